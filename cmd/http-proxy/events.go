@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// writeEvents writes every flow event of store to path as one JSON line,
+// the same objects the web UI receives over its WebSocket, until ctx is done.
+// path "-" is stdout. A named pipe is reopened whenever its reader goes
+// away, so consumers can come and go while the proxy runs; events while
+// nobody is reading are dropped.
+func writeEvents(ctx context.Context, store *proxy.FlowStore, path string) error {
+	if path == "-" {
+		return copyEvents(ctx, store, os.Stdout)
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open events file: %w", err)
+		}
+		defer f.Close()
+		if err := copyEvents(ctx, store, f); err != nil {
+			fmt.Fprintf(os.Stderr, "events: %v; no longer writing %s\n", err, path)
+		}
+		return nil
+	}
+
+	for ctx.Err() == nil {
+		f, err := openFIFO(ctx, path)
+		if err != nil {
+			return fmt.Errorf("open events pipe: %w", err)
+		}
+		if f == nil {
+			return nil
+		}
+		_ = copyEvents(ctx, store, f)
+		f.Close()
+	}
+	return nil
+}
+
+// openFIFO opens the named pipe at path for writing once a reader has opened
+// it. It returns nil, nil if ctx is done first.
+func openFIFO(ctx context.Context, path string) (*os.File, error) {
+	for {
+		// Without O_NONBLOCK, open blocks until a reader appears and can't
+		// be interrupted; with it, open fails with ENXIO until then.
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, syscall.ENXIO) {
+			return nil, err
+		}
+		select {
+		case <-time.After(250 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+// copyEvents writes store events to w until ctx is done or a write fails.
+// Events already queued when ctx is done are still written.
+func copyEvents(ctx context.Context, store *proxy.FlowStore, w io.Writer) error {
+	ch := store.Subscribe()
+	defer store.Unsubscribe(ch)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for {
+		select {
+		case evt := <-ch:
+			if err := enc.Encode(evt); err != nil {
+				return err
+			}
+			// Flush once the burst is written, so readers see events live.
+			if len(ch) == 0 {
+				if err := bw.Flush(); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			for len(ch) > 0 {
+				if err := enc.Encode(<-ch); err != nil {
+					return err
+				}
+			}
+			return bw.Flush()
+		}
+	}
+}
+
+// logShutdown prints the engine's shutdown notices to stderr until ctx is
+// done, so a headless proxy says what it is waiting for on the way out.
+func logShutdown(ctx context.Context, store *proxy.FlowStore) error {
+	ch := store.Subscribe()
+	defer store.Unsubscribe(ch)
+	for {
+		select {
+		case evt := <-ch:
+			if evt.Type == proxy.FlowEventShutdown {
+				fmt.Fprintln(os.Stderr, evt.Message)
+			}
+		case <-ctx.Done():
+			for len(ch) > 0 {
+				if evt := <-ch; evt.Type == proxy.FlowEventShutdown {
+					fmt.Fprintln(os.Stderr, evt.Message)
+				}
+			}
+			return nil
+		}
+	}
+}
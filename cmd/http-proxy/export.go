@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fidiego/http-proxy/pkg/codegen"
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export SESSION",
+	Short: "Convert a session file to Go tests, HAR, native JSON, mitmproxy, or CSV",
+	Long: `export reads a session file (native, hpz, HAR, or mitmproxy) and writes
+its flows in another format:
+
+  gotest   a Go test file with an httptest stub server serving the captured
+           responses and a table-driven test replaying the captured requests
+  har      HTTP Archive 1.2
+  native   http-proxy's own JSON session format
+  hpz      the native format, gzip-compressed
+  mitm     mitmproxy's flow file format (mitmproxy -r, mitmweb)
+  csv      one row per flow with its status, timings, sizes, and tags,
+           for spreadsheets (export only)
+  k6       a k6 load-test script sending the captured requests in order
+  vegeta   vegeta JSON targets (vegeta attack -format=json)
+
+Load-test output keeps each flow's host unless --base-url is given; with
+--timing, the k6 script waits so requests start at their recorded offsets.
+
+Examples:
+  http-proxy export session.json --filter '~p /api' -o api_test.go
+  http-proxy export session.hpz --format k6 --timing -o load.js`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Convert a HAR or mitmproxy flow file into a session file",
+	Long: `import reads flows saved by another tool (a HAR file, or a mitmproxy flow
+file written by mitmproxy -w or mitmweb's Save) and writes them as a session
+that open, replay, and export accept. Non-HTTP mitmproxy flows are skipped.
+
+The output format is inferred from --out's extension (default: FILE with
+the extension replaced by .hpz).
+
+Example:
+  http-proxy import flows.mitm -o session.hpz`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+var (
+	flagExportFormat  string
+	flagExportOut     string
+	flagExportFilter  string
+	flagExportPackage string
+	flagExportBaseURL string
+	flagExportTiming  bool
+	flagImportOut     string
+)
+
+func init() {
+	exportCmd.Flags().StringVar(&flagExportFormat, "format", "gotest",
+		"output format: gotest, har, native, hpz, mitm, csv, k6, or vegeta")
+	exportCmd.Flags().StringVarP(&flagExportOut, "out", "o", "",
+		"file to write (default: stdout)")
+	exportCmd.Flags().StringVar(&flagExportFilter, "filter", "",
+		"only export flows matching this filter expression")
+	exportCmd.Flags().StringVar(&flagExportPackage, "package", codegen.DefaultPackage,
+		"package clause for --format gotest")
+	exportCmd.Flags().StringVar(&flagExportBaseURL, "base-url", "",
+		"scheme and host for k6 and vegeta requests (default: each flow's host)")
+	exportCmd.Flags().BoolVar(&flagExportTiming, "timing", false,
+		"keep the recorded gaps between requests in k6 scripts")
+	importCmd.Flags().StringVarP(&flagImportOut, "out", "o", "",
+		"session file to write (default: FILE with a .hpz extension)")
+}
+
+func runExport(_ *cobra.Command, args []string) error {
+	flows, err := session.Load(args[0])
+	if err != nil {
+		return err
+	}
+	if flagExportFilter != "" {
+		match, err := filter.Parse(flagExportFilter)
+		if err != nil {
+			return fmt.Errorf("invalid --filter: %w", err)
+		}
+		var kept []*proxy.Flow
+		for _, f := range flows {
+			if match(f) {
+				kept = append(kept, f)
+			}
+		}
+		flows = kept
+	}
+
+	var out io.Writer = os.Stdout
+	if flagExportOut != "" {
+		f, err := os.Create(flagExportOut)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var src []byte
+	lopts := codegen.LoadTestOptions{BaseURL: flagExportBaseURL, KeepTiming: flagExportTiming}
+	switch strings.ToLower(flagExportFormat) {
+	case "gotest":
+		src, err = codegen.GoTest(flows, flagExportPackage)
+	case "k6":
+		src, err = codegen.K6(flows, lopts)
+	case "vegeta":
+		src, err = codegen.Vegeta(flows, lopts)
+	case "csv":
+		return session.WriteCSV(out, flows)
+	default:
+		format, err := session.ParseFormat(flagExportFormat)
+		if err != nil {
+			return err
+		}
+		return session.Write(out, flows, format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(src)
+	return err
+}
+
+func runImport(_ *cobra.Command, args []string) error {
+	flows, err := session.Load(args[0])
+	if err != nil {
+		return err
+	}
+	out := flagImportOut
+	if out == "" {
+		out = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".hpz"
+	}
+	if err := session.Save(out, flows, session.FormatForPath(out)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d flows to %s\n", len(flows), out)
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/fidiego/http-proxy/pkg/addons"
+	"github.com/fidiego/http-proxy/pkg/client"
+	"github.com/fidiego/http-proxy/pkg/curl"
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+var flowsCmd = &cobra.Command{
+	Use:   "flows",
+	Short: "Print the flows of a running proxy",
+	Long: `flows queries a running proxy through its control API and prints the
+flows matching --filter, oldest first:
+
+  table  one line per flow, as in the headless log (default)
+  json   one JSON flow per line, for jq
+  curl   a curl command per flow, to re-send the request through the proxy
+
+--follow keeps printing flows as they complete, like tail -f. With --limit,
+only the newest flows are printed first.
+
+The proxy is reached at --api, or else on localhost at the web port set by
+the config file and flags, using the web_auth or web_token credentials from
+there.
+
+Examples:
+  http-proxy flows --filter '~s 5'
+  http-proxy flows --format json --limit 20 | jq .request.url
+  http-proxy flows --follow --filter '~p /checkout'`,
+	Args: cobra.NoArgs,
+	RunE: runFlows,
+}
+
+var (
+	flagAPI         string
+	flagFlowsFilter string
+	flagFlowsFormat string
+	flagFlowsLimit  int
+	flagFlowsFollow bool
+)
+
+func init() {
+	flowsCmd.Flags().StringVar(&flagAPI, "api", "",
+		"web UI address of the running proxy (default: http://localhost:WEB_PORT)")
+	flowsCmd.Flags().StringVar(&flagFlowsFilter, "filter", "",
+		"only print flows matching this filter expression")
+	flowsCmd.Flags().StringVar(&flagFlowsFormat, "format", "table",
+		"output format: table, json, or curl")
+	flowsCmd.Flags().IntVarP(&flagFlowsLimit, "limit", "n", 0,
+		"print only the newest N flows (0: all)")
+	flowsCmd.Flags().BoolVarP(&flagFlowsFollow, "follow", "f", false,
+		"keep printing flows as they complete")
+}
+
+// apiClient returns a client for the running proxy named by --api, or else
+// the one the config file and flags describe. With auto_port, the web port
+// is taken from the info file, since the proxy may have bound another.
+func apiClient(cmd *cobra.Command) (*client.Client, error) {
+	opts, ui, err := resolveOptions(cmd)
+	if err != nil && !errors.Is(err, errNoUpstreams) {
+		return nil, err
+	}
+	addr := flagAPI
+	if addr == "" && opts.AutoPort {
+		if info, err := proxy.ReadInfoFile(ui.infoFile); err == nil {
+			addr = info.WebURL
+		}
+	}
+	if addr == "" {
+		port := opts.WebPort
+		switch {
+		case port == 0:
+			port = proxy.DefaultWebPort
+		case port < 0:
+			return nil, fmt.Errorf("the web UI is disabled (web_port); pass --api")
+		}
+		addr = fmt.Sprintf("http://localhost:%d", port)
+	}
+	c := client.New(addr)
+	c.Token = opts.WebAuth.Token
+	c.User, c.Password = opts.WebAuth.User, opts.WebAuth.Password
+	return c, nil
+}
+
+func runFlows(cmd *cobra.Command, _ []string) error {
+	emit, err := flowPrinter(os.Stdout, flagFlowsFormat)
+	if err != nil {
+		return err
+	}
+	match, err := filter.Parse(flagFlowsFilter)
+	if err != nil {
+		return fmt.Errorf("invalid --filter: %w", err)
+	}
+	c, err := apiClient(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Subscribe before listing so no flow completes unseen in between.
+	var events <-chan proxy.FlowEvent
+	if flagFlowsFollow {
+		if events, err = c.Events(ctx); err != nil {
+			return err
+		}
+	}
+	opts := client.ListOptions{Filter: flagFlowsFilter}
+	if flagFlowsLimit > 0 {
+		opts.Limit, opts.Desc = flagFlowsLimit, true
+	}
+	flows, err := c.Flows(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Desc {
+		slices.Reverse(flows)
+	}
+	seen := make(map[string]bool, len(flows))
+	for _, f := range flows {
+		seen[f.ID] = true
+		emit(f)
+	}
+	if events == nil {
+		return nil
+	}
+
+	for evt := range events {
+		f := evt.Flow
+		if f == nil || (evt.Type != proxy.FlowEventComplete && evt.Type != proxy.FlowEventError) {
+			continue
+		}
+		if !seen[f.ID] && match(f) {
+			emit(f)
+		}
+	}
+	if ctx.Err() == nil {
+		return fmt.Errorf("lost connection to %s", c.BaseURL)
+	}
+	return nil
+}
+
+// flowPrinter returns a function writing flows to w in format.
+func flowPrinter(w io.Writer, format string) (func(*proxy.Flow), error) {
+	switch format {
+	case "table":
+		log := addons.NewLogAddon(w, flagNoColor || !isTerminal())
+		return log.OnComplete, nil
+	case "json":
+		enc := json.NewEncoder(w)
+		return func(f *proxy.Flow) { _ = enc.Encode(f) }, nil
+	case "curl":
+		return func(f *proxy.Flow) {
+			if f.Request != nil {
+				fmt.Fprintln(w, curl.Command(f.Request))
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown --format %q: want table, json, or curl", format)
+}
+
+// runReplayFlows is replay for flow IDs or --filter: it has the running proxy
+// replay each flow --count times and summarises the response statuses.
+func runReplayFlows(cmd *cobra.Command, ids []string) error {
+	switch {
+	case flagReplayFilter != "" && len(ids) > 0:
+		return fmt.Errorf("pass flow IDs or --filter, not both")
+	case flagReplayFilter == "" && len(ids) == 0:
+		return fmt.Errorf("replay needs a session file, flow IDs, or --filter")
+	case flagReplayCount < 1:
+		return fmt.Errorf("--count must be >= 1")
+	case flagReplayConc < 1:
+		return fmt.Errorf("--concurrency must be >= 1")
+	}
+	assert, err := replayAssertions()
+	if err != nil {
+		return err
+	}
+	c, err := apiClient(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if flagReplayFilter != "" {
+		flows, err := c.Flows(ctx, client.ListOptions{Filter: flagReplayFilter})
+		if err != nil {
+			return err
+		}
+		for _, f := range flows {
+			ids = append(ids, f.ID)
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("no flows match %q", flagReplayFilter)
+		}
+	}
+
+	emit, _ := flowPrinter(os.Stdout, "table")
+	var (
+		mu       sync.Mutex
+		statuses = map[string]int{}
+		failed   int
+		tally    assertTally
+	)
+	g := new(errgroup.Group)
+	g.SetLimit(flagReplayConc)
+	opts := client.ReplayOptions{Target: flagReplayTarget, Assert: assert}
+	for _, id := range ids {
+		for range flagReplayCount {
+			if ctx.Err() != nil {
+				break
+			}
+			g.Go(func() error {
+				f, err := c.Replay(ctx, id, opts)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err != nil:
+					failed++
+					fmt.Fprintf(os.Stderr, "replay %s: %v\n", id, err)
+				case f.Response != nil:
+					statuses[strconv.Itoa(f.Response.StatusCode)]++
+					emit(f)
+				default:
+					statuses["error"]++
+					emit(f)
+				}
+				if err == nil {
+					tally.add(f)
+				}
+				return nil
+			})
+		}
+	}
+	_ = g.Wait()
+
+	var total int
+	var summary []string
+	for _, status := range slices.Sorted(maps.Keys(statuses)) {
+		total += statuses[status]
+		summary = append(summary, fmt.Sprintf("%s: %d", status, statuses[status]))
+	}
+	fmt.Fprintf(os.Stderr, "replayed %d requests (%d failed)", total, failed)
+	if len(summary) > 0 {
+		fmt.Fprintf(os.Stderr, " — %s", strings.Join(summary, ", "))
+	}
+	fmt.Fprintln(os.Stderr)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d replays could not be started", failed)
+	}
+	if err := tally.report(); err != nil {
+		// A failed assertion isn't a usage error, and the tally above
+		// already says how many failed.
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return err
+	}
+	return nil
+}
@@ -2,18 +2,29 @@ package main
 
 import (
 	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/fidiego/http-proxy/pkg/addons"
 	"github.com/fidiego/http-proxy/pkg/config"
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/format"
 	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/qr"
+	"github.com/fidiego/http-proxy/pkg/session"
 	"github.com/fidiego/http-proxy/pkg/tui"
 	"github.com/fidiego/http-proxy/pkg/web"
 )
@@ -51,76 +62,431 @@ var initCmd = &cobra.Command{
 	},
 }
 
+var webCmd = &cobra.Command{
+	Use:   "web",
+	Short: "Run the proxy with the web UI and no terminal UI",
+	Long: `web runs the proxy headless, for working in the browser.
+
+--dev serves the web UI from pkg/web/static in the source tree the binary
+was built from (or from --web-ui-dir) and re-reads the files on every
+request, so changes to the UI show up on reload without rebuilding.
+
+Example:
+  go run ./cmd/http-proxy web --dev --upstream http://localhost:8081`,
+	Args: cobra.NoArgs,
+	RunE: runWeb,
+}
+
+var flagWebDev bool
+
+func runWeb(cmd *cobra.Command, _ []string) error {
+	opts, ui, err := loadOptions(cmd)
+	if err != nil {
+		return err
+	}
+	ui.noTUI = true
+	if flagWebDev && ui.webUIDir == "" {
+		if ui.webUIDir, err = web.SourceDir(); err != nil {
+			return err
+		}
+	}
+	return serve(opts, ui, nil)
+}
+
 var (
-	flagConfig   string
-	flagListen   string
-	flagUpstream string
-	flagRoutes   []string
-	flagWebPort  int
-	flagMaxFlows int
-	flagNoTUI    bool
-	flagNoColor  bool
+	flagConfig    string
+	flagProfile   string
+	flagListen    []string
+	flagUpstream  string
+	flagRoutes    []string
+	flagWebPort   int
+	flagAutoPort  bool
+	flagPrint     bool
+	flagQR        bool
+	flagInfoFile  string
+	flagMaxFlows  int
+	flagNoTUI     bool
+	flagNoColor   bool
+	flagTLS       bool
+	flagTLSCert   string
+	flagTLSKey    string
+	flagCertDir   string
+	flagHTTP2     bool
+	flagShutdown  time.Duration
+	flagMode      string
+	flagMITM      bool
+	flagCache     bool
+	flagOffline   bool
+	flagCacheFile string
+	flagPersist   string
+	flagReload    int
+	flagLogFormat string
+	flagLogFile   string
+	flagEvents    string
+	flagIgnore    []string
+	flagRecord    string
+	flagWebUIDir  string
+	flagProtos    []string
+	flagCORS      bool
+	flagAlertLat  time.Duration
+	flagAlertCode []string
+	flagSample    float64
+	flagNetwork   string
+	flagMaxStore  int64
+	flagSpill     int64
+	flagCompress  int64
+	flagCompAlg   string
 )
 
 func init() {
-	rootCmd.Flags().StringVar(&flagConfig, "config", "",
+	// Proxy flags are persistent so subcommands that run an engine (record,
+	// replay) share config loading with the root command.
+	pf := rootCmd.PersistentFlags()
+	pf.StringVar(&flagConfig, "config", "",
 		"path to config file (default: proxy.yml in current directory)")
-	rootCmd.Flags().StringVar(&flagListen, "listen", "",
-		"proxy listen address (default: :9090)")
-	rootCmd.Flags().StringVar(&flagUpstream, "upstream", "",
+	pf.StringVar(&flagProfile, "profile", "",
+		"use the profile `NAME`: its config, saved views, and sessions (see http-proxy profile)")
+	pf.StringArrayVar(&flagListen, "listen", nil,
+		"proxy listen address, or unix:///path for a Unix socket; repeatable (default: :9090)")
+	pf.StringVar(&flagUpstream, "upstream", "",
 		"single upstream target URL (e.g. http://localhost:8081)")
-	rootCmd.Flags().StringArrayVar(&flagRoutes, "route", nil,
+	pf.StringArrayVar(&flagRoutes, "route", nil,
 		"path-routed upstream in PREFIX=TARGET form (e.g. /api=http://localhost:8081); repeatable")
-	rootCmd.Flags().IntVar(&flagWebPort, "web-port", 0,
+	pf.IntVar(&flagWebPort, "web-port", 0,
 		"port for web inspection UI (default: 9091; set to 0 to disable)")
-	rootCmd.Flags().IntVar(&flagMaxFlows, "max-flows", 0,
+	pf.BoolVar(&flagAutoPort, "auto-port", false,
+		"if the listen or web port is busy, use the next free one")
+	pf.BoolVar(&flagPrint, "print-ports", false,
+		"print where the proxy bound as one JSON line on stdout once listening")
+	pf.BoolVar(&flagQR, "qr", false,
+		"show a QR code of the proxy's LAN address at startup, for pointing a phone at it")
+	pf.StringVar(&flagInfoFile, "info-file", "",
+		"write where the proxy bound to this JSON file while running (default: running.json in the user config dir)")
+	pf.IntVar(&flagMaxFlows, "max-flows", 0,
 		"maximum number of flows to keep in memory (default: 1000)")
-	rootCmd.Flags().BoolVar(&flagNoTUI, "no-tui", false,
+	pf.Int64Var(&flagMaxStore, "max-store-bytes", 0,
+		"also evict the oldest flows while their bodies in memory exceed this many bytes")
+	pf.Int64Var(&flagSpill, "spill-threshold", 0,
+		"move captured bodies larger than this many bytes to temporary files")
+	pf.Int64Var(&flagCompress, "compress-threshold", 0,
+		"keep captured bodies larger than this many bytes compressed in memory")
+	pf.StringVar(&flagCompAlg, "compress-algorithm", "",
+		`algorithm for --compress-threshold: "gzip" (default) or "zstd"`)
+	pf.BoolVar(&flagNoTUI, "no-tui", false,
 		"disable the interactive terminal UI (log to stdout only)")
-	rootCmd.Flags().BoolVar(&flagNoColor, "no-color", false,
+	pf.BoolVar(&flagNoColor, "no-color", false,
 		"disable ANSI colours in log output")
+	pf.BoolVar(&flagTLS, "tls", false,
+		"serve the proxy over HTTPS using a locally generated certificate")
+	pf.StringVar(&flagTLSCert, "tls-cert", "",
+		"PEM certificate for --tls (default: issued by the local CA)")
+	pf.StringVar(&flagTLSKey, "tls-key", "",
+		"PEM private key for --tls-cert")
+	pf.StringVar(&flagCertDir, "cert-dir", "",
+		"directory for the generated local CA (default: user cache dir)")
+	pf.BoolVar(&flagHTTP2, "http2", false,
+		"serve HTTP/2 on the listener (h2 with --tls, cleartext h2c otherwise)")
+	pf.DurationVar(&flagShutdown, "shutdown-timeout", 0,
+		"how long to wait for in-flight flows on exit (default 5s)")
+	pf.StringVar(&flagMode, "mode", "",
+		`proxy mode: "reverse" (route to upstreams) or "forward" (HTTP_PROXY for clients)`)
+	pf.BoolVar(&flagMITM, "mitm", false,
+		"in forward mode, decrypt HTTPS tunnels using the local CA")
+	pf.BoolVar(&flagCORS, "cors", false,
+		"rewrite CORS headers to allow any origin and answer preflights in the proxy")
+	pf.DurationVar(&flagAlertLat, "alert-latency", 0,
+		"tag flows slower than this as alert:latency (e.g. 500ms)")
+	pf.StringSliceVar(&flagAlertCode, "alert-status", nil,
+		"tag flows with these statuses as alert:status (e.g. 5xx,429)")
+	pf.Float64Var(&flagSample, "sample-rate", 1,
+		"fraction of flows to store (e.g. 0.1); all are still proxied and counted in stats")
+	pf.StringVar(&flagNetwork, "network", "",
+		"simulate a network profile for every upstream (slow-3g, 3g, lte, flaky-wifi, or one from the config)")
+
+	pf.BoolVar(&flagCache, "cache", false,
+		"serve previously captured responses when an upstream is unreachable")
+	pf.BoolVar(&flagOffline, "offline", false,
+		"serve every request from the response cache; never contact upstreams")
+	pf.StringVar(&flagCacheFile, "cache-file", "",
+		"session file to seed the response cache from and save it to")
+	pf.StringVar(&flagPersist, "persist", "",
+		"append every finished flow to this journal database, to keep flows across restarts")
+	pf.IntVar(&flagReload, "persist-reload", 0,
+		"load the last N flows of the --persist journal on start")
+	pf.StringVar(&flagLogFormat, "log-format", "",
+		`access log format: "text" or "json" (one object per line)`)
+	pf.StringVar(&flagLogFile, "log-file", "",
+		"append the access log to this file instead of stdout")
+	pf.StringVar(&flagEvents, "events-ndjson", "",
+		`write every flow event as a JSON line to this file or FIFO, or "-" for stdout`)
+	pf.StringArrayVar(&flagIgnore, "ignore", nil,
+		"proxy requests matching this filter expression without capturing them; repeatable")
+	pf.StringVar(&flagRecord, "record-filter", "",
+		"store only flows matching this filter expression, checked on arrival and on completion")
+	pf.StringVar(&flagWebUIDir, "web-ui-dir", "",
+		"serve the web UI from this directory instead of the embedded copy")
+	pf.StringArrayVar(&flagProtos, "proto-descriptor", nil,
+		"protobuf descriptor set naming the fields of protobuf and gRPC bodies; repeatable")
+	webCmd.Flags().BoolVar(&flagWebDev, "dev", false,
+		"serve the web UI from the source tree, re-read on every request")
+	rootCmd.AddCommand(initCmd, webCmd, recordCmd, replayCmd, openCmd, mockCmd, exportCmd, importCmd, flowsCmd, profileCmd)
+}
+
+// uiOptions are CLI settings that are handled outside the engine: presentation
+// and the addons serve registers.
+type uiOptions struct {
+	noTUI   bool
+	noColor bool
 
-	rootCmd.AddCommand(initCmd)
+	// tui lays out the TUI's flow table.
+	tui tui.Options
+
+	// webUIDir, if set, is served as the web UI instead of the embedded copy.
+	webUIDir string
+
+	// protoDescriptors are loaded into pkg/format to decode protobuf bodies.
+	protoDescriptors []string
+
+	// logFormat and logFile configure the access log addon.
+	logFormat string
+	logFile   string
+	// events, if set, is where flow events are written as NDJSON ("-": stdout).
+	events string
+
+	// infoFile receives the proxy's Info while it runs; printPorts also
+	// prints it once listening.
+	infoFile   string
+	printPorts bool
+
+	// qr shows a QR code of the proxy's LAN address at startup.
+	qr bool
+
+	// jwt holds keys for the JWT addon's signature checks.
+	jwt config.JWTConfig
+
+	// cache, offline, and cacheFile configure the response cache addon.
+	cache     bool
+	offline   bool
+	cacheFile string
+
+	// persist configures the flow journal.
+	persist config.PersistConfig
+
+	// sinks upload finished flows to HTTP endpoints or S3 buckets.
+	sinks []config.SinkConfig
+
+	// inject inserts HTML snippets into matching pages.
+	inject []config.InjectConfig
+
+	// configPath is the loaded config file, watched for changes; empty if none.
+	configPath string
+	// reload re-resolves options from the config file and CLI flags.
+	reload func() (proxy.Options, error)
 }
 
 func run(cmd *cobra.Command, _ []string) error {
+	opts, ui, err := loadOptions(cmd)
+	if err != nil {
+		return err
+	}
+	return serve(opts, ui, nil)
+}
+
+// loadOptions resolves engine options from defaults, the config file, and
+// explicitly set CLI flags, in that order.
+func loadOptions(cmd *cobra.Command) (proxy.Options, uiOptions, error) {
+	opts, ui, err := resolveOptions(cmd)
+	if err != nil {
+		return opts, ui, err
+	}
+	if ui.configPath != "" {
+		fmt.Fprintf(os.Stderr, "loaded config: %s\n", ui.configPath)
+	}
+	ui.reload = func() (proxy.Options, error) {
+		opts, _, err := resolveOptions(cmd)
+		return opts, err
+	}
+	return opts, ui, nil
+}
+
+// resolveOptions does the work of loadOptions without printing, so it can be
+// re-run when the config file changes.
+func resolveOptions(cmd *cobra.Command) (proxy.Options, uiOptions, error) {
 	// 1. Start from an empty options struct; proxy.New will apply defaults.
 	opts := proxy.Options{}
 
-	// 2. Load config file.
+	// 2. Load config file: --config, else the profile's, else proxy.yml.
+	var profile config.Profile
+	if flagProfile != "" {
+		p, err := config.OpenProfile(flagProfile)
+		if err != nil {
+			return opts, uiOptions{}, err
+		}
+		profile = p
+	}
 	cfgPath := flagConfig
+	if cfgPath == "" && profile.Name != "" {
+		cfgPath = profile.ConfigPath()
+	}
 	if cfgPath == "" {
 		cfgPath = config.FindDefault(".")
 	}
-	noTUI := false
-	noColor := false
+	var ui uiOptions
 	if cfgPath != "" {
 		cfg, err := config.Load(cfgPath)
 		if err != nil {
-			return err
+			return opts, uiOptions{}, err
 		}
-		fmt.Fprintf(os.Stderr, "loaded config: %s\n", cfgPath)
 		opts = cfg.ToOptions()
-		noTUI = cfg.NoTUI
-		noColor = cfg.NoColor
+		ui = uiOptions{
+			noTUI:     cfg.NoTUI,
+			noColor:   cfg.NoColor,
+			tui:       tui.Options{Columns: cfg.TUI.Columns, Sort: cfg.TUI.Sort},
+			logFormat: cfg.Log.Format,
+			logFile:   cfg.Log.File,
+			events:    cfg.Log.Events,
+			infoFile:  cfg.InfoFile,
+			jwt:       cfg.JWT,
+			cache:     cfg.Cache,
+			offline:   cfg.Offline,
+			cacheFile: cfg.CacheFile,
+			persist:   cfg.Persist,
+			sinks:     cfg.Sinks,
+			inject:    cfg.Inject,
+			webUIDir:  cfg.WebUIDir,
+
+			protoDescriptors: append(cfg.Descriptors, cfg.ProtoDescriptors...),
+		}
 	}
 
 	// 3. CLI flags override config file values (only when explicitly set).
 	f := cmd.Flags()
 	if f.Changed("listen") {
-		opts.ListenAddr = flagListen
+		opts.ListenAddr = flagListen[0]
+		opts.ExtraListenAddrs = flagListen[1:]
 	}
 	if f.Changed("web-port") {
 		opts.WebPort = flagWebPort
 	}
+	if f.Changed("auto-port") {
+		opts.AutoPort = flagAutoPort
+	}
+	if f.Changed("info-file") {
+		ui.infoFile = flagInfoFile
+	}
+	ui.printPorts = flagPrint
+	ui.qr = flagQR
 	if f.Changed("max-flows") {
 		opts.MaxFlows = flagMaxFlows
 	}
+	if f.Changed("max-store-bytes") {
+		opts.MaxStoreBytes = flagMaxStore
+	}
+	if f.Changed("spill-threshold") {
+		opts.SpillThreshold = flagSpill
+	}
+	if f.Changed("compress-threshold") {
+		opts.CompressThreshold = flagCompress
+	}
+	if f.Changed("compress-algorithm") {
+		opts.CompressAlgorithm = flagCompAlg
+	}
 	if f.Changed("no-tui") {
-		noTUI = flagNoTUI
+		ui.noTUI = flagNoTUI
 	}
 	if f.Changed("no-color") {
-		noColor = flagNoColor
+		ui.noColor = flagNoColor
+	}
+	if f.Changed("log-format") {
+		ui.logFormat = flagLogFormat
+	}
+	if f.Changed("log-file") {
+		ui.logFile = flagLogFile
+	}
+	if f.Changed("events-ndjson") {
+		ui.events = flagEvents
+	}
+	if f.Changed("web-ui-dir") {
+		ui.webUIDir = flagWebUIDir
+	}
+	if f.Changed("proto-descriptor") {
+		ui.protoDescriptors = flagProtos
+	}
+	if err := format.LoadProtoDescriptors(ui.protoDescriptors...); err != nil {
+		return opts, uiOptions{}, fmt.Errorf("proto descriptors: %w", err)
+	}
+	if err := ui.tui.Validate(); err != nil {
+		return opts, uiOptions{}, fmt.Errorf("tui: %w", err)
+	}
+	switch ui.logFormat {
+	case "", "text", "json":
+	default:
+		return opts, uiOptions{}, fmt.Errorf(`unknown log format %q (want "text" or "json")`, ui.logFormat)
+	}
+	if f.Changed("cache") {
+		ui.cache = flagCache
+	}
+	if f.Changed("offline") {
+		ui.offline = flagOffline
+	}
+	if f.Changed("cache-file") {
+		ui.cacheFile = flagCacheFile
+	}
+	if f.Changed("persist") {
+		ui.persist.Path = flagPersist
+	}
+	if f.Changed("persist-reload") {
+		ui.persist.Reload = flagReload
+	}
+	if f.Changed("tls") {
+		opts.TLS = flagTLS
+	}
+	if f.Changed("tls-cert") {
+		opts.TLSCertFile = flagTLSCert
+	}
+	if f.Changed("tls-key") {
+		opts.TLSKeyFile = flagTLSKey
+	}
+	if f.Changed("cert-dir") {
+		opts.CertDir = flagCertDir
+	}
+	if f.Changed("http2") {
+		opts.HTTP2 = flagHTTP2
+	}
+	if f.Changed("shutdown-timeout") {
+		opts.ShutdownTimeout = flagShutdown
+	}
+	if f.Changed("mode") {
+		opts.Mode = flagMode
+	}
+	if f.Changed("mitm") {
+		opts.MITM = flagMITM
+	}
+	if f.Changed("cors") {
+		opts.CORS = nil
+		if flagCORS {
+			opts.CORS = &proxy.CORS{AllowCredentials: true}
+		}
+	}
+	if f.Changed("sample-rate") {
+		opts.SampleRate = flagSample
+	}
+	if f.Changed("network") {
+		opts.Network = flagNetwork
+	}
+	if f.Changed("alert-latency") || f.Changed("alert-status") {
+		// Flags set the global thresholds, keeping any notifications.
+		a := proxy.Alerts{}
+		if opts.Alerts != nil {
+			a = *opts.Alerts
+		}
+		if f.Changed("alert-latency") {
+			a.Latency = flagAlertLat
+		}
+		if f.Changed("alert-status") {
+			a.Status = flagAlertCode
+		}
+		opts.Alerts = &a
 	}
 
 	// --upstream and --route replace (not merge with) the config file's upstreams
@@ -128,48 +494,501 @@ func run(cmd *cobra.Command, _ []string) error {
 	if f.Changed("upstream") || f.Changed("route") {
 		cliUpstreams, err := buildUpstreams()
 		if err != nil {
-			return err
+			return opts, uiOptions{}, err
 		}
 		opts.Upstreams = cliUpstreams
 	}
 
-	if len(opts.Upstreams) == 0 {
-		return fmt.Errorf("at least one upstream is required (use --upstream, --route, or a config file)")
+	for _, v := range opts.Views {
+		if _, err := filter.Parse(v.Filter); err != nil {
+			return opts, uiOptions{}, fmt.Errorf("view %q: invalid filter: %w", v.Name, err)
+		}
+	}
+	for _, expr := range flagIgnore {
+		opts.Ignore = append(opts.Ignore, proxy.IgnoreRule{Filter: expr})
+	}
+	for i, ig := range opts.Ignore {
+		match, err := filter.Parse(ig.Filter)
+		if err != nil {
+			return opts, uiOptions{}, fmt.Errorf("ignore %q: invalid filter: %w", ig.Filter, err)
+		}
+		opts.Ignore[i].Match = proxy.Matcher(match)
+	}
+	for i, j := range opts.Jobs {
+		if j.Filter == "" {
+			continue
+		}
+		match, err := filter.Parse(j.Filter)
+		if err != nil {
+			return opts, uiOptions{}, fmt.Errorf("job %q: invalid filter: %w", j.Name, err)
+		}
+		opts.Jobs[i].Match = proxy.Matcher(match)
+	}
+	if f.Changed("record-filter") {
+		opts.Record = nil
+		if flagRecord != "" {
+			opts.Record = &proxy.RecordFilter{Filter: flagRecord}
+		}
+	}
+	if opts.Record != nil {
+		match, err := filter.Parse(opts.Record.Filter)
+		if err != nil {
+			return opts, uiOptions{}, fmt.Errorf("record_filter %q: invalid filter: %w", opts.Record.Filter, err)
+		}
+		opts.Record.Match = proxy.Matcher(match)
+	}
+	for i, b := range opts.Breakpoints {
+		if b.Filter == "" {
+			continue
+		}
+		match, err := filter.Parse(b.Filter)
+		if err != nil {
+			return opts, uiOptions{}, fmt.Errorf("breakpoint %q: invalid filter: %w", b.Filter, err)
+		}
+		opts.Breakpoints[i].Match = proxy.Matcher(match)
+	}
+	for i, t := range opts.Transforms {
+		if t.Filter == "" {
+			continue
+		}
+		match, err := filter.Parse(t.Filter)
+		if err != nil {
+			return opts, uiOptions{}, fmt.Errorf("transform %q: invalid filter: %w", t.Filter, err)
+		}
+		opts.Transforms[i].Match = proxy.Matcher(match)
+	}
+	if profile.Name != "" {
+		if opts.StateFile == "" {
+			opts.StateFile = profile.StateFile()
+		}
+		if ui.infoFile == "" {
+			ui.infoFile = profile.InfoFile()
+		}
+		ui.tui.Profile = profile.Name
+		ui.tui.SessionDir = profile.SessionDir()
+	}
+	if opts.StateFile == "" {
+		opts.StateFile = proxy.DefaultStateFile()
+	}
+	if ui.infoFile == "" {
+		ui.infoFile = proxy.DefaultInfoFile()
+	}
+
+	if opts.WebAuth.Password != "" && opts.WebAuth.User == "" {
+		return opts, uiOptions{}, fmt.Errorf("web_auth: user is required")
+	}
+	if opts.MITM && opts.Mode != proxy.ModeForward {
+		return opts, uiOptions{}, fmt.Errorf("--mitm requires --mode forward")
+	}
+	ui.configPath = cfgPath
+	// open inspects a saved session and mock serves one, so they can run
+	// without upstreams.
+	if opts.Mode != proxy.ModeForward && len(opts.Upstreams) == 0 && len(opts.Mocks) == 0 &&
+		cmd.Name() != "open" && cmd.Name() != "mock" {
+		return opts, ui, errNoUpstreams
+	}
+	return opts, ui, nil
+}
+
+// openJournal opens the flow journal, compacting it if needed, loads its
+// latest flows into the store, and registers the addon that appends
+// finished flows to it.
+func openJournal(engine *proxy.Engine, p config.PersistConfig) (*addons.JournalAddon, error) {
+	if p.Reload < 0 || p.MaxBytes < 0 {
+		return nil, fmt.Errorf("persist reload and max_bytes must be >= 0")
+	}
+	maxBytes := p.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = config.DefaultJournalMaxBytes
+	}
+	j, compacted, err := session.OpenJournal(p.Path, maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	if compacted {
+		fmt.Fprintf(os.Stderr, "journal: compacted %s to its newest flows\n", p.Path)
+	}
+	flows, err := j.Latest(p.Reload)
+	if err != nil {
+		j.Close()
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	reloaded := 0
+	for _, f := range flows {
+		if engine.Excludes(f) {
+			continue // journaled before an ignore rule or record filter left it out
+		}
+		engine.Store().Add(f)
+		reloaded++
+	}
+	journal := addons.NewJournalAddon(j)
+	engine.Addons().Add(journal)
+	fmt.Fprintf(os.Stderr, "journal: %s, reloaded %d flows\n", p.Path, reloaded)
+	return journal, nil
+}
+
+// newSinkAddon builds the addon uploading flows to the sink sc describes.
+func newSinkAddon(sc config.SinkConfig) (*addons.SinkAddon, error) {
+	if sc.Name == "" {
+		return nil, fmt.Errorf("sink: name is required")
+	}
+	if !addons.ValidSinkFormat(sc.Format) {
+		return nil, fmt.Errorf("sink %q: format must be ndjson or har", sc.Name)
+	}
+	if sc.Batch < 0 || sc.Interval < 0 {
+		return nil, fmt.Errorf("sink %q: batch and interval must be >= 0", sc.Name)
+	}
+	opts := addons.SinkOptions{Batch: sc.Batch, Interval: sc.Interval}
+	if sc.Filter != "" {
+		match, err := filter.Parse(sc.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: invalid filter: %w", sc.Name, err)
+		}
+		opts.Match = proxy.Matcher(match)
+	}
+	var sink addons.FlowSink
+	switch {
+	case (sc.URL == "") == (sc.S3 == nil):
+		return nil, fmt.Errorf("sink %q: set exactly one of url and s3", sc.Name)
+	case sc.URL != "":
+		headers := make(map[string]string, len(sc.Headers))
+		for k, v := range sc.Headers {
+			headers[k] = os.ExpandEnv(v)
+		}
+		sink = &addons.HTTPSink{URL: sc.URL, Headers: headers, Format: sc.Format}
+	default:
+		if sc.S3.Bucket == "" {
+			return nil, fmt.Errorf("sink %q: s3 bucket is required", sc.Name)
+		}
+		ak, sk, token := sc.S3.Credentials()
+		if ak == "" || sk == "" {
+			return nil, fmt.Errorf("sink %q: s3 access_key and secret_key are required (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)", sc.Name)
+		}
+		sink = &addons.S3Sink{
+			Endpoint:     sc.S3.Endpoint,
+			Bucket:       sc.S3.Bucket,
+			Prefix:       sc.S3.Prefix,
+			Region:       sc.S3.Region,
+			AccessKey:    ak,
+			SecretKey:    sk,
+			SessionToken: token,
+			Format:       sc.Format,
+		}
 	}
+	return addons.NewSinkAddon(sc.Name, sink, opts), nil
+}
+
+// errNoUpstreams is returned by resolveOptions along with otherwise complete
+// options, so commands that only talk to a running proxy can ignore it.
+var errNoUpstreams = errors.New("at least one upstream is required (use --upstream, --route, or a config file)")
+
+// serve runs the engine, web UI, and TUI until interrupted. setup, if non-nil,
+// is called with the engine and errgroup before anything starts, so callers
+// can register addons and background tasks.
+func serve(opts proxy.Options, ui uiOptions, setup func(context.Context, *proxy.Engine, *errgroup.Group) error) error {
+	noTUI, noColor := ui.noTUI, ui.noColor
 
 	engine, err := proxy.New(opts)
 	if err != nil {
 		return fmt.Errorf("create engine: %w", err)
 	}
 
-	engine.Addons().Add(addons.NewLogAddon(os.Stdout, noTUI || noColor))
+	tuiEnabled := !noTUI && isTerminal()
+	if ui.events == "-" && tuiEnabled {
+		return fmt.Errorf("--events-ndjson - writes to stdout, so it needs --no-tui")
+	}
+
+	// The standard logger writes to the engine's log, which the TUI's logs
+	// screen and the API show; headless, it is printed to stderr as well.
+	log.SetOutput(engine.LogWriter())
+	log.SetFlags(0)
+	if !tuiEnabled {
+		engine.SetLogOutput(os.Stderr)
+	}
+
+	// With events on stdout, the access log and process output move to
+	// stderr so stdout stays pure NDJSON.
+	var logOut io.Writer = os.Stdout
+	if ui.events == "-" {
+		logOut = os.Stderr
+	}
+	if ui.logFile != "" {
+		f, err := os.OpenFile(ui.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open log file: %w", err)
+		}
+		defer f.Close()
+		logOut = f
+	}
+	if ui.logFormat == "json" {
+		engine.Addons().Add(addons.NewJSONLogAddon(logOut))
+	} else {
+		engine.Addons().Add(addons.NewLogAddon(logOut, noTUI || noColor || ui.logFile != ""))
+	}
+
+	jwt, err := newJWTAddon(ui.jwt)
+	if err != nil {
+		return err
+	}
+	engine.Addons().Add(jwt)
+	engine.Addons().Add(addons.NewProtoAddon())
+	engine.Addons().Add(addons.NewSOAPAddon())
+	if len(ui.inject) > 0 {
+		inject, err := newInjectAddon(ui.inject)
+		if err != nil {
+			return err
+		}
+		engine.Addons().Add(inject)
+	}
+
+	var cache *addons.CacheAddon
+	if ui.cache || ui.offline || ui.cacheFile != "" {
+		cache = addons.NewCacheAddon(ui.offline)
+		if ui.cacheFile != "" {
+			if err := cache.Load(ui.cacheFile); err != nil {
+				return err
+			}
+		}
+		engine.Addons().Add(cache)
+		mode := "fallback"
+		if ui.offline {
+			mode = "offline"
+		}
+		fmt.Fprintf(os.Stderr, "response cache: %s, %d entries\n", mode, cache.Len())
+	}
+
+	var journal *addons.JournalAddon
+	if ui.persist.Path != "" {
+		if journal, err = openJournal(engine, ui.persist); err != nil {
+			return err
+		}
+	}
+
+	var sinks []*addons.SinkAddon
+	for _, sc := range ui.sinks {
+		sink, err := newSinkAddon(sc)
+		if err != nil {
+			return err
+		}
+		engine.Addons().Add(sink)
+		sinks = append(sinks, sink)
+		dest := sc.URL
+		if sc.S3 != nil {
+			dest = "s3://" + sc.S3.Bucket + "/" + sc.S3.Prefix
+		}
+		fmt.Fprintf(os.Stderr, "sink %s: %s\n", sc.Name, dest)
+	}
+
+	scheme := "http"
+	if opts.TLS {
+		scheme = "https"
+		if opts.TLSCertFile == "" {
+			ca, err := engine.CA()
+			if err != nil {
+				return fmt.Errorf("local CA: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "TLS: trust %s to avoid certificate warnings\n", ca.CertPath())
+		}
+	}
+	if opts.Mode == proxy.ModeForward {
+		scheme += ", forward proxy"
+	}
+	if opts.Mode == proxy.ModeForward && opts.MITM {
+		ca, err := engine.CA()
+		if err != nil {
+			return fmt.Errorf("local CA: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "MITM: clients must trust %s to inspect HTTPS\n", ca.CertPath())
+	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	defer cancel()
 
 	g, ctx := errgroup.WithContext(ctx)
+	if !tuiEnabled {
+		if ui.events == "-" {
+			engine.SetProcessOutput(os.Stderr)
+		} else {
+			engine.SetProcessOutput(os.Stdout)
+		}
+	}
+
+	if setup != nil {
+		if err := setup(ctx, engine, g); err != nil {
+			return err
+		}
+	}
+
+	// Event consumers, the web UI included, outlive ctx until the engine
+	// has drained, so the final events of in-flight flows get out too.
+	eventsCtx, stopEvents := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopEvents()
+	if ui.events != "" {
+		g.Go(func() error {
+			return writeEvents(eventsCtx, engine.Store(), ui.events)
+		})
+	}
+	if !tuiEnabled {
+		g.Go(func() error {
+			return logShutdown(eventsCtx, engine.Store())
+		})
+	}
+
+	if cache != nil && ui.cacheFile != "" {
+		g.Go(func() error {
+			return cache.Run(ctx, time.Second)
+		})
+	}
+	if journal != nil {
+		g.Go(func() error {
+			return journal.Run(eventsCtx, time.Second)
+		})
+	}
+	for _, sink := range sinks {
+		g.Go(func() error {
+			return sink.Run(eventsCtx)
+		})
+	}
+
+	if ui.configPath != "" {
+		engine.SetConfigSource(ui.reload)
+		g.Go(func() error {
+			// Reload logs the outcome itself.
+			return config.Watch(ctx, ui.configPath, func() { _, _ = engine.Reload() })
+		})
+	}
+
+	var webSrv *web.Server
+	if engine.Options().WebPort > 0 {
+		webSrv = web.New(engine, engine.Options().WebPort)
+		webSrv.SetSessionDir(ui.tui.SessionDir)
+		if ui.webUIDir != "" {
+			if err := webSrv.SetUIDir(ui.webUIDir); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Bind before anything is served, so the ports actually bound (see
+	// --auto-port) can be announced.
+	if err := engine.Listen(); err != nil {
+		return err
+	}
+	if webSrv != nil {
+		if err := webSrv.Listen(); err != nil {
+			return err
+		}
+	}
+	info := engine.Info()
+	if err := proxy.WriteInfoFile(ui.infoFile, info); err != nil {
+		fmt.Fprintf(os.Stderr, "info file: %v\n", err)
+	}
+	defer proxy.RemoveInfoFile(ui.infoFile)
+	if ui.printPorts {
+		portsOut := os.Stdout
+		if ui.events == "-" {
+			portsOut = os.Stderr
+		}
+		if err := json.NewEncoder(portsOut).Encode(info); err != nil {
+			return err
+		}
+	}
+
+	if ui.qr && !tuiEnabled {
+		printQR(info)
+	}
 
 	g.Go(func() error {
-		fmt.Fprintf(os.Stderr, "proxy listening on %s\n", engine.Options().ListenAddr)
+		fmt.Fprintf(os.Stderr, "proxy listening on %s (%s)\n", strings.Join(info.Listen, ", "), scheme)
+		defer stopEvents()
 		return engine.Start(ctx)
 	})
 
-	if engine.Options().WebPort > 0 {
-		webSrv := web.New(engine, engine.Options().WebPort)
+	if webSrv != nil {
 		g.Go(func() error {
-			return webSrv.Start(ctx)
+			return webSrv.Start(eventsCtx)
 		})
 	}
 
-	if !noTUI && isTerminal() {
+	if tuiEnabled {
 		g.Go(func() error {
-			return tui.Run(ctx, engine, engine.Options().WebPort)
+			tuiOpts := ui.tui
+			tuiOpts.WebPort = info.WebPort
+			tuiOpts.QR = ui.qr
+			return tui.Run(ctx, engine, tuiOpts)
 		})
 	}
 
 	return g.Wait()
 }
 
+// printQR prints a QR code of the proxy's first LAN address to stderr, the
+// headless counterpart of the TUI's pairing screen.
+func printQR(info proxy.Info) {
+	if len(info.LANURLs) == 0 {
+		fmt.Fprintln(os.Stderr, "--qr: the proxy isn't reachable from the LAN; listen on all interfaces (e.g. :9090)")
+		return
+	}
+	code, err := qr.Encode(info.LANURLs[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "--qr: %v\n", err)
+		return
+	}
+	style := lipgloss.NewRenderer(os.Stderr).NewStyle().
+		Foreground(lipgloss.Color("#ffffff")).Background(lipgloss.Color("#000000"))
+	for _, line := range strings.Split(strings.TrimSuffix(code.String(), "\n"), "\n") {
+		fmt.Fprintln(os.Stderr, style.Render(line))
+	}
+	fmt.Fprintln(os.Stderr, info.LANURLs[0])
+}
+
+// newJWTAddon creates the JWT addon, reading any public key files.
+func newJWTAddon(cfg config.JWTConfig) (*addons.JWTAddon, error) {
+	var secrets [][]byte
+	for _, s := range cfg.Secrets {
+		secrets = append(secrets, []byte(s))
+	}
+	var keys []crypto.PublicKey
+	for _, path := range cfg.PublicKeys {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("jwt public key: %w", err)
+		}
+		k, err := addons.ParsePublicKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("jwt public key %s: %w", path, err)
+		}
+		keys = append(keys, k...)
+	}
+	return addons.NewJWTAddon(secrets, keys), nil
+}
+
+func newInjectAddon(cfgs []config.InjectConfig) (*addons.InjectAddon, error) {
+	var rules []addons.InjectRule
+	for i, ic := range cfgs {
+		if (ic.HTML == "") == (ic.File == "") {
+			return nil, fmt.Errorf("inject %d: set exactly one of html and file", i+1)
+		}
+		rule := addons.InjectRule{HTML: ic.HTML}
+		if ic.File != "" {
+			data, err := os.ReadFile(ic.File)
+			if err != nil {
+				return nil, fmt.Errorf("inject %d: %w", i+1, err)
+			}
+			rule.HTML = string(data)
+		}
+		if ic.Filter != "" {
+			match, err := filter.Parse(ic.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("inject %d: invalid filter: %w", i+1, err)
+			}
+			rule.Match = proxy.Matcher(match)
+		}
+		rules = append(rules, rule)
+	}
+	return addons.NewInjectAddon(rules), nil
+}
+
 // buildUpstreams constructs the upstream list from --upstream / --route flags.
 func buildUpstreams() ([]proxy.Upstream, error) {
 	var upstreams []proxy.Upstream
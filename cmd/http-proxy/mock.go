@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/fidiego/http-proxy/pkg/addons"
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+var mockCmd = &cobra.Command{
+	Use:   "mock SESSION...",
+	Short: "Serve the responses captured in session files as a mock server",
+	Long: `mock loads session files (native, hpz, HAR, or mitmproxy) and answers
+every request with the response captured for the same method and path, so a
+frontend can run without any real backend. When several flows match, the
+last one recorded wins; requests nothing matches get a 404 and are tagged
+"fixture-miss" (or, with --forward-misses, go to the configured upstreams).
+
+--match-query, --match-body, and --match-json narrow the match to flows
+whose query string, whole body, or JSON body values at the given paths
+equal the request's, e.g. to tell GraphQL operations apart.
+
+The proxy runs as usual otherwise: --listen sets the address, and served
+requests show up in the TUI and web UI tagged "fixture". Mocks in the
+config file still take precedence.
+
+Examples:
+  http-proxy mock session.har --listen :8081
+  http-proxy mock api.hpz --match-json operationName --match-json variables.id`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runMock,
+}
+
+var (
+	flagMockQuery   bool
+	flagMockBody    bool
+	flagMockJSON    []string
+	flagMockFilter  string
+	flagMockForward bool
+)
+
+func init() {
+	mockCmd.Flags().BoolVar(&flagMockQuery, "match-query", false,
+		"also match the query string")
+	mockCmd.Flags().BoolVar(&flagMockBody, "match-body", false,
+		"also match the whole request body")
+	mockCmd.Flags().StringArrayVar(&flagMockJSON, "match-json", nil,
+		"also match the value at this path in the JSON request body, e.g. operationName; repeatable")
+	mockCmd.Flags().StringVar(&flagMockFilter, "filter", "",
+		"serve only the flows matching this filter expression")
+	mockCmd.Flags().BoolVar(&flagMockForward, "forward-misses", false,
+		"forward requests no fixture matches to the upstreams instead of answering 404")
+}
+
+func runMock(cmd *cobra.Command, args []string) error {
+	var flows []*proxy.Flow
+	for _, path := range args {
+		loaded, err := session.Load(path)
+		if err != nil {
+			return err
+		}
+		flows = append(flows, loaded...)
+	}
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].Timestamps.Created.Before(flows[j].Timestamps.Created)
+	})
+	if flagMockFilter != "" {
+		match, err := filter.Parse(flagMockFilter)
+		if err != nil {
+			return fmt.Errorf("invalid --filter: %w", err)
+		}
+		var kept []*proxy.Flow
+		for _, f := range flows {
+			if match(f) {
+				kept = append(kept, f)
+			}
+		}
+		flows = kept
+	}
+	fixtures, err := proxy.NewFixtures(flows, proxy.FixtureRules{
+		Query: flagMockQuery,
+		Body:  flagMockBody,
+		JSON:  flagMockJSON,
+	})
+	if err != nil {
+		return err
+	}
+
+	opts, ui, err := loadOptions(cmd)
+	if err != nil {
+		return err
+	}
+	return serve(opts, ui, func(_ context.Context, engine *proxy.Engine, _ *errgroup.Group) error {
+		engine.Addons().Add(addons.NewFixtureAddon(fixtures, flagMockForward))
+		fmt.Fprintf(os.Stderr, "mock: %d fixtures for %d routes from %s\n",
+			fixtures.Len(), fixtures.Routes(), strings.Join(args, ", "))
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fidiego/http-proxy/pkg/config"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "List or create named profiles",
+	Long: `A profile is a named project: its own config file, saved views and filter
+history, and saved sessions, kept in a directory under the user's config
+directory. --profile NAME runs the proxy (or any command reading the
+config, such as flows) with that profile instead of a proxy.yml in the
+current directory; an explicit --config still wins.
+
+Without a subcommand, profile lists the profiles and their ports.
+
+Examples:
+  http-proxy profile new shop --from ./proxy.yml
+  http-proxy --profile shop`,
+	Args: cobra.NoArgs,
+	RunE: runProfileList,
+}
+
+var profileNewCmd = &cobra.Command{
+	Use:   "new NAME",
+	Short: "Create a profile",
+	Long: `new creates a profile from --from, or from the example config with a
+listen port and web port that no other profile uses, and prints the path of
+its config file for editing.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runProfileNew,
+}
+
+var flagProfileFrom string
+
+func init() {
+	profileNewCmd.Flags().StringVar(&flagProfileFrom, "from", "",
+		"config file to copy into the profile (default: the example config)")
+	profileCmd.AddCommand(profileNewCmd)
+}
+
+func runProfileList(_ *cobra.Command, _ []string) error {
+	profiles, err := config.Profiles()
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		fmt.Fprintln(os.Stderr, "no profiles yet; create one with `http-proxy profile new NAME`")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLISTEN\tWEB\tCONFIG")
+	for _, p := range profiles {
+		listen, web, err := p.Ports()
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t%s (%v)\n", p.Name, p.ConfigPath(), err)
+			continue
+		}
+		ports := make([]string, len(listen))
+		for i, n := range listen {
+			ports[i] = strconv.Itoa(n)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", p.Name, strings.Join(ports, ","), web, p.ConfigPath())
+	}
+	return tw.Flush()
+}
+
+func runProfileNew(_ *cobra.Command, args []string) error {
+	var data []byte
+	if flagProfileFrom != "" {
+		if _, err := config.Load(flagProfileFrom); err != nil {
+			return err
+		}
+		var err error
+		if data, err = os.ReadFile(flagProfileFrom); err != nil {
+			return err
+		}
+	}
+	p, err := config.CreateProfile(args[0], data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "created profile %s; run it with `http-proxy --profile %s`\n", p.Name, p.Name)
+	fmt.Println(p.ConfigPath())
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/fidiego/http-proxy/pkg/addons"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+var recordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Run the proxy and record every flow to a session file",
+	Long: `record runs the proxy exactly like the root command and additionally
+writes every completed flow to --out. Flows are appended every second and
+on exit, so native, hpz, and mitmproxy files are valid sessions while the
+recording runs (native JSON is written one flow per line). A HAR file is
+written once, on exit, from flows spooled next to it.
+
+The format is inferred from the extension (.har → HAR 1.2, .hpz →
+compressed native JSON, .mitm → mitmproxy flows, anything else → native JSON)
+unless --format is given.
+
+Example:
+  http-proxy record --upstream http://localhost:8081 --out session.json`,
+	Args: cobra.NoArgs,
+	RunE: runRecord,
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay SESSION | ID... | --filter EXPR",
+	Short: "Re-issue the requests in a session file, or flows of a running proxy",
+	Long: `replay loads a session file (native or HAR) and sends each request, in
+the order it was recorded, to the upstream that matches it under the current
+configuration. Results are logged to stdout.
+
+--speed controls pacing: 0 (default) sends requests back-to-back, 1 keeps the
+original gaps between requests, 2 halves them, and so on.
+
+--target sends every request to one upstream (by name) or to an explicit base
+URL, e.g. to point traffic recorded against staging at a local service.
+
+When the arguments are not a session file, they are flow IDs in a running
+proxy, which replays them itself: the replays show up in its TUI and web UI,
+linked to their originals. --filter replays every flow matching an
+expression instead. Each flow is replayed --count times, --concurrency at a
+time, and a summary of the response statuses is printed at the end. The
+proxy is found as for "http-proxy flows" (--api, or the config file).
+
+--expect-status, --expect-header, and --expect-json check each replay's
+response, turning captured flows into contract checks: failed checks are
+printed, tallied at the end, and make replay exit non-zero. The results are
+also recorded on the replayed flows, which are tagged "assert-failed" when
+a check fails.
+
+Examples:
+  http-proxy replay session.json --upstream http://localhost:8081 --speed 1
+  http-proxy replay 6f1c2a9e-... --target http://localhost:8082 --count 50 --concurrency 10
+  http-proxy replay --filter '~s 5 & ~p /checkout'
+  http-proxy replay --filter '~p /api/orders' --expect-status 2xx --expect-json 'items[*].currency="EUR"'`,
+	Args: cobra.ArbitraryArgs,
+	RunE: runReplay,
+}
+
+var openCmd = &cobra.Command{
+	Use:   "open SESSION",
+	Short: "Run the proxy with the flows of a session file loaded for inspection",
+	Long: `open loads a session file (native, hpz, HAR, or mitmproxy) into the flow
+store and runs the proxy with the TUI and web UI, so a saved session can be
+browsed, filtered, diffed, and exported as if it had just been captured. Upstreams are
+optional; configure them to replay the loaded flows or capture new ones.
+
+Sessions are saved with :w FILE in the TUI, the Save button in the web UI,
+or POST /api/session/save.
+
+Example:
+  http-proxy open session.hpz`,
+	Args: cobra.ExactArgs(1),
+	RunE: runOpen,
+}
+
+var (
+	flagRecordOut    string
+	flagRecordFormat string
+	flagReplaySpeed  float64
+	flagReplayTarget string
+	flagReplayFilter string
+	flagReplayCount  int
+	flagReplayConc   int
+	flagExpectStatus []string
+	flagExpectHeader []string
+	flagExpectJSON   []string
+)
+
+func init() {
+	recordCmd.Flags().StringVarP(&flagRecordOut, "out", "o", "",
+		"session file to write (required)")
+	recordCmd.Flags().StringVar(&flagRecordFormat, "format", "",
+		"session format: native, hpz, har, or mitm (default: from --out extension)")
+	_ = recordCmd.MarkFlagRequired("out")
+
+	replayCmd.Flags().Float64Var(&flagReplaySpeed, "speed", 0,
+		"replay pacing relative to the recording (0 = no delay, 1 = original timing)")
+	replayCmd.Flags().StringVar(&flagReplayTarget, "target", "",
+		"send every request to this upstream name or base URL instead of routing it")
+	replayCmd.Flags().StringVar(&flagReplayFilter, "filter", "",
+		"replay the flows of a running proxy matching this filter expression")
+	replayCmd.Flags().IntVar(&flagReplayCount, "count", 1,
+		"replay each flow of a running proxy this many times")
+	replayCmd.Flags().IntVar(&flagReplayConc, "concurrency", 1,
+		"replays of a running proxy's flows to run at once")
+	replayCmd.Flags().StringArrayVar(&flagExpectStatus, "expect-status", nil,
+		"assert the replay's status: a code (200) or class (2xx); repeatable, any may match")
+	replayCmd.Flags().StringArrayVar(&flagExpectHeader, "expect-header", nil,
+		"assert a response header as NAME=REGEXP (NAME= only requires it); repeatable")
+	replayCmd.Flags().StringArrayVar(&flagExpectJSON, "expect-json", nil,
+		"assert a JSON body value as PATH=VALUE, e.g. items[0].id=7 (VALUE is JSON, or else a string); repeatable")
+	replayCmd.Flags().StringVar(&flagAPI, "api", "",
+		"web UI address of the running proxy (default: http://localhost:WEB_PORT)")
+}
+
+func runRecord(cmd *cobra.Command, _ []string) error {
+	format := session.FormatForPath(flagRecordOut)
+	if flagRecordFormat != "" {
+		var err error
+		if format, err = session.ParseFormat(flagRecordFormat); err != nil {
+			return err
+		}
+	}
+
+	opts, ui, err := loadOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	return serve(opts, ui, func(ctx context.Context, engine *proxy.Engine, g *errgroup.Group) error {
+		rec := addons.NewRecordAddon(flagRecordOut, format)
+		engine.Addons().Add(rec)
+		fmt.Fprintf(os.Stderr, "recording to %s (%s)\n", flagRecordOut, format)
+		g.Go(func() error {
+			err := rec.Run(ctx, time.Second)
+			fmt.Fprintf(os.Stderr, "recorded %d flows to %s\n", rec.Count(), flagRecordOut)
+			return err
+		})
+		return nil
+	})
+}
+
+func runOpen(cmd *cobra.Command, args []string) error {
+	flows, err := session.Load(args[0])
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].Timestamps.Created.Before(flows[j].Timestamps.Created)
+	})
+
+	opts, ui, err := loadOptions(cmd)
+	if err != nil {
+		return err
+	}
+	return serve(opts, ui, func(_ context.Context, engine *proxy.Engine, _ *errgroup.Group) error {
+		for _, f := range flows {
+			engine.Store().Add(f)
+		}
+		fmt.Fprintf(os.Stderr, "loaded %d flows from %s\n", len(flows), args[0])
+		return nil
+	})
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	if flagReplayFilter != "" || len(args) != 1 || !isFile(args[0]) {
+		return runReplayFlows(cmd, args)
+	}
+	if flagReplaySpeed < 0 {
+		return fmt.Errorf("--speed must be >= 0")
+	}
+
+	flows, err := session.Load(args[0])
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].Timestamps.Created.Before(flows[j].Timestamps.Created)
+	})
+
+	opts, ui, err := loadOptions(cmd)
+	if err != nil {
+		return err
+	}
+	engine, err := proxy.New(opts)
+	if err != nil {
+		return fmt.Errorf("create engine: %w", err)
+	}
+	engine.Addons().Add(addons.NewLogAddon(os.Stdout, ui.noColor || !isTerminal()))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	assert, err := replayAssertions()
+	if err != nil {
+		return err
+	}
+
+	tag := "session:" + filepath.Base(args[0])
+	var failed int
+	var tally assertTally
+	var prev time.Time
+	for i, f := range flows {
+		if f.Request == nil {
+			continue
+		}
+		if flagReplaySpeed > 0 && i > 0 && !prev.IsZero() {
+			gap := f.Timestamps.Created.Sub(prev)
+			if gap > 0 {
+				select {
+				case <-time.After(time.Duration(float64(gap) / flagReplaySpeed)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		prev = f.Timestamps.Created
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		ro := proxy.ReplayOptions{Target: flagReplayTarget, Tags: []string{"replay", tag}, Assert: assert}
+		res, err := engine.ReplayRequest(f.Request, ro)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "replay %s %s: %v\n", f.Request.Method, f.Request.URL, err)
+		} else if res != nil {
+			tally.add(res)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "replayed %d flows (%d failed)\n", len(flows), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d requests could not be replayed", failed)
+	}
+	if err := tally.report(); err != nil {
+		// A failed assertion isn't a usage error, and the tally above
+		// already says how many failed.
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return err
+	}
+	return nil
+}
+
+// replayAssertions builds the checks given with --expect-*, or nil.
+func replayAssertions() (*proxy.Assertions, error) {
+	a := &proxy.Assertions{Status: flagExpectStatus}
+	for _, h := range flagExpectHeader {
+		name, expr, ok := strings.Cut(h, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--expect-header %q: want NAME=REGEXP", h)
+		}
+		if a.Headers == nil {
+			a.Headers = make(map[string]string)
+		}
+		a.Headers[name] = expr
+	}
+	for _, j := range flagExpectJSON {
+		path, text, ok := strings.Cut(j, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("--expect-json %q: want PATH=VALUE", j)
+		}
+		var v any
+		if json.Unmarshal([]byte(text), &v) != nil {
+			v = text
+		}
+		if a.JSON == nil {
+			a.JSON = make(map[string]any)
+		}
+		a.JSON[path] = v
+	}
+	if a.IsZero() {
+		return nil, nil
+	}
+	return a, a.Validate()
+}
+
+// assertTally counts replays passing and failing their assertions, and the
+// failures by check.
+type assertTally struct {
+	passed, failed int
+	checks         map[string]int
+}
+
+// add counts f, printing its failed checks to stderr.
+func (t *assertTally) add(f *proxy.Flow) {
+	res := f.Assertions
+	if res == nil {
+		return
+	}
+	if res.Passed {
+		t.passed++
+		return
+	}
+	t.failed++
+	if t.checks == nil {
+		t.checks = make(map[string]int)
+	}
+	for _, c := range res.Failures {
+		t.checks[c.Check]++
+		fmt.Fprintf(os.Stderr, "assert %s %s: %s: %s\n", f.Request.Method, f.Request.URL, c.Check, c.Message)
+	}
+}
+
+// report prints the tally and returns an error if any replay failed.
+func (t *assertTally) report() error {
+	if t.passed+t.failed == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "assertions: %d passed, %d failed", t.passed, t.failed)
+	var by []string
+	for _, c := range slices.Sorted(maps.Keys(t.checks)) {
+		by = append(by, fmt.Sprintf("%s: %d", c, t.checks[c]))
+	}
+	if len(by) > 0 {
+		fmt.Fprintf(os.Stderr, " (%s)", strings.Join(by, ", "))
+	}
+	fmt.Fprintln(os.Stderr)
+	if t.failed > 0 {
+		return fmt.Errorf("%d replays failed their assertions", t.failed)
+	}
+	return nil
+}
+
+// isFile reports whether path names an existing regular file.
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,225 @@
+package addons
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+// CacheTag marks flows answered from the response cache.
+const CacheTag = "cache"
+
+// maxCacheEntries bounds the responses kept; the least recently used are
+// dropped first.
+const maxCacheEntries = 1000
+
+// CacheAddon remembers the last successful response for each request and
+// serves it when the upstream is unreachable or, in offline mode, for every
+// request. Requests are keyed by method, path and query, and a hash of the
+// body. Responses with a 5xx status or a truncated body are not cached, and
+// only the maxCacheEntries most recently used are kept.
+type CacheAddon struct {
+	offline bool
+	path    string // session file to seed from and persist to; empty if none
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *cacheEntry, by cacheKey
+	lru     list.List                // most recently used first
+	dirty   bool
+}
+
+// cacheEntry is a copy of a cached response, kept apart from the flow it
+// came from so evicting that flow from the store frees its bodies.
+type cacheEntry struct {
+	key     string
+	id      string
+	created time.Time
+	request proxy.CapturedRequest // method, URL, and, when persisting, body
+	resp    proxy.CapturedResponse
+}
+
+// NewCacheAddon creates an empty cache. When offline is set, no request is
+// forwarded: hits are served from the cache and misses get a 504.
+func NewCacheAddon(offline bool) *CacheAddon {
+	return &CacheAddon{offline: offline, entries: make(map[string]*list.Element)}
+}
+
+// Name identifies the addon in the addon list.
+func (c *CacheAddon) Name() string { return "cache" }
+
+// Load seeds the cache from a session file and remembers path so Run can
+// write the cache back to it. A missing file is not an error.
+func (c *CacheAddon) Load(path string) error {
+	c.path = path
+	flows, err := session.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load cache: %w", err)
+	}
+	for _, f := range flows {
+		c.store(f)
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *CacheAddon) OnComplete(flow *proxy.Flow) {
+	if slices.Contains(flow.Tags, CacheTag) {
+		return
+	}
+	c.store(flow)
+}
+
+func (c *CacheAddon) store(flow *proxy.Flow) {
+	req, resp := flow.Request, flow.Response
+	if req == nil || resp == nil || resp.StatusCode >= 500 || req.BodyTruncated || resp.BodyTruncated {
+		return
+	}
+	e := &cacheEntry{
+		key:     cacheKey(req),
+		id:      flow.ID,
+		created: flow.Timestamps.Created,
+		request: proxy.CapturedRequest{Method: req.Method, URL: req.URL, Path: req.Path, Headers: http.Header{}},
+		resp: proxy.CapturedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Headers.Clone(),
+			Body:       slices.Clone(resp.ReadBody()),
+			Proto:      resp.Proto,
+			Trailers:   resp.Trailers.Clone(),
+			Size:       resp.Size,
+		},
+	}
+	if c.path != "" {
+		e.request.Body = slices.Clone(req.ReadBody()) // to key it again when loaded
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[e.key]; ok {
+		c.lru.Remove(old)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	if c.lru.Len() > maxCacheEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.dirty = true
+}
+
+// Respond serves every request from the cache in offline mode.
+func (c *CacheAddon) Respond(flow *proxy.Flow) *proxy.CapturedResponse {
+	if !c.offline {
+		return nil
+	}
+	if resp := c.lookup(flow); resp != nil {
+		return resp
+	}
+	flow.Tags = append(flow.Tags, CacheTag+"-miss")
+	body := fmt.Sprintf("offline: no cached response for %s %s\n", flow.Request.Method, flow.Request.URL)
+	return &proxy.CapturedResponse{
+		StatusCode: http.StatusGatewayTimeout,
+		Headers:    http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte(body),
+		Proto:      "HTTP/1.1",
+	}
+}
+
+// Fallback serves a cached response when the upstream could not be reached.
+func (c *CacheAddon) Fallback(flow *proxy.Flow, _ error) *proxy.CapturedResponse {
+	return c.lookup(flow)
+}
+
+// lookup returns a copy of the cached response for flow's request, tagging
+// flow on a hit.
+func (c *CacheAddon) lookup(flow *proxy.Flow) *proxy.CapturedResponse {
+	if flow.Request == nil {
+		return nil
+	}
+	key := cacheKey(flow.Request)
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	hit := el.Value.(*cacheEntry).resp
+	c.mu.Unlock()
+	resp := &proxy.CapturedResponse{
+		StatusCode: hit.StatusCode,
+		Headers:    hit.Headers.Clone(),
+		Body:       slices.Clone(hit.Body),
+		Proto:      hit.Proto,
+		Trailers:   hit.Trailers.Clone(),
+		Size:       hit.Size,
+	}
+	flow.Tags = append(flow.Tags, CacheTag)
+	return resp
+}
+
+// Len returns the number of cached responses.
+func (c *CacheAddon) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Flush writes the cache to its session file if anything changed since the
+// last write, least recently used first, so loading it back keeps the order.
+func (c *CacheAddon) Flush() error {
+	c.mu.Lock()
+	if c.path == "" || !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	flows := make([]*proxy.Flow, 0, c.lru.Len())
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*cacheEntry)
+		req, resp := e.request, e.resp
+		f := &proxy.Flow{ID: e.id, State: proxy.FlowStateComplete, Request: &req, Response: &resp}
+		f.Timestamps.Created = e.created
+		flows = append(flows, f)
+	}
+	c.dirty = false
+	c.mu.Unlock()
+	return session.Save(c.path, flows, session.FormatForPath(c.path))
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes once more.
+func (c *CacheAddon) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := c.Flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return c.Flush()
+		}
+	}
+}
+
+// cacheKey identifies a request by method, path and query, and body hash.
+func cacheKey(req *proxy.CapturedRequest) string {
+	target := req.URL
+	if target == "" {
+		target = req.Path
+	}
+	sum := sha256.Sum256(req.ReadBody())
+	return req.Method + " " + target + " " + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,90 @@
+package addons
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+func cacheFlow(url, body string) *proxy.Flow {
+	return &proxy.Flow{
+		ID:       "id-" + url,
+		State:    proxy.FlowStateComplete,
+		Request:  &proxy.CapturedRequest{Method: "GET", URL: url, Headers: http.Header{}},
+		Response: &proxy.CapturedResponse{StatusCode: 200, Headers: http.Header{"Etag": {`"1"`}}, Body: []byte(body)},
+	}
+}
+
+func request(url string) *proxy.Flow {
+	return &proxy.Flow{Request: &proxy.CapturedRequest{Method: "GET", URL: url, Headers: http.Header{}}}
+}
+
+func TestCacheAddonCopiesResponses(t *testing.T) {
+	c := NewCacheAddon(false)
+	f := cacheFlow("http://api.test/a", "hello")
+	c.OnComplete(f)
+	f.Response.Body[0] = 'J'
+	f.Response.Headers.Set("Etag", `"2"`)
+
+	resp := c.Fallback(request("http://api.test/a"), nil)
+	if resp == nil {
+		t.Fatal("no cached response")
+	}
+	if string(resp.Body) != "hello" || resp.Headers.Get("Etag") != `"1"` {
+		t.Errorf("cached response changed with its flow: %q, ETag %s", resp.Body, resp.Headers.Get("Etag"))
+	}
+	if c.Fallback(request("http://api.test/b"), nil) != nil {
+		t.Error("a miss returned a response")
+	}
+}
+
+func TestCacheAddonEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCacheAddon(false)
+	url := func(i int) string { return fmt.Sprintf("http://api.test/?bust=%d", i) }
+	for i := range maxCacheEntries {
+		c.OnComplete(cacheFlow(url(i), "ok"))
+	}
+	c.Fallback(request(url(0)), nil) // used, so kept
+	c.OnComplete(cacheFlow(url(maxCacheEntries), "ok"))
+
+	if n := c.Len(); n != maxCacheEntries {
+		t.Errorf("Len() = %d, want %d", n, maxCacheEntries)
+	}
+	if c.Fallback(request(url(0)), nil) == nil {
+		t.Error("the recently used entry was evicted")
+	}
+	if c.Fallback(request(url(1)), nil) != nil {
+		t.Error("the least recently used entry was kept")
+	}
+}
+
+func TestCacheAddonPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c := NewCacheAddon(false)
+	if err := c.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	post := cacheFlow("http://api.test/search", "results")
+	post.Request.Method, post.Request.Body = "POST", []byte(`{"q":"x"}`)
+	c.OnComplete(post)
+	c.OnComplete(cacheFlow("http://api.test/a", "a"))
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCacheAddon(true)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := loaded.Len(); n != 2 {
+		t.Fatalf("loaded %d entries, want 2", n)
+	}
+	req := request("http://api.test/search")
+	req.Request.Method, req.Request.Body = "POST", []byte(`{"q":"x"}`)
+	if resp := loaded.Respond(req); resp == nil || string(resp.Body) != "results" {
+		t.Errorf("Respond after reload = %+v", resp)
+	}
+}
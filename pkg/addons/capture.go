@@ -12,6 +12,9 @@ type CaptureAddon struct {
 	OnFlowComplete func(flow *proxy.Flow)
 }
 
+// Name identifies the addon in the addon list.
+func (c *CaptureAddon) Name() string { return "capture" }
+
 func (c *CaptureAddon) OnComplete(flow *proxy.Flow) {
 	if c.OnFlowComplete != nil {
 		c.OnFlowComplete(flow)
@@ -0,0 +1,53 @@
+package addons
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// FixtureTag marks flows answered from fixtures.
+const FixtureTag = "fixture"
+
+// FixtureAddon answers every request with the response of the captured flow
+// that matches it, so a saved session stands in for the backend. Requests
+// no fixture matches get a 404, or are forwarded if forwardMisses is set.
+type FixtureAddon struct {
+	fixtures      *proxy.Fixtures
+	forwardMisses bool
+}
+
+// NewFixtureAddon creates an addon serving fixtures.
+func NewFixtureAddon(fixtures *proxy.Fixtures, forwardMisses bool) *FixtureAddon {
+	return &FixtureAddon{fixtures: fixtures, forwardMisses: forwardMisses}
+}
+
+// Name identifies the addon in the addon list.
+func (a *FixtureAddon) Name() string { return "fixtures" }
+
+// Respond serves the matching fixture's response.
+func (a *FixtureAddon) Respond(flow *proxy.Flow) *proxy.CapturedResponse {
+	if flow.Request == nil {
+		return nil
+	}
+	if hit := a.fixtures.Match(flow.Request); hit != nil {
+		resp := *hit.Response
+		resp.Headers = resp.Headers.Clone()
+		resp.Body = slices.Clone(hit.Response.ReadBody())
+		flow.Tags = append(flow.Tags, FixtureTag)
+		return &resp
+	}
+	flow.Tags = append(flow.Tags, FixtureTag+"-miss")
+	if a.forwardMisses {
+		return nil
+	}
+	body := fmt.Sprintf("mock: no fixture for %s %s\n", flow.Request.Method, flow.Request.URL)
+	return &proxy.CapturedResponse{
+		StatusCode: http.StatusNotFound,
+		Headers:    http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte(body),
+		Proto:      "HTTP/1.1",
+	}
+}
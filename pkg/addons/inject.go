@@ -0,0 +1,80 @@
+package addons
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// InjectRule adds HTML to the pages a filter matches.
+type InjectRule struct {
+	Match proxy.Matcher // nil matches every page
+	HTML  string
+}
+
+// InjectAddon inserts HTML snippets, such as debugging overlays or analytics
+// stubs, into HTML responses before their closing </body> tag, or at the
+// end of pages without one. The snippets of every matching rule are
+// inserted, in order, and injected flows are tagged "injected".
+type InjectAddon struct {
+	rules []InjectRule
+}
+
+// NewInjectAddon creates an InjectAddon.
+func NewInjectAddon(rules []InjectRule) *InjectAddon {
+	return &InjectAddon{rules: rules}
+}
+
+// Name identifies the addon in the addon list.
+func (a *InjectAddon) Name() string { return "inject" }
+
+// Rewrites reports whether flow's response is an HTML page a rule matches.
+func (a *InjectAddon) Rewrites(flow *proxy.Flow) bool {
+	if !proxy.IsInjectableHTML(flow) {
+		return false
+	}
+	for _, r := range a.rules {
+		if r.Match == nil || r.Match(flow) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite inserts the matching rules' snippets into body.
+func (a *InjectAddon) Rewrite(flow *proxy.Flow, body []byte) []byte {
+	var snippet strings.Builder
+	for _, r := range a.rules {
+		if r.Match == nil || r.Match(flow) {
+			snippet.WriteString(r.HTML)
+		}
+	}
+	if snippet.Len() == 0 {
+		return body
+	}
+	_, params, _ := mime.ParseMediaType(flow.Response.Headers.Get("Content-Type"))
+	addTag(flow, "injected")
+	return proxy.InjectHTML(body, encodeSnippet(snippet.String(), params["charset"]))
+}
+
+// encodeSnippet writes a UTF-8 snippet for a page in charset: as is for
+// UTF-8 (or no charset), and otherwise with characters beyond ASCII as
+// numeric character references, which mean the same in any charset.
+func encodeSnippet(snippet, charset string) string {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8":
+		return snippet
+	}
+	var b strings.Builder
+	for _, r := range snippet {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "&#%d;", r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package addons
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+// JournalAddon appends every finished flow to a session.Journal, so the
+// next run can reload the latest flows.
+// Flows the store leaves out (see proxy.Flow.Excluded) are not journaled.
+type JournalAddon struct {
+	journal *session.Journal
+
+	mu      sync.Mutex
+	pending []*proxy.Flow
+	count   int
+}
+
+// NewJournalAddon creates a JournalAddon appending to journal.
+func NewJournalAddon(journal *session.Journal) *JournalAddon {
+	return &JournalAddon{journal: journal}
+}
+
+// Name identifies the addon in the addon list.
+func (j *JournalAddon) Name() string { return "journal" }
+
+func (j *JournalAddon) OnComplete(flow *proxy.Flow) {
+	j.add(flow)
+}
+
+func (j *JournalAddon) OnError(flow *proxy.Flow, _ error) {
+	j.add(flow)
+}
+
+func (j *JournalAddon) add(flow *proxy.Flow) {
+	if flow.Excluded() {
+		return
+	}
+	j.mu.Lock()
+	j.pending = append(j.pending, flow)
+	j.mu.Unlock()
+}
+
+// Count returns the number of flows appended to the journal so far.
+func (j *JournalAddon) Count() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.count
+}
+
+// Flush appends the flows that finished since the last call. Flows that
+// could not be written are kept for the next one.
+func (j *JournalAddon) Flush() error {
+	j.mu.Lock()
+	flows := j.pending
+	j.pending = nil
+	j.mu.Unlock()
+	if len(flows) == 0 {
+		return nil
+	}
+	err := j.journal.Append(flows)
+	j.mu.Lock()
+	if err != nil {
+		j.pending = append(flows, j.pending...)
+	} else {
+		j.count += len(flows)
+	}
+	j.mu.Unlock()
+	return err
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes once more
+// and closes the journal. A failed write is retried on the next tick rather
+// than stopping the proxy.
+func (j *JournalAddon) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	failing := false
+	for {
+		select {
+		case <-t.C:
+			err := j.Flush()
+			if err != nil && !failing {
+				log.Printf("journal: %v", err)
+			}
+			failing = err != nil
+		case <-ctx.Done():
+			return errors.Join(j.Flush(), j.journal.Close())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package addons
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// JSONLogAddon writes one JSON object per finished flow (ndjson), for
+// machine analysis of access logs.
+type JSONLogAddon struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLogAddon creates a JSONLogAddon that writes to w.
+func NewJSONLogAddon(w io.Writer) *JSONLogAddon {
+	return &JSONLogAddon{enc: json.NewEncoder(w)}
+}
+
+// Name identifies the addon in the addon list.
+func (j *JSONLogAddon) Name() string { return "jsonlog" }
+
+// accessRecord is the JSON shape of one log line. Durations are in
+// milliseconds; sizes are full body sizes in bytes, even when the captured
+// body was truncated.
+type accessRecord struct {
+	Time          time.Time `json:"time"`
+	ID            string    `json:"id"`
+	Method        string    `json:"method"`
+	Host          string    `json:"host,omitempty"`
+	URL           string    `json:"url"`
+	Upstream      string    `json:"upstream"`
+	Status        int       `json:"status,omitempty"`
+	State         string    `json:"state"`
+	Error         string    `json:"error,omitempty"`
+	DurationMS    float64   `json:"duration_ms"`
+	TTFBMS        float64   `json:"ttfb_ms,omitempty"`
+	RequestBytes  int64     `json:"request_bytes"`
+	ResponseBytes int64     `json:"response_bytes"`
+	Tags          []string  `json:"tags,omitempty"`
+}
+
+func (j *JSONLogAddon) OnComplete(flow *proxy.Flow) {
+	j.write(flow)
+}
+
+func (j *JSONLogAddon) OnError(flow *proxy.Flow, _ error) {
+	j.write(flow)
+}
+
+func (j *JSONLogAddon) write(flow *proxy.Flow) {
+	req := flow.Request
+	if req == nil {
+		return
+	}
+	rec := accessRecord{
+		Time:         flow.Timestamps.Created,
+		ID:           flow.ID,
+		Method:       req.Method,
+		Host:         req.Host,
+		URL:          req.URL,
+		Upstream:     flow.Upstream,
+		State:        string(flow.State),
+		Error:        flow.Error,
+		DurationMS:   millis(flow.Duration()),
+		RequestBytes: req.Size,
+		Tags:         flow.Tags,
+	}
+	if ts := flow.Timestamps; !ts.ResponseStart.IsZero() {
+		rec.TTFBMS = millis(ts.ResponseStart.Sub(ts.Created))
+	}
+	if resp := flow.Response; resp != nil {
+		rec.Status = resp.StatusCode
+		rec.ResponseBytes = resp.Size
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = j.enc.Encode(rec)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
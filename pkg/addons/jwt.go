@@ -0,0 +1,267 @@
+package addons
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// JWTMetaKey is the Flow.Meta key under which decoded tokens are stored.
+const JWTMetaKey = "jwt"
+
+// Signature verification results reported in JWT.Signature.
+const (
+	SigUnverified = "unverified" // no key configured for the algorithm
+	SigValid      = "valid"
+	SigInvalid    = "invalid"
+)
+
+// JWT is a token found in a request, decoded but not trusted unless
+// Signature is SigValid.
+type JWT struct {
+	Source      string         `json:"source"` // "Authorization" or "cookie:<name>"
+	Header      map[string]any `json:"header"`
+	Claims      map[string]any `json:"claims"`
+	Expires     time.Time      `json:"expires,omitzero"`
+	Expired     bool           `json:"expired,omitempty"`
+	NotYetValid bool           `json:"notYetValid,omitempty"`
+	Signature   string         `json:"signature"`
+}
+
+// JWTAddon decodes JWTs in Authorization headers and cookies, checks their
+// exp and nbf claims, and attaches them to the flow under JWTMetaKey. With
+// keys configured it also verifies signatures. Flows are tagged "jwt", plus
+// "jwt-expired" or "jwt-invalid" when a token fails a check.
+type JWTAddon struct {
+	secrets    [][]byte
+	publicKeys []crypto.PublicKey
+	now        func() time.Time
+}
+
+// NewJWTAddon creates a JWTAddon that verifies HS* tokens against secrets and
+// RS*, PS*, ES*, and EdDSA tokens against publicKeys. Both may be empty.
+func NewJWTAddon(secrets [][]byte, publicKeys []crypto.PublicKey) *JWTAddon {
+	return &JWTAddon{secrets: secrets, publicKeys: publicKeys, now: time.Now}
+}
+
+// Name identifies the addon in the addon list.
+func (j *JWTAddon) Name() string { return "jwt" }
+
+// ParsePublicKeys parses every PEM "PUBLIC KEY" (PKIX), "RSA PUBLIC KEY", or
+// "CERTIFICATE" block in data.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			k, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		case "RSA PUBLIC KEY":
+			k, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, cert.PublicKey)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM public keys found")
+	}
+	return keys, nil
+}
+
+func (j *JWTAddon) OnRequest(flow *proxy.Flow) {
+	req := flow.Request
+	if req == nil {
+		return
+	}
+	var tokens []JWT
+	if scheme, tok, ok := strings.Cut(req.Headers.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		if t, ok := j.decode(strings.TrimSpace(tok)); ok {
+			t.Source = "Authorization"
+			tokens = append(tokens, t)
+		}
+	}
+	for _, c := range req.Cookies() {
+		if t, ok := j.decode(c.Value); ok {
+			t.Source = "cookie:" + c.Name
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	flow.SetMeta(JWTMetaKey, tokens)
+	flow.Tags = append(flow.Tags, "jwt")
+	var expired, invalid bool
+	for _, t := range tokens {
+		expired = expired || t.Expired || t.NotYetValid
+		invalid = invalid || t.Signature == SigInvalid
+	}
+	if expired {
+		flow.Tags = append(flow.Tags, "jwt-expired")
+	}
+	if invalid {
+		flow.Tags = append(flow.Tags, "jwt-invalid")
+	}
+}
+
+// decode parses s as a compact JWS. ok is false if s isn't a JWT at all.
+func (j *JWTAddon) decode(s string) (JWT, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return JWT{}, false
+	}
+	var t JWT
+	if decodeSegment(parts[0], &t.Header) != nil || decodeSegment(parts[1], &t.Claims) != nil {
+		return JWT{}, false
+	}
+	alg, _ := t.Header["alg"].(string)
+	if alg == "" {
+		return JWT{}, false
+	}
+
+	now := j.now()
+	if exp, ok := numericDate(t.Claims["exp"]); ok {
+		t.Expires = exp
+		t.Expired = !now.Before(exp)
+	}
+	if nbf, ok := numericDate(t.Claims["nbf"]); ok {
+		t.NotYetValid = now.Before(nbf)
+	}
+	t.Signature = j.verify(alg, parts[0]+"."+parts[1], parts[2])
+	return t, true
+}
+
+func decodeSegment(seg string, v *map[string]any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// verify checks the signature over signingInput against every configured key
+// that fits alg.
+func (j *JWTAddon) verify(alg, signingInput, sigSeg string) string {
+	sig, err := base64.RawURLEncoding.DecodeString(sigSeg)
+	if err != nil {
+		return SigInvalid
+	}
+
+	var newHash func() hash.Hash
+	var h crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		newHash, h = sha256.New, crypto.SHA256
+	case "384":
+		newHash, h = sha512.New384, crypto.SHA384
+	case "512":
+		newHash, h = sha512.New, crypto.SHA512
+	}
+
+	tried := false
+	switch {
+	case alg == "none":
+		// Unsigned tokens can't be trusted once keys are configured.
+		tried = len(j.secrets) > 0 || len(j.publicKeys) > 0
+	case strings.HasPrefix(alg, "HS") && newHash != nil:
+		for _, secret := range j.secrets {
+			tried = true
+			mac := hmac.New(newHash, secret)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return SigValid
+			}
+		}
+	case alg == "EdDSA":
+		for _, k := range j.publicKeys {
+			if pk, ok := k.(ed25519.PublicKey); ok {
+				tried = true
+				if ed25519.Verify(pk, []byte(signingInput), sig) {
+					return SigValid
+				}
+			}
+		}
+	case newHash != nil:
+		d := newHash()
+		d.Write([]byte(signingInput))
+		digest := d.Sum(nil)
+		for _, k := range j.publicKeys {
+			switch pk := k.(type) {
+			case *rsa.PublicKey:
+				switch {
+				case strings.HasPrefix(alg, "RS"):
+					tried = true
+					if rsa.VerifyPKCS1v15(pk, h, digest, sig) == nil {
+						return SigValid
+					}
+				case strings.HasPrefix(alg, "PS"):
+					tried = true
+					if rsa.VerifyPSS(pk, h, digest, sig, nil) == nil {
+						return SigValid
+					}
+				}
+			case *ecdsa.PublicKey:
+				if strings.HasPrefix(alg, "ES") && len(sig)%2 == 0 {
+					tried = true
+					half := len(sig) / 2
+					r := new(big.Int).SetBytes(sig[:half])
+					s := new(big.Int).SetBytes(sig[half:])
+					if ecdsa.Verify(pk, digest, r, s) {
+						return SigValid
+					}
+				}
+			}
+		}
+	}
+	if !tried {
+		return SigUnverified
+	}
+	return SigInvalid
+}
@@ -39,6 +39,9 @@ func NewLogAddon(w io.Writer, noColor bool) *LogAddon {
 	return &LogAddon{w: w, noColor: noColor}
 }
 
+// Name identifies the addon in the addon list.
+func (l *LogAddon) Name() string { return "log" }
+
 func (l *LogAddon) OnComplete(flow *proxy.Flow) {
 	l.write(flow)
 }
@@ -69,7 +72,7 @@ func (l *LogAddon) write(flow *proxy.Flow) {
 	if flow.Response != nil {
 		code := flow.Response.StatusCode
 		codeStr := fmt.Sprintf("%d", code)
-		size := formatSize(len(flow.Response.Body))
+		size := formatSize(int(flow.Response.WireSize()))
 		if !l.noColor {
 			statusPart = fmt.Sprintf("%s%s%s %s", colorFor(code), codeStr, resetColor, size)
 		} else {
@@ -0,0 +1,45 @@
+package addons
+
+import (
+	"github.com/fidiego/http-proxy/pkg/format"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// ProtoTagPrefix starts the tags naming a flow's protobuf message types,
+// e.g. "proto:shop.Order".
+const ProtoTagPrefix = "proto:"
+
+// ProtoAddon tags flows whose protobuf, Twirp, or gRPC bodies resolve to a
+// message type in the loaded descriptor sets (see
+// format.LoadProtoDescriptors), once for the request's and once for the
+// response's.
+type ProtoAddon struct{}
+
+// NewProtoAddon creates a ProtoAddon.
+func NewProtoAddon() *ProtoAddon { return &ProtoAddon{} }
+
+// Name identifies the addon in the addon list.
+func (p *ProtoAddon) Name() string { return "protobuf" }
+
+func (p *ProtoAddon) OnRequest(flow *proxy.Flow) {
+	if req := flow.Request; req != nil {
+		tagProto(flow, format.Body{ContentType: req.Headers.Get("Content-Type"), Path: req.Path})
+	}
+}
+
+func (p *ProtoAddon) OnResponse(flow *proxy.Flow) {
+	if flow.Request == nil || flow.Response == nil {
+		return
+	}
+	tagProto(flow, format.Body{
+		ContentType: flow.Response.Headers.Get("Content-Type"),
+		Path:        flow.Request.Path,
+		Response:    true,
+	})
+}
+
+func tagProto(flow *proxy.Flow, b format.Body) {
+	if name := format.ProtoMessageType(b); name != "" {
+		addTag(flow, ProtoTagPrefix+name)
+	}
+}
@@ -0,0 +1,107 @@
+package addons
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+// RecordAddon records every finished flow, independent of the flow store's
+// ring-buffer capacity, appending them to a session file as they finish
+// (see session.Recorder), so it holds only the flows not yet written.
+// Flows the store leaves out (see proxy.Flow.Excluded) are not recorded.
+type RecordAddon struct {
+	path   string
+	format session.Format
+
+	rec *session.Recorder // opened by Run
+
+	mu      sync.Mutex
+	pending []*proxy.Flow
+	count   int
+}
+
+// NewRecordAddon creates a RecordAddon that writes to path in format.
+func NewRecordAddon(path string, format session.Format) *RecordAddon {
+	return &RecordAddon{path: path, format: format}
+}
+
+// Name identifies the addon in the addon list.
+func (r *RecordAddon) Name() string { return "record" }
+
+func (r *RecordAddon) OnComplete(flow *proxy.Flow) {
+	r.add(flow)
+}
+
+func (r *RecordAddon) OnError(flow *proxy.Flow, _ error) {
+	r.add(flow)
+}
+
+func (r *RecordAddon) add(flow *proxy.Flow) {
+	if flow.Excluded() {
+		return
+	}
+	r.mu.Lock()
+	r.pending = append(r.pending, flow)
+	r.mu.Unlock()
+}
+
+// Count returns the number of flows written to the session file so far.
+func (r *RecordAddon) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Flush appends the flows that finished since the last call. Flows that
+// could not be written are kept for the next one.
+func (r *RecordAddon) Flush() error {
+	if r.rec == nil {
+		return nil // Run hasn't created the file yet
+	}
+	r.mu.Lock()
+	flows := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(flows) == 0 {
+		return nil
+	}
+	err := r.rec.Append(flows)
+	r.mu.Lock()
+	if err != nil {
+		r.pending = append(flows, r.pending...)
+	} else {
+		r.count += len(flows)
+	}
+	r.mu.Unlock()
+	return err
+}
+
+// Run creates the session file, so a bad path fails fast, and flushes
+// every interval until ctx is cancelled, then flushes once more and closes
+// the file.
+func (r *RecordAddon) Run(ctx context.Context, interval time.Duration) error {
+	rec, err := session.CreateRecorder(r.path, r.format)
+	if err != nil {
+		return err
+	}
+	r.rec = rec
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := r.Flush(); err != nil {
+				rec.Close()
+				return err
+			}
+		case <-ctx.Done():
+			return errors.Join(r.Flush(), rec.Close())
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package addons
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// DefaultS3Region is the region requests are signed for when none is set.
+const DefaultS3Region = "us-east-1"
+
+// S3Sink uploads each batch as an object to an S3-compatible bucket (AWS,
+// MinIO, R2, ...), signing requests with AWS Signature Version 4. Objects
+// are named Prefix + "2006/01/02/150405.000000000-N" + ".ndjson" or ".har".
+type S3Sink struct {
+	// Endpoint is the service's base URL (default: the AWS endpoint for
+	// Region). Buckets are addressed path-style, as Endpoint/Bucket/key.
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Region   string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // for temporary credentials; may be empty
+
+	Format string // SinkNDJSON (default) or SinkHAR
+	Client *http.Client
+
+	seq atomic.Int64
+}
+
+// Send uploads flows as one object.
+func (s *S3Sink) Send(ctx context.Context, flows []*proxy.Flow) error {
+	body, contentType, err := encodeSinkBatch(flows, s.Format)
+	if err != nil {
+		return err
+	}
+	t := time.Now().UTC()
+	ext := ".ndjson"
+	if s.Format == SinkHAR {
+		ext = ".har"
+	}
+	key := fmt.Sprintf("%s%s-%d%s", s.Prefix, t.Format("2006/01/02/150405.000000000"), s.seq.Add(1), ext)
+
+	region := s.Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + s.Bucket + "/" + key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	signS3(req, body, region, s.AccessKey, s.SecretKey, s.SessionToken, t)
+	return doSinkRequest(s.Client, req)
+}
+
+// signS3 adds AWS Signature Version 4 headers for the s3 service to req,
+// whose body is payload, signing all of its headers. Set them first.
+func signS3(req *http.Request, payload []byte, region, accessKey, secretKey, token string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	// Every header of req is signed, along with the host.
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	slices.Sort(names)
+	var canonHeaders strings.Builder
+	for _, name := range names {
+		v := strings.Join(req.Header.Values(name), ",")
+		if name == "host" {
+			v = req.URL.Host
+		}
+		canonHeaders.WriteString(name + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, sig))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
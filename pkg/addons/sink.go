@@ -0,0 +1,232 @@
+package addons
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+// FlowSink stores batches of finished flows outside the proxy, such as in a
+// team's central archive. Send is called by one goroutine at a time; a
+// batch it fails to store is sent again with the next.
+type FlowSink interface {
+	Send(ctx context.Context, flows []*proxy.Flow) error
+}
+
+// Sink formats: one native JSON flow per line, or an HTTP Archive.
+const (
+	SinkNDJSON = "ndjson"
+	SinkHAR    = "har"
+)
+
+const (
+	// DefaultSinkBatch is how many flows a batch holds at most.
+	DefaultSinkBatch = 100
+	// DefaultSinkInterval is how often a partial batch is sent.
+	DefaultSinkInterval = 30 * time.Second
+
+	// maxSinkBacklog bounds the flows kept while a sink is failing; the
+	// oldest are dropped beyond it.
+	maxSinkBacklog = 10000
+	// sinkFinalTimeout bounds the last send on shutdown.
+	sinkFinalTimeout = 10 * time.Second
+)
+
+// SinkOptions configure a SinkAddon. Zero values take the defaults above.
+type SinkOptions struct {
+	Match    proxy.Matcher // flows to send; nil sends all
+	Batch    int
+	Interval time.Duration
+}
+
+// SinkAddon batches finished flows and hands them to a FlowSink: when a
+// batch is full, every Interval, and on shutdown. Flows the store leaves out
+// (see proxy.Flow.Excluded) are not sent.
+type SinkAddon struct {
+	name string
+	sink FlowSink
+	opts SinkOptions
+
+	mu      sync.Mutex
+	pending []*proxy.Flow
+	sent    int
+	dropped int
+	full    chan struct{}
+}
+
+// NewSinkAddon creates an addon sending flows to sink, listed as
+// "sink:"+name.
+func NewSinkAddon(name string, sink FlowSink, opts SinkOptions) *SinkAddon {
+	if opts.Batch <= 0 {
+		opts.Batch = DefaultSinkBatch
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultSinkInterval
+	}
+	return &SinkAddon{name: name, sink: sink, opts: opts, full: make(chan struct{}, 1)}
+}
+
+// Name identifies the addon in the addon list.
+func (s *SinkAddon) Name() string { return "sink:" + s.name }
+
+func (s *SinkAddon) OnComplete(flow *proxy.Flow) {
+	s.add(flow)
+}
+
+func (s *SinkAddon) OnError(flow *proxy.Flow, _ error) {
+	s.add(flow)
+}
+
+func (s *SinkAddon) add(flow *proxy.Flow) {
+	if flow.Excluded() || s.opts.Match != nil && !s.opts.Match(flow) {
+		return
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, flow)
+	if n := len(s.pending) - maxSinkBacklog; n > 0 {
+		s.pending = s.pending[n:]
+		s.dropped += n
+	}
+	full := len(s.pending) >= s.opts.Batch
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Sent returns how many flows the sink has stored, and how many were
+// dropped because it kept failing.
+func (s *SinkAddon) Sent() (sent, dropped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent, s.dropped
+}
+
+// Flush sends the pending flows, a batch at a time. Flows of a batch that
+// fails are kept for the next call.
+func (s *SinkAddon) Flush(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		batch := s.pending[:min(len(s.pending), s.opts.Batch)]
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.sink.Send(ctx, batch); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		// Only add appends to pending, and it drops from the front only
+		// past the backlog limit, which the batch is well within.
+		s.pending = s.pending[min(len(batch), len(s.pending)):]
+		s.sent += len(batch)
+		s.mu.Unlock()
+	}
+}
+
+// Run sends batches until ctx is cancelled, then sends what is left. Failed
+// sends are logged and retried rather than stopping the proxy.
+func (s *SinkAddon) Run(ctx context.Context) error {
+	t := time.NewTicker(s.opts.Interval)
+	defer t.Stop()
+	failing := false
+	for {
+		select {
+		case <-t.C:
+		case <-s.full:
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), sinkFinalTimeout)
+			defer cancel()
+			if err := s.Flush(final); err != nil {
+				s.mu.Lock()
+				n := len(s.pending)
+				s.mu.Unlock()
+				log.Printf("%s: %v; %d flows not sent", s.Name(), err, n)
+			}
+			return nil
+		}
+		err := s.Flush(ctx)
+		if err != nil && !failing {
+			log.Printf("%s: %v (retrying)", s.Name(), err)
+		}
+		failing = err != nil
+	}
+}
+
+// encodeSinkBatch writes flows in format, returning the body and its
+// content type.
+func encodeSinkBatch(flows []*proxy.Flow, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == SinkHAR {
+		if err := session.Write(&buf, flows, session.FormatHAR); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/json", nil
+	}
+	enc := json.NewEncoder(&buf)
+	for _, f := range flows {
+		if err := enc.Encode(f); err != nil {
+			return nil, "", err
+		}
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// ValidSinkFormat reports whether format is a sink format ("" is ndjson).
+func ValidSinkFormat(format string) bool {
+	return format == "" || format == SinkNDJSON || format == SinkHAR
+}
+
+// HTTPSink POSTs each batch to URL, with Headers added.
+type HTTPSink struct {
+	URL     string
+	Headers map[string]string
+	Format  string // SinkNDJSON (default) or SinkHAR
+	Client  *http.Client
+}
+
+// Send posts flows as one request and expects a 2xx response.
+func (h *HTTPSink) Send(ctx context.Context, flows []*proxy.Flow) error {
+	body, contentType, err := encodeSinkBatch(flows, h.Format)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	return doSinkRequest(h.Client, req)
+}
+
+// doSinkRequest sends req and turns a non-2xx response into an error.
+func doSinkRequest(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package addons
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// fakeSink records the batches it is sent, failing while fail is set.
+type fakeSink struct {
+	batches [][]string
+	fail    bool
+}
+
+func (s *fakeSink) Send(_ context.Context, flows []*proxy.Flow) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	var ids []string
+	for _, f := range flows {
+		ids = append(ids, f.ID)
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+func sinkFlow(i int, status int) *proxy.Flow {
+	return &proxy.Flow{
+		ID:       fmt.Sprintf("f%d", i),
+		State:    proxy.FlowStateComplete,
+		Request:  &proxy.CapturedRequest{Method: "GET", URL: fmt.Sprintf("http://api.test/%d", i), Headers: http.Header{}},
+		Response: &proxy.CapturedResponse{StatusCode: status, Headers: http.Header{}},
+	}
+}
+
+func TestSinkAddonBatches(t *testing.T) {
+	serverErrors := func(f *proxy.Flow) bool { return f.Response != nil && f.Response.StatusCode >= 500 }
+	tests := []struct {
+		name  string
+		opts  SinkOptions
+		flows int
+		want  [][]string
+	}{
+		{"one batch", SinkOptions{}, 3, [][]string{{"f0", "f1", "f2"}}},
+		{"split into batches", SinkOptions{Batch: 2}, 5, [][]string{{"f0", "f1"}, {"f2", "f3"}, {"f4"}}},
+		{"filtered", SinkOptions{Match: serverErrors}, 6, [][]string{{"f1", "f3", "f5"}}},
+		{"nothing to send", SinkOptions{}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &fakeSink{}
+			a := NewSinkAddon("test", sink, tt.opts)
+			for i := range tt.flows {
+				status := 200
+				if i%2 == 1 {
+					status = 502
+				}
+				a.OnComplete(sinkFlow(i, status))
+			}
+			if err := a.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(sink.batches, tt.want, slices.Equal) {
+				t.Errorf("batches = %v, want %v", sink.batches, tt.want)
+			}
+		})
+	}
+}
+
+func TestSinkAddonKeepsFailedBatches(t *testing.T) {
+	sink := &fakeSink{fail: true}
+	a := NewSinkAddon("test", sink, SinkOptions{Batch: 2})
+	for i := range 3 {
+		a.OnComplete(sinkFlow(i, 200))
+	}
+	if err := a.Flush(context.Background()); err == nil {
+		t.Fatal("Flush to a failing sink succeeded")
+	}
+	if sent, dropped := a.Sent(); sent != 0 || dropped != 0 {
+		t.Errorf("Sent() = %d, %d after a failure, want 0, 0", sent, dropped)
+	}
+
+	sink.fail = false
+	a.OnError(sinkFlow(3, 0), errors.New("connection refused"))
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"f0", "f1"}, {"f2", "f3"}}
+	if !slices.EqualFunc(sink.batches, want, slices.Equal) {
+		t.Errorf("batches = %v, want %v", sink.batches, want)
+	}
+	if sent, _ := a.Sent(); sent != 4 {
+		t.Errorf("sent %d flows, want 4", sent)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got []string
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var f proxy.Flow
+			if err := json.Unmarshal(sc.Bytes(), &f); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			got = append(got, f.ID)
+		}
+	}))
+	defer srv.Close()
+
+	flows := []*proxy.Flow{sinkFlow(0, 200), sinkFlow(1, 404)}
+	sink := &HTTPSink{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	if err := sink.Send(context.Background(), flows); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{"f0", "f1"}) || contentType != "application/x-ndjson" {
+		t.Errorf("server got %v as %q", got, contentType)
+	}
+
+	bad := &HTTPSink{URL: srv.URL}
+	err := bad.Send(context.Background(), flows)
+	if err == nil {
+		t.Fatal("Send without credentials succeeded")
+	}
+	if want := "401 Unauthorized: unauthorized"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q doesn't mention %q", err, want)
+	}
+}
@@ -0,0 +1,96 @@
+package addons
+
+import (
+	"mime"
+	"slices"
+	"strings"
+
+	"github.com/fidiego/http-proxy/pkg/format"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// SOAPMetaKey is the Flow.Meta key under which SOAP details are stored.
+const SOAPMetaKey = "soap"
+
+// SOAP summarises a SOAP exchange.
+type SOAP struct {
+	Version   string            `json:"version"` // "1.1" or "1.2"
+	Action    string            `json:"action,omitempty"`
+	Operation string            `json:"operation,omitempty"`
+	Response  string            `json:"response,omitempty"`
+	Fault     *format.SOAPFault `json:"fault,omitempty"`
+}
+
+// SOAPAddon recognises SOAP envelopes and attaches their action,
+// operation, and any fault to the flow under SOAPMetaKey. Flows are tagged
+// "soap" and "soap:<operation>", plus "soap-fault" when the response is a
+// Fault.
+type SOAPAddon struct{}
+
+// NewSOAPAddon creates a SOAPAddon.
+func NewSOAPAddon() *SOAPAddon { return &SOAPAddon{} }
+
+// Name identifies the addon in the addon list.
+func (s *SOAPAddon) Name() string { return "soap" }
+
+func (s *SOAPAddon) OnRequest(flow *proxy.Flow) {
+	req := flow.Request
+	if req == nil {
+		return
+	}
+	contentType := req.Headers.Get("Content-Type")
+	body := req.ReadBody()
+	if !format.IsXML(contentType, body) {
+		return
+	}
+	env, ok := format.ParseSOAP(body)
+	if !ok {
+		return
+	}
+	// SOAP 1.1 names the action in a header, 1.2 in the Content-Type.
+	action := strings.Trim(req.Headers.Get("SOAPAction"), `"`)
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && action == "" {
+		action = params["action"]
+	}
+	flow.SetMeta(SOAPMetaKey, &SOAP{Version: env.Version, Action: action, Operation: env.Operation})
+	addTag(flow, "soap")
+	if env.Operation != "" {
+		addTag(flow, "soap:"+env.Operation)
+	}
+}
+
+func (s *SOAPAddon) OnResponse(flow *proxy.Flow) {
+	resp := flow.Response
+	if resp == nil {
+		return
+	}
+	body := resp.ReadBody()
+	if !format.IsXML(resp.Headers.Get("Content-Type"), body) {
+		return
+	}
+	env, ok := format.ParseSOAP(body)
+	if !ok {
+		return
+	}
+	info := SOAP{Version: env.Version}
+	if prev, ok := flow.Meta[SOAPMetaKey].(*SOAP); ok {
+		info = *prev
+	}
+	if env.Fault != nil {
+		info.Fault = env.Fault
+	} else {
+		info.Response = env.Operation
+	}
+	flow.SetMeta(SOAPMetaKey, &info)
+	addTag(flow, "soap")
+	if env.Fault != nil {
+		addTag(flow, "soap-fault")
+	}
+}
+
+// addTag tags flow unless it already is.
+func addTag(flow *proxy.Flow, tag string) {
+	if !slices.Contains(flow.Tags, tag) {
+		flow.Tags = append(flow.Tags, tag)
+	}
+}
@@ -0,0 +1,238 @@
+// Package certs generates and caches a local certificate authority and
+// leaf certificates for serving the proxy over HTTPS.
+//
+// The CA is created on first use and stored in the cache directory as
+// ca.pem / ca-key.pem. Trust ca.pem in your OS or browser to avoid
+// certificate warnings, the same way mkcert works.
+package certs
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	caCertFile = "ca.pem"
+	caKeyFile  = "ca-key.pem"
+
+	// maxLeaves bounds the leaf certificates kept; the least recently used
+	// are signed again if asked for after being dropped.
+	maxLeaves = 1000
+)
+
+// DefaultDir returns the default certificate cache directory
+// (e.g. ~/.cache/http-proxy/certs on Linux).
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "http-proxy", "certs")
+}
+
+// CA is a local certificate authority that signs leaf certificates on demand.
+type CA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	dir     string
+
+	mu     sync.Mutex
+	leaves map[string]*list.Element // of *leafEntry, by host
+	lru    list.List                // most recently used first
+}
+
+// leafEntry is a cached leaf certificate.
+type leafEntry struct {
+	host string
+	cert *tls.Certificate
+}
+
+// LoadOrCreateCA loads the CA from dir, generating and saving a new one if
+// none exists.
+func LoadOrCreateCA(dir string) (*CA, error) {
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr == nil && keyErr == nil {
+		return parseCA(dir, certPEM, keyPEM)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cert dir: %w", err)
+	}
+	certPEM, keyPEM, err := generateCA()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return nil, fmt.Errorf("write CA cert: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return nil, fmt.Errorf("write CA key: %w", err)
+	}
+	return parseCA(dir, certPEM, keyPEM)
+}
+
+// CertPath returns the path of the CA certificate on disk.
+func (ca *CA) CertPath() string { return filepath.Join(ca.dir, caCertFile) }
+
+// CertPEM returns the PEM-encoded CA certificate.
+func (ca *CA) CertPEM() []byte { return ca.certPEM }
+
+// Leaf returns a certificate for host signed by the CA, generating and
+// caching it on first request; the cache keeps the maxLeaves most recently
+// used. host may be a DNS name or an IP address.
+func (ca *CA) Leaf(host string) (*tls.Certificate, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if host == "" {
+		host = "localhost"
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if e, ok := ca.leaves[host]; ok {
+		ca.lru.MoveToFront(e)
+		return e.Value.(*leafEntry).cert, nil
+	}
+	c, err := ca.sign(host)
+	if err != nil {
+		return nil, err
+	}
+	ca.leaves[host] = ca.lru.PushFront(&leafEntry{host: host, cert: c})
+	if ca.lru.Len() > maxLeaves {
+		oldest := ca.lru.Back()
+		ca.lru.Remove(oldest)
+		delete(ca.leaves, oldest.Value.(*leafEntry).host)
+	}
+	return c, nil
+}
+
+// TLSConfig returns a server tls.Config that issues a leaf certificate for
+// whatever SNI name the client requests (localhost when none is sent).
+func (ca *CA) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return ca.Leaf(hello.ServerName)
+		},
+	}
+}
+
+func (ca *CA) sign(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate leaf key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"http-proxy"}, CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		// Browsers reject leaf certificates valid for more than ~13 months.
+		NotAfter:    time.Now().AddDate(0, 0, 397),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+		if host == "localhost" {
+			tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("sign leaf for %q: %w", host, err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+func generateCA() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"http-proxy local CA"}, CommonName: "http-proxy CA " + hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create CA cert: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal CA key: %w", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func parseCA(dir string, certPEM, keyPEM []byte) (*CA, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load CA from %s: %w", dir, err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse CA cert: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("CA key in %s is not ECDSA", dir)
+	}
+	return &CA{
+		cert:    cert,
+		key:     key,
+		certPEM: certPEM,
+		dir:     dir,
+		leaves:  make(map[string]*list.Element),
+	}, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,516 @@
+// Package client drives a running http-proxy through its control API, the
+// REST API served under /api/v1 on the web UI port. Test harnesses and
+// scripts use it to list and filter flows, replay requests, intercept
+// traffic, reload the config, and read stats.
+//
+//	c := client.New("http://localhost:9091")
+//	flows, err := c.Flows(ctx, client.ListOptions{Filter: "~s 5"})
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// Client talks to one proxy's control API. Set the credentials the web UI
+// requires (web_auth, web_token), if any, before use.
+type Client struct {
+	// BaseURL is the web UI's address, e.g. "http://localhost:9091".
+	BaseURL string
+
+	// HTTPClient sends the requests; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Token is sent as a bearer token; User and Password as basic auth.
+	Token    string
+	User     string
+	Password string
+}
+
+// New returns a client for the proxy whose web UI is at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Error is a response from the API with a non-2xx status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("http-proxy: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API, e.g. for a flow that
+// has been evicted.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// ListOptions selects flows. The zero value lists every stored flow, oldest
+// first.
+type ListOptions struct {
+	Filter string // filter expression, e.g. "~m POST & ~s 5"
+	Limit  int    // 0 means no limit
+	Offset int    // matches to skip
+	Desc   bool   // newest first
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{"stream": {"1"}}
+	if o.Filter != "" {
+		q.Set("filter", o.Filter)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Desc {
+		q.Set("order", "desc")
+	}
+	return q
+}
+
+// Flows returns the flows selected by opts.
+func (c *Client) Flows(ctx context.Context, opts ListOptions) ([]*proxy.Flow, error) {
+	var flows []*proxy.Flow
+	err := c.EachFlow(ctx, opts, func(f *proxy.Flow) error {
+		flows = append(flows, f)
+		return nil
+	})
+	return flows, err
+}
+
+// EachFlow calls fn with each flow selected by opts as it is received, so
+// a large store needn't be held in memory at once. An error from fn stops
+// the listing and is returned.
+func (c *Client) EachFlow(ctx context.Context, opts ListOptions, fn func(*proxy.Flow) error) error {
+	resp, err := c.send(ctx, http.MethodGet, "/flows?"+opts.query().Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 256<<20) // a flow holds up to two captured bodies
+	for sc.Scan() {
+		var f proxy.Flow
+		if err := json.Unmarshal(sc.Bytes(), &f); err != nil {
+			return fmt.Errorf("http-proxy: decode flow: %w", err)
+		}
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// Flow returns the flow with the given ID.
+func (c *Client) Flow(ctx context.Context, id string) (*proxy.Flow, error) {
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodGet, "/flows/"+url.PathEscape(id), nil, &f)
+}
+
+// DeleteFlow removes a flow, pinned or not.
+func (c *Client) DeleteFlow(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/flows/"+url.PathEscape(id), nil, nil)
+}
+
+// DeleteFlows removes the flows matching filter, and returns their IDs.
+// Pinned flows are kept unless force is set.
+func (c *Client) DeleteFlows(ctx context.Context, filter string, force bool) ([]string, error) {
+	q := url.Values{"filter": {filter}}
+	if force {
+		q.Set("force", "true")
+	}
+	var out struct {
+		Deleted []string `json:"deleted"`
+	}
+	return out.Deleted, c.do(ctx, http.MethodDelete, "/flows?"+q.Encode(), nil, &out)
+}
+
+// Groups returns the flows matching filter grouped by request signature,
+// busiest group first.
+func (c *Client) Groups(ctx context.Context, filter string) ([]proxy.FlowGroup, error) {
+	var g []proxy.FlowGroup
+	return g, c.do(ctx, http.MethodGet, "/flows/groups?"+url.Values{"filter": {filter}}.Encode(), nil, &g)
+}
+
+// Clear removes every unpinned flow, or with force every flow.
+func (c *Client) Clear(ctx context.Context, force bool) error {
+	path := "/flows"
+	if force {
+		path += "?force=true"
+	}
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// PatchFlow sets a flow's note and/or pin.
+func (c *Client) PatchFlow(ctx context.Context, id string, p proxy.FlowPatch) (*proxy.Flow, error) {
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodPatch, "/flows/"+url.PathEscape(id), p, &f)
+}
+
+// TagFlow adds and removes user tags on a flow.
+func (c *Client) TagFlow(ctx context.Context, id string, add, remove []string) (*proxy.Flow, error) {
+	body := map[string][]string{"add": add, "remove": remove}
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodPost, "/flows/"+url.PathEscape(id)+"/tags", body, &f)
+}
+
+// Diff compares two flows, ignoring the named headers. b may be
+// "latest-replay" for a's newest stored replay.
+func (c *Client) Diff(ctx context.Context, a, b string, ignoreHeaders ...string) (*proxy.FlowDiff, error) {
+	path := "/flows/" + url.PathEscape(a) + "/diff/" + url.PathEscape(b)
+	if len(ignoreHeaders) > 0 {
+		path += "?" + url.Values{"ignore": {strings.Join(ignoreHeaders, ",")}}.Encode()
+	}
+	var d proxy.FlowDiff
+	return &d, c.do(ctx, http.MethodGet, path, nil, &d)
+}
+
+// ReplayOptions changes a replayed request or where it is sent.
+type ReplayOptions struct {
+	Edit   proxy.RequestEdit
+	Target string            // upstream name or base URL; empty routes as usual
+	Assert *proxy.Assertions // checked against the response; see Flow.Assertions
+}
+
+// Replay re-sends a captured flow's request and returns the new flow once
+// its response is in.
+func (c *Client) Replay(ctx context.Context, id string, opts ReplayOptions) (*proxy.Flow, error) {
+	body := struct {
+		proxy.RequestEdit
+		Target string            `json:"target,omitempty"`
+		Assert *proxy.Assertions `json:"assert,omitempty"`
+	}{opts.Edit, opts.Target, opts.Assert}
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodPost, "/flows/"+url.PathEscape(id)+"/replay", body, &f)
+}
+
+// Request is a new request to send through the proxy.
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"` // absolute, or a path routed as usual
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+	Target  string      `json:"target,omitempty"`
+}
+
+// Send sends a new request through the proxy and returns its flow.
+func (c *Client) Send(ctx context.Context, req Request) (*proxy.Flow, error) {
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodPost, "/requests", req, &f)
+}
+
+// BulkReplayOptions selects the flows of a bulk replay and paces it.
+type BulkReplayOptions struct {
+	Filter      string
+	Concurrency int
+	Delay       time.Duration // between starting requests
+	Order       string        // "recorded" (default), "reverse", or "random"
+	Target      string
+	Assert      *proxy.Assertions // replays failing these count as failed
+}
+
+// BulkReplay starts replaying every flow matching opts.Filter in the
+// background. Follow it with Job.
+func (c *Client) BulkReplay(ctx context.Context, opts BulkReplayOptions) (*proxy.ReplayJob, error) {
+	body := map[string]any{
+		"filter":      opts.Filter,
+		"concurrency": opts.Concurrency,
+		"order":       opts.Order,
+		"target":      opts.Target,
+	}
+	if opts.Assert != nil {
+		body["assert"] = opts.Assert
+	}
+	if opts.Delay > 0 {
+		body["delay"] = opts.Delay.String()
+	}
+	var j proxy.ReplayJob
+	return &j, c.do(ctx, http.MethodPost, "/flows/replay", body, &j)
+}
+
+// Job returns the progress of a bulk replay.
+func (c *Client) Job(ctx context.Context, id string) (*proxy.ReplayJob, error) {
+	var j proxy.ReplayJob
+	return &j, c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, &j)
+}
+
+// Jobs reports on the scheduled replay jobs.
+func (c *Client) Jobs(ctx context.Context) ([]proxy.JobStatus, error) {
+	var jobs []proxy.JobStatus
+	return jobs, c.do(ctx, http.MethodGet, "/jobs", nil, &jobs)
+}
+
+// RunJob starts a run of the scheduled job called name now.
+func (c *Client) RunJob(ctx context.Context, name string) (*proxy.ReplayJob, error) {
+	var j proxy.ReplayJob
+	return &j, c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(name)+"/run", nil, &j)
+}
+
+// CancelJob stops a running bulk replay.
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, nil)
+}
+
+// Intercept returns whether requests are being paused, and for which filter.
+func (c *Client) Intercept(ctx context.Context) (proxy.InterceptStatus, error) {
+	var s proxy.InterceptStatus
+	return s, c.do(ctx, http.MethodGet, "/intercept", nil, &s)
+}
+
+// SetIntercept pauses requests matching filter (every request if empty)
+// until they are resumed or killed.
+func (c *Client) SetIntercept(ctx context.Context, filter string) error {
+	return c.do(ctx, http.MethodPut, "/intercept", proxy.InterceptStatus{Enabled: true, Filter: filter}, nil)
+}
+
+// ClearIntercept turns intercept off and releases paused requests.
+func (c *Client) ClearIntercept(ctx context.Context) error {
+	return c.do(ctx, http.MethodPut, "/intercept", proxy.InterceptStatus{}, nil)
+}
+
+// EditRequest changes a paused request before it is resumed.
+func (c *Client) EditRequest(ctx context.Context, id string, edit proxy.RequestEdit) (*proxy.Flow, error) {
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodPatch, "/flows/"+url.PathEscape(id)+"/request", edit, &f)
+}
+
+// EditResponse changes a response paused at a response breakpoint before it
+// is resumed.
+func (c *Client) EditResponse(ctx context.Context, id string, edit proxy.ResponseEdit) (*proxy.Flow, error) {
+	var f proxy.Flow
+	return &f, c.do(ctx, http.MethodPatch, "/flows/"+url.PathEscape(id)+"/response", edit, &f)
+}
+
+// Resume sends a paused request on upstream.
+func (c *Client) Resume(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/flows/"+url.PathEscape(id)+"/resume", nil, nil)
+}
+
+// Kill answers a paused request with an error instead of forwarding it.
+func (c *Client) Kill(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/flows/"+url.PathEscape(id)+"/kill", nil, nil)
+}
+
+// Breakpoints returns the breakpoints set on the proxy.
+func (c *Client) Breakpoints(ctx context.Context) ([]proxy.Breakpoint, error) {
+	var b []proxy.Breakpoint
+	return b, c.do(ctx, http.MethodGet, "/breakpoints", nil, &b)
+}
+
+// AddBreakpoint pauses flows matching filter (every flow if empty) at phase,
+// proxy.BreakRequest or proxy.BreakResponse, until it is deleted.
+func (c *Client) AddBreakpoint(ctx context.Context, filter, phase string) (*proxy.Breakpoint, error) {
+	var b proxy.Breakpoint
+	in := proxy.Breakpoint{Filter: filter, Phase: phase}
+	return &b, c.do(ctx, http.MethodPost, "/breakpoints", in, &b)
+}
+
+// DeleteBreakpoint removes a breakpoint by ID.
+func (c *Client) DeleteBreakpoint(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/breakpoints/"+url.PathEscape(id), nil, nil)
+}
+
+// HeaderOverrides returns the active header overrides.
+func (c *Client) HeaderOverrides(ctx context.Context) ([]proxy.HeaderOverride, error) {
+	var o []proxy.HeaderOverride
+	return o, c.do(ctx, http.MethodGet, "/overrides", nil, &o)
+}
+
+// AddHeaderOverride sets header to value (removes it if value is empty) on
+// requests matching filter (every request if empty) until it is deleted.
+func (c *Client) AddHeaderOverride(ctx context.Context, filter, header, value string) (*proxy.HeaderOverride, error) {
+	var o proxy.HeaderOverride
+	in := proxy.HeaderOverride{Filter: filter, Header: header, Value: value}
+	return &o, c.do(ctx, http.MethodPost, "/overrides", in, &o)
+}
+
+// DeleteHeaderOverride removes a header override by ID.
+func (c *Client) DeleteHeaderOverride(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/overrides/"+url.PathEscape(id), nil, nil)
+}
+
+// NetworkConditions returns the active network simulation and the profiles
+// available.
+func (c *Client) NetworkConditions(ctx context.Context) (*proxy.NetworkStatus, error) {
+	var st proxy.NetworkStatus
+	return &st, c.do(ctx, http.MethodGet, "/network", nil, &st)
+}
+
+// SetNetworkProfile simulates profile for upstream, or for every upstream
+// without its own if upstream is empty. An empty profile turns it off, or
+// returns upstream to the global profile.
+func (c *Client) SetNetworkProfile(ctx context.Context, upstream, profile string) error {
+	in := map[string]string{"upstream": upstream, "profile": profile}
+	return c.do(ctx, http.MethodPut, "/network", in, nil)
+}
+
+// Config is the routing the proxy is running with.
+type Config struct {
+	Upstreams []Upstream `json:"upstreams"`
+	Mocks     []Mock     `json:"mocks"`
+	Flows     int        `json:"flows"` // flows currently stored
+}
+
+// Upstream is a configured upstream.
+type Upstream struct {
+	Name        string         `json:"name"`
+	Prefix      string         `json:"prefix"`
+	Target      string         `json:"target"`
+	H2C         bool           `json:"h2c,omitempty"`
+	Rules       []proxy.Rule   `json:"rules,omitempty"`
+	PrefixRegex string         `json:"prefixRegex,omitempty"`
+	StripPrefix bool           `json:"stripPrefix,omitempty"`
+	RewriteTo   string         `json:"rewriteTo,omitempty"`
+	Targets     []proxy.Target `json:"targets,omitempty"`
+}
+
+// Mock is a configured mock response.
+type Mock struct {
+	Name   string `json:"name"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+}
+
+// Config returns the running configuration.
+func (c *Client) Config(ctx context.Context) (*Config, error) {
+	var cfg Config
+	return &cfg, c.do(ctx, http.MethodGet, "/config", nil, &cfg)
+}
+
+// Reload re-reads the proxy's config file and applies it, returning the
+// proxy's summary of what changed.
+func (c *Client) Reload(ctx context.Context) (string, error) {
+	var out struct {
+		Message string `json:"message"`
+	}
+	return out.Message, c.do(ctx, http.MethodPost, "/config/reload", nil, &out)
+}
+
+// Info returns where the proxy bound: its listen addresses and web port.
+func (c *Client) Info(ctx context.Context) (*proxy.Info, error) {
+	var info proxy.Info
+	return &info, c.do(ctx, http.MethodGet, "/info", nil, &info)
+}
+
+// Logs returns the recent lines of the proxy's own log, oldest first.
+func (c *Client) Logs(ctx context.Context) ([]proxy.LogLine, error) {
+	var lines []proxy.LogLine
+	return lines, c.do(ctx, http.MethodGet, "/logs", nil, &lines)
+}
+
+// Stats returns traffic statistics per window, overall and per upstream.
+func (c *Client) Stats(ctx context.Context) (*proxy.Stats, error) {
+	var s proxy.Stats
+	return &s, c.do(ctx, http.MethodGet, "/stats", nil, &s)
+}
+
+// ShadowReport returns the comparisons of mirrored responses with the
+// originals.
+func (c *Client) ShadowReport(ctx context.Context) (*proxy.ShadowReport, error) {
+	var r proxy.ShadowReport
+	return &r, c.do(ctx, http.MethodGet, "/shadow/report", nil, &r)
+}
+
+// ResetShadowReport clears the shadow report.
+func (c *Client) ResetShadowReport(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/shadow/report", nil, nil)
+}
+
+// Views returns the saved filter views.
+func (c *Client) Views(ctx context.Context) ([]proxy.View, error) {
+	var v []proxy.View
+	return v, c.do(ctx, http.MethodGet, "/views", nil, &v)
+}
+
+// SaveView saves a named filter view, replacing one of the same name.
+func (c *Client) SaveView(ctx context.Context, name, filter string) error {
+	body := map[string]string{"filter": filter}
+	return c.do(ctx, http.MethodPut, "/views/"+url.PathEscape(name), body, nil)
+}
+
+// DeleteView deletes a view saved at runtime.
+func (c *Client) DeleteView(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/views/"+url.PathEscape(name), nil, nil)
+}
+
+// do sends a request with in as its JSON body, if not nil, and decodes the
+// JSON response into out, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("http-proxy: decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// send sends a request to the API and returns the response if its status
+// is 2xx, or else an *Error.
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api/v1"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req.Header)
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// authorize adds the client's credentials to h.
+func (c *Client) authorize(h http.Header) {
+	if c.Token != "" {
+		h.Set("Authorization", "Bearer "+c.Token)
+	} else if c.User != "" {
+		r := http.Request{Header: h}
+		r.SetBasicAuth(c.User, c.Password)
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/gorilla/websocket"
+)
+
+// Events streams flow events (new flows, responses, deletions, reloads,
+// replay job progress) over the /api/v1/events WebSocket. The channel is
+// closed when ctx is done or the connection drops. Like the web UI, a
+// client that falls far behind has events dropped by the proxy.
+func (c *Client) Events(ctx context.Context) (<-chan proxy.FlowEvent, error) {
+	u := "ws" + strings.TrimPrefix(c.BaseURL, "http") + "/api/v1/events"
+	h := http.Header{}
+	c.authorize(h)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u, h)
+	if err != nil {
+		if resp != nil {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: err.Error()}
+		}
+		return nil, err
+	}
+	ch := make(chan proxy.FlowEvent, 128)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var evt proxy.FlowEvent
+			if json.Unmarshal(data, &evt) != nil {
+				continue
+			}
+			select {
+			case ch <- evt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,238 @@
+// Package codegen turns captured flows into source code, so real traffic can
+// become regression tests.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// DefaultPackage is the package clause used when none is given.
+const DefaultPackage = "recorded_test"
+
+// skipRequestHeaders are set by the transport or the proxy and would make
+// generated requests brittle.
+var skipRequestHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Te":                true,
+	"Transfer-Encoding": true,
+	"X-Forwarded-For":   true,
+}
+
+// skipResponseHeaders are computed by net/http when the stub responds.
+var skipResponseHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Transfer-Encoding": true,
+}
+
+// GoTest renders flows as a Go test file containing:
+//
+//   - newRecordedServer, an httptest.Server stub that replays the captured
+//     responses, for testing client code against real traffic; and
+//   - TestRecordedFlows, a table-driven test that sends the captured requests
+//     to a handler under test and checks the captured status and body.
+//
+// Flows without a response are skipped. pkg defaults to DefaultPackage.
+func GoTest(flows []*proxy.Flow, pkg string) ([]byte, error) {
+	if pkg == "" {
+		pkg = DefaultPackage
+	}
+	data := struct {
+		Package string
+		Cases   []testCase
+	}{Package: pkg}
+	for _, f := range flows {
+		if f.Request == nil || f.Response == nil {
+			continue
+		}
+		data.Cases = append(data.Cases, newTestCase(f))
+	}
+
+	var buf bytes.Buffer
+	if err := goTestTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// testCase holds pre-quoted Go literals for one flow.
+type testCase struct {
+	Name       string
+	Note       []string // comment lines from the flow's note
+	Method     string
+	Target     string
+	Header     string
+	Body       string
+	Status     int
+	RespHeader string
+	RespBody   string
+}
+
+func newTestCase(f *proxy.Flow) testCase {
+	req, resp := f.Request, f.Response
+	target := req.URL
+	if target == "" {
+		target = req.Path
+	}
+	return testCase{
+		Name:       strconv.Quote(req.Method + " " + req.Path),
+		Note:       noteLines(f.Note),
+		Method:     strconv.Quote(req.Method),
+		Target:     strconv.Quote(target),
+		Header:     headerLiteral(req.Headers, skipRequestHeaders),
+		Body:       bodyLiteral(req.ReadBody()),
+		Status:     resp.StatusCode,
+		RespHeader: headerLiteral(resp.Headers, skipResponseHeaders),
+		RespBody:   bodyLiteral(resp.ReadBody()),
+	}
+}
+
+// noteLines splits a flow note into lines for a Go comment.
+func noteLines(note string) []string {
+	if note == "" {
+		return nil
+	}
+	return strings.Split(note, "\n")
+}
+
+// headerLiteral renders h as an http.Header composite literal.
+func headerLiteral(h http.Header, skip map[string]bool) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		if !skip[http.CanonicalHeaderKey(k)] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return "nil"
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	b.WriteString("http.Header{\n")
+	for _, k := range keys {
+		vals := make([]string, len(h[k]))
+		for i, v := range h[k] {
+			vals[i] = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, "%s: {%s},\n", strconv.Quote(k), strings.Join(vals, ", "))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// bodyLiteral renders body as a Go string literal, using a raw string when
+// that is both possible and more readable.
+func bodyLiteral(body []byte) string {
+	s := string(body)
+	if strings.Contains(s, "\n") && !strings.ContainsAny(s, "`\r") && strconv.CanBackquote(strings.ReplaceAll(s, "\n", "")) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+var goTestTmpl = template.Must(template.New("gotest").Parse(`// Code generated by http-proxy from captured traffic. Edit as needed.
+
+package {{.Package}}
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordedFlows are the captured request/response pairs.
+var recordedFlows = []struct {
+	name       string
+	method     string
+	target     string
+	header     http.Header
+	body       string
+	wantStatus int
+	respHeader http.Header
+	wantBody   string
+}{
+{{- range .Cases}}
+	{
+{{- range .Note}}
+		// {{.}}
+{{- end}}
+		name:       {{.Name}},
+		method:     {{.Method}},
+		target:     {{.Target}},
+		header:     {{.Header}},
+		body:       {{.Body}},
+		wantStatus: {{.Status}},
+		respHeader: {{.RespHeader}},
+		wantBody:   {{.RespBody}},
+	},
+{{- end}}
+}
+
+// newRecordedServer starts a stub server that answers each recorded
+// method and target with its captured response. Unknown requests get 404.
+func newRecordedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range recordedFlows {
+			if f.method != r.Method || f.target != r.URL.RequestURI() {
+				continue
+			}
+			for k, vv := range f.respHeader {
+				w.Header()[k] = vv
+			}
+			w.WriteHeader(f.wantStatus)
+			io.WriteString(w, f.wantBody)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// handlerUnderTest returns the handler TestRecordedFlows exercises.
+func handlerUnderTest(t *testing.T) http.Handler {
+	t.Skip("TODO: return the http.Handler under test")
+	return nil
+}
+
+func TestRecordedFlows(t *testing.T) {
+	for _, tt := range recordedFlows {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlerUnderTest(t)
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for k, vv := range tt.header {
+				req.Header[k] = vv
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+`))
@@ -0,0 +1,225 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// LoadTestOptions controls K6 and Vegeta output.
+type LoadTestOptions struct {
+	// BaseURL replaces each flow's scheme and host (e.g.
+	// "http://localhost:8081"). Empty keeps the captured host, over http.
+	BaseURL string
+
+	// KeepTiming makes K6 wait so each request starts at the same offset from
+	// the first one as when it was captured. Vegeta paces requests itself
+	// (-rate), so its targets carry no timing.
+	KeepTiming bool
+}
+
+// loadRequest is one captured request, ready to be rendered.
+type loadRequest struct {
+	Name   string
+	Method string
+	Origin string
+	Target string
+	Header http.Header
+	Body   []byte
+	Status int           // captured status, 0 when the flow has no response
+	Offset time.Duration // start time relative to the first request
+}
+
+func loadRequests(flows []*proxy.Flow, opts LoadTestOptions) []loadRequest {
+	var reqs []loadRequest
+	var first time.Time
+	for _, f := range flows {
+		req := f.Request
+		if req == nil {
+			continue
+		}
+		origin, target := "http://"+req.Host, req.URL
+		if u, err := url.Parse(req.URL); err == nil && u.IsAbs() {
+			origin, target = u.Scheme+"://"+u.Host, u.RequestURI()
+		}
+		if target == "" {
+			target = req.Path
+		}
+		if opts.BaseURL != "" {
+			origin = strings.TrimSuffix(opts.BaseURL, "/")
+		}
+		lr := loadRequest{
+			Name:   req.Method + " " + req.Path,
+			Method: req.Method,
+			Origin: origin,
+			Target: target,
+			Header: http.Header{},
+			Body:   req.ReadBody(),
+		}
+		for k, vv := range req.Headers {
+			if !skipRequestHeaders[http.CanonicalHeaderKey(k)] {
+				lr.Header[k] = vv
+			}
+		}
+		if f.Response != nil {
+			lr.Status = f.Response.StatusCode
+		}
+		if first.IsZero() {
+			first = f.Timestamps.Created
+		}
+		if !f.Timestamps.Created.IsZero() {
+			lr.Offset = max(0, f.Timestamps.Created.Sub(first))
+		}
+		reqs = append(reqs, lr)
+	}
+	return reqs
+}
+
+// K6 renders flows as a k6 (https://k6.io) script that sends the captured
+// requests in order, with their recorded headers and bodies, and checks each
+// response against the captured status. BASE_URL in the environment
+// overrides every request's origin at run time.
+func K6(flows []*proxy.Flow, opts LoadTestOptions) ([]byte, error) {
+	data := struct {
+		Requests   []k6Request
+		KeepTiming bool
+		Binary     bool
+	}{KeepTiming: opts.KeepTiming}
+	for _, lr := range loadRequests(flows, opts) {
+		r := k6Request{
+			Title:  lr.Name,
+			Name:   jsString(lr.Name),
+			Method: jsString(lr.Method),
+			Origin: jsString(lr.Origin),
+			Target: jsString(lr.Target),
+			Body:   "null",
+			Status: lr.Status,
+			Wait:   lr.Offset.Milliseconds(),
+		}
+		if len(lr.Header) > 0 {
+			h := make(map[string]string, len(lr.Header))
+			for k, vv := range lr.Header {
+				sep := ", "
+				if http.CanonicalHeaderKey(k) == "Cookie" {
+					sep = "; "
+				}
+				h[k] = strings.Join(vv, sep)
+			}
+			b, err := json.Marshal(h)
+			if err != nil {
+				return nil, err
+			}
+			r.Header = string(b)
+		}
+		switch {
+		case len(lr.Body) == 0:
+		case utf8.Valid(lr.Body):
+			r.Body = jsString(string(lr.Body))
+		default:
+			r.Body = "encoding.b64decode(" + jsString(base64.StdEncoding.EncodeToString(lr.Body)) + ")"
+			data.Binary = true
+		}
+		data.Requests = append(data.Requests, r)
+	}
+	var buf bytes.Buffer
+	if err := k6Tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// k6Request holds pre-quoted JavaScript literals for one request.
+type k6Request struct {
+	Title  string // unquoted, for the comment
+	Name   string
+	Method string
+	Origin string
+	Target string
+	Header string // JSON object, empty when there are no headers
+	Body   string
+	Status int
+	Wait   int64 // milliseconds after the script starts
+}
+
+// jsString quotes s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+var k6Tmpl = template.Must(template.New("k6").Parse(`// Code generated by http-proxy from captured traffic. Edit as needed.
+//
+//   k6 run script.js
+//   k6 run -e BASE_URL=http://localhost:8081 --vus 10 --duration 30s script.js
+
+import http from 'k6/http';
+import { check{{if .KeepTiming}}, sleep{{end}} } from 'k6';
+{{- if .Binary}}
+import encoding from 'k6/encoding';
+{{- end}}
+
+const url = (origin, target) => (__ENV.BASE_URL || origin) + target;
+
+export default function () {
+{{- if .KeepTiming}}
+	const start = Date.now();
+	const wait = (ms) => {
+		const d = ms - (Date.now() - start);
+		if (d > 0) sleep(d / 1000);
+	};
+{{- end}}
+	let res;
+{{range .Requests}}
+	// {{.Title}}
+{{- if $.KeepTiming}}
+	wait({{.Wait}});
+{{- end}}
+	res = http.request({{.Method}}, url({{.Origin}}, {{.Target}}), {{.Body}}{{if .Header}}, {
+		headers: {{.Header}},
+	}{{end}});
+{{- if .Status}}
+	check(res, { {{.Name}}: (r) => r.status === {{.Status}} });
+{{- end}}
+{{end -}}
+}
+`))
+
+// vegetaTarget is one line of vegeta's JSON target format.
+type vegetaTarget struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Body   []byte      `json:"body,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// Vegeta renders flows as vegeta (https://github.com/tsenart/vegeta)
+// targets in its JSON format, one request per line:
+//
+//	vegeta attack -format=json -targets=targets.json -rate=50 -duration=30s
+func Vegeta(flows []*proxy.Flow, opts LoadTestOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, lr := range loadRequests(flows, opts) {
+		t := vegetaTarget{
+			Method: lr.Method,
+			URL:    lr.Origin + lr.Target,
+			Body:   lr.Body,
+		}
+		if len(lr.Header) > 0 {
+			t.Header = lr.Header
+		}
+		if err := enc.Encode(t); err != nil {
+			return nil, fmt.Errorf("encode %s: %w", lr.Name, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -11,6 +11,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
@@ -25,35 +28,705 @@ var DefaultFilenames = []string{"proxy.yml", "proxy.yaml", ".proxy.yml"}
 type UpstreamConfig struct {
 	Name   string `yaml:"name"`
 	Prefix string `yaml:"prefix"`
+	Target string `yaml:"target"` // base URL, or "passthrough" to forward by Host header
+	H2C    bool   `yaml:"h2c"`
+
+	// AllowHosts are the host globs a passthrough upstream may forward to.
+	AllowHosts []string `yaml:"allow_hosts"`
+
+	// PassthroughPort replaces the Host header's port for passthrough.
+	PassthroughPort int `yaml:"passthrough_port"`
+
+	// PrefixRegex matches the path with a regex instead of Prefix.
+	PrefixRegex string `yaml:"prefix_regex"`
+
+	// StripPrefix removes the matched prefix before forwarding.
+	StripPrefix bool `yaml:"strip_prefix"`
+
+	// RewriteTo replaces the matched prefix; supports $1 with PrefixRegex.
+	RewriteTo string `yaml:"rewrite_to"`
+
+	// Targets splits traffic across weighted destinations instead of Target.
+	Targets []TargetConfig `yaml:"targets"`
+
+	// Rules restrict the upstream to requests matching any rule.
+	Rules []RuleConfig `yaml:"rules"`
+
+	// RateLimit caps requests forwarded to the upstream; excess get a 429.
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
+
+	// TLS configures connections to https:// targets.
+	TLS *UpstreamTLSConfig `yaml:"tls"`
+
+	// Transport tunes timeouts and connection pooling for the upstream.
+	Transport *TransportConfig `yaml:"transport"`
+
+	// Affinity keeps each client on one of the weighted Targets.
+	Affinity *AffinityConfig `yaml:"affinity"`
+
+	// CORSOverride replaces the global cors_override for this upstream;
+	// false turns it off.
+	CORSOverride *CORSConfig `yaml:"cors_override"`
+
+	// Alerts replaces the global alerts for this upstream.
+	Alerts *AlertsConfig `yaml:"alerts"`
+
+	// Capture replaces the global capture rules for this upstream.
+	Capture []CaptureRuleConfig `yaml:"capture"`
+
+	// Auth attaches credentials to requests forwarded to the upstream.
+	Auth *AuthConfig `yaml:"auth"`
+
+	// Mirror also sends a copy of each request to another target.
+	Mirror *MirrorConfig `yaml:"mirror"`
+
+	// Retries re-sends idempotent requests that fail transiently.
+	Retries *RetryConfig `yaml:"retries"`
+
+	// HoldTimeout holds requests to a target that can't be reached for up
+	// to this long, until it is back, instead of failing them with a 502.
+	// HealthCheck is the path that must answer below 500 for it to count as
+	// back; without one, an open port will do.
+	HoldTimeout time.Duration `yaml:"hold_timeout"`
+	HealthCheck string        `yaml:"health_check"`
+
+	// SampleRate replaces the global sample_rate for this upstream.
+	SampleRate Fraction `yaml:"sample_rate"`
+
+	// Network replaces the global network profile for this upstream.
+	Network string `yaml:"network"`
+
+	// Command is a shell command that runs the upstream's server; the proxy
+	// starts it, restarts it when it exits, and waits for the target's port.
+	// CommandDir is its working directory; CommandEnv adds to its environment.
+	Command    string            `yaml:"command"`
+	CommandDir string            `yaml:"command_dir"`
+	CommandEnv map[string]string `yaml:"command_env"`
+}
+
+// CORSConfig rewrites the CORS headers of responses and answers preflights
+// in the proxy. It may also be written as true (all defaults) or false (off).
+type CORSConfig struct {
+	Disabled bool `yaml:"-"`
+
+	// Origins are the allowed origins; "*" allows any. Empty echoes the
+	// request's Origin.
+	Origins StringList `yaml:"origins"`
+
+	// Methods and Headers are what preflights allow (default: what they ask).
+	Methods StringList `yaml:"methods"`
+	Headers StringList `yaml:"headers"`
+
+	// ExposeHeaders are response headers scripts may read.
+	ExposeHeaders StringList `yaml:"expose_headers"`
+
+	// Credentials allows cookies and Authorization (default true).
+	Credentials *bool `yaml:"credentials"`
+
+	// MaxAge is how long browsers may cache preflight answers.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// UnmarshalYAML accepts a boolean or a mapping.
+func (c *CORSConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var on bool
+		if err := node.Decode(&on); err != nil {
+			return err
+		}
+		*c = CORSConfig{Disabled: !on}
+		return nil
+	}
+	type plain CORSConfig
+	return node.Decode((*plain)(c))
+}
+
+// LiveReloadConfig adds a reload script to proxied HTML pages, listening on
+// a WebSocket at Path (default /livereload) for the restart of one of
+// Upstreams (default: all). It may also be written as true or false.
+type LiveReloadConfig struct {
+	Disabled  bool       `yaml:"-"`
+	Path      string     `yaml:"path"`
+	Upstreams StringList `yaml:"upstreams"`
+}
+
+// UnmarshalYAML accepts a boolean or a mapping.
+func (c *LiveReloadConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var on bool
+		if err := node.Decode(&on); err != nil {
+			return err
+		}
+		*c = LiveReloadConfig{Disabled: !on}
+		return nil
+	}
+	type plain LiveReloadConfig
+	return node.Decode((*plain)(c))
+}
+
+// RetryConfig re-sends idempotent requests up to Max times (default 2)
+// when the upstream answers with one of the On statuses or, with
+// "connection-error", can't be reached (default: 502, 503, 504, and
+// connection errors), waiting Backoff (default 100ms) and twice as long
+// before each further retry.
+type RetryConfig struct {
+	Max     int           `yaml:"max"`
+	On      StringList    `yaml:"on"`
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+// MirrorConfig copies an upstream's requests to a second target: another
+// upstream's name or a base URL. It may also be written as just the target.
+type MirrorConfig struct {
 	Target string `yaml:"target"`
+
+	// Capture stores the copies as flows linked to the originals;
+	// otherwise their responses are discarded.
+	Capture bool `yaml:"capture"`
+
+	// Compare diffs each copy's response against the original's and tags
+	// the originals that differ.
+	Compare *CompareConfig `yaml:"compare"`
+}
+
+// CompareConfig tunes the comparison of mirrored responses: the response
+// headers compared, besides the status and body, and JSON body paths
+// expected to differ (e.g. "items[*].updatedAt").
+type CompareConfig struct {
+	Headers []string `yaml:"headers"`
+	Ignore  []string `yaml:"ignore"`
+}
+
+// UnmarshalYAML accepts a bare target as well as the full form.
+func (m *MirrorConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*m = MirrorConfig{}
+		return node.Decode(&m.Target)
+	}
+	type plain MirrorConfig
+	return node.Decode((*plain)(m))
+}
+
+// NetworkProfileConfig is a simulated client network: latency give or take
+// jitter, bandwidth caps in kilobits per second, and the share of requests
+// whose connection is reset (0.05 or "5%").
+type NetworkProfileConfig struct {
+	Name         string   `yaml:"name"`
+	LatencyMS    int      `yaml:"latency_ms"`
+	JitterMS     int      `yaml:"jitter_ms"`
+	DownloadKbps int      `yaml:"download_kbps"`
+	UploadKbps   int      `yaml:"upload_kbps"`
+	ResetRate    Fraction `yaml:"reset_rate"`
+}
+
+// AuthConfig is the credentials the proxy adds to an upstream's requests:
+// one of a static bearer token, basic auth, or an OAuth2 client credentials
+// grant. ${VAR} references in the credentials are expanded from the
+// environment, so secrets can stay out of the file.
+type AuthConfig struct {
+	Bearer string         `yaml:"bearer"`
+	Basic  *WebAuthConfig `yaml:"basic"`
+	OAuth2 *OAuth2Config  `yaml:"oauth2"`
+
+	// Override replaces an Authorization header sent by the client.
+	Override bool `yaml:"override"`
+}
+
+// OAuth2Config is an OAuth2 client credentials grant.
+type OAuth2Config struct {
+	TokenURL     string            `yaml:"token_url"`
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	Scopes       StringList        `yaml:"scopes"`
+	Params       map[string]string `yaml:"params"` // extra token request parameters, e.g. audience
+
+	// InParams sends the client ID and secret in the form, not basic auth.
+	InParams bool `yaml:"in_params"`
+}
+
+// AlertsConfig tags flows that are slower than LatencyMS or end with one
+// of Status ("5xx", "429"), and optionally reports them.
+type AlertsConfig struct {
+	LatencyMS int        `yaml:"latency_ms"`
+	Status    StringList `yaml:"status"`
+
+	// Webhook receives a JSON POST for each alert.
+	Webhook string `yaml:"webhook"`
+
+	// Notify shows a desktop notification (notify-send or osascript).
+	Notify bool `yaml:"notify"`
+}
+
+// CaptureRuleConfig limits body capture for bodies whose Content-Type
+// matches one of ContentType ("video/*") and, for responses, whose status
+// matches one of Status ("2xx", "404"): only MaxBodySize bytes are kept,
+// or none with Skip.
+type CaptureRuleConfig struct {
+	ContentType StringList `yaml:"content_type"`
+	Status      StringList `yaml:"status"`
+	MaxBodySize int64      `yaml:"max_body_size"`
+	Skip        bool       `yaml:"skip"`
+}
+
+// AffinityConfig selects sticky routing for weighted targets: Cookie names
+// a cookie the proxy sets to the chosen target; Header names a request
+// header whose value is hashed to pick one.
+type AffinityConfig struct {
+	Cookie string `yaml:"cookie"`
+	Header string `yaml:"header"`
+}
+
+// TransportConfig sets an upstream's connection timeouts and pool limits.
+// Durations are Go duration strings ("5s", "1m"); unset fields keep Go's
+// defaults.
+type TransportConfig struct {
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	KeepAlive             time.Duration `yaml:"keep_alive"` // TCP keep-alive interval; negative disables
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	MaxIdleConns          int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host"`
+	DisableKeepAlives     bool          `yaml:"disable_keep_alives"`
+}
+
+// UpstreamTLSConfig configures TLS to an upstream.
+type UpstreamTLSConfig struct {
+	// InsecureSkipVerify accepts any certificate (e.g. self-signed).
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string `yaml:"ca_file"`
+
+	// ClientCert and ClientKey are a PEM pair for mutual TLS.
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+
+	// ServerName overrides SNI and the name the certificate is checked against.
+	ServerName string `yaml:"server_name"`
+}
+
+// RateLimitConfig is a token-bucket rate limit.
+type RateLimitConfig struct {
+	// RPS is the sustained rate in requests per second.
+	RPS float64 `yaml:"rps"`
+
+	// Burst is the number of requests allowed at once (default: RPS rounded up).
+	Burst int `yaml:"burst"`
+}
+
+// TargetConfig is one weighted destination of an upstream.
+type TargetConfig struct {
+	URL string `yaml:"url"`
+
+	// Weight is the relative share of traffic (default 1; 0 disables).
+	Weight *int `yaml:"weight"`
+}
+
+// RuleConfig is the YAML representation of a routing rule.
+type RuleConfig struct {
+	Methods []string          `yaml:"methods"`
+	Headers map[string]string `yaml:"headers"`
+	Query   map[string]string `yaml:"query"`
+}
+
+// MockConfig is the YAML representation of a static mock response.
+type MockConfig struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	File    string            `yaml:"file"`
+}
+
+// TransformConfig is the YAML representation of a response body
+// transformation.
+type TransformConfig struct {
+	// Filter selects the responses to transform; empty matches all.
+	Filter    string            `yaml:"filter"`
+	Replace   []ReplaceConfig   `yaml:"replace"`
+	JSONPatch []JSONPatchConfig `yaml:"json_patch"`
+}
+
+// ReplaceConfig replaces matches of the regular expression Find with With.
+type ReplaceConfig struct {
+	Find string `yaml:"find"`
+	With string `yaml:"with"`
+}
+
+// JSONPatchConfig is one RFC 6902 JSON Patch operation.
+type JSONPatchConfig struct {
+	Op    string `yaml:"op"`
+	Path  string `yaml:"path"`
+	From  string `yaml:"from"`
+	Value any    `yaml:"value"`
+}
+
+// BreakpointConfig pauses the flows matching Filter at Phase.
+type BreakpointConfig struct {
+	Filter string `yaml:"filter"` // empty: every flow
+	Phase  string `yaml:"phase"`  // "request" (default) or "response"
+}
+
+// ViewConfig is a named filter expression.
+type ViewConfig struct {
+	Name   string `yaml:"name"`
+	Filter string `yaml:"filter"`
+}
+
+// JobConfig is a replay run on a schedule as a smoke test: the flows
+// matching Filter, or listed by ID in Flows, are replayed Every so often,
+// and pass if they get one of the Expect statuses (default: their
+// original's).
+type JobConfig struct {
+	Name   string        `yaml:"name"`
+	Filter string        `yaml:"filter"`
+	Flows  []string      `yaml:"flows"`
+	Target string        `yaml:"target"`
+	Every  time.Duration `yaml:"every"`
+	Expect StringList    `yaml:"expect"`
+	Assert *AssertConfig `yaml:"assert"`
+}
+
+// AssertConfig lists checks on a replay's response: its status, header
+// values matching regular expressions, and values at JSON body paths.
+type AssertConfig struct {
+	Status  StringList        `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	JSON    map[string]any    `yaml:"json"`
+}
+
+// TUIConfig configures the terminal UI's flow table.
+type TUIConfig struct {
+	// Columns lists the visible columns in order (default: num, method,
+	// status, upstream, path, duration, size).
+	Columns []string `yaml:"columns"`
+
+	// Sort is the initial sort: time, duration, status, or size, prefixed
+	// with "-" for descending (default: time).
+	Sort string `yaml:"sort"`
+}
+
+// LogConfig configures the access log written for every finished flow.
+type LogConfig struct {
+	// Format is "text" (default; one coloured line per flow) or "json"
+	// (one JSON object per line).
+	Format string `yaml:"format"`
+
+	// File appends the log to a file instead of writing it to stdout.
+	File string `yaml:"file"`
+
+	// Events writes every flow event (as sent to the web UI's WebSocket) as
+	// one JSON line to this file or FIFO, or to stdout when "-".
+	Events string `yaml:"events"`
+}
+
+// JWTConfig lists keys for verifying JWT signatures. Tokens are decoded
+// whether or not keys are given.
+type JWTConfig struct {
+	// Secrets are HMAC secrets for HS256/HS384/HS512 tokens.
+	Secrets []string `yaml:"secrets"`
+
+	// PublicKeys are PEM files (public keys or certificates) for RS*, PS*,
+	// ES*, and EdDSA tokens.
+	PublicKeys []string `yaml:"public_keys"`
+}
+
+// PersistConfig keeps flows across restarts: every finished flow is
+// appended to the journal (see session.Journal) at Path, and the last
+// Reload of them are loaded into the flow store on start. A journal larger than MaxBytes (default
+// DefaultJournalMaxBytes) is cut down to its newest flows on start.
+type PersistConfig struct {
+	Path     string `yaml:"path"`
+	Reload   int    `yaml:"reload"`
+	MaxBytes int64  `yaml:"max_bytes"`
+}
+
+// DefaultJournalMaxBytes is the journal size that triggers compaction.
+const DefaultJournalMaxBytes = 256 << 20
+
+// InjectConfig inserts an HTML snippet, given inline (HTML) or read from
+// File, before the closing </body> of the HTML responses Filter matches
+// (default: all).
+type InjectConfig struct {
+	Filter string `yaml:"filter"`
+	HTML   string `yaml:"html"`
+	File   string `yaml:"file"`
+}
+
+// SinkConfig uploads finished flows matching Filter, in batches of up to
+// Batch every Interval, to an HTTP endpoint (URL) or an S3-compatible
+// bucket (S3). Format is "ndjson" (default) or "har".
+type SinkConfig struct {
+	Name     string            `yaml:"name"`
+	URL      string            `yaml:"url"`
+	Headers  map[string]string `yaml:"headers"`
+	S3       *S3Config         `yaml:"s3"`
+	Format   string            `yaml:"format"`
+	Filter   string            `yaml:"filter"`
+	Batch    int               `yaml:"batch"`
+	Interval time.Duration     `yaml:"interval"`
+}
+
+// S3Config names a bucket and the credentials to upload to it with. Keys
+// default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+// AWS_SESSION_TOKEN environment variables.
+type S3Config struct {
+	Bucket       string `yaml:"bucket"`
+	Prefix       string `yaml:"prefix"`
+	Region       string `yaml:"region"`
+	Endpoint     string `yaml:"endpoint"`
+	AccessKey    string `yaml:"access_key"`
+	SecretKey    string `yaml:"secret_key"`
+	SessionToken string `yaml:"session_token"`
+}
+
+// Credentials returns the keys to sign requests with, expanding
+// environment variables and falling back to the standard AWS ones.
+func (c *S3Config) Credentials() (accessKey, secretKey, token string) {
+	get := func(v, env string) string {
+		if v != "" {
+			return os.ExpandEnv(v)
+		}
+		return os.Getenv(env)
+	}
+	return get(c.AccessKey, "AWS_ACCESS_KEY_ID"),
+		get(c.SecretKey, "AWS_SECRET_ACCESS_KEY"),
+		get(c.SessionToken, "AWS_SESSION_TOKEN")
+}
+
+// StringList is a YAML value that may be written as a single string or a
+// list of strings.
+type StringList []string
+
+// UnmarshalYAML accepts a scalar or a sequence.
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Fraction is a number between 0 and 1, written as one (0.25) or as a
+// percentage ("25%").
+type Fraction float64
+
+// UnmarshalYAML accepts a number or a percentage.
+func (f *Fraction) UnmarshalYAML(node *yaml.Node) error {
+	if pct, ok := strings.CutSuffix(node.Value, "%"); ok && node.Kind == yaml.ScalarNode {
+		v, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid percentage %q", node.Line, node.Value)
+		}
+		*f = Fraction(v / 100)
+		return nil
+	}
+	var v float64
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	*f = Fraction(v)
+	return nil
+}
+
+// WebAuthConfig is a basic-auth user and password for the web UI.
+type WebAuthConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
 }
 
 // Config is the full YAML configuration for http-proxy.
 type Config struct {
-	// Listen is the proxy server address (e.g. ":9090").
-	Listen string `yaml:"listen"`
+	// Listen is the proxy server address (e.g. ":9090"), or a list of them.
+	// Unix sockets are written "unix:///path/to/sock".
+	Listen StringList `yaml:"listen"`
 
 	// WebPort is the port for the web inspection UI. 0 disables it.
 	WebPort *int `yaml:"web_port"`
 
+	// AutoPort falls back to the next free port when a listen or web port
+	// is busy.
+	AutoPort bool `yaml:"auto_port"`
+
+	// InfoFile is where the bound ports are written as JSON while the proxy
+	// runs (default: http-proxy/running.json in the user config dir, or
+	// running.json in the profile's directory).
+	InfoFile string `yaml:"info_file"`
+
+	// WebAuth requires basic auth for the web UI and API; WebToken accepts
+	// a bearer token instead (or as well).
+	WebAuth  *WebAuthConfig `yaml:"web_auth"`
+	WebToken string         `yaml:"web_token"`
+
+	// WebUIDir serves the web UI's files from this directory instead of the
+	// copy embedded in the binary.
+	WebUIDir string `yaml:"web_ui_dir"`
+
 	// NoTUI disables the interactive terminal UI.
 	NoTUI bool `yaml:"no_tui"`
 
+	// TUI configures the terminal UI's flow table.
+	TUI TUIConfig `yaml:"tui"`
+
+	// Descriptors are FileDescriptorSet files (protoc
+	// --descriptor_set_out) naming the fields of protobuf, Twirp, and gRPC
+	// bodies.
+	Descriptors []string `yaml:"descriptors"`
+
+	// ProtoDescriptors is the older name of Descriptors; both are loaded.
+	ProtoDescriptors []string `yaml:"proto_descriptors"`
+
 	// NoColor disables ANSI colours in log output.
 	NoColor bool `yaml:"no_color"`
 
+	// Log configures the access log.
+	Log LogConfig `yaml:"log"`
+
 	// MaxFlows is the ring-buffer capacity for the flow store.
 	MaxFlows *int `yaml:"max_flows"`
 
+	// MaxStoreBytes also evicts the oldest flows while their in-memory
+	// bodies add up to more than this (0: no budget).
+	MaxStoreBytes int64 `yaml:"max_store_bytes"`
+
+	// SpillThreshold moves bodies larger than this to temporary files in
+	// SpillDir (default: the system temp directory) once their flow finishes
+	// (0: never).
+	SpillThreshold int64  `yaml:"spill_threshold"`
+	SpillDir       string `yaml:"spill_dir"`
+
+	// CompressThreshold compresses in-memory bodies larger than this with
+	// CompressAlgorithm ("gzip", the default, or "zstd") once their flow
+	// finishes (0: never).
+	CompressThreshold int64  `yaml:"compress_threshold"`
+	CompressAlgorithm string `yaml:"compress_algorithm"`
+
 	// MaxBodySize is the max bytes captured per request/response body.
 	MaxBodySize *int64 `yaml:"max_body_size"`
 
+	// MaxRequestSize rejects larger request bodies with 413 (0: no limit).
+	MaxRequestSize int64 `yaml:"max_request_size"`
+
+	// TLS serves the proxy listener over HTTPS.
+	TLS bool `yaml:"tls"`
+
+	// TLSCert and TLSKey are an optional PEM key pair. When unset, a local
+	// CA is generated in CertDir and used to issue certificates.
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+
+	// CertDir is where the generated local CA is cached.
+	CertDir string `yaml:"cert_dir"`
+
+	// HTTP2 enables HTTP/2 on the listener (h2 with TLS, h2c without).
+	HTTP2 bool `yaml:"http2"`
+
+	// ShutdownTimeout is how long to wait for in-flight flows on exit.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Mode is "reverse" (default) or "forward". In forward mode the proxy
+	// serves clients configured with HTTP_PROXY and upstreams are not needed.
+	Mode string `yaml:"mode"`
+
+	// MITM decrypts HTTPS tunnelled through a forward proxy, signing
+	// certificates with the local CA in CertDir.
+	MITM bool `yaml:"mitm"`
+
+	// JWT supplies keys for verifying the signatures of decoded JWTs.
+	JWT JWTConfig `yaml:"jwt"`
+
+	// Cache serves previously captured responses when an upstream is
+	// unreachable. Offline serves every request from the cache. CacheFile
+	// seeds the cache from, and saves it to, a session file. Offline and
+	// CacheFile both imply Cache.
+	Cache     bool   `yaml:"cache"`
+	Offline   bool   `yaml:"offline"`
+	CacheFile string `yaml:"cache_file"`
+
+	// Persist journals finished flows and reloads the latest on start.
+	Persist PersistConfig `yaml:"persist"`
+
+	// Sinks upload finished flows to HTTP endpoints or S3 buckets.
+	Sinks []SinkConfig `yaml:"sinks"`
+
+	// Inject inserts HTML snippets into matching HTML responses.
+	Inject []InjectConfig `yaml:"inject"`
+
 	// Upstream is a shorthand for a single catch-all upstream.
 	// Equivalent to a single entry in Upstreams with prefix "/".
 	Upstream string `yaml:"upstream"`
 
 	// Upstreams defines the routing table for multi-upstream mode.
 	Upstreams []UpstreamConfig `yaml:"upstreams"`
+
+	// Mocks are static responses served without contacting an upstream.
+	Mocks []MockConfig `yaml:"mocks"`
+
+	// Views are named filter expressions selectable in the TUI and web UI.
+	Views []ViewConfig `yaml:"views"`
+
+	// StateFile is where views saved from the UIs are kept
+	// (default: http-proxy/state.json in the user config dir).
+	StateFile string `yaml:"state_file"`
+
+	// Ignore lists filter expressions for requests that are proxied but
+	// never captured.
+	Ignore []string `yaml:"ignore"`
+
+	// RecordFilter, if set, is a filter expression limiting the flows
+	// stored to those it matches, checked on arrival and on completion.
+	RecordFilter string `yaml:"record_filter"`
+
+	// Jobs replay captured flows on a schedule as smoke tests.
+	Jobs []JobConfig `yaml:"jobs"`
+
+	// Breakpoints pause matching flows before they are forwarded or before
+	// their response is returned, until resumed from a UI or the API.
+	Breakpoints []BreakpointConfig `yaml:"breakpoints"`
+
+	// Transforms rewrite the bodies of matching responses, in order.
+	Transforms []TransformConfig `yaml:"transforms"`
+
+	// PathTemplates normalize paths into endpoints, such as
+	// /users/{id}, for request groups and per-endpoint stats.
+	PathTemplates []string `yaml:"path_templates"`
+
+	// CORSOverride rewrites the CORS headers of every upstream's responses
+	// and answers preflights in the proxy.
+	CORSOverride *CORSConfig `yaml:"cors_override"`
+
+	// LiveReload reloads the browsers showing proxied pages when a watched
+	// upstream restarts.
+	LiveReload *LiveReloadConfig `yaml:"live_reload"`
+
+	// Alerts tag slow or failing flows of every upstream that doesn't set
+	// its own.
+	Alerts *AlertsConfig `yaml:"alerts"`
+
+	// SampleRate is the share of flows stored (e.g. 0.1 or "10%"); the
+	// rest are proxied and counted in the stats but not kept.
+	SampleRate Fraction `yaml:"sample_rate"`
+
+	// Capture limits body capture by content type and status for every
+	// upstream that doesn't set its own rules.
+	Capture []CaptureRuleConfig `yaml:"capture"`
+
+	// NetworkProfiles define simulated networks, in addition to (or in
+	// place of) the built-in slow-3g, 3g, lte, and flaky-wifi.
+	NetworkProfiles []NetworkProfileConfig `yaml:"network_profiles"`
+
+	// Network is the profile simulated for every upstream that doesn't set
+	// its own; it can be switched at runtime.
+	Network string `yaml:"network"`
 }
 
 // Load reads and parses a YAML config file from path.
@@ -86,18 +759,39 @@ func FindDefault(dir string) string {
 func (c *Config) ToOptions() proxy.Options {
 	opts := proxy.Options{}
 
-	if c.Listen != "" {
-		opts.ListenAddr = c.Listen
+	if len(c.Listen) > 0 {
+		opts.ListenAddr = c.Listen[0]
+		opts.ExtraListenAddrs = c.Listen[1:]
 	}
 	if c.WebPort != nil {
 		opts.WebPort = *c.WebPort
 	}
+	opts.AutoPort = c.AutoPort
+	if c.WebAuth != nil {
+		opts.WebAuth.User = c.WebAuth.User
+		opts.WebAuth.Password = c.WebAuth.Password
+	}
+	opts.WebAuth.Token = c.WebToken
 	if c.MaxFlows != nil {
 		opts.MaxFlows = *c.MaxFlows
 	}
+	opts.MaxStoreBytes = c.MaxStoreBytes
+	opts.SpillThreshold = c.SpillThreshold
+	opts.SpillDir = c.SpillDir
+	opts.CompressThreshold = c.CompressThreshold
+	opts.CompressAlgorithm = c.CompressAlgorithm
 	if c.MaxBodySize != nil {
 		opts.MaxBodySize = *c.MaxBodySize
 	}
+	opts.MaxRequestSize = c.MaxRequestSize
+	opts.TLS = c.TLS
+	opts.TLSCertFile = c.TLSCert
+	opts.TLSKeyFile = c.TLSKey
+	opts.CertDir = c.CertDir
+	opts.HTTP2 = c.HTTP2
+	opts.ShutdownTimeout = c.ShutdownTimeout
+	opts.Mode = c.Mode
+	opts.MITM = c.MITM
 
 	// Build upstream list.
 	if c.Upstream != "" {
@@ -115,46 +809,503 @@ func (c *Config) ToOptions() proxy.Options {
 		name := u.Name
 		if name == "" {
 			name = u.Prefix
+			if u.PrefixRegex != "" {
+				name = u.PrefixRegex
+			}
 		}
 		opts.Upstreams = append(opts.Upstreams, proxy.Upstream{
 			Name:   name,
 			Prefix: prefix,
 			Target: u.Target,
+			H2C:    u.H2C,
+			Rules:  toRules(u.Rules),
+
+			PrefixRegex: u.PrefixRegex,
+			StripPrefix: u.StripPrefix,
+			RewriteTo:   u.RewriteTo,
+			Targets:     toTargets(u.Targets),
+			RateLimit:   toRateLimit(u.RateLimit),
+			TLS:         toUpstreamTLS(u.TLS),
+			Transport:   toTransport(u.Transport),
+			Affinity:    toAffinity(u.Affinity),
+			CORS:        toCORS(u.CORSOverride),
+			Alerts:      toAlerts(u.Alerts),
+			Capture:     toCaptureRules(u.Capture),
+			Auth:        toAuth(u.Auth),
+			Mirror:      toMirror(u.Mirror),
+			Retry:       toRetry(u.Retries),
+			HoldTimeout: u.HoldTimeout,
+			HealthCheck: u.HealthCheck,
+			SampleRate:  float64(u.SampleRate),
+			Network:     u.Network,
+
+			AllowHosts:      u.AllowHosts,
+			PassthroughPort: u.PassthroughPort,
+
+			Command:    u.Command,
+			CommandDir: u.CommandDir,
+			CommandEnv: u.CommandEnv,
 		})
 	}
 
+	for _, m := range c.Mocks {
+		opts.Mocks = append(opts.Mocks, proxy.Mock{
+			Name:     m.Name,
+			Method:   m.Method,
+			Path:     m.Path,
+			Status:   m.Status,
+			Headers:  m.Headers,
+			Body:     m.Body,
+			BodyFile: m.File,
+		})
+	}
+
+	for _, v := range c.Views {
+		opts.Views = append(opts.Views, proxy.View{Name: v.Name, Filter: v.Filter})
+	}
+	opts.StateFile = c.StateFile
+
+	for _, expr := range c.Ignore {
+		opts.Ignore = append(opts.Ignore, proxy.IgnoreRule{Filter: expr})
+	}
+	for _, j := range c.Jobs {
+		opts.Jobs = append(opts.Jobs, proxy.ScheduledJob{
+			Name:     j.Name,
+			Filter:   j.Filter,
+			Flows:    j.Flows,
+			Target:   j.Target,
+			Interval: j.Every,
+			Expect:   j.Expect,
+			Assert:   toAssertions(j.Assert),
+		})
+	}
+	if c.RecordFilter != "" {
+		opts.Record = &proxy.RecordFilter{Filter: c.RecordFilter}
+	}
+	for _, b := range c.Breakpoints {
+		opts.Breakpoints = append(opts.Breakpoints, proxy.Breakpoint{Filter: b.Filter, Phase: b.Phase})
+	}
+	for _, t := range c.Transforms {
+		opts.Transforms = append(opts.Transforms, toTransform(t))
+	}
+	opts.PathTemplates = c.PathTemplates
+	opts.CORS = toCORS(c.CORSOverride)
+	opts.LiveReload = toLiveReload(c.LiveReload)
+	opts.Alerts = toAlerts(c.Alerts)
+	opts.SampleRate = float64(c.SampleRate)
+	opts.Capture = toCaptureRules(c.Capture)
+	for _, p := range c.NetworkProfiles {
+		opts.NetworkProfiles = append(opts.NetworkProfiles, proxy.NetworkProfile{
+			Name:         p.Name,
+			LatencyMS:    p.LatencyMS,
+			JitterMS:     p.JitterMS,
+			DownloadKbps: p.DownloadKbps,
+			UploadKbps:   p.UploadKbps,
+			ResetRate:    float64(p.ResetRate),
+		})
+	}
+	opts.Network = c.Network
+
 	return opts
 }
 
+func toCORS(cc *CORSConfig) *proxy.CORS {
+	if cc == nil {
+		return nil
+	}
+	return &proxy.CORS{
+		Disabled:         cc.Disabled,
+		AllowOrigins:     cc.Origins,
+		AllowMethods:     cc.Methods,
+		AllowHeaders:     cc.Headers,
+		ExposeHeaders:    cc.ExposeHeaders,
+		AllowCredentials: cc.Credentials == nil || *cc.Credentials,
+		MaxAge:           cc.MaxAge,
+	}
+}
+
+func toLiveReload(lc *LiveReloadConfig) *proxy.LiveReload {
+	if lc == nil || lc.Disabled {
+		return nil
+	}
+	return &proxy.LiveReload{Path: lc.Path, Upstreams: lc.Upstreams}
+}
+
+// toAssertions converts the checks of a job, nil if there are none.
+func toAssertions(ac *AssertConfig) *proxy.Assertions {
+	if ac == nil {
+		return nil
+	}
+	return &proxy.Assertions{Status: ac.Status, Headers: ac.Headers, JSON: ac.JSON}
+}
+
+func toAlerts(ac *AlertsConfig) *proxy.Alerts {
+	if ac == nil {
+		return nil
+	}
+	return &proxy.Alerts{
+		Latency: time.Duration(ac.LatencyMS) * time.Millisecond,
+		Status:  ac.Status,
+		Webhook: ac.Webhook,
+		Desktop: ac.Notify,
+	}
+}
+
+// toCaptureRules converts capture rules, keeping an empty list distinct
+// from none: an upstream with "capture: []" captures bodies in full.
+func toCaptureRules(rules []CaptureRuleConfig) []proxy.CaptureRule {
+	if rules == nil {
+		return nil
+	}
+	out := make([]proxy.CaptureRule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, proxy.CaptureRule{
+			ContentTypes: r.ContentType,
+			Status:       r.Status,
+			MaxBodySize:  r.MaxBodySize,
+			Skip:         r.Skip,
+		})
+	}
+	return out
+}
+
+func toTransform(tc TransformConfig) proxy.ResponseTransform {
+	t := proxy.ResponseTransform{Filter: tc.Filter}
+	for _, r := range tc.Replace {
+		t.Replace = append(t.Replace, proxy.BodyReplace{Find: r.Find, With: r.With})
+	}
+	for _, op := range tc.JSONPatch {
+		t.JSONPatch = append(t.JSONPatch, proxy.JSONPatchOp{Op: op.Op, Path: op.Path, From: op.From, Value: op.Value})
+	}
+	return t
+}
+
+func toAuth(ac *AuthConfig) *proxy.UpstreamAuth {
+	if ac == nil {
+		return nil
+	}
+	a := &proxy.UpstreamAuth{Bearer: os.ExpandEnv(ac.Bearer), Override: ac.Override}
+	if ac.Basic != nil {
+		a.User = os.ExpandEnv(ac.Basic.User)
+		a.Password = os.ExpandEnv(ac.Basic.Password)
+	}
+	if o := ac.OAuth2; o != nil {
+		a.OAuth2 = &proxy.OAuth2ClientCredentials{
+			TokenURL:     os.ExpandEnv(o.TokenURL),
+			ClientID:     os.ExpandEnv(o.ClientID),
+			ClientSecret: os.ExpandEnv(o.ClientSecret),
+			Scopes:       o.Scopes,
+			Params:       o.Params,
+			InParams:     o.InParams,
+		}
+	}
+	return a
+}
+
+func toMirror(mc *MirrorConfig) *proxy.Mirror {
+	if mc == nil {
+		return nil
+	}
+	m := &proxy.Mirror{Target: mc.Target, Capture: mc.Capture}
+	if cc := mc.Compare; cc != nil {
+		m.Compare = &proxy.ShadowCompare{Headers: cc.Headers, Ignore: cc.Ignore}
+	}
+	return m
+}
+
+func toRetry(rc *RetryConfig) *proxy.RetryPolicy {
+	if rc == nil {
+		return nil
+	}
+	return &proxy.RetryPolicy{Max: rc.Max, On: rc.On, Backoff: rc.Backoff}
+}
+
+func toRateLimit(rc *RateLimitConfig) *proxy.RateLimit {
+	if rc == nil {
+		return nil
+	}
+	return &proxy.RateLimit{RPS: rc.RPS, Burst: rc.Burst}
+}
+
+func toUpstreamTLS(tc *UpstreamTLSConfig) *proxy.UpstreamTLS {
+	if tc == nil {
+		return nil
+	}
+	return &proxy.UpstreamTLS{
+		InsecureSkipVerify: tc.InsecureSkipVerify,
+		CAFile:             tc.CAFile,
+		ClientCert:         tc.ClientCert,
+		ClientKey:          tc.ClientKey,
+		ServerName:         tc.ServerName,
+	}
+}
+
+func toTransport(tc *TransportConfig) *proxy.UpstreamTransport {
+	if tc == nil {
+		return nil
+	}
+	return &proxy.UpstreamTransport{
+		DialTimeout:           tc.DialTimeout,
+		KeepAlive:             tc.KeepAlive,
+		TLSHandshakeTimeout:   tc.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: tc.ResponseHeaderTimeout,
+		IdleConnTimeout:       tc.IdleConnTimeout,
+		MaxIdleConns:          tc.MaxIdleConns,
+		MaxIdleConnsPerHost:   tc.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       tc.MaxConnsPerHost,
+		DisableKeepAlives:     tc.DisableKeepAlives,
+	}
+}
+
+func toAffinity(ac *AffinityConfig) *proxy.Affinity {
+	if ac == nil {
+		return nil
+	}
+	return &proxy.Affinity{Cookie: ac.Cookie, Header: ac.Header}
+}
+
+func toTargets(tcs []TargetConfig) []proxy.Target {
+	var targets []proxy.Target
+	for _, tc := range tcs {
+		weight := 1
+		if tc.Weight != nil {
+			weight = *tc.Weight
+		}
+		targets = append(targets, proxy.Target{URL: tc.URL, Weight: weight})
+	}
+	return targets
+}
+
+func toRules(rcs []RuleConfig) []proxy.Rule {
+	var rules []proxy.Rule
+	for _, rc := range rcs {
+		rules = append(rules, proxy.Rule{
+			Methods: rc.Methods,
+			Headers: rc.Headers,
+			Query:   rc.Query,
+		})
+	}
+	return rules
+}
+
 // Example returns the canonical example config as a YAML string.
 func Example() string {
 	return `# http-proxy configuration
 # All fields are optional; CLI flags take precedence over this file.
 
-# Proxy listen address.
+# Proxy listen address, or a list of them. Unix sockets: "unix:///path".
 listen: ":9090"
+# listen: ["127.0.0.1:9090", "unix:///tmp/http-proxy.sock"]
 
 # Port for the web inspection UI. Set to 0 to disable.
 web_port: 9091
 
+# If the listen or web port is taken, use the next free one instead of
+# failing. The ports actually bound are served at GET /api/info and written
+# to info_file (default: running.json in the user config dir).
+# auto_port: true
+# info_file: /tmp/http-proxy.json
+
+# Require credentials for the web UI and API, e.g. on a shared machine:
+# basic auth, and/or a token sent as "Authorization: Bearer <token>" or
+# opened once as http://host:9091/?token=<token>.
+# web_auth: {user: me, password: s3cret}
+# web_token: change-me
+
+# Serve the web UI from a directory (index.html, app.css, app.js) instead of
+# the copy built into the binary.
+# web_ui_dir: ./my-ui
+
 # Disable the interactive terminal UI (log to stdout instead).
 no_tui: false
 
+# Flow table columns, in order: num, method, status, upstream, host, path,
+# duration, size, type, started, tags. sort is time (default), duration,
+# status, or size, with a "-" prefix for descending; o and O change it.
+# tui:
+#   columns: [num, method, status, host, path, duration, size]
+#   sort: -duration
+
+# Protobuf descriptor sets (protoc --include_imports --descriptor_set_out=...)
+# used to decode protobuf, Twirp, and gRPC bodies into JSON, and to tag flows
+# "proto:<type>". Without them, fields are shown by number. The message type
+# comes from the messageType Content-Type parameter or the method in the path
+# (/pkg.Service/Method, /twirp/pkg.Service/Method). proto_descriptors is an
+# older name for the same list.
+# descriptors: [./api.pb]
+
 # Disable ANSI colors in log output.
 no_color: false
 
+# Access log: "text" (default) or "json" (one object per flow: timings, sizes,
+# upstream, status, tags). file appends to a file instead of stdout. events
+# streams every flow event (new, response, delete, ...) as NDJSON to a file,
+# a named pipe, or stdout ("-"; the access log then goes to stderr).
+# log:
+#   format: json
+#   file: access.ndjson
+#   events: /tmp/http-proxy.events
+
 # Maximum number of flows held in memory (ring buffer).
 max_flows: 1000
 
+# Also evict the oldest flows while the bodies held in memory add up to more
+# than this many bytes (default: 0 = count only). Pinned flows are kept.
+# max_store_bytes: 268435456
+
+# Move captured bodies larger than this many bytes to temporary files in
+# spill_dir (default: the system temp directory), read back when displayed or
+# exported. They don't count against max_store_bytes (default: 0 = never).
+# spill_threshold: 65536
+# spill_dir: /var/tmp
+
+# Compress captured bodies larger than this many bytes once their flow
+# finishes, keeping them in memory compressed; max_store_bytes counts the
+# compressed size, so the budget holds more flows (default: 0 = never).
+# compress_algorithm is gzip (the default) or zstd.
+# compress_threshold: 4096
+# compress_algorithm: gzip
+
 # Maximum bytes captured per request/response body (default: 1048576 = 1 MiB).
 max_body_size: 1048576
 
+# Reject request bodies larger than this with 413 Request Entity Too Large,
+# before forwarding them (default: 0 = no limit).
+# max_request_size: 104857600
+
+# Serve the proxy over HTTPS. A local CA is generated on first run; trust its
+# ca.pem (printed at startup) to avoid browser warnings.
+tls: false
+# tls_cert: ./cert.pem
+# tls_key: ./key.pem
+# cert_dir: ~/.cache/http-proxy/certs
+
+# Serve HTTP/2 on the listener (h2 over TLS, cleartext h2c otherwise).
+http2: false
+
+# On Ctrl-C or SIGTERM, stop accepting connections and wait this long for
+# in-flight flows (streams and WebSockets included) to finish; the rest are
+# closed and recorded as errors tagged "shutdown" (default: 5s).
+# shutdown_timeout: 30s
+
+# Run as a forward proxy instead of a reverse proxy: point clients at it with
+# HTTP_PROXY/HTTPS_PROXY and no upstreams are needed. mitm decrypts HTTPS
+# tunnels with certificates from the local CA, which clients must trust.
+mode: reverse
+# mitm: true
+
+# Response cache: serve the last captured response for a request (keyed by
+# method, path, query, and body hash) when its upstream is unreachable.
+# offline serves everything from the cache without contacting upstreams;
+# cache_file persists the cache between runs. Both imply cache.
+cache: false
+# offline: true
+# cache_file: ./cache.json
+
+# Keep flows across restarts: append every finished flow to a journal (a
+# bbolt database) and load the last reload of them into the flow store on
+# start. A journal over max_bytes (default: 256 MiB) is cut down to its
+# newest flows on start.
+# persist:
+#   path: .http-proxy/journal
+#   reload: 500
+#   max_bytes: 268435456
+
+# Sinks: upload finished flows in batches, as NDJSON (default) or HAR, to an
+# HTTP endpoint (POSTed) or an S3-compatible bucket (one object per batch).
+# A batch is sent when it holds batch flows (default: 100) or every interval
+# (default: 30s), and once more on shutdown. $VARS in headers and keys are
+# expanded; S3 keys default to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+# sinks:
+#   - name: archive
+#     s3:
+#       bucket: team-traffic
+#       prefix: http-proxy/
+#       region: eu-west-1
+#       # endpoint: http://localhost:9000   # MinIO, R2, ...
+#     format: har
+#   - name: collector
+#     url: https://collector.internal/flows
+#     headers: {Authorization: "Bearer $COLLECTOR_TOKEN"}
+#     filter: ~s 5                         # server errors only
+#     batch: 20
+#     interval: 10s
+
+# JWTs in Authorization headers and cookies are decoded and shown on each
+# flow. Supply keys to verify their signatures too.
+# jwt:
+#   secrets: [dev-secret]
+#   public_keys: [./keys/auth.pem]
+
+# CORS override: replace the CORS headers of upstream responses and answer
+# preflight requests in the proxy, for a frontend on another origin (e.g. a
+# dev server on :3000). true allows any origin with credentials; upstreams
+# may set their own cors_override, or false to leave theirs untouched.
+# cors_override: true
+# cors_override:
+#   origins: ["http://localhost:3000"]   # default: echo the request's Origin
+#   methods: [GET, POST, PUT, DELETE]    # default: whatever preflights ask for
+#   headers: [Content-Type, Authorization]
+#   expose_headers: [X-Request-Id]
+#   credentials: true                    # cookies and Authorization (default)
+#   max_age: 10m                         # let browsers cache preflights
+
+# Live reload: add a script to proxied HTML pages that reloads them when a
+# watched upstream restarts, seen by its command opening its port again or,
+# for other upstreams, its health check passing after failing.
+# live_reload: true
+# live_reload:
+#   path: /livereload        # WebSocket on the proxy's own port (default)
+#   upstreams: [api]         # default: all
+
+# Alerts: tag flows that are slower than latency_ms or end with one of the
+# statuses ("alert:latency", "alert:status"), highlighted in both UIs.
+# Upstreams may set their own alerts in place of these.
+# alerts:
+#   latency_ms: 500
+#   status: [5xx, 429]
+#   webhook: http://localhost:9000/hooks/proxy   # POSTed JSON per alert
+#   notify: true                                 # desktop notification
+
+# Store only a share of flows (0.1 or "10%"), to bound memory in front of
+# chatty services. Every request is still proxied and counted in the stats.
+# Upstreams may set their own sample_rate.
+# sample_rate: 1
+
+# Capture rules: keep less of some bodies, by Content-Type and (for
+# responses) status; the first matching rule wins. Skipped bodies are tagged
+# "capture-skipped", and every flow's headers, sizes, and timings are still
+# recorded. Upstreams may set their own capture rules ([] captures all).
+# capture:
+#   - content_type: [video/*, audio/*, image/*]
+#     skip: true
+#   - content_type: text/html
+#     max_body_size: 4096
+#   - status: 3xx
+#     skip: true
+
+# Network simulation: delay, throttle, and occasionally reset requests as a
+# slow or flaky client network would, to try a frontend's loading states.
+# Built-in profiles are slow-3g, 3g, lte, and flaky-wifi; define more here.
+# Switch profiles at runtime with N in the TUI, the web UI's Network menu, or
+# PUT /api/network. Upstreams may set their own network.
+# network: 3g
+# network_profiles:
+#   - name: train
+#     latency_ms: 300
+#     jitter_ms: 250
+#     download_kbps: 800
+#     upload_kbps: 200
+#     reset_rate: 3%
+
 # --- Upstream routing ---
 
 # Single upstream: proxy everything to one target.
 # upstream: http://localhost:8081
 
 # Multi-upstream: route by path prefix (longer prefixes win).
+# Optional rules narrow an upstream further by method, header, or query
+# parameter; any rule may match, and all conditions within a rule must hold.
 upstreams:
   - name: ctl-api
     prefix: /api
@@ -162,8 +1313,198 @@ upstreams:
   - name: runner
     prefix: /runner
     target: http://localhost:8083
+    # h2c: true  # cleartext HTTP/2 to the target (e.g. gRPC)
+    # rate_limit: {rps: 5, burst: 10}  # excess requests get 429 Retry-After
+    # cors_override: false            # keep the upstream's own CORS headers
+    # alerts: {latency_ms: 2000, status: 5xx}
+    # sample_rate: 5%                 # keep 1 in 20 of this upstream's flows
+    # capture: [{content_type: application/octet-stream, skip: true}]
+    # network: slow-3g                # simulate a slow network for this upstream
+    # retries: {max: 2, on: [502, 503, connection-error], backoff: 100ms}  # re-send idempotent requests
+    # auth:                             # credentials added to every request
+    #   bearer: ${RUNNER_TOKEN}         # ${VAR} is read from the environment
+    #   # basic: {user: me, password: ${RUNNER_PASSWORD}}
+    #   # oauth2:                       # client credentials, refreshed as needed
+    #   #   token_url: https://auth.example.com/oauth/token
+    #   #   client_id: local-dev
+    #   #   client_secret: ${RUNNER_CLIENT_SECRET}
+    #   #   scopes: [runner.read, runner.write]
+    #   #   params: {audience: https://runner.example.com}
+    #   # override: true                # replace the client's own Authorization
+    # mirror:                           # also send a copy of each request here
+    #   target: http://localhost:8086   # a base URL or another upstream's name
+    #   capture: true                   # store the copies, linked to the originals
+    #   compare:                        # diff the responses; see /api/shadow/report
+    #     headers: [Content-Type]       # compared besides the status and body
+    #     ignore: [requestId, items[*].updatedAt]  # JSON body paths that may differ
+    # tls:                              # for https:// targets
+    #   insecure_skip_verify: true      # accept self-signed certificates
+    #   ca_file: ./internal-ca.pem      # or trust a private CA
+    #   client_cert: ./client.pem       # mutual TLS
+    #   client_key: ./client-key.pem
+    #   server_name: runner.internal    # SNI / verification name override
+    # transport:                        # timeouts and connection pool
+    #   dial_timeout: 5s
+    #   response_header_timeout: 2m     # slow endpoints; default waits forever
+    #   idle_conn_timeout: 90s
+    #   max_idle_conns_per_host: 16
+    #   max_conns_per_host: 0           # 0 = unlimited
+    #   keep_alive: 30s                 # TCP keep-alive; -1s disables
+    #   disable_keep_alives: false      # true = new connection per request
+    # rules:
+    #   - headers: {X-Service: runner}
+    #   - methods: [POST]
+    #     query: {debug: ""}   # empty value = parameter present
+  # Regex routing with rewrite: /api/v1/users → /users on the target.
+  # - name: legacy
+  #   prefix_regex: /api/v1/(.*)
+  #   rewrite_to: /$1
+  #   target: http://localhost:8085
+  # Weighted targets: send 10% of /search traffic to a WIP build. Flows are
+  # tagged "target:<url>" with the destination that served them.
+  # - name: search
+  #   prefix: /search
+  #   targets:
+  #     - url: http://localhost:8090
+  #       weight: 90
+  #     - url: http://localhost:8091
+  #       weight: 10
+  #   affinity: {cookie: search_target}   # keep each browser on one target
+  #   # affinity: {header: X-User-Id}     # or hash a request header
+  # Or drop a plain prefix: /billing/invoices → /invoices.
+  # - name: billing
+  #   prefix: /billing
+  #   strip_prefix: true
+  #   target: http://localhost:8086
+  # Passthrough: forward to whatever host the Host header names, e.g. for
+  # domains mapped to the proxy in /etc/hosts. Only allow_hosts are served.
+  # - name: vhosts
+  #   prefix: /
+  #   target: passthrough
+  #   allow_hosts: ["*.test"]
+  #   passthrough_port: 8080   # optional: replace the Host header's port
   - name: dashboard
     prefix: /
     target: http://localhost:4000
+    # Run the server too: started with the proxy, restarted if it crashes, and
+    # requests wait for its port. Output shows in the TUI's logs screen (L).
+    # command: npm run dev
+    # command_dir: ./dashboard
+    # command_env: {PORT: "4000"}
+    # hold_timeout: 30s     # hold requests while the server restarts, not 502
+    # health_check: /healthz  # ...until this answers below 500 (default: port open)
+
+# --- Mock responses ---
+
+# Static responses served instead of forwarding (checked before routing, first
+# match wins). Each needs a path: exact, a glob ("/api/users/*"), or a prefix
+# ("/api/**"; "/**" matches everything).
+# Mocked flows are captured and tagged "mock".
+# mocks:
+#   - name: health
+#     path: /api/health
+#     body: '{"ok": true}'
+#     headers:
+#       Content-Type: application/json
+#   - method: POST
+#     path: /runner/jobs/**
+#     status: 202
+#     file: ./fixtures/job.json
+
+# --- Saved views ---
+
+# Named filter expressions, selectable with v in the TUI and from the views
+# menu in the web UI. Views saved from either UI are kept in state_file.
+# views:
+#   - name: errors
+#     filter: ~s 5 | ~t error
+#   - name: runner writes
+#     filter: ~u runner & !~m GET
+# state_file: ./.proxy-state.json
+
+# --- Ignored traffic ---
+
+# Requests matching any of these filter expressions are proxied as usual but
+# never captured or shown. They are checked when the request arrives, so
+# filters on the body or response (~b, ~s) never match.
+# ignore:
+#   - ~p ^/healthz$
+#   - ~p /_next/webpack-hmr
+
+# Store only the flows matching this filter expression. Flows that don't
+# match when the request arrives are held back and checked again when they
+# finish, so this keeps every POST and every server error:
+# record_filter: ~m POST | ~s 5
+
+# --- Breakpoints ---
+
+# Pause matching flows before they are forwarded (phase: request, the default)
+# or before their response is returned (phase: response), until resumed,
+# edited, or killed from the TUI's intercept screen (i), the web UI, or the
+# API. Response breakpoints see the status and headers, not the body. More can
+# be added while the proxy runs.
+# breakpoints:
+#   - filter: ~m POST & ~p /checkout
+#   - filter: ~u runner & ~s 5
+#     phase: response
+
+# --- Scheduled replays ---
+
+# Replay captured flows every so often as a smoke test. A run passes if every
+# replay gets one of the expected statuses (default: its original's status);
+# results are at GET /api/jobs and in the web UI's Jobs panel.
+# jobs:
+#   - name: smoke
+#     filter: ~u api & ~m GET      # originals only; replays are never replayed
+#     # flows: [<flow id>, ...]    # or specific flows, e.g. from a loaded session
+#     # target: http://localhost:8081
+#     every: 5m
+#     expect: [2xx, 304]
+#     assert:                      # further checks on each replay's response
+#       headers:
+#         Content-Type: ^application/json   # a regexp; "" only requires the header
+#       json:
+#         ok: true                 # the value at a JSON body path
+#         items[*].state: active   # [*] checks every element
+
+# --- Response transforms ---
+
+# Rewrite the bodies of matching upstream responses before they reach the
+# client, to try out a backend change without making it. JSON patches (RFC
+# 6902) apply to JSON responses, then regex replacements ($1 for submatches)
+# to the text. Filters see the response status and headers, not its body.
+# Transformed flows are tagged "transformed".
+# transforms:
+#   - filter: ~u runner & ~p /jobs
+#     json_patch:
+#       - {op: move, from: /status, path: /state}
+#       - {op: add, path: /beta, value: true}
+#   - filter: ~h content-type:text/html
+#     replace:
+#       - find: 'Runner (v\d+)'
+#         with: 'Runner $1-preview'
+
+# --- HTML injection ---
+
+# Insert HTML (a debugging overlay, an analytics stub) before the closing
+# </body> of matching HTML pages, inline or from a file. Compressed pages are
+# decompressed and Content-Length is fixed up. Injected flows are tagged
+# "injected".
+# inject:
+#   - filter: ~u dashboard
+#     html: <script src="https://cdn.example.com/debug-overlay.js"></script>
+#   - filter: ~p /admin
+#     file: ./snippets/banner.html
+
+# --- Path templates ---
+
+# Request groups and per-endpoint stats name endpoints by normalized path:
+# segments that look like IDs (numbers, UUIDs, long hex strings, and opaque
+# tokens) become {id}. List templates for paths that need more, in order;
+# {name} matches one segment and a final {name...} the rest of the path.
+# path_templates:
+#   - /repos/{owner}/{repo}/issues/{number}
+#   - /blog/{slug}
+#   - /static/{file...}
 `
 }
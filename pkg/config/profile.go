@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// A Profile is a named project kept under ProfilesDir, selected with
+// --profile: a directory holding the project's config file, its state file
+// (saved views, filter history), and its saved sessions, so several projects
+// can be switched between without juggling config files or ports.
+type Profile struct {
+	Name string
+	Dir  string
+}
+
+// validProfileName keeps profile names usable as directory names.
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ProfilesDir returns the directory profiles are kept in, in the user's
+// config directory.
+func ProfilesDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "http-proxy", "profiles")
+}
+
+// ConfigPath is the profile's config file.
+func (p Profile) ConfigPath() string { return filepath.Join(p.Dir, DefaultFilenames[0]) }
+
+// StateFile is where the profile's saved views and filter history are kept.
+func (p Profile) StateFile() string { return filepath.Join(p.Dir, "state.json") }
+
+// InfoFile is where a proxy running with the profile writes its bound ports.
+func (p Profile) InfoFile() string { return filepath.Join(p.Dir, "running.json") }
+
+// SessionDir is where the TUI saves sessions for the profile by default.
+func (p Profile) SessionDir() string { return filepath.Join(p.Dir, "sessions") }
+
+// profile returns the profile called name, which need not exist yet.
+func profile(name string) (Profile, error) {
+	if !validProfileName.MatchString(name) {
+		return Profile{}, fmt.Errorf("invalid profile name %q (use letters, digits, '.', '-', '_')", name)
+	}
+	return Profile{Name: name, Dir: filepath.Join(ProfilesDir(), name)}, nil
+}
+
+// OpenProfile returns the existing profile called name.
+func OpenProfile(name string) (Profile, error) {
+	p, err := profile(name)
+	if err != nil {
+		return p, err
+	}
+	if _, err := os.Stat(p.ConfigPath()); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, fmt.Errorf("profile %q does not exist (create it with `http-proxy profile new %s`)", name, name)
+		}
+		return p, err
+	}
+	return p, nil
+}
+
+// Profiles returns the existing profiles, sorted by name.
+func Profiles() ([]Profile, error) {
+	entries, err := os.ReadDir(ProfilesDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Profile
+	for _, e := range entries {
+		if p, err := OpenProfile(e.Name()); err == nil && e.IsDir() {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// CreateProfile creates the profile called name. Its config file is config,
+// or, if config is nil, the Example config with a listen port and web port
+// that no other profile uses, so profiles can run side by side.
+func CreateProfile(name string, config []byte) (Profile, error) {
+	p, err := profile(name)
+	if err != nil {
+		return p, err
+	}
+	if _, err := os.Stat(p.Dir); err == nil {
+		return p, fmt.Errorf("profile %q already exists in %s", name, p.Dir)
+	}
+	if config == nil {
+		listen, web, err := freeProfilePorts()
+		if err != nil {
+			return p, err
+		}
+		text := strings.Replace(Example(), `listen: ":9090"`, fmt.Sprintf(`listen: ":%d"`, listen), 1)
+		text = strings.Replace(text, "web_port: 9091", fmt.Sprintf("web_port: %d", web), 1)
+		config = []byte(fmt.Sprintf("# Profile %q; run it with `http-proxy --profile %s`.\n", name, name) + text)
+	}
+	if err := os.MkdirAll(p.SessionDir(), 0o755); err != nil {
+		return p, fmt.Errorf("create profile: %w", err)
+	}
+	if err := os.WriteFile(p.ConfigPath(), config, 0o644); err != nil {
+		return p, fmt.Errorf("create profile: %w", err)
+	}
+	return p, nil
+}
+
+// Ports returns the ports the profile's config has the proxy listen on and
+// serve the web UI on, defaults included.
+func (p Profile) Ports() (listen []int, web int, err error) {
+	cfg, err := Load(p.ConfigPath())
+	if err != nil {
+		return nil, 0, err
+	}
+	addrs := []string(cfg.Listen)
+	if len(addrs) == 0 {
+		addrs = []string{proxy.DefaultListenAddr}
+	}
+	for _, addr := range addrs {
+		if _, port, err := net.SplitHostPort(addr); err == nil {
+			if n, err := strconv.Atoi(port); err == nil {
+				listen = append(listen, n)
+			}
+		}
+	}
+	web = proxy.DefaultWebPort
+	if cfg.WebPort != nil {
+		web = *cfg.WebPort
+	}
+	return listen, web, nil
+}
+
+// freeProfilePorts picks the first pair of ports, counting up by two from the
+// defaults 9090 and 9091, that no existing profile's config uses.
+func freeProfilePorts() (listen, web int, err error) {
+	profiles, err := Profiles()
+	if err != nil {
+		return 0, 0, err
+	}
+	var used []int
+	for _, p := range profiles {
+		l, w, err := p.Ports()
+		if err != nil {
+			continue // a broken profile reserves nothing
+		}
+		used = append(append(used, l...), w)
+	}
+	for listen = 9090; slices.Contains(used, listen) || slices.Contains(used, listen+1); listen += 2 {
+	}
+	return listen, listen + 1, nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the burst of events a single editor save produces.
+const watchDebounce = 200 * time.Millisecond
+
+// Watch calls onChange each time the file at path is written or replaced,
+// until ctx is cancelled.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch config: %w", err)
+	}
+	defer w.Close()
+
+	// Watch the directory rather than the file: many editors save by writing
+	// a temp file and renaming it over the original, which drops a file watch.
+	if err := w.Add(filepath.Dir(abs)); err != nil {
+		return fmt.Errorf("watch config: %w", err)
+	}
+
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Name == abs && ev.Has(fsnotify.Write|fsnotify.Create) {
+				fire = time.After(watchDebounce)
+			}
+		case _, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			// Overflows and similar errors are transient; keep watching.
+		case <-fire:
+			fire = nil
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package curl
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// Command renders a captured request as a curl command line, the "Copy as
+// cURL" export. Origin-form URLs ("/path?q") are made absolute with the
+// request's Host, so the command goes back through the proxy.
+func Command(cr *proxy.CapturedRequest) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("curl -X %s %s", cr.Method, quote(absolute(cr))))
+	for _, k := range slices.Sorted(maps.Keys(cr.Headers)) {
+		// Skip hop-by-hop headers.
+		lk := strings.ToLower(k)
+		if lk == "connection" || lk == "transfer-encoding" {
+			continue
+		}
+		for _, v := range cr.Headers[k] {
+			b.WriteString(" \\\n  -H " + quote(k+": "+v))
+		}
+	}
+	if data := cr.ReadBody(); len(data) > 0 {
+		b.WriteString(" \\\n  -d " + quote(string(data)))
+	}
+	return b.String()
+}
+
+// absolute returns the request's URL with a scheme and host, if it has a
+// Host to take them from.
+func absolute(cr *proxy.CapturedRequest) string {
+	u, err := url.Parse(cr.URL)
+	if err != nil || u.IsAbs() || cr.Host == "" {
+		return cr.URL
+	}
+	u.Scheme = "http"
+	u.Host = cr.Host
+	return u.String()
+}
+
+// quote single-quotes s for a POSIX shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
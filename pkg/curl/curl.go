@@ -0,0 +1,292 @@
+// Package curl turns pasted curl command lines and raw HTTP request text into
+// captured requests that the engine can send. It is the inverse of the
+// "Copy as cURL" export.
+package curl
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// ParseRequest parses either a curl command line (starting with "curl") or
+// raw HTTP request text ("GET /path HTTP/1.1", headers, blank line, body).
+func ParseRequest(text string) (*proxy.CapturedRequest, error) {
+	text = strings.TrimSpace(text)
+	if text == "curl" || strings.HasPrefix(text, "curl ") || strings.HasPrefix(text, "curl\t") {
+		return Parse(text)
+	}
+	return ParseRaw(text)
+}
+
+// Parse parses a curl command line. Only options that affect the request
+// itself are supported; output and connection options are ignored, and
+// unknown options are an error rather than being silently dropped.
+func Parse(command string) (*proxy.CapturedRequest, error) {
+	args, err := split(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, fmt.Errorf("not a curl command")
+	}
+	args = args[1:]
+
+	var (
+		method   string
+		rawURL   string
+		headers  = make(http.Header)
+		data     []string
+		hasData  bool
+		getQuery bool
+		head     bool
+	)
+	next := func(i *int, name string) (string, error) {
+		*i++
+		if *i >= len(args) {
+			return "", fmt.Errorf("option %s requires a value", name)
+		}
+		return args[*i], nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		// Support --opt=value as well as --opt value.
+		name, inline, hasInline := a, "", false
+		if strings.HasPrefix(a, "--") {
+			name, inline, hasInline = strings.Cut(a, "=")
+		}
+		value := func() (string, error) {
+			if hasInline {
+				return inline, nil
+			}
+			return next(&i, name)
+		}
+
+		switch name {
+		case "-X", "--request":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			method = strings.ToUpper(v)
+		case "-H", "--header":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			k, hv, ok := strings.Cut(v, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid header %q", v)
+			}
+			headers.Add(strings.TrimSpace(k), strings.TrimSpace(hv))
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii", "--data-urlencode":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(v, "@") && name != "--data-raw" {
+				return nil, fmt.Errorf("%s %s: reading the body from a file is not supported", name, v)
+			}
+			if name == "--data-urlencode" {
+				v = urlencode(v)
+			}
+			data = append(data, v)
+			hasData = true
+		case "--json":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(v, "@") {
+				return nil, fmt.Errorf("--json %s: reading the body from a file is not supported", v)
+			}
+			data = append(data, v)
+			hasData = true
+			setDefault(headers, "Content-Type", "application/json")
+			setDefault(headers, "Accept", "application/json")
+		case "-u", "--user":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(v)))
+		case "-A", "--user-agent":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			headers.Set("User-Agent", v)
+		case "-e", "--referer":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			headers.Set("Referer", v)
+		case "-b", "--cookie":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(v, "=") {
+				return nil, fmt.Errorf("%s %s: reading cookies from a file is not supported", name, v)
+			}
+			headers.Add("Cookie", v)
+		case "--url":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			rawURL = v
+		case "-G", "--get":
+			getQuery = true
+		case "-I", "--head":
+			head = true
+		case "-s", "--silent", "-S", "--show-error", "-k", "--insecure", "-L", "--location",
+			"-v", "--verbose", "-i", "--include", "-f", "--fail", "--compressed",
+			"--http1.1", "--http2", "--http2-prior-knowledge", "-N", "--no-buffer":
+			// Client-side behaviour; irrelevant to the request sent.
+		case "-o", "--output", "-m", "--max-time", "--connect-timeout", "-w", "--write-out",
+			"--retry", "-x", "--proxy":
+			if _, err := value(); err != nil {
+				return nil, err
+			}
+		default:
+			if strings.HasPrefix(a, "-") && len(a) > 1 {
+				return nil, fmt.Errorf("unsupported curl option %s", a)
+			}
+			if rawURL != "" {
+				return nil, fmt.Errorf("more than one URL given (%q and %q)", rawURL, a)
+			}
+			rawURL = a
+		}
+	}
+
+	if rawURL == "" {
+		return nil, fmt.Errorf("no URL given")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL // curl's default scheme
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+
+	body := strings.Join(data, "&")
+	switch {
+	case method != "":
+	case head:
+		method = http.MethodHead
+	case hasData && !getQuery:
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+	if getQuery && hasData {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		body = ""
+	} else if hasData {
+		setDefault(headers, "Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return newRequest(method, u, headers, body), nil
+}
+
+// ParseRaw parses raw HTTP request text. Lines may end in \n or \r\n, and
+// everything after the first blank line is the body, verbatim.
+func ParseRaw(text string) (*proxy.CapturedRequest, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	headPart, body, _ := strings.Cut(text, "\n\n")
+	lines := strings.Split(headPart, "\n")
+
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("request line must be METHOD URL [PROTO], got %q", lines[0])
+	}
+	u, err := url.Parse(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", fields[1], err)
+	}
+
+	headers := make(http.Header)
+	for i, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("line %d: header must be Name: value", i+2)
+		}
+		headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	if u.Host == "" {
+		u.Host = headers.Get("Host")
+	}
+	return newRequest(strings.ToUpper(fields[0]), u, headers, body), nil
+}
+
+// Build assembles a request from its parts, as entered in the web UI's
+// compose form. rawURL may be absolute or just a path, which is then routed
+// like any other request; the method defaults to GET.
+func Build(method, rawURL string, headers http.Header, body string) (*proxy.CapturedRequest, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return nil, fmt.Errorf("URL is required")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	headers = headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if u.Host == "" {
+		u.Host = headers.Get("Host")
+	}
+	return newRequest(method, u, headers, body), nil
+}
+
+func newRequest(method string, u *url.URL, headers http.Header, body string) *proxy.CapturedRequest {
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	headers.Del("Host") // carried in Host
+	return &proxy.CapturedRequest{
+		Method:  method,
+		URL:     u.RequestURI(),
+		Path:    path,
+		Host:    u.Host,
+		Headers: headers,
+		Body:    []byte(body),
+		Proto:   "HTTP/1.1",
+	}
+}
+
+func setDefault(h http.Header, key, value string) {
+	if h.Get(key) == "" {
+		h.Set(key, value)
+	}
+}
+
+// urlencode implements --data-urlencode for the "content" and "name=content"
+// forms.
+func urlencode(v string) string {
+	if name, content, ok := strings.Cut(v, "="); ok {
+		return name + "=" + url.QueryEscape(content)
+	}
+	return url.QueryEscape(v)
+}
@@ -0,0 +1,156 @@
+package curl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// split tokenises a POSIX-shell-style command line: whitespace separates
+// words; single quotes, double quotes, $'...' (as emitted by browsers'
+// "Copy as cURL"), and backslash escapes are honoured; a backslash-newline
+// continues the line. Variable expansion and globbing are not performed.
+func split(s string) ([]string, error) {
+	var (
+		words []string
+		cur   strings.Builder
+		inW   bool // cur holds a word, possibly empty ("")
+	)
+	flush := func() {
+		if inW {
+			words = append(words, cur.String())
+			cur.Reset()
+			inW = false
+		}
+	}
+
+	r := []rune(s)
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(r) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			if r[i] == '\n' {
+				continue // line continuation
+			}
+			if r[i] == '\r' && i+1 < len(r) && r[i+1] == '\n' {
+				i++
+				continue
+			}
+			cur.WriteRune(r[i])
+			inW = true
+		case c == '\'':
+			end := indexRune(r, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(string(r[i+1 : end]))
+			inW = true
+			i = end
+		case c == '$' && i+1 < len(r) && r[i+1] == '\'':
+			n, err := ansiC(r, i+2, &cur)
+			if err != nil {
+				return nil, err
+			}
+			inW = true
+			i = n
+		case c == '"':
+			i++
+			for ; i < len(r) && r[i] != '"'; i++ {
+				if r[i] == '\\' && i+1 < len(r) && strings.ContainsRune("\"\\$`\n", r[i+1]) {
+					i++
+					if r[i] == '\n' {
+						continue
+					}
+				}
+				cur.WriteRune(r[i])
+			}
+			if i >= len(r) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inW = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			cur.WriteRune(c)
+			inW = true
+		}
+	}
+	flush()
+	return words, nil
+}
+
+func indexRune(r []rune, from int, c rune) int {
+	for i := from; i < len(r); i++ {
+		if r[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// ansiC decodes the body of a $'...' string starting at r[i], writing it to
+// b, and returns the index of the closing quote.
+func ansiC(r []rune, i int, b *strings.Builder) (int, error) {
+	for ; i < len(r); i++ {
+		c := r[i]
+		if c == '\'' {
+			return i, nil
+		}
+		if c != '\\' || i+1 >= len(r) {
+			b.WriteRune(c)
+			continue
+		}
+		i++
+		switch r[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case 'x', 'u':
+			width := 2
+			if r[i] == 'u' {
+				width = 4
+			}
+			j := i + 1
+			var v rune
+			for ; j < len(r) && j <= i+width; j++ {
+				d := hexVal(r[j])
+				if d < 0 {
+					break
+				}
+				v = v*16 + rune(d)
+			}
+			if j == i+1 {
+				return 0, fmt.Errorf(`invalid \%c escape`, r[i])
+			}
+			if r[i] == 'x' {
+				b.WriteByte(byte(v))
+			} else {
+				b.WriteRune(v)
+			}
+			i = j - 1
+		default: // \\ \' \" and anything else: the character itself
+			b.WriteRune(r[i])
+		}
+	}
+	return 0, fmt.Errorf("unterminated $' quote")
+}
+
+func hexVal(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
@@ -5,9 +5,17 @@
 //	~m METHOD   match HTTP method (substring)
 //	~s CODE     match response status code (prefix, e.g. "5" matches 5xx)
 //	~p PATH     match URL path (substring)
-//	~h KEY:VAL  match header key containing VAL (substring)
-//	~b TEXT     match request or response body (substring)
+//	~h KEY:VAL  match header or trailer key containing VAL (substring)
+//	~b TEXT     match request or response body (substring; protobuf bodies
+//	            also match their decoded form)
 //	~u NAME     match upstream name (substring)
+//	~t TAG      match a flow tag (exact, or "target" matches "target:...")
+//	~c ADDR     match client IP (exact, or CIDR like 10.0.0.0/8)
+//	~v PROTO    match request protocol (substring, e.g. "2" or "HTTP/1.1")
+//	~d URL      match upstream target URL (substring)
+//	~x PATH     match an XML element in the request or response body, by
+//	            local names ("Fault/faultcode", "*" for any, a leading "/"
+//	            from the root), optionally with text: PATH=TEXT (substring)
 //	!EXPR       negate
 //	A & B       AND
 //	A | B       OR
@@ -16,12 +24,36 @@ package filter
 
 import (
 	"fmt"
+	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 
+	"github.com/fidiego/http-proxy/pkg/format"
 	"github.com/fidiego/http-proxy/pkg/proxy"
 )
 
+// Primitive describes a filter primitive, for completion and help.
+type Primitive struct {
+	Token string // e.g. "~m"
+	Help  string
+}
+
+// Primitives lists every filter primitive, in the order of the package doc.
+var Primitives = []Primitive{
+	{"~m", "HTTP method"},
+	{"~s", "status code prefix"},
+	{"~p", "URL path"},
+	{"~h", "header or trailer KEY:VAL"},
+	{"~b", "request or response body"},
+	{"~u", "upstream name"},
+	{"~t", "flow tag"},
+	{"~c", "client IP or CIDR"},
+	{"~v", "request protocol"},
+	{"~d", "upstream target URL"},
+	{"~x", "XML element PATH[=TEXT]"},
+}
+
 // Filter is a compiled predicate over a Flow.
 type Filter func(flow *proxy.Flow) bool
 
@@ -179,6 +211,16 @@ func (p *parser) parsePrimitive() (Filter, error) {
 		return bodyFilter(arg), nil
 	case 'u':
 		return upstreamFilter(arg), nil
+	case 't':
+		return tagFilter(arg), nil
+	case 'c':
+		return clientFilter(arg)
+	case 'v':
+		return protoFilter(arg), nil
+	case 'd':
+		return targetFilter(arg), nil
+	case 'x':
+		return xmlFilter(arg)
 	default:
 		return nil, fmt.Errorf("unknown filter type %q", string(kind))
 	}
@@ -261,49 +303,52 @@ func headerFilter(arg string) Filter {
 	if len(parts) == 2 {
 		val = strings.ToLower(parts[1])
 	}
-	return func(f *proxy.Flow) bool {
-		if f.Request != nil {
-			for k, vv := range f.Request.Headers {
-				if strings.Contains(strings.ToLower(k), key) {
-					if val == "" {
-						return true
-					}
-					for _, v := range vv {
-						if strings.Contains(strings.ToLower(v), val) {
-							return true
-						}
-					}
+	match := func(h http.Header) bool {
+		for k, vv := range h {
+			if strings.Contains(strings.ToLower(k), key) {
+				if val == "" {
+					return true
 				}
-			}
-		}
-		if f.Response != nil {
-			for k, vv := range f.Response.Headers {
-				if strings.Contains(strings.ToLower(k), key) {
-					if val == "" {
+				for _, v := range vv {
+					if strings.Contains(strings.ToLower(v), val) {
 						return true
 					}
-					for _, v := range vv {
-						if strings.Contains(strings.ToLower(v), val) {
-							return true
-						}
-					}
 				}
 			}
 		}
 		return false
 	}
+	return func(f *proxy.Flow) bool {
+		if f.Request != nil && (match(f.Request.Headers) || match(f.Request.Trailers)) {
+			return true
+		}
+		return f.Response != nil && (match(f.Response.Headers) || match(f.Response.Trailers))
+	}
 }
 
 func bodyFilter(arg string) Filter {
 	lower := strings.ToLower(arg)
-	return func(f *proxy.Flow) bool {
-		if f.Request != nil && strings.Contains(strings.ToLower(string(f.Request.Body)), lower) {
+	match := func(b format.Body) bool {
+		if strings.Contains(strings.ToLower(string(b.Data)), lower) {
 			return true
 		}
-		if f.Response != nil && strings.Contains(strings.ToLower(string(f.Response.Body)), lower) {
-			return true
+		text, ok := format.DecodeProtobuf(b)
+		return ok && strings.Contains(strings.ToLower(text), lower)
+	}
+	return func(f *proxy.Flow) bool {
+		path := ""
+		if f.Request != nil {
+			path = f.Request.Path
+			if match(format.Body{ContentType: f.Request.Headers.Get("Content-Type"), Data: f.Request.ReadBody(), Path: path}) {
+				return true
+			}
 		}
-		return false
+		return f.Response != nil && match(format.Body{
+			ContentType: f.Response.Headers.Get("Content-Type"),
+			Data:        f.Response.ReadBody(),
+			Path:        path,
+			Response:    true,
+		})
 	}
 }
 
@@ -313,3 +358,101 @@ func upstreamFilter(arg string) Filter {
 		return strings.Contains(strings.ToLower(f.Upstream), lower)
 	}
 }
+
+func tagFilter(arg string) Filter {
+	return func(f *proxy.Flow) bool {
+		for _, tag := range f.Tags {
+			name, _, _ := strings.Cut(tag, ":")
+			if strings.EqualFold(tag, arg) || strings.EqualFold(name, arg) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func clientFilter(arg string) (Filter, error) {
+	var match func(netip.Addr) bool
+	if strings.Contains(arg, "/") {
+		prefix, err := netip.ParsePrefix(arg)
+		if err != nil {
+			return nil, fmt.Errorf("~c: invalid CIDR %q", arg)
+		}
+		match = prefix.Contains
+	} else {
+		want, err := netip.ParseAddr(arg)
+		if err != nil {
+			return nil, fmt.Errorf("~c: invalid IP address %q", arg)
+		}
+		want = want.Unmap()
+		match = func(a netip.Addr) bool { return a == want }
+	}
+	return func(f *proxy.Flow) bool {
+		if f.Request == nil {
+			return false
+		}
+		ap, err := netip.ParseAddrPort(f.Request.RemoteAddr)
+		if err != nil {
+			return false
+		}
+		return match(ap.Addr().Unmap())
+	}, nil
+}
+
+func protoFilter(arg string) Filter {
+	upper := strings.ToUpper(arg)
+	return func(f *proxy.Flow) bool {
+		return f.Request != nil && strings.Contains(strings.ToUpper(f.Request.Proto), upper)
+	}
+}
+
+func targetFilter(arg string) Filter {
+	lower := strings.ToLower(arg)
+	return func(f *proxy.Flow) bool {
+		return f.TargetURL != "" && strings.Contains(strings.ToLower(f.TargetURL), lower)
+	}
+}
+
+func xmlFilter(arg string) (Filter, error) {
+	expr, text, hasText := strings.Cut(arg, "=")
+	anchored := strings.HasPrefix(expr, "/")
+	expr = strings.Trim(expr, "/")
+	if expr == "" {
+		return nil, fmt.Errorf("~x: expected an element path, got %q", arg)
+	}
+	steps := strings.Split(expr, "/")
+	text = strings.ToLower(text)
+	match := func(contentType string, body []byte) bool {
+		if len(body) == 0 || !format.IsXML(contentType, body) {
+			return false
+		}
+		found := false
+		format.WalkXML(body, func(path []string, elemText string) bool {
+			found = xmlPathMatch(path, steps, anchored) &&
+				(!hasText || strings.Contains(strings.ToLower(elemText), text))
+			return !found
+		})
+		return found
+	}
+	return func(f *proxy.Flow) bool {
+		if f.Request != nil && match(f.Request.Headers.Get("Content-Type"), f.Request.ReadBody()) {
+			return true
+		}
+		return f.Response != nil && match(f.Response.Headers.Get("Content-Type"), f.Response.ReadBody())
+	}, nil
+}
+
+// xmlPathMatch reports whether an element's path ends with steps, or is
+// steps when anchored.
+func xmlPathMatch(path, steps []string, anchored bool) bool {
+	if len(path) < len(steps) || anchored && len(path) != len(steps) {
+		return false
+	}
+	tail := path[len(path)-len(steps):]
+	for i, step := range steps {
+		if step != "*" && !strings.EqualFold(tail[i], step) {
+			return false
+		}
+	}
+	return true
+}
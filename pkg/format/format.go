@@ -0,0 +1,294 @@
+// Package format pretty-prints captured bodies by content type. The TUI and
+// the web UI both render bodies through it, so a formatter registered here
+// shows up in each.
+//
+// Built in: JSON, XML, URL-encoded forms, CSV (as a table preview),
+// MessagePack, and protobuf (decoded against descriptor sets loaded with
+// LoadProtoDescriptors, or raw field numbers without them).
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Body is a captured body and what is known about where it came from.
+type Body struct {
+	ContentType string
+	Data        []byte
+
+	// Path is the request path. It picks the message types of gRPC bodies
+	// (/package.Service/Method).
+	Path string
+
+	// Response is set for response bodies.
+	Response bool
+}
+
+// Formatter renders the bodies of the content types it matches as text.
+type Formatter struct {
+	// Name identifies the formatter in the UIs, e.g. "xml".
+	Name string
+
+	// Match reports whether the formatter handles a media type, given in
+	// lower case without parameters (e.g. "application/xml").
+	Match func(mediaType string) bool
+
+	// Format renders b. params holds the Content-Type parameters, with
+	// lower-case names. An error means b isn't valid for this formatter;
+	// the next matching one is tried.
+	Format func(b Body, params map[string]string) (string, error)
+}
+
+var (
+	mu         sync.RWMutex
+	formatters = []Formatter{
+		{"json", isJSON, formatJSON},
+		{"xml", isXML, formatXML},
+		{"form", is("application/x-www-form-urlencoded"), formatForm},
+		{"csv", is("text/csv", "application/csv"), formatCSV},
+		{"msgpack", isMsgpack, formatMsgpack},
+		{"protobuf", isProtobuf, formatProtobuf},
+	}
+)
+
+// Register adds f ahead of the formatters already registered, so it can take
+// over a content type from a built-in one.
+func Register(f Formatter) {
+	mu.Lock()
+	defer mu.Unlock()
+	formatters = append([]Formatter{f}, formatters...)
+}
+
+// Names lists the registered formatters in the order they are tried.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, len(formatters))
+	for i, f := range formatters {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Format renders b with the first formatter that matches its content type
+// and accepts it, returning the text and the formatter's name. ok is false
+// when none does, and the caller shows the body as it is.
+func Format(b Body) (text, name string, ok bool) {
+	if len(b.Data) == 0 {
+		return "", "", false
+	}
+	mediaType, params, err := mime.ParseMediaType(b.ContentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(strings.ToLower(b.ContentType), ";")
+		mediaType = strings.TrimSpace(mediaType)
+	}
+	mu.RLock()
+	fs := formatters
+	mu.RUnlock()
+	for _, f := range fs {
+		if !f.Match(mediaType) {
+			continue
+		}
+		if text, err := f.Format(b, params); err == nil {
+			return text, f.Name, true
+		}
+	}
+	// Legacy services often send XML as text/plain or without a type.
+	if looksLikeXML(b.Data) {
+		if text, err := formatXML(b, params); err == nil {
+			return text, "xml", true
+		}
+	}
+	return "", "", false
+}
+
+// is matches any of the given media types.
+func is(types ...string) func(string) bool {
+	return func(mt string) bool {
+		for _, t := range types {
+			if mt == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isJSON matches application/json and its relatives (application/problem+json,
+// application/x-ndjson, ...).
+func isJSON(mt string) bool {
+	return strings.Contains(mt, "json")
+}
+
+func formatJSON(b Body, _ map[string]string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(b.Data), "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func isXML(mt string) bool {
+	return mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml")
+}
+
+// formatXML re-indents an XML document, such as a SOAP envelope. Namespace
+// prefixes are kept as written.
+func formatXML(b Body, _ map[string]string) (string, error) {
+	dec := newXMLDecoder(b.Data)
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue // the encoder indents
+			}
+		case xml.StartElement:
+			t.Name = rawName(t.Name)
+			for i, a := range t.Attr {
+				t.Attr[i].Name = rawName(a.Name)
+			}
+			tok = t
+		case xml.EndElement:
+			t.Name = rawName(t.Name)
+			tok = t
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				buf.WriteString("<?xml " + string(t.Inst) + "?>")
+				continue // the encoder only allows it first, and writes no newline
+			}
+		}
+		if err := enc.EncodeToken(tok); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.Replace(buf.String(), "?>", "?>\n", 1), "\n"), nil
+}
+
+// rawName folds a prefix into the local name, so the encoder writes it as is
+// instead of declaring it as a namespace.
+func rawName(n xml.Name) xml.Name {
+	if n.Space == "" {
+		return n
+	}
+	return xml.Name{Local: n.Space + ":" + n.Local}
+}
+
+// formatForm lists URL-encoded fields one per line, in order, decoded.
+func formatForm(b Body, _ map[string]string) (string, error) {
+	var lines []string
+	for _, pair := range strings.Split(strings.TrimSpace(string(b.Data)), "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			return "", err
+		}
+		val, err := url.QueryUnescape(v)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, key+" = "+val)
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no fields")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// CSV previews are cut to this many rows, and cells to this many runes.
+const (
+	csvMaxRows  = 100
+	csvMaxWidth = 40
+)
+
+// formatCSV previews a CSV body as an aligned table, header first.
+func formatCSV(b Body, _ map[string]string) (string, error) {
+	r := csv.NewReader(bytes.NewReader(b.Data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var rows [][]string
+	more := 0
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(rows) == csvMaxRows {
+			more++
+			continue
+		}
+		for i, cell := range rec {
+			if utf8.RuneCountInString(cell) > csvMaxWidth {
+				rec[i] = string([]rune(cell)[:csvMaxWidth-1]) + "…"
+			}
+		}
+		rows = append(rows, rec)
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no rows")
+	}
+	var widths []int
+	for _, rec := range rows {
+		for i, cell := range rec {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	var out strings.Builder
+	for n, rec := range rows {
+		for i, cell := range rec {
+			if i > 0 {
+				out.WriteString(" │ ")
+			}
+			out.WriteString(cell)
+			if i < len(rec)-1 {
+				out.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			}
+		}
+		out.WriteString("\n")
+		if n == 0 && len(rows) > 1 {
+			for i, w := range widths {
+				if i > 0 {
+					out.WriteString("─┼─")
+				}
+				out.WriteString(strings.Repeat("─", w))
+			}
+			out.WriteString("\n")
+		}
+	}
+	if more > 0 {
+		fmt.Fprintf(&out, "… %d more rows\n", more)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
@@ -0,0 +1,227 @@
+package format
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+func isMsgpack(mt string) bool {
+	return strings.Contains(mt, "msgpack") || strings.Contains(mt, "messagepack")
+}
+
+// formatMsgpack decodes MessagePack into indented JSON. Binary values
+// become base64 strings, extension values {"ext": type, "data": base64},
+// and a body holding several values shows each in turn.
+func formatMsgpack(b Body, _ map[string]string) (string, error) {
+	d := &msgpackDecoder{data: b.Data}
+	var out []string
+	for d.pos < len(d.data) {
+		v, err := d.value(0)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return "", err
+		}
+		out = append(out, strings.TrimSuffix(buf.String(), "\n"))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// msgpackMaxDepth bounds nesting, so a malicious body can't exhaust the stack.
+const msgpackMaxDepth = 100
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, fmt.Errorf("msgpack: unexpected end of data at byte %d", d.pos)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads an n-byte big-endian unsigned integer.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > msgpackMaxDepth {
+		return nil, fmt.Errorf("msgpack: nested too deeply")
+	}
+	tb, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	t := tb[0]
+	switch {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xf0 == 0x80:
+		return d.mapOf(int(t&0x0f), depth)
+	case t&0xf0 == 0x90:
+		return d.arrayOf(int(t&0x0f), depth)
+	case t&0xe0 == 0xa0:
+		return d.str(int(t & 0x1f))
+	}
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := d.uint(1 << (t - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := d.uint(1 << (t - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		return d.uint(1 << (t - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		n := 1 << (t - 0xd0)
+		v, err := d.uint(n)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*n
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return d.ext(1 << (t - 0xd4))
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := d.uint(1 << (t - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd: // array 16/32
+		n, err := d.uint(2 << (t - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n), depth)
+	case 0xde, 0xdf: // map 16/32
+		n, err := d.uint(2 << (t - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n), depth)
+	}
+	return nil, fmt.Errorf("msgpack: invalid type byte 0x%02x at byte %d", t, d.pos-1)
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// ext decodes an extension value with n data bytes. Timestamps (type -1)
+// are shown as seconds and nanoseconds.
+func (d *msgpackDecoder) ext(n int) (any, error) {
+	tb, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	typ := int8(tb[0])
+	if typ == -1 {
+		switch n {
+		case 4:
+			return map[string]any{"timestamp": binary.BigEndian.Uint32(data)}, nil
+		case 8:
+			v := binary.BigEndian.Uint64(data)
+			return map[string]any{"timestamp": v & (1<<34 - 1), "nanos": v >> 34}, nil
+		case 12:
+			return map[string]any{"timestamp": int64(binary.BigEndian.Uint64(data[4:])), "nanos": binary.BigEndian.Uint32(data)}, nil
+		}
+	}
+	return map[string]any{"ext": typ, "data": base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+func (d *msgpackDecoder) arrayOf(n int, depth int) (any, error) {
+	if n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("msgpack: array of %d values in %d bytes", n, len(d.data)-d.pos)
+	}
+	arr := make([]any, n)
+	for i := range arr {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+// mapOf decodes a map of n pairs. JSON keys are strings, so other keys are
+// written in their JSON form.
+func (d *msgpackDecoder) mapOf(n int, depth int) (any, error) {
+	if n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("msgpack: map of %d pairs in %d bytes", n, len(d.data)-d.pos)
+	}
+	m := make(map[string]any, n)
+	for range n {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			kb, _ := json.Marshal(k)
+			key = string(kb)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,590 @@
+package format
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Protobuf bodies are decoded into JSON when their message type's descriptor
+// is loaded, and printed in text format with fields shown by number
+// otherwise, like protoc --decode_raw. The type comes from the messageType
+// (or proto) Content-Type parameter, or from the method in the request path
+// (gRPC's /package.Service/Method, Twirp's /twirp/package.Service/Method).
+
+var isProtobuf = is(
+	"application/protobuf",
+	"application/x-protobuf",
+	"application/vnd.google.protobuf",
+	"application/grpc",
+	"application/grpc+proto",
+)
+
+// protoMaxDepth bounds message nesting.
+const protoMaxDepth = 64
+
+// Field types from google/protobuf/descriptor.proto.
+const (
+	protoDouble   = 1
+	protoFloat    = 2
+	protoInt64    = 3
+	protoUint64   = 4
+	protoInt32    = 5
+	protoFixed64  = 6
+	protoFixed32  = 7
+	protoBool     = 8
+	protoString   = 9
+	protoGroup    = 10
+	protoMessage  = 11
+	protoBytes    = 12
+	protoUint32   = 13
+	protoEnum     = 14
+	protoSfixed32 = 15
+	protoSfixed64 = 16
+	protoSint32   = 17
+	protoSint64   = 18
+)
+
+type protoMessageType struct {
+	fields   map[int]*protoField
+	mapEntry bool // the synthetic entry type of a map field
+}
+
+type protoField struct {
+	name     string
+	jsonName string
+	typ      int
+	typeName string // message and enum fields, fully qualified
+	repeated bool
+}
+
+// protoLabelRepeated is FieldDescriptorProto.Label's LABEL_REPEATED.
+const protoLabelRepeated = 3
+
+// protoRegistry holds the types from the loaded descriptor sets, by fully
+// qualified name without the leading dot.
+type protoRegistry struct {
+	messages map[string]*protoMessageType
+	enums    map[string]map[int32]string
+	methods  map[string][2]string // "pkg.Service/Method" -> input, output type
+}
+
+func newProtoRegistry() *protoRegistry {
+	return &protoRegistry{
+		messages: make(map[string]*protoMessageType),
+		enums:    make(map[string]map[int32]string),
+		methods:  make(map[string][2]string),
+	}
+}
+
+var (
+	protoMu sync.RWMutex
+	protos  = newProtoRegistry()
+)
+
+// LoadProtoDescriptors loads the message types in FileDescriptorSet files,
+// as written by protoc --descriptor_set_out (with --include_imports so
+// imported types resolve).
+func LoadProtoDescriptors(paths ...string) error {
+	reg := newProtoRegistry()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := reg.loadSet(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	protoMu.Lock()
+	defer protoMu.Unlock()
+	for k, v := range reg.messages {
+		protos.messages[k] = v
+	}
+	for k, v := range reg.enums {
+		protos.enums[k] = v
+	}
+	for k, v := range reg.methods {
+		protos.methods[k] = v
+	}
+	return nil
+}
+
+func (r *protoRegistry) loadSet(data []byte) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return fmt.Errorf("not a descriptor set: %w", err)
+	}
+	files := 0
+	for _, f := range fields {
+		if f.num == 1 && f.typ == 2 {
+			if err := r.loadFile(f.data); err != nil {
+				return err
+			}
+			files++
+		}
+	}
+	if files == 0 {
+		return errors.New("not a descriptor set: no files in it")
+	}
+	return nil
+}
+
+func (r *protoRegistry) loadFile(data []byte) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+	pkg := ""
+	for _, f := range fields {
+		if f.num == 2 && f.typ == 2 {
+			pkg = string(f.data)
+		}
+	}
+	for _, f := range fields {
+		if f.typ != 2 {
+			continue
+		}
+		switch f.num {
+		case 4:
+			err = r.loadMessage(f.data, pkg)
+		case 5:
+			err = r.loadEnum(f.data, pkg)
+		case 6:
+			err = r.loadService(f.data, pkg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *protoRegistry) loadMessage(data []byte, scope string) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+	name := qualify(scope, wireString(fields, 1))
+	msg := &protoMessageType{fields: make(map[int]*protoField)}
+	r.messages[name] = msg
+	for _, f := range fields {
+		if f.typ != 2 {
+			continue
+		}
+		switch f.num {
+		case 2:
+			ff, err := parseWire(f.data)
+			if err != nil {
+				return err
+			}
+			fd := &protoField{
+				name:     wireString(ff, 1),
+				jsonName: wireString(ff, 10),
+				typ:      int(wireVarint(ff, 5)),
+				typeName: strings.TrimPrefix(wireString(ff, 6), "."),
+				repeated: wireVarint(ff, 4) == protoLabelRepeated,
+			}
+			if fd.jsonName == "" {
+				fd.jsonName = fd.name
+			}
+			msg.fields[int(wireVarint(ff, 3))] = fd
+		case 7:
+			opts, err := parseWire(f.data)
+			if err != nil {
+				return err
+			}
+			msg.mapEntry = wireVarint(opts, 7) != 0
+		case 3:
+			err = r.loadMessage(f.data, name)
+		case 4:
+			err = r.loadEnum(f.data, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *protoRegistry) loadEnum(data []byte, scope string) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+	values := make(map[int32]string)
+	for _, f := range fields {
+		if f.num != 2 || f.typ != 2 {
+			continue
+		}
+		vf, err := parseWire(f.data)
+		if err != nil {
+			return err
+		}
+		values[int32(wireVarint(vf, 2))] = wireString(vf, 1)
+	}
+	r.enums[qualify(scope, wireString(fields, 1))] = values
+	return nil
+}
+
+func (r *protoRegistry) loadService(data []byte, pkg string) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+	service := qualify(pkg, wireString(fields, 1))
+	for _, f := range fields {
+		if f.num != 2 || f.typ != 2 {
+			continue
+		}
+		mf, err := parseWire(f.data)
+		if err != nil {
+			return err
+		}
+		r.methods[service+"/"+wireString(mf, 1)] = [2]string{
+			strings.TrimPrefix(wireString(mf, 2), "."),
+			strings.TrimPrefix(wireString(mf, 3), "."),
+		}
+	}
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func lookupMessage(name string) *protoMessageType {
+	protoMu.RLock()
+	defer protoMu.RUnlock()
+	return protos.messages[name]
+}
+
+func lookupEnum(name string, v int32) (string, bool) {
+	protoMu.RLock()
+	defer protoMu.RUnlock()
+	s, ok := protos.enums[name][v]
+	return s, ok
+}
+
+// methodMessageType is the input or output type of the method a request
+// path calls, named by its last two segments: /package.Service/Method for
+// gRPC, behind a prefix such as /twirp for Twirp.
+func methodMessageType(path string, response bool) string {
+	path, _, _ = strings.Cut(path, "?")
+	path = strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return ""
+	}
+	method := path[i+1:]
+	service := path[strings.LastIndex(path[:i], "/")+1 : i]
+	protoMu.RLock()
+	defer protoMu.RUnlock()
+	types, ok := protos.methods[service+"/"+method]
+	if !ok {
+		return ""
+	}
+	if response {
+		return types[1]
+	}
+	return types[0]
+}
+
+// protoTypeName is the message type of a protobuf body, from its
+// Content-Type parameters or else its request path; "" if unknown.
+func protoTypeName(b Body, params map[string]string) string {
+	if name := strings.TrimPrefix(cmp.Or(params["messagetype"], params["proto"]), "."); name != "" {
+		return name
+	}
+	return methodMessageType(b.Path, b.Response)
+}
+
+// isGRPC reports whether a Content-Type is gRPC's, whose bodies frame
+// their messages.
+func isGRPC(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	return strings.HasPrefix(strings.TrimSpace(mediaType), "application/grpc")
+}
+
+// formatProtobuf prints a protobuf message, or each message of a gRPC body.
+func formatProtobuf(b Body, params map[string]string) (string, error) {
+	typeName := protoTypeName(b, params)
+	msg := lookupMessage(typeName)
+	var out strings.Builder
+	if !isGRPC(b.ContentType) {
+		if err := writeProtoMessage(&out, b.Data, msg); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(out.String(), "\n"), nil
+	}
+
+	// gRPC bodies are a series of length-prefixed messages.
+	data := b.Data
+	for i := 1; len(data) > 0; i++ {
+		if len(data) < 5 {
+			return "", errors.New("grpc: truncated message header")
+		}
+		compressed := data[0]&1 == 1
+		n := binary.BigEndian.Uint32(data[1:5])
+		if uint64(n) > uint64(len(data)-5) {
+			return "", errors.New("grpc: truncated message")
+		}
+		payload := data[5 : 5+n]
+		data = data[5+n:]
+		if compressed {
+			fmt.Fprintf(&out, "# message %d: compressed, %d bytes\n", i, n)
+			continue
+		}
+		fmt.Fprintf(&out, "# message %d", i)
+		if typeName != "" {
+			out.WriteString(": " + typeName)
+		}
+		out.WriteString("\n")
+		if err := writeProtoMessage(&out, payload, msg); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// writeProtoMessage prints data as JSON if its type msg is known, and in
+// text format otherwise.
+func writeProtoMessage(out *strings.Builder, data []byte, msg *protoMessageType) error {
+	if msg == nil {
+		return writeProto(out, data, nil, 0)
+	}
+	text, err := protoJSON(data, msg)
+	if err != nil {
+		return err
+	}
+	out.WriteString(text + "\n")
+	return nil
+}
+
+// writeProto prints the fields of data, which is a message of type msg, or of
+// an unknown type when msg is nil.
+func writeProto(out *strings.Builder, data []byte, msg *protoMessageType, depth int) error {
+	fields, err := parseWire(data)
+	if err != nil {
+		return err
+	}
+	writeFields(out, fields, msg, depth)
+	return nil
+}
+
+func writeFields(out *strings.Builder, fields []wireField, msg *protoMessageType, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, wf := range fields {
+		var fd *protoField
+		if msg != nil {
+			fd = msg.fields[wf.num]
+		}
+		switch {
+		case fd == nil:
+			writeRawField(out, wf, depth)
+		case wf.typ == 2 && (fd.typ == protoMessage || fd.typ == protoGroup):
+			sub, err := parseWire(wf.data)
+			if err != nil || depth >= protoMaxDepth {
+				fmt.Fprintf(out, "%s%s: %q\n", indent, fd.name, wf.data)
+				continue
+			}
+			fmt.Fprintf(out, "%s%s {\n", indent, fd.name)
+			writeFields(out, sub, lookupMessage(fd.typeName), depth+1)
+			fmt.Fprintf(out, "%s}\n", indent)
+		case wf.typ == 2 && (fd.typ == protoString || fd.typ == protoBytes):
+			fmt.Fprintf(out, "%s%s: %q\n", indent, fd.name, wf.data)
+		case wf.typ == 2: // packed repeated scalars
+			vals, err := unpack(wf.data, fd.typ)
+			if err != nil {
+				writeRawField(out, wf, depth)
+				continue
+			}
+			for _, v := range vals {
+				fmt.Fprintf(out, "%s%s: %s\n", indent, fd.name, protoScalar(fd, v))
+			}
+		default:
+			fmt.Fprintf(out, "%s%s: %s\n", indent, fd.name, protoScalar(fd, wf.val))
+		}
+	}
+}
+
+// writeRawField prints a field of unknown type by number. A length-delimited
+// value is shown as a string when it is printable text, as a message when it
+// parses as one, and as escaped bytes otherwise.
+func writeRawField(out *strings.Builder, wf wireField, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch wf.typ {
+	case 0:
+		fmt.Fprintf(out, "%s%d: %d\n", indent, wf.num, wf.val)
+	case 1:
+		fmt.Fprintf(out, "%s%d: 0x%016x\n", indent, wf.num, wf.val)
+	case 5:
+		fmt.Fprintf(out, "%s%d: 0x%08x\n", indent, wf.num, wf.val)
+	case 2:
+		if !isText(wf.data) && depth < protoMaxDepth {
+			if sub, err := parseWire(wf.data); err == nil {
+				fmt.Fprintf(out, "%s%d {\n", indent, wf.num)
+				writeFields(out, sub, nil, depth+1)
+				fmt.Fprintf(out, "%s}\n", indent)
+				return
+			}
+		}
+		fmt.Fprintf(out, "%s%d: %q\n", indent, wf.num, wf.data)
+	}
+}
+
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// unpack splits a packed repeated field into its values.
+func unpack(data []byte, typ int) ([]uint64, error) {
+	var vals []uint64
+	for len(data) > 0 {
+		switch typ {
+		case protoDouble, protoFixed64, protoSfixed64:
+			if len(data) < 8 {
+				return nil, errors.New("truncated packed field")
+			}
+			vals = append(vals, binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		case protoFloat, protoFixed32, protoSfixed32:
+			if len(data) < 4 {
+				return nil, errors.New("truncated packed field")
+			}
+			vals = append(vals, uint64(binary.LittleEndian.Uint32(data)))
+			data = data[4:]
+		default:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errors.New("bad varint in packed field")
+			}
+			vals = append(vals, v)
+			data = data[n:]
+		}
+	}
+	return vals, nil
+}
+
+// protoScalar formats a varint or fixed-width value as the field's type.
+func protoScalar(fd *protoField, v uint64) string {
+	switch fd.typ {
+	case protoDouble:
+		return strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64)
+	case protoFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32)
+	case protoInt64, protoSfixed64:
+		return strconv.FormatInt(int64(v), 10)
+	case protoInt32, protoSfixed32:
+		return strconv.FormatInt(int64(int32(v)), 10)
+	case protoUint32, protoFixed32:
+		return strconv.FormatUint(uint64(uint32(v)), 10)
+	case protoBool:
+		return strconv.FormatBool(v != 0)
+	case protoEnum:
+		if name, ok := lookupEnum(fd.typeName, int32(v)); ok {
+			return name
+		}
+		return strconv.FormatInt(int64(int32(v)), 10)
+	case protoSint32:
+		return strconv.FormatInt(int64(int32(uint32(v)>>1)^-int32(v&1)), 10)
+	case protoSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10)
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// wireField is one field of an encoded message.
+type wireField struct {
+	num  int
+	typ  int    // wire type
+	val  uint64 // varint and fixed-width values
+	data []byte // length-delimited values
+}
+
+var errBadWire = errors.New("invalid protobuf encoding")
+
+// parseWire splits an encoded message into its fields. Groups, which are
+// deprecated, aren't supported.
+func parseWire(data []byte) ([]wireField, error) {
+	var fields []wireField
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 || tag>>3 == 0 || tag>>3 > math.MaxInt32 {
+			return nil, errBadWire
+		}
+		data = data[n:]
+		f := wireField{num: int(tag >> 3), typ: int(tag & 7)}
+		switch f.typ {
+		case 0:
+			f.val, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errBadWire
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return nil, errBadWire
+			}
+			f.val = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return nil, errBadWire
+			}
+			f.data = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case 5:
+			if len(data) < 4 {
+				return nil, errBadWire
+			}
+			f.val = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return nil, errBadWire
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// wireString is the last value of a string field, as protobuf merges them.
+func wireString(fields []wireField, num int) string {
+	s := ""
+	for _, f := range fields {
+		if f.num == num && f.typ == 2 {
+			s = string(f.data)
+		}
+	}
+	return s
+}
+
+func wireVarint(fields []wireField, num int) uint64 {
+	var v uint64
+	for _, f := range fields {
+		if f.num == num && f.typ == 0 {
+			v = f.val
+		}
+	}
+	return v
+}
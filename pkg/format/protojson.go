@@ -0,0 +1,257 @@
+package format
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Typed protobuf messages are decoded into JSON after protobuf's JSON
+// mapping: fields under their JSON names in wire order, repeated fields as
+// arrays, maps as objects, 64-bit integers and bytes (base64) as strings,
+// and enums by name. Fields missing from the descriptor are keyed by number.
+
+// ProtoMessageType returns the message type of a protobuf, Twirp, or gRPC
+// body, if its descriptor is loaded, or "".
+func ProtoMessageType(b Body) string {
+	mediaType, params, err := mime.ParseMediaType(b.ContentType)
+	if err != nil || !isProtobuf(mediaType) {
+		return ""
+	}
+	name := protoTypeName(b, params)
+	if lookupMessage(name) == nil {
+		return ""
+	}
+	return name
+}
+
+// DecodeProtobuf renders a protobuf body as Format does, so its field
+// values can be searched. ok is false if b isn't a protobuf body or doesn't
+// decode.
+func DecodeProtobuf(b Body) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(b.ContentType)
+	if err != nil || !isProtobuf(mediaType) || len(b.Data) == 0 {
+		return "", false
+	}
+	text, err := formatProtobuf(b, params)
+	return text, err == nil
+}
+
+// protoJSON decodes data, a message of type msg, into indented JSON.
+func protoJSON(data []byte, msg *protoMessageType) (string, error) {
+	obj, err := protoObject(data, msg, 0)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(obj); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// jsonObject is a JSON object that keeps its keys in insertion order.
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]any)}
+}
+
+func (o *jsonObject) set(key string, v any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+// add appends v to the array at key.
+func (o *jsonObject) add(key string, v any) {
+	arr, _ := o.values[key].([]any)
+	o.set(key, append(arr, v))
+}
+
+// merge sets key to v, or to an array of its values once it has several.
+func (o *jsonObject) merge(key string, v any) {
+	old, ok := o.values[key]
+	if !ok {
+		o.set(key, v)
+		return
+	}
+	arr, isArr := old.([]any)
+	if !isArr {
+		arr = []any{old}
+	}
+	o.set(key, append(arr, v))
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(k); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := enc.Encode(o.values[k]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// protoObject decodes data, a message of type msg, into an object.
+func protoObject(data []byte, msg *protoMessageType, depth int) (*jsonObject, error) {
+	if depth >= protoMaxDepth {
+		return nil, errors.New("protobuf: message nested too deeply")
+	}
+	fields, err := parseWire(data)
+	if err != nil {
+		return nil, err
+	}
+	obj := newJSONObject()
+	for _, wf := range fields {
+		fd := msg.fields[wf.num]
+		if fd == nil {
+			obj.merge(strconv.Itoa(wf.num), rawProtoValue(wf))
+			continue
+		}
+		switch {
+		case wf.typ == 2 && (fd.typ == protoMessage || fd.typ == protoGroup):
+			sub := lookupMessage(fd.typeName)
+			if sub == nil {
+				sub = &protoMessageType{}
+			}
+			v, err := protoObject(wf.data, sub, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if sub.mapEntry {
+				m, _ := obj.values[fd.jsonName].(*jsonObject)
+				if m == nil {
+					m = newJSONObject()
+					obj.set(fd.jsonName, m)
+				}
+				m.set(mapKey(v.values[keyName(sub, 1)]), v.values[keyName(sub, 2)])
+				continue
+			}
+			setProtoField(obj, fd, v)
+		case wf.typ == 2 && fd.typ == protoString:
+			setProtoField(obj, fd, string(wf.data))
+		case wf.typ == 2 && fd.typ == protoBytes:
+			setProtoField(obj, fd, base64.StdEncoding.EncodeToString(wf.data))
+		case wf.typ == 2: // packed repeated scalars
+			vals, err := unpack(wf.data, fd.typ)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range vals {
+				setProtoField(obj, fd, protoJSONScalar(fd, v))
+			}
+		default:
+			setProtoField(obj, fd, protoJSONScalar(fd, wf.val))
+		}
+	}
+	return obj, nil
+}
+
+// setProtoField sets a field's value, appending it if the field is
+// repeated. A repeated singular field keeps its last value, as protobuf
+// merges them.
+func setProtoField(obj *jsonObject, fd *protoField, v any) {
+	if fd.repeated {
+		obj.add(fd.jsonName, v)
+	} else {
+		obj.set(fd.jsonName, v)
+	}
+}
+
+// keyName is the JSON name of a map entry's key (1) or value (2) field.
+func keyName(entry *protoMessageType, num int) string {
+	if fd := entry.fields[num]; fd != nil {
+		return fd.jsonName
+	}
+	return strconv.Itoa(num)
+}
+
+// mapKey renders a map entry's key as an object key.
+func mapKey(v any) string {
+	switch k := v.(type) {
+	case string:
+		return k
+	case nil:
+		return ""
+	default:
+		raw, _ := json.Marshal(k)
+		return string(raw)
+	}
+}
+
+// protoJSONScalar converts a varint or fixed-width value to the field's
+// JSON form.
+func protoJSONScalar(fd *protoField, v uint64) any {
+	switch fd.typ {
+	case protoDouble:
+		return jsonFloat(math.Float64frombits(v), 64)
+	case protoFloat:
+		return jsonFloat(float64(math.Float32frombits(uint32(v))), 32)
+	case protoInt64, protoSfixed64, protoSint64, protoUint64, protoFixed64:
+		return protoScalar(fd, v) // quoted, as JSON numbers lose precision
+	case protoBool:
+		return v != 0
+	case protoEnum:
+		if name, ok := lookupEnum(fd.typeName, int32(v)); ok {
+			return name
+		}
+		return json.Number(strconv.FormatInt(int64(int32(v)), 10))
+	}
+	return json.Number(protoScalar(fd, v))
+}
+
+// jsonFloat is f as a JSON number, or a string for values JSON lacks.
+func jsonFloat(f float64, bits int) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+// rawProtoValue converts a field missing from the descriptor: varints as
+// numbers, fixed-width values as their bits, and length-delimited values as
+// text when printable and base64 otherwise.
+func rawProtoValue(wf wireField) any {
+	switch wf.typ {
+	case 2:
+		if isText(wf.data) {
+			return string(wf.data)
+		}
+		return base64.StdEncoding.EncodeToString(wf.data)
+	case 1:
+		return fmt.Sprintf("0x%016x", wf.val)
+	case 5:
+		return fmt.Sprintf("0x%08x", wf.val)
+	}
+	return json.Number(strconv.FormatUint(wf.val, 10))
+}
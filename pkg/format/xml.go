@@ -0,0 +1,193 @@
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// Namespaces of the SOAP 1.1 and 1.2 envelopes.
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// newXMLDecoder reads data, decoding the Latin-1 and ASCII encodings legacy
+// services declare as well as UTF-8.
+func newXMLDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = xmlCharsetReader
+	return dec
+}
+
+func xmlCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, len(data))
+		for _, c := range data {
+			out = utf8.AppendRune(out, rune(c))
+		}
+		return bytes.NewReader(out), nil
+	}
+	return nil, fmt.Errorf("unsupported XML encoding %q", charset)
+}
+
+// IsXML reports whether a body is XML: by its Content-Type, or, for bodies
+// sent as text/plain or octet-stream, by an XML declaration or SOAP
+// envelope at its start.
+func IsXML(contentType string, data []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && isXML(mediaType) {
+		return true
+	}
+	return looksLikeXML(data)
+}
+
+// looksLikeXML reports whether data starts with an XML declaration or a
+// SOAP envelope, so it can be formatted whatever its content type. HTML
+// never does.
+func looksLikeXML(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n\ufeff")
+	if bytes.HasPrefix(data, []byte("<?xml")) {
+		return true
+	}
+	if len(data) == 0 || data[0] != '<' {
+		return false
+	}
+	root, _, _ := bytes.Cut(data[1:min(len(data), 256)], []byte(">"))
+	name, _, _ := bytes.Cut(root, []byte(" "))
+	_, local, _ := bytes.Cut(name, []byte(":"))
+	if local == nil {
+		local = name
+	}
+	return string(local) == "Envelope"
+}
+
+// WalkXML calls fn for each element of an XML document as it ends, with
+// the local names (namespace prefixes dropped) from the root down to the
+// element, and the element's own text, trimmed. It stops early when fn
+// returns false.
+func WalkXML(data []byte, fn func(path []string, text string) bool) error {
+	dec := newXMLDecoder(data)
+	var path []string
+	var texts []string
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			if len(path) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			texts = append(texts, "")
+		case xml.CharData:
+			if len(texts) > 0 {
+				texts[len(texts)-1] += string(t)
+			}
+		case xml.EndElement:
+			if !fn(path, strings.TrimSpace(texts[len(texts)-1])) {
+				return nil
+			}
+			path = path[:len(path)-1]
+			texts = texts[:len(texts)-1]
+		}
+	}
+}
+
+// SOAPEnvelope summarises a SOAP message.
+type SOAPEnvelope struct {
+	Version string // "1.1" or "1.2"
+
+	// Operation is the local name of the first element in the Body: the
+	// operation for a request, its response element otherwise.
+	Operation string
+
+	Fault *SOAPFault
+}
+
+// SOAPFault is a SOAP Fault's code and message. For SOAP 1.2, Code is the
+// Code's Value, with any Subcode values after it, separated by "/".
+type SOAPFault struct {
+	Code   string `json:"code"`
+	String string `json:"string,omitempty"`
+}
+
+// ParseSOAP summarises data if it is a SOAP envelope; ok is false if not.
+func ParseSOAP(data []byte) (env SOAPEnvelope, ok bool) {
+	dec := newXMLDecoder(data)
+	var path []string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return env, ok // a truncated body still tells what it got to
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+			switch {
+			case len(path) == 1:
+				if t.Name.Local != "Envelope" {
+					return env, false
+				}
+				switch t.Name.Space {
+				case soap11Namespace:
+					env.Version = "1.1"
+				case soap12Namespace:
+					env.Version = "1.2"
+				default:
+					return env, false
+				}
+				ok = true
+			case len(path) == 3 && path[1] == "Body" && env.Operation == "":
+				env.Operation = t.Name.Local
+				if t.Name.Local == "Fault" {
+					env.Fault = &SOAPFault{}
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if f := env.Fault; f != nil && len(path) > 3 && path[2] == "Fault" {
+				v := strings.TrimSpace(text.String())
+				switch leaf := strings.Join(path[3:], "/"); leaf {
+				case "faultcode", "Code/Value":
+					f.Code = v
+				case "faultstring":
+					f.String = v
+				case "Reason/Text":
+					if f.String == "" {
+						f.String = v
+					}
+				default:
+					if strings.HasPrefix(leaf, "Code/") && strings.HasSuffix(leaf, "Subcode/Value") {
+						f.Code += "/" + v
+					}
+				}
+			}
+			text.Reset()
+			path = path[:len(path)-1]
+			if len(path) == 0 {
+				return env, ok
+			}
+		}
+	}
+}
@@ -1,6 +1,18 @@
 package proxy
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
 // RequestHook is called after the full request body is read, before forwarding.
+// OnRequest may change flow.Request's Method, URL (path and query), Headers,
+// and Body, and the changes are forwarded. The upstream has already been
+// chosen, so a new path is not routed again. A Body left truncated (see
+// BodyTruncated) is streamed from the client unchanged.
 type RequestHook interface {
 	OnRequest(flow *Flow)
 }
@@ -20,56 +32,268 @@ type ErrorHook interface {
 	OnError(flow *Flow, err error)
 }
 
+// Responder can answer a request itself instead of forwarding it. Respond is
+// called after the request hooks and any intercept; the first addon to return
+// a non-nil response wins and the upstream is never contacted.
+type Responder interface {
+	Respond(flow *Flow) *CapturedResponse
+}
+
+// FallbackResponder can answer a request whose upstream could not be reached.
+// The first addon to return a non-nil response replaces the 502.
+type FallbackResponder interface {
+	Fallback(flow *Flow, err error) *CapturedResponse
+}
+
+// ResponseRewriter can change a response body before it reaches the client.
+// Both methods see the response's status and headers in flow.Response, and
+// Rewrites reports whether the addon rewrites it. The engine then reads the
+// whole body once, decompressing gzip, passes it through each such addon's
+// Rewrite, and sends the result uncompressed with a matching Content-Length
+// and without the upstream's ETag. Bodies it can't read (over 32 MB, or in
+// another encoding) are passed on unchanged.
+type ResponseRewriter interface {
+	Rewrites(flow *Flow) bool
+	Rewrite(flow *Flow, body []byte) []byte
+}
+
 // Addon is a marker interface; addons implement whichever hook interfaces they need.
+// Hooks run for every flow, including those left out of the store by ignore
+// rules, sampling, or the record filter; addons that keep or export flows
+// check Flow.Excluded.
 type Addon interface{}
 
-// AddonManager dispatches flow lifecycle events to registered addons in order.
+// Named is implemented by addons that report the name they are listed and
+// toggled under. Other addons are named after their type.
+type Named interface {
+	Name() string
+}
+
+// Prioritized is implemented by addons that need to run before or after
+// others. Lower priorities run first, and addons of equal priority run in
+// the order they were added. The default priority is 0.
+type Prioritized interface {
+	Priority() int
+}
+
+// AddonInfo describes a registered addon.
+type AddonInfo struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	Enabled  bool     `json:"enabled"`
+	Hooks    []string `json:"hooks"`
+}
+
+// AddonPatch changes a registered addon at runtime. Nil fields are left
+// unchanged.
+type AddonPatch struct {
+	Name     string `json:"name"`
+	Enabled  *bool  `json:"enabled"`
+	Priority *int   `json:"priority"`
+}
+
+type addonEntry struct {
+	addon    Addon
+	name     string
+	priority int // guarded by AddonManager.mu
+	enabled  atomic.Bool
+}
+
+// AddonManager dispatches flow lifecycle events to registered addons in
+// priority order, skipping disabled ones.
 type AddonManager struct {
-	addons []Addon
+	mu sync.Mutex // serializes changes
+
+	// addons is replaced, sorted by priority, on every change so the hot
+	// path never takes mu.
+	addons atomic.Pointer[[]*addonEntry]
 }
 
 // NewAddonManager returns an empty AddonManager.
 func NewAddonManager() *AddonManager {
-	return &AddonManager{}
+	m := &AddonManager{}
+	m.addons.Store(&[]*addonEntry{})
+	return m
 }
 
-// Add registers one or more addons.
+// Add registers one or more addons, enabled. A name already taken gets a
+// numeric suffix.
 func (m *AddonManager) Add(addons ...Addon) {
-	m.addons = append(m.addons, addons...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := slices.Clone(*m.addons.Load())
+	for _, a := range addons {
+		e := &addonEntry{addon: a, name: addonName(a)}
+		if p, ok := a.(Prioritized); ok {
+			e.priority = p.Priority()
+		}
+		for n := 2; slices.ContainsFunc(entries, func(o *addonEntry) bool { return o.name == e.name }); n++ {
+			e.name = fmt.Sprintf("%s-%d", addonName(a), n)
+		}
+		e.enabled.Store(true)
+		entries = append(entries, e)
+	}
+	m.store(entries)
+}
+
+// List describes the registered addons in the order they run.
+func (m *AddonManager) List() []AddonInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := *m.addons.Load()
+	out := make([]AddonInfo, len(entries))
+	for i, e := range entries {
+		out[i] = AddonInfo{Name: e.name, Priority: e.priority, Enabled: e.enabled.Load(), Hooks: addonHooks(e.addon)}
+	}
+	return out
+}
+
+// Patch enables, disables, or reprioritizes the addon named p.Name.
+func (m *AddonManager) Patch(p AddonPatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := *m.addons.Load()
+	i := slices.IndexFunc(entries, func(e *addonEntry) bool { return e.name == p.Name })
+	if i < 0 {
+		return fmt.Errorf("addon %q not found", p.Name)
+	}
+	if p.Enabled != nil {
+		entries[i].enabled.Store(*p.Enabled)
+	}
+	if p.Priority != nil && *p.Priority != entries[i].priority {
+		entries[i].priority = *p.Priority
+		m.store(slices.Clone(entries))
+	}
+	return nil
+}
+
+// store publishes entries, stably sorted by priority. Callers hold mu.
+func (m *AddonManager) store(entries []*addonEntry) {
+	slices.SortStableFunc(entries, func(a, b *addonEntry) int { return a.priority - b.priority })
+	m.addons.Store(&entries)
+}
+
+// each calls fn on every enabled addon in order until it returns false.
+func (m *AddonManager) each(fn func(Addon) bool) {
+	for _, e := range *m.addons.Load() {
+		if e.enabled.Load() && !fn(e.addon) {
+			return
+		}
+	}
+}
+
+func addonName(a Addon) string {
+	if n, ok := a.(Named); ok {
+		return n.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", a), "*")
+}
+
+// addonHooks lists the hook interfaces a implements.
+func addonHooks(a Addon) []string {
+	var hooks []string
+	if _, ok := a.(RequestHook); ok {
+		hooks = append(hooks, "request")
+	}
+	if _, ok := a.(ResponseHook); ok {
+		hooks = append(hooks, "response")
+	}
+	if _, ok := a.(CompleteHook); ok {
+		hooks = append(hooks, "complete")
+	}
+	if _, ok := a.(ErrorHook); ok {
+		hooks = append(hooks, "error")
+	}
+	if _, ok := a.(Responder); ok {
+		hooks = append(hooks, "respond")
+	}
+	if _, ok := a.(FallbackResponder); ok {
+		hooks = append(hooks, "fallback")
+	}
+	if _, ok := a.(ResponseRewriter); ok {
+		hooks = append(hooks, "rewrite")
+	}
+	return hooks
 }
 
 // FireRequest calls OnRequest on every addon that implements RequestHook.
 func (m *AddonManager) FireRequest(flow *Flow) {
-	for _, a := range m.addons {
+	m.each(func(a Addon) bool {
 		if h, ok := a.(RequestHook); ok {
 			h.OnRequest(flow)
 		}
-	}
+		return true
+	})
 }
 
 // FireResponse calls OnResponse on every addon that implements ResponseHook.
 func (m *AddonManager) FireResponse(flow *Flow) {
-	for _, a := range m.addons {
+	m.each(func(a Addon) bool {
 		if h, ok := a.(ResponseHook); ok {
 			h.OnResponse(flow)
 		}
-	}
+		return true
+	})
 }
 
 // FireComplete calls OnComplete on every addon that implements CompleteHook.
 func (m *AddonManager) FireComplete(flow *Flow) {
-	for _, a := range m.addons {
+	m.each(func(a Addon) bool {
 		if h, ok := a.(CompleteHook); ok {
 			h.OnComplete(flow)
 		}
-	}
+		return true
+	})
+}
+
+// rewriters returns the ResponseRewriter addons that rewrite flow's response.
+func (m *AddonManager) rewriters(flow *Flow) (out []ResponseRewriter) {
+	m.each(func(a Addon) bool {
+		if h, ok := a.(ResponseRewriter); ok && h.Rewrites(flow) {
+			out = append(out, h)
+		}
+		return true
+	})
+	return out
+}
+
+// Respond returns the first non-nil response from a Responder addon.
+func (m *AddonManager) Respond(flow *Flow) (resp *CapturedResponse) {
+	m.each(func(a Addon) bool {
+		if h, ok := a.(Responder); ok {
+			resp = h.Respond(flow)
+		}
+		return resp == nil
+	})
+	return resp
+}
+
+// responds reports whether any enabled addon implements Responder.
+func (m *AddonManager) responds() (ok bool) {
+	m.each(func(a Addon) bool {
+		_, ok = a.(Responder)
+		return !ok
+	})
+	return ok
+}
+
+// Fallback returns the first non-nil response from a FallbackResponder addon.
+func (m *AddonManager) Fallback(flow *Flow, err error) (resp *CapturedResponse) {
+	m.each(func(a Addon) bool {
+		if h, ok := a.(FallbackResponder); ok {
+			resp = h.Fallback(flow, err)
+		}
+		return resp == nil
+	})
+	return resp
 }
 
 // FireError calls OnError on every addon that implements ErrorHook.
 func (m *AddonManager) FireError(flow *Flow, err error) {
-	for _, a := range m.addons {
+	m.each(func(a Addon) bool {
 		if h, ok := a.(ErrorHook); ok {
 			h.OnError(flow, err)
 		}
-	}
+		return true
+	})
 }
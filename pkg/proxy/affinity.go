@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+)
+
+// Affinity keeps a client on the same weighted target across requests, for
+// apps that hold session state on the server. Exactly one field is set.
+type Affinity struct {
+	// Cookie names a cookie the proxy sets to the target it chose; later
+	// requests carrying it go to that target while it has a positive weight.
+	Cookie string
+
+	// Header names a request header whose value is hashed to pick the
+	// target, e.g. a user or session ID. Requests without it are spread by
+	// weight as usual.
+	Header string
+}
+
+const affinityContextKey contextKey = "affinity"
+
+func (a *Affinity) validate(upstream string) error {
+	if (a.Cookie == "") == (a.Header == "") {
+		return fmt.Errorf("upstream %q: affinity needs exactly one of cookie or header", upstream)
+	}
+	return nil
+}
+
+// id names t in affinity cookies. It is derived from the URL so it survives
+// config reloads that reorder or reweight targets.
+func (t *Target) id() string {
+	h := fnv.New32a()
+	h.Write([]byte(t.URL))
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// pickTarget chooses the target for r: by affinity when configured and
+// possible, otherwise at random in proportion to weight. The returned cookie,
+// if non-nil, should be set on the response to pin the client.
+func (u *Upstream) pickTarget(r *http.Request) (*Target, *http.Cookie) {
+	if len(u.Targets) == 1 {
+		return &u.Targets[0], nil
+	}
+	a := u.Affinity
+	switch {
+	case a == nil:
+	case a.Cookie != "":
+		if c, err := r.Cookie(a.Cookie); err == nil {
+			for i := range u.Targets {
+				if t := &u.Targets[i]; t.Weight > 0 && t.id() == c.Value {
+					return t, nil
+				}
+			}
+		}
+		t := u.weightedTarget(-1)
+		return t, &http.Cookie{Name: a.Cookie, Value: t.id(), Path: "/", HttpOnly: true}
+	case a.Header != "":
+		if v := r.Header.Get(a.Header); v != "" {
+			h := fnv.New32a()
+			h.Write([]byte(v))
+			return u.weightedTarget(int(h.Sum32() % uint32(u.totalWeight()))), nil
+		}
+	}
+	return u.weightedTarget(-1), nil
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alerts flag forwarded flows that are slower than a latency budget or end
+// with an unwanted status. Such flows are tagged "alert:latency" and/or
+// "alert:status", which the UIs highlight, and can also be reported to a
+// webhook or as a desktop notification.
+type Alerts struct {
+	// Latency is the budget for a flow's whole duration; 0 has none.
+	Latency time.Duration
+
+	// Status lists the statuses that raise an alert: codes ("429") or
+	// classes ("5xx"). Upstream errors count as 502.
+	Status []string
+
+	// Webhook, if set, receives a JSON POST for each alert (see AlertEvent).
+	Webhook string
+
+	// Desktop shows a desktop notification for alerts, at most one per
+	// upstream every desktopAlertInterval.
+	Desktop bool
+}
+
+// desktopAlertInterval keeps a run of slow requests from flooding the
+// desktop with notifications.
+const desktopAlertInterval = 10 * time.Second
+
+// AlertEvent is the body POSTed to an alert webhook.
+type AlertEvent struct {
+	FlowID     string   `json:"flowId"`
+	Upstream   string   `json:"upstream"`
+	Method     string   `json:"method"`
+	URL        string   `json:"url"`
+	Status     int      `json:"status"`     // 502 for upstream errors
+	DurationMS int64    `json:"durationMs"` // the flow's whole duration
+	Reasons    []string `json:"reasons"`    // "latency", "status"
+	Message    string   `json:"message"`
+}
+
+// alerter sends alert notifications.
+type alerter struct {
+	mu          sync.Mutex
+	lastDesktop map[string]time.Time // by upstream
+}
+
+// validate checks the status patterns.
+func (a *Alerts) validate(where string) error {
+	if a.Latency < 0 {
+		return fmt.Errorf("alerts for %s: latency must be >= 0", where)
+	}
+	for _, s := range a.Status {
+		if !validStatusPattern(s) {
+			return fmt.Errorf("alerts for %s: status %q is not a code (429) or class (5xx)", where, s)
+		}
+	}
+	return nil
+}
+
+func validStatusPattern(s string) bool {
+	s = strings.ToLower(s)
+	if len(s) != 3 || s[0] < '1' || s[0] > '5' {
+		return false
+	}
+	if s[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// statusMatches reports whether code matches one of the status patterns.
+func (a *Alerts) statusMatches(code int) bool {
+	return statusMatches(a.Status, code)
+}
+
+// statusMatches reports whether code matches one of patterns, codes or
+// classes as checked by validStatusPattern.
+func statusMatches(patterns []string, code int) bool {
+	c := strconv.Itoa(code)
+	for _, s := range patterns {
+		s = strings.ToLower(s)
+		if s == c || (strings.HasSuffix(s, "xx") && s[0] == c[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// alerts returns the alert thresholds for flows forwarded to upstream: its
+// own, or else the global ones.
+func (rt *routing) alerts(upstream *Upstream) *Alerts {
+	if upstream != nil && upstream.Alerts != nil {
+		return upstream.Alerts
+	}
+	return rt.opts.Alerts
+}
+
+// checkAlerts tags flow if it broke its alert thresholds, once its response
+// is done, and sends the configured notifications.
+func (e *Engine) checkAlerts(flow *Flow) {
+	a := flow.alerts
+	if a == nil {
+		return
+	}
+	status := http.StatusBadGateway
+	if flow.Response != nil {
+		status = flow.Response.StatusCode
+	}
+	d := flow.Duration().Round(time.Millisecond)
+	var reasons, why []string
+	if a.Latency > 0 && d > a.Latency {
+		reasons = append(reasons, "latency")
+		why = append(why, fmt.Sprintf("took %s (budget %s)", d, a.Latency))
+	}
+	if a.statusMatches(status) {
+		reasons = append(reasons, "status")
+		why = append(why, fmt.Sprintf("returned %d", status))
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	for _, r := range reasons {
+		flow.Tags = append(flow.Tags, "alert:"+r)
+	}
+	if a.Webhook == "" && !a.Desktop {
+		return
+	}
+	ev := AlertEvent{
+		FlowID:     flow.ID,
+		Upstream:   flow.Upstream,
+		Method:     flow.Request.Method,
+		URL:        flow.Request.URL,
+		Status:     status,
+		DurationMS: d.Milliseconds(),
+		Reasons:    reasons,
+		Message:    fmt.Sprintf("%s %s %s", flow.Request.Method, flow.Request.Path, strings.Join(why, ", ")),
+	}
+	if a.Webhook != "" {
+		go e.alerts.post(a.Webhook, ev)
+	}
+	if a.Desktop && e.alerts.desktopDue(flow.Upstream) {
+		go desktopNotify("http-proxy: "+flow.Upstream, ev.Message)
+	}
+}
+
+// post sends ev to the webhook url. Failures are only logged; the flow is
+// tagged either way.
+func (al *alerter) post(url string, ev AlertEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("alert webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("alert webhook: POST %s: %s", url, resp.Status)
+	}
+}
+
+// desktopDue reports whether a desktop notification for upstream may be
+// shown now, and if so starts its quiet interval.
+func (al *alerter) desktopDue(upstream string) bool {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if time.Since(al.lastDesktop[upstream]) < desktopAlertInterval {
+		return false
+	}
+	if al.lastDesktop == nil {
+		al.lastDesktop = make(map[string]time.Time)
+	}
+	al.lastDesktop[upstream] = time.Now()
+	return true
+}
+
+// desktopNotify shows a notification with notify-send on Linux and the BSDs,
+// or osascript on macOS. Elsewhere, or without those tools, it does nothing.
+func desktopNotify(title, msg string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(msg), strconv.Quote(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows", "plan9", "js", "wasip1":
+		return
+	default:
+		cmd = exec.Command("notify-send", "--app-name=http-proxy", title, msg)
+	}
+	_ = cmd.Run()
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FlowPatch is a partial update of a flow's user-managed fields. Nil fields
+// are left unchanged.
+type FlowPatch struct {
+	Note   *string `json:"note"`
+	Pinned *bool   `json:"pinned"`
+}
+
+// PatchFlow applies p to a flow.
+func (e *Engine) PatchFlow(flowID string, p FlowPatch) (*Flow, error) {
+	flow := e.store.Get(flowID)
+	if flow == nil {
+		return nil, fmt.Errorf("flow %q not found", flowID)
+	}
+	flow.mu.Lock()
+	if p.Note != nil {
+		flow.Note = strings.TrimSpace(*p.Note)
+	}
+	flow.mu.Unlock()
+	if p.Pinned != nil {
+		e.store.SetPinned(flow, *p.Pinned)
+	}
+	e.store.Update(flow, FlowEventUpdate)
+	return flow, nil
+}
+
+// TagFlow adds and removes user tags on a flow. Tags are trimmed; adding a
+// tag the flow already has is a no-op.
+func (e *Engine) TagFlow(flowID string, add, remove []string) (*Flow, error) {
+	flow := e.store.Get(flowID)
+	if flow == nil {
+		return nil, fmt.Errorf("flow %q not found", flowID)
+	}
+	flow.mu.Lock()
+	tags := slices.DeleteFunc(slices.Clone(flow.Tags), func(t string) bool {
+		return slices.Contains(remove, t)
+	})
+	for _, t := range add {
+		t = strings.TrimSpace(t)
+		if t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	flow.Tags = tags
+	flow.mu.Unlock()
+	e.store.Update(flow, FlowEventUpdate)
+	return flow, nil
+}
@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// assertFailedTag marks replays whose assertions failed.
+const assertFailedTag = "assert-failed"
+
+// Assertions are checks on a replay's response, which turn captured flows
+// into contract checks. The replay passes if every check holds.
+type Assertions struct {
+	// Status lists the statuses that pass: codes ("200") or classes ("2xx").
+	Status []string `json:"status,omitempty"`
+
+	// Headers maps response header names to regular expressions their value
+	// must match; "" only requires the header to be present.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// JSON maps paths in the JSON response body, in the form of Diff's
+	// change paths without "response.body." ("user.id", "items[0].name"),
+	// to the value expected there. [*] checks every element of an array.
+	JSON map[string]any `json:"json,omitempty"`
+}
+
+// AssertionResult is the outcome of a replay's assertions.
+type AssertionResult struct {
+	Passed   bool               `json:"passed"`
+	Checks   int                `json:"checks"`
+	Failures []AssertionFailure `json:"failures,omitempty"`
+}
+
+// AssertionFailure is a check that failed. Check names it as written
+// ("status", "header Content-Type", "json items[*].id"); Message says what
+// the response had instead.
+type AssertionFailure struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// IsZero reports whether a has no checks.
+func (a *Assertions) IsZero() bool {
+	return a == nil || len(a.Status) == 0 && len(a.Headers) == 0 && len(a.JSON) == 0
+}
+
+// Validate checks the status patterns, header expressions, and JSON paths.
+func (a *Assertions) Validate() error {
+	if a == nil {
+		return nil
+	}
+	for _, s := range a.Status {
+		if !validStatusPattern(s) {
+			return fmt.Errorf("assert status %q is not a code (200) or class (2xx)", s)
+		}
+	}
+	for name, expr := range a.Headers {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("assert header %s: %w", name, err)
+		}
+	}
+	for path := range a.JSON {
+		if _, err := parseJSONPath(path); err != nil {
+			return fmt.Errorf("assert json %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Check runs the assertions against flow's response. A flow without one
+// fails every check. a must be valid.
+func (a *Assertions) Check(flow *Flow) *AssertionResult {
+	res := &AssertionResult{}
+	fail := func(check, format string, args ...any) {
+		res.Failures = append(res.Failures, AssertionFailure{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	resp := flow.Response
+	if len(a.Status) > 0 {
+		res.Checks++
+		switch {
+		case resp == nil:
+			fail("status", "no response (%s)", flow.Error)
+		case !statusMatches(a.Status, resp.StatusCode):
+			fail("status", "got %d, want %s", resp.StatusCode, strings.Join(a.Status, " or "))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(a.Headers)) {
+		res.Checks++
+		check := "header " + name
+		var values []string
+		if resp != nil {
+			values = resp.Headers.Values(name)
+		}
+		if len(values) == 0 {
+			fail(check, "missing")
+			continue
+		}
+		if expr := a.Headers[name]; expr != "" && !regexp.MustCompile(expr).MatchString(values[0]) {
+			fail(check, "%q doesn't match %s", values[0], expr)
+		}
+	}
+	if len(a.JSON) > 0 {
+		var body any
+		var bodyErr error
+		if resp == nil {
+			bodyErr = fmt.Errorf("no response")
+		} else if bodyErr = json.Unmarshal(resp.ReadBody(), &body); bodyErr != nil {
+			bodyErr = fmt.Errorf("body is not JSON")
+		}
+		for _, path := range slices.Sorted(maps.Keys(a.JSON)) {
+			res.Checks++
+			check := "json " + path
+			if bodyErr != nil {
+				fail(check, "%v", bodyErr)
+				continue
+			}
+			want := normalizeJSON(a.JSON[path])
+			segs, _ := parseJSONPath(path)
+			for _, v := range jsonAt(body, "", segs) {
+				if !v.found {
+					fail(check, "%s not found", v.path)
+					break
+				}
+				if !reflect.DeepEqual(v.value, want) {
+					fail(check, "%s is %s, want %s", v.path, jsonText(v.value), jsonText(want))
+					break
+				}
+			}
+		}
+	}
+	res.Passed = len(res.Failures) == 0
+	return res
+}
+
+// recordAssertions checks flow against a and records the result on it,
+// tagging it assertFailedTag if any check failed.
+func (e *Engine) recordAssertions(flow *Flow, a *Assertions) {
+	res := a.Check(flow)
+	flow.mu.Lock()
+	flow.Assertions = res
+	if !res.Passed {
+		flow.Tags = append(slices.Clone(flow.Tags), assertFailedTag)
+	}
+	flow.mu.Unlock()
+	e.store.Update(flow, FlowEventUpdate)
+}
+
+// jsonSeg is a step in a JSON path: a key, an index, or every index.
+type jsonSeg struct {
+	key   string
+	index int // -1 for a key, -2 for [*]
+}
+
+// parseJSONPath splits a path such as "items[*].tags[0]" into its steps.
+func parseJSONPath(path string) ([]jsonSeg, error) {
+	var segs []jsonSeg
+	rest := path
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			idx := rest[1:end]
+			if idx == "*" {
+				segs = append(segs, jsonSeg{index: -2})
+			} else if n, err := strconv.Atoi(idx); err == nil && n >= 0 {
+				segs = append(segs, jsonSeg{index: n})
+			} else {
+				return nil, fmt.Errorf("bad index [%s]", idx)
+			}
+			rest = rest[end+1:]
+		case rest[0] == '.' && len(segs) > 0:
+			rest = rest[1:]
+			fallthrough
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key")
+			}
+			segs = append(segs, jsonSeg{key: rest[:end], index: -1})
+			rest = rest[end:]
+		}
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return segs, nil
+}
+
+// jsonValue is a value found, or not, at a concrete path.
+type jsonValue struct {
+	path  string
+	value any
+	found bool
+}
+
+// jsonAt returns the values at segs in v, one for each element an [*]
+// ranges over. A missing step yields a single value that isn't found, with
+// the rest of the path as written.
+func jsonAt(v any, path string, segs []jsonSeg) []jsonValue {
+	if len(segs) == 0 {
+		return []jsonValue{{path: path, value: v, found: true}}
+	}
+	s := segs[0]
+	missing := []jsonValue{{path: appendSegs(path, segs)}}
+	switch s.index {
+	case -1:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return missing
+		}
+		x, ok := m[s.key]
+		if !ok {
+			return missing
+		}
+		return jsonAt(x, appendSegs(path, segs[:1]), segs[1:])
+	case -2:
+		arr, ok := v.([]any)
+		if !ok {
+			return missing
+		}
+		var out []jsonValue
+		for i, x := range arr {
+			out = append(out, jsonAt(x, fmt.Sprintf("%s[%d]", path, i), segs[1:])...)
+		}
+		return out
+	default:
+		arr, ok := v.([]any)
+		if !ok || s.index >= len(arr) {
+			return missing
+		}
+		return jsonAt(arr[s.index], appendSegs(path, segs[:1]), segs[1:])
+	}
+}
+
+// appendSegs writes segs after path in the form parseJSONPath reads.
+func appendSegs(path string, segs []jsonSeg) string {
+	var b strings.Builder
+	b.WriteString(path)
+	for _, s := range segs {
+		switch s.index {
+		case -1:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(s.key)
+		case -2:
+			b.WriteString("[*]")
+		default:
+			fmt.Fprintf(&b, "[%d]", s.index)
+		}
+	}
+	return b.String()
+}
+
+// normalizeJSON gives v, such as a value decoded from YAML, the types
+// encoding/json decodes to, so that it compares equal to the body's value.
+func normalizeJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if json.Unmarshal(data, &out) != nil {
+		return v
+	}
+	return out
+}
+
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpstreamAuth attaches credentials to requests forwarded to an upstream, so
+// clients of a protected API don't each need a token. Set one of Bearer,
+// User, or OAuth2. Requests that carry their own Authorization header keep
+// it unless Override is set. Flows the proxy added credentials to are
+// tagged "auth".
+type UpstreamAuth struct {
+	// Bearer is a static token, sent as "Authorization: Bearer <token>".
+	Bearer string
+
+	// User and Password are sent as basic auth.
+	User     string
+	Password string
+
+	// OAuth2 fetches bearer tokens with the client credentials grant and
+	// fetches a new one before the last expires or after the upstream
+	// rejects it with a 401.
+	OAuth2 *OAuth2ClientCredentials
+
+	// Override replaces an Authorization header sent by the client.
+	Override bool
+
+	token *tokenSource // OAuth2 tokens, set by validate
+}
+
+// OAuth2ClientCredentials configures an OAuth2 client credentials grant
+// (RFC 6749 section 4.4).
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// Params are extra form parameters for the token request, e.g. an
+	// "audience" some providers require.
+	Params map[string]string
+
+	// InParams sends the client ID and secret as form parameters instead
+	// of basic auth, for providers that only accept them there.
+	InParams bool
+}
+
+// tokenRefreshMargin is how long before a token expires a new one is fetched,
+// so requests in flight don't reach the upstream with a just-expired token.
+const tokenRefreshMargin = 30 * time.Second
+
+// validate checks that exactly one kind of credential is set.
+func (a *UpstreamAuth) validate(upstream string) error {
+	n := 0
+	for _, set := range []bool{a.Bearer != "", a.User != "", a.OAuth2 != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("auth for upstream %q: set one of bearer, basic, or oauth2", upstream)
+	}
+	if o := a.OAuth2; o != nil {
+		if o.TokenURL == "" || o.ClientID == "" {
+			return fmt.Errorf("auth for upstream %q: oauth2 needs token_url and client_id", upstream)
+		}
+		if _, err := url.Parse(o.TokenURL); err != nil {
+			return fmt.Errorf("auth for upstream %q: invalid token_url: %w", upstream, err)
+		}
+		if a.token == nil {
+			a.token = &tokenSource{config: o, client: &http.Client{Timeout: 30 * time.Second}}
+		}
+	}
+	return nil
+}
+
+// header returns the Authorization header value to send.
+func (a *UpstreamAuth) header() (string, error) {
+	switch {
+	case a.Bearer != "":
+		return "Bearer " + a.Bearer, nil
+	case a.User != "":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.User+":"+a.Password)), nil
+	case a.token != nil:
+		token, err := a.token.get()
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", nil
+}
+
+// tokenSource caches an OAuth2 access token until shortly before it expires.
+type tokenSource struct {
+	config *OAuth2ClientCredentials
+	client *http.Client
+
+	mu      sync.Mutex // held while fetching, so concurrent requests share one fetch
+	token   string
+	expires time.Time // zero: no expiry given
+}
+
+// get returns the cached token, fetching a new one if there is none or it is
+// about to expire.
+func (s *tokenSource) get() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && (s.expires.IsZero() || time.Until(s.expires) > tokenRefreshMargin) {
+		return s.token, nil
+	}
+	token, expiresIn, err := s.fetch()
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.expires = time.Time{}
+	if expiresIn > 0 {
+		s.expires = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// invalidate drops token if it is still the cached one, so the next request
+// fetches a new token.
+func (s *tokenSource) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// fetch requests a token from the token endpoint.
+func (s *tokenSource) fetch() (token string, expiresIn int64, err error) {
+	c := s.config
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for k, v := range c.Params {
+		form.Set(k, v)
+	}
+	if c.InParams {
+		form.Set("client_id", c.ClientID)
+		form.Set("client_secret", c.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !c.InParams {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("token request: %w", err)
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &tr)
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		msg := strings.TrimSpace(tr.Error + " " + tr.Description)
+		if msg == "" {
+			msg = strings.TrimSpace(string(body))
+		}
+		return "", 0, fmt.Errorf("token request: %s: %s", resp.Status, msg)
+	}
+	return tr.AccessToken, tr.ExpiresIn, nil
+}
+
+// authAddon adds the credentials of a flow's upstream to its request. It is
+// registered by New, so it can be turned off like any other addon.
+type authAddon struct{}
+
+// Name identifies the addon in the addon list.
+func (authAddon) Name() string { return "auth" }
+
+// Priority runs the addon after others, so their request changes can't drop
+// the credentials.
+func (authAddon) Priority() int { return 100 }
+
+// OnRequest sets the Authorization header. If no token can be had, the flow
+// is killed rather than sent without credentials.
+func (authAddon) OnRequest(flow *Flow) {
+	auth := flow.auth
+	if auth == nil || flow.Request == nil {
+		return
+	}
+	if !auth.Override && flow.Request.Headers.Get("Authorization") != "" {
+		return
+	}
+	value, err := auth.header()
+	if err != nil {
+		flow.Kill()
+		flow.Error = "auth: " + err.Error()
+		return
+	}
+	if flow.Request.Headers == nil {
+		flow.Request.Headers = make(http.Header)
+	}
+	flow.Request.Headers.Set("Authorization", value)
+	flow.Tags = append(flow.Tags, "auth")
+}
+
+// OnResponse drops an OAuth2 token the upstream rejected.
+func (authAddon) OnResponse(flow *Flow) {
+	auth := flow.auth
+	if auth == nil || auth.token == nil || flow.Response == nil || flow.Response.StatusCode != http.StatusUnauthorized {
+		return
+	}
+	if token, ok := strings.CutPrefix(flow.Request.Headers.Get("Authorization"), "Bearer "); ok {
+		auth.token.invalidate(token)
+	}
+}
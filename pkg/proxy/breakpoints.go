@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Breakpoint phases.
+const (
+	BreakRequest  = "request"  // pause before the request is forwarded
+	BreakResponse = "response" // pause before the response is returned
+)
+
+// Breakpoint pauses the flows matching Filter, like intercept but standing:
+// any number may be set at once, each at the request or the response.
+// Paused flows are resumed, edited, or killed as intercepted ones are, and
+// tagged "breakpoint".
+//
+// Response breakpoints see the response status and headers, so ~s and ~h
+// match, but not its body; flows stopped there show the body while paused.
+// They apply to upstream responses of flows that are stored, not to mocks
+// or replays.
+type Breakpoint struct {
+	ID     string `json:"id"`
+	Filter string `json:"filter,omitempty"` // empty: every flow
+	Phase  string `json:"phase"`            // BreakRequest (default) or BreakResponse
+
+	// Match is Filter parsed by the caller with the filter package; nil
+	// matches every flow.
+	Match Matcher `json:"-"`
+}
+
+// errFlowKilled is returned from modifyResponse for a flow killed at a
+// response breakpoint, so errorHandler answers without a fallback.
+var errFlowKilled = errors.New("flow killed")
+
+// breakpointTable holds the engine's breakpoints.
+type breakpointTable struct {
+	mu     sync.RWMutex
+	list   []Breakpoint
+	nextID int
+}
+
+// Breakpoints returns the breakpoints, in the order they were added.
+func (e *Engine) Breakpoints() []Breakpoint {
+	e.breakpoints.mu.RLock()
+	defer e.breakpoints.mu.RUnlock()
+	return slices.Clone(e.breakpoints.list)
+}
+
+// AddBreakpoint adds b and returns it with its ID. An empty phase is
+// BreakRequest.
+func (e *Engine) AddBreakpoint(b Breakpoint) (Breakpoint, error) {
+	switch b.Phase {
+	case "":
+		b.Phase = BreakRequest
+	case BreakRequest, BreakResponse:
+	default:
+		return Breakpoint{}, fmt.Errorf("breakpoint phase must be %q or %q, got %q", BreakRequest, BreakResponse, b.Phase)
+	}
+	e.breakpoints.mu.Lock()
+	defer e.breakpoints.mu.Unlock()
+	e.breakpoints.nextID++
+	b.ID = strconv.Itoa(e.breakpoints.nextID)
+	e.breakpoints.list = append(e.breakpoints.list, b)
+	return b, nil
+}
+
+// DeleteBreakpoint removes the breakpoint with the given ID. Flows it
+// paused stay paused.
+func (e *Engine) DeleteBreakpoint(id string) error {
+	e.breakpoints.mu.Lock()
+	defer e.breakpoints.mu.Unlock()
+	i := slices.IndexFunc(e.breakpoints.list, func(b Breakpoint) bool { return b.ID == id })
+	if i < 0 {
+		return fmt.Errorf("breakpoint %q not found", id)
+	}
+	e.breakpoints.list = slices.Delete(e.breakpoints.list, i, i+1)
+	return nil
+}
+
+// hasBreakpoints reports whether any breakpoint is set for phase.
+func (e *Engine) hasBreakpoints(phase string) bool {
+	e.breakpoints.mu.RLock()
+	defer e.breakpoints.mu.RUnlock()
+	return slices.ContainsFunc(e.breakpoints.list, func(b Breakpoint) bool { return b.Phase == phase })
+}
+
+// breaksAt reports whether a breakpoint for phase matches flow, and tags the
+// flow if so.
+func (e *Engine) breaksAt(flow *Flow, phase string) bool {
+	e.breakpoints.mu.RLock()
+	defer e.breakpoints.mu.RUnlock()
+	for _, b := range e.breakpoints.list {
+		if b.Phase == phase && (b.Match == nil || b.Match(flow)) {
+			flow.Tags = append(flow.Tags, "breakpoint")
+			return true
+		}
+	}
+	return false
+}
+
+// breakResponse pauses flow before resp is returned if a response
+// breakpoint matches, then applies any edit made meanwhile. It returns
+// errFlowKilled if the flow was killed.
+func (e *Engine) breakResponse(flow *Flow, resp *http.Response) error {
+	if !flow.breakable || resp.StatusCode == http.StatusSwitchingProtocols || !e.hasBreakpoints(BreakResponse) {
+		return nil
+	}
+	flow.Response = &CapturedResponse{StatusCode: resp.StatusCode, Headers: resp.Header.Clone(), Proto: resp.Proto}
+	if !e.breaksAt(flow, BreakResponse) {
+		flow.Response = nil
+		return nil
+	}
+
+	// Show what there is of the body while paused, keeping all of it for
+	// the client. Event streams would never end, so they aren't read.
+	if resp.Body != nil && resp.Body != http.NoBody &&
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		limit := e.routing.Load().opts.MaxBodySize
+		prefix, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		if err != nil {
+			return err
+		}
+		flow.Response.Body = prefix[:min(int64(len(prefix)), limit)]
+		flow.Response.BodyTruncated = int64(len(prefix)) > limit
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+	}
+
+	e.pause(resp.Request, flow)
+	if flow.Killed() {
+		return errFlowKilled
+	}
+	applyCapturedResponse(resp, flow.Response)
+	return nil
+}
+
+// ResponseEdit describes changes to the response of a flow paused at a
+// response breakpoint. Nil/empty fields are left untouched.
+type ResponseEdit struct {
+	StatusCode *int        `json:"statusCode,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       *string     `json:"body,omitempty"`
+}
+
+// Apply mutates cr according to the edit.
+func (e ResponseEdit) Apply(cr *CapturedResponse) error {
+	if e.StatusCode != nil {
+		if *e.StatusCode < 100 || *e.StatusCode > 999 {
+			return fmt.Errorf("invalid status code %d", *e.StatusCode)
+		}
+		cr.StatusCode = *e.StatusCode
+	}
+	if e.Headers != nil {
+		cr.Headers = e.Headers.Clone()
+	}
+	if e.Body != nil {
+		cr.Body = []byte(*e.Body)
+		cr.BodyTruncated = false
+	}
+	return nil
+}
+
+// EditResponse modifies the response of a flow paused at a response
+// breakpoint before it is resumed.
+func (e *Engine) EditResponse(flowID string, edit ResponseEdit) (*Flow, error) {
+	flow, err := e.interceptedFlow(flowID)
+	if err != nil {
+		return nil, err
+	}
+	flow.mu.Lock()
+	if flow.Response == nil {
+		err = fmt.Errorf("flow %q is paused before its request was sent", flowID)
+	} else {
+		err = edit.Apply(flow.Response)
+	}
+	flow.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	e.store.Update(flow, FlowEventUpdate)
+	return flow, nil
+}
+
+// applyCapturedResponse copies a (possibly edited) captured response back
+// onto resp.
+func applyCapturedResponse(resp *http.Response, cr *CapturedResponse) {
+	resp.StatusCode = cr.StatusCode
+	resp.Status = fmt.Sprintf("%d %s", cr.StatusCode, http.StatusText(cr.StatusCode))
+	resp.Header = cr.Headers.Clone()
+	if cr.BodyTruncated || cr.Body == nil {
+		// Only partly captured and not edited, or never read (no body, or
+		// an event stream): keep the original.
+		return
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(cr.Body))
+	resp.ContentLength = int64(len(cr.Body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(cr.Body)))
+}
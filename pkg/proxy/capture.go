@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errClientGone is reported when the proxy stops reading a response body
+// before EOF, which happens when the client disconnects mid-transfer.
+var errClientGone = errors.New("client disconnected before the body was sent")
+
+// captureRequestBody reads up to maxBytes of the request body onto the flow,
+// so request hooks, intercept, and filters can see it. The upstream receives
+// the whole body: the captured prefix, then the unread remainder streamed
+// straight through. Request.Size records the full length once it is known.
+func captureRequestBody(flow *Flow, r *http.Request, maxBytes int64) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	cr := flow.Request
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		r.Body.Close()
+		return err
+	}
+	if len(r.Trailer) > 0 {
+		// Trailers are populated once the body hits EOF. Send chunked so the
+		// transport can forward them after the body.
+		r.ContentLength = -1
+	}
+
+	if int64(len(head)) <= maxBytes {
+		// The whole body fit; there is nothing left to stream.
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(head))
+		cr.Body = head
+		cr.Size = int64(len(head))
+		if len(r.Trailer) > 0 {
+			cr.Trailers = r.Trailer.Clone()
+		}
+		return nil
+	}
+
+	cr.Body = head[:maxBytes]
+	cr.BodyTruncated = true
+	if maxBytes == 0 {
+		cr.Body = nil
+		flow.Tags = append(flow.Tags, captureSkippedTag)
+	}
+	trailer := r.Trailer
+	r.Body = &teeBody{
+		r: io.MultiReader(bytes.NewReader(head), r.Body),
+		c: r.Body,
+		done: func(t *teeBody, err error) {
+			cr.Size = t.n
+			if err == nil && len(trailer) > 0 {
+				cr.Trailers = trailer.Clone()
+			}
+		},
+	}
+	return nil
+}
+
+// limitRequestBody enforces maxBytes (if positive) on r's body. A declared
+// Content-Length over the limit is rejected at once; otherwise reads past the
+// limit fail with *http.MaxBytesError, which the caller turns into a 413 via
+// rejectTooLarge.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, maxBytes int64) bool {
+	if maxBytes <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	if r.ContentLength > maxBytes {
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	return true
+}
+
+// rejectTooLarge answers flow with a 413 for a body over maxBytes. Such flows
+// are tagged "too-large".
+func (e *Engine) rejectTooLarge(w http.ResponseWriter, flow *Flow, maxBytes int64) {
+	flow.Tags = append(flow.Tags, "too-large")
+	e.serveResponse(w, flow, &CapturedResponse{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Headers: http.Header{
+			"Content-Type": {"text/plain; charset=utf-8"},
+			"Connection":   {"close"},
+		},
+		Body:  []byte(fmt.Sprintf("request body exceeds max_request_size (%d bytes)\n", maxBytes)),
+		Proto: "HTTP/1.1",
+	})
+}
+
+// headerBytes returns the length of cr's request line and headers in
+// HTTP/1.1 form, Host header included.
+func (cr *CapturedRequest) headerBytes() int64 {
+	n := int64(len(cr.Method) + 1 + len(cr.URL) + 1 + len(cr.Proto) + 2)
+	if cr.Headers.Get("Host") == "" && cr.Host != "" {
+		n += int64(len("Host: ") + len(cr.Host) + 2)
+	}
+	return n + headerFieldBytes(cr.Headers)
+}
+
+// headerBytes returns the length of r's status line and headers in
+// HTTP/1.1 form.
+func (r *CapturedResponse) headerBytes() int64 {
+	status := fmt.Sprintf("%s %d %s\r\n", r.Proto, r.StatusCode, http.StatusText(r.StatusCode))
+	return int64(len(status)) + headerFieldBytes(r.Headers)
+}
+
+// headerFieldBytes is the length of h as "Key: value\r\n" lines, plus the
+// blank line that ends them.
+func headerFieldBytes(h http.Header) int64 {
+	n := 2
+	for k, vv := range h {
+		for _, v := range vv {
+			n += len(k) + 2 + len(v) + 2
+		}
+	}
+	return int64(n)
+}
+
+// captureResponse records resp on the flow and arranges for its body to be
+// captured as it streams to the client. The flow completes, and the response
+// and complete hooks fire, when the body has been fully sent.
+func (e *Engine) captureResponse(flow *Flow, resp *http.Response, maxBytes int64) {
+	flow.Response = &CapturedResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header.Clone(),
+		Proto:      resp.Proto,
+	}
+	flow.Response.HeadersSize = flow.Response.headerBytes()
+	if resp.Body == nil || resp.Body == http.NoBody || resp.StatusCode == http.StatusSwitchingProtocols {
+		// Nothing to capture; an upgraded connection's body is the raw
+		// stream and must be handed to the reverse proxy untouched.
+		e.finishResponse(flow, resp, &teeBody{}, nil)
+		return
+	}
+	resp.Body = &teeBody{
+		r:     resp.Body,
+		c:     resp.Body,
+		limit: maxBytes,
+		done: func(t *teeBody, err error) {
+			e.finishResponse(flow, resp, t, err)
+		},
+	}
+}
+
+// finishResponse completes flow once its response body has been streamed.
+func (e *Engine) finishResponse(flow *Flow, resp *http.Response, t *teeBody, err error) {
+	captured := flow.Response
+	captured.Body = t.buf.Bytes()
+	captured.BodyTruncated = t.n > t.limit
+	captured.Size = t.n
+	if t.limit == 0 && t.n > 0 {
+		flow.Tags = append(flow.Tags, captureSkippedTag)
+	}
+	if len(resp.Trailer) > 0 {
+		captured.Trailers = resp.Trailer.Clone()
+	}
+	flow.Timestamps.ResponseDone = time.Now()
+	recordTimings(flow)
+	e.checkAlerts(flow)
+
+	if err != nil {
+		flow.State = FlowStateError
+		flow.Error = fmt.Sprintf("response body: %v", err)
+		e.addons.FireError(flow, err)
+		e.store.Update(flow, FlowEventError)
+		return
+	}
+	flow.State = FlowStateComplete
+	e.addons.FireResponse(flow)
+	e.addons.FireComplete(flow)
+	e.store.Update(flow, FlowEventComplete)
+}
+
+// teeBody passes a body through unchanged while copying the first limit
+// bytes aside and counting the total. done is called exactly once: at EOF
+// (with a nil error), on a read error, or on Close before EOF.
+type teeBody struct {
+	r     io.Reader
+	c     io.Closer
+	limit int64
+	done  func(t *teeBody, err error)
+
+	buf  bytes.Buffer
+	n    int64
+	once sync.Once
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if room := t.limit - int64(t.buf.Len()); room > 0 {
+			t.buf.Write(p[:min(int64(n), room)])
+		}
+		t.n += int64(n)
+	}
+	if err == io.EOF {
+		t.finish(nil)
+	} else if err != nil {
+		t.finish(err)
+	}
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	t.finish(errClientGone)
+	return t.c.Close()
+}
+
+func (t *teeBody) finish(err error) {
+	t.once.Do(func() {
+		if t.done != nil {
+			t.done(t, err)
+		}
+	})
+}
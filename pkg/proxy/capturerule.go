@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// CaptureRule limits how much of matching bodies is captured, to keep the
+// store lean: large media or HTML pages can be left out while their flows'
+// metadata (headers, sizes, timings) is still recorded. Rules are checked in
+// order and the first match wins; bodies no rule matches are captured up to
+// Options.MaxBodySize. The full body always reaches the client or upstream.
+type CaptureRule struct {
+	// ContentTypes are media type globs ("video/*", "text/html") matched
+	// against the body's Content-Type; empty matches any.
+	ContentTypes []string
+
+	// Status lists response statuses, codes ("404") or classes ("2xx"),
+	// the rule applies to. A rule with statuses never matches a request
+	// body.
+	Status []string
+
+	// MaxBodySize is how many bytes of a matching body are kept, when Skip
+	// is false.
+	MaxBodySize int64
+
+	// Skip captures none of a matching body.
+	Skip bool
+}
+
+// validate checks the rule's patterns.
+func (c *CaptureRule) validate(where string) error {
+	for _, ct := range c.ContentTypes {
+		if _, err := path.Match(strings.ToLower(ct), ""); err != nil {
+			return fmt.Errorf("capture rule for %s: bad content type pattern %q", where, ct)
+		}
+	}
+	for _, s := range c.Status {
+		if !validStatusPattern(s) {
+			return fmt.Errorf("capture rule for %s: status %q is not a code (404) or class (2xx)", where, s)
+		}
+	}
+	if !c.Skip && c.MaxBodySize <= 0 {
+		return fmt.Errorf("capture rule for %s: needs max_body_size > 0 or skip", where)
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a body of the given
+// Content-Type, in a response with status (0 for requests).
+func (c *CaptureRule) matches(contentType string, status int) bool {
+	if len(c.Status) > 0 && (status == 0 || !statusMatches(c.Status, status)) {
+		return false
+	}
+	if len(c.ContentTypes) == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, pat := range c.ContentTypes {
+		if ok, _ := path.Match(strings.ToLower(pat), mt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCaptureRules checks every rule of a list.
+func validateCaptureRules(rules []CaptureRule, where string) error {
+	for i := range rules {
+		if err := rules[i].validate(where); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// captureRules returns the capture rules for flows to upstream (nil for
+// mocks): its own, or else the global ones.
+func (rt *routing) captureRules(upstream *Upstream) []CaptureRule {
+	if upstream != nil && upstream.Capture != nil {
+		return upstream.Capture
+	}
+	return rt.opts.Capture
+}
+
+// captureLimit returns how many bytes of a body to capture for flow: the
+// limit of the first of its capture rules that matches, 0 if that rule
+// skips the body, or else def.
+func captureLimit(flow *Flow, contentType string, status int, def int64) int64 {
+	for i := range flow.capture {
+		r := &flow.capture[i]
+		if !r.matches(contentType, status) {
+			continue
+		}
+		if r.Skip {
+			return 0
+		}
+		return min(r.MaxBodySize, def)
+	}
+	return def
+}
+
+// captureSkippedTag marks flows with a body that was not captured at all
+// because a capture rule skips it.
+const captureSkippedTag = "capture-skipped"
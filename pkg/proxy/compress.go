@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// With a CompressThreshold, the store compresses bodies larger than it once
+// their flow finishes and keeps only the compressed form in memory;
+// CapturedRequest and CapturedResponse ReadBody decompress them on demand.
+// Bodies too large to keep in memory are spilled instead, and bodies that
+// don't shrink are left as they are.
+
+// Algorithms for Options.CompressAlgorithm.
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd" // faster than gzip, and compresses better
+)
+
+// zstdEncoder and zstdDecoder are shared: EncodeAll and DecodeAll are safe
+// for concurrent use.
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		return dec
+	})
+)
+
+// packedBody is a captured body kept compressed in memory.
+type packedBody struct {
+	algorithm string
+	data      []byte
+}
+
+// validateCompressAlgorithm checks that alg names a supported algorithm.
+func validateCompressAlgorithm(alg string) error {
+	switch alg {
+	case "", CompressGzip, CompressZstd:
+		return nil
+	}
+	return fmt.Errorf("compress_algorithm %q: use %q or %q", alg, CompressGzip, CompressZstd)
+}
+
+// packBody compresses data with alg, favouring speed over ratio since it
+// runs as flows finish. It returns nil if the result is no smaller.
+func packBody(alg string, data []byte) *packedBody {
+	if alg == CompressZstd {
+		packed := zstdEncoder().EncodeAll(data, nil)
+		if len(packed) >= len(data) {
+			return nil
+		}
+		return &packedBody{algorithm: alg, data: packed}
+	}
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if _, err := w.Write(data); err != nil || w.Close() != nil || buf.Len() >= len(data) {
+		return nil
+	}
+	return &packedBody{algorithm: CompressGzip, data: bytes.Clone(buf.Bytes())}
+}
+
+// read returns the decompressed body, or nil if it can't be decompressed.
+func (b *packedBody) read() []byte {
+	if b.algorithm == CompressZstd {
+		data, err := zstdDecoder().DecodeAll(b.data, nil)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b.data))
+	if err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// compress packs f's in-memory bodies larger than the threshold.
+func (s *FlowStore) compress(f *Flow) {
+	if s.compressThreshold <= 0 {
+		return
+	}
+	if cr := f.Request; cr != nil && int64(len(cr.Body)) > s.compressThreshold {
+		if b := packBody(s.compressAlgorithm, cr.Body); b != nil {
+			bodyMu.Lock()
+			cr.packed, cr.Body = b, nil
+			bodyMu.Unlock()
+		}
+	}
+	if r := f.Response; r != nil && int64(len(r.Body)) > s.compressThreshold {
+		if b := packBody(s.compressAlgorithm, r.Body); b != nil {
+			bodyMu.Lock()
+			r.packed, r.Body = b, nil
+			bodyMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPackBodyRoundTrip(t *testing.T) {
+	jsonBody := []byte(strings.Repeat(`{"id":1,"name":"widget","tags":["a","b"]},`, 200))
+	htmlBody := []byte("<html><body>" + strings.Repeat("<p>hello, world</p>", 300) + "</body></html>")
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	tests := []struct {
+		name       string
+		alg        string
+		data       []byte
+		wantPacked bool
+	}{
+		{"gzip json", CompressGzip, jsonBody, true},
+		{"gzip html", CompressGzip, htmlBody, true},
+		{"default is gzip", "", jsonBody, true},
+		{"zstd json", CompressZstd, jsonBody, true},
+		{"zstd html", CompressZstd, htmlBody, true},
+		{"gzip incompressible", CompressGzip, random, false},
+		{"zstd incompressible", CompressZstd, random, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := packBody(tt.alg, tt.data)
+			if (b != nil) != tt.wantPacked {
+				t.Fatalf("packBody returned %v, want packed = %v", b, tt.wantPacked)
+			}
+			if b == nil {
+				return
+			}
+			if len(b.data) >= len(tt.data) {
+				t.Errorf("packed %d bytes into %d", len(tt.data), len(b.data))
+			}
+			if want := tt.alg; want != "" && b.algorithm != want {
+				t.Errorf("algorithm = %q, want %q", b.algorithm, want)
+			}
+			if got := b.read(); !bytes.Equal(got, tt.data) {
+				t.Errorf("read returned %d bytes, not the %d packed", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestValidateCompressAlgorithm(t *testing.T) {
+	tests := []struct {
+		alg     string
+		wantErr bool
+	}{
+		{"", false},
+		{CompressGzip, false},
+		{CompressZstd, false},
+		{"flate", true},
+		{"brotli", true},
+	}
+	for _, tt := range tests {
+		if err := validateCompressAlgorithm(tt.alg); (err != nil) != tt.wantErr {
+			t.Errorf("validateCompressAlgorithm(%q) = %v, want error %v", tt.alg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStoreCompressesFinishedFlows(t *testing.T) {
+	body := []byte(strings.Repeat("compressible ", 1000))
+	small := []byte("short")
+	for _, alg := range []string{CompressGzip, CompressZstd} {
+		t.Run(alg, func(t *testing.T) {
+			s := NewFlowStore(10)
+			s.setCompression(alg, 1024)
+			f := &Flow{
+				ID:       "f1",
+				State:    FlowStateComplete,
+				Request:  &CapturedRequest{Method: "POST", URL: "http://example.test/", Body: small},
+				Response: &CapturedResponse{StatusCode: 200, Body: body},
+			}
+			s.Add(f)
+
+			if f.Response.Body != nil || f.Response.packed == nil {
+				t.Fatalf("response body not compressed: Body %d bytes, packed %v", len(f.Response.Body), f.Response.packed)
+			}
+			if f.Request.packed != nil || !bytes.Equal(f.Request.Body, small) {
+				t.Errorf("request body under the threshold was compressed")
+			}
+			if got := f.Response.ReadBody(); !bytes.Equal(got, body) {
+				t.Errorf("ReadBody returned %d bytes, want %d", len(got), len(body))
+			}
+			if s.Stats().BodyBytes >= int64(len(body)) {
+				t.Errorf("store counts %d bytes, want the compressed size", s.Stats().BodyBytes)
+			}
+
+			data, err := json.Marshal(f.Response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded CapturedResponse
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded.Body, body) {
+				t.Errorf("MarshalJSON body is %d bytes, want %d", len(decoded.Body), len(body))
+			}
+		})
+	}
+}
+
+// TestReadBodyWhileCompressing reads a body while the store swaps it for its
+// compressed form; run with -race.
+func TestReadBodyWhileCompressing(t *testing.T) {
+	body := []byte(strings.Repeat("compressible ", 1000))
+	s := NewFlowStore(10)
+	s.setCompression(CompressZstd, 1024)
+	f := &Flow{
+		ID:       "f1",
+		State:    FlowStateActive,
+		Request:  &CapturedRequest{Method: "GET", URL: "http://example.test/"},
+		Response: &CapturedResponse{StatusCode: 200, Body: body},
+	}
+	s.Add(f)
+	f.State = FlowStateComplete
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				if got := f.Response.ReadBody(); !bytes.Equal(got, body) {
+					t.Errorf("ReadBody returned %d bytes, want %d", len(got), len(body))
+					return
+				}
+			}
+		}()
+	}
+	s.Update(f, FlowEventComplete)
+	wg.Wait()
+	if f.Response.packed == nil {
+		t.Error("body was not compressed")
+	}
+}
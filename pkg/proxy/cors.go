@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS overrides the CORS headers of responses, so a frontend served from
+// one origin can call backends that don't allow it. The upstream's own
+// Access-Control-* headers are replaced, and preflight requests are answered
+// by the proxy without reaching the upstream. The zero value allows any
+// origin, method, and header, without credentials.
+type CORS struct {
+	// Disabled turns the override off, e.g. for one upstream when it is
+	// set globally.
+	Disabled bool
+
+	// AllowOrigins lists the origins allowed to read responses; "*" allows
+	// any. Empty echoes the request's Origin back. Other origins get no
+	// Access-Control-Allow-Origin header, so browsers refuse the response.
+	AllowOrigins []string
+
+	// AllowMethods and AllowHeaders are what preflights allow. Empty allows
+	// whatever the preflight asks for.
+	AllowMethods []string
+	AllowHeaders []string
+
+	// ExposeHeaders are response headers scripts may read.
+	ExposeHeaders []string
+
+	// AllowCredentials lets requests carry cookies and Authorization. The
+	// allowed origin is then always echoed, as browsers reject "*" with it.
+	AllowCredentials bool
+
+	// MaxAge lets browsers cache preflight answers. 0 leaves it to them.
+	MaxAge time.Duration
+}
+
+// cors returns the CORS override for requests to upstream (nil for mocks):
+// its own, or else the global one. Nil means responses pass unchanged.
+func (rt *routing) cors(upstream *Upstream) *CORS {
+	c := rt.opts.CORS
+	if upstream != nil && upstream.CORS != nil {
+		c = upstream.CORS
+	}
+	if c == nil || c.Disabled {
+		return nil
+	}
+	return c
+}
+
+// isPreflight reports whether r is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" if it isn't allowed.
+func (c *CORS) allowOrigin(origin string) string {
+	switch {
+	case len(c.AllowOrigins) == 0 || slices.Contains(c.AllowOrigins, "*"):
+		if origin == "" || (len(c.AllowOrigins) > 0 && !c.AllowCredentials) {
+			return "*"
+		}
+		return origin
+	case slices.Contains(c.AllowOrigins, origin):
+		return origin
+	}
+	return ""
+}
+
+// apply replaces the Access-Control-* headers in h with the ones allowing
+// a request from origin.
+func (c *CORS) apply(h http.Header, origin string) {
+	for k := range h {
+		if strings.HasPrefix(k, "Access-Control-") {
+			delete(h, k)
+		}
+	}
+	allow := c.allowOrigin(origin)
+	if allow == "" {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", allow)
+	if allow != "*" && !slices.Contains(h.Values("Vary"), "Origin") {
+		h.Add("Vary", "Origin")
+	}
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(c.ExposeHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposeHeaders, ", "))
+	}
+}
+
+// preflight builds the proxy's answer to the preflight request r.
+func (c *CORS) preflight(r *http.Request) *CapturedResponse {
+	h := make(http.Header)
+	c.apply(h, r.Header.Get("Origin"))
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		methods := strings.Join(c.AllowMethods, ", ")
+		if methods == "" {
+			methods = r.Header.Get("Access-Control-Request-Method")
+		}
+		h.Set("Access-Control-Allow-Methods", methods)
+		headers := strings.Join(c.AllowHeaders, ", ")
+		if headers == "" {
+			headers = r.Header.Get("Access-Control-Request-Headers")
+		}
+		if headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		// Private Network Access: pages on public sites calling localhost.
+		if r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+			h.Set("Access-Control-Allow-Private-Network", "true")
+		}
+	}
+	return &CapturedResponse{StatusCode: http.StatusNoContent, Headers: h, Proto: "HTTP/1.1"}
+}
+
+// servePreflight answers a CORS preflight for flow without forwarding it.
+// Such flows are tagged "cors-preflight".
+func (e *Engine) servePreflight(w http.ResponseWriter, r *http.Request, flow *Flow) {
+	flow.Tags = append(flow.Tags, "cors-preflight")
+	resp := flow.cors.preflight(r)
+	flow.cors = nil // the answer has its CORS headers; don't rewrite them
+	e.serveResponse(w, flow, resp)
+}
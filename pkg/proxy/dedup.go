@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"bytes"
+	"hash/maphash"
+	"slices"
+)
+
+// Identical bodies, common with polling endpoints, are stored once. When a
+// flow finishes, the store looks each body it holds in memory up in a table
+// keyed by the body's hash; if an equal body is already there, the flow's
+// Body is pointed at that copy, and the table counts its references. A copy
+// leaves the table once no stored flow refers to it. Finished flows' bodies
+// are never modified in place, so sharing them is safe.
+
+// dedupMinBytes is the smallest body worth sharing; below it the table
+// entry costs about as much as the copy it saves.
+const dedupMinBytes = 64
+
+// sharedBody is a body held once for every stored flow with an equal one.
+type sharedBody struct {
+	sum  uint64
+	data []byte
+	refs int
+}
+
+// bodyTable holds the shared bodies by hash. The store guards it with its
+// mutex.
+type bodyTable struct {
+	seed   maphash.Seed
+	bodies map[uint64]*sharedBody
+	refs   int   // bodies of stored flows pointing into the table
+	bytes  int64 // bytes held by the table, once per body
+	saved  int64 // bytes the references beyond the first would have taken
+}
+
+func newBodyTable() *bodyTable {
+	return &bodyTable{seed: maphash.MakeSeed(), bodies: make(map[uint64]*sharedBody)}
+}
+
+// share points *body at the table's copy of its contents, adding it to the
+// table if there is none, and records the reference in *shared. A body
+// that was replaced or spilled since it was last shared gives up its old
+// reference first.
+func (t *bodyTable) share(body *[]byte, shared **sharedBody) {
+	if b := *shared; b != nil {
+		if len(*body) > 0 && &(*body)[0] == &b.data[0] {
+			return
+		}
+		t.release(b)
+		*shared = nil
+	}
+	if len(*body) < dedupMinBytes {
+		return
+	}
+	sum := maphash.Bytes(t.seed, *body)
+	b := t.bodies[sum]
+	switch {
+	case b == nil:
+		b = &sharedBody{sum: sum, data: slices.Clip(*body)}
+		t.bodies[sum] = b
+		t.bytes += int64(len(b.data))
+	case bytes.Equal(b.data, *body):
+		t.saved += int64(len(b.data))
+	default:
+		return // a hash collision; the body keeps its own copy
+	}
+	b.refs++
+	t.refs++
+	bodyMu.Lock() // readers may be reading *body; see ReadBody
+	*body = b.data
+	*shared = b
+	bodyMu.Unlock()
+}
+
+// release drops a reference to b, and b itself once it has none.
+func (t *bodyTable) release(b *sharedBody) {
+	b.refs--
+	t.refs--
+	if b.refs > 0 {
+		t.saved -= int64(len(b.data))
+		return
+	}
+	delete(t.bodies, b.sum)
+	t.bytes -= int64(len(b.data))
+}
+
+// dedup shares f's in-memory bodies through the table. Compressed bodies
+// are shared in their compressed form, which is the same for equal bodies.
+func (s *FlowStore) dedup(f *Flow) {
+	if cr := f.Request; cr != nil {
+		s.bodies.share(heldBody(&cr.Body, cr.packed), &cr.shared)
+	}
+	if r := f.Response; r != nil {
+		s.bodies.share(heldBody(&r.Body, r.packed), &r.shared)
+	}
+}
+
+// heldBody returns the bytes a captured body keeps in memory: its packed
+// form if compressed, else Body.
+func heldBody(body *[]byte, packed *packedBody) *[]byte {
+	if packed != nil {
+		return &packed.data
+	}
+	return body
+}
+
+// undedup gives up f's references to shared bodies.
+func (s *FlowStore) undedup(f *Flow) {
+	if cr := f.Request; cr != nil && cr.shared != nil {
+		s.bodies.release(cr.shared)
+		cr.shared = nil
+	}
+	if r := f.Response; r != nil && r.shared != nil {
+		s.bodies.release(r.shared)
+		r.shared = nil
+	}
+}
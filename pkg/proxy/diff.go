@@ -0,0 +1,360 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Diff operations.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// Change is a single difference between two flows. Path locates it, e.g.
+// "response.status", "response.headers.Content-Type", or, for JSON bodies,
+// "response.body.users[0].name".
+type Change struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	A    any    `json:"a,omitempty"`
+	B    any    `json:"b,omitempty"`
+}
+
+// DiffLine is one line of a text body diff. Op is " " (common), "-" (only
+// in A), or "+" (only in B).
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// FlowDiff is a structured comparison of flow A against flow B.
+type FlowDiff struct {
+	A       string   `json:"a"`
+	B       string   `json:"b"`
+	Equal   bool     `json:"equal"`
+	Changes []Change `json:"changes"`
+
+	// RequestBody and ResponseBody hold line diffs for bodies that differ
+	// and are not both JSON (JSON bodies are diffed structurally in Changes).
+	RequestBody  []DiffLine `json:"requestBody,omitempty"`
+	ResponseBody []DiffLine `json:"responseBody,omitempty"`
+
+	// RequestHeaders and ResponseHeaders hold line diffs of the headers, as
+	// sorted "Name: value" lines. They are only filled in with
+	// DiffOptions.Lines.
+	RequestHeaders  []DiffLine `json:"requestHeaders,omitempty"`
+	ResponseHeaders []DiffLine `json:"responseHeaders,omitempty"`
+}
+
+// DiffOptions tunes a comparison.
+type DiffOptions struct {
+	// IgnoreHeaders lists headers that are expected to differ (e.g. Date).
+	IgnoreHeaders []string
+
+	// Lines line-diffs the headers and all text bodies, JSON bodies
+	// pretty-printed, including the lines both flows share, for a
+	// side-by-side view. Changes are reported as usual.
+	Lines bool
+}
+
+// maxLineDiff bounds the line-diff table (lines in A × lines in B). Larger
+// bodies are reported as a whole replacement.
+const maxLineDiff = 4_000_000
+
+// Diff compares two stored flows.
+func (e *Engine) Diff(aID, bID string, opts DiffOptions) (*FlowDiff, error) {
+	a := e.store.Get(aID)
+	if a == nil {
+		return nil, fmt.Errorf("flow %q not found", aID)
+	}
+	b := e.store.Get(bID)
+	if b == nil {
+		return nil, fmt.Errorf("flow %q not found", bID)
+	}
+	return DiffFlows(a, b, opts), nil
+}
+
+// DiffFlows compares the requests and responses of a and b.
+func DiffFlows(a, b *Flow, opts DiffOptions) *FlowDiff {
+	d := &FlowDiff{A: a.ID, B: b.ID, Changes: []Change{}}
+	ignore := make(map[string]bool, len(opts.IgnoreHeaders))
+	for _, h := range opts.IgnoreHeaders {
+		ignore[http.CanonicalHeaderKey(h)] = true
+	}
+
+	switch ra, rb := a.Request, b.Request; {
+	case ra == nil && rb == nil:
+	case ra == nil || rb == nil:
+		d.Changes = append(d.Changes, presenceChange("request", ra != nil, rb != nil))
+	default:
+		d.changed("request.method", ra.Method, rb.Method)
+		d.changed("request.url", ra.URL, rb.URL)
+		d.diffHeaders("request.headers", ra.Headers, rb.Headers, ignore)
+		d.RequestBody = d.diffBody("request.body", ra.ReadBody(), rb.ReadBody(), ra.Headers, rb.Headers)
+		if opts.Lines {
+			d.RequestHeaders = diffLines(headerLines(ra.Headers, ignore), headerLines(rb.Headers, ignore))
+			d.RequestBody = bodyLines(ra.ReadBody(), rb.ReadBody())
+		}
+	}
+
+	switch ra, rb := a.Response, b.Response; {
+	case ra == nil && rb == nil:
+	case ra == nil || rb == nil:
+		d.Changes = append(d.Changes, presenceChange("response", ra != nil, rb != nil))
+	default:
+		d.changed("response.status", ra.StatusCode, rb.StatusCode)
+		d.diffHeaders("response.headers", ra.Headers, rb.Headers, ignore)
+		d.ResponseBody = d.diffBody("response.body", ra.ReadBody(), rb.ReadBody(), ra.Headers, rb.Headers)
+		if opts.Lines {
+			d.ResponseHeaders = diffLines(headerLines(ra.Headers, ignore), headerLines(rb.Headers, ignore))
+			d.ResponseBody = bodyLines(ra.ReadBody(), rb.ReadBody())
+		}
+	}
+
+	d.changed("error", a.Error, b.Error)
+	d.Equal = len(d.Changes) == 0
+	return d
+}
+
+func presenceChange(path string, inA, inB bool) Change {
+	if inA {
+		return Change{Path: path, Op: DiffRemoved}
+	}
+	return Change{Path: path, Op: DiffAdded}
+}
+
+// changed records a change if a and b differ.
+func (d *FlowDiff) changed(path string, a, b any) {
+	if a != b {
+		d.Changes = append(d.Changes, Change{Path: path, Op: DiffChanged, A: a, B: b})
+	}
+}
+
+func (d *FlowDiff) diffHeaders(path string, a, b http.Header, ignore map[string]bool) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if ignore[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		va, inA := a[k]
+		vb, inB := b[k]
+		p := path + "." + k
+		switch {
+		case !inB:
+			d.Changes = append(d.Changes, Change{Path: p, Op: DiffRemoved, A: strings.Join(va, ", ")})
+		case !inA:
+			d.Changes = append(d.Changes, Change{Path: p, Op: DiffAdded, B: strings.Join(vb, ", ")})
+		case !slices.Equal(va, vb):
+			d.Changes = append(d.Changes, Change{Path: p, Op: DiffChanged, A: strings.Join(va, ", "), B: strings.Join(vb, ", ")})
+		}
+	}
+}
+
+// diffBody compares two bodies. JSON bodies are compared structurally;
+// anything else that differs produces one Change plus a line diff.
+func (d *FlowDiff) diffBody(path string, a, b []byte, ha, hb http.Header) []DiffLine {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	if isJSONType(ha) || isJSONType(hb) {
+		ja, errA := decodeJSON(a)
+		jb, errB := decodeJSON(b)
+		if errA == nil && errB == nil {
+			diffJSON(path, ja, jb, &d.Changes)
+			return nil
+		}
+	}
+
+	if !utf8.Valid(a) || !utf8.Valid(b) {
+		d.Changes = append(d.Changes, Change{Path: path, Op: DiffChanged,
+			A: fmt.Sprintf("%d bytes (binary)", len(a)), B: fmt.Sprintf("%d bytes (binary)", len(b))})
+		return nil
+	}
+	d.Changes = append(d.Changes, Change{Path: path, Op: DiffChanged,
+		A: fmt.Sprintf("%d bytes", len(a)), B: fmt.Sprintf("%d bytes", len(b))})
+	return diffLines(splitLines(string(a)), splitLines(string(b)))
+}
+
+// headerLines renders h as sorted "Name: value" lines, one per value.
+func headerLines(h http.Header, ignore map[string]bool) []string {
+	var lines []string
+	for k, vv := range h {
+		if ignore[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		for _, v := range vv {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// bodyLines line-diffs two text bodies, indenting JSON so that structural
+// changes line up. Binary bodies have no lines.
+func bodyLines(a, b []byte) []DiffLine {
+	if !utf8.Valid(a) || !utf8.Valid(b) {
+		return nil
+	}
+	return diffLines(splitLines(indentJSON(a)), splitLines(indentJSON(b)))
+}
+
+// indentJSON returns data indented if it is JSON, and as is otherwise.
+func indentJSON(data []byte) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, data, "", "  ") != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
+func isJSONType(h http.Header) bool {
+	return strings.Contains(strings.ToLower(h.Get("Content-Type")), "json")
+}
+
+func decodeJSON(data []byte) (any, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // compare numbers exactly
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// diffJSON appends the structural differences between a and b to out.
+func diffJSON(path string, a, b any, out *[]Change) {
+	switch va := a.(type) {
+	case map[string]any:
+		vb, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(va)+len(vb))
+		for k := range va {
+			keys = append(keys, k)
+		}
+		for k := range vb {
+			if _, ok := va[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			x, inA := va[k]
+			y, inB := vb[k]
+			p := path + "." + k
+			switch {
+			case !inB:
+				*out = append(*out, Change{Path: p, Op: DiffRemoved, A: x})
+			case !inA:
+				*out = append(*out, Change{Path: p, Op: DiffAdded, B: y})
+			default:
+				diffJSON(p, x, y, out)
+			}
+		}
+		return
+	case []any:
+		vb, ok := b.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(va), len(vb)); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(vb):
+				*out = append(*out, Change{Path: p, Op: DiffRemoved, A: va[i]})
+			case i >= len(va):
+				*out = append(*out, Change{Path: p, Op: DiffAdded, B: vb[i]})
+			default:
+				diffJSON(p, va[i], vb[i], out)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, Change{Path: path, Op: DiffChanged, A: a, B: b})
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns a line diff of a and b based on their longest common
+// subsequence.
+func diffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	if n*m > maxLineDiff {
+		out := make([]DiffLine, 0, n+m)
+		for _, l := range a {
+			out = append(out, DiffLine{Op: "-", Text: l})
+		}
+		for _, l := range b {
+			out = append(out, DiffLine{Op: "+", Text: l})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	out := make([]DiffLine, 0, max(n, m))
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, DiffLine{Op: "+", Text: b[j]})
+	}
+	return out
+}
@@ -3,65 +3,239 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
+	"math"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/fidiego/http-proxy/pkg/certs"
 )
 
 type contextKey string
 
-const flowContextKey contextKey = "flow"
+const (
+	flowContextKey   contextKey = "flow"
+	targetContextKey contextKey = "target"
+)
 
 // Engine is the core proxy. It routes requests to upstreams, captures flows,
 // and dispatches them through the addon pipeline.
 type Engine struct {
-	store   *FlowStore
-	addons  *AddonManager
+	store  *FlowStore
+	addons *AddonManager
+	opts   Options // as started; listener settings never change
+	server *http.Server
+	webSrv *http.Server
+
+	// routing holds the reloadable configuration (see Reload).
+	routing      atomic.Pointer[routing]
+	reloadMu     sync.Mutex // guards configSource
+	configSource func() (Options, error)
+
+	intercept   interceptConfig
+	breakpoints breakpointTable
+
+	overrides overrideTable
+	network   networkTable
+	jobs      jobTable
+	schedules scheduleTable
+	views     viewTable
+	procs     processTable // upstream commands, as started
+	live      liveReloadHub
+	alerts    alerter
+	stats     *statsCollector
+	shadows   shadowTable
+	mirrors   chan struct{} // one slot per mirrored request in flight
+	mitmCA    *certs.CA     // signs tunnel certificates in forward mode with MITM
+	inflight  atomic.Int64  // requests being handled, counted by ServeHTTP
+	tunnels   tunnelServers // servers inside intercepted CONNECT tunnels
+	logs      logBuffer     // see LogWriter
+	bound     boundAddrs    // see Listen and Info
+}
+
+// routing is the part of the engine's configuration that can be swapped at
+// runtime. Each request loads it once, so in-flight requests finish on the
+// configuration they started with.
+type routing struct {
+	opts    Options
 	router  *Router
 	proxies map[string]*httputil.ReverseProxy
-	opts    Options
-	server  *http.Server
-	webSrv  *http.Server
+	mocks   []Mock
+
+	transforms      []ResponseTransform
+	pathTemplates   []pathTemplate
+	networkProfiles map[string]NetworkProfile
 }
 
 // New creates a new Engine with the given options.
 func New(opts Options) (*Engine, error) {
 	opts.setDefaults()
+	if err := validateMode(opts.Mode); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		store:  NewFlowStore(opts.MaxFlows),
+		addons: NewAddonManager(),
+		opts:   opts,
+		stats:  newStatsCollector(),
+
+		mirrors: make(chan struct{}, maxMirrorsInFlight),
+	}
+	e.stats.normalize = e.NormalizePath
+	e.addons.Add(e.stats, overrideAddon{e}, authAddon{}, shadowAddon{e}, retryAddon{}, liveReloadAddon{e})
+	for _, b := range opts.Breakpoints {
+		if _, err := e.AddBreakpoint(b); err != nil {
+			return nil, err
+		}
+	}
+	rt, err := e.buildRouting(opts)
+	if err != nil {
+		return nil, err
+	}
+	e.routing.Store(rt)
+	e.network.reset(rt.networkProfiles, opts)
+	if err := e.prepareProcesses(rt.router.upstreams); err != nil {
+		return nil, err
+	}
+	if opts.MaxStoreBytes < 0 || opts.SpillThreshold < 0 || opts.CompressThreshold < 0 {
+		return nil, fmt.Errorf("max_store_bytes, spill_threshold, and compress_threshold must be >= 0")
+	}
+	if err := validateCompressAlgorithm(opts.CompressAlgorithm); err != nil {
+		return nil, err
+	}
+	var spillDir string
+	if opts.SpillThreshold > 0 {
+		dir, err := os.MkdirTemp(opts.SpillDir, "http-proxy-bodies-")
+		if err != nil {
+			return nil, fmt.Errorf("spill directory: %w", err)
+		}
+		spillDir = dir
+	}
+	e.store.setLimits(opts.MaxStoreBytes, spillDir, opts.SpillThreshold)
+	e.store.setCompression(opts.CompressAlgorithm, opts.CompressThreshold)
+
+	return e, nil
+}
 
+// buildRouting validates opts and builds the router, reverse proxies, and mocks.
+func (e *Engine) buildRouting(opts Options) (*routing, error) {
 	router, err := NewRouter(opts.Upstreams)
 	if err != nil {
 		return nil, err
 	}
+	mocks, err := validateMocks(opts.Mocks)
+	if err != nil {
+		return nil, err
+	}
+	transforms, err := validateTransforms(opts.Transforms)
+	if err != nil {
+		return nil, err
+	}
+	pathTemplates, err := compilePathTemplates(opts.PathTemplates)
+	if err != nil {
+		return nil, err
+	}
+	networkProfiles, err := buildNetworkProfiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, ig := range opts.Ignore {
+		if ig.Match == nil {
+			return nil, fmt.Errorf("ignore rule %q has no matcher", ig.Filter)
+		}
+	}
+	jobNames := make(map[string]bool)
+	for i := range opts.Jobs {
+		if err := opts.Jobs[i].validate(); err != nil {
+			return nil, err
+		}
+		if jobNames[opts.Jobs[i].Name] {
+			return nil, fmt.Errorf("duplicate scheduled job %q", opts.Jobs[i].Name)
+		}
+		jobNames[opts.Jobs[i].Name] = true
+	}
+	if opts.Record != nil && opts.Record.Match == nil {
+		return nil, fmt.Errorf("record filter %q has no matcher", opts.Record.Filter)
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, fmt.Errorf("sample_rate must be between 0 and 1, got %g", opts.SampleRate)
+	}
+	if opts.Alerts != nil {
+		if err := opts.Alerts.validate("all upstreams"); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateCaptureRules(opts.Capture, "all upstreams"); err != nil {
+		return nil, err
+	}
+	if opts.LiveReload != nil {
+		lr := *opts.LiveReload
+		if err := lr.validate(opts.Upstreams); err != nil {
+			return nil, err
+		}
+		opts.LiveReload = &lr
+	}
 
-	e := &Engine{
-		store:   NewFlowStore(opts.MaxFlows),
-		addons:  NewAddonManager(),
+	rt := &routing{
+		opts:    opts,
 		router:  router,
 		proxies: make(map[string]*httputil.ReverseProxy),
-		opts:    opts,
-	}
+		mocks:   mocks,
 
+		transforms:      transforms,
+		pathTemplates:   pathTemplates,
+		networkProfiles: networkProfiles,
+	}
 	for i := range router.upstreams {
 		u := &router.upstreams[i]
-		p := &httputil.ReverseProxy{
-			Director:       Director(u),
-			ModifyResponse: e.modifyResponse,
-			ErrorHandler:   e.errorHandler,
-			FlushInterval:  -1, // flush immediately for streaming support
-		}
-		e.proxies[u.Name] = p
+		rt.proxies[u.Name] = e.newReverseProxy(u)
 	}
+	return rt, nil
+}
 
-	return e, nil
+// newReverseProxy creates the reverse proxy that forwards to u.
+func (e *Engine) newReverseProxy(u *Upstream) *httputil.ReverseProxy {
+	p := &httputil.ReverseProxy{
+		Director:       Director(u),
+		ModifyResponse: e.modifyResponse,
+		ErrorHandler:   e.errorHandler,
+		FlushInterval:  -1, // flush immediately for streaming support
+	}
+	if u.transport != nil {
+		p.Transport = u.transport
+	}
+	if u.HoldTimeout > 0 {
+		next := p.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		p.Transport = &holdTransport{next: next, e: e, upstream: u.Name, timeout: u.HoldTimeout, health: u.HealthCheck}
+	}
+	if u.Retry != nil {
+		next := p.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		p.Transport = &retryTransport{next: next}
+	}
+	return p
 }
 
-// Options returns the resolved options the engine was started with.
-func (e *Engine) Options() Options { return e.opts }
+// Options returns the engine's current options, including any reloaded changes.
+func (e *Engine) Options() Options { return e.routing.Load().opts }
 
 // Store returns the flow store (read-only access for UI components).
 func (e *Engine) Store() *FlowStore { return e.store }
@@ -70,51 +244,218 @@ func (e *Engine) Store() *FlowStore { return e.store }
 func (e *Engine) Addons() *AddonManager { return e.addons }
 
 // Router returns the router (for UI display of configured upstreams).
-func (e *Engine) Router() *Router { return e.router }
+func (e *Engine) Router() *Router { return e.routing.Load().router }
+
+// Mocks returns a copy of the configured mock responses.
+func (e *Engine) Mocks() []Mock {
+	mocks := e.routing.Load().mocks
+	cp := make([]Mock, len(mocks))
+	copy(cp, mocks)
+	return cp
+}
 
 // Start runs the proxy and (optionally) the web UI server until ctx is cancelled.
 func (e *Engine) Start(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 
 	e.server = &http.Server{
-		Addr:    e.opts.ListenAddr,
-		Handler: e,
+		Handler:   e,
+		Protocols: listenerProtocols(e.opts.HTTP2),
 	}
 
-	g.Go(func() error {
-		if err := e.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			return fmt.Errorf("proxy server: %w", err)
+	if e.opts.TLS {
+		tlsCfg, err := e.tlsConfig()
+		if err != nil {
+			return err
 		}
+		e.server.TLSConfig = tlsCfg
+	}
+	if e.opts.Mode == ModeForward && e.opts.MITM {
+		ca, err := e.CA()
+		if err != nil {
+			return fmt.Errorf("local CA: %w", err)
+		}
+		e.mitmCA = ca
+	}
+
+	if err := e.Listen(); err != nil {
+		return err
+	}
+	for _, ln := range e.listeners() {
+		g.Go(func() error {
+			var err error
+			if e.opts.TLS {
+				err = e.server.ServeTLS(ln, "", "")
+			} else {
+				err = e.server.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				return fmt.Errorf("proxy server on %s: %w", ln.Addr(), err)
+			}
+			return nil
+		})
+	}
+
+	// Upstream processes outlive ctx until the drain is over, so the
+	// requests it waits for can still reach them.
+	procCtx, stopProcs := context.WithCancel(context.WithoutCancel(ctx))
+	g.Go(func() error {
+		e.runProcesses(procCtx)
+		return nil
+	})
+
+	g.Go(func() error {
+		e.runSchedules(ctx)
+		return nil
+	})
+
+	g.Go(func() error {
+		e.watchLiveReload(ctx)
 		return nil
 	})
 
 	g.Go(func() error {
 		<-ctx.Done()
-		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		_ = e.server.Shutdown(shutCtx)
+		e.drain()
+		stopProcs()
 		return nil
 	})
 
-	return g.Wait()
+	err := g.Wait()
+	if dir := e.store.spillDir; dir != "" {
+		_ = os.RemoveAll(dir)
+	}
+	return err
+}
+
+// listenerProtocols returns the protocols served by the proxy listener.
+func listenerProtocols(http2 bool) *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	if http2 {
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+	}
+	return p
+}
+
+// h2cTransport returns a transport that speaks cleartext HTTP/2 only.
+func h2cTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	p := new(http.Protocols)
+	p.SetUnencryptedHTTP2(true)
+	t.Protocols = p
+	return t
+}
+
+// CA returns the local certificate authority used for the HTTPS listener,
+// creating it in the configured cert directory if needed.
+func (e *Engine) CA() (*certs.CA, error) {
+	dir := e.opts.CertDir
+	if dir == "" {
+		dir = certs.DefaultDir()
+	}
+	return certs.LoadOrCreateCA(dir)
+}
+
+// tlsConfig builds the listener TLS config from a static key pair or the local CA.
+func (e *Engine) tlsConfig() (*tls.Config, error) {
+	if e.opts.TLSCertFile != "" || e.opts.TLSKeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(e.opts.TLSCertFile, e.opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS key pair: %w", err)
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{pair}}, nil
+	}
+	ca, err := e.CA()
+	if err != nil {
+		return nil, fmt.Errorf("local CA: %w", err)
+	}
+	return ca.TLSConfig(), nil
 }
 
 // ServeHTTP implements http.Handler. It is the main proxy entry point.
 func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	upstream := e.router.Match(r)
-	if upstream == nil {
-		http.Error(w, "no upstream matched", http.StatusBadGateway)
+	e.inflight.Add(1)
+	defer e.inflight.Add(-1)
+	if e.opts.Mode == ModeForward {
+		e.serveForward(w, r)
+		return
+	}
+	rt := e.routing.Load()
+	if lr := rt.opts.LiveReload; lr != nil && r.URL.Path == lr.Path {
+		e.serveLiveReload(w, r)
 		return
 	}
+	mock := rt.matchMock(r)
+	upstream := rt.router.Match(r)
+	// Responder addons, such as fixtures, may answer paths nothing routes.
+	if upstream == nil && mock == nil && !e.addons.responds() {
+		e.rejectRequest(w, r, http.StatusBadGateway, rejectNoRoute, errNoRoute)
+		return
+	}
+	var proxy *httputil.ReverseProxy
+	if upstream != nil {
+		proxy = rt.proxies[upstream.Name]
+	}
+	e.serve(w, r, rt, mock, upstream, proxy)
+}
 
-	flow := e.newFlow(r, upstream)
-	e.store.Add(flow)
+// serve runs a request through capture, hooks, intercept, mocks, and
+// responders, then forwards it to upstream via proxy. mock or upstream may
+// be nil, and both are when only a responder can answer.
+func (e *Engine) serve(w http.ResponseWriter, r *http.Request, rt *routing, mock *Mock, upstream *Upstream, proxy *httputil.ReverseProxy) {
+	upstreamName := "mock"
+	if upstream != nil {
+		upstreamName = upstream.Name
+	}
+	flow := e.newFlow(r, upstreamName)
+	flow.cors = rt.cors(upstream)
+	flow.capture = rt.captureRules(upstream)
+	if upstream != nil {
+		flow.auth = upstream.Auth
+		flow.retryPolicy = upstream.Retry
+	}
+	if mock != nil {
+		flow.Tags = append(flow.Tags, "mock", "mock:"+mock.Name)
+	}
+	// An ignored flow goes through the same pipeline but is never stored or
+	// broadcast, nor intercepted, since no UI could release it. Flows left
+	// out by sampling are treated the same, but still count in the stats.
+	// Flows the record filter doesn't match yet are held back likewise until
+	// they finish, when the store checks the filter again.
+	ignored := rt.ignores(flow)
+	if !ignored && !rt.sampled(upstream) {
+		ignored = true
+		flow.sampledOut = true
+	}
+	if !ignored && !rt.records(flow) {
+		ignored = true
+		flow.record = rt.opts.Record.Match
+	}
+	if ignored {
+		flow.dropped = true
+		flow.excluded = true
+	} else {
+		e.store.Add(flow)
+	}
 
-	if err := captureRequestBody(flow, r, e.opts.MaxBodySize); err != nil {
-		flow.State = FlowStateError
-		flow.Error = fmt.Sprintf("capture request: %v", err)
-		e.store.Update(flow, FlowEventError)
-		http.Error(w, "internal proxy error", http.StatusInternalServerError)
+	w, r, reset := e.simulateNetwork(w, r, flow, upstream)
+	if reset {
+		panic(http.ErrAbortHandler) // drops the connection without a response
+	}
+	if !limitRequestBody(w, r, rt.opts.MaxRequestSize) {
+		e.rejectTooLarge(w, flow, rt.opts.MaxRequestSize)
+		return
+	}
+	limit := captureLimit(flow, r.Header.Get("Content-Type"), 0, rt.opts.MaxBodySize)
+	if err := captureRequestBody(flow, r, limit); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			e.rejectTooLarge(w, flow, tooLarge.Limit)
+			return
+		}
+		e.failRequest(w, flow, http.StatusInternalServerError, rejectCaptureFailed, fmt.Errorf("capture request: %w", err))
 		return
 	}
 
@@ -122,20 +463,133 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	e.addons.FireRequest(flow)
 
-	if flow.killed {
+	flow.breakable = !ignored
+	if !ignored && !flow.Killed() && (e.shouldIntercept(flow) || e.breaksAt(flow, BreakRequest)) {
+		e.pause(r, flow)
+	}
+	if !flow.Killed() {
+		// Request hooks and the intercept editor work on flow.Request; carry
+		// their changes over to what is forwarded.
+		if err := applyCapturedRequest(r, flow.Request); err != nil {
+			flow.Kill()
+			flow.Error = fmt.Sprintf("apply edited request: %v", err)
+		}
+	}
+
+	if flow.Killed() {
+		flow.Timestamps.ResponseDone = time.Now()
+		e.store.Update(flow, FlowEventError)
 		http.Error(w, "flow killed", http.StatusBadGateway)
 		return
 	}
 
-	// Attach the flow to the request context so modifyResponse can find it.
-	r = r.WithContext(context.WithValue(r.Context(), flowContextKey, flow))
+	if flow.cors != nil && isPreflight(r) {
+		e.servePreflight(w, r, flow)
+		return
+	}
+	if mock != nil {
+		e.serveMock(w, flow, mock)
+		return
+	}
+	if resp := e.addons.Respond(flow); resp != nil {
+		e.serveResponse(w, flow, resp)
+		return
+	}
+	if upstream == nil {
+		e.failRequest(w, flow, http.StatusBadGateway, rejectNoRoute, errNoRoute)
+		return
+	}
+	if e.rateLimited(w, flow, upstream) || e.passthroughRefused(w, r, flow, upstream) ||
+		e.processNotReady(w, r, flow, upstream) {
+		return
+	}
 
-	proxy, ok := e.proxies[upstream.Name]
-	if !ok {
+	if proxy == nil {
 		http.Error(w, "upstream not configured", http.StatusBadGateway)
 		return
 	}
-	proxy.ServeHTTP(w, r)
+	e.mirror(flow, upstream, !ignored)
+	e.store.Update(flow, FlowEventRequest)
+	proxy.ServeHTTP(w, e.bindFlow(r, flow, upstream))
+}
+
+// Excludes reports whether the ignore rules or the record filter leave a
+// finished flow, such as one loaded from a journal, out of the store.
+func (e *Engine) Excludes(flow *Flow) bool {
+	rt := e.routing.Load()
+	return rt.ignores(flow) || !rt.records(flow)
+}
+
+// ignores reports whether flow matches an ignore rule.
+func (rt *routing) ignores(flow *Flow) bool {
+	for _, ig := range rt.opts.Ignore {
+		if ig.Match(flow) {
+			return true
+		}
+	}
+	return false
+}
+
+// records reports whether flow matches the record filter, if there is one.
+func (rt *routing) records(flow *Flow) bool {
+	return rt.opts.Record == nil || rt.opts.Record.Match(flow)
+}
+
+// sampled reports whether a flow to upstream (nil for mocks) is to be
+// stored, drawing against its sample rate, or else the global one.
+func (rt *routing) sampled(upstream *Upstream) bool {
+	rate := rt.opts.SampleRate
+	if upstream != nil && upstream.SampleRate > 0 {
+		rate = upstream.SampleRate
+	}
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// rateLimited answers flow with a 429 and reports true if upstream's rate
+// limit is exhausted. Limited flows are tagged "rate-limited".
+func (e *Engine) rateLimited(w http.ResponseWriter, flow *Flow, upstream *Upstream) bool {
+	ok, wait := upstream.allow()
+	if ok {
+		return false
+	}
+	flow.Tags = append(flow.Tags, "rate-limited")
+	retry := int(math.Ceil(wait.Seconds()))
+	e.serveResponse(w, flow, &CapturedResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Headers: http.Header{
+			"Content-Type": {"text/plain; charset=utf-8"},
+			"Retry-After":  {strconv.Itoa(retry)},
+		},
+		Body:  []byte(fmt.Sprintf("rate limit exceeded for upstream %q\n", upstream.Name)),
+		Proto: "HTTP/1.1",
+	})
+	return true
+}
+
+// bindFlow picks the upstream target for r and attaches it and the flow to
+// the request context, so the director and modifyResponse can find them.
+// Flows on weighted upstreams are tagged with the chosen target; with cookie
+// affinity, the pinning cookie travels in the context too.
+func (e *Engine) bindFlow(r *http.Request, flow *Flow, upstream *Upstream) *http.Request {
+	var target *Target
+	var pin *http.Cookie
+	if upstream.Passthrough() {
+		// Already checked by passthroughRefused.
+		target, _ = upstream.passthroughTarget(r)
+	} else {
+		target, pin = upstream.pickTarget(r)
+	}
+	if len(upstream.Targets) > 1 {
+		flow.Tags = append(flow.Tags, "target:"+target.URL)
+	}
+	ctx := context.WithValue(r.Context(), flowContextKey, flow)
+	ctx = context.WithValue(ctx, targetContextKey, target)
+	if pin != nil {
+		ctx = context.WithValue(ctx, affinityContextKey, pin)
+	}
+	ctx = withTrace(ctx, flow)
+	flow.alerts = e.routing.Load().alerts(upstream)
+	return r.WithContext(ctx)
 }
 
 // modifyResponse is called by the reverse proxy with the upstream response.
@@ -146,41 +600,61 @@ func (e *Engine) modifyResponse(resp *http.Response) error {
 	}
 
 	flow.Timestamps.ResponseStart = time.Now()
-
-	if err := captureResponseBody(flow, resp, e.opts.MaxBodySize); err != nil {
-		// Don't fail the proxy; just mark the body capture as failed.
-		flow.Response.Body = nil
-		flow.Response.BodyTruncated = true
+	if pin, ok := resp.Request.Context().Value(affinityContextKey).(*http.Cookie); ok {
+		resp.Header.Add("Set-Cookie", pin.String())
 	}
-
-	flow.Timestamps.ResponseDone = time.Now()
-	flow.State = FlowStateComplete
-
-	e.addons.FireResponse(flow)
-	e.addons.FireComplete(flow)
-	e.store.Update(flow, FlowEventComplete)
-
+	if flow.cors != nil {
+		flow.cors.apply(resp.Header, flow.Request.Headers.Get("Origin"))
+	}
+	e.transformResponse(flow, resp)
+	e.rewriteResponse(flow, resp)
+	if err := e.breakResponse(flow, resp); err != nil {
+		return err
+	}
+	limit := captureLimit(flow, resp.Header.Get("Content-Type"), resp.StatusCode, e.routing.Load().opts.MaxBodySize)
+	e.captureResponse(flow, resp, limit)
 	return nil
 }
 
 // errorHandler is called by the reverse proxy when the upstream is unreachable.
 func (e *Engine) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	flow, ok := r.Context().Value(flowContextKey).(*Flow)
+	if ok && errors.Is(err, errFlowKilled) {
+		flow.Timestamps.ResponseDone = time.Now()
+		e.store.Update(flow, FlowEventError)
+		http.Error(w, "flow killed", http.StatusBadGateway)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if ok && errors.As(err, &tooLarge) {
+		// The body outgrew max_request_size while streaming upstream.
+		e.rejectTooLarge(w, flow, tooLarge.Limit)
+		return
+	}
 	if ok {
+		if resp := e.addons.Fallback(flow, err); resp != nil {
+			e.serveResponse(w, flow, resp)
+			return
+		}
 		flow.State = FlowStateError
 		flow.Error = err.Error()
 		flow.Timestamps.ResponseDone = time.Now()
+		recordTimings(flow)
+		e.checkAlerts(flow)
 		e.addons.FireError(flow, err)
 		e.store.Update(flow, FlowEventError)
+		if flow.cors != nil {
+			flow.cors.apply(w.Header(), flow.Request.Headers.Get("Origin"))
+		}
 	}
 	http.Error(w, fmt.Sprintf("upstream error: %v", err), http.StatusBadGateway)
 }
 
 // newFlow builds a Flow skeleton from the incoming request.
-func (e *Engine) newFlow(r *http.Request, upstream *Upstream) *Flow {
+func (e *Engine) newFlow(r *http.Request, upstreamName string) *Flow {
 	f := &Flow{
 		ID:       uuid.New().String(),
-		Upstream: upstream.Name,
+		Upstream: upstreamName,
 		State:    FlowStateActive,
 	}
 	f.Timestamps.Created = time.Now()
@@ -191,13 +665,48 @@ func (e *Engine) newFlow(r *http.Request, upstream *Upstream) *Flow {
 		Host:    r.Host,
 		Headers: r.Header.Clone(),
 		Proto:   r.Proto,
+
+		RemoteAddr: r.RemoteAddr,
 	}
+	f.Request.HeadersSize = f.Request.headerBytes()
 	return f
 }
 
+// ReplayOptions customises a replay.
+type ReplayOptions struct {
+	// Edit is applied to a copy of the captured request before it is sent.
+	Edit RequestEdit
+
+	// Target overrides routing: either the name of a configured upstream or
+	// an absolute base URL (e.g. "http://localhost:8085"). Empty means the
+	// request is routed as usual.
+	Target string
+
+	// Tags are added to the replayed flow.
+	Tags []string
+
+	// ReplayOf is the ID of the flow being replayed, set by ReplayWith. The
+	// new flow's ReplayOf is set to it, and it is added to that flow's
+	// Replays if it is still stored.
+	ReplayOf string
+
+	// Assert, if set, is checked against the replay's response, and the
+	// result recorded in the flow's Assertions.
+	Assert *Assertions
+
+	discard bool // send without storing the flow, for uncaptured mirrors; it is still returned
+}
+
 // Replay re-sends the request from a captured flow through the proxy engine.
 // The replayed flow is stored as a new entry and returned.
 func (e *Engine) Replay(flowID string) (*Flow, error) {
+	return e.ReplayWith(flowID, ReplayOptions{})
+}
+
+// ReplayWith is like Replay but lets the caller edit the request or send it
+// somewhere other than where it was routed originally. The original flow is
+// left untouched.
+func (e *Engine) ReplayWith(flowID string, ro ReplayOptions) (*Flow, error) {
 	original := e.store.Get(flowID)
 	if original == nil {
 		return nil, fmt.Errorf("flow %q not found", flowID)
@@ -205,99 +714,113 @@ func (e *Engine) Replay(flowID string) (*Flow, error) {
 	if original.Request == nil {
 		return nil, fmt.Errorf("flow %q has no captured request", flowID)
 	}
+	ro.Tags = append([]string{"replay", "replay:" + flowID}, ro.Tags...)
+	ro.ReplayOf = flowID
+	return e.ReplayRequest(original.Request, ro)
+}
 
-	req, err := rebuildRequest(original.Request)
+// ReplayRequest sends a captured request as a new flow. The request need not
+// come from the store (e.g. it may have been loaded from a session file). If
+// ro.Edit changes anything, the flow is also tagged "edited".
+func (e *Engine) ReplayRequest(cr *CapturedRequest, ro ReplayOptions) (*Flow, error) {
+	if err := ro.Assert.Validate(); err != nil {
+		return nil, err
+	}
+	tags := ro.Tags
+	if !ro.Edit.IsZero() {
+		cr = cloneRequest(cr)
+		if err := ro.Edit.Apply(cr); err != nil {
+			return nil, err
+		}
+		tags = append(tags, "edited")
+	}
+
+	req, err := rebuildRequest(cr)
 	if err != nil {
 		return nil, fmt.Errorf("rebuild request: %w", err)
 	}
 
-	upstream := e.router.Match(req)
-	if upstream == nil {
-		return nil, fmt.Errorf("no upstream for path %q", req.URL.Path)
+	upstream, proxy, err := e.replayUpstream(req, ro.Target)
+	if err != nil {
+		return nil, err
 	}
 
-	flow := e.newFlow(req, upstream)
-	flow.Tags = append(flow.Tags, "replay", "replay:"+flowID)
-	flow.Request = cloneRequest(original.Request)
-	e.store.Add(flow)
+	flow := e.newFlow(req, upstream.Name)
+	flow.Tags = append(flow.Tags, tags...)
+	flow.ReplayOf = ro.ReplayOf
+	flow.Request = cloneRequest(cr)
+	flow.Request.Size = int64(len(flow.Request.Body))
+	flow.Request.HeadersSize = flow.Request.headerBytes()
+	if ro.discard {
+		flow.dropped = true
+		flow.excluded = true
+	} else {
+		e.store.Add(flow)
+	}
+	if ro.ReplayOf != "" {
+		e.store.linkReplay(ro.ReplayOf, flow.ID)
+	}
 
 	// Forward via the upstream proxy, capturing response into a recorder.
 	rec := &responseRecorder{header: make(http.Header), code: 200}
-	req = req.WithContext(context.WithValue(req.Context(), flowContextKey, flow))
-	proxy, ok := e.proxies[upstream.Name]
-	if !ok {
-		return nil, fmt.Errorf("upstream %q not configured", upstream.Name)
+	if !e.rateLimited(rec, flow, upstream) && !e.passthroughRefused(rec, req, flow, upstream) {
+		proxy.ServeHTTP(rec, e.bindFlow(req, flow, upstream))
 	}
-	proxy.ServeHTTP(rec, req)
-
-	return e.store.Get(flow.ID), nil
-}
-
-// captureRequestBody reads up to maxBytes of the request body and stores it on the flow.
-func captureRequestBody(flow *Flow, r *http.Request, maxBytes int64) error {
-	if r.Body == nil || r.Body == http.NoBody {
-		return nil
+	if !ro.Assert.IsZero() {
+		e.recordAssertions(flow, ro.Assert)
 	}
-	body, truncated, err := readLimited(r.Body, maxBytes)
-	if err != nil {
-		return err
+	if ro.discard {
+		return flow, nil // not in the store
 	}
-	// Replace r.Body so the reverse proxy can still read it.
-	r.Body = io.NopCloser(bytes.NewReader(body))
-	r.ContentLength = int64(len(body))
-
-	flow.Request.Body = body
-	flow.Request.BodyTruncated = truncated
-	return nil
+	return e.store.Get(flow.ID), nil
 }
 
-// captureResponseBody reads up to maxBytes of the response body and stores it on the flow.
-func captureResponseBody(flow *Flow, resp *http.Response, maxBytes int64) error {
-	captured := &CapturedResponse{
-		StatusCode: resp.StatusCode,
-		Headers:    resp.Header.Clone(),
-		Proto:      resp.Proto,
+// replayUpstream resolves where a replayed request goes: the upstream named
+// by target, a one-off upstream for a base URL, the host in the URL in
+// forward mode, or the router's match.
+func (e *Engine) replayUpstream(req *http.Request, target string) (*Upstream, *httputil.ReverseProxy, error) {
+	rt := e.routing.Load()
+	if target == "" && e.isForwardURL(req.URL) {
+		return e.forwardUpstream(req.URL)
 	}
-	flow.Response = captured
-
-	if resp.Body == nil {
-		return nil
+	if target == "" {
+		upstream := rt.router.Match(req)
+		if upstream == nil {
+			return nil, nil, fmt.Errorf("no upstream for path %q", req.URL.Path)
+		}
+		proxy, ok := rt.proxies[upstream.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("upstream %q not configured", upstream.Name)
+		}
+		return upstream, proxy, nil
 	}
 
-	body, truncated, err := readLimited(resp.Body, maxBytes)
-	if err != nil {
-		return err
+	for i := range rt.router.upstreams {
+		if u := &rt.router.upstreams[i]; u.Name == target {
+			return u, rt.proxies[u.Name], nil
+		}
 	}
-	// Replace resp.Body so the reverse proxy can still send it.
-	resp.Body = io.NopCloser(bytes.NewReader(body))
-	resp.ContentLength = int64(len(body))
-
-	captured.Body = body
-	captured.BodyTruncated = truncated
-	return nil
-}
 
-// readLimited reads at most maxBytes from r, then closes r.
-// Returns the bytes read and whether the source had more data (truncated).
-func readLimited(r io.ReadCloser, maxBytes int64) ([]byte, bool, error) {
-	defer r.Close()
-	limit := maxBytes + 1
-	data, err := io.ReadAll(io.LimitReader(r, limit))
-	if err != nil {
-		return nil, false, err
+	base, err := url.Parse(target)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, nil, fmt.Errorf("target %q is neither an upstream name nor an http(s) base URL", target)
 	}
-	if int64(len(data)) > maxBytes {
-		return data[:maxBytes], true, nil
+	u := &Upstream{Name: base.String(), Prefix: "/", Target: base.String()}
+	if err := u.prepareTargets(); err != nil {
+		return nil, nil, err
 	}
-	return data, false, nil
+	return u, e.newReverseProxy(u), nil
 }
 
 // rebuildRequest constructs a new *http.Request from a CapturedRequest.
 func rebuildRequest(cr *CapturedRequest) (*http.Request, error) {
-	req, err := http.NewRequest(cr.Method, cr.URL, bytes.NewReader(cr.Body))
+	req, err := http.NewRequest(cr.Method, cr.URL, bytes.NewReader(cr.ReadBody()))
 	if err != nil {
 		return nil, err
 	}
+	if req.Host == "" {
+		req.Host = cr.Host // for passthrough upstreams
+	}
 	for k, vv := range cr.Headers {
 		for _, v := range vv {
 			req.Header.Add(k, v)
@@ -308,8 +831,9 @@ func rebuildRequest(cr *CapturedRequest) (*http.Request, error) {
 
 // cloneRequest returns a copy of a CapturedRequest (with a copy of the body slice).
 func cloneRequest(cr *CapturedRequest) *CapturedRequest {
-	body := make([]byte, len(cr.Body))
-	copy(body, cr.Body)
+	src := cr.ReadBody()
+	body := make([]byte, len(src))
+	copy(body, src)
 	return &CapturedRequest{
 		Method:        cr.Method,
 		URL:           cr.URL,
@@ -319,6 +843,8 @@ func cloneRequest(cr *CapturedRequest) *CapturedRequest {
 		Body:          body,
 		Proto:         cr.Proto,
 		BodyTruncated: cr.BodyTruncated,
+		Size:          cr.Size,
+		HeadersSize:   cr.HeadersSize,
 	}
 }
 
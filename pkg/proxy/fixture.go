@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// FixtureRules say what, beyond the method and path, a request must share
+// with a captured one to be answered with its response.
+type FixtureRules struct {
+	// Query also matches the query string, parameters in any order.
+	Query bool
+
+	// Body also matches the whole request body.
+	Body bool
+
+	// JSON also matches the values at these paths in the JSON request body,
+	// written as for Assertions.JSON ("operationName", "variables.id"), so
+	// requests to one endpoint, such as /graphql, can tell fixtures apart.
+	JSON []string
+}
+
+// Fixtures are captured flows whose responses answer the requests that
+// match them, as a mock server built from a session. Flows without a
+// response, or whose response body was truncated, are left out.
+type Fixtures struct {
+	rules  FixtureRules
+	paths  [][]jsonSeg
+	routes map[string][]*Flow // by method and path, in recorded order
+	count  int
+}
+
+// NewFixtures indexes flows, which should be in recorded order, by rules.
+func NewFixtures(flows []*Flow, rules FixtureRules) (*Fixtures, error) {
+	fx := &Fixtures{rules: rules, routes: make(map[string][]*Flow)}
+	for _, p := range rules.JSON {
+		segs, err := parseJSONPath(p)
+		if err != nil {
+			return nil, fmt.Errorf("fixture JSON path %q: %v", p, err)
+		}
+		fx.paths = append(fx.paths, segs)
+	}
+	for _, f := range flows {
+		if f.Request == nil || f.Response == nil || f.Response.BodyTruncated {
+			continue
+		}
+		key := fixtureRoute(f.Request)
+		fx.routes[key] = append(fx.routes[key], f)
+		fx.count++
+	}
+	return fx, nil
+}
+
+// Len returns the number of fixtures.
+func (fx *Fixtures) Len() int { return fx.count }
+
+// Routes returns the number of distinct methods and paths the fixtures
+// answer.
+func (fx *Fixtures) Routes() int { return len(fx.routes) }
+
+// Match returns the flow whose response answers req: the last one recorded
+// for its method and path that also satisfies the rules, or nil.
+func (fx *Fixtures) Match(req *CapturedRequest) *Flow {
+	candidates := fx.routes[fixtureRoute(req)]
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if fx.matches(candidates[i].Request, req) {
+			return candidates[i]
+		}
+	}
+	return nil
+}
+
+func (fx *Fixtures) matches(captured, req *CapturedRequest) bool {
+	if fx.rules.Query && !reflect.DeepEqual(requestQuery(captured), requestQuery(req)) {
+		return false
+	}
+	if fx.rules.Body && !bytes.Equal(captured.ReadBody(), req.ReadBody()) {
+		return false
+	}
+	if len(fx.paths) == 0 {
+		return true
+	}
+	a, errA := decodeJSON(captured.ReadBody())
+	b, errB := decodeJSON(req.ReadBody())
+	if errA != nil || errB != nil {
+		return false
+	}
+	for _, segs := range fx.paths {
+		va, vb := jsonAt(a, "", segs), jsonAt(b, "", segs)
+		if len(va) != len(vb) {
+			return false
+		}
+		for j := range va {
+			if va[j].found != vb[j].found || !reflect.DeepEqual(va[j].value, vb[j].value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fixtureRoute keys a request by method and path.
+func fixtureRoute(req *CapturedRequest) string {
+	p := req.Path
+	if p == "" {
+		if u, err := url.Parse(req.URL); err == nil {
+			p = u.Path
+		}
+	}
+	if p == "" {
+		p = "/"
+	}
+	return strings.ToUpper(req.Method) + " " + p
+}
+
+// requestQuery returns the parsed query string of req's URL.
+func requestQuery(req *CapturedRequest) url.Values {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil
+	}
+	q := u.Query()
+	if len(q) == 0 {
+		return nil
+	}
+	return q
+}
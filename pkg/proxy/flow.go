@@ -14,6 +14,11 @@ const (
 	FlowStateIntercepted FlowState = "intercepted"
 	FlowStateComplete    FlowState = "complete"
 	FlowStateError       FlowState = "error"
+
+	// FlowStateRejected is a request the proxy answered with an error of
+	// its own before handling it (no upstream matched, unreadable body).
+	// Such flows are tagged "proxy-error" and the reason.
+	FlowStateRejected FlowState = "rejected"
 )
 
 // CapturedRequest holds a snapshot of an HTTP request.
@@ -26,6 +31,52 @@ type CapturedRequest struct {
 	Body          []byte      `json:"body,omitempty"`
 	Proto         string      `json:"proto"`
 	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+	Trailers      http.Header `json:"trailers,omitempty"`
+
+	// RemoteAddr is the client's address ("ip:port") as seen by the proxy.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+
+	// Size is the full body length in bytes, even when Body was truncated.
+	Size int64 `json:"size"`
+
+	// HeadersSize is the length of the request line and headers as
+	// HTTP/1.1 sends them (an estimate for HTTP/2, which compresses them).
+	HeadersSize int64 `json:"headersSize,omitempty"`
+
+	spilled *spilledBody // Body, once the store has moved it to disk
+	packed  *packedBody  // Body, once the store has compressed it
+	shared  *sharedBody  // the store's copy Body (or packed) points at, if shared
+}
+
+// WireSize is the request's full length: headers plus the whole body.
+func (cr *CapturedRequest) WireSize() int64 {
+	return cr.HeadersSize + max(cr.Size, int64(len(cr.Body)))
+}
+
+// ReadBody returns the captured body. The store may move large bodies of
+// finished flows to disk or compress them (see Options.SpillThreshold and
+// Options.CompressThreshold), leaving Body nil; ReadBody reads them back.
+func (cr *CapturedRequest) ReadBody() []byte {
+	bodyMu.RLock()
+	body, spilled, packed := cr.Body, cr.spilled, cr.packed
+	bodyMu.RUnlock()
+	return readBody(body, spilled, packed)
+}
+
+// bodyMu guards the store's swap of a finished flow's Body for its spilled
+// or packed form, so that ReadBody, which may run on any goroutine while
+// the store does so, sees one or the other.
+var bodyMu sync.RWMutex
+
+// readBody returns a captured body from whichever form holds it.
+func readBody(body []byte, spilled *spilledBody, packed *packedBody) []byte {
+	if body == nil && spilled != nil {
+		return spilled.read()
+	}
+	if body == nil && packed != nil {
+		return packed.read()
+	}
+	return body
 }
 
 // CapturedResponse holds a snapshot of an HTTP response.
@@ -35,6 +86,33 @@ type CapturedResponse struct {
 	Body          []byte      `json:"body,omitempty"`
 	Proto         string      `json:"proto"`
 	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+	Trailers      http.Header `json:"trailers,omitempty"`
+
+	// Size is the full body length in bytes, even when Body was truncated.
+	Size int64 `json:"size"`
+
+	// HeadersSize is the length of the status line and headers, counted
+	// like CapturedRequest.HeadersSize.
+	HeadersSize int64 `json:"headersSize,omitempty"`
+
+	spilled *spilledBody // Body, once the store has moved it to disk
+	packed  *packedBody  // Body, once the store has compressed it
+	shared  *sharedBody  // the store's copy Body (or packed) points at, if shared
+}
+
+// WireSize is the response's full length: headers plus the whole body.
+func (r *CapturedResponse) WireSize() int64 {
+	return r.HeadersSize + max(r.Size, int64(len(r.Body)))
+}
+
+// ReadBody returns the captured body, reading it back from disk or
+// decompressing it if the store spilled or compressed it (see
+// CapturedRequest.ReadBody).
+func (r *CapturedResponse) ReadBody() []byte {
+	bodyMu.RLock()
+	body, spilled, packed := r.Body, r.spilled, r.packed
+	bodyMu.RUnlock()
+	return readBody(body, spilled, packed)
 }
 
 // Flow represents a complete HTTP transaction.
@@ -42,6 +120,10 @@ type Flow struct {
 	ID       string `json:"id"`
 	Upstream string `json:"upstream"` // name of the upstream that handled this
 
+	// TargetURL is the upstream URL the request was sent to, after routing,
+	// target selection, and path rewriting.
+	TargetURL string `json:"targetUrl,omitempty"`
+
 	Request  *CapturedRequest  `json:"request"`
 	Response *CapturedResponse `json:"response,omitempty"`
 	Error    string            `json:"error,omitempty"`
@@ -49,6 +131,26 @@ type Flow struct {
 	State FlowState `json:"state"`
 	Tags  []string  `json:"tags,omitempty"`
 
+	// Note is free text attached by the user, kept in exports.
+	Note string `json:"note,omitempty"`
+
+	// Pinned flows are exempt from ring-buffer eviction and from Clear. Set
+	// it with FlowStore.SetPinned.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// ReplayOf is the ID of the flow this one is a replay of. Replays lists
+	// the IDs of this flow's own replays, oldest first; it is guarded by
+	// FlowStore.mu and may name flows that have since been evicted.
+	ReplayOf string   `json:"replayOf,omitempty"`
+	Replays  []string `json:"replays,omitempty"`
+
+	// Assertions is the outcome of the checks a replay was sent with.
+	Assertions *AssertionResult `json:"assertions,omitempty"`
+
+	// Meta holds structured data attached by addons, keyed by addon
+	// (e.g. "jwt"). The UIs show each entry in its own section.
+	Meta map[string]any `json:"meta,omitempty"`
+
 	Timestamps struct {
 		Created       time.Time `json:"created"`
 		RequestDone   time.Time `json:"requestDone"`
@@ -56,10 +158,43 @@ type Flow struct {
 		ResponseDone  time.Time `json:"responseDone,omitempty"`
 	} `json:"timestamps"`
 
+	// Timings breaks down the duration of flows forwarded upstream.
+	Timings *Timings `json:"timings,omitempty"`
+
 	// mu protects resumeCh and killed, used for intercept/resume.
 	mu       sync.Mutex
 	resumeCh chan struct{}
 	killed   bool
+
+	trace *connTrace // set while a forwarded request is in flight
+
+	cors   *CORS         // the CORS override applied to the response, if any
+	alerts *Alerts       // the thresholds checked when the flow is forwarded
+	auth   *UpstreamAuth // the credentials added to the request, if any
+
+	retryPolicy *RetryPolicy // the upstream's retry policy, if any
+	retry       *RetryPolicy // retryPolicy, once retryAddon finds the request can be re-sent
+
+	capture []CaptureRule // limits body capture; see captureLimit
+
+	// dropped marks flows that are ignored or were deleted, whose updates
+	// are no longer broadcast. Guarded by FlowStore.mu once stored.
+	dropped bool
+
+	// excluded marks flows left out of the store by an ignore rule,
+	// sampling, or the record filter, and uncaptured replay copies; see
+	// Excluded.
+	excluded bool
+
+	sampledOut bool    // not stored because of the sample rate
+	record     Matcher // the record filter to check again once a held-back flow finishes
+	breakable  bool    // response breakpoints apply; set by serve for stored flows
+
+	shadow *shadowPair // set by mirror when the copy's response is compared
+
+	// storeBytes is how much of the store's memory budget the flow's bodies
+	// use. Guarded by FlowStore.mu.
+	storeBytes int64
 }
 
 // Duration returns elapsed time from flow creation to response completion,
@@ -71,13 +206,58 @@ func (f *Flow) Duration() time.Duration {
 	return time.Since(f.Timestamps.Created)
 }
 
+// Pending reports whether the request has been sent on and the flow is
+// waiting for the upstream's response.
+func (f *Flow) Pending() bool {
+	return f.State == FlowStateActive && f.Response == nil && !f.Timestamps.RequestDone.IsZero()
+}
+
+// Excluded reports whether the flow is left out of the store: matched by an
+// ignore rule, sampled out, not matched by the record filter, or an
+// uncaptured replay copy. Addon hooks see these flows too, so addons that
+// keep or export flows should skip them. A flow the record filter held back
+// is checked against it again once finished, as the store will; call
+// Excluded from the flow's own hooks, not from another goroutine.
+func (f *Flow) Excluded() bool {
+	if f.record != nil && finished(f) {
+		return !f.record(f)
+	}
+	return f.excluded
+}
+
+// SetMeta attaches addon data to the flow under key.
+func (f *Flow) SetMeta(key string, v any) {
+	if f.Meta == nil {
+		f.Meta = make(map[string]any)
+	}
+	f.Meta[key] = v
+}
+
 // Intercept pauses the flow until Resume or Kill is called.
 func (f *Flow) Intercept() {
+	<-f.hold()
+}
+
+// hold marks the flow intercepted and returns a channel that is closed when
+// the flow is resumed or killed.
+func (f *Flow) hold() <-chan struct{} {
 	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan struct{})
+	if f.killed {
+		close(ch)
+		return ch
+	}
 	f.State = FlowStateIntercepted
-	f.resumeCh = make(chan struct{})
-	f.mu.Unlock()
-	<-f.resumeCh
+	f.resumeCh = ch
+	return ch
+}
+
+// Killed reports whether Kill has been called on the flow.
+func (f *Flow) Killed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.killed
 }
 
 // Resume continues a paused (intercepted) flow.
@@ -112,10 +292,46 @@ const (
 	FlowEventUpdate   FlowEventType = "update"
 	FlowEventComplete FlowEventType = "complete"
 	FlowEventError    FlowEventType = "error"
+
+	// FlowEventRequest reports that the request phase is done (body
+	// captured, hooks and intercept passed) and the flow is waiting on the
+	// upstream.
+	FlowEventRequest FlowEventType = "request"
+
+	// FlowEventDelete reports flows removed from the store, by ID in IDs;
+	// Flow is nil.
+	FlowEventDelete FlowEventType = "delete"
+
+	// FlowEventEvict reports flows pushed out of the store to make room
+	// (see Options.MaxFlows and MaxStoreBytes), by ID in IDs; Flow is nil.
+	FlowEventEvict FlowEventType = "evict"
+
+	// FlowEventReload is not tied to a flow: it reports a configuration
+	// reload (or a failed attempt) in Message, and Flow is nil.
+	FlowEventReload FlowEventType = "reload"
+
+	// FlowEventJob reports bulk replay progress in Job; Flow is nil.
+	FlowEventJob FlowEventType = "job"
+
+	// FlowEventProcess reports an upstream process starting, becoming
+	// ready, or exiting, in Message; Flow is nil.
+	FlowEventProcess FlowEventType = "process"
+
+	// FlowEventUpstream reports an upstream target going down or coming
+	// back while requests to it are held (see Upstream.HoldTimeout), in
+	// Message; Flow is nil.
+	FlowEventUpstream FlowEventType = "upstream"
+
+	// FlowEventShutdown reports the proxy draining in-flight flows on the
+	// way out, and how that went, in Message; Flow is nil.
+	FlowEventShutdown FlowEventType = "shutdown"
 )
 
 // FlowEvent carries a flow change notification to subscribers.
 type FlowEvent struct {
-	Type FlowEventType `json:"type"`
-	Flow *Flow         `json:"flow"`
+	Type    FlowEventType `json:"type"`
+	Flow    *Flow         `json:"flow"`
+	Message string        `json:"message,omitempty"`
+	Job     *ReplayJob    `json:"job,omitempty"`
+	IDs     []string      `json:"ids,omitempty"`
 }
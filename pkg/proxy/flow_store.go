@@ -1,8 +1,14 @@
 package proxy
 
-import "sync"
+import (
+	"slices"
+	"sync"
+)
 
 // FlowStore is a thread-safe, fixed-capacity ring buffer of flows with pub/sub.
+// Pinned flows are exempt from eviction and from Clear, so the store can hold
+// more than its capacity when many flows are pinned. With a memory budget,
+// the oldest flows are also evicted while their bodies take up more than it.
 type FlowStore struct {
 	mu          sync.RWMutex
 	flows       []*Flow
@@ -11,6 +17,19 @@ type FlowStore struct {
 	head        int // next write position
 	count       int // current number of stored flows
 	subscribers []chan FlowEvent
+
+	// pinned holds pinned flows pushed out of the ring, oldest first. Every
+	// one of them is older than the flows still in the ring.
+	pinned []*Flow
+
+	maxBytes       int64      // memory budget for bodies; 0 has none
+	bytes          int64      // body bytes held in memory by stored flows alone
+	bodies         *bodyTable // bodies shared by stored flows; see dedup.go
+	spillDir       string     // where large bodies go; "" keeps them in memory
+	spillThreshold int64      // bodies larger than this are spilled
+
+	compressAlgorithm string // CompressGzip or CompressZstd
+	compressThreshold int64  // bodies larger than this are compressed; 0 never
 }
 
 // NewFlowStore creates a store with the given capacity. Oldest flows are evicted when full.
@@ -22,36 +41,195 @@ func NewFlowStore(capacity int) *FlowStore {
 		flows:    make([]*Flow, capacity),
 		index:    make(map[string]*Flow),
 		capacity: capacity,
+		bodies:   newBodyTable(),
 	}
 }
 
+// setLimits sets a memory budget for the flows' bodies (0 for none), and
+// has bodies larger than spillThreshold moved to files in spillDir once
+// their flow finishes ("" keeps them in memory).
+func (s *FlowStore) setLimits(maxBytes int64, spillDir string, spillThreshold int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxBytes = maxBytes
+	s.spillDir = spillDir
+	s.spillThreshold = spillThreshold
+}
+
+// setCompression has bodies larger than threshold compressed with alg once
+// their flow finishes (0 leaves them as they are).
+func (s *FlowStore) setCompression(alg string, threshold int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compressAlgorithm = alg
+	s.compressThreshold = threshold
+}
+
 // Add stores a new flow and notifies subscribers.
 func (s *FlowStore) Add(f *Flow) {
+	if finished(f) {
+		s.spill(f) // e.g. a flow loaded from a session file
+		s.compress(f)
+	}
 	s.mu.Lock()
+	var evicted []string
 	if s.count == s.capacity {
-		// Evict the oldest entry.
-		old := s.flows[s.head]
-		if old != nil {
-			delete(s.index, old.ID)
-		}
-	} else {
-		s.count++
+		// Evict the oldest entry, unless it is pinned. Flows unpinned since
+		// they left the ring go with it.
+		evicted = append(s.pruneUnpinned(), s.evictOldest()...)
 	}
 	s.flows[s.head] = f
 	s.index[f.ID] = f
 	s.head = (s.head + 1) % s.capacity
+	s.count++
+	if finished(f) {
+		s.dedup(f)
+	}
+	s.account(f)
+	evicted = append(evicted, s.enforceBudget()...)
 	subs := s.copySubscribers()
 	s.mu.Unlock()
 
 	s.broadcast(subs, FlowEvent{Type: FlowEventNew, Flow: f})
+	if len(evicted) > 0 {
+		s.broadcast(subs, FlowEvent{Type: FlowEventEvict, IDs: evicted})
+	}
 }
 
-// Update notifies subscribers of a change to an existing flow.
+// Update notifies subscribers of a change to an existing flow. Ignored,
+// deleted, and cleared flows are skipped. When the flow has finished, its
+// large bodies are spilled, the rest compressed and deduplicated, and the
+// memory budget is enforced, and a flow held back by the record filter is
+// stored if the filter matches it now.
 func (s *FlowStore) Update(f *Flow, eventType FlowEventType) {
+	done := eventType == FlowEventComplete || eventType == FlowEventError
+	if done && f.record != nil {
+		match := f.record
+		f.record = nil
+		if match(f) {
+			f.dropped = false // not stored yet, so not shared
+			f.excluded = false
+			s.Add(f)
+		}
+	}
+	if !done {
+		s.mu.RLock()
+		dropped := f.dropped
+		subs := s.copySubscribers()
+		s.mu.RUnlock()
+		if dropped {
+			return
+		}
+		s.broadcast(subs, FlowEvent{Type: eventType, Flow: f})
+		return
+	}
+
+	s.mu.RLock()
+	dropped := f.dropped
+	s.mu.RUnlock()
+	if dropped {
+		return
+	}
+	s.spill(f)
+	s.compress(f)
+	s.mu.Lock()
+	if f.dropped || s.index[f.ID] != f { // deleted or cleared while in flight
+		s.mu.Unlock()
+		return
+	}
+	s.dedup(f)
+	s.account(f)
+	evicted := s.enforceBudget()
+	dropped = f.dropped // it may have been the oldest
+	subs := s.copySubscribers()
+	s.mu.Unlock()
+	if !dropped {
+		s.broadcast(subs, FlowEvent{Type: eventType, Flow: f})
+	}
+	if len(evicted) > 0 {
+		s.broadcast(subs, FlowEvent{Type: FlowEventEvict, IDs: evicted})
+	}
+}
+
+// finished reports whether f will see no more changes from the proxy.
+func finished(f *Flow) bool {
+	return f.State == FlowStateComplete || f.State == FlowStateError || f.State == FlowStateRejected
+}
+
+// account brings the store's byte count up to date with f's bodies.
+func (s *FlowStore) account(f *Flow) {
+	n := memBytes(f)
+	s.bytes += n - f.storeBytes
+	f.storeBytes = n
+}
+
+// forget removes f from the index and the byte count, and drops its
+// further updates.
+func (s *FlowStore) forget(f *Flow) {
+	delete(s.index, f.ID)
+	s.undedup(f)
+	s.bytes -= f.storeBytes
+	f.storeBytes = 0
+	f.dropped = true
+}
+
+// pruneUnpinned forgets the flows in the overflow list that have been
+// unpinned, returning their IDs.
+func (s *FlowStore) pruneUnpinned() []string {
+	var ids []string
+	s.pinned = slices.DeleteFunc(s.pinned, func(p *Flow) bool {
+		if !p.Pinned {
+			s.forget(p)
+			ids = append(ids, p.ID)
+			return true
+		}
+		return false
+	})
+	return ids
+}
+
+// evictOldest takes the oldest flow out of the ring, forgetting it, or
+// moving it to the overflow list if it is pinned. It returns the ID of a
+// forgotten flow.
+func (s *FlowStore) evictOldest() []string {
+	if s.count == 0 {
+		return nil
+	}
+	i := (s.head - s.count + s.capacity) % s.capacity
+	old := s.flows[i]
+	s.flows[i] = nil
+	s.count--
+	switch {
+	case old == nil:
+		return nil
+	case old.Pinned:
+		s.pinned = append(s.pinned, old)
+		return nil
+	}
+	s.forget(old)
+	return []string{old.ID}
+}
+
+// enforceBudget evicts the oldest unpinned flows while the bodies held in
+// memory exceed the budget. The newest flow is always kept. It returns the
+// IDs of the evicted flows.
+func (s *FlowStore) enforceBudget() []string {
+	if s.maxBytes <= 0 || s.memBytes() <= s.maxBytes {
+		return nil
+	}
+	evicted := s.pruneUnpinned()
+	for s.memBytes() > s.maxBytes && s.count > 1 {
+		evicted = append(evicted, s.evictOldest()...)
+	}
+	return evicted
+}
+
+// Notify sends an event that is not tied to a stored flow (e.g. a reload).
+func (s *FlowStore) Notify(evt FlowEvent) {
 	s.mu.RLock()
 	subs := s.copySubscribers()
 	s.mu.RUnlock()
-	s.broadcast(subs, FlowEvent{Type: eventType, Flow: f})
+	s.broadcast(subs, evt)
 }
 
 // Get returns the flow with the given ID, or nil if not found.
@@ -61,46 +239,161 @@ func (s *FlowStore) Get(id string) *Flow {
 	return s.index[id]
 }
 
+// SetPinned pins or unpins f. An unpinned flow that had already been pushed
+// out of the ring is dropped on the next eviction.
+func (s *FlowStore) SetPinned(f *Flow, pinned bool) {
+	s.mu.Lock()
+	f.Pinned = pinned
+	s.mu.Unlock()
+}
+
+// linkReplay records replayID in the Replays of the flow with ID id, if it
+// is still stored, and notifies subscribers of the change.
+func (s *FlowStore) linkReplay(id, replayID string) {
+	s.mu.Lock()
+	original := s.index[id]
+	if original != nil {
+		original.Replays = append(original.Replays, replayID)
+	}
+	s.mu.Unlock()
+	if original != nil {
+		s.Update(original, FlowEventUpdate)
+	}
+}
+
+// Replays returns the replays of f that are still stored, oldest first.
+func (s *FlowStore) Replays(f *Flow) []*Flow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*Flow
+	for _, id := range f.Replays {
+		if r := s.index[id]; r != nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
 // All returns flows in insertion order (oldest first).
 func (s *FlowStore) All() []*Flow {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if s.count == 0 {
+	return s.all()
+}
+
+// all is All without locking.
+func (s *FlowStore) all() []*Flow {
+	if s.count == 0 && len(s.pinned) == 0 {
 		return nil
 	}
-	result := make([]*Flow, 0, s.count)
-	if s.count < s.capacity {
-		for i := 0; i < s.count; i++ {
-			if s.flows[i] != nil {
-				result = append(result, s.flows[i])
-			}
-		}
-	} else {
-		for i := 0; i < s.capacity; i++ {
-			idx := (s.head + i) % s.capacity
-			if s.flows[idx] != nil {
-				result = append(result, s.flows[idx])
-			}
+	result := make([]*Flow, 0, s.count+len(s.pinned))
+	result = append(result, s.pinned...)
+	start := s.head - s.count + s.capacity
+	for i := range s.count {
+		if f := s.flows[(start+i)%s.capacity]; f != nil {
+			result = append(result, f)
 		}
 	}
 	return result
 }
 
-// Clear removes all flows from the store.
-func (s *FlowStore) Clear() {
+// Clear removes all unpinned flows from the store and returns how many
+// pinned flows were kept.
+func (s *FlowStore) Clear() int {
+	return s.clear(false)
+}
+
+// ClearAll removes every flow from the store, pinned or not.
+func (s *FlowStore) ClearAll() {
+	s.clear(true)
+}
+
+func (s *FlowStore) clear(all bool) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	var kept []*Flow
+	for _, f := range s.all() {
+		if !all && f.Pinned {
+			kept = append(kept, f)
+		} else {
+			s.forget(f) // drops the updates of flows still in flight
+		}
+	}
 	s.flows = make([]*Flow, s.capacity)
 	s.index = make(map[string]*Flow)
 	s.head = 0
 	s.count = 0
+	s.bytes = 0
+	// Kept flows are older than anything added later, so they go straight to
+	// the overflow list rather than using up ring slots.
+	s.pinned = kept
+	for _, f := range kept {
+		s.index[f.ID] = f
+		s.bytes += f.storeBytes
+	}
+	return len(kept)
+}
+
+// Delete removes the flow with the given ID, pinned or not, and reports
+// whether it was found.
+func (s *FlowStore) Delete(id string) bool {
+	return len(s.DeleteFunc(func(f *Flow) bool { return f.ID == id })) > 0
+}
+
+// DeleteFunc removes every flow for which del returns true, notifies
+// subscribers, and returns the removed IDs.
+func (s *FlowStore) DeleteFunc(del func(*Flow) bool) []string {
+	s.mu.Lock()
+	var ids []string
+	var pinned, ring []*Flow
+	for i, f := range s.all() {
+		switch {
+		case del(f):
+			ids = append(ids, f.ID)
+			s.forget(f)
+		case i < len(s.pinned):
+			pinned = append(pinned, f)
+		default:
+			ring = append(ring, f)
+		}
+	}
+	if len(ids) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	// Compact the survivors to the front of the ring, oldest first.
+	s.pinned = pinned
+	s.flows = make([]*Flow, s.capacity)
+	copy(s.flows, ring)
+	s.count = len(ring)
+	s.head = s.count % s.capacity
+	subs := s.copySubscribers()
+	s.mu.Unlock()
+	s.broadcast(subs, FlowEvent{Type: FlowEventDelete, IDs: ids})
+	return ids
+}
+
+// memBytes is how many body bytes the stored flows hold in memory.
+func (s *FlowStore) memBytes() int64 { return s.bytes + s.bodies.bytes }
+
+// Stats reports the store's size and how much deduplication saves.
+func (s *FlowStore) Stats() StoreStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StoreStats{
+		Flows:        s.count + len(s.pinned),
+		BodyBytes:    s.memBytes(),
+		SharedBodies: len(s.bodies.bodies),
+		SharedRefs:   s.bodies.refs,
+		DedupSaved:   s.bodies.saved,
+	}
 }
 
 // Count returns the number of flows currently held.
 func (s *FlowStore) Count() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.count
+	return s.count + len(s.pinned)
 }
 
 // Subscribe returns a channel that receives FlowEvents. The channel is
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func storeFlow(i int) *Flow {
+	return &Flow{
+		ID:       fmt.Sprintf("f%d", i),
+		State:    FlowStateActive,
+		Request:  &CapturedRequest{Method: "GET", URL: fmt.Sprintf("http://api.test/%d", i)},
+		Response: &CapturedResponse{StatusCode: 200},
+	}
+}
+
+func complete(s *FlowStore, f *Flow, body []byte) {
+	f.Response.Body = body
+	f.State = FlowStateComplete
+	s.Update(f, FlowEventComplete)
+}
+
+// TestClearDuringFlight completes flows cleared while in flight, which must
+// not come back into the byte count or reach subscribers.
+func TestClearDuringFlight(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		clear func(*FlowStore)
+	}{
+		{"Clear", func(s *FlowStore) { s.Clear() }},
+		{"ClearAll", (*FlowStore).ClearAll},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFlowStore(10)
+			s.setLimits(1000, "", 0)
+			inFlight := storeFlow(1)
+			s.Add(inFlight)
+			tt.clear(s)
+
+			events := s.Subscribe()
+			defer s.Unsubscribe(events)
+			complete(s, inFlight, bytes.Repeat([]byte("x"), 900))
+			if got := s.Stats(); got.Flows != 0 || got.BodyBytes != 0 {
+				t.Fatalf("after completing a cleared flow: %d flows, %d bytes, want an empty store", got.Flows, got.BodyBytes)
+			}
+			select {
+			case evt := <-events:
+				t.Errorf("completing a cleared flow sent a %v event", evt.Type)
+			default:
+			}
+
+			next := storeFlow(2)
+			s.Add(next)
+			complete(s, next, bytes.Repeat([]byte("y"), 200))
+			if s.Get(next.ID) == nil {
+				t.Error("a flow within the budget was evicted")
+			}
+			if got := s.Stats().BodyBytes; got != 200 {
+				t.Errorf("store counts %d bytes, want 200", got)
+			}
+		})
+	}
+}
+
+func TestClearKeepsPinned(t *testing.T) {
+	s := NewFlowStore(10)
+	pinned, other := storeFlow(1), storeFlow(2)
+	s.Add(pinned)
+	s.Add(other)
+	s.SetPinned(pinned, true)
+	if kept := s.Clear(); kept != 1 {
+		t.Fatalf("Clear kept %d flows, want 1", kept)
+	}
+	complete(s, pinned, []byte("pinned body"))
+	complete(s, other, []byte("cleared body"))
+	if s.Get(pinned.ID) == nil || s.Get(other.ID) != nil {
+		t.Errorf("after Clear: pinned stored %v, other stored %v", s.Get(pinned.ID) != nil, s.Get(other.ID) != nil)
+	}
+	if got, want := s.Stats().BodyBytes, int64(len("pinned body")); got != want {
+		t.Errorf("store counts %d bytes, want %d", got, want)
+	}
+}
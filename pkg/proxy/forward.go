@@ -0,0 +1,380 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Proxy modes (Options.Mode).
+const (
+	// ModeReverse routes requests to the configured upstreams by path.
+	ModeReverse = "reverse"
+
+	// ModeForward acts as a classic HTTP proxy for clients configured with
+	// HTTP_PROXY/HTTPS_PROXY: absolute-URI requests go to the host they
+	// name, and CONNECT opens a tunnel, decrypted when Options.MITM is set.
+	ModeForward = "forward"
+)
+
+// tunnelTag marks flows that record a CONNECT tunnel rather than a request.
+const tunnelTag = "tunnel"
+
+// connectEstablished is the answer to a CONNECT request that was accepted.
+const connectEstablished = "HTTP/1.1 200 Connection Established\r\n\r\n"
+
+func validateMode(mode string) error {
+	switch mode {
+	case "", ModeReverse, ModeForward:
+		return nil
+	}
+	return fmt.Errorf("unknown proxy mode %q (want %q or %q)", mode, ModeReverse, ModeForward)
+}
+
+// serveForward handles a request in forward-proxy mode.
+func (e *Engine) serveForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		e.serveConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		e.rejectRequest(w, r, http.StatusBadRequest, rejectBadRequest,
+			errors.New("forward proxy: request URI must be absolute; configure the client to use this address as its HTTP proxy"))
+		return
+	}
+	e.forward(w, r)
+}
+
+// forward sends r, whose URL is absolute, to the host it names through the
+// usual pipeline: capture, hooks, intercept, mocks, and responders.
+func (e *Engine) forward(w http.ResponseWriter, r *http.Request) {
+	rt := e.routing.Load()
+	upstream, rp, err := e.forwardUpstream(r.URL)
+	if err != nil {
+		e.rejectRequest(w, r, http.StatusBadRequest, rejectBadRequest, err)
+		return
+	}
+	e.serve(w, r, rt, rt.matchMock(r), upstream, rp)
+}
+
+// forwardUpstream builds a one-off upstream for the origin of u, named after
+// its host.
+func (e *Engine) forwardUpstream(u *url.URL) (*Upstream, *httputil.ReverseProxy, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil, fmt.Errorf("forward proxy: unsupported scheme %q", u.Scheme)
+	}
+	up := &Upstream{Name: u.Host, Prefix: "/", Target: u.Scheme + "://" + u.Host}
+	if err := up.prepareTargets(); err != nil {
+		return nil, nil, err
+	}
+	return up, e.newReverseProxy(up), nil
+}
+
+// serveConnect answers a CONNECT request: with MITM the tunnel is terminated
+// here and its requests are captured one by one; otherwise the bytes are
+// relayed untouched and the tunnel is recorded as a single flow.
+func (e *Engine) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		e.rejectRequest(w, r, http.StatusHTTPVersionNotSupported, rejectBadRequest, errors.New("CONNECT is only supported over HTTP/1.1"))
+		return
+	}
+	if e.mitmCA != nil {
+		e.interceptTunnel(hj, r)
+		return
+	}
+	e.relayTunnel(w, hj, r)
+}
+
+// relayTunnel copies bytes between the client and r.Host until both sides
+// are done. The flow records the byte counts as the body sizes.
+func (e *Engine) relayTunnel(w http.ResponseWriter, hj http.Hijacker, r *http.Request) {
+	flow := e.newTunnelFlow(r)
+	flow.Timestamps.RequestDone = time.Now()
+	e.addons.FireRequest(flow)
+	e.store.Update(flow, FlowEventRequest)
+
+	upConn, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+	if err != nil {
+		e.failTunnel(flow, err)
+		http.Error(w, fmt.Sprintf("upstream error: %v", err), http.StatusBadGateway)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		upConn.Close()
+		e.failTunnel(flow, err)
+		return
+	}
+	defer conn.Close()
+	defer upConn.Close()
+	if _, err := io.WriteString(conn, connectEstablished); err != nil {
+		e.failTunnel(flow, err)
+		return
+	}
+	flow.Timestamps.ResponseStart = time.Now()
+	flow.Response = &CapturedResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Proto: "HTTP/1.1"}
+	flow.Response.HeadersSize = int64(len(connectEstablished))
+	e.store.Update(flow, FlowEventUpdate)
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent = pipe(upConn, io.MultiReader(buf.Reader, conn))
+	}()
+	go func() {
+		defer wg.Done()
+		received = pipe(conn, upConn)
+	}()
+	wg.Wait()
+
+	flow.Request.Size = sent
+	flow.Response.Size = received
+	flow.Timestamps.ResponseDone = time.Now()
+	flow.State = FlowStateComplete
+	e.addons.FireResponse(flow)
+	e.addons.FireComplete(flow)
+	e.store.Update(flow, FlowEventComplete)
+}
+
+// newTunnelFlow adds a flow recording the CONNECT request r.
+func (e *Engine) newTunnelFlow(r *http.Request) *Flow {
+	flow := e.newFlow(r, r.Host)
+	flow.Request.URL = r.Host
+	flow.Request.HeadersSize = flow.Request.headerBytes()
+	flow.Tags = append(flow.Tags, tunnelTag)
+	e.store.Add(flow)
+	return flow
+}
+
+// pipe copies src to dst, then closes dst for writing so the peer sees EOF.
+func pipe(dst net.Conn, src io.Reader) int64 {
+	n, _ := io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+	return n
+}
+
+func (e *Engine) failTunnel(flow *Flow, err error) {
+	flow.State = FlowStateError
+	flow.Error = err.Error()
+	flow.Timestamps.ResponseDone = time.Now()
+	e.addons.FireError(flow, err)
+	e.store.Update(flow, FlowEventError)
+}
+
+// interceptTunnel accepts the tunnel and serves HTTP inside it, over TLS with
+// a certificate from the local CA unless the client speaks plain HTTP. Each
+// request is forwarded to the CONNECT target as its own flow.
+func (e *Engine) interceptTunnel(hj http.Hijacker, r *http.Request) {
+	target := r.Host
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	if _, err := io.WriteString(conn, connectEstablished); err != nil {
+		conn.Close()
+		return
+	}
+
+	// A client that opens the tunnel and goes quiet would otherwise hold
+	// the goroutine and connection forever.
+	conn.SetReadDeadline(time.Now().Add(tunnelHandshakeTimeout))
+	var inner net.Conn = &bufferedConn{Conn: conn, r: buf.Reader}
+	scheme := "http"
+	if first, err := buf.Reader.Peek(1); err == nil && first[0] == 0x16 { // TLS handshake record
+		ca := e.mitmCA
+		tlsConn := tls.Server(inner, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"http/1.1"},
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				if hello.ServerName != "" {
+					return ca.Leaf(hello.ServerName)
+				}
+				return ca.Leaf(target)
+			},
+		})
+		if err := tlsConn.HandshakeContext(r.Context()); err != nil {
+			// Most likely the client doesn't trust the local CA; record it
+			// so the failure is visible in the UIs.
+			flow := e.newTunnelFlow(r)
+			e.failTunnel(flow, fmt.Errorf("TLS handshake with client: %w", err))
+			conn.Close()
+			return
+		}
+		inner, scheme = tlsConn, "https"
+	}
+	conn.SetReadDeadline(time.Time{}) // the inner server sets its own
+
+	host := target
+	if h, port, err := net.SplitHostPort(target); err == nil && (scheme == "https" && port == "443" || scheme == "http" && port == "80") {
+		host = h
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Scheme = scheme
+			r.URL.Host = host
+			e.forward(w, r)
+		}),
+		ReadHeaderTimeout: tunnelHandshakeTimeout,
+		IdleTimeout:       tunnelIdleTimeout,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	if !e.tunnels.add(srv) {
+		conn.Close() // shutting down
+		return
+	}
+	defer e.tunnels.remove(srv)
+	_ = srv.Serve(newConnListener(inner))
+}
+
+const (
+	// tunnelHandshakeTimeout bounds how long an intercepted tunnel waits
+	// for the client's TLS handshake, and then for each request's headers.
+	tunnelHandshakeTimeout = 10 * time.Second
+
+	// tunnelIdleTimeout closes an intercepted tunnel whose client keeps it
+	// open without sending another request.
+	tunnelIdleTimeout = 90 * time.Second
+)
+
+// tunnelServers tracks the servers running inside intercepted tunnels. They
+// serve hijacked connections, which the engine's own server doesn't know
+// about, so drain shuts them down through this set.
+type tunnelServers struct {
+	mu      sync.Mutex
+	servers map[*http.Server]struct{}
+	closed  bool
+}
+
+// add registers srv, or reports false once the set is closed.
+func (t *tunnelServers) add(srv *http.Server) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	if t.servers == nil {
+		t.servers = make(map[*http.Server]struct{})
+	}
+	t.servers[srv] = struct{}{}
+	return true
+}
+
+func (t *tunnelServers) remove(srv *http.Server) {
+	t.mu.Lock()
+	delete(t.servers, srv)
+	t.mu.Unlock()
+}
+
+// snapshot closes the set to new servers and returns the running ones.
+func (t *tunnelServers) snapshot() []*http.Server {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	servers := make([]*http.Server, 0, len(t.servers))
+	for srv := range t.servers {
+		servers = append(servers, srv)
+	}
+	return servers
+}
+
+// shutdown shuts every tunnel server down gracefully, in parallel, letting
+// requests in progress finish until ctx is done.
+func (t *tunnelServers) shutdown(ctx context.Context) error {
+	servers := t.snapshot()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// close closes every tunnel server and its connection.
+func (t *tunnelServers) close() {
+	for _, srv := range t.snapshot() {
+		_ = srv.Close()
+	}
+}
+
+// bufferedConn reads through the bufio.Reader left over from Hijack, which
+// may already hold the start of the client's stream.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// connListener is a net.Listener that yields a single connection, then
+// reports itself closed once that connection is, so http.Server.Serve can be
+// used on a hijacked tunnel.
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+	done chan struct{}
+	mu   sync.Mutex
+	used bool
+}
+
+func newConnListener(c net.Conn) *connListener {
+	return &connListener{conn: c, done: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	used := l.used
+	l.used = true
+	l.mu.Unlock()
+	if !used {
+		return &closeNotifyConn{Conn: l.conn, l: l}, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+type closeNotifyConn struct {
+	net.Conn
+	l *connListener
+}
+
+func (c *closeNotifyConn) Close() error {
+	err := c.Conn.Close()
+	c.l.Close()
+	return err
+}
+
+// isForwardURL reports whether a replayed request should bypass routing and
+// go to the host in its URL.
+func (e *Engine) isForwardURL(u *url.URL) bool {
+	return e.opts.Mode == ModeForward && u.IsAbs() && strings.HasPrefix(u.Scheme, "http")
+}
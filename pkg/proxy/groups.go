@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"time"
+)
+
+// FlowGroup summarises the flows sharing one request signature: the same
+// method, path template, and request body. Latencies are in milliseconds,
+// over the flows that have finished.
+type FlowGroup struct {
+	Signature string `json:"signature"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`               // template, e.g. /users/{id}
+	BodyHash  string `json:"bodyHash,omitempty"` // empty for requests without a body
+
+	Count    int         `json:"count"`
+	Statuses map[int]int `json:"statuses"` // flows by response status; 0 for no response
+	Errors   int         `json:"errors"`   // failed flows and 5xx responses
+	P50      float64     `json:"p50"`
+	P95      float64     `json:"p95"`
+	Max      float64     `json:"max"`
+	First    time.Time   `json:"first"`
+	Last     time.Time   `json:"last"`
+	Latest   string      `json:"latest"` // ID of the newest flow
+}
+
+// GroupFlows groups flows by request signature, busiest group first, so
+// repeated calls such as polling collapse into one row each.
+//
+// Paths are normalized with NormalizePath; the query string is ignored.
+// Bodies are hashed as captured, so two bodies differing only past
+// MaxBodySize fall in one group.
+func (e *Engine) GroupFlows(flows []*Flow) []FlowGroup {
+	index := make(map[string]int)
+	var groups []FlowGroup
+	var latencies [][]time.Duration
+	for _, f := range flows {
+		if f.Request == nil {
+			continue
+		}
+		method, path, hash := f.Request.Method, e.NormalizePath(f.Request.Path), bodyHash(f.Request.ReadBody())
+		sig := method + " " + path
+		if hash != "" {
+			sig += " #" + hash
+		}
+		i, ok := index[sig]
+		if !ok {
+			i = len(groups)
+			index[sig] = i
+			groups = append(groups, FlowGroup{Signature: sig, Method: method, Path: path, BodyHash: hash,
+				Statuses: make(map[int]int), First: f.Timestamps.Created})
+			latencies = append(latencies, nil)
+		}
+		g := &groups[i]
+		g.Count++
+		status := 0
+		if f.Response != nil {
+			status = f.Response.StatusCode
+		}
+		g.Statuses[status]++
+		if f.State == FlowStateError || f.State == FlowStateRejected || status >= 500 {
+			g.Errors++
+		}
+		if f.Timestamps.Created.Before(g.First) {
+			g.First = f.Timestamps.Created
+		}
+		if !f.Timestamps.Created.Before(g.Last) {
+			g.Last, g.Latest = f.Timestamps.Created, f.ID
+		}
+		if !f.Timestamps.ResponseDone.IsZero() {
+			latencies[i] = append(latencies[i], f.Duration())
+		}
+	}
+	for i := range groups {
+		if l := latencies[i]; len(l) > 0 {
+			slices.Sort(l)
+			groups[i].P50 = percentile(l, 0.50)
+			groups[i].P95 = percentile(l, 0.95)
+			groups[i].Max = millis(l[len(l)-1])
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b FlowGroup) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Signature, b.Signature))
+	})
+	return groups
+}
+
+// bodyHash returns a short hash of body, or "" if it is empty.
+func bodyHash(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:6])
+}
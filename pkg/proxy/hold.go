@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Upstreams with a HoldTimeout ride out restarts: when a request can't
+// connect, its target is marked down and probed until it accepts
+// connections again or, with a HealthCheck path, until a GET of that path
+// answers below 500. The request, and any others for the target meanwhile,
+// are held until then and sent as soon as it is back, or fail as usual once
+// HoldTimeout runs out. Held flows are tagged "held".
+
+// holdProbeInterval is how often a down target is probed.
+const holdProbeInterval = 200 * time.Millisecond
+
+// holdTransport sends requests through next, holding them while their
+// target is down.
+type holdTransport struct {
+	next     http.RoundTripper
+	e        *Engine
+	upstream string
+	timeout  time.Duration
+	health   string // path probed, or "" to dial
+
+	mu   sync.Mutex
+	down map[string]*downTarget // by scheme://host
+}
+
+// downTarget is a target being probed until it is back.
+type downTarget struct {
+	up       chan struct{} // closed once the target is back
+	lastWait time.Time     // when a request last waited; guarded by holdTransport.mu
+}
+
+func (t *holdTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	flow, _ := req.Context().Value(flowContextKey).(*Flow)
+	deadline := time.Now().Add(t.timeout)
+	held, err := t.wait(req, flow, deadline)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err == nil || !isDialError(err) || !replayable(req, flow) {
+		return resp, err
+	}
+	t.markDown(req)
+	if _, werr := t.wait(req, flow, deadline); werr != nil {
+		if held || errors.Is(werr, context.Canceled) {
+			return nil, werr
+		}
+		return nil, fmt.Errorf("%w (held %s)", err, t.timeout)
+	}
+	retry := req.Clone(req.Context())
+	retry.Body = http.NoBody
+	if flow != nil && flow.Request != nil && len(flow.Request.Body) > 0 {
+		body := flow.Request.Body
+		retry.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return t.next.RoundTrip(retry)
+}
+
+// wait holds req while its target is down, until deadline. It reports
+// whether the request was held.
+func (t *holdTransport) wait(req *http.Request, flow *Flow, deadline time.Time) (bool, error) {
+	key := req.URL.Scheme + "://" + req.URL.Host
+	t.mu.Lock()
+	d := t.down[key]
+	if d != nil {
+		d.lastWait = time.Now()
+	}
+	t.mu.Unlock()
+	if d == nil {
+		return false, nil
+	}
+	if flow != nil && !slices.Contains(flow.Tags, "held") {
+		flow.Tags = append(flow.Tags, "held")
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-d.up:
+		return true, nil
+	case <-req.Context().Done():
+		return true, req.Context().Err()
+	case <-timer.C:
+		return true, fmt.Errorf("upstream %q: %s still down after %s", t.upstream, req.URL.Host, t.timeout)
+	}
+}
+
+// markDown marks req's target down, if it isn't already, and probes it
+// until it is back.
+func (t *holdTransport) markDown(req *http.Request) {
+	key := req.URL.Scheme + "://" + req.URL.Host
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.down[key] != nil {
+		return
+	}
+	if t.down == nil {
+		t.down = make(map[string]*downTarget)
+	}
+	d := &downTarget{up: make(chan struct{}), lastWait: time.Now()}
+	t.down[key] = d
+	t.announce(req.URL.Host + " is down; holding requests")
+	go t.probe(key, req.URL, d)
+}
+
+// probe waits for a down target to come back, giving up once no request
+// has waited on it for a HoldTimeout, so the next one tries it afresh.
+func (t *holdTransport) probe(key string, target *url.URL, d *downTarget) {
+	for {
+		time.Sleep(holdProbeInterval)
+		if probeTarget(t.next, target, t.health) {
+			t.mu.Lock()
+			delete(t.down, key)
+			t.mu.Unlock()
+			close(d.up)
+			t.announce(target.Host + " is back")
+			return
+		}
+		t.mu.Lock()
+		idle := time.Since(d.lastWait) > t.timeout
+		if idle {
+			delete(t.down, key)
+		}
+		t.mu.Unlock()
+		if idle {
+			return
+		}
+	}
+}
+
+// probeTarget reports whether target is up: a GET of the health check path
+// through rt answers below 500, or, without one, its port accepts
+// connections.
+func probeTarget(rt http.RoundTripper, target *url.URL, health string) bool {
+	if health == "" {
+		conn, err := net.DialTimeout("tcp", hostPort(target), time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.Scheme+"://"+target.Host+health, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return resp.StatusCode < 500
+}
+
+// announce broadcasts a change in the upstream's health as a
+// FlowEventUpstream.
+func (t *holdTransport) announce(msg string) {
+	t.e.store.Notify(FlowEvent{
+		Type:    FlowEventUpstream,
+		Message: fmt.Sprintf("upstream %s: %s", t.upstream, msg),
+	})
+}
+
+// isDialError reports whether err is a failure to connect, so the request
+// was never sent.
+func isDialError(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// replayable reports whether req can be sent again after failing to
+// connect: it has no body, or its flow captured the body in full.
+func replayable(req *http.Request, flow *Flow) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	return flow != nil && flow.Request != nil && !flow.Request.BodyTruncated && len(req.Trailer) == 0
+}
+
+// hostPort is u's host and port, defaulting the port by scheme.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// serveLater starts an echoing server on addr after delay.
+func serveLater(t *testing.T, addr string, delay time.Duration) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+string(body))
+	}))
+	t.Cleanup(srv.Close)
+	go func() {
+		time.Sleep(delay)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("listen on %s: %v", addr, err)
+			return
+		}
+		srv.Listener = l
+		srv.Start()
+	}()
+}
+
+func newHoldTransport(timeout time.Duration) *holdTransport {
+	transport := &http.Transport{DisableKeepAlives: true}
+	return &holdTransport{
+		next:     transport,
+		e:        &Engine{store: NewFlowStore(10)},
+		upstream: "api",
+		timeout:  timeout,
+	}
+}
+
+func TestHoldTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		delay    time.Duration // until the upstream starts; 0 never starts it
+		timeout  time.Duration
+		want     string
+		wantHeld bool
+		wantErr  string
+	}{
+		{"held GET", "GET", "", 300 * time.Millisecond, 5 * time.Second, "GET ", true, ""},
+		{"held POST resends its body", "POST", "payload", 300 * time.Millisecond, 5 * time.Second, "POST payload", true, ""},
+		{"times out", "GET", "", 0, 300 * time.Millisecond, "", true, "held 300ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := freeAddr(t)
+			if tt.delay > 0 {
+				serveLater(t, addr, tt.delay)
+			}
+			ht := newHoldTransport(tt.timeout)
+			flow := &Flow{Request: &CapturedRequest{Method: tt.method, Body: []byte(tt.body)}}
+			ctx := context.WithValue(context.Background(), flowContextKey, flow)
+			req, err := http.NewRequestWithContext(ctx, tt.method, "http://"+addr+"/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := ht.RoundTrip(req)
+			if held := slices.Contains(flow.Tags, "held"); held != tt.wantHeld {
+				t.Errorf("held tag = %v, want %v", held, tt.wantHeld)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RoundTrip: err = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			defer resp.Body.Close()
+			if got, _ := io.ReadAll(resp.Body); string(got) != tt.want {
+				t.Errorf("upstream got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHoldTransportUpstreamUp(t *testing.T) {
+	addr := freeAddr(t)
+	serveLater(t, addr, 0)
+	time.Sleep(100 * time.Millisecond)
+	ht := newHoldTransport(time.Second)
+	flow := &Flow{Request: &CapturedRequest{Method: "GET"}}
+	ctx := context.WithValue(context.Background(), flowContextKey, flow)
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://"+addr+"/", nil)
+	resp, err := ht.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if slices.Contains(flow.Tags, "held") {
+		t.Error("a request to a running upstream was held")
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.Reader
+		flow *Flow
+		want bool
+	}{
+		{"no body", nil, nil, true},
+		{"captured body", strings.NewReader("x"), &Flow{Request: &CapturedRequest{Body: []byte("x")}}, true},
+		{"truncated body", strings.NewReader("x"), &Flow{Request: &CapturedRequest{BodyTruncated: true}}, false},
+		{"body without a flow", strings.NewReader("x"), nil, false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "http://api.test/", tt.body)
+		if got := replayable(req, tt.flow); got != tt.want {
+			t.Errorf("%s: replayable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://api.test", "api.test:80"},
+		{"https://api.test", "api.test:443"},
+		{"http://api.test:8080", "api.test:8080"},
+		{"http://[::1]:9000", "[::1]:9000"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := hostPort(u); got != tt.want {
+			t.Errorf("hostPort(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
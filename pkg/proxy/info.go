@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Info describes where a running proxy bound, for scripts discovering it:
+// with Options.AutoPort these can differ from the configured ports.
+type Info struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	Mode    string    `json:"mode"` // ModeReverse or ModeForward
+
+	// Listen lists the proxy's bound addresses, e.g. "127.0.0.1:9092" or
+	// "unix:///tmp/http-proxy.sock".
+	Listen []string `json:"listen"`
+
+	// ProxyURL is the URL of the first TCP listener, as a client on this
+	// machine reaches it.
+	ProxyURL string `json:"proxyUrl,omitempty"`
+
+	// LANURLs reach that listener from other devices, one per IPv4 address
+	// of this machine's network interfaces, for pointing a phone at the
+	// proxy. Empty if it only listens on loopback.
+	LANURLs []string `json:"lanUrls,omitempty"`
+
+	// WebPort and WebURL locate the web UI and API, once it has bound
+	// (see SetWebPort); zero and empty without one.
+	WebPort int    `json:"webPort,omitempty"`
+	WebURL  string `json:"webUrl,omitempty"`
+}
+
+// boundAddrs records what Listen and SetWebPort bound.
+type boundAddrs struct {
+	mu      sync.Mutex
+	started time.Time
+	listen  []net.Listener
+	webPort int
+}
+
+// Listen binds the proxy's listeners, so Info reports them before Start
+// serves on them; Start calls it if it hasn't been. With Options.AutoPort a
+// busy port is replaced by the next free one.
+func (e *Engine) Listen() error {
+	e.bound.mu.Lock()
+	defer e.bound.mu.Unlock()
+	if e.bound.listen != nil {
+		return nil
+	}
+	listeners, err := listenAll(e.opts.ListenAddrs(), e.opts.AutoPort)
+	if err != nil {
+		return err
+	}
+	e.bound.listen = listeners
+	e.bound.started = time.Now()
+	return nil
+}
+
+// listeners returns the listeners bound by Listen.
+func (e *Engine) listeners() []net.Listener {
+	e.bound.mu.Lock()
+	defer e.bound.mu.Unlock()
+	return e.bound.listen
+}
+
+// SetWebPort records the port the web UI bound, for Info.
+func (e *Engine) SetWebPort(port int) {
+	e.bound.mu.Lock()
+	defer e.bound.mu.Unlock()
+	e.bound.webPort = port
+}
+
+// Info describes the running proxy. Listen and ProxyURL are empty until
+// Listen has been called.
+func (e *Engine) Info() Info {
+	e.bound.mu.Lock()
+	defer e.bound.mu.Unlock()
+	info := Info{PID: os.Getpid(), Started: e.bound.started, Mode: e.opts.Mode, WebPort: e.bound.webPort}
+	if info.Mode == "" {
+		info.Mode = ModeReverse
+	}
+	scheme := "http"
+	if e.opts.TLS {
+		scheme = "https"
+	}
+	for _, ln := range e.bound.listen {
+		addr := ln.Addr()
+		if addr.Network() == "unix" {
+			info.Listen = append(info.Listen, "unix://"+addr.String())
+			continue
+		}
+		info.Listen = append(info.Listen, addr.String())
+		if tcp, ok := addr.(*net.TCPAddr); ok && info.ProxyURL == "" {
+			info.ProxyURL = fmt.Sprintf("%s://localhost:%d", scheme, tcp.Port)
+			for _, ip := range lanIPs() {
+				if tcp.IP.IsUnspecified() || tcp.IP.Equal(ip) {
+					info.LANURLs = append(info.LANURLs, fmt.Sprintf("%s://%s:%d", scheme, ip, tcp.Port))
+				}
+			}
+		}
+	}
+	if info.WebPort != 0 {
+		info.WebURL = "http://localhost:" + strconv.Itoa(info.WebPort)
+	}
+	return info
+}
+
+// lanIPs returns the IPv4 addresses of the machine's network interfaces
+// that are up, other than loopback and link-local ones.
+func lanIPs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip := ipnet.IP.To4(); ip != nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+				out = append(out, ip)
+			}
+		}
+	}
+	return out
+}
+
+// DefaultInfoFile returns the default location of the info file, in the
+// user's config directory.
+func DefaultInfoFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "http-proxy", "running.json")
+}
+
+// WriteInfoFile writes info to path as JSON, creating its directory.
+func WriteInfoFile(path string, info Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadInfoFile reads an info file written by WriteInfoFile.
+func ReadInfoFile(path string) (Info, error) {
+	var info Info
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("info file %s: %w", path, err)
+	}
+	return info, nil
+}
+
+// RemoveInfoFile removes the info file at path if it was written by this
+// process, leaving one another proxy has since taken over.
+func RemoveInfoFile(path string) error {
+	info, err := ReadInfoFile(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.PID != os.Getpid() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
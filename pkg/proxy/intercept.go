@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Matcher is a predicate over a flow. filter.Filter values satisfy it.
+type Matcher func(flow *Flow) bool
+
+// interceptConfig holds the engine's intercept toggle and match predicate.
+type interceptConfig struct {
+	mu      sync.RWMutex
+	enabled bool
+	expr    string
+	match   Matcher
+}
+
+// InterceptStatus describes the current intercept configuration.
+type InterceptStatus struct {
+	Enabled bool   `json:"enabled"`
+	Filter  string `json:"filter"`
+}
+
+// RequestEdit describes changes to a captured request. Nil/empty fields are
+// left untouched. Body is plain text rather than base64 for easy editing.
+type RequestEdit struct {
+	Method  *string     `json:"method,omitempty"`
+	URL     *string     `json:"url,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    *string     `json:"body,omitempty"`
+}
+
+// Apply mutates cr according to the edit.
+func (e RequestEdit) Apply(cr *CapturedRequest) error {
+	if e.Method != nil && *e.Method != "" {
+		cr.Method = *e.Method
+	}
+	if e.URL != nil && *e.URL != "" {
+		u, err := url.Parse(*e.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url %q: %w", *e.URL, err)
+		}
+		cr.URL = u.String()
+		cr.Path = u.Path
+	}
+	if e.Headers != nil {
+		cr.Headers = e.Headers.Clone()
+	}
+	if e.Body != nil {
+		cr.Body = []byte(*e.Body)
+		cr.BodyTruncated = false
+	}
+	return nil
+}
+
+// IsZero reports whether the edit changes nothing.
+func (e RequestEdit) IsZero() bool {
+	return e.Method == nil && e.URL == nil && e.Headers == nil && e.Body == nil
+}
+
+// SetIntercept enables intercept mode. Requests for which match returns true
+// are paused after the request hooks run until resumed or killed. A nil match
+// intercepts every request; expr is kept for display only.
+func (e *Engine) SetIntercept(expr string, match Matcher) {
+	e.intercept.mu.Lock()
+	defer e.intercept.mu.Unlock()
+	e.intercept.enabled = true
+	e.intercept.expr = expr
+	e.intercept.match = match
+}
+
+// ClearIntercept disables intercept mode. Already-paused flows stay paused.
+func (e *Engine) ClearIntercept() {
+	e.intercept.mu.Lock()
+	defer e.intercept.mu.Unlock()
+	e.intercept.enabled = false
+	e.intercept.expr = ""
+	e.intercept.match = nil
+}
+
+// Intercept returns the current intercept configuration.
+func (e *Engine) Intercept() InterceptStatus {
+	e.intercept.mu.RLock()
+	defer e.intercept.mu.RUnlock()
+	return InterceptStatus{Enabled: e.intercept.enabled, Filter: e.intercept.expr}
+}
+
+// shouldIntercept reports whether flow matches the active intercept filter.
+func (e *Engine) shouldIntercept(flow *Flow) bool {
+	e.intercept.mu.RLock()
+	defer e.intercept.mu.RUnlock()
+	if !e.intercept.enabled {
+		return false
+	}
+	return e.intercept.match == nil || e.intercept.match(flow)
+}
+
+// Resume releases an intercepted flow to its upstream.
+func (e *Engine) Resume(flowID string) error {
+	flow, err := e.interceptedFlow(flowID)
+	if err != nil {
+		return err
+	}
+	flow.Resume()
+	e.store.Update(flow, FlowEventUpdate)
+	return nil
+}
+
+// Kill aborts an intercepted flow; the client receives a 502.
+func (e *Engine) Kill(flowID string) error {
+	flow, err := e.interceptedFlow(flowID)
+	if err != nil {
+		return err
+	}
+	flow.Kill()
+	return nil
+}
+
+// EditRequest modifies the request of an intercepted flow before it is
+// resumed. The flow was routed before it paused, so its URL may change only
+// in path and query; an edit naming another scheme or host is refused.
+func (e *Engine) EditRequest(flowID string, edit RequestEdit) (*Flow, error) {
+	flow, err := e.interceptedFlow(flowID)
+	if err != nil {
+		return nil, err
+	}
+	flow.mu.Lock()
+	switch {
+	case flow.Response != nil:
+		err = fmt.Errorf("flow %q is paused at its response; its request was already sent", flowID)
+	case edit.URL != nil && *edit.URL != "":
+		err = checkSameOrigin(*edit.URL, flow.Request.URL)
+	}
+	if err == nil {
+		err = edit.Apply(flow.Request)
+	}
+	flow.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	e.store.Update(flow, FlowEventUpdate)
+	return flow, nil
+}
+
+func (e *Engine) interceptedFlow(flowID string) (*Flow, error) {
+	flow := e.store.Get(flowID)
+	if flow == nil {
+		return nil, fmt.Errorf("flow %q not found", flowID)
+	}
+	flow.mu.Lock()
+	state := flow.State
+	flow.mu.Unlock()
+	if state != FlowStateIntercepted {
+		return nil, fmt.Errorf("flow %q is not intercepted", flowID)
+	}
+	return flow, nil
+}
+
+// pause blocks until an intercepted flow is resumed or killed. If the client
+// goes away first the flow is killed so the handler goroutine is released.
+func (e *Engine) pause(r *http.Request, flow *Flow) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			flow.Kill()
+		case <-done:
+		}
+	}()
+	// Hold before publishing so a fast Resume cannot race the pause.
+	ch := flow.hold()
+	e.store.Update(flow, FlowEventUpdate)
+	<-ch
+}
+
+// checkSameOrigin returns an error if rawURL names a scheme or host other
+// than orig's. A URL without either keeps orig's.
+func checkSameOrigin(rawURL, orig string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	o, err := url.Parse(orig)
+	if err != nil {
+		return err
+	}
+	if sameOrigin(u, o) {
+		return nil
+	}
+	return fmt.Errorf("url %q changes the scheme or host of %q; an intercepted request was already routed, so only its path and query can change", rawURL, orig)
+}
+
+// sameOrigin reports whether u has no scheme and host, or orig's.
+func sameOrigin(u, orig *url.URL) bool {
+	if u.Scheme == "" && u.Host == "" {
+		return true
+	}
+	return strings.EqualFold(u.Scheme, orig.Scheme) && strings.EqualFold(u.Host, orig.Host)
+}
+
+// applyCapturedRequest copies a (possibly edited) captured request back onto
+// r: method, path and query from URL, headers, and body. Path is updated to
+// match URL. The request has been routed, so a URL with another scheme or
+// host than r's is an error rather than being silently dropped.
+func applyCapturedRequest(r *http.Request, cr *CapturedRequest) error {
+	u, err := url.Parse(cr.URL)
+	if err != nil {
+		return err
+	}
+	if !sameOrigin(u, r.URL) {
+		return fmt.Errorf("url %q changes the scheme or host of %q; only the path and query can change", cr.URL, r.URL)
+	}
+	r.Method = cr.Method
+	r.URL.Path = u.Path
+	r.URL.RawPath = u.RawPath
+	r.URL.RawQuery = u.RawQuery
+	r.Header = cr.Headers.Clone()
+	cr.Path = u.Path
+	if cr.BodyTruncated {
+		// The body wasn't edited and only a prefix was captured; keep
+		// streaming the original.
+		return nil
+	}
+	r.Body = http.NoBody
+	if len(cr.Body) > 0 {
+		r.Body = io.NopCloser(bytes.NewReader(cr.Body))
+	}
+	if len(r.Trailer) == 0 {
+		// With trailers the body stays chunked so they can follow it.
+		r.ContentLength = int64(len(cr.Body))
+	}
+	cr.Size = int64(len(cr.Body))
+	cr.HeadersSize = cr.headerBytes()
+	return nil
+}
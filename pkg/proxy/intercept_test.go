@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyCapturedRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string // the incoming request's URL
+		url      string // the captured, possibly edited, URL
+		wantPath string
+		wantErr  bool
+	}{
+		{"path and query", "/items", "/items/2?expand=1", "/items/2", false},
+		{"absolute, same origin", "http://api.test/items", "http://api.test/other", "/other", false},
+		{"another host", "/items", "http://evil.test/items", "", true},
+		{"another host, forward mode", "http://api.test/items", "http://evil.test/items", "", true},
+		{"another scheme", "http://api.test/items", "https://api.test/items", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			cr := &CapturedRequest{Method: "GET", URL: tt.url, Headers: http.Header{}}
+			err := applyCapturedRequest(r, cr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && r.URL.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q", r.URL.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestCheckSameOrigin(t *testing.T) {
+	tests := []struct {
+		edit, orig string
+		wantErr    bool
+	}{
+		{"/new?q=1", "/old", false},
+		{"/new", "http://api.test/old", false},
+		{"http://API.test/new", "http://api.test/old", false},
+		{"http://other.test/new", "http://api.test/old", true},
+		{"https://api.test/new", "http://api.test/old", true},
+		{"http://api.test/new", "/old", true},
+	}
+	for _, tt := range tests {
+		if err := checkSameOrigin(tt.edit, tt.orig); (err != nil) != tt.wantErr {
+			t.Errorf("checkSameOrigin(%q, %q) = %v, want error %v", tt.edit, tt.orig, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobState is the lifecycle state of a bulk replay job.
+type JobState string
+
+const (
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobCancelled JobState = "cancelled"
+)
+
+// Replay orders accepted by BulkReplayOptions.Order.
+const (
+	OrderRecorded = "recorded" // oldest first (default)
+	OrderReverse  = "reverse"  // newest first
+	OrderRandom   = "random"
+)
+
+// BulkReplayOptions configures Engine.BulkReplay.
+type BulkReplayOptions struct {
+	// Match selects the flows to replay; nil selects every stored flow.
+	// Filter is the expression Match was built from, kept for display.
+	Match  Matcher
+	Filter string
+
+	Concurrency int           // requests in flight at once (default 1)
+	Delay       time.Duration // pause between starting consecutive requests
+	Order       string        // OrderRecorded, OrderReverse, or OrderRandom
+	Target      string        // see ReplayOptions.Target
+	Assert      *Assertions   // see ReplayOptions.Assert; replays failing them count as failed
+
+	schedule string                            // the scheduled job starting the run, if any
+	expect   func(replay, original *Flow) bool // fails replays it rejects; nil fails only errors
+	done     func(ReplayJob)                   // called with the final snapshot
+}
+
+// ReplayJob reports the progress of a bulk replay. Values returned by the
+// engine are snapshots; progress is also broadcast as FlowEventJob events.
+type ReplayJob struct {
+	ID       string    `json:"id"`
+	Filter   string    `json:"filter,omitempty"`
+	State    JobState  `json:"state"`
+	Total    int       `json:"total"`
+	Done     int       `json:"done"`
+	Failed   int       `json:"failed"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitzero"`
+
+	// FailedChecks counts the replays failing each assertion check, by
+	// AssertionFailure.Check.
+	FailedChecks map[string]int `json:"failedChecks,omitempty"`
+
+	// Schedule names the scheduled job this is a run of, if any.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// maxFinishedJobs bounds the finished jobs kept for Job; the ones that
+// finished first are forgotten first.
+const maxFinishedJobs = 100
+
+// jobTable holds the engine's bulk replay jobs.
+type jobTable struct {
+	mu      sync.Mutex
+	jobs    map[string]*ReplayJob
+	cancels map[string]context.CancelFunc
+}
+
+// BulkReplay replays every stored flow selected by opts in the background
+// and returns the new job. Each replayed flow is tagged "job:<id>".
+func (e *Engine) BulkReplay(opts BulkReplayOptions) (ReplayJob, error) {
+	var flows []*Flow
+	for _, f := range e.store.All() {
+		if f.Request != nil && (opts.Match == nil || opts.Match(f)) {
+			flows = append(flows, f)
+		}
+	}
+	return e.startJob(flows, opts)
+}
+
+// startJob orders flows as opts asks and replays them in the background.
+func (e *Engine) startJob(flows []*Flow, opts BulkReplayOptions) (ReplayJob, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Delay < 0 {
+		return ReplayJob{}, fmt.Errorf("delay must be >= 0")
+	}
+	if err := opts.Assert.Validate(); err != nil {
+		return ReplayJob{}, err
+	}
+	switch opts.Order {
+	case "", OrderRecorded:
+	case OrderReverse:
+		slices.Reverse(flows)
+	case OrderRandom:
+		rand.Shuffle(len(flows), func(i, j int) { flows[i], flows[j] = flows[j], flows[i] })
+	default:
+		return ReplayJob{}, fmt.Errorf("unknown order %q (want %s, %s, or %s)", opts.Order, OrderRecorded, OrderReverse, OrderRandom)
+	}
+
+	job := &ReplayJob{
+		ID:       uuid.New().String(),
+		Filter:   opts.Filter,
+		State:    JobRunning,
+		Total:    len(flows),
+		Started:  time.Now(),
+		Schedule: opts.schedule,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e.jobs.mu.Lock()
+	if e.jobs.jobs == nil {
+		e.jobs.jobs = make(map[string]*ReplayJob)
+		e.jobs.cancels = make(map[string]context.CancelFunc)
+	}
+	e.jobs.jobs[job.ID] = job
+	e.jobs.cancels[job.ID] = cancel
+	snap := *job
+	e.jobs.mu.Unlock()
+	e.store.Notify(FlowEvent{Type: FlowEventJob, Job: &snap})
+
+	go e.runJob(ctx, job, flows, opts)
+	return snap, nil
+}
+
+// runJob replays flows with at most opts.Concurrency requests in flight.
+func (e *Engine) runJob(ctx context.Context, job *ReplayJob, flows []*Flow, opts BulkReplayOptions) {
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+
+dispatch:
+	for i, f := range flows {
+		if i > 0 && opts.Delay > 0 {
+			select {
+			case <-time.After(opts.Delay):
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// Replay from the snapshot rather than by ID: the job's own flows
+			// may evict the originals from the store while it runs.
+			ro := ReplayOptions{
+				Target:   opts.Target,
+				Tags:     []string{"replay", "replay:" + f.ID, "job:" + job.ID},
+				ReplayOf: f.ID,
+				Assert:   opts.Assert,
+			}
+			if opts.schedule != "" {
+				ro.Tags = append(ro.Tags, "schedule:"+opts.schedule)
+			}
+			res, err := e.ReplayRequest(f.Request, ro)
+			failed := err != nil || res == nil || res.State == FlowStateError || res.State == FlowStateRejected
+			if !failed && opts.expect != nil && !opts.expect(res, f) {
+				failed = true
+				_, _ = e.TagFlow(res.ID, []string{"job-failed"}, nil)
+			}
+			var checks *AssertionResult
+			if res != nil {
+				checks = res.Assertions
+			}
+			e.updateJob(job, func(j *ReplayJob) {
+				j.Done++
+				if checks != nil && !checks.Passed {
+					failed = true
+					if j.FailedChecks == nil {
+						j.FailedChecks = make(map[string]int)
+					}
+					for _, c := range checks.Failures {
+						j.FailedChecks[c.Check]++
+					}
+				}
+				if failed {
+					j.Failed++
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	snap := e.updateJob(job, func(j *ReplayJob) {
+		j.State = JobDone
+		if ctx.Err() != nil {
+			j.State = JobCancelled
+		}
+		j.Finished = time.Now()
+	})
+
+	e.jobs.mu.Lock()
+	if cancel := e.jobs.cancels[job.ID]; cancel != nil {
+		cancel()
+		delete(e.jobs.cancels, job.ID)
+	}
+	e.jobs.prune()
+	e.jobs.mu.Unlock()
+	if opts.done != nil {
+		opts.done(snap)
+	}
+}
+
+// prune forgets the earliest finished jobs beyond maxFinishedJobs. t.mu
+// must be held.
+func (t *jobTable) prune() {
+	var finished []*ReplayJob
+	for _, j := range t.jobs {
+		if j.State != JobRunning {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	slices.SortFunc(finished, func(a, b *ReplayJob) int { return a.Finished.Compare(b.Finished) })
+	for _, j := range finished[:len(finished)-maxFinishedJobs] {
+		delete(t.jobs, j.ID)
+	}
+}
+
+// updateJob mutates job under the table lock, broadcasts a snapshot, and
+// returns it.
+func (e *Engine) updateJob(job *ReplayJob, fn func(*ReplayJob)) ReplayJob {
+	e.jobs.mu.Lock()
+	fn(job)
+	snap := *job
+	snap.FailedChecks = maps.Clone(job.FailedChecks)
+	e.jobs.mu.Unlock()
+	e.store.Notify(FlowEvent{Type: FlowEventJob, Job: &snap})
+	return snap
+}
+
+// Job returns a snapshot of the job with the given ID.
+func (e *Engine) Job(id string) (ReplayJob, bool) {
+	e.jobs.mu.Lock()
+	defer e.jobs.mu.Unlock()
+	job, ok := e.jobs.jobs[id]
+	if !ok {
+		return ReplayJob{}, false
+	}
+	snap := *job
+	snap.FailedChecks = maps.Clone(job.FailedChecks)
+	return snap, true
+}
+
+// CancelJob stops a running job. Requests already in flight complete.
+func (e *Engine) CancelJob(id string) error {
+	e.jobs.mu.Lock()
+	defer e.jobs.mu.Unlock()
+	if _, ok := e.jobs.jobs[id]; !ok {
+		return fmt.Errorf("job %q not found", id)
+	}
+	cancel, ok := e.jobs.cancels[id]
+	if !ok {
+		return fmt.Errorf("job %q is not running", id)
+	}
+	cancel()
+	return nil
+}
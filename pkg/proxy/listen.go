@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// maxPortTries is how many ports past a busy one ListenAuto tries.
+const maxPortTries = 100
+
+// splitListenAddr returns the network and address for a listen address:
+// "unix" for "unix:///path" (or "unix:path"), "tcp" otherwise.
+func splitListenAddr(addr string) (network, address string) {
+	if rest, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", strings.TrimPrefix(rest, "//")
+	}
+	return "tcp", addr
+}
+
+// listenAll opens a listener for every address. If any fails, those already
+// opened are closed. With auto, a busy TCP port is replaced by the next free
+// one (see ListenAuto).
+func listenAll(addrs []string, auto bool) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		var ln net.Listener
+		var err error
+		if auto {
+			ln, err = ListenAuto(addr)
+		} else {
+			ln, err = listen(addr)
+		}
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	network, address := splitListenAddr(addr)
+	if network == "unix" {
+		if address == "" {
+			return nil, errors.New("missing socket path")
+		}
+		// A socket left behind by a crashed run would make Listen fail;
+		// remove it, but never a regular file.
+		if fi, err := os.Lstat(address); err == nil && fi.Mode().Type() == fs.ModeSocket {
+			os.Remove(address)
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// ListenAuto listens on addr like listen, but if its TCP port is in use it
+// tries the following ports, up to maxPortTries of them, and listens on the
+// first free one. Unix sockets and port 0 are listened on as given.
+func ListenAuto(addr string) (net.Listener, error) {
+	ln, err := listen(addr)
+	if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+		return ln, err
+	}
+	host, port, splitErr := net.SplitHostPort(addr)
+	n, atoiErr := strconv.Atoi(port)
+	if splitErr != nil || atoiErr != nil || n == 0 {
+		return nil, err
+	}
+	for next := n + 1; next <= n+maxPortTries && next <= 65535; next++ {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(next)))
+		if err == nil {
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w, as are the next %d ports", err, maxPortTries)
+}
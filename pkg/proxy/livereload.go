@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// LiveReload refreshes the browsers showing proxied pages when a watched
+// upstream restarts. The proxy adds a small script to HTML responses that
+// connects to a WebSocket at Path on the proxy's own listener, and sends
+// "reload" down it once the upstream is back: when its Command opens its
+// port again or, for other upstreams, when a health check (the upstream's
+// HealthCheck, or its target's port) passes after failing.
+type LiveReload struct {
+	// Path is the WebSocket endpoint (default "/livereload"). Requests to it
+	// are answered by the proxy, never forwarded or captured.
+	Path string
+
+	// Upstreams lists the upstreams watched; empty watches them all.
+	Upstreams []string
+}
+
+const (
+	defaultLiveReloadPath = "/livereload"
+
+	// liveReloadInterval is how often upstreams without a Command are
+	// health checked while browsers are connected.
+	liveReloadInterval = 500 * time.Millisecond
+)
+
+// validate checks lr against the upstreams and fills in its defaults.
+func (lr *LiveReload) validate(upstreams []Upstream) error {
+	if lr.Path == "" {
+		lr.Path = defaultLiveReloadPath
+	}
+	if lr.Path[0] != '/' {
+		return fmt.Errorf("live_reload path must start with /, got %q", lr.Path)
+	}
+	for _, name := range lr.Upstreams {
+		if !slices.ContainsFunc(upstreams, func(u Upstream) bool { return u.Name == name }) {
+			return fmt.Errorf("live_reload: unknown upstream %q", name)
+		}
+	}
+	return nil
+}
+
+// watches reports whether a restart of the named upstream reloads browsers.
+func (lr *LiveReload) watches(upstream string) bool {
+	return len(lr.Upstreams) == 0 || slices.Contains(lr.Upstreams, upstream)
+}
+
+// liveReloadScript is added to HTML responses; %s is the endpoint path as
+// a JSON string. It reconnects when the proxy goes away, such as on restart.
+const liveReloadScript = `<script>/* http-proxy live reload */(function(){` +
+	`var u=(location.protocol==="https:"?"wss://":"ws://")+location.host+%s;` +
+	`function c(){var w=new WebSocket(u);` +
+	`w.onmessage=function(e){if(e.data==="reload")location.reload()};` +
+	`w.onclose=function(){setTimeout(c,1000)}}c()})();</script>`
+
+// liveReloadHub holds the connected browsers.
+type liveReloadHub struct {
+	mu    sync.Mutex // also serializes writes to the connections
+	conns map[*websocket.Conn]bool
+}
+
+var liveReloadUpgrader = websocket.Upgrader{
+	CheckOrigin: func(_ *http.Request) bool { return true },
+}
+
+// serveLiveReload keeps a browser's WebSocket open until it goes away.
+func (e *Engine) serveLiveReload(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "live reload expects a WebSocket", http.StatusBadRequest)
+		return
+	}
+	conn, err := liveReloadUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	h := &e.live
+	h.mu.Lock()
+	if h.conns == nil {
+		h.conns = make(map[*websocket.Conn]bool)
+	}
+	h.conns[conn] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.conns, conn)
+		h.mu.Unlock()
+		conn.Close()
+	}()
+	conn.SetReadLimit(512)
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// connected reports whether any browser is listening.
+func (h *liveReloadHub) connected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns) > 0
+}
+
+// broadcast sends msg to every browser.
+func (h *liveReloadHub) broadcast(msg string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.conns {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			conn.Close() // its read loop unregisters it
+		}
+	}
+}
+
+// closeAll disconnects every browser.
+func (h *liveReloadHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.conns {
+		conn.Close()
+	}
+}
+
+// upstreamRestarted reloads the browsers if live reload watches upstream.
+func (e *Engine) upstreamRestarted(upstream string) {
+	lr := e.routing.Load().opts.LiveReload
+	if lr == nil || !lr.watches(upstream) || !e.live.connected() {
+		return
+	}
+	log.Printf("live reload: %s restarted, reloading browsers", upstream)
+	e.live.broadcast("reload")
+}
+
+// watchLiveReload health checks the watched upstreams that have no Command
+// while browsers are connected, and reloads them when one comes back after
+// failing a check. It returns when ctx is done.
+func (e *Engine) watchLiveReload(ctx context.Context) {
+	defer e.live.closeAll()
+	up := make(map[string]bool)
+	ticker := time.NewTicker(liveReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rt := e.routing.Load()
+		lr := rt.opts.LiveReload
+		if lr == nil || !e.live.connected() {
+			clear(up)
+			continue
+		}
+		for i := range rt.router.upstreams {
+			u := &rt.router.upstreams[i]
+			if u.Command != "" || u.Passthrough() || !lr.watches(u.Name) {
+				continue
+			}
+			var transport http.RoundTripper = http.DefaultTransport
+			if u.transport != nil {
+				transport = u.transport
+			}
+			ok := probeTarget(transport, u.parsed, u.HealthCheck)
+			if was, seen := up[u.Name]; seen && !was && ok {
+				e.upstreamRestarted(u.Name)
+			}
+			up[u.Name] = ok
+		}
+	}
+}
+
+// liveReloadAddon adds the live reload script to HTML responses, before
+// their closing </body> tag or else at the end.
+type liveReloadAddon struct {
+	e *Engine
+}
+
+// Name identifies the addon in the addon list.
+func (liveReloadAddon) Name() string { return "live-reload" }
+
+// Rewrites reports whether live reload is on and flow's response is a page.
+func (a liveReloadAddon) Rewrites(flow *Flow) bool {
+	return a.e.routing.Load().opts.LiveReload != nil && IsInjectableHTML(flow)
+}
+
+// Rewrite adds the script to body.
+func (a liveReloadAddon) Rewrite(_ *Flow, body []byte) []byte {
+	lr := a.e.routing.Load().opts.LiveReload
+	if lr == nil {
+		return body
+	}
+	path, _ := json.Marshal(lr.Path)
+	return InjectHTML(body, fmt.Sprintf(liveReloadScript, path))
+}
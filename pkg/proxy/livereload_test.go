@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// bannerAddon stands in for the inject addon.
+type bannerAddon struct{}
+
+func (bannerAddon) Rewrites(flow *Flow) bool { return IsInjectableHTML(flow) }
+
+func (bannerAddon) Rewrite(_ *Flow, body []byte) []byte { return InjectHTML(body, "<p>banner</p>") }
+
+func TestRewriteResponseLiveReload(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		io.WriteString(zw, s)
+		zw.Close()
+		return b.Bytes()
+	}
+	tests := []struct {
+		name     string
+		method   string
+		status   int
+		ctype    string
+		encoding string
+		body     []byte
+		want     string // "" for a body passed on unchanged
+	}{
+		{"page", "GET", 200, "text/html; charset=utf-8", "", []byte("<html><body>hi</body></html>"), "<html><body>hiSCRIPT<p>banner</p></body></html>"},
+		{"gzipped page", "GET", 200, "text/html", "gzip", gzipped("<body>hi</body>"), "<body>hiSCRIPT<p>banner</p></body>"},
+		{"no closing tag", "GET", 200, "text/html", "", []byte("hi"), "hiSCRIPT<p>banner</p>"},
+		{"json", "GET", 200, "application/json", "", []byte(`{"a":1}`), ""},
+		{"head", "HEAD", 200, "text/html", "", []byte("<body></body>"), ""},
+		{"not modified", "GET", 304, "text/html", "", []byte("<body></body>"), ""},
+		{"no content", "GET", 204, "text/html", "", []byte("<body></body>"), ""},
+	}
+	e, err := New(Options{
+		Upstreams:  []Upstream{{Name: "web", Prefix: "/", Target: "http://localhost:1"}},
+		LiveReload: &LiveReload{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Addons().Add(bannerAddon{})
+	script := strings.Replace(liveReloadScript, "%s", `"/livereload"`, 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := &Flow{Request: &CapturedRequest{Method: tt.method, Headers: http.Header{}}}
+			header := http.Header{"Content-Type": {tt.ctype}, "Etag": {`"v1"`}}
+			if tt.encoding != "" {
+				header.Set("Content-Encoding", tt.encoding)
+			}
+			resp := &http.Response{StatusCode: tt.status, Header: header, Body: io.NopCloser(bytes.NewReader(tt.body))}
+			e.rewriteResponse(flow, resp)
+
+			got, _ := io.ReadAll(resp.Body)
+			if tt.want == "" {
+				if !bytes.Equal(got, tt.body) || resp.Header.Get("ETag") == "" {
+					t.Errorf("response was rewritten to %q", got)
+				}
+				return
+			}
+			if want := strings.Replace(tt.want, "SCRIPT", script, 1); string(got) != want {
+				t.Errorf("body = %q, want %q", got, want)
+			}
+			if resp.Header.Get("ETag") != "" || resp.Header.Get("Content-Encoding") != "" {
+				t.Errorf("rewritten response kept ETag %q, Content-Encoding %q", resp.Header.Get("ETag"), resp.Header.Get("Content-Encoding"))
+			}
+			if resp.ContentLength != int64(len(got)) {
+				t.Errorf("Content-Length = %d, body is %d bytes", resp.ContentLength, len(got))
+			}
+		})
+	}
+}
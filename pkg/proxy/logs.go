@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLogLines is how many lines of the engine's log are kept.
+const maxLogLines = 2000
+
+// LogLine is a line of the engine's log: messages from the proxy itself and
+// from anything else written to LogWriter, such as the standard logger.
+type LogLine struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// logBuffer keeps the last maxLogLines lines written to it.
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []LogLine // ring of the last maxLogLines
+	next    int       // ring position once full
+	partial []byte    // an unfinished line
+	out     io.Writer // also receives each line, if set
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.partial = append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(strings.TrimRight(string(b.partial[:i]), "\r"))
+		b.partial = b.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// add records a line; b.mu is held.
+func (b *logBuffer) add(text string) {
+	line := LogLine{Time: time.Now(), Text: text}
+	if len(b.lines) < maxLogLines {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % maxLogLines
+	}
+	if b.out != nil {
+		fmt.Fprintf(b.out, "%s %s\n", line.Time.Format("2006/01/02 15:04:05"), text)
+	}
+}
+
+// LogWriter returns the writer of the engine's log, e.g. for log.SetOutput:
+// each line written to it is kept for Logs and copied to the writer set with
+// SetLogOutput.
+func (e *Engine) LogWriter() io.Writer { return &e.logs }
+
+// SetLogOutput copies each line of the engine's log to w, prefixed with the
+// time, as the standard logger would print it; nil stops copying.
+func (e *Engine) SetLogOutput(w io.Writer) {
+	e.logs.mu.Lock()
+	defer e.logs.mu.Unlock()
+	e.logs.out = w
+}
+
+// Logs returns the kept lines of the engine's log, oldest first.
+func (e *Engine) Logs() []LogLine {
+	b := &e.logs
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]LogLine, 0, len(b.lines))
+	out = append(out, b.lines[b.next:]...)
+	return append(out, b.lines[:b.next]...)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Mirror copies an upstream's requests to a second target, to shadow-test
+// another build of a service with real traffic. Each copy is sent in the
+// background once the request has gone through the request hooks and any
+// intercept; its response never reaches the client.
+type Mirror struct {
+	// Target is the name of another upstream, whose path rewriting and
+	// transport then apply, or a base URL such as "http://localhost:8086",
+	// which receives the path the client sent. Like a replay, the copy
+	// carries the headers the original was forwarded with, credentials
+	// added by Upstream.Auth included.
+	Target string
+
+	// Capture stores each copy as a flow tagged "mirror" and "mirror:<id>",
+	// listed among the original's replays so the UIs can diff the two.
+	// Otherwise the mirror's responses are discarded.
+	Capture bool
+
+	// Compare, if set, diffs each copy's response against the primary's
+	// (see ShadowCompare).
+	Compare *ShadowCompare
+}
+
+// maxMirrorsInFlight caps the copies being sent at once, so a slow mirror
+// can't pile up goroutines; requests beyond it aren't mirrored.
+const maxMirrorsInFlight = 64
+
+// validate checks that m names an upstream among names or a base URL.
+func (m *Mirror) validate(upstream string, names map[string]bool) error {
+	if m.Target == "" {
+		return fmt.Errorf("mirror for upstream %q needs a target", upstream)
+	}
+	if names[m.Target] {
+		return nil
+	}
+	u, err := url.Parse(m.Target)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("mirror target %q for upstream %q is neither an upstream name nor an http(s) base URL",
+			m.Target, upstream)
+	}
+	return nil
+}
+
+// mirror sends a copy of flow's request to upstream's mirror, if it has
+// one. Requests whose body was only partly captured, or that arrive while
+// maxMirrorsInFlight copies are pending, are tagged "mirror-skipped"
+// instead. The copy is captured only if the original is stored.
+func (e *Engine) mirror(flow *Flow, upstream *Upstream, stored bool) {
+	m := upstream.Mirror
+	if m == nil {
+		return
+	}
+	if flow.Request.BodyTruncated {
+		flow.Tags = append(flow.Tags, "mirror-skipped")
+		return
+	}
+	select {
+	case e.mirrors <- struct{}{}:
+	default:
+		flow.Tags = append(flow.Tags, "mirror-skipped")
+		return
+	}
+	ro := ReplayOptions{Target: m.Target, Tags: []string{"mirror", "mirror:" + flow.ID}, discard: true}
+	if m.Capture && stored {
+		ro.ReplayOf, ro.discard = flow.ID, false
+	}
+	if m.Compare != nil {
+		flow.shadow = &shadowPair{primary: flow, compare: m.Compare, stored: !ro.discard}
+	}
+	cr := cloneRequest(flow.Request)
+	go func() {
+		defer func() { <-e.mirrors }()
+		// The target was validated with the config; a mirror that fails
+		// is recorded on its own flow, if captured.
+		copied, _ := e.ReplayRequest(cr, ro)
+		if p := flow.shadow; p != nil && p.finish(copied) {
+			e.compareShadow(p)
+		}
+	}()
+}
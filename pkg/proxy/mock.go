@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Mock is a static response served in place of an upstream. Mocks are
+// checked before routing, so they work for paths no upstream handles.
+type Mock struct {
+	Name string // display name; defaults to the path pattern
+
+	// Method restricts the mock to one HTTP method; empty matches any.
+	Method string
+
+	// Path is an exact path or a path.Match glob (e.g. "/api/users/*").
+	// A trailing "/**" matches the prefix and everything below it, so "/**"
+	// matches every path. It is required.
+	Path string
+
+	Status   int               // response status (default 200)
+	Headers  map[string]string // response headers
+	Body     string            // inline response body
+	BodyFile string            // file whose contents are the body; read per request
+}
+
+// Matches reports whether the mock applies to r.
+func (m *Mock) Matches(r *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+		return false
+	}
+	return matchPathPattern(m.Path, r.URL.Path)
+}
+
+// body returns the mock's response body, reading BodyFile if set.
+func (m *Mock) body() ([]byte, error) {
+	if m.BodyFile != "" {
+		data, err := os.ReadFile(m.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("mock %q: %w", m.Name, err)
+		}
+		return data, nil
+	}
+	return []byte(m.Body), nil
+}
+
+// matchPathPattern matches p against an exact path, a glob, or a "/**" prefix.
+func matchPathPattern(pattern, p string) bool {
+	if pattern == p {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	ok, err := path.Match(pattern, p)
+	return err == nil && ok
+}
+
+// validateMocks fills defaults and checks that each mock has a path with
+// valid glob syntax.
+func validateMocks(mocks []Mock) ([]Mock, error) {
+	out := make([]Mock, len(mocks))
+	for i, m := range mocks {
+		if m.Path == "" {
+			return nil, fmt.Errorf("mock %d needs a path (\"/**\" matches every path)", i+1)
+		}
+		if m.Name == "" {
+			m.Name = m.Path
+		}
+		if m.Status == 0 {
+			m.Status = http.StatusOK
+		}
+		if _, err := path.Match(strings.TrimSuffix(m.Path, "/**"), ""); err != nil {
+			return nil, fmt.Errorf("invalid path %q for mock %q: %w", m.Path, m.Name, err)
+		}
+		out[i] = m
+	}
+	return out, nil
+}
+
+// matchMock returns the first mock that applies to r, or nil.
+func (rt *routing) matchMock(r *http.Request) *Mock {
+	for i := range rt.mocks {
+		if rt.mocks[i].Matches(r) {
+			return &rt.mocks[i]
+		}
+	}
+	return nil
+}
+
+// serveMock completes flow with the mock's static response.
+func (e *Engine) serveMock(w http.ResponseWriter, flow *Flow, m *Mock) {
+	body, err := m.body()
+	if err != nil {
+		flow.State = FlowStateError
+		flow.Error = err.Error()
+		flow.Timestamps.ResponseDone = time.Now()
+		e.addons.FireError(flow, err)
+		e.store.Update(flow, FlowEventError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := make(http.Header)
+	for k, v := range m.Headers {
+		header.Set(k, v)
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(body))
+	}
+	e.serveResponse(w, flow, &CapturedResponse{
+		StatusCode: m.Status,
+		Headers:    header,
+		Body:       body,
+		Proto:      "HTTP/1.1",
+	})
+}
+
+// serveResponse completes flow with a response produced by the proxy itself
+// (a mock or an addon) rather than an upstream, and writes it to the client.
+func (e *Engine) serveResponse(w http.ResponseWriter, flow *Flow, resp *CapturedResponse) {
+	flow.Timestamps.ResponseStart = time.Now()
+	if flow.cors != nil {
+		flow.cors.apply(resp.Headers, flow.Request.Headers.Get("Origin"))
+	}
+	resp.Size = int64(len(resp.Body))
+	resp.HeadersSize = resp.headerBytes()
+	flow.Response = resp
+	flow.Timestamps.ResponseDone = time.Now()
+	flow.State = FlowStateComplete
+	flow.Error = ""
+
+	e.addons.FireResponse(flow)
+	e.addons.FireComplete(flow)
+	e.store.Update(flow, FlowEventComplete)
+
+	for k, vv := range flow.Response.Headers {
+		w.Header()[k] = vv
+	}
+	w.WriteHeader(flow.Response.StatusCode)
+	_, _ = w.Write(flow.Response.Body)
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import "testing"
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/api/health", "/api/health", true},
+		{"/api/health", "/api/healthz", false},
+		{"/api/users/*", "/api/users/42", true},
+		{"/api/users/*", "/api/users/42/posts", false},
+		{"/api/**", "/api", true},
+		{"/api/**", "/api/users/42", true},
+		{"/api/**", "/apiary", false},
+		{"/**", "/anything/at/all", true},
+		{"", "/anything", false},
+	}
+	for _, tt := range tests {
+		if got := matchPathPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPathPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidateMocks(t *testing.T) {
+	mocks, err := validateMocks([]Mock{{Path: "/api/health"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := mocks[0]; m.Name != "/api/health" || m.Status != 200 {
+		t.Errorf("defaults: name %q, status %d", m.Name, m.Status)
+	}
+	for _, bad := range []Mock{{Name: "typo"}, {Path: "/api/[users"}} {
+		if _, err := validateMocks([]Mock{bad}); err == nil {
+			t.Errorf("validateMocks(%+v) succeeded", bad)
+		}
+	}
+}
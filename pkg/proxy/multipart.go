@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// ErrNotMultipart is returned by CapturedRequest.Parts for requests whose
+// body is not multipart.
+var ErrNotMultipart = errors.New("request body is not multipart")
+
+// Part is one part of a multipart (typically multipart/form-data) body.
+type Part struct {
+	Name        string      `json:"name"`
+	Filename    string      `json:"filename,omitempty"`
+	ContentType string      `json:"contentType,omitempty"`
+	Size        int         `json:"size"`
+	Headers     http.Header `json:"headers"`
+
+	// Truncated is set when the captured body ends inside this part.
+	Truncated bool `json:"truncated,omitempty"`
+
+	Body []byte `json:"-"`
+}
+
+// IsMultipart reports whether the request has a multipart body.
+func (cr *CapturedRequest) IsMultipart() bool {
+	mt, _, err := mime.ParseMediaType(cr.Headers.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mt, "multipart/")
+}
+
+// Parts parses a multipart request body. If the captured body was truncated,
+// the parts up to the cut are returned and the last one is marked Truncated.
+func (cr *CapturedRequest) Parts() ([]Part, error) {
+	mt, params, err := mime.ParseMediaType(cr.Headers.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mt, "multipart/") {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart body has no boundary")
+	}
+
+	var parts []Part
+	mr := multipart.NewReader(bytes.NewReader(cr.ReadBody()), boundary)
+	for {
+		// NextRawPart leaves Content-Transfer-Encoding alone, so sizes and
+		// downloads match what was sent.
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			if cr.BodyTruncated {
+				return parts, nil
+			}
+			return parts, fmt.Errorf("part %d: %w", len(parts), err)
+		}
+		body, err := io.ReadAll(p)
+		part := Part{
+			Name:        p.FormName(),
+			Filename:    p.FileName(),
+			ContentType: p.Header.Get("Content-Type"),
+			Size:        len(body),
+			Headers:     http.Header(p.Header),
+			Body:        body,
+		}
+		if err != nil {
+			if !cr.BodyTruncated {
+				return parts, fmt.Errorf("part %d: %w", len(parts), err)
+			}
+			part.Truncated = true
+			return append(parts, part), nil
+		}
+		parts = append(parts, part)
+	}
+}
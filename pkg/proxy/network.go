@@ -0,0 +1,294 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkProfile simulates a slow or unreliable client network, so a
+// frontend can be tried against it through the proxy. Each request to an
+// upstream with an active profile waits Latency, give or take up to Jitter,
+// before it is handled; its body is read and its response written no faster
+// than the bandwidth caps; and with probability ResetRate the connection is
+// reset instead of forwarding it. Affected flows are tagged "network:<name>",
+// reset ones "network-reset" too.
+type NetworkProfile struct {
+	Name string `json:"name"`
+
+	LatencyMS int `json:"latencyMs,omitempty"`
+	JitterMS  int `json:"jitterMs,omitempty"`
+
+	// DownloadKbps and UploadKbps cap the response and request body rates,
+	// in kilobits per second. 0 is unlimited.
+	DownloadKbps int `json:"downloadKbps,omitempty"`
+	UploadKbps   int `json:"uploadKbps,omitempty"`
+
+	// ResetRate is the fraction of requests, between 0 and 1, whose
+	// connection is dropped.
+	ResetRate float64 `json:"resetRate,omitempty"`
+
+	Builtin bool `json:"builtin,omitempty"` // one of BuiltinNetworkProfiles
+}
+
+// BuiltinNetworkProfiles are the presets always available. Profiles
+// configured under the same name replace them.
+var BuiltinNetworkProfiles = []NetworkProfile{
+	{Name: "slow-3g", LatencyMS: 2000, JitterMS: 200, DownloadKbps: 400, UploadKbps: 400, Builtin: true},
+	{Name: "3g", LatencyMS: 560, JitterMS: 100, DownloadKbps: 1600, UploadKbps: 750, Builtin: true},
+	{Name: "lte", LatencyMS: 150, JitterMS: 40, DownloadKbps: 12000, UploadKbps: 5000, Builtin: true},
+	{Name: "flaky-wifi", LatencyMS: 40, JitterMS: 400, DownloadKbps: 2000, UploadKbps: 1000, ResetRate: 0.05, Builtin: true},
+}
+
+// validate checks a configured profile's settings.
+func (p *NetworkProfile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("network profile needs a name")
+	}
+	if p.LatencyMS < 0 || p.JitterMS < 0 || p.DownloadKbps < 0 || p.UploadKbps < 0 {
+		return fmt.Errorf("network profile %q: latency, jitter, and bandwidth must be >= 0", p.Name)
+	}
+	if p.ResetRate < 0 || p.ResetRate > 1 {
+		return fmt.Errorf("network profile %q: reset_rate must be between 0 and 1, got %g", p.Name, p.ResetRate)
+	}
+	return nil
+}
+
+// delay draws the latency of one request.
+func (p *NetworkProfile) delay() time.Duration {
+	ms := p.LatencyMS
+	if p.JitterMS > 0 {
+		ms += rand.IntN(2*p.JitterMS+1) - p.JitterMS
+	}
+	return time.Duration(max(ms, 0)) * time.Millisecond
+}
+
+// NetworkStatus is the active network simulation: a profile for every
+// upstream, one per upstream in place of it, and the profiles to choose
+// from. An empty Global means no simulation; upstreams missing from
+// Upstreams use Global.
+type NetworkStatus struct {
+	Global    string            `json:"global"`
+	Upstreams map[string]string `json:"upstreams"`
+	Profiles  []NetworkProfile  `json:"profiles"`
+}
+
+// networkTable holds the engine's network simulation settings. They are
+// seeded from the options by New and on every reload, and changed at
+// runtime with SetNetworkProfile.
+type networkTable struct {
+	mu        sync.RWMutex
+	profiles  map[string]NetworkProfile
+	global    string
+	upstreams map[string]string
+}
+
+// buildNetworkProfiles merges the configured profiles over the built-in
+// ones and checks that the selected ones exist.
+func buildNetworkProfiles(opts Options) (map[string]NetworkProfile, error) {
+	profiles := make(map[string]NetworkProfile)
+	for _, p := range BuiltinNetworkProfiles {
+		profiles[p.Name] = p
+	}
+	for _, p := range opts.NetworkProfiles {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		p.Builtin = false
+		profiles[p.Name] = p
+	}
+	if _, ok := profiles[opts.Network]; opts.Network != "" && !ok {
+		return nil, fmt.Errorf("unknown network profile %q", opts.Network)
+	}
+	for _, u := range opts.Upstreams {
+		if _, ok := profiles[u.Network]; u.Network != "" && !ok {
+			return nil, fmt.Errorf("unknown network profile %q for upstream %q", u.Network, u.Name)
+		}
+	}
+	return profiles, nil
+}
+
+// reset replaces the table's profiles and selections with those of opts.
+func (t *networkTable) reset(profiles map[string]NetworkProfile, opts Options) {
+	upstreams := make(map[string]string)
+	for _, u := range opts.Upstreams {
+		if u.Network != "" {
+			upstreams[u.Name] = u.Network
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.profiles = profiles
+	t.global = opts.Network
+	t.upstreams = upstreams
+}
+
+// NetworkConditions returns the active network simulation settings.
+func (e *Engine) NetworkConditions() NetworkStatus {
+	t := &e.network
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	st := NetworkStatus{
+		Global:    t.global,
+		Upstreams: maps.Clone(t.upstreams),
+		Profiles:  slices.Collect(maps.Values(t.profiles)),
+	}
+	slices.SortFunc(st.Profiles, func(a, b NetworkProfile) int { return strings.Compare(a.Name, b.Name) })
+	return st
+}
+
+// SetNetworkProfile activates the named profile for upstream, or for every
+// upstream without its own when upstream is empty. An empty profile turns
+// the simulation off, or returns an upstream to the global profile. Changes
+// last until the config is reloaded.
+func (e *Engine) SetNetworkProfile(upstream, profile string) error {
+	if upstream != "" && !slices.ContainsFunc(e.Router().upstreams, func(u Upstream) bool { return u.Name == upstream }) {
+		return fmt.Errorf("upstream %q not found", upstream)
+	}
+	t := &e.network
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.profiles[profile]; profile != "" && !ok {
+		return fmt.Errorf("network profile %q not found", profile)
+	}
+	switch {
+	case upstream == "":
+		t.global = profile
+	case profile == "":
+		delete(t.upstreams, upstream)
+	default:
+		t.upstreams[upstream] = profile
+	}
+	return nil
+}
+
+// networkProfile returns the profile active for upstream (nil for mocks),
+// or nil if there is none.
+func (e *Engine) networkProfile(upstream *Upstream) *NetworkProfile {
+	t := &e.network
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	name := t.global
+	if upstream != nil {
+		if n, ok := t.upstreams[upstream.Name]; ok {
+			name = n
+		}
+	}
+	p, ok := t.profiles[name]
+	if !ok {
+		return nil
+	}
+	return &p
+}
+
+// simulateNetwork applies the network profile active for upstream to a
+// request: it waits out the profile's latency and throttles r's body and
+// the response written to w. It reports reset when the connection is to
+// be dropped instead, in which case flow has already been finished as an
+// error; the caller aborts the handler.
+func (e *Engine) simulateNetwork(w http.ResponseWriter, r *http.Request, flow *Flow, upstream *Upstream) (_ http.ResponseWriter, _ *http.Request, reset bool) {
+	p := e.networkProfile(upstream)
+	if p == nil {
+		return w, r, false
+	}
+	flow.Tags = append(flow.Tags, "network:"+p.Name)
+	if d := p.delay(); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+		}
+	}
+	if p.ResetRate > 0 && rand.Float64() < p.ResetRate {
+		flow.Tags = append(flow.Tags, "network-reset")
+		flow.State = FlowStateError
+		flow.Error = fmt.Sprintf("connection reset by network profile %q", p.Name)
+		flow.Timestamps.ResponseDone = time.Now()
+		e.store.Update(flow, FlowEventError)
+		return w, r, true
+	}
+	if p.UploadKbps > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = &throttledBody{ReadCloser: r.Body, ctx: r.Context(), bps: kbpsToBytes(p.UploadKbps)}
+	}
+	if p.DownloadKbps > 0 {
+		w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), bps: kbpsToBytes(p.DownloadKbps)}
+	}
+	return w, r, false
+}
+
+// kbpsToBytes converts kilobits per second to bytes per second.
+func kbpsToBytes(kbps int) int {
+	return max(kbps*1000/8, 1)
+}
+
+// throttleChunk is how many bytes to pass at a time at bps bytes per
+// second: about a tenth of a second's worth.
+func throttleChunk(bps int) int {
+	return max(bps/10, 1)
+}
+
+// throttle sleeps for as long as n bytes take at bps bytes per second, or
+// until ctx is done.
+func throttle(ctx context.Context, n, bps int) error {
+	select {
+	case <-time.After(time.Duration(n) * time.Second / time.Duration(bps)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledWriter writes a response no faster than bps bytes per second,
+// flushing each chunk so the client sees it trickle in.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+	bps int
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := min(len(p), throttleChunk(t.bps))
+		if err := throttle(t.ctx, chunk, t.bps); err != nil {
+			return n, err
+		}
+		m, err := t.ResponseWriter.Write(p[:chunk])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		_ = http.NewResponseController(t.ResponseWriter).Flush()
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (t *throttledWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
+
+// throttledBody reads a request body no faster than bps bytes per second.
+type throttledBody struct {
+	io.ReadCloser
+	ctx context.Context
+	bps int
+}
+
+func (t *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk(t.bps) {
+		p = p[:throttleChunk(t.bps)]
+	}
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if terr := throttle(t.ctx, n, t.bps); terr != nil && err == nil {
+			err = terr
+		}
+	}
+	return n, err
+}
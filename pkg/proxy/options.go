@@ -1,5 +1,7 @@
 package proxy
 
+import "time"
+
 const (
 	DefaultListenAddr = ":9090"
 	DefaultWebPort    = 9091
@@ -9,20 +11,181 @@ const (
 
 // Options configures the proxy engine.
 type Options struct {
-	// ListenAddr is the address for the proxy HTTP server (e.g. ":9090").
+	// ListenAddr is the address for the proxy HTTP server (e.g. ":9090"), or
+	// a Unix socket as "unix:///path/to/sock".
 	ListenAddr string
 
+	// ExtraListenAddrs are further addresses, in the same forms, served by
+	// the same engine (e.g. several interfaces in a docker-compose setup).
+	ExtraListenAddrs []string
+
 	// WebPort is the port for the web inspection UI. 0 disables it.
 	WebPort int
 
+	// AutoPort makes a busy listen or web port fall back to the next free
+	// one instead of failing; Info reports the ports actually bound.
+	AutoPort bool
+
+	// WebAuth, if set, requires credentials for the web UI, its API, and
+	// its WebSocket.
+	WebAuth WebAuth
+
 	// Upstreams defines the routing table.
 	Upstreams []Upstream
 
 	// MaxFlows is the ring-buffer capacity for the flow store.
 	MaxFlows int
 
+	// MaxStoreBytes, if positive, also evicts the oldest flows while the
+	// captured bodies held in memory add up to more than this.
+	MaxStoreBytes int64
+
+	// SpillThreshold, if positive, moves captured bodies larger than this
+	// many bytes to temporary files in SpillDir (default: the system temp
+	// directory) once their flow finishes. See CapturedRequest.ReadBody.
+	SpillThreshold int64
+	SpillDir       string
+
+	// CompressThreshold, if positive, compresses captured bodies larger than
+	// this many bytes with CompressAlgorithm (CompressGzip, the default, or
+	// CompressZstd) once their flow finishes, keeping them in memory in that
+	// form; ReadBody decompresses them. Bodies large enough to spill are
+	// spilled instead.
+	CompressThreshold int64
+	CompressAlgorithm string
+
 	// MaxBodySize is the maximum number of bytes captured per request/response body.
 	MaxBodySize int64
+
+	// MaxRequestSize rejects request bodies larger than this many bytes with
+	// 413 instead of forwarding them. 0 means no limit.
+	MaxRequestSize int64
+
+	// TLS serves the proxy listener over HTTPS. Unless TLSCertFile and
+	// TLSKeyFile are set, certificates are issued by a local CA kept in CertDir.
+	TLS bool
+
+	// TLSCertFile and TLSKeyFile are an optional PEM certificate/key pair.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// CertDir caches the generated local CA (default: certs.DefaultDir()).
+	CertDir string
+
+	// HTTP2 enables HTTP/2 on the listener: h2 via ALPN when TLS is on, and
+	// cleartext h2c with prior knowledge otherwise. HTTP/1.1 is always served.
+	HTTP2 bool
+
+	// Mode is ModeReverse (the default when empty) or ModeForward. In forward
+	// mode Upstreams are not used for routing; requests go where they name.
+	Mode string
+
+	// MITM decrypts CONNECT tunnels in forward mode, presenting certificates
+	// from the local CA in CertDir, which clients must trust.
+	MITM bool
+
+	// Mocks are static responses served instead of forwarding, checked in order
+	// before upstream routing.
+	Mocks []Mock
+
+	// Views are named filter expressions offered in the TUI and web UI.
+	// Views saved at runtime are added to these.
+	Views []View
+
+	// StateFile is where views saved at runtime are persisted (JSON). Empty
+	// keeps them in memory only.
+	StateFile string
+
+	// Ignore lists requests that are proxied as usual but never stored or
+	// broadcast, such as health checks.
+	Ignore []IgnoreRule
+
+	// Record, if set, stores only the flows it matches. It is checked when
+	// the request arrives and, for flows that don't match then, again when
+	// they finish, so filters on the response (~s, ~bs) can keep a flow.
+	Record *RecordFilter
+
+	// Jobs are replays run on a schedule, as smoke tests; see ScheduledJob.
+	Jobs []ScheduledJob
+
+	// Breakpoints are set when the engine is created; more can be added
+	// and removed at runtime.
+	Breakpoints []Breakpoint
+
+	// Transforms rewrite the bodies of matching upstream responses, in
+	// order, before they reach the client.
+	Transforms []ResponseTransform
+
+	// PathTemplates name the endpoints of paths for request groups and
+	// per-endpoint stats, such as /repos/{owner}/{repo}; a final
+	// {param...} matches the rest of the path. Paths fitting none fall
+	// back to PathTemplate.
+	PathTemplates []string
+
+	// CORS, if set, overrides the CORS headers of responses from every
+	// upstream and mock, unless an Upstream sets its own.
+	CORS *CORS
+
+	// LiveReload, if set, reloads the browsers showing proxied pages when
+	// a watched upstream restarts.
+	LiveReload *LiveReload
+
+	// SampleRate is the fraction of flows stored, between 0 and 1, for
+	// upstreams without their own; the rest are proxied, counted in the
+	// stats, and otherwise treated like ignored flows. 0 or 1 stores all.
+	SampleRate float64
+
+	// Alerts, if set, flag slow or failing flows of every upstream, unless
+	// an Upstream sets its own.
+	Alerts *Alerts
+
+	// Capture limits body capture by content type and status for every
+	// upstream that doesn't set its own rules.
+	Capture []CaptureRule
+
+	// NetworkProfiles add to, or replace, the BuiltinNetworkProfiles.
+	NetworkProfiles []NetworkProfile
+
+	// Network names the profile simulated for every upstream that doesn't
+	// set its own; empty simulates none. It can be changed at runtime.
+	Network string
+
+	// ShutdownTimeout is how long Start waits, once its context is done,
+	// for in-flight flows to finish before closing their connections.
+	// Default: DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+}
+
+// IgnoreRule matches requests to leave unrecorded. Filter is the filter
+// expression as written; Match is its parsed form, which the caller fills in
+// with the filter package (it builds on this one). Rules are checked when the
+// request arrives, so filters on the body or response never match.
+type IgnoreRule struct {
+	Filter string
+	Match  Matcher
+}
+
+// RecordFilter selects the flows to store. Filter is the filter expression
+// as written; Match is its parsed form, filled in like IgnoreRule.Match.
+type RecordFilter struct {
+	Filter string
+	Match  Matcher
+}
+
+// WebAuth holds the credentials for the web UI: basic-auth User and
+// Password, a bearer Token, or both (either is then accepted).
+type WebAuth struct {
+	User     string
+	Password string
+	Token    string
+}
+
+// Enabled reports whether any credentials are configured.
+func (a WebAuth) Enabled() bool { return a.User != "" || a.Token != "" }
+
+// ListenAddrs returns every address the proxy listens on.
+func (o Options) ListenAddrs() []string {
+	return append([]string{o.ListenAddr}, o.ExtraListenAddrs...)
 }
 
 func (o *Options) setDefaults() {
@@ -38,4 +201,7 @@ func (o *Options) setDefaults() {
 	if o.MaxBodySize == 0 {
 		o.MaxBodySize = DefaultMaxBody
 	}
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = DefaultShutdownTimeout
+	}
 }
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HeaderOverride sets a request header on the flows matching Filter before
+// they are forwarded, e.g. a feature flag for all /api traffic. Overrides are
+// added at runtime from the UIs or the API and last until removed or the
+// proxy exits. Flows they changed are tagged "override".
+type HeaderOverride struct {
+	ID     string `json:"id"`
+	Filter string `json:"filter,omitempty"` // empty: every flow
+	Header string `json:"header"`
+	Value  string `json:"value"` // empty: remove the header
+
+	match Matcher
+}
+
+// overrideTable holds the engine's header overrides.
+type overrideTable struct {
+	mu     sync.RWMutex
+	list   []HeaderOverride
+	nextID int
+}
+
+// HeaderOverrides returns the active header overrides, in the order they
+// are applied.
+func (e *Engine) HeaderOverrides() []HeaderOverride {
+	e.overrides.mu.RLock()
+	defer e.overrides.mu.RUnlock()
+	return slices.Clone(e.overrides.list)
+}
+
+// AddHeaderOverride adds an override for the flows match accepts; a nil
+// match applies it to every flow, and o.Filter is kept for display only.
+// The override is returned with its ID.
+func (e *Engine) AddHeaderOverride(o HeaderOverride, match Matcher) (HeaderOverride, error) {
+	o.Header = strings.TrimSpace(o.Header)
+	if o.Header == "" || strings.ContainsAny(o.Header, " \t\r\n:") {
+		return HeaderOverride{}, fmt.Errorf("invalid header name %q", o.Header)
+	}
+	if strings.ContainsAny(o.Value, "\r\n") {
+		return HeaderOverride{}, errors.New("header value must be one line")
+	}
+	o.Header = http.CanonicalHeaderKey(o.Header)
+	o.match = match
+
+	e.overrides.mu.Lock()
+	defer e.overrides.mu.Unlock()
+	e.overrides.nextID++
+	o.ID = strconv.Itoa(e.overrides.nextID)
+	e.overrides.list = append(e.overrides.list, o)
+	return o, nil
+}
+
+// DeleteHeaderOverride removes the override with the given ID.
+func (e *Engine) DeleteHeaderOverride(id string) error {
+	e.overrides.mu.Lock()
+	defer e.overrides.mu.Unlock()
+	i := slices.IndexFunc(e.overrides.list, func(o HeaderOverride) bool { return o.ID == id })
+	if i < 0 {
+		return fmt.Errorf("header override %q not found", id)
+	}
+	e.overrides.list = slices.Delete(e.overrides.list, i, i+1)
+	return nil
+}
+
+// overrideAddon applies the engine's header overrides to requests. It is
+// registered by New, so it can be turned off like any other addon.
+type overrideAddon struct {
+	e *Engine
+}
+
+// Name identifies the addon in the addon list.
+func (overrideAddon) Name() string { return "overrides" }
+
+// Priority runs the addon after others, so the overrides win, but before
+// the auth addon.
+func (overrideAddon) Priority() int { return 90 }
+
+// OnRequest applies every matching override to flow.Request.
+func (a overrideAddon) OnRequest(flow *Flow) {
+	if flow.Request == nil {
+		return
+	}
+	a.e.overrides.mu.RLock()
+	defer a.e.overrides.mu.RUnlock()
+	changed := false
+	for _, o := range a.e.overrides.list {
+		if o.match != nil && !o.match(flow) {
+			continue
+		}
+		switch {
+		case o.Value != "":
+			if flow.Request.Headers == nil {
+				flow.Request.Headers = make(http.Header)
+			}
+			flow.Request.Headers.Set(o.Header, o.Value)
+			changed = true
+		case len(flow.Request.Headers.Values(o.Header)) > 0:
+			flow.Request.Headers.Del(o.Header)
+			changed = true
+		}
+	}
+	if changed {
+		flow.Tags = append(flow.Tags, "override")
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// QueryParam is one name=value pair from a URL query string.
+type QueryParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie is a parsed Cookie or Set-Cookie value. The attributes are only
+// set for Set-Cookie.
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Path     string    `json:"path,omitempty"`
+	Domain   string    `json:"domain,omitempty"`
+	Expires  time.Time `json:"expires,omitzero"`
+	MaxAge   int       `json:"maxAge,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"httpOnly,omitempty"`
+	SameSite string    `json:"sameSite,omitempty"`
+}
+
+// QueryParams returns the request's query parameters in the order they were
+// sent, including repeats. Malformed escapes are kept verbatim.
+func (cr *CapturedRequest) QueryParams() []QueryParam {
+	_, raw, ok := strings.Cut(cr.URL, "?")
+	if !ok || raw == "" {
+		return nil
+	}
+	var params []QueryParam
+	for pair := range strings.SplitSeq(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		params = append(params, QueryParam{Name: unescapeQuery(name), Value: unescapeQuery(value)})
+	}
+	return params
+}
+
+func unescapeQuery(s string) string {
+	if u, err := url.QueryUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// Cookies parses the request's Cookie headers.
+func (cr *CapturedRequest) Cookies() []Cookie {
+	var cookies []Cookie
+	for _, c := range (&http.Request{Header: cr.Headers}).Cookies() {
+		cookies = append(cookies, Cookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
+
+// SetCookies parses the response's Set-Cookie headers.
+func (r *CapturedResponse) SetCookies() []Cookie {
+	var cookies []Cookie
+	for _, c := range (&http.Response{Header: r.Headers}).Cookies() {
+		cookies = append(cookies, Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			Expires:  c.Expires,
+			MaxAge:   c.MaxAge,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			SameSite: sameSiteName(c.SameSite),
+		})
+	}
+	return cookies
+}
+
+func sameSiteName(s http.SameSite) string {
+	switch s {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
+
+// MarshalJSON adds the parsed query string and cookies to the JSON form, so
+// clients don't have to parse raw headers. They are derived, so decoding
+// ignores them. A spilled body is read back.
+func (cr *CapturedRequest) MarshalJSON() ([]byte, error) {
+	type plain CapturedRequest
+	bodyMu.RLock()
+	p := plain(*cr)
+	bodyMu.RUnlock()
+	p.Body = readBody(p.Body, p.spilled, p.packed)
+	return json.Marshal(struct {
+		plain
+		Query   []QueryParam `json:"query,omitempty"`
+		Cookies []Cookie     `json:"cookies,omitempty"`
+	}{p, cr.QueryParams(), cr.Cookies()})
+}
+
+// MarshalJSON adds the parsed Set-Cookie headers to the JSON form. A
+// spilled body is read back.
+func (r *CapturedResponse) MarshalJSON() ([]byte, error) {
+	type plain CapturedResponse
+	bodyMu.RLock()
+	p := plain(*r)
+	bodyMu.RUnlock()
+	p.Body = readBody(p.Body, p.spilled, p.packed)
+	return json.Marshal(struct {
+		plain
+		SetCookies []Cookie `json:"setCookies,omitempty"`
+	}{p, r.SetCookies()})
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// PassthroughTarget as an upstream's Target forwards each request to the host
+// named by its Host header instead of a fixed URL, so the proxy can front
+// many hostnames (e.g. mapped to it in /etc/hosts) without listing them.
+const PassthroughTarget = "passthrough"
+
+// viaToken identifies this process in the Via header of passthrough
+// requests, so a request that resolves back to the proxy is caught instead
+// of looping.
+var viaToken = func() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return "http-proxy-" + hex.EncodeToString(b)
+}()
+
+// Passthrough reports whether the upstream forwards by Host header.
+func (u *Upstream) Passthrough() bool { return u.Target == PassthroughTarget }
+
+// preparePassthrough validates a passthrough upstream's allow-list and port.
+func (u *Upstream) preparePassthrough() error {
+	if len(u.Targets) > 0 {
+		return fmt.Errorf("upstream %q: passthrough can't be combined with targets", u.Name)
+	}
+	if len(u.AllowHosts) == 0 {
+		return fmt.Errorf("upstream %q: passthrough requires allow_hosts", u.Name)
+	}
+	for _, p := range u.AllowHosts {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("upstream %q: invalid allow_hosts pattern %q: %w", u.Name, p, err)
+		}
+	}
+	if u.PassthroughPort < 0 || u.PassthroughPort > 65535 {
+		return fmt.Errorf("upstream %q: invalid passthrough_port %d", u.Name, u.PassthroughPort)
+	}
+	return nil
+}
+
+// allowsHost reports whether host (without port) matches the allow-list.
+func (u *Upstream) allowsHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, p := range u.AllowHosts {
+		if ok, _ := path.Match(strings.ToLower(p), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// passthroughTarget resolves where a passthrough upstream sends r: the host
+// in its Host header, on PassthroughPort if set, over https if r arrived
+// over TLS.
+func (u *Upstream) passthroughTarget(r *http.Request) (*Target, error) {
+	hostport := r.Host
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, ""
+	}
+	if host == "" {
+		return nil, fmt.Errorf("request has no Host header")
+	}
+	if !u.allowsHost(host) {
+		return nil, fmt.Errorf("host %q is not in allow_hosts for upstream %q", host, u.Name)
+	}
+	if u.PassthroughPort != 0 {
+		port = strconv.Itoa(u.PassthroughPort)
+	}
+	if port != "" {
+		hostport = net.JoinHostPort(host, port)
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	t := &Target{URL: scheme + "://" + hostport, Weight: 1}
+	t.parsed = &url.URL{Scheme: scheme, Host: hostport}
+	return t, nil
+}
+
+// passthroughRefused answers flow and reports true if upstream is a
+// passthrough upstream that can't forward r: its host isn't allowed (403),
+// or r has already been through this proxy (508).
+func (e *Engine) passthroughRefused(w http.ResponseWriter, r *http.Request, flow *Flow, upstream *Upstream) bool {
+	if !upstream.Passthrough() {
+		return false
+	}
+	status, msg := 0, ""
+	if strings.Contains(strings.Join(r.Header.Values("Via"), ","), viaToken) {
+		status, msg = http.StatusLoopDetected, fmt.Sprintf("request to %s loops back to the proxy", r.Host)
+	} else if _, err := upstream.passthroughTarget(r); err != nil {
+		status, msg = http.StatusForbidden, err.Error()
+	} else {
+		return false
+	}
+	flow.Tags = append(flow.Tags, "passthrough-refused")
+	e.serveResponse(w, flow, &CapturedResponse{
+		StatusCode: status,
+		Headers:    http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte(msg + "\n"),
+		Proto:      "HTTP/1.1",
+	})
+	return true
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pathTemplate is a compiled Options.PathTemplates entry.
+type pathTemplate struct {
+	text string
+	segs []string // literal segments; "{}" for a {param}
+	rest bool     // the last segment is {param...}, matching one or more
+}
+
+// compilePathTemplates validates templates such as /users/{id}/posts.
+func compilePathTemplates(templates []string) ([]pathTemplate, error) {
+	out := make([]pathTemplate, 0, len(templates))
+	for _, text := range templates {
+		if !strings.HasPrefix(text, "/") {
+			return nil, fmt.Errorf("path template %q must start with /", text)
+		}
+		t := pathTemplate{text: text, segs: strings.Split(text, "/")}
+		for i, seg := range t.segs {
+			if !strings.ContainsAny(seg, "{}") {
+				continue
+			}
+			name, ok := strings.CutPrefix(seg, "{")
+			name, ok2 := strings.CutSuffix(name, "}")
+			if !ok || !ok2 || name == "" || strings.ContainsAny(name, "{}") {
+				return nil, fmt.Errorf("path template %q: a parameter must be a whole segment, like {id}", text)
+			}
+			if strings.HasSuffix(name, "...") {
+				if i != len(t.segs)-1 {
+					return nil, fmt.Errorf("path template %q: %s must be the last segment", text, seg)
+				}
+				t.rest = true
+			}
+			t.segs[i] = "{}"
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// match reports whether path fits t.
+func (t pathTemplate) match(path string) bool {
+	segs := strings.Split(path, "/")
+	if len(segs) != len(t.segs) && !(t.rest && len(segs) > len(t.segs)) {
+		return false
+	}
+	for i, lit := range t.segs {
+		if lit == "{}" && segs[i] == "" || lit != "{}" && lit != segs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizePath returns the endpoint path is a call of, for grouping and
+// per-endpoint stats: the first of Options.PathTemplates it fits, or else
+// PathTemplate(path).
+func (e *Engine) NormalizePath(path string) string {
+	for _, t := range e.routing.Load().pathTemplates {
+		if t.match(path) {
+			return t.text
+		}
+	}
+	return PathTemplate(path)
+}
+
+// PathTemplate is the default path normalization: it replaces segments that
+// look like identifiers (numbers, UUIDs, long hex strings, and long tokens
+// mixing letters and digits) with {id}, so /users/123 becomes /users/{id}.
+func PathTemplate(path string) string {
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if isIDSegment(s) {
+			segs[i] = "{id}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func isIDSegment(s string) bool {
+	if s == "" {
+		return false
+	}
+	var digits, hexLetters, letters, other int
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F':
+			hexLetters++
+		case r >= 'g' && r <= 'z' || r >= 'G' && r <= 'Z':
+			letters++
+		case r == '-' || r == '_':
+			other++
+		default:
+			return false
+		}
+	}
+	switch {
+	case digits == len(s):
+		return true
+	case len(s) == 36 && letters == 0 && other == 4 && strings.Count(s, "-") == 4: // UUID
+		return true
+	case len(s) >= 16 && digits > 0 && letters == 0 && other == 0: // hex digest or object ID
+		return true
+	}
+	// Opaque tokens: long, and mixing letters and digits.
+	return len(s) >= 20 && digits > 0 && hexLetters+letters > 0
+}
@@ -0,0 +1,423 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstreams with a Command are run by the engine: it starts each command
+// with the proxy, restarts it when it exits (backing off while it keeps
+// crashing), and stops it on shutdown. Until the target's port accepts
+// connections, requests to the upstream wait for it, then get a 503.
+
+// Process states.
+const (
+	ProcessStarting = "starting" // running, port not open yet
+	ProcessReady    = "ready"    // port accepting connections
+	ProcessExited   = "exited"   // waiting to be restarted
+	ProcessStopped  = "stopped"  // shut down with the engine
+)
+
+const (
+	// processReadyTimeout is how long a request waits for its upstream's
+	// process to open its port.
+	processReadyTimeout = 30 * time.Second
+
+	// maxProcessLines is how many lines of output are kept per process.
+	maxProcessLines = 2000
+
+	// A process that ran this long before exiting is restarted after
+	// minRestartDelay; quicker crashes double the delay, up to maxRestartDelay.
+	stableRunTime   = 10 * time.Second
+	minRestartDelay = time.Second
+	maxRestartDelay = 30 * time.Second
+)
+
+// ProcessStatus describes an upstream's process.
+type ProcessStatus struct {
+	Upstream string    `json:"upstream"`
+	Command  string    `json:"command"`
+	Addr     string    `json:"addr"` // the host:port waited on
+	State    string    `json:"state"`
+	PID      int       `json:"pid,omitempty"`
+	Restarts int       `json:"restarts"`
+	Started  time.Time `json:"started,omitempty"`
+	LastExit string    `json:"lastExit,omitempty"` // why the last run ended
+}
+
+// ProcessLine is a line of a process's output. Stream is "stdout",
+// "stderr", or "proxy" for the engine's own lifecycle messages.
+type ProcessLine struct {
+	Time     time.Time `json:"time"`
+	Upstream string    `json:"upstream"`
+	Stream   string    `json:"stream"`
+	Text     string    `json:"text"`
+}
+
+type process struct {
+	e       *Engine
+	command string
+	dir     string
+	env     []string
+
+	mu      sync.Mutex
+	status  ProcessStatus
+	ready   chan struct{} // closed while the port is open
+	cmd     *exec.Cmd     // the current run, nil between runs
+	lines   []ProcessLine // ring of the last maxProcessLines
+	next    int           // ring position once full
+	restart chan struct{}
+}
+
+// processTable holds the processes by upstream name, in config order.
+type processTable struct {
+	byName map[string]*process
+	names  []string
+	out    io.Writer // also receives output lines, if set
+	outMu  sync.Mutex
+}
+
+// prepareProcesses sets up a process for every upstream with a Command.
+func (e *Engine) prepareProcesses(upstreams []Upstream) error {
+	t := &e.procs
+	t.byName = make(map[string]*process)
+	for _, u := range upstreams {
+		if u.Command == "" {
+			continue
+		}
+		if u.Passthrough() {
+			return fmt.Errorf("upstream %q: command needs a fixed target, not passthrough", u.Name)
+		}
+		host, port := u.parsed.Hostname(), u.parsed.Port()
+		if port == "" {
+			port = "80"
+			if u.parsed.Scheme == "https" {
+				port = "443"
+			}
+		}
+		env := make([]string, 0, len(u.CommandEnv))
+		for k, v := range u.CommandEnv {
+			env = append(env, k+"="+v)
+		}
+		slices.Sort(env)
+		t.names = append(t.names, u.Name)
+		t.byName[u.Name] = &process{
+			e:       e,
+			command: u.Command,
+			dir:     u.CommandDir,
+			env:     env,
+			status: ProcessStatus{
+				Upstream: u.Name,
+				Command:  u.Command,
+				Addr:     net.JoinHostPort(cmp.Or(host, "localhost"), port),
+				State:    ProcessStopped,
+			},
+			ready:   make(chan struct{}),
+			restart: make(chan struct{}, 1),
+		}
+	}
+	return nil
+}
+
+// SetProcessOutput copies the output of upstream processes to w, each line
+// prefixed with the upstream name, e.g. to stdout when there is no TUI.
+func (e *Engine) SetProcessOutput(w io.Writer) {
+	e.procs.outMu.Lock()
+	e.procs.out = w
+	e.procs.outMu.Unlock()
+}
+
+// Processes reports on the upstream processes, in config order.
+func (e *Engine) Processes() []ProcessStatus {
+	out := make([]ProcessStatus, 0, len(e.procs.names))
+	for _, name := range e.procs.names {
+		out = append(out, e.procs.byName[name].snapshot())
+	}
+	return out
+}
+
+// ProcessLogs returns the kept output of the named upstream's process, or of
+// all processes, interleaved by time, when name is empty.
+func (e *Engine) ProcessLogs(name string) ([]ProcessLine, error) {
+	if name != "" {
+		p, ok := e.procs.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("upstream %q has no command", name)
+		}
+		return p.logs(), nil
+	}
+	var out []ProcessLine
+	for _, name := range e.procs.names {
+		out = append(out, e.procs.byName[name].logs()...)
+	}
+	slices.SortStableFunc(out, func(a, b ProcessLine) int { return a.Time.Compare(b.Time) })
+	return out, nil
+}
+
+// RestartProcess stops the named upstream's process and starts it again
+// straight away.
+func (e *Engine) RestartProcess(name string) error {
+	p, ok := e.procs.byName[name]
+	if !ok {
+		return fmt.Errorf("upstream %q has no command", name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status.State == ProcessStopped {
+		return fmt.Errorf("process for %q is not running", name)
+	}
+	select {
+	case p.restart <- struct{}{}:
+	default: // already requested
+	}
+	if p.cmd != nil {
+		_ = terminate(p.cmd)
+	}
+	return nil
+}
+
+// runProcesses runs every process until ctx is done.
+func (e *Engine) runProcesses(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range e.procs.byName {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// processNotReady holds a request to upstream until its process is ready,
+// and answers 503 and reports true if it doesn't get there in time (its
+// HoldTimeout, or processReadyTimeout). Such flows are tagged
+// "process-not-ready".
+func (e *Engine) processNotReady(w http.ResponseWriter, r *http.Request, flow *Flow, upstream *Upstream) bool {
+	p, ok := e.procs.byName[upstream.Name]
+	if !ok {
+		return false
+	}
+	p.mu.Lock()
+	ready := p.ready
+	p.mu.Unlock()
+	timer := time.NewTimer(cmp.Or(upstream.HoldTimeout, processReadyTimeout))
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return false
+	case <-r.Context().Done():
+	case <-timer.C:
+	}
+	st := p.snapshot()
+	flow.Tags = append(flow.Tags, "process-not-ready")
+	e.serveResponse(w, flow, &CapturedResponse{
+		StatusCode: http.StatusServiceUnavailable,
+		Headers: http.Header{
+			"Content-Type": {"text/plain; charset=utf-8"},
+			"Retry-After":  {"5"},
+		},
+		Body:  []byte(fmt.Sprintf("upstream %q: process is %s (%s not accepting connections)\n", upstream.Name, st.State, st.Addr)),
+		Proto: "HTTP/1.1",
+	})
+	return true
+}
+
+func (p *process) snapshot() ProcessStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// run starts the process and restarts it whenever it exits, until ctx is
+// done.
+func (p *process) run(ctx context.Context) {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := p.runOnce(ctx)
+		if ctx.Err() != nil {
+			p.setState(ProcessStopped, "")
+			p.log("proxy", "stopped")
+			return
+		}
+		select {
+		case <-p.restart:
+			p.log("proxy", "restarting")
+			p.bumpRestarts()
+			continue
+		default:
+		}
+		if time.Since(started) >= stableRunTime {
+			delay = minRestartDelay
+		}
+		reason := "exited"
+		if err != nil {
+			reason = err.Error()
+		}
+		p.setState(ProcessExited, reason)
+		p.announce(fmt.Sprintf("%s; restarting in %s", reason, delay))
+		select {
+		case <-ctx.Done():
+			p.setState(ProcessStopped, reason)
+			return
+		case <-time.After(delay):
+		case <-p.restart:
+		}
+		delay = min(delay*2, maxRestartDelay)
+		p.bumpRestarts()
+	}
+}
+
+// runOnce runs the command until it exits, watching for its port to open.
+func (p *process) runOnce(ctx context.Context) error {
+	cmd := shellCommand(ctx, p.command)
+	cmd.Dir = p.dir
+	cmd.Env = append(os.Environ(), p.env...)
+	cmd.Stdout = &lineWriter{p: p, stream: "stdout"}
+	cmd.Stderr = &lineWriter{p: p, stream: "stderr"}
+	cmd.Cancel = func() error { return terminate(cmd) }
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Start(); err != nil {
+		p.announce(err.Error())
+		return err
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.status.State = ProcessStarting
+	p.status.PID = cmd.Process.Pid
+	p.status.Started = time.Now()
+	ready := p.ready
+	p.mu.Unlock()
+	p.log("proxy", fmt.Sprintf("started %q (pid %d)", p.command, cmd.Process.Pid))
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	go p.watchPort(watchCtx, ready)
+	err := cmd.Wait()
+	stopWatch()
+
+	p.mu.Lock()
+	p.cmd = nil
+	p.status.PID = 0
+	select {
+	case <-p.ready:
+		p.ready = make(chan struct{}) // requests wait for the next run
+	default:
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// watchPort marks the process ready once its address accepts connections.
+func (p *process) watchPort(ctx context.Context, ready chan struct{}) {
+	addr := p.status.Addr
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			p.mu.Lock()
+			if ctx.Err() != nil { // the run ended meanwhile
+				p.mu.Unlock()
+				return
+			}
+			p.status.State = ProcessReady
+			close(ready)
+			p.mu.Unlock()
+			p.announce("ready on " + addr)
+			p.e.upstreamRestarted(p.status.Upstream)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (p *process) setState(state, lastExit string) {
+	p.mu.Lock()
+	p.status.State = state
+	if lastExit != "" {
+		p.status.LastExit = lastExit
+	}
+	p.mu.Unlock()
+}
+
+func (p *process) bumpRestarts() {
+	p.mu.Lock()
+	p.status.Restarts++
+	p.mu.Unlock()
+}
+
+// announce logs a lifecycle message and broadcasts it as a FlowEventProcess.
+func (p *process) announce(msg string) {
+	p.log("proxy", msg)
+	p.e.store.Notify(FlowEvent{
+		Type:    FlowEventProcess,
+		Message: fmt.Sprintf("process %s: %s", p.status.Upstream, msg),
+	})
+}
+
+func (p *process) log(stream, text string) {
+	line := ProcessLine{Time: time.Now(), Upstream: p.status.Upstream, Stream: stream, Text: text}
+	p.mu.Lock()
+	if len(p.lines) < maxProcessLines {
+		p.lines = append(p.lines, line)
+	} else {
+		p.lines[p.next] = line
+		p.next = (p.next + 1) % maxProcessLines
+	}
+	p.mu.Unlock()
+
+	t := &p.e.procs
+	t.outMu.Lock()
+	if t.out != nil {
+		fmt.Fprintf(t.out, "[%s] %s\n", line.Upstream, text)
+	}
+	t.outMu.Unlock()
+}
+
+func (p *process) logs() []ProcessLine {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]ProcessLine, 0, len(p.lines))
+	out = append(out, p.lines[p.next:]...)
+	return append(out, p.lines[:p.next]...)
+}
+
+// lineWriter splits a process's output into lines for its log.
+type lineWriter struct {
+	p      *process
+	stream string
+	buf    []byte
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.p.log(w.stream, strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > 64<<10 { // no newline in sight; don't buffer forever
+		w.p.log(w.stream, string(w.buf))
+		w.buf = nil
+	}
+	return len(b), nil
+}
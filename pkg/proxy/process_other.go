@@ -0,0 +1,16 @@
+//go:build !unix
+
+package proxy
+
+import (
+	"context"
+	"os/exec"
+)
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+func terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// proxyErrorTag marks flows in FlowStateRejected.
+const proxyErrorTag = "proxy-error"
+
+// Reasons a request is rejected, tagged on its flow next to proxyErrorTag.
+const (
+	rejectNoRoute       = "no-route"       // no upstream or mock matched
+	rejectCaptureFailed = "capture-failed" // the request body could not be read
+	rejectBadRequest    = "bad-request"    // not something the proxy can forward
+)
+
+var errNoRoute = errors.New("no upstream matched")
+
+// rejectRequest answers a request that failed before it could be routed,
+// recording it as a flow of its own so it still shows up in the UIs. Ignore
+// rules and the record filter apply to it as to any other flow.
+func (e *Engine) rejectRequest(w http.ResponseWriter, r *http.Request, status int, reason string, err error) {
+	flow := e.newFlow(r, "")
+	rt := e.routing.Load()
+	if rt.ignores(flow) {
+		flow.dropped = true
+		flow.excluded = true
+	} else if !rt.records(flow) {
+		flow.dropped = true
+		flow.excluded = true
+		flow.record = rt.opts.Record.Match
+	} else {
+		e.store.Add(flow)
+	}
+	e.failRequest(w, flow, status, reason, err)
+}
+
+// failRequest finishes flow in FlowStateRejected, tagged "proxy-error" and
+// reason, with the error response the proxy sends in place of handling the
+// request, and writes that response to the client.
+func (e *Engine) failRequest(w http.ResponseWriter, flow *Flow, status int, reason string, err error) {
+	body := err.Error() + "\n"
+	now := time.Now()
+	flow.Tags = append(flow.Tags, proxyErrorTag, reason)
+	flow.Response = &CapturedResponse{
+		StatusCode: status,
+		Headers: http.Header{
+			"Content-Type":           {"text/plain; charset=utf-8"},
+			"X-Content-Type-Options": {"nosniff"},
+		},
+		Body:  []byte(body),
+		Size:  int64(len(body)),
+		Proto: "HTTP/1.1",
+	}
+	flow.Response.HeadersSize = flow.Response.headerBytes()
+	flow.Timestamps.ResponseStart = now
+	flow.Timestamps.ResponseDone = now
+	flow.State = FlowStateRejected
+	flow.Error = err.Error()
+	e.addons.FireError(flow, err)
+	e.store.Update(flow, FlowEventError)
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// SetConfigSource registers the function Reload uses to obtain fresh options,
+// typically by re-reading the config file.
+func (e *Engine) SetConfigSource(fn func() (Options, error)) {
+	e.reloadMu.Lock()
+	e.configSource = fn
+	e.reloadMu.Unlock()
+}
+
+// Reload fetches options from the config source and applies them, returning
+// a summary of the result. The outcome, success or failure, is broadcast as a
+// FlowEventReload so the UIs can show a notice, and logged.
+func (e *Engine) Reload() (string, error) {
+	e.reloadMu.Lock()
+	src := e.configSource
+	e.reloadMu.Unlock()
+	if src == nil {
+		return "", errors.New("no config file to reload")
+	}
+
+	opts, err := src()
+	if err == nil {
+		var msg string
+		if msg, err = e.Apply(opts); err == nil {
+			return msg, nil
+		}
+	}
+	log.Print("config reload failed: ", err)
+	e.store.Notify(FlowEvent{Type: FlowEventReload, Message: "config reload failed: " + err.Error()})
+	return "", err
+}
+
+// Apply swaps in new routing, rewrites, mocks, and body limits. Requests
+// already in flight finish on the configuration they started with.
+//
+// Listener settings (listen address, web port, TLS, HTTP/2, flow capacity)
+// only take effect on restart; changes to them are reported in the notice.
+func (e *Engine) Apply(opts Options) (string, error) {
+	opts.setDefaults()
+	rt, err := e.buildRouting(opts)
+	if err != nil {
+		return "", err
+	}
+
+	e.routing.Store(rt)
+	e.network.reset(rt.networkProfiles, opts)
+
+	msg := fmt.Sprintf("config reloaded: %d upstreams, %d mocks", len(opts.Upstreams), len(opts.Mocks))
+	if fixed := restartRequired(e.opts, opts); len(fixed) > 0 {
+		msg += " (restart required for " + strings.Join(fixed, ", ") + ")"
+	}
+	log.Print(msg)
+	e.store.Notify(FlowEvent{Type: FlowEventReload, Message: msg})
+	return msg, nil
+}
+
+// restartRequired lists the settings that differ between old and next but
+// cannot be changed on a running engine.
+func restartRequired(old, next Options) []string {
+	var out []string
+	if !slices.Equal(old.ListenAddrs(), next.ListenAddrs()) {
+		out = append(out, "listen")
+	}
+	if old.WebPort != next.WebPort {
+		out = append(out, "web_port")
+	}
+	if old.AutoPort != next.AutoPort {
+		out = append(out, "auto_port")
+	}
+	if old.WebAuth != next.WebAuth {
+		out = append(out, "web_auth")
+	}
+	if old.MaxFlows != next.MaxFlows {
+		out = append(out, "max_flows")
+	}
+	if old.MaxStoreBytes != next.MaxStoreBytes {
+		out = append(out, "max_store_bytes")
+	}
+	if old.SpillThreshold != next.SpillThreshold || old.SpillDir != next.SpillDir {
+		out = append(out, "spill_threshold")
+	}
+	if old.TLS != next.TLS || old.TLSCertFile != next.TLSCertFile ||
+		old.TLSKeyFile != next.TLSKeyFile || old.CertDir != next.CertDir {
+		out = append(out, "tls")
+	}
+	if old.HTTP2 != next.HTTP2 {
+		out = append(out, "http2")
+	}
+	if !maps.Equal(commands(old.Upstreams), commands(next.Upstreams)) {
+		out = append(out, "command")
+	}
+	sameBreakpoint := func(a, b Breakpoint) bool { return a.Filter == b.Filter && a.Phase == b.Phase }
+	if !slices.EqualFunc(old.Breakpoints, next.Breakpoints, sameBreakpoint) {
+		out = append(out, "breakpoints")
+	}
+	return out
+}
+
+// commands maps upstream names to their commands, which are started once.
+func commands(upstreams []Upstream) map[string]string {
+	m := make(map[string]string)
+	for _, u := range upstreams {
+		if u.Command != "" {
+			m[u.Name] = u.Command
+		}
+	}
+	return m
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy re-sends requests to an upstream that fail transiently, such
+// as a local service that drops connections while it restarts. Only
+// idempotent requests are retried: GET, HEAD, OPTIONS, TRACE, PUT, and
+// DELETE, or any method with an Idempotency-Key header. Flows that were
+// retried are tagged "retry:N" with the number of retries.
+type RetryPolicy struct {
+	// Max is the number of retries after the first attempt (default 2).
+	Max int `json:"max"`
+
+	// On lists what is retried: response statuses, as codes (502) or
+	// classes (5xx), and RetryConnectionError (default: 502, 503, 504, and
+	// connection errors).
+	On []string `json:"on,omitempty"`
+
+	// Backoff is the wait before the first retry, doubled for each one
+	// after it (default 100ms).
+	Backoff time.Duration `json:"backoff"`
+}
+
+// RetryConnectionError in RetryPolicy.On retries requests whose upstream
+// couldn't be reached or dropped the connection.
+const RetryConnectionError = "connection-error"
+
+const (
+	defaultRetryMax     = 2
+	defaultRetryBackoff = 100 * time.Millisecond
+)
+
+var defaultRetryOn = []string{"502", "503", "504", RetryConnectionError}
+
+// validate checks the policy and fills in its defaults.
+func (p *RetryPolicy) validate(upstream string) error {
+	if p.Max < 0 || p.Backoff < 0 {
+		return fmt.Errorf("retries for upstream %q: max and backoff must be >= 0", upstream)
+	}
+	if p.Max == 0 {
+		p.Max = defaultRetryMax
+	}
+	if p.Backoff == 0 {
+		p.Backoff = defaultRetryBackoff
+	}
+	if len(p.On) == 0 {
+		p.On = defaultRetryOn
+	}
+	for _, on := range p.On {
+		if on != RetryConnectionError && !validStatusPattern(on) {
+			return fmt.Errorf("retries for upstream %q: %q is not a status (503, 5xx) or %q", upstream, on, RetryConnectionError)
+		}
+	}
+	return nil
+}
+
+// retries reports whether the policy retries after resp or err.
+func (p *RetryPolicy) retries(resp *http.Response, err error) bool {
+	if err != nil {
+		return slices.Contains(p.On, RetryConnectionError) &&
+			!errors.Is(err, context.Canceled) && !errors.Is(err, errFlowKilled)
+	}
+	return statusMatches(p.On, resp.StatusCode)
+}
+
+// idempotent reports whether a request may be sent more than once.
+func idempotent(r *CapturedRequest) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Headers.Get("Idempotency-Key") != ""
+}
+
+// retryAddon arms the retry policy of a flow's upstream for requests that
+// can be re-sent. It is registered by New, so retries can be turned off
+// like any other addon.
+type retryAddon struct{}
+
+// Name identifies the addon in the addon list.
+func (retryAddon) Name() string { return "retry" }
+
+// OnRequest arms flow's retries if its request is idempotent and its body
+// was captured in full, so it can be sent again.
+func (retryAddon) OnRequest(flow *Flow) {
+	r := flow.Request
+	if flow.retryPolicy == nil || r == nil || r.BodyTruncated || !idempotent(r) ||
+		r.Headers.Get("Upgrade") != "" {
+		return
+	}
+	flow.retry = flow.retryPolicy
+}
+
+// retryTransport sends requests through next, retrying them as their
+// flow's armed policy allows.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	flow, _ := req.Context().Value(flowContextKey).(*Flow)
+	if flow == nil || flow.retry == nil || len(req.Trailer) > 0 {
+		return t.next.RoundTrip(req)
+	}
+	policy := flow.retry
+	body := flow.Request.Body
+	resp, err := t.next.RoundTrip(req)
+	n := 0
+	for ; n < policy.Max && policy.retries(resp, err); n++ {
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		wait := policy.Backoff << n
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		retry := req.Clone(req.Context())
+		retry.Body = http.NoBody
+		if len(body) > 0 {
+			retry.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err = t.next.RoundTrip(retry)
+	}
+	if n > 0 {
+		flow.Tags = append(flow.Tags, "retry:"+strconv.Itoa(n))
+	}
+	return resp, err
+}
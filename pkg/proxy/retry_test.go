@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		want    RetryPolicy
+		wantErr bool
+	}{
+		{"defaults", RetryPolicy{}, RetryPolicy{Max: 2, On: defaultRetryOn, Backoff: 100 * time.Millisecond}, false},
+		{"kept", RetryPolicy{Max: 5, On: []string{"5xx"}, Backoff: time.Second}, RetryPolicy{Max: 5, On: []string{"5xx"}, Backoff: time.Second}, false},
+		{"connection errors only", RetryPolicy{On: []string{RetryConnectionError}}, RetryPolicy{Max: 2, On: []string{RetryConnectionError}, Backoff: 100 * time.Millisecond}, false},
+		{"negative max", RetryPolicy{Max: -1}, RetryPolicy{}, true},
+		{"negative backoff", RetryPolicy{Backoff: -time.Second}, RetryPolicy{}, true},
+		{"bad status", RetryPolicy{On: []string{"50x"}}, RetryPolicy{}, true},
+		{"bad word", RetryPolicy{On: []string{"timeout"}}, RetryPolicy{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			err := p.validate("api")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate: err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Max != tt.want.Max || p.Backoff != tt.want.Backoff || !slices.Equal(p.On, tt.want.On) {
+				t.Errorf("validate filled in %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetries(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name   string
+		on     []string
+		status int
+		err    error
+		want   bool
+	}{
+		{"default 502", nil, 502, nil, true},
+		{"default 503", nil, 503, nil, true},
+		{"default 500", nil, 500, nil, false},
+		{"default 200", nil, 200, nil, false},
+		{"default connection error", nil, 0, dialErr, true},
+		{"class", []string{"5xx"}, 500, nil, true},
+		{"class miss", []string{"5xx"}, 429, nil, false},
+		{"code", []string{"429"}, 429, nil, true},
+		{"statuses only", []string{"503"}, 0, dialErr, false},
+		{"cancelled", nil, 0, context.Canceled, false},
+		{"killed", nil, 0, errFlowKilled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RetryPolicy{On: tt.on}
+			if err := p.validate("api"); err != nil {
+				t.Fatal(err)
+			}
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := p.retries(resp, tt.err); got != tt.want {
+				t.Errorf("retries(%d, %v) = %v, want %v", tt.status, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	tests := []struct {
+		method string
+		key    string
+		want   bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodHead, "", true},
+		{http.MethodOptions, "", true},
+		{http.MethodTrace, "", true},
+		{http.MethodPut, "", true},
+		{http.MethodDelete, "", true},
+		{http.MethodPost, "", false},
+		{http.MethodPatch, "", false},
+		{http.MethodPost, "order-42", true},
+	}
+	for _, tt := range tests {
+		r := &CapturedRequest{Method: tt.method, Headers: http.Header{}}
+		if tt.key != "" {
+			r.Headers.Set("Idempotency-Key", tt.key)
+		}
+		if got := idempotent(r); got != tt.want {
+			t.Errorf("idempotent(%s, key %q) = %v, want %v", tt.method, tt.key, got, tt.want)
+		}
+	}
+}
+
+// scriptedTransport answers each request with the next status, or with a
+// connection error for 0, and records the bodies it was sent.
+type scriptedTransport struct {
+	statuses []int
+	bodies   []string
+}
+
+func (s *scriptedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	s.bodies = append(s.bodies, string(body))
+	status := s.statuses[0]
+	s.statuses = s.statuses[1:]
+	if status == 0 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		truncated  bool
+		statuses   []int
+		wantStatus int
+		wantSent   int
+		wantTag    string
+	}{
+		{"first try", "GET", "", false, []int{200}, 200, 1, ""},
+		{"after a 503", "GET", "", false, []int{503, 200}, 200, 2, "retry:1"},
+		{"after a connection error", "PUT", "payload", false, []int{0, 200}, 200, 2, "retry:1"},
+		{"gives up after max", "GET", "", false, []int{502, 502, 502}, 502, 3, "retry:2"},
+		{"not a retried status", "GET", "", false, []int{500}, 500, 1, ""},
+		{"not idempotent", "POST", "payload", false, []int{503}, 503, 1, ""},
+		{"truncated body", "PUT", "payload", true, []int{503}, 503, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetryPolicy{Backoff: time.Millisecond}
+			if err := policy.validate("api"); err != nil {
+				t.Fatal(err)
+			}
+			flow := &Flow{
+				Request: &CapturedRequest{
+					Method:        tt.method,
+					URL:           "http://api.test/items",
+					Headers:       http.Header{},
+					Body:          []byte(tt.body),
+					BodyTruncated: tt.truncated,
+				},
+				retryPolicy: policy,
+			}
+			retryAddon{}.OnRequest(flow)
+
+			next := &scriptedTransport{statuses: tt.statuses}
+			ctx := context.WithValue(context.Background(), flowContextKey, flow)
+			req, err := http.NewRequestWithContext(ctx, tt.method, "http://api.test/items", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := (&retryTransport{next: next}).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if len(next.bodies) != tt.wantSent {
+				t.Errorf("sent %d times, want %d", len(next.bodies), tt.wantSent)
+			}
+			for i, b := range next.bodies {
+				if b != tt.body {
+					t.Errorf("attempt %d sent body %q, want %q", i+1, b, tt.body)
+				}
+			}
+			var tag string
+			for _, tg := range flow.Tags {
+				if strings.HasPrefix(tg, "retry:") {
+					tag = tg
+				}
+			}
+			if tag != tt.wantTag {
+				t.Errorf("tag = %q, want %q", tag, tt.wantTag)
+			}
+		})
+	}
+}
@@ -2,22 +2,227 @@ package proxy
 
 import (
 	"fmt"
+	"math"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 // Upstream defines a single proxy target.
 type Upstream struct {
 	Name   string // display name (e.g. "ctl-api")
 	Prefix string // URL path prefix to match (e.g. "/api"); use "/" for catch-all
-	Target string // target base URL (e.g. "http://localhost:8081")
+	Target string // target base URL (e.g. "http://localhost:8081"), or PassthroughTarget
+
+	// PrefixRegex, if set, replaces Prefix matching with a regular expression
+	// anchored at the start of the path (e.g. "/api/v[0-9]+/(.*)").
+	PrefixRegex string
+
+	// StripPrefix removes the matched prefix (or regex match) from the path
+	// before forwarding.
+	StripPrefix bool
+
+	// RewriteTo replaces the matched prefix (or regex match) with this
+	// string. With PrefixRegex, $1-style references expand to capture groups.
+	RewriteTo string
+
+	// H2C speaks cleartext HTTP/2 (prior knowledge) to an http:// target,
+	// e.g. for gRPC servers. https:// targets negotiate HTTP/2 automatically.
+	H2C bool
+
+	// Rules further restrict which requests this upstream receives. A request
+	// matches if the prefix matches and any rule matches (or there are none).
+	Rules []Rule
+
+	// Targets splits traffic across several base URLs by weight (e.g. 90/10
+	// for a canary). When empty, Target receives all traffic.
+	Targets []Target
+
+	// RateLimit, if set, caps the request rate forwarded to this upstream.
+	// Requests over the limit get a 429 without reaching the upstream.
+	RateLimit *RateLimit
+
+	// AllowHosts lists the hosts a passthrough upstream may forward to, as
+	// path.Match globs (e.g. "*.test"). Required with PassthroughTarget.
+	AllowHosts []string
+
+	// PassthroughPort, if set, replaces the port from the Host header.
+	PassthroughPort int
+
+	// TLS configures certificate checks and client certificates for
+	// https:// targets. Nil uses the system defaults.
+	TLS *UpstreamTLS
+
+	// Transport tunes timeouts and connection pooling. Nil uses the
+	// defaults of http.DefaultTransport.
+	Transport *UpstreamTransport
+
+	// Affinity keeps clients on one of several Targets.
+	Affinity *Affinity
+
+	// CORS overrides the CORS headers of this upstream's responses, in
+	// place of Options.CORS.
+	CORS *CORS
+
+	// SampleRate is the fraction of this upstream's flows that are stored,
+	// in place of Options.SampleRate; the rest are proxied but not kept.
+	// 0 uses Options.SampleRate.
+	SampleRate float64
+
+	// Alerts flag this upstream's slow or failing flows, in place of
+	// Options.Alerts.
+	Alerts *Alerts
+
+	// Capture limits body capture for this upstream, in place of
+	// Options.Capture. An empty, non-nil list captures bodies in full.
+	Capture []CaptureRule
+
+	// Auth attaches credentials to the requests forwarded to this upstream.
+	Auth *UpstreamAuth
+
+	// Mirror, if set, also sends a copy of each request to another target.
+	Mirror *Mirror
+
+	// Retry, if set, re-sends idempotent requests that fail transiently.
+	Retry *RetryPolicy
+
+	// HoldTimeout, if set, holds requests to a target that can't be
+	// reached for up to this long, until it is back (see hold.go), rather
+	// than failing them straight away. It also bounds how long requests wait
+	// for a Command to open its port. HealthCheck, if set, is the path whose
+	// GET must answer below 500 for a down target to count as back;
+	// otherwise an open port will do.
+	HoldTimeout time.Duration
+	HealthCheck string
+
+	// Network names the network profile simulated for this upstream's
+	// requests, in place of Options.Network.
+	Network string
+
+	// Command, if set, is a shell command that runs the upstream's server.
+	// The engine keeps it running and holds requests until Target's port
+	// opens (see process.go). CommandDir is its working directory, and
+	// CommandEnv adds to its environment.
+	Command    string
+	CommandDir string
+	CommandEnv map[string]string
+
+	parsed    *url.URL
+	re        *regexp.Regexp
+	prefixLen int // the routing precedence; see literalPrefixLen
+	limiter   *rate.Limiter
+	transport *http.Transport // nil: http.DefaultTransport
+}
+
+// RateLimit is a token-bucket limit: RPS requests per second on average, with
+// bursts of up to Burst requests (default: RPS rounded up, at least 1).
+type RateLimit struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// Target is one weighted destination of an upstream.
+type Target struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"` // relative share; 0 disables the target
+
 	parsed *url.URL
 }
 
-// Router routes incoming requests to upstreams based on path prefix.
-// Longer prefixes take precedence over shorter ones.
+// Rule is a routing predicate; all of its non-empty conditions must hold.
+type Rule struct {
+	// Methods lists allowed HTTP methods (case-insensitive).
+	Methods []string `json:"methods,omitempty"`
+
+	// Headers maps header names to required values. An empty value only
+	// requires the header to be present; otherwise any of the header's values
+	// must equal it (case-insensitive).
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Query maps query parameter names to required values, with the same
+	// presence/equality semantics as Headers (values are case-sensitive).
+	Query map[string]string `json:"query,omitempty"`
+}
+
+// Matches reports whether req satisfies every condition in the rule.
+func (r Rule) Matches(req *http.Request) bool {
+	if len(r.Methods) > 0 {
+		ok := false
+		for _, m := range r.Methods {
+			if strings.EqualFold(m, req.Method) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for k, want := range r.Headers {
+		vv := req.Header.Values(k)
+		if len(vv) == 0 {
+			return false
+		}
+		if want == "" {
+			continue
+		}
+		ok := false
+		for _, v := range vv {
+			if strings.EqualFold(strings.TrimSpace(v), want) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.Query) > 0 {
+		q := req.URL.Query()
+		for k, want := range r.Query {
+			vv, present := q[k]
+			if !present {
+				return false
+			}
+			if want != "" && !slices.Contains(vv, want) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches reports whether the upstream should handle req.
+func (u *Upstream) matches(req *http.Request) bool {
+	if u.re != nil {
+		if !u.re.MatchString(req.URL.Path) {
+			return false
+		}
+	} else if u.Prefix != "/" && !strings.HasPrefix(req.URL.Path, u.Prefix) {
+		return false
+	}
+	if len(u.Rules) == 0 {
+		return true
+	}
+	for _, r := range u.Rules {
+		if r.Matches(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// Router routes incoming requests to upstreams based on path prefix and
+// optional rules. Longer prefixes take precedence over shorter ones; for equal
+// prefixes, upstreams with rules are tried before those without, then in
+// configuration order.
 type Router struct {
 	upstreams []Upstream
 }
@@ -29,32 +234,232 @@ func NewRouter(upstreams []Upstream) (*Router, error) {
 		if u.Prefix == "" {
 			u.Prefix = "/"
 		}
-		parsed, err := url.Parse(u.Target)
-		if err != nil {
-			return nil, fmt.Errorf("invalid target %q for upstream %q: %w", u.Target, u.Name, err)
+		if err := u.prepareTargets(); err != nil {
+			return nil, err
+		}
+		if err := u.prepareLimiter(); err != nil {
+			return nil, err
+		}
+		if err := u.prepareTransport(); err != nil {
+			return nil, err
+		}
+		if u.SampleRate < 0 || u.SampleRate > 1 {
+			return nil, fmt.Errorf("sample_rate for upstream %q must be between 0 and 1, got %g", u.Name, u.SampleRate)
+		}
+		if u.Alerts != nil {
+			if err := u.Alerts.validate(fmt.Sprintf("upstream %q", u.Name)); err != nil {
+				return nil, err
+			}
+		}
+		if err := validateCaptureRules(u.Capture, fmt.Sprintf("upstream %q", u.Name)); err != nil {
+			return nil, err
+		}
+		if u.Affinity != nil {
+			if err := u.Affinity.validate(u.Name); err != nil {
+				return nil, err
+			}
 		}
-		u.parsed = parsed
+		if u.Auth != nil {
+			if err := u.Auth.validate(u.Name); err != nil {
+				return nil, err
+			}
+		}
+		if u.Retry != nil {
+			rp := *u.Retry
+			if err := rp.validate(u.Name); err != nil {
+				return nil, err
+			}
+			u.Retry = &rp
+		}
+		if u.HoldTimeout < 0 {
+			return nil, fmt.Errorf("hold_timeout for upstream %q must be >= 0", u.Name)
+		}
+		if u.HealthCheck != "" && !strings.HasPrefix(u.HealthCheck, "/") {
+			return nil, fmt.Errorf("health_check for upstream %q must be a path starting with /, got %q", u.Name, u.HealthCheck)
+		}
+		if u.PrefixRegex != "" {
+			re, err := regexp.Compile("^(?:" + strings.TrimPrefix(u.PrefixRegex, "^") + ")")
+			if err != nil {
+				return nil, fmt.Errorf("invalid prefix_regex %q for upstream %q: %w", u.PrefixRegex, u.Name, err)
+			}
+			u.re = re
+		}
+		u.prefixLen = u.literalPrefixLen()
 		r.upstreams = append(r.upstreams, u)
 	}
-	// Longest prefix wins.
-	sort.Slice(r.upstreams, func(i, j int) bool {
-		return len(r.upstreams[i].Prefix) > len(r.upstreams[j].Prefix)
+	names := make(map[string]bool, len(r.upstreams))
+	for _, u := range r.upstreams {
+		names[u.Name] = true
+	}
+	for _, u := range r.upstreams {
+		if u.Mirror != nil {
+			if err := u.Mirror.validate(u.Name, names); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Longest prefix wins; rule-restricted upstreams shadow catch-alls.
+	sort.SliceStable(r.upstreams, func(i, j int) bool {
+		a, b := &r.upstreams[i], &r.upstreams[j]
+		if a.prefixLen != b.prefixLen {
+			return a.prefixLen > b.prefixLen
+		}
+		return len(a.Rules) > 0 && len(b.Rules) == 0
 	})
 	return r, nil
 }
 
-// Match returns the best-matching upstream for the given request path, or nil.
+// Match returns the best-matching upstream for the given request, or nil.
 func (r *Router) Match(req *http.Request) *Upstream {
-	path := req.URL.Path
 	for i := range r.upstreams {
 		u := &r.upstreams[i]
-		if u.Prefix == "/" || strings.HasPrefix(path, u.Prefix) {
+		if u.matches(req) {
 			return u
 		}
 	}
 	return nil
 }
 
+// prepareLimiter validates RateLimit and creates the upstream's limiter.
+func (u *Upstream) prepareLimiter() error {
+	if u.RateLimit == nil {
+		return nil
+	}
+	rl := *u.RateLimit
+	if rl.RPS <= 0 {
+		return fmt.Errorf("rate_limit for upstream %q: rps must be > 0", u.Name)
+	}
+	if rl.Burst < 0 {
+		return fmt.Errorf("rate_limit for upstream %q: burst must be >= 0", u.Name)
+	}
+	if rl.Burst == 0 {
+		rl.Burst = max(1, int(math.Ceil(rl.RPS)))
+	}
+	u.RateLimit = &rl
+	u.limiter = rate.NewLimiter(rate.Limit(rl.RPS), rl.Burst)
+	return nil
+}
+
+// allow takes a token from the upstream's rate limiter. When none is
+// available it returns false and how long until one will be.
+func (u *Upstream) allow() (bool, time.Duration) {
+	if u.limiter == nil {
+		return true, 0
+	}
+	r := u.limiter.Reserve()
+	if d := r.Delay(); d > 0 {
+		r.Cancel()
+		return false, d
+	}
+	return true, 0
+}
+
+// prepareTargets parses Target/Targets and normalises them so that Targets
+// always holds at least one entry and Target names the primary destination.
+func (u *Upstream) prepareTargets() error {
+	if u.Passthrough() {
+		return u.preparePassthrough()
+	}
+	if len(u.Targets) == 0 {
+		u.Targets = []Target{{URL: u.Target, Weight: 1}}
+	} else {
+		u.Targets = slices.Clone(u.Targets)
+	}
+	total := 0
+	for i := range u.Targets {
+		t := &u.Targets[i]
+		parsed, err := url.Parse(t.URL)
+		if err != nil {
+			return fmt.Errorf("invalid target %q for upstream %q: %w", t.URL, u.Name, err)
+		}
+		if t.Weight < 0 {
+			return fmt.Errorf("negative weight for target %q of upstream %q", t.URL, u.Name)
+		}
+		t.parsed = parsed
+		total += t.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("upstream %q has no target with a positive weight", u.Name)
+	}
+	if u.Target == "" {
+		u.Target = u.Targets[0].URL
+	}
+	u.parsed = u.Targets[0].parsed
+	return nil
+}
+
+func (u *Upstream) totalWeight() int {
+	total := 0
+	for _, t := range u.Targets {
+		total += t.Weight
+	}
+	return total
+}
+
+// weightedTarget returns the target covering point n of the cumulative
+// weights, or a target chosen at random in proportion to weight if n < 0.
+func (u *Upstream) weightedTarget(n int) *Target {
+	if n < 0 {
+		n = rand.IntN(u.totalWeight())
+	}
+	for i := range u.Targets {
+		n -= u.Targets[i].Weight
+		if n < 0 {
+			return &u.Targets[i]
+		}
+	}
+	return &u.Targets[0]
+}
+
+// literalPrefixLen is the sort key for routing precedence. For regex
+// upstreams it is the length of the regex's literal prefix. NewRouter
+// computes it once per upstream, as prefixLen, rather than in the sort.
+func (u *Upstream) literalPrefixLen() int {
+	if u.PrefixRegex == "" {
+		return len(u.Prefix)
+	}
+	re, err := regexp.Compile(strings.TrimPrefix(u.PrefixRegex, "^"))
+	if err != nil {
+		return 0
+	}
+	lit, _ := re.LiteralPrefix()
+	return len(lit)
+}
+
+// rewritePath applies StripPrefix / RewriteTo to an incoming path.
+func (u *Upstream) rewritePath(p string) string {
+	if !u.StripPrefix && u.RewriteTo == "" {
+		return p
+	}
+	var rest string
+	var replacement []byte
+	if u.re != nil {
+		idx := u.re.FindStringSubmatchIndex(p)
+		if idx == nil {
+			return p
+		}
+		rest = p[idx[1]:]
+		if u.RewriteTo != "" {
+			replacement = u.re.ExpandString(nil, u.RewriteTo, p, idx)
+		}
+	} else {
+		if !strings.HasPrefix(p, u.Prefix) {
+			return p
+		}
+		// A "/" catch-all strips nothing, but RewriteTo still prepends.
+		rest = p
+		if u.Prefix != "/" {
+			rest = strings.TrimPrefix(p, u.Prefix)
+		}
+		replacement = []byte(u.RewriteTo)
+	}
+	out := string(replacement) + rest
+	if !strings.HasPrefix(out, "/") {
+		out = "/" + out
+	}
+	return out
+}
+
 // Upstreams returns a read-only copy of the configured upstreams.
 func (r *Router) Upstreams() []Upstream {
 	cp := make([]Upstream, len(r.upstreams))
@@ -63,19 +468,35 @@ func (r *Router) Upstreams() []Upstream {
 }
 
 // Director returns an http.Request director for use with httputil.ReverseProxy.
-// It rewrites the outgoing request URL to point at the upstream target.
+// It rewrites the outgoing request URL to point at the upstream target, or at
+// the weighted target chosen for the request when one is in its context.
 func Director(upstream *Upstream) func(*http.Request) {
-	target := upstream.parsed
 	return func(req *http.Request) {
+		target := upstream.parsed
+		if t, ok := req.Context().Value(targetContextKey).(*Target); ok {
+			target = t.parsed
+		}
+
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
 
+		if p := upstream.rewritePath(req.URL.Path); p != req.URL.Path {
+			req.URL.Path = p
+			req.URL.RawPath = ""
+		}
+
 		// Prepend the target's base path if it has one.
 		if p := target.Path; p != "" && p != "/" {
 			req.URL.Path = strings.TrimSuffix(p, "/") + req.URL.Path
 		}
 
 		req.Host = target.Host
+		if flow, ok := req.Context().Value(flowContextKey).(*Flow); ok {
+			flow.TargetURL = req.URL.String()
+		}
+		if upstream.Passthrough() {
+			req.Header.Add("Via", "1.1 "+viaToken)
+		}
 
 		// Propagate the real client IP.
 		if prior, ok := req.Header["X-Forwarded-For"]; ok {
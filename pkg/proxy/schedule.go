@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// scheduleTick is how often the scheduler checks for jobs that are due.
+const scheduleTick = time.Second
+
+// Results of a scheduled job's latest finished run, in JobStatus.Result.
+const (
+	JobPending = "pending" // no run has finished yet
+	JobPass    = "pass"
+	JobFail    = "fail"
+)
+
+// ScheduledJob replays captured flows every Interval, a lightweight smoke
+// test built from recorded traffic. Each run is a bulk replay (see
+// BulkReplay) that passes if every replay gets an expected status, and fails
+// otherwise, or if there was nothing to replay.
+type ScheduledJob struct {
+	Name string
+
+	// Filter selects the stored flows to replay; Match is its parsed form,
+	// filled in like IgnoreRule.Match. Replays are never selected.
+	Filter string
+	Match  Matcher
+
+	// Flows lists the IDs of flows to replay, in addition to those Filter
+	// selects. Flows no longer stored are skipped.
+	Flows []string
+
+	Target   string // see ReplayOptions.Target
+	Interval time.Duration
+
+	// Expect lists the statuses that pass: codes ("200") or classes
+	// ("2xx"). Empty expects each replay to get its original's status.
+	Expect []string
+
+	// Assert adds checks on each replay's response; see Assertions.
+	Assert *Assertions
+}
+
+// JobStatus reports on a scheduled job: its definition, its latest run, and
+// the result of the latest finished run.
+type JobStatus struct {
+	Name       string      `json:"name"`
+	Filter     string      `json:"filter,omitempty"`
+	Flows      []string    `json:"flows,omitempty"`
+	Target     string      `json:"target,omitempty"`
+	IntervalMS int64       `json:"intervalMs"`
+	Expect     []string    `json:"expect,omitempty"`
+	Assert     *Assertions `json:"assert,omitempty"`
+	Result     string      `json:"result"`   // JobPending, JobPass, or JobFail
+	Runs       int         `json:"runs"`     // finished runs
+	Failures   int         `json:"failures"` // finished runs that failed
+	LastRun    *ReplayJob  `json:"lastRun,omitempty"`
+	Next       time.Time   `json:"next,omitzero"`
+}
+
+// scheduleTable tracks the runs of the scheduled jobs, by name.
+type scheduleTable struct {
+	mu    sync.Mutex
+	state map[string]*scheduleState
+}
+
+type scheduleState struct {
+	interval time.Duration // the interval next was set with
+	next     time.Time
+	running  bool
+	lastRun  string // the ID of the latest run's ReplayJob
+	result   string
+	runs     int
+	failures int
+}
+
+// validate checks a scheduled job's definition.
+func (j *ScheduledJob) validate() error {
+	if j.Name == "" {
+		return fmt.Errorf("scheduled job has no name")
+	}
+	if j.Interval < time.Second {
+		return fmt.Errorf("scheduled job %q: interval must be at least 1s", j.Name)
+	}
+	if j.Filter == "" && len(j.Flows) == 0 {
+		return fmt.Errorf("scheduled job %q: needs a filter or flows to replay", j.Name)
+	}
+	if j.Filter != "" && j.Match == nil {
+		return fmt.Errorf("scheduled job %q: filter %q has no matcher", j.Name, j.Filter)
+	}
+	for _, s := range j.Expect {
+		if !validStatusPattern(s) {
+			return fmt.Errorf("scheduled job %q: expect %q is not a code (200) or class (2xx)", j.Name, s)
+		}
+	}
+	if err := j.Assert.Validate(); err != nil {
+		return fmt.Errorf("scheduled job %q: %w", j.Name, err)
+	}
+	return nil
+}
+
+// runSchedules starts the runs of the scheduled jobs as they fall due, until
+// ctx is done. Jobs come from the current options, so reloads add, change,
+// and remove them; a job's first run is one interval after it appears.
+func (e *Engine) runSchedules(ctx context.Context) {
+	t := time.NewTicker(scheduleTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			e.startDueJobs(now)
+		}
+	}
+}
+
+// startDueJobs starts a run of every scheduled job that is due and not still
+// running, and forgets jobs no longer configured.
+func (e *Engine) startDueJobs(now time.Time) {
+	jobs := e.routing.Load().opts.Jobs
+	var due []ScheduledJob
+	e.schedules.mu.Lock()
+	if e.schedules.state == nil {
+		e.schedules.state = make(map[string]*scheduleState)
+	}
+	names := make(map[string]bool)
+	for _, j := range jobs {
+		names[j.Name] = true
+		st := e.schedules.state[j.Name]
+		if st == nil {
+			st = &scheduleState{result: JobPending}
+			e.schedules.state[j.Name] = st
+		}
+		if st.interval != j.Interval {
+			st.interval = j.Interval
+			st.next = now.Add(j.Interval)
+		}
+		if now.Before(st.next) || st.running {
+			continue
+		}
+		st.next = now.Add(j.Interval)
+		st.running = true
+		due = append(due, j)
+	}
+	for name := range e.schedules.state {
+		if !names[name] {
+			delete(e.schedules.state, name)
+		}
+	}
+	e.schedules.mu.Unlock()
+
+	for _, j := range due {
+		_, _ = e.startScheduledRun(j) // failures are logged
+	}
+}
+
+// startScheduledRun replays the flows j selects as a bulk replay job,
+// recording its result when it finishes. Only the latest run of each
+// scheduled job is kept in the job table.
+func (e *Engine) startScheduledRun(j ScheduledJob) (ReplayJob, error) {
+	var flows []*Flow
+	for _, f := range e.store.All() {
+		if f.Request != nil && f.ReplayOf == "" && j.Match != nil && j.Match(f) {
+			flows = append(flows, f)
+		}
+	}
+	for _, id := range j.Flows {
+		if f := e.store.Get(id); f != nil && f.Request != nil && !slices.Contains(flows, f) {
+			flows = append(flows, f)
+		}
+	}
+	run, err := e.startJob(flows, BulkReplayOptions{
+		Filter:   j.Filter,
+		Target:   j.Target,
+		Assert:   j.Assert,
+		schedule: j.Name,
+		expect:   j.expect,
+		done:     func(run ReplayJob) { e.finishScheduledRun(j.Name, run) },
+	})
+
+	e.schedules.mu.Lock()
+	st := e.schedules.state[j.Name]
+	var previous string
+	if st != nil {
+		if err != nil {
+			st.running = false
+		} else {
+			previous, st.lastRun = st.lastRun, run.ID
+		}
+	}
+	e.schedules.mu.Unlock()
+	if err != nil {
+		log.Printf("scheduled job %s: %v", j.Name, err)
+	}
+	if previous != "" {
+		e.jobs.mu.Lock()
+		delete(e.jobs.jobs, previous)
+		e.jobs.mu.Unlock()
+	}
+	return run, err
+}
+
+// finishScheduledRun records the result of a scheduled job's run, logging
+// failures.
+func (e *Engine) finishScheduledRun(name string, run ReplayJob) {
+	result := JobPass
+	if run.Failed > 0 || run.Total == 0 || run.State == JobCancelled {
+		result = JobFail
+	}
+	e.schedules.mu.Lock()
+	if st := e.schedules.state[name]; st != nil {
+		st.running = false
+		st.result = result
+		st.runs++
+		if result == JobFail {
+			st.failures++
+		}
+	}
+	e.schedules.mu.Unlock()
+
+	switch {
+	case run.Total == 0:
+		log.Printf("scheduled job %s failed: no flows to replay", name)
+	case run.Failed > 0:
+		log.Printf("scheduled job %s failed: %d of %d replays", name, run.Failed, run.Total)
+	}
+}
+
+// expect reports whether a replay got a status j expects.
+func (j ScheduledJob) expect(replay, original *Flow) bool {
+	if replay.Response == nil {
+		return false
+	}
+	if len(j.Expect) > 0 {
+		return statusMatches(j.Expect, replay.Response.StatusCode)
+	}
+	return original.Response == nil || replay.Response.StatusCode == original.Response.StatusCode
+}
+
+// Jobs reports on the scheduled jobs, in the order they are configured.
+func (e *Engine) Jobs() []JobStatus {
+	jobs := e.routing.Load().opts.Jobs
+	out := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		js := JobStatus{
+			Name:       j.Name,
+			Filter:     j.Filter,
+			Flows:      j.Flows,
+			Target:     j.Target,
+			IntervalMS: j.Interval.Milliseconds(),
+			Expect:     j.Expect,
+			Assert:     j.Assert,
+			Result:     JobPending,
+		}
+		e.schedules.mu.Lock()
+		var lastRun string
+		if st := e.schedules.state[j.Name]; st != nil {
+			js.Result, js.Runs, js.Failures = st.result, st.runs, st.failures
+			js.Next = st.next
+			lastRun = st.lastRun
+		}
+		e.schedules.mu.Unlock()
+		if run, ok := e.Job(lastRun); ok {
+			js.LastRun = &run
+		}
+		out = append(out, js)
+	}
+	return out
+}
+
+// RunJob starts a run of the scheduled job called name now, unless one is
+// still running, and returns it. The job's next run is an interval later.
+func (e *Engine) RunJob(name string) (ReplayJob, error) {
+	jobs := e.routing.Load().opts.Jobs
+	idx := slices.IndexFunc(jobs, func(j ScheduledJob) bool { return j.Name == name })
+	if idx < 0 {
+		return ReplayJob{}, fmt.Errorf("scheduled job %q not found", name)
+	}
+	j := jobs[idx]
+	e.schedules.mu.Lock()
+	if e.schedules.state == nil {
+		e.schedules.state = make(map[string]*scheduleState)
+	}
+	st := e.schedules.state[name]
+	if st == nil {
+		st = &scheduleState{result: JobPending, interval: j.Interval}
+		e.schedules.state[name] = st
+	}
+	if st.running {
+		e.schedules.mu.Unlock()
+		return ReplayJob{}, fmt.Errorf("scheduled job %q is still running", name)
+	}
+	st.running = true
+	st.next = time.Now().Add(j.Interval)
+	e.schedules.mu.Unlock()
+
+	return e.startScheduledRun(j)
+}
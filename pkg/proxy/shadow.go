@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShadowCompare diffs each mirrored response against the primary's, for a
+// Mirror. The status is always compared, response headers only when listed,
+// and bodies as in Diff: JSON structurally, anything else as a whole.
+// Primary flows whose responses differ are tagged "shadow-mismatch" and get
+// the changes as "shadow" meta; Engine.ShadowReport aggregates them.
+type ShadowCompare struct {
+	// Headers lists the response headers compared.
+	Headers []string `json:"headers,omitempty"`
+
+	// Ignore lists JSON body paths expected to differ, such as
+	// "updatedAt" or "items[*].id", in the form of Diff's change paths
+	// without "response.body."; [*] matches any index. Ignoring a path
+	// ignores everything below it.
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// maxShadowRecent caps the mismatches ShadowReport lists.
+const maxShadowRecent = 50
+
+// ShadowReport aggregates the comparisons of primary and mirrored responses
+// since the proxy started or the report was reset.
+type ShadowReport struct {
+	Compared   int `json:"compared"`
+	Mismatched int `json:"mismatched"`
+
+	// Fields counts mismatches by change path, with array indexes as [*].
+	Fields map[string]int `json:"fields"`
+
+	// Endpoints breaks the comparisons down by upstream, method, and
+	// normalized path, most mismatches first.
+	Endpoints []ShadowEndpoint `json:"endpoints"`
+
+	// Recent lists the latest mismatches, newest first.
+	Recent []ShadowMismatch `json:"recent"`
+}
+
+// ShadowEndpoint counts one endpoint's comparisons.
+type ShadowEndpoint struct {
+	Upstream   string `json:"upstream"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Compared   int    `json:"compared"`
+	Mismatched int    `json:"mismatched"`
+}
+
+// ShadowMismatch is one primary response that differed from its mirror's.
+// Shadow is the mirrored flow's ID if it was captured.
+type ShadowMismatch struct {
+	Time     time.Time `json:"time"`
+	Primary  string    `json:"primary"`
+	Shadow   string    `json:"shadow,omitempty"`
+	Upstream string    `json:"upstream"`
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	Changes  []Change  `json:"changes"`
+}
+
+// shadowPair joins a primary flow and its mirrored copy until both have
+// finished.
+type shadowPair struct {
+	mu      sync.Mutex
+	primary *Flow
+	shadow  *Flow
+	done    int // how many of the two have finished
+	compare *ShadowCompare
+	stored  bool // the copy is captured, so its ID can be reported
+}
+
+// finish records that one side has finished and reports whether both have.
+func (p *shadowPair) finish(shadow *Flow) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if shadow != nil {
+		p.shadow = shadow
+	}
+	p.done++
+	return p.done == 2
+}
+
+// shadowTable accumulates the shadow report.
+type shadowTable struct {
+	mu         sync.Mutex
+	compared   int
+	mismatched int
+	fields     map[string]int
+	endpoints  map[[3]string]*ShadowEndpoint
+	recent     []ShadowMismatch // oldest first
+}
+
+// ShadowReport returns the comparisons of mirrored responses so far.
+func (e *Engine) ShadowReport() ShadowReport {
+	t := &e.shadows
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := ShadowReport{
+		Compared:   t.compared,
+		Mismatched: t.mismatched,
+		Fields:     maps.Clone(t.fields),
+		Endpoints:  []ShadowEndpoint{},
+		Recent:     slices.Clone(t.recent),
+	}
+	if r.Fields == nil {
+		r.Fields = map[string]int{}
+	}
+	for _, ep := range t.endpoints {
+		r.Endpoints = append(r.Endpoints, *ep)
+	}
+	slices.SortFunc(r.Endpoints, func(a, b ShadowEndpoint) int {
+		return cmp.Or(cmp.Compare(b.Mismatched, a.Mismatched), cmp.Compare(b.Compared, a.Compared),
+			cmp.Compare(a.Upstream, b.Upstream), cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+	slices.Reverse(r.Recent)
+	if r.Recent == nil {
+		r.Recent = []ShadowMismatch{}
+	}
+	return r
+}
+
+// ResetShadowReport clears the shadow report. Flows keep their tags.
+func (e *Engine) ResetShadowReport() {
+	t := &e.shadows
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.compared, t.mismatched = 0, 0
+	t.fields, t.endpoints, t.recent = nil, nil, nil
+}
+
+// shadowAddon finishes the primary side of shadow comparisons. It is
+// registered by New, so comparing can be turned off like any other addon.
+type shadowAddon struct {
+	e *Engine
+}
+
+// Name identifies the addon in the addon list.
+func (shadowAddon) Name() string { return "shadow" }
+
+// OnComplete compares flow with its mirrored copy if that has finished.
+func (a shadowAddon) OnComplete(flow *Flow) { a.finish(flow) }
+
+// OnError compares flow with its mirrored copy if that has finished.
+func (a shadowAddon) OnError(flow *Flow, _ error) { a.finish(flow) }
+
+func (a shadowAddon) finish(flow *Flow) {
+	if p := flow.shadow; p != nil && p.finish(nil) {
+		a.e.compareShadow(p)
+	}
+}
+
+// compareShadow diffs a finished pair and records the result.
+func (e *Engine) compareShadow(p *shadowPair) {
+	if p.shadow == nil {
+		return // the copy couldn't be sent
+	}
+	primary := p.primary
+	changes := shadowChanges(primary, p.shadow, p.compare)
+
+	var shadowID string
+	if p.stored {
+		shadowID = p.shadow.ID
+	}
+	t := &e.shadows
+	t.mu.Lock()
+	if t.endpoints == nil {
+		t.fields = make(map[string]int)
+		t.endpoints = make(map[[3]string]*ShadowEndpoint)
+	}
+	key := [3]string{primary.Upstream, primary.Request.Method, e.NormalizePath(primary.Request.Path)}
+	ep := t.endpoints[key]
+	if ep == nil {
+		ep = &ShadowEndpoint{Upstream: key[0], Method: key[1], Path: key[2]}
+		t.endpoints[key] = ep
+	}
+	t.compared++
+	ep.Compared++
+	if len(changes) > 0 {
+		t.mismatched++
+		ep.Mismatched++
+		for _, c := range changes {
+			t.fields[anyIndex.ReplaceAllString(c.Path, "[*]")]++
+		}
+		t.recent = append(t.recent, ShadowMismatch{
+			Time: time.Now(), Primary: primary.ID, Shadow: shadowID,
+			Upstream: primary.Upstream, Method: primary.Request.Method, URL: primary.Request.URL,
+			Changes: changes,
+		})
+		if len(t.recent) > maxShadowRecent {
+			t.recent = slices.Delete(t.recent, 0, len(t.recent)-maxShadowRecent)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+	meta := map[string]any{"changes": changes}
+	if shadowID != "" {
+		meta["mirror"] = shadowID
+	}
+	flows := []*Flow{primary}
+	if p.stored {
+		flows = append(flows, p.shadow)
+	}
+	for _, f := range flows {
+		f.mu.Lock()
+		f.Tags = append(slices.Clone(f.Tags), "shadow-mismatch")
+		if f == primary {
+			m := maps.Clone(f.Meta)
+			if m == nil {
+				m = make(map[string]any)
+			}
+			m["shadow"] = meta
+			f.Meta = m
+		}
+		f.mu.Unlock()
+		e.store.Update(f, FlowEventUpdate)
+	}
+}
+
+// anyIndex matches the array indexes of change paths.
+var anyIndex = regexp.MustCompile(`\[\d+\]`)
+
+// shadowChanges compares the responses of a primary flow and its copy.
+// Bodies only partly captured on either side aren't compared.
+func shadowChanges(a, b *Flow, c *ShadowCompare) []Change {
+	d := &FlowDiff{Changes: []Change{}}
+	ra, rb := a.Response, b.Response
+	if ra == nil || rb == nil {
+		d.changed("error", a.Error, b.Error)
+		if ra != nil || rb != nil {
+			d.Changes = append(d.Changes, presenceChange("response", ra != nil, rb != nil))
+		}
+		return d.Changes
+	}
+	d.changed("response.status", ra.StatusCode, rb.StatusCode)
+	for _, h := range c.Headers {
+		h = http.CanonicalHeaderKey(h)
+		d.changed("response.headers."+h, strings.Join(ra.Headers.Values(h), ", "), strings.Join(rb.Headers.Values(h), ", "))
+	}
+	if !ra.BodyTruncated && !rb.BodyTruncated {
+		d.diffBody("response.body", ra.ReadBody(), rb.ReadBody(), ra.Headers, rb.Headers)
+	}
+	return slices.DeleteFunc(d.Changes, func(ch Change) bool {
+		rel, ok := strings.CutPrefix(ch.Path, "response.body")
+		if !ok || rel == "" {
+			return false
+		}
+		rel = anyIndex.ReplaceAllString(strings.TrimPrefix(rel, "."), "[*]")
+		for _, ig := range c.Ignore {
+			if rel == ig || strings.HasPrefix(rel, ig+".") || strings.HasPrefix(rel, ig+"[") {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long Start waits for in-flight flows when
+// Options.ShutdownTimeout is unset.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// errShutdown is recorded on flows still in flight when the drain times out.
+const errShutdown = "proxy shut down before the flow finished"
+
+// drain shuts the proxy listener down gracefully: it stops accepting
+// connections, kills flows paused by intercept or a breakpoint (no UI is
+// left to release them), and waits up to ShutdownTimeout for the rest,
+// streaming and upgraded ones included, to finish. Flows still going when
+// time runs out have their connections closed and are finished as errors
+// tagged "shutdown", so subscribers see a final event for every flow. The
+// start and outcome are broadcast as FlowEventShutdown. The timeout is read
+// from the current config, so a reload can change it.
+func (e *Engine) drain() {
+	timeout := e.routing.Load().opts.ShutdownTimeout
+	if n := e.inflight.Load(); n > 0 {
+		e.store.Notify(FlowEvent{
+			Type:    FlowEventShutdown,
+			Message: fmt.Sprintf("shutting down: waiting up to %s for %d in-flight flows", timeout, n),
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, f := range e.store.All() {
+		if f.State == FlowStateIntercepted {
+			f.Kill()
+		}
+	}
+	// Shutdown waits for connections to go idle, but not for hijacked
+	// ones (WebSocket upgrades, CONNECT tunnels), which ServeHTTP counts.
+	// Intercepted tunnels run their own servers, shut down alongside.
+	err := e.server.Shutdown(ctx)
+	if err == nil {
+		err = e.tunnels.shutdown(ctx)
+	}
+	for err == nil && e.inflight.Load() > 0 {
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err == nil {
+		e.store.Notify(FlowEvent{Type: FlowEventShutdown, Message: "shut down: all flows finished"})
+		return
+	}
+
+	var abandoned []*Flow
+	for _, f := range e.store.All() {
+		if f.State == FlowStateActive || f.State == FlowStateIntercepted {
+			abandoned = append(abandoned, f)
+		}
+	}
+	// Closing the connections cancels the requests; give their handlers a
+	// moment to unwind before recording why they ended.
+	_ = e.server.Close()
+	e.tunnels.close()
+	for wait := time.Now().Add(time.Second); e.inflight.Load() > 0 && time.Now().Before(wait); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, f := range abandoned {
+		f.State = FlowStateError
+		f.Error = errShutdown
+		f.Tags = append(f.Tags, "shutdown")
+		if f.Timestamps.ResponseDone.IsZero() {
+			f.Timestamps.ResponseDone = time.Now()
+		}
+		e.store.Update(f, FlowEventError)
+	}
+	e.store.Notify(FlowEvent{
+		Type:    FlowEventShutdown,
+		Message: fmt.Sprintf("shut down after %s: %d flows did not finish", timeout, len(abandoned)),
+	})
+}
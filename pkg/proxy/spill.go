@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"os"
+	"runtime"
+)
+
+// With a SpillThreshold, the store moves bodies larger than it to files in
+// a temporary directory once their flow finishes, and CapturedRequest and
+// CapturedResponse ReadBody load them back on demand. A file is removed
+// when nothing references its body any more, and the directory when the
+// engine stops.
+
+// spilledBody is a captured body kept in a file.
+type spilledBody struct {
+	path string
+}
+
+// spillBody writes data to a new file in dir. The file is removed once the
+// returned spilledBody is garbage collected.
+func spillBody(dir string, data []byte) (*spilledBody, error) {
+	f, err := os.CreateTemp(dir, "body-*")
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	b := &spilledBody{path: f.Name()}
+	runtime.AddCleanup(b, func(path string) { os.Remove(path) }, b.path)
+	return b, nil
+}
+
+// read returns the body, or nil if its file is gone.
+func (b *spilledBody) read() []byte {
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// spill moves f's bodies larger than the threshold to disk. Bodies that
+// can't be written stay in memory.
+func (s *FlowStore) spill(f *Flow) {
+	if s.spillDir == "" {
+		return
+	}
+	if cr := f.Request; cr != nil && int64(len(cr.Body)) > s.spillThreshold {
+		if b, err := spillBody(s.spillDir, cr.Body); err == nil {
+			bodyMu.Lock()
+			cr.spilled, cr.Body = b, nil
+			bodyMu.Unlock()
+		}
+	}
+	if r := f.Response; r != nil && int64(len(r.Body)) > s.spillThreshold {
+		if b, err := spillBody(s.spillDir, r.Body); err == nil {
+			bodyMu.Lock()
+			r.spilled, r.Body = b, nil
+			bodyMu.Unlock()
+		}
+	}
+}
+
+// memBytes is how many bytes of f's bodies, compressed ones as compressed,
+// are held in memory by f alone; shared bodies are counted by the store's
+// body table.
+func memBytes(f *Flow) int64 {
+	var n int64
+	if cr := f.Request; cr != nil && cr.shared == nil {
+		n += int64(len(*heldBody(&cr.Body, cr.packed)))
+	}
+	if r := f.Response; r != nil && r.shared == nil {
+		n += int64(len(*heldBody(&r.Body, r.packed)))
+	}
+	return n
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StatsWindows are the sliding windows traffic statistics are reported over.
+var StatsWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// maxStatEndpoints caps the endpoints Stats reports, busiest first.
+const maxStatEndpoints = 50
+
+// maxStatSamples caps the samples kept per upstream, so a flood of traffic
+// can't grow memory without bound. Beyond it the oldest samples are dropped
+// early and the longer windows under-count.
+const maxStatSamples = 50000
+
+// WindowStats summarises the flows that finished within one window.
+// Latencies are in milliseconds; errors are failed flows and 5xx responses.
+type WindowStats struct {
+	Window    string  `json:"window"`
+	Requests  int     `json:"requests"`
+	Rate      float64 `json:"rate"` // requests per second
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"errorRate"` // fraction of requests, 0–1
+	P50       float64 `json:"p50"`
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+	BytesIn   int64   `json:"bytesIn"`  // request bodies
+	BytesOut  int64   `json:"bytesOut"` // response bodies
+
+	// SampledOut counts the requests proxied but not stored because of
+	// the sample rate.
+	SampledOut int `json:"sampledOut"`
+}
+
+// UpstreamStats holds one upstream's statistics, one entry per StatsWindows.
+type UpstreamStats struct {
+	Upstream string        `json:"upstream"`
+	Windows  []WindowStats `json:"windows"`
+}
+
+// EndpointStats holds one endpoint's statistics: an upstream's requests
+// with one method and normalized path (see Engine.NormalizePath).
+type EndpointStats struct {
+	Upstream string        `json:"upstream"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Windows  []WindowStats `json:"windows"`
+}
+
+// Stats is a snapshot of traffic statistics, overall, per upstream, and for
+// the busiest endpoints over the longest window.
+type Stats struct {
+	Time      time.Time       `json:"time"`
+	Global    []WindowStats   `json:"global"`
+	Upstreams []UpstreamStats `json:"upstreams"`
+	Endpoints []EndpointStats `json:"endpoints"`
+	Store     StoreStats      `json:"store"`
+}
+
+// StoreStats describes the flow store's memory use. Identical bodies are
+// held once: SharedBodies counts those copies, SharedRefs the flow bodies
+// pointing at them, and DedupSaved the bytes the extra references would
+// otherwise take. BodyBytes is what the bodies do take, shared ones once.
+type StoreStats struct {
+	Flows        int   `json:"flows"`
+	BodyBytes    int64 `json:"bodyBytes"`
+	SharedBodies int   `json:"sharedBodies"`
+	SharedRefs   int   `json:"sharedRefs"`
+	DedupSaved   int64 `json:"dedupSavedBytes"`
+}
+
+type statSample struct {
+	at           time.Time
+	latency      time.Duration
+	in, out      int64
+	hasError     bool
+	sampledOut   bool
+	method, path string // path normalized
+}
+
+// statsCollector is an addon, registered by New, that records every
+// finished flow.
+type statsCollector struct {
+	mu      sync.Mutex
+	started time.Time
+	samples map[string][]statSample // by upstream, oldest first
+	now     func() time.Time
+
+	// normalize maps request paths to endpoints; set by New.
+	normalize func(path string) string
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		started: time.Now(),
+		samples: make(map[string][]statSample),
+		now:     time.Now,
+
+		normalize: PathTemplate,
+	}
+}
+
+func (c *statsCollector) Name() string { return "stats" }
+
+func (c *statsCollector) OnComplete(flow *Flow) { c.record(flow) }
+
+func (c *statsCollector) OnError(flow *Flow, _ error) { c.record(flow) }
+
+func (c *statsCollector) record(flow *Flow) {
+	s := statSample{
+		at:         c.now(),
+		latency:    flow.Duration(),
+		hasError:   flow.State == FlowStateError || flow.State == FlowStateRejected,
+		sampledOut: flow.sampledOut,
+	}
+	if flow.Request != nil {
+		s.in = flow.Request.WireSize()
+		s.method, s.path = flow.Request.Method, c.normalize(flow.Request.Path)
+	}
+	if flow.Response != nil {
+		s.out = flow.Response.WireSize()
+		s.hasError = s.hasError || flow.Response.StatusCode >= 500
+	}
+	name := flow.Upstream
+	if name == "" {
+		name = "-"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	samples := c.expire(append(c.samples[name], s), s.at)
+	if len(samples) > maxStatSamples {
+		samples = slices.Delete(samples, 0, len(samples)-maxStatSamples)
+	}
+	c.samples[name] = samples
+}
+
+// expire drops samples older than the longest window.
+func (c *statsCollector) expire(samples []statSample, now time.Time) []statSample {
+	cutoff := now.Add(-StatsWindows[len(StatsWindows)-1])
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].at.After(cutoff) })
+	return slices.Delete(samples, 0, i)
+}
+
+func (c *statsCollector) snapshot() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	st := Stats{Time: now, Upstreams: []UpstreamStats{}, Endpoints: []EndpointStats{}}
+	var all []statSample
+	for name, samples := range c.samples {
+		samples = c.expire(samples, now)
+		c.samples[name] = samples
+		if len(samples) == 0 {
+			delete(c.samples, name)
+			continue
+		}
+		all = append(all, samples...)
+		st.Upstreams = append(st.Upstreams, UpstreamStats{Upstream: name, Windows: c.windows(samples, now)})
+		st.Endpoints = append(st.Endpoints, c.endpoints(name, samples, now)...)
+	}
+	slices.SortFunc(all, func(a, b statSample) int { return a.at.Compare(b.at) })
+	st.Global = c.windows(all, now)
+	slices.SortFunc(st.Upstreams, func(a, b UpstreamStats) int { return cmp.Compare(a.Upstream, b.Upstream) })
+	last := len(StatsWindows) - 1
+	slices.SortFunc(st.Endpoints, func(a, b EndpointStats) int {
+		return cmp.Or(cmp.Compare(b.Windows[last].Requests, a.Windows[last].Requests),
+			cmp.Compare(a.Upstream, b.Upstream), cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+	if len(st.Endpoints) > maxStatEndpoints {
+		st.Endpoints = st.Endpoints[:maxStatEndpoints]
+	}
+	return st
+}
+
+// endpoints splits an upstream's samples (oldest first) by endpoint.
+func (c *statsCollector) endpoints(upstream string, samples []statSample, now time.Time) []EndpointStats {
+	type endpoint struct{ method, path string }
+	byEndpoint := make(map[endpoint][]statSample)
+	for _, s := range samples {
+		if s.method != "" {
+			k := endpoint{s.method, s.path}
+			byEndpoint[k] = append(byEndpoint[k], s)
+		}
+	}
+	out := make([]EndpointStats, 0, len(byEndpoint))
+	for k, samples := range byEndpoint {
+		out = append(out, EndpointStats{Upstream: upstream, Method: k.method, Path: k.path, Windows: c.windows(samples, now)})
+	}
+	return out
+}
+
+// windows computes WindowStats over samples (oldest first) for each window.
+func (c *statsCollector) windows(samples []statSample, now time.Time) []WindowStats {
+	out := make([]WindowStats, len(StatsWindows))
+	for i, w := range StatsWindows {
+		cutoff := now.Add(-w)
+		first := sort.Search(len(samples), func(i int) bool { return samples[i].at.After(cutoff) })
+		out[i] = summarize(samples[first:], min(w, now.Sub(c.started)))
+		out[i].Window = formatWindow(w)
+	}
+	return out
+}
+
+func summarize(samples []statSample, span time.Duration) WindowStats {
+	var ws WindowStats
+	if len(samples) == 0 {
+		return ws
+	}
+	latencies := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		latencies[i] = s.latency
+		ws.BytesIn += s.in
+		ws.BytesOut += s.out
+		if s.hasError {
+			ws.Errors++
+		}
+		if s.sampledOut {
+			ws.SampledOut++
+		}
+	}
+	slices.Sort(latencies)
+	ws.Requests = len(samples)
+	ws.ErrorRate = float64(ws.Errors) / float64(ws.Requests)
+	if span > 0 {
+		ws.Rate = float64(ws.Requests) / span.Seconds()
+	}
+	ws.P50 = percentile(latencies, 0.50)
+	ws.P95 = percentile(latencies, 0.95)
+	ws.P99 = percentile(latencies, 0.99)
+	return ws
+}
+
+// percentile returns the nearest-rank percentile of sorted, in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return millis(sorted[max(i, 0)])
+}
+
+func formatWindow(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	return d.String()
+}
+
+// Stats returns latency, rate, error, and byte statistics over the
+// StatsWindows, for all traffic, per upstream, and per endpoint, along with
+// the flow store's memory use.
+func (e *Engine) Stats() Stats {
+	st := e.stats.snapshot()
+	st.Store = e.store.Stats()
+	return st
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks a forwarded flow's duration into phases, in milliseconds,
+// measured with net/http/httptrace on the upstream connection. Phases that
+// didn't happen, such as DNS and connect on a reused connection, are zero.
+type Timings struct {
+	Proxy   float64 `json:"proxy"`   // before forwarding: request capture, hooks, intercept
+	Blocked float64 `json:"blocked"` // waiting for a free connection
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"` // TCP connect
+	TLS     float64 `json:"tls"`
+	Send    float64 `json:"send"`    // writing the request, including a streamed body
+	Wait    float64 `json:"wait"`    // time to first response byte once sent
+	Receive float64 `json:"receive"` // response body transfer
+
+	Reused     bool   `json:"reused,omitempty"` // the connection was kept alive from an earlier request
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+}
+
+// connTrace records httptrace events for one forwarded request. Callbacks
+// may run on transport goroutines, hence the lock.
+type connTrace struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	getConn, gotConn       time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	tlsStart, tlsDone      time.Time
+	wroteRequest           time.Time
+	firstByte              time.Time
+	reused                 bool
+	remoteAddr             string
+}
+
+// withTrace attaches a connTrace for flow to ctx.
+func withTrace(ctx context.Context, flow *Flow) context.Context {
+	t := &connTrace{start: time.Now()}
+	flow.trace = t
+	stamp := func(at *time.Time) {
+		t.mu.Lock()
+		*at = time.Now()
+		t.mu.Unlock()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) { stamp(&t.getConn) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+			t.mu.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { stamp(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { stamp(&t.dnsDone) },
+		ConnectStart:         func(string, string) { stamp(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { stamp(&t.connDone) },
+		TLSHandshakeStart:    func() { stamp(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { stamp(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { stamp(&t.wroteRequest) },
+		GotFirstResponseByte: func() { stamp(&t.firstByte) },
+	})
+}
+
+// timings derives the phase breakdown. done is when the flow finished.
+func (t *connTrace) timings(created, done time.Time) *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dns := span(t.dnsStart, t.dnsDone)
+	connect := span(t.connectStart, t.connDone)
+	tlsTime := span(t.tlsStart, t.tlsDone)
+	blocked := max(0, span(t.getConn, t.gotConn)-dns-connect-tlsTime)
+	return &Timings{
+		Proxy:      millis(span(created, t.start)),
+		Blocked:    millis(blocked),
+		DNS:        millis(dns),
+		Connect:    millis(connect),
+		TLS:        millis(tlsTime),
+		Send:       millis(span(t.gotConn, t.wroteRequest)),
+		Wait:       millis(span(t.wroteRequest, t.firstByte)),
+		Receive:    millis(span(t.firstByte, done)),
+		Reused:     t.reused,
+		RemoteAddr: t.remoteAddr,
+	}
+}
+
+// span returns b-a, or 0 unless both are set and ordered.
+func span(a, b time.Time) time.Duration {
+	if a.IsZero() || b.IsZero() || b.Before(a) {
+		return 0
+	}
+	return b.Sub(a)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// recordTimings fills in flow.Timings once a forwarded flow has finished.
+func recordTimings(flow *Flow) {
+	if flow.trace != nil {
+		flow.Timings = flow.trace.timings(flow.Timestamps.Created, flow.Timestamps.ResponseDone)
+	}
+}
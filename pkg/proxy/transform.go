@@ -0,0 +1,530 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ResponseTransform rewrites the bodies of upstream responses, to simulate a
+// backend change (a renamed field, a new flag) without touching the backend.
+// JSON patches run first, on JSON responses only, then the replacements run
+// on the resulting text. Transformed flows are tagged "transformed"; if a
+// transform fails, the response is passed on unchanged and the flow is
+// tagged "transform-failed".
+//
+// Filter is the filter expression as written; Match is its parsed form,
+// which the caller fills in with the filter package. A nil Match applies the
+// transform to every response. Filters see the response status and headers
+// but not its body, so ~b only matches on the request body.
+type ResponseTransform struct {
+	Filter string
+	Match  Matcher
+
+	Replace   []BodyReplace
+	JSONPatch []JSONPatchOp
+}
+
+// BodyReplace replaces every match of the regular expression Find with
+// With, in which $1 or ${name} stand for submatches.
+type BodyReplace struct {
+	Find string
+	With string
+
+	re *regexp.Regexp
+}
+
+// JSONPatchOp is one RFC 6902 operation: add, remove, replace, move, copy,
+// or test. Path and From are JSON pointers (RFC 6901), e.g. "/items/0/id";
+// "-" as the last token of an add's path appends to an array. A failed test
+// leaves the body unchanged.
+type JSONPatchOp struct {
+	Op    string
+	Path  string
+	From  string // move and copy
+	Value any    // add, replace, and test
+
+	value json.RawMessage // Value as JSON, decoded afresh for each response
+}
+
+// maxTransformBody is the largest response body transforms are applied to;
+// larger ones are passed on unchanged.
+const maxTransformBody = 32 << 20
+
+// validateTransforms compiles the regular expressions and checks the patch
+// operations of ts, returning copies ready to apply.
+func validateTransforms(ts []ResponseTransform) ([]ResponseTransform, error) {
+	out := make([]ResponseTransform, len(ts))
+	for i, t := range ts {
+		t.Replace = slices.Clone(t.Replace)
+		for j := range t.Replace {
+			r := &t.Replace[j]
+			re, err := regexp.Compile(r.Find)
+			if err != nil {
+				return nil, fmt.Errorf("transform %d: invalid find pattern: %w", i+1, err)
+			}
+			r.re = re
+		}
+		t.JSONPatch = slices.Clone(t.JSONPatch)
+		for j := range t.JSONPatch {
+			op := &t.JSONPatch[j]
+			if err := op.validate(); err != nil {
+				return nil, fmt.Errorf("transform %d: json_patch %d: %w", i+1, j+1, err)
+			}
+		}
+		out[i] = t
+	}
+	return out, nil
+}
+
+func (op *JSONPatchOp) validate() error {
+	switch op.Op {
+	case "add", "remove", "replace", "move", "copy", "test":
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	if _, err := parsePointer(op.Path); err != nil {
+		return fmt.Errorf("path: %w", err)
+	}
+	if op.Op == "move" || op.Op == "copy" {
+		if _, err := parsePointer(op.From); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	}
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		data, err := json.Marshal(op.Value)
+		if err != nil {
+			return fmt.Errorf("value: %w", err)
+		}
+		op.value = data
+	}
+	return nil
+}
+
+// transformResponse applies the transforms matching flow to resp's body.
+// It is called before the response is captured, so the flow records the
+// body the client receives.
+func (e *Engine) transformResponse(flow *Flow, resp *http.Response) {
+	transforms := e.routing.Load().transforms
+	if len(transforms) == 0 || resp.Body == nil || resp.Body == http.NoBody ||
+		resp.StatusCode == http.StatusSwitchingProtocols ||
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	// Let filters on the status and headers match; captureResponse replaces
+	// this with the full response.
+	flow.Response = &CapturedResponse{StatusCode: resp.StatusCode, Headers: resp.Header, Proto: resp.Proto}
+	var matched []*ResponseTransform
+	for i := range transforms {
+		if t := &transforms[i]; t.Match == nil || t.Match(flow) {
+			matched = append(matched, t)
+		}
+	}
+	flow.Response = nil
+	if len(matched) == 0 {
+		return
+	}
+
+	body, err := readTransformBody(resp)
+	if err == nil {
+		isJSON := isJSONType(resp.Header)
+		for _, t := range matched {
+			if body, err = t.apply(body, isJSON); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		flow.Tags = append(flow.Tags, "transform-failed")
+		flow.Error = "transform: " + err.Error()
+		return
+	}
+	setResponseBody(resp, body)
+	flow.Tags = append(flow.Tags, "transformed")
+}
+
+// rewriteResponse passes resp's body through the ResponseRewriter addons
+// that take it. Like transformResponse, it runs before the response is
+// captured.
+func (e *Engine) rewriteResponse(flow *Flow, resp *http.Response) {
+	if resp.Body == nil || resp.Body == http.NoBody || resp.StatusCode == http.StatusSwitchingProtocols ||
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	// Rewriters see the status and headers, as for transforms, until
+	// captureResponse replaces them with the full response.
+	flow.Response = &CapturedResponse{StatusCode: resp.StatusCode, Headers: resp.Header, Proto: resp.Proto}
+	defer func() { flow.Response = nil }()
+	rewriters := e.addons.rewriters(flow)
+	if len(rewriters) == 0 {
+		return
+	}
+	body, err := readTransformBody(resp)
+	if err != nil {
+		return
+	}
+	for _, r := range rewriters {
+		body = r.Rewrite(flow, body)
+	}
+	setResponseBody(resp, body)
+}
+
+// setResponseBody replaces resp's body with body, sent uncompressed. The
+// upstream's ETag is dropped, as it no longer matches.
+func setResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("ETag")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// readTransformBody reads resp's body, decompressing gzip. On failure resp's
+// body is left readable from the start, so the response can be passed on
+// unchanged.
+func readTransformBody(resp *http.Response) ([]byte, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxTransformBody+1))
+	rest := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(raw), rest), rest}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxTransformBody {
+		return nil, fmt.Errorf("body larger than %d bytes", maxTransformBody)
+	}
+	rest.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	if encoding != "gzip" {
+		return raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	body, err := io.ReadAll(io.LimitReader(zr, maxTransformBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if len(body) > maxTransformBody {
+		return nil, fmt.Errorf("body larger than %d bytes", maxTransformBody)
+	}
+	return body, nil
+}
+
+// apply runs t's JSON patch, if the body is JSON, and then its replacements.
+func (t *ResponseTransform) apply(body []byte, isJSON bool) ([]byte, error) {
+	if len(t.JSONPatch) > 0 && isJSON {
+		patched, err := applyJSONPatch(body, t.JSONPatch)
+		if err != nil {
+			return nil, fmt.Errorf("json_patch: %w", err)
+		}
+		body = patched
+	}
+	for _, r := range t.Replace {
+		body = r.re.ReplaceAll(body, []byte(r.With))
+	}
+	return body, nil
+}
+
+// applyJSONPatch applies ops to the JSON document data. Object keys of the
+// result are sorted.
+func applyJSONPatch(data []byte, ops []JSONPatchOp) ([]byte, error) {
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("body is not JSON: %w", err)
+	}
+	for i, op := range ops {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("op %d (%s %s): %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// apply applies op to doc and returns the new document.
+func (op JSONPatchOp) apply(doc any) (any, error) {
+	path, _ := parsePointer(op.Path)
+	var value any
+	if op.value != nil {
+		value, _ = decodeJSON(op.value)
+	}
+	switch op.Op {
+	case "add":
+		return patchAdd(doc, path, value)
+	case "remove":
+		doc, _, err := patchRemove(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		return patchAt(doc, path, func(c any, key string) (any, error) {
+			switch c := c.(type) {
+			case map[string]any:
+				c[key] = value
+				return c, nil
+			case []any:
+				i, err := arrayIndex(key, len(c)-1)
+				if err != nil {
+					return nil, err
+				}
+				c[i] = value
+				return c, nil
+			}
+			return nil, errNotContainer
+		})
+	case "move", "copy":
+		from, _ := parsePointer(op.From)
+		if op.Op == "move" && len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		var v any
+		var err error
+		if op.Op == "move" {
+			doc, v, err = patchRemove(doc, from)
+		} else {
+			v, err = pointerGet(doc, from)
+			if err == nil {
+				v, err = deepCopyJSON(v)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		return patchAdd(doc, path, v)
+	case "test":
+		v, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, value) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+var errNotContainer = errors.New("parent is not an object or array")
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens.
+// The empty pointer refers to the whole document.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token, which must be at most max.
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// pointerGet returns the value at path in doc.
+func pointerGet(doc any, path []string) (any, error) {
+	for _, key := range path {
+		switch c := doc.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", key)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(key, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("cannot index %q into a scalar", key)
+		}
+	}
+	return doc, nil
+}
+
+// patchAt calls fn with the container holding the last token of path and
+// that token, storing the container fn returns (arrays may be reallocated)
+// back into its parent. path must not be empty.
+func patchAt(doc any, path []string, fn func(container any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	key := path[0]
+	switch c := doc.(type) {
+	case map[string]any:
+		child, ok := c[key]
+		if !ok {
+			return nil, fmt.Errorf("no member %q", key)
+		}
+		v, err := patchAt(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[key] = v
+		return c, nil
+	case []any:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := patchAt(c[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("cannot index %q into a scalar", key)
+}
+
+// patchAdd adds value at path: it sets an object member, or inserts into an
+// array ("-" appends).
+func patchAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return patchAt(doc, path, func(c any, key string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			c[key] = value
+			return c, nil
+		case []any:
+			if key == "-" {
+				return append(c, value), nil
+			}
+			i, err := arrayIndex(key, len(c))
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(c, i, value), nil
+		}
+		return nil, errNotContainer
+	})
+}
+
+// patchRemove removes the value at path and returns the new document and the
+// removed value.
+func patchRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed any
+	doc, err := patchAt(doc, path, func(c any, key string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", key)
+			}
+			removed = v
+			delete(c, key)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(key, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return slices.Delete(c, i, i+1), nil
+		}
+		return nil, errNotContainer
+	})
+	return doc, removed, err
+}
+
+// deepCopyJSON copies a decoded JSON value, so a copied value can be changed
+// by later operations without affecting the original.
+func deepCopyJSON(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(data)
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers by value.
+func jsonEqual(a, b any) bool {
+	da, err1 := json.Marshal(a)
+	db, err2 := json.Marshal(b)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	var va, vb any
+	if json.Unmarshal(da, &va) != nil || json.Unmarshal(db, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// IsInjectableHTML reports whether flow's response is an HTML page with a
+// body that snippets can be added to: a text/html response to a request
+// other than HEAD, and not 1xx, 204, or 304. ResponseRewriter addons that
+// insert into pages, like live reload, check it in Rewrites.
+func IsInjectableHTML(flow *Flow) bool {
+	resp := flow.Response
+	if flow.Request == nil || flow.Request.Method == http.MethodHead || resp == nil ||
+		resp.StatusCode < 200 || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+	return mediaType == "text/html"
+}
+
+// InjectHTML inserts snippet into an HTML document before its last </body>
+// tag, in any case, or appends it if there is none.
+func InjectHTML(doc []byte, snippet string) []byte {
+	const tag = "</body"
+	i := len(doc)
+	for j := len(doc) - len(tag); j >= 0; j-- {
+		if bytes.EqualFold(doc[j:j+len(tag)], []byte(tag)) {
+			i = j
+			break
+		}
+	}
+	out := make([]byte, 0, len(doc)+len(snippet))
+	out = append(out, doc[:i]...)
+	out = append(out, snippet...)
+	return append(out, doc[i:]...)
+}
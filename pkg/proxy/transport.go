@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// UpstreamTLS configures the TLS client used for an upstream's https://
+// targets, e.g. local services with self-signed or internal-CA certificates.
+type UpstreamTLS struct {
+	// InsecureSkipVerify accepts any server certificate.
+	InsecureSkipVerify bool
+
+	// CAFile is a PEM bundle of CAs trusted in addition to the system roots.
+	CAFile string
+
+	// ClientCert and ClientKey are a PEM certificate and key presented to
+	// upstreams that require mutual TLS.
+	ClientCert string
+	ClientKey  string
+
+	// ServerName overrides the name sent in SNI and checked against the
+	// server certificate (default: the target's host).
+	ServerName string
+}
+
+// UpstreamTransport tunes an upstream's timeouts and connection pool. Zero
+// fields keep http.DefaultTransport's settings.
+type UpstreamTransport struct {
+	// DialTimeout limits establishing the TCP connection (default 30s).
+	DialTimeout time.Duration
+
+	// KeepAlive is the TCP keep-alive probe interval (default 30s); negative
+	// disables probes.
+	KeepAlive time.Duration
+
+	// TLSHandshakeTimeout limits the TLS handshake (default 10s).
+	TLSHandshakeTimeout time.Duration
+
+	// ResponseHeaderTimeout limits the wait for response headers once the
+	// request is written (default: no limit).
+	ResponseHeaderTimeout time.Duration
+
+	// IdleConnTimeout closes pooled connections idle this long (default 90s).
+	IdleConnTimeout time.Duration
+
+	// MaxIdleConns caps pooled idle connections in total (default 100);
+	// MaxIdleConnsPerHost caps them per target host (default 2).
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost caps connections per target host, including active
+	// ones (default: no limit).
+	MaxConnsPerHost int
+
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+}
+
+// prepareTransport builds the upstream's dedicated transport when it needs
+// one; otherwise requests use http.DefaultTransport.
+func (u *Upstream) prepareTransport() error {
+	if u.TLS == nil && u.Transport == nil && !u.H2C {
+		return nil
+	}
+	var t *http.Transport
+	if u.H2C {
+		t = h2cTransport()
+	} else {
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if u.TLS != nil {
+		cfg, err := u.TLS.config()
+		if err != nil {
+			return fmt.Errorf("upstream %q: %w", u.Name, err)
+		}
+		t.TLSClientConfig = cfg
+	}
+	if u.Transport != nil {
+		if err := u.Transport.apply(t); err != nil {
+			return fmt.Errorf("upstream %q: %w", u.Name, err)
+		}
+	}
+	u.transport = t
+	return nil
+}
+
+func (o *UpstreamTransport) apply(t *http.Transport) error {
+	if o.MaxIdleConns < 0 || o.MaxIdleConnsPerHost < 0 || o.MaxConnsPerHost < 0 {
+		return fmt.Errorf("connection limits can't be negative")
+	}
+	if o.DialTimeout < 0 || o.TLSHandshakeTimeout < 0 || o.ResponseHeaderTimeout < 0 || o.IdleConnTimeout < 0 {
+		return fmt.Errorf("timeouts can't be negative")
+	}
+	if o.DialTimeout != 0 || o.KeepAlive != 0 {
+		d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if o.DialTimeout != 0 {
+			d.Timeout = o.DialTimeout
+		}
+		if o.KeepAlive != 0 {
+			d.KeepAlive = o.KeepAlive
+		}
+		t.DialContext = d.DialContext
+	}
+	if o.TLSHandshakeTimeout != 0 {
+		t.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+	}
+	if o.ResponseHeaderTimeout != 0 {
+		t.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	}
+	if o.IdleConnTimeout != 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.MaxIdleConns != 0 {
+		t.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost != 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.MaxConnsPerHost != 0 {
+		t.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	t.DisableKeepAlives = o.DisableKeepAlives
+	return nil
+}
+
+func (c *UpstreamTLS) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s: no PEM certificates found", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		pair, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
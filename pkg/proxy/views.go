@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// View is a named filter expression, selectable from the TUI and web UI.
+type View struct {
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+
+	// Saved marks views saved at runtime, which are kept in the state file
+	// and can be deleted. Views from the config file are read-only.
+	Saved bool `json:"saved,omitempty"`
+}
+
+// DefaultStateFile returns the default location of the state file, in the
+// user's config directory.
+func DefaultStateFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "http-proxy", "state.json")
+}
+
+// MaxFilterHistory is the number of filter expressions kept per project.
+const MaxFilterHistory = 50
+
+// state is the JSON layout of Options.StateFile.
+type state struct {
+	Views []View `json:"views,omitempty"`
+
+	// FilterHistory holds recent filter expressions, oldest first, keyed by
+	// the directory the proxy ran in so each project has its own.
+	FilterHistory map[string][]string `json:"filterHistory,omitempty"`
+}
+
+// viewTable holds the views saved at runtime and the filter history.
+type viewTable struct {
+	mu      sync.Mutex
+	loaded  bool
+	saved   []View
+	project string              // key of this run's filter history
+	history map[string][]string // all projects' filter history
+}
+
+// Views returns the views from the config followed by those saved at
+// runtime. A saved view shadows a config view of the same name.
+func (e *Engine) Views() []View {
+	saved := e.savedViews()
+	var views []View
+	for _, v := range e.Options().Views {
+		if !slices.ContainsFunc(saved, func(s View) bool { return s.Name == v.Name }) {
+			views = append(views, v)
+		}
+	}
+	return append(views, saved...)
+}
+
+// SaveView saves a view under name, replacing any saved view with that name,
+// and writes the state file. The filter is not validated here; callers parse
+// it first.
+func (e *Engine) SaveView(name, filter string) (View, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return View{}, errors.New("view name is required")
+	}
+	v := View{Name: name, Filter: filter, Saved: true}
+
+	e.views.mu.Lock()
+	defer e.views.mu.Unlock()
+	e.loadViews()
+	if i := slices.IndexFunc(e.views.saved, func(s View) bool { return s.Name == name }); i >= 0 {
+		e.views.saved[i] = v
+	} else {
+		e.views.saved = append(e.views.saved, v)
+	}
+	return v, e.writeState()
+}
+
+// DeleteView removes a saved view. Views from the config can't be deleted.
+func (e *Engine) DeleteView(name string) error {
+	e.views.mu.Lock()
+	defer e.views.mu.Unlock()
+	e.loadViews()
+	i := slices.IndexFunc(e.views.saved, func(s View) bool { return s.Name == name })
+	if i < 0 {
+		if slices.ContainsFunc(e.Options().Views, func(v View) bool { return v.Name == name }) {
+			return fmt.Errorf("view %q is defined in the config file", name)
+		}
+		return fmt.Errorf("view %q not found", name)
+	}
+	e.views.saved = slices.Delete(e.views.saved, i, i+1)
+	return e.writeState()
+}
+
+// FilterHistory returns this project's recent filter expressions, oldest
+// first.
+func (e *Engine) FilterHistory() []string {
+	e.views.mu.Lock()
+	defer e.views.mu.Unlock()
+	e.loadViews()
+	return slices.Clone(e.views.history[e.views.project])
+}
+
+// AddFilterHistory records expr as the most recent filter expression,
+// dropping an earlier copy of it and the oldest entries beyond
+// MaxFilterHistory, and writes the state file.
+func (e *Engine) AddFilterHistory(expr string) error {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil
+	}
+	e.views.mu.Lock()
+	defer e.views.mu.Unlock()
+	e.loadViews()
+	h := slices.DeleteFunc(e.views.history[e.views.project], func(s string) bool { return s == expr })
+	h = append(h, expr)
+	if len(h) > MaxFilterHistory {
+		h = h[len(h)-MaxFilterHistory:]
+	}
+	e.views.history[e.views.project] = h
+	return e.writeState()
+}
+
+func (e *Engine) savedViews() []View {
+	e.views.mu.Lock()
+	defer e.views.mu.Unlock()
+	e.loadViews()
+	return slices.Clone(e.views.saved)
+}
+
+// loadViews reads saved views and filter history from the state file on
+// first use. A missing or unreadable file leaves the table empty. Caller
+// holds e.views.mu.
+func (e *Engine) loadViews() {
+	if e.views.loaded {
+		return
+	}
+	e.views.loaded = true
+	e.views.history = map[string][]string{}
+	e.views.project, _ = os.Getwd()
+	path := e.opts.StateFile
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var st state
+	if json.Unmarshal(data, &st) != nil {
+		return
+	}
+	for _, v := range st.Views {
+		v.Saved = true
+		e.views.saved = append(e.views.saved, v)
+	}
+	if st.FilterHistory != nil {
+		e.views.history = st.FilterHistory
+	}
+}
+
+// writeState persists saved views and filter history. Without a state file
+// they live only for the session. Caller holds e.views.mu.
+func (e *Engine) writeState() error {
+	path := e.opts.StateFile
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(state{Views: e.views.saved, FilterHistory: e.views.history}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,437 @@
+// Package qr encodes short text, such as a URL, as a QR code and draws it
+// with block characters for a terminal.
+//
+// Only what pointing a phone at the proxy needs is implemented: byte mode,
+// error correction level M, and versions 1 to 10 (up to 213 bytes).
+package qr
+
+import (
+	"errors"
+	"strings"
+)
+
+// Code is an encoded QR code: a square of dark and light modules.
+type Code struct {
+	Size    int
+	modules [][]bool // [y][x], true for dark
+	fn      [][]bool // function patterns, which masks leave alone
+}
+
+// block layout of error correction level M per version: EC codewords per
+// block, then count and data codewords of each of the two block groups.
+type blockLayout struct {
+	ec             int
+	blocks1, data1 int
+	blocks2, data2 int
+}
+
+var layoutsM = [...]blockLayout{
+	1:  {10, 1, 16, 0, 0},
+	2:  {16, 1, 28, 0, 0},
+	3:  {26, 1, 44, 0, 0},
+	4:  {18, 2, 32, 0, 0},
+	5:  {24, 2, 43, 0, 0},
+	6:  {16, 4, 27, 0, 0},
+	7:  {18, 4, 31, 0, 0},
+	8:  {22, 2, 38, 2, 39},
+	9:  {22, 3, 36, 2, 37},
+	10: {26, 4, 43, 1, 44},
+}
+
+// alignment lists the alignment pattern centre coordinates per version.
+var alignment = [...][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+const maxVersion = 10
+
+// ErrTooLong is returned by Encode for text that doesn't fit version 10.
+var ErrTooLong = errors.New("qr: text too long")
+
+func (l blockLayout) dataCodewords() int { return l.blocks1*l.data1 + l.blocks2*l.data2 }
+
+// Encode encodes text in the smallest version that holds it, with the mask
+// that scores best.
+func Encode(text string) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(text) <= 8*layoutsM[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version)
+	c.drawData(interleave(layoutsM[version], dataCodewords(text, version)))
+
+	best, bestScore := 0, -1
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if score := c.penalty(); bestScore < 0 || score < bestScore {
+			best, bestScore = mask, score
+		}
+		c.applyMask(mask) // XOR again to undo
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+	return c, nil
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool { return c.modules[y][x] }
+
+// String draws the code two rows of modules per line with half-block
+// characters, including a two-module quiet zone. Light modules are drawn as
+// blocks, so it reads correctly as light on a dark background; render it in a
+// light foreground on a dark background to be safe.
+func (c *Code) String() string {
+	const quiet = 2
+	light := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x < 0 || y < 0 || x >= c.Size || y >= c.Size || !c.modules[y][x]
+	}
+	var b strings.Builder
+	size := c.Size + 2*quiet
+	for y := 0; y < size; y += 2 {
+		for x := range size {
+			top, bottom := light(x, y), y+1 < size && light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// dataCodewords encodes text in byte mode and pads it to the version's
+// capacity.
+func dataCodewords(text string, version int) []byte {
+	var bits bitBuffer
+	bits.append(0b0100, 4) // byte mode
+	if version >= 10 {
+		bits.append(len(text), 16)
+	} else {
+		bits.append(len(text), 8)
+	}
+	for i := range len(text) {
+		bits.append(int(text[i]), 8)
+	}
+	capacity := 8 * layoutsM[version].dataCodewords()
+	bits.append(0, min(4, capacity-len(bits))) // terminator
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	out := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 == 1)
+	}
+}
+
+// interleave splits data into the version's blocks, adds each block's error
+// correction, and interleaves the blocks' codewords.
+func interleave(l blockLayout, data []byte) []byte {
+	var blocks, ecs [][]byte
+	div := rsDivisor(l.ec)
+	for i := range l.blocks1 + l.blocks2 {
+		n := l.data1
+		if i >= l.blocks1 {
+			n = l.data2
+		}
+		blocks = append(blocks, data[:n])
+		ecs = append(ecs, rsRemainder(data[:n], div))
+		data = data[n:]
+	}
+	var out []byte
+	for i := range max(l.data1, l.data2) {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := range l.ec {
+		for _, e := range ecs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// gfMul multiplies in GF(2^8) modulo the QR polynomial x^8+x^4+x^3+x^2+1.
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		hi := z & 0x80
+		z <<= 1
+		if hi != 0 {
+			z ^= 0x1D
+		}
+		if y>>i&1 == 1 {
+			z ^= x
+		}
+	}
+	return z
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given
+// degree, highest coefficient (always 1) omitted.
+func rsDivisor(degree int) []byte {
+	out := make([]byte, degree)
+	out[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range degree {
+			out[j] = gfMul(out[j], root)
+			if j+1 < degree {
+				out[j] ^= out[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return out
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, divisor []byte) []byte {
+	out := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ out[0]
+		copy(out, out[1:])
+		out[len(out)-1] = 0
+		for i, d := range divisor {
+			out[i] ^= gfMul(d, factor)
+		}
+	}
+	return out
+}
+
+// newCode returns a code of the given version with its function patterns
+// drawn and the format and version areas reserved.
+func newCode(version int) *Code {
+	size := 4*version + 17
+	c := &Code{Size: size, modules: make([][]bool, size), fn: make([][]bool, size)}
+	for y := range size {
+		c.modules[y] = make([]bool, size)
+		c.fn[y] = make([]bool, size)
+	}
+
+	for i := range size {
+		c.set(6, i, i%2 == 0) // timing patterns
+		c.set(i, 6, i%2 == 0)
+	}
+	for _, p := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := p[0]+dx, p[1]+dy
+				if x >= 0 && y >= 0 && x < size && y < size {
+					d := max(abs(dx), abs(dy))
+					c.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	pos := alignment[version]
+	for i, ax := range pos {
+		for j, ay := range pos {
+			last := len(pos) - 1
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue // overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.set(ax+dx, ay+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	c.drawFormat(0) // reserves the area; redrawn once the mask is chosen
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = rem<<1 ^ rem>>11*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := range 18 {
+			a, b := size-11+i%3, i/3
+			c.set(a, b, bits>>i&1 == 1)
+			c.set(b, a, bits>>i&1 == 1)
+		}
+	}
+	return c
+}
+
+// set draws a function module.
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.fn[y][x] = true
+}
+
+// drawFormat draws both copies of the format information: level M and mask.
+func (c *Code) drawFormat(mask int) {
+	data := 0b00<<3 | mask // 00 is level M
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ rem>>9*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := range 6 {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // the dark module
+}
+
+// drawData places the codewords in the zigzag order, two columns at a time
+// from the bottom right, skipping function modules.
+func (c *Code) drawData(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := range c.Size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert // upward
+				}
+				if !c.fn[y][x] && i < len(data)*8 {
+					c.modules[y][x] = data[i/8]>>(7-i%8)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with mask pattern m.
+func (c *Code) applyMask(m int) {
+	for y := range c.Size {
+		for x := range c.Size {
+			var flip bool
+			switch m {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !c.fn[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the code by the standard's four rules; lower is better.
+func (c *Code) penalty() int {
+	score := 0
+	line := func(get func(i int) bool) {
+		run := 1
+		for i := 1; i <= c.Size; i++ {
+			if i < c.Size && get(i) == get(i-1) {
+				run++
+				continue
+			}
+			if run >= 5 {
+				score += 3 + run - 5
+			}
+			run = 1
+		}
+		// Finder-like 1:1:3:1:1 runs with four light modules on a side.
+		for i := 0; i+11 <= c.Size; i++ {
+			var s [11]bool
+			for k := range s {
+				s[k] = get(i + k)
+			}
+			core := s[4] && !s[5] && s[6] && s[7] && s[8] && !s[9] && s[10]
+			if core && !s[0] && !s[1] && !s[2] && !s[3] {
+				score += 40
+			}
+			rev := s[0] && !s[1] && s[2] && s[3] && s[4] && !s[5] && s[6]
+			if rev && !s[7] && !s[8] && !s[9] && !s[10] {
+				score += 40
+			}
+		}
+	}
+	dark := 0
+	for y := range c.Size {
+		line(func(x int) bool { return c.modules[y][x] })
+		line(func(x int) bool { return c.modules[x][y] })
+		for x := range c.Size {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.modules[y][x]
+				if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+					score += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (c.Size * c.Size)
+	return score + abs(percent-50)/5*10
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
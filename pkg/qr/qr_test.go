@@ -0,0 +1,177 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   int
+		wantSize int
+		wantErr  error
+	}{
+		{"empty", 0, 21, nil},
+		{"version 1 full", 14, 21, nil},
+		{"version 2", 15, 25, nil},
+		{"version 2 full", 26, 25, nil},
+		{"version 3", 27, 29, nil},
+		{"version 9 full", 180, 53, nil},
+		{"version 10, 16-bit count", 181, 57, nil},
+		{"version 10 full", 213, 57, nil},
+		{"too long", 214, 0, ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Encode(strings.Repeat("a", tt.length))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Encode: err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.Size != tt.wantSize {
+				t.Errorf("Size = %d, want %d", c.Size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestGFMul(t *testing.T) {
+	tests := []struct {
+		x, y, want byte
+	}{
+		{0, 0x53, 0},
+		{1, 0x53, 0x53},
+		{0x53, 1, 0x53},
+		{2, 0x40, 0x80},
+		{2, 0x80, 0x1D}, // wraps modulo the QR polynomial
+		{0x80, 0x80, 0x13},
+	}
+	for _, tt := range tests {
+		if got := gfMul(tt.x, tt.y); got != tt.want {
+			t.Errorf("gfMul(%#x, %#x) = %#x, want %#x", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" as version 1-M, in alphanumeric mode: the worked example
+	// of the QR specification's tutorials.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestDataCodewords(t *testing.T) {
+	tests := []struct {
+		text    string
+		version int
+		want    []byte
+	}{
+		// Mode 0100, count 00000010, "hi", terminator, then pad bytes.
+		{"hi", 1, []byte{0x40, 0x26, 0x86, 0x90, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}},
+		{"", 1, []byte{0x40, 0x00, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}},
+	}
+	for _, tt := range tests {
+		if got := dataCodewords(tt.text, tt.version); !bytes.Equal(got, tt.want) {
+			t.Errorf("dataCodewords(%q, %d) = % x, want % x", tt.text, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestFinderPatterns(t *testing.T) {
+	for _, text := range []string{"http://192.168.1.20:9090", strings.Repeat("x", 200)} {
+		c, err := Encode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+			for dy := range 7 {
+				for dx := range 7 {
+					d := max(abs(dx-3), abs(dy-3))
+					if want := d != 2; c.Dark(corner[0]+dx, corner[1]+dy) != want {
+						t.Fatalf("%d-module code: finder at %v: module (%d, %d) dark = %v, want %v",
+							c.Size, corner, dx, dy, !want, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFormatInformation(t *testing.T) {
+	for _, text := range []string{"", "http://10.0.0.5:9090/", strings.Repeat("z", 100)} {
+		c, err := Encode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var first, second int
+		read := func(bits *int, i, x, y int) {
+			if c.Dark(x, y) {
+				*bits |= 1 << i
+			}
+		}
+		for i := range 6 {
+			read(&first, i, 8, i)
+		}
+		read(&first, 6, 8, 7)
+		read(&first, 7, 8, 8)
+		read(&first, 8, 7, 8)
+		for i := 9; i < 15; i++ {
+			read(&first, i, 14-i, 8)
+		}
+		for i := range 8 {
+			read(&second, i, c.Size-1-i, 8)
+		}
+		for i := 8; i < 15; i++ {
+			read(&second, i, 8, c.Size-15+i)
+		}
+		if first != second {
+			t.Errorf("%q: format copies differ: %015b and %015b", text, first, second)
+		}
+		bits := first ^ 0x5412
+		if level := bits >> 13; level != 0b00 {
+			t.Errorf("%q: error correction level bits = %02b, want 00 (M)", text, level)
+		}
+		rem := bits
+		for i := 14; i >= 10; i-- {
+			if rem>>i&1 == 1 {
+				rem ^= 0x537 << (i - 10)
+			}
+		}
+		if rem != 0 {
+			t.Errorf("%q: format bits %015b fail their BCH check", text, bits)
+		}
+		if !c.Dark(8, c.Size-8) {
+			t.Errorf("%q: the dark module is light", text)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	c, err := Encode("http://localhost:9090")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(c.String(), "\n"), "\n")
+	// Two-module quiet zone on each side, two rows of modules per line.
+	width := c.Size + 4
+	if want := (width + 1) / 2; len(lines) != want {
+		t.Errorf("got %d lines, want %d", len(lines), want)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != width {
+			t.Errorf("line %d: %d characters, want %d", i, n, width)
+		}
+	}
+	if lines[0] != strings.Repeat("█", width) {
+		t.Errorf("first line %q is not all quiet zone", lines[0])
+	}
+}
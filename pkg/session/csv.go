@@ -0,0 +1,74 @@
+package session
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// csvHeader names the columns WriteCSV writes. Durations are milliseconds
+// and sizes bytes.
+var csvHeader = []string{
+	"id", "started", "method", "host", "path", "upstream", "target", "status", "state", "error",
+	"duration_ms", "proxy_ms", "blocked_ms", "dns_ms", "connect_ms", "tls_ms", "send_ms", "wait_ms", "receive_ms",
+	"request_bytes", "response_bytes", "content_type", "tags",
+}
+
+// WriteCSV writes one row per flow, with its timing breakdown, sizes, and
+// tags, for analysis in a spreadsheet. The export is one-way: Read does not
+// accept it. Flows that weren't forwarded leave the timing columns empty;
+// tags are separated by spaces.
+func WriteCSV(w io.Writer, flows []*proxy.Flow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, f := range flows {
+		if err := cw.Write(csvRow(f)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvRow(f *proxy.Flow) []string {
+	row := make([]string, 0, len(csvHeader))
+	var method, host, path string
+	var reqSize int64
+	if r := f.Request; r != nil {
+		method, host, path, reqSize = r.Method, r.Host, r.Path, r.Size
+	}
+	status, respSize, ctype := "", "", ""
+	if r := f.Response; r != nil {
+		status = strconv.Itoa(r.StatusCode)
+		respSize = strconv.FormatInt(r.Size, 10)
+		ctype = r.Headers.Get("Content-Type")
+	}
+	row = append(row, f.ID, f.Timestamps.Created.Format(time.RFC3339Nano), method, host, path,
+		f.Upstream, f.TargetURL, status, string(f.State), f.Error)
+
+	duration := ""
+	if !f.Timestamps.ResponseDone.IsZero() {
+		duration = csvMillis(float64(f.Duration()) / float64(time.Millisecond))
+	}
+	row = append(row, duration)
+	if t := f.Timings; t != nil {
+		for _, ms := range []float64{t.Proxy, t.Blocked, t.DNS, t.Connect, t.TLS, t.Send, t.Wait, t.Receive} {
+			row = append(row, csvMillis(ms))
+		}
+	} else {
+		row = append(row, make([]string, 8)...)
+	}
+
+	return append(row, strconv.FormatInt(reqSize, 10), respSize, ctype, strings.Join(f.Tags, " "))
+}
+
+// csvMillis formats milliseconds to microsecond precision.
+func csvMillis(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 3, 64)
+}
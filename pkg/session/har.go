@@ -0,0 +1,357 @@
+package session
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// HAR is the root of an HTTP Archive 1.2 document.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the archive's entries.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the tool that produced the archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request/response pair.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"` // upstream name
+
+	// Note is the flow's user note, as a custom (underscore-prefixed) field.
+	Note string `json:"_note,omitempty"`
+}
+
+// HARRequest is the request half of an entry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	Cookies     []HARNameValue `json:"cookies"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is the response half of an entry.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header, query parameter, or cookie.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is a request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // non-standard, mirrors content.encoding
+}
+
+// HARContent is a response body.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings breaks down an entry's duration in milliseconds. Optional
+// phases are -1 when they don't apply.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"` // includes SSL
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ToHAR converts flows to a HAR 1.2 document.
+func ToHAR(flows []*proxy.Flow) *HAR {
+	h := &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "http-proxy", Version: "1"},
+		Entries: make([]HAREntry, 0, len(flows)),
+	}}
+	for _, f := range flows {
+		if f.Request == nil {
+			continue
+		}
+		h.Log.Entries = append(h.Log.Entries, toHAREntry(f))
+	}
+	return h
+}
+
+func toHAREntry(f *proxy.Flow) HAREntry {
+	ts := f.Timestamps
+	e := HAREntry{
+		StartedDateTime: ts.Created,
+		Time:            ms(f.Duration()),
+		Comment:         f.Upstream,
+		Note:            f.Note,
+	}
+
+	req := f.Request
+	reqBody := req.ReadBody()
+	e.Request = HARRequest{
+		Method:      req.Method,
+		URL:         absoluteURL(req),
+		HTTPVersion: req.Proto,
+		Headers:     headersToHAR(req.Headers),
+		QueryString: queryToHAR(req.URL),
+		Cookies:     []HARNameValue{},
+		HeadersSize: headersSize(req.HeadersSize),
+		BodySize:    bodySize(reqBody, req.Size),
+	}
+	if len(reqBody) > 0 {
+		text, enc := encodeBody(reqBody)
+		e.Request.PostData = &HARPostData{
+			MimeType: req.Headers.Get("Content-Type"),
+			Text:     text,
+			Encoding: enc,
+		}
+	}
+
+	if resp := f.Response; resp != nil {
+		respBody := resp.ReadBody()
+		text, enc := encodeBody(respBody)
+		e.Response = HARResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Headers:     headersToHAR(resp.Headers),
+			Cookies:     []HARNameValue{},
+			Content: HARContent{
+				Size:     bodySize(respBody, resp.Size),
+				MimeType: resp.Headers.Get("Content-Type"),
+				Text:     text,
+				Encoding: enc,
+			},
+			HeadersSize: headersSize(resp.HeadersSize),
+			BodySize:    bodySize(respBody, resp.Size),
+		}
+	} else {
+		e.Response = HARResponse{
+			Headers:     []HARNameValue{},
+			Cookies:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+	}
+
+	e.Timings.Blocked, e.Timings.DNS, e.Timings.Connect, e.Timings.SSL = -1, -1, -1, -1
+	if t := f.Timings; t != nil {
+		e.Timings.Blocked = t.Proxy + t.Blocked
+		e.Timings.DNS = optionalPhase(t.DNS)
+		e.Timings.Connect = optionalPhase(t.Connect + t.TLS)
+		e.Timings.SSL = optionalPhase(t.TLS)
+		e.Timings.Send = t.Send
+		e.Timings.Wait = t.Wait
+		e.Timings.Receive = t.Receive
+	} else if !ts.RequestDone.IsZero() && !ts.ResponseStart.IsZero() {
+		e.Timings.Send = ms(ts.RequestDone.Sub(ts.Created))
+		e.Timings.Wait = ms(ts.ResponseStart.Sub(ts.RequestDone))
+		if !ts.ResponseDone.IsZero() {
+			e.Timings.Receive = ms(ts.ResponseDone.Sub(ts.ResponseStart))
+		}
+	} else {
+		e.Timings.Wait = e.Time
+	}
+	return e
+}
+
+// FromHAR converts HAR entries back into flows. Each flow gets a fresh ID.
+func FromHAR(h *HAR) ([]*proxy.Flow, error) {
+	flows := make([]*proxy.Flow, 0, len(h.Log.Entries))
+	for i, e := range h.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: invalid url %q: %w", i, e.Request.URL, err)
+		}
+		f := &proxy.Flow{
+			ID:       uuid.New().String(),
+			Upstream: e.Comment,
+			Note:     e.Note,
+			State:    proxy.FlowStateComplete,
+		}
+		f.Timestamps.Created = e.StartedDateTime
+		f.Timestamps.RequestDone = e.StartedDateTime.Add(dur(e.Timings.Send))
+		f.Timestamps.ResponseStart = f.Timestamps.RequestDone.Add(dur(e.Timings.Wait))
+		f.Timestamps.ResponseDone = e.StartedDateTime.Add(dur(e.Time))
+		f.Timings = &proxy.Timings{
+			Blocked: max(0, e.Timings.Blocked),
+			DNS:     max(0, e.Timings.DNS),
+			Connect: max(0, e.Timings.Connect-max(0, e.Timings.SSL)),
+			TLS:     max(0, e.Timings.SSL),
+			Send:    e.Timings.Send,
+			Wait:    e.Timings.Wait,
+			Receive: e.Timings.Receive,
+		}
+
+		f.Request = &proxy.CapturedRequest{
+			Method:  e.Request.Method,
+			URL:     u.RequestURI(),
+			Path:    u.Path,
+			Host:    u.Host,
+			Headers: headersFromHAR(e.Request.Headers),
+			Proto:   e.Request.HTTPVersion,
+		}
+		if pd := e.Request.PostData; pd != nil {
+			body, err := decodeBody(pd.Text, pd.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: request body: %w", i, err)
+			}
+			f.Request.Body = body
+		}
+		f.Request.Size = max(int64(e.Request.BodySize), int64(len(f.Request.Body)))
+		f.Request.HeadersSize = max(int64(e.Request.HeadersSize), 0)
+		if e.Response.Status > 0 {
+			body, err := decodeBody(e.Response.Content.Text, e.Response.Content.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: response body: %w", i, err)
+			}
+			f.Response = &proxy.CapturedResponse{
+				StatusCode: e.Response.Status,
+				Headers:    headersFromHAR(e.Response.Headers),
+				Body:       body,
+				Proto:      e.Response.HTTPVersion,
+				Size:       max(int64(e.Response.Content.Size), int64(len(body))),
+
+				HeadersSize: max(int64(e.Response.HeadersSize), 0),
+			}
+		} else {
+			f.State = proxy.FlowStateError
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// bodySize returns the full body length, falling back to the captured length
+// for flows recorded before sizes were tracked.
+func bodySize(body []byte, size int64) int {
+	return int(max(size, int64(len(body))))
+}
+
+// headersSize returns a header block length for HAR, where -1 means
+// unknown, as it is for flows recorded before header sizes were tracked.
+func headersSize(n int64) int {
+	if n == 0 {
+		return -1
+	}
+	return int(n)
+}
+
+// absoluteURL returns the request URL with scheme and host, as HAR requires.
+// Captured URLs are usually origin-form ("/path?q"), so the Host header is used.
+func absoluteURL(req *proxy.CapturedRequest) string {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.IsAbs() {
+		return req.URL
+	}
+	u.Scheme = "http"
+	u.Host = req.Host
+	return u.String()
+}
+
+func headersToHAR(h http.Header) []HARNameValue {
+	out := []HARNameValue{}
+	for k, vv := range h {
+		for _, v := range vv {
+			out = append(out, HARNameValue{Name: k, Value: v})
+		}
+	}
+	return out
+}
+
+func headersFromHAR(nvs []HARNameValue) http.Header {
+	h := make(http.Header)
+	for _, nv := range nvs {
+		h.Add(nv.Name, nv.Value)
+	}
+	return h
+}
+
+func queryToHAR(rawURL string) []HARNameValue {
+	out := []HARNameValue{}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return out
+	}
+	for k, vv := range u.Query() {
+		for _, v := range vv {
+			out = append(out, HARNameValue{Name: k, Value: v})
+		}
+	}
+	return out
+}
+
+// encodeBody returns body as text, base64-encoding it when it isn't valid UTF-8.
+func encodeBody(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// optionalPhase maps a phase that didn't happen to HAR's -1.
+func optionalPhase(ms float64) float64 {
+	if ms == 0 {
+		return -1
+	}
+	return ms
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+func dur(ms float64) time.Duration {
+	if ms < 0 {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
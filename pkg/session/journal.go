@@ -0,0 +1,181 @@
+package session
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// A Journal is an embedded bbolt database of flows, written as flows finish
+// so that they survive a restart. Flows are kept as native JSON under a
+// big-endian sequence number, so they iterate oldest first. Each batch is
+// appended in one transaction, synced to disk on commit, so a crash loses
+// at most the flows not yet appended and never leaves one half written.
+type Journal struct {
+	path string
+	db   *bbolt.DB
+}
+
+var journalBucket = []byte("flows")
+
+// journalCompactTx bounds the size of a transaction while a journal is
+// rewritten by compaction.
+const journalCompactTx = 64 << 20
+
+// OpenJournal opens the journal at path, creating it and its directory if
+// needed. A journal larger than maxBytes is first cut down to the newest
+// flows that fit in half of that, so it doesn't have to be compacted again
+// straight away, and rewritten to release the space; compacted reports
+// whether it was. A maxBytes of 0 never compacts.
+func OpenJournal(path string, maxBytes int64) (j *Journal, compacted bool, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, false, err
+	}
+	db, err := openJournalDB(path)
+	if err != nil {
+		return nil, false, err
+	}
+	j = &Journal{path: path, db: db}
+	if compacted, err = j.compact(maxBytes); err != nil {
+		j.Close()
+		return nil, false, err
+	}
+	return j, compacted, nil
+}
+
+// openJournalDB opens the database at path and creates its bucket. bbolt
+// locks the file, so a journal another process has open fails after a
+// second rather than blocking.
+func openJournalDB(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another process", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(journalBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Append adds flows to the journal in one transaction.
+func (j *Journal) Append(flows []*proxy.Flow) error {
+	values := make([][]byte, len(flows))
+	for i, f := range flows {
+		v, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+	return j.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(journalBucket)
+		for _, v := range values {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Latest returns the last n flows in the journal, oldest first, or all of
+// them if n is negative. Flows that no longer decode are skipped.
+func (j *Journal) Latest(n int) ([]*proxy.Flow, error) {
+	var flows []*proxy.Flow
+	err := j.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(journalBucket).Cursor()
+		for k, v := c.Last(); k != nil && (n < 0 || len(flows) < n); k, v = c.Prev() {
+			var f proxy.Flow
+			if json.Unmarshal(v, &f) == nil {
+				flows = append(flows, &f)
+			}
+		}
+		return nil
+	})
+	slices.Reverse(flows)
+	return flows, err
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	return j.db.Close()
+}
+
+// compact deletes the oldest flows if the journal file is larger than
+// maxBytes, keeping the newest that fit in half of it, and rewrites the
+// file, which bbolt never shrinks on its own. It reports whether it did.
+func (j *Journal) compact(maxBytes int64) (bool, error) {
+	fi, err := os.Stat(j.path)
+	if err != nil || maxBytes <= 0 || fi.Size() <= maxBytes {
+		return false, err
+	}
+	err = j.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(journalBucket)
+		c := b.Cursor()
+		var size int64
+		k, v := c.Last()
+		for ; k != nil && size+int64(len(k)+len(v)) <= maxBytes/2; k, v = c.Prev() {
+			size += int64(len(k) + len(v))
+		}
+		var stale [][]byte
+		for ; k != nil; k, _ = c.Prev() {
+			stale = append(stale, slices.Clone(k))
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), "."+filepath.Base(j.path)+".*")
+	if err != nil {
+		return false, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	dst, err := bbolt.Open(tmp.Name(), 0o600, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := bbolt.Compact(dst, j.db, journalCompactTx); err != nil {
+		dst.Close()
+		return false, err
+	}
+	if err := dst.Close(); err != nil {
+		return false, err
+	}
+	if err := j.db.Close(); err != nil {
+		return false, err
+	}
+	renameErr := os.Rename(tmp.Name(), j.path)
+	if j.db, err = openJournalDB(j.path); err != nil {
+		return false, err
+	}
+	return renameErr == nil, renameErr
+}
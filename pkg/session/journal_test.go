@@ -0,0 +1,153 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+func journalFlow(i int, body string) *proxy.Flow {
+	return &proxy.Flow{
+		ID:       fmt.Sprintf("flow-%d", i),
+		Upstream: "api",
+		State:    proxy.FlowStateComplete,
+		Request:  &proxy.CapturedRequest{Method: "GET", URL: fmt.Sprintf("http://example.test/items/%d", i)},
+		Response: &proxy.CapturedResponse{StatusCode: 200, Body: []byte(body), Size: int64(len(body))},
+	}
+}
+
+func flowIDs(flows []*proxy.Flow) []string {
+	var ids []string
+	for _, f := range flows {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func TestJournalReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "journal")
+	j, compacted, err := OpenJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted {
+		t.Error("a new journal was compacted")
+	}
+	for batch := range 3 {
+		var flows []*proxy.Flow
+		for i := range 2 {
+			flows = append(flows, journalFlow(batch*2+i, "ok"))
+		}
+		if err := j.Append(flows); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, _, err = OpenJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{-1, []string{"flow-0", "flow-1", "flow-2", "flow-3", "flow-4", "flow-5"}},
+		{0, nil},
+		{2, []string{"flow-4", "flow-5"}},
+		{5, []string{"flow-1", "flow-2", "flow-3", "flow-4", "flow-5"}},
+		{100, []string{"flow-0", "flow-1", "flow-2", "flow-3", "flow-4", "flow-5"}},
+	}
+	for _, tt := range tests {
+		flows, err := j.Latest(tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := flowIDs(flows); !slices.Equal(got, tt.want) {
+			t.Errorf("Latest(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+
+	flows, _ := j.Latest(1)
+	f := flows[0]
+	if f.Request.URL != "http://example.test/items/5" || f.Response.StatusCode != 200 || string(f.Response.ReadBody()) != "ok" {
+		t.Errorf("reloaded flow = %+v, %+v", f.Request, f.Response)
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, _, err := OpenJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.Repeat("x", 4096)
+	for i := range 200 {
+		if err := j.Append([]*proxy.Flow{journalFlow(i, body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const maxBytes = 256 << 10
+	j, compacted, err := OpenJournal(path, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if !compacted {
+		t.Fatalf("a %d-byte journal was not compacted to %d", before.Size(), maxBytes)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() > maxBytes {
+		t.Errorf("compacted journal is %d bytes, want at most %d", after.Size(), maxBytes)
+	}
+	flows, err := j.Latest(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) == 0 || len(flows) >= 200 {
+		t.Fatalf("compaction kept %d of 200 flows", len(flows))
+	}
+	if last := flows[len(flows)-1].ID; last != "flow-199" {
+		t.Errorf("newest flow after compaction = %s, want flow-199", last)
+	}
+	if first := flows[0].ID; first != fmt.Sprintf("flow-%d", 200-len(flows)) {
+		t.Errorf("compaction kept %d flows from %s, want the newest", len(flows), first)
+	}
+
+	// Appending after compaction carries on the sequence.
+	if err := j.Append([]*proxy.Flow{journalFlow(200, "ok")}); err != nil {
+		t.Fatal(err)
+	}
+	if flows, _ := j.Latest(1); len(flows) != 1 || flows[0].ID != "flow-200" {
+		t.Errorf("Latest(1) after compaction = %v, want [flow-200]", flowIDs(flows))
+	}
+}
+
+func TestJournalInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, _, err := OpenJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if _, _, err := OpenJournal(path, 0); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("opening a journal twice: err = %v, want in use", err)
+	}
+}
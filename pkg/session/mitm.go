@@ -0,0 +1,406 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// MitmFlowVersion is the mitmproxy flow format version written by WriteMitm
+// (mitmproxy 10). mitmproxy upgrades older versions on load; ReadMitm only
+// relies on the request and response fields, which all versions share.
+const MitmFlowVersion = 20
+
+// WriteMitm encodes flows as a mitmproxy flow file, readable by mitmproxy -r
+// and mitmweb.
+func WriteMitm(w io.Writer, flows []*proxy.Flow) error {
+	var buf bytes.Buffer
+	for _, f := range flows {
+		if f.Request == nil {
+			continue
+		}
+		if err := writeTNetString(&buf, toMitmFlow(f)); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func toMitmFlow(f *proxy.Flow) map[string]any {
+	ts := f.Timestamps
+	u, err := url.Parse(absoluteURL(f.Request))
+	if err != nil {
+		u = &url.URL{Scheme: "http", Host: f.Request.Host, Path: f.Request.Path}
+	}
+	host, port := splitHostPort(u.Host, u.Scheme)
+	tls := u.Scheme == "https"
+
+	req := f.Request
+	headers := req.Headers
+	if headers.Get("Host") == "" && req.Host != "" {
+		// Go keeps Host out of the header map; mitmproxy expects it there.
+		headers = headers.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Set("Host", req.Host)
+	}
+	request := map[string]any{
+		"http_version":    []byte(orDefault(req.Proto, "HTTP/1.1")),
+		"headers":         mitmHeaders(headers),
+		"content":         bodyOrEmpty(req.ReadBody()),
+		"trailers":        mitmTrailers(req.Trailers),
+		"timestamp_start": unixOrNil(ts.Created),
+		"timestamp_end":   unixOrNil(ts.RequestDone),
+		"host":            host,
+		"port":            port,
+		"method":          []byte(req.Method),
+		"scheme":          []byte(u.Scheme),
+		"authority":       []byte{},
+		"path":            []byte(u.RequestURI()),
+	}
+	if request["timestamp_start"] == nil {
+		request["timestamp_start"] = 0.0
+	}
+
+	var response any
+	if resp := f.Response; resp != nil {
+		response = map[string]any{
+			"http_version":    []byte(orDefault(resp.Proto, "HTTP/1.1")),
+			"headers":         mitmHeaders(resp.Headers),
+			"content":         bodyOrEmpty(resp.ReadBody()),
+			"trailers":        mitmTrailers(resp.Trailers),
+			"timestamp_start": unixOrNil(ts.ResponseStart),
+			"timestamp_end":   unixOrNil(ts.ResponseDone),
+			"status_code":     int64(resp.StatusCode),
+			"reason":          []byte(http.StatusText(resp.StatusCode)),
+		}
+	}
+
+	var flowErr any
+	if f.Error != "" {
+		flowErr = map[string]any{"msg": f.Error, "timestamp": unixOrNil(ts.ResponseDone)}
+	}
+	var isReplay any
+	if slices.Contains(f.Tags, "replay") {
+		isReplay = "request"
+	}
+	marked := ""
+	if f.Pinned {
+		marked = ":default:"
+	}
+	metadata := map[string]any{}
+	if f.Upstream != "" {
+		metadata["upstream"] = f.Upstream
+	}
+
+	clientHost, clientPort := splitHostPort(req.RemoteAddr, "")
+	client := mitmConnection(tls)
+	client["peername"] = []any{orDefault(clientHost, "127.0.0.1"), clientPort}
+	client["sockname"] = []any{"0.0.0.0", int64(0)}
+	client["timestamp_start"] = request["timestamp_start"]
+	client["mitmcert"] = nil
+	client["proxy_mode"] = "regular"
+
+	server := mitmConnection(tls)
+	server["peername"] = nil
+	server["sockname"] = nil
+	server["address"] = []any{host, port}
+	server["timestamp_tcp_setup"] = nil
+	server["via"] = nil
+	if tls {
+		server["sni"] = host
+	}
+
+	return map[string]any{
+		"version":           int64(MitmFlowVersion),
+		"id":                orDefault(f.ID, uuid.New().String()),
+		"type":              "http",
+		"request":           request,
+		"response":          response,
+		"error":             flowErr,
+		"websocket":         nil,
+		"client_conn":       client,
+		"server_conn":       server,
+		"intercepted":       false,
+		"is_replay":         isReplay,
+		"marked":            marked,
+		"metadata":          metadata,
+		"comment":           f.Note,
+		"timestamp_created": request["timestamp_start"],
+	}
+}
+
+// mitmConnection returns the fields shared by mitmproxy's client and server
+// connection state.
+func mitmConnection(tls bool) map[string]any {
+	return map[string]any{
+		"id":                  uuid.New().String(),
+		"error":               nil,
+		"tls":                 tls,
+		"certificate_list":    []any{},
+		"alpn":                nil,
+		"alpn_offers":         []any{},
+		"cipher":              nil,
+		"cipher_list":         []any{},
+		"tls_version":         nil,
+		"sni":                 nil,
+		"timestamp_start":     nil,
+		"timestamp_end":       nil,
+		"timestamp_tls_setup": nil,
+		"transport_protocol":  "tcp",
+	}
+}
+
+func mitmHeaders(h http.Header) []any {
+	fields := []any{}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fields = append(fields, []any{[]byte(k), []byte(v)})
+		}
+	}
+	return fields
+}
+
+func mitmTrailers(h http.Header) any {
+	if len(h) == 0 {
+		return nil
+	}
+	return mitmHeaders(h)
+}
+
+// ReadMitm decodes a mitmproxy flow file. Non-HTTP flows (TCP, UDP, DNS) are
+// skipped. Each flow keeps its mitmproxy ID.
+func ReadMitm(r io.Reader) ([]*proxy.Flow, error) {
+	br := bufio.NewReader(r)
+	var flows []*proxy.Flow
+	for i := 0; ; i++ {
+		v, err := readTNetString(br)
+		if errors.Is(err, io.EOF) {
+			return flows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("flow %d: %w", i, err)
+		}
+		state, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("flow %d: not a flow", i)
+		}
+		if t := mitmString(state["type"]); t != "" && t != "http" {
+			continue
+		}
+		f, err := fromMitmFlow(state)
+		if err != nil {
+			return nil, fmt.Errorf("flow %d: %w", i, err)
+		}
+		flows = append(flows, f)
+	}
+}
+
+func fromMitmFlow(state map[string]any) (*proxy.Flow, error) {
+	req, ok := state["request"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("no request")
+	}
+	f := &proxy.Flow{
+		ID:    mitmString(state["id"]),
+		Note:  mitmString(state["comment"]),
+		State: proxy.FlowStateComplete,
+	}
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+
+	host := mitmString(req["host"])
+	port := int(mitmNumber(req["port"]))
+	scheme := orDefault(mitmString(req["scheme"]), "http")
+	headers := fromMitmHeaders(req["headers"])
+	hostport := headers.Get("Host")
+	if hostport == "" {
+		hostport = host
+		if port != 0 && !(scheme == "http" && port == 80 || scheme == "https" && port == 443) {
+			hostport = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+	headers.Del("Host")
+	path := orDefault(mitmString(req["path"]), "/")
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %w", path, err)
+	}
+	if md, ok := state["metadata"].(map[string]any); ok {
+		f.Upstream = mitmString(md["upstream"])
+	}
+	f.Request = &proxy.CapturedRequest{
+		Method:   mitmString(req["method"]),
+		URL:      u.RequestURI(),
+		Path:     u.Path,
+		Host:     hostport,
+		Headers:  headers,
+		Body:     mitmBytes(req["content"]),
+		Proto:    mitmString(req["http_version"]),
+		Trailers: fromMitmTrailers(req["trailers"]),
+	}
+	f.Request.Size = int64(len(f.Request.Body))
+	if client, ok := state["client_conn"].(map[string]any); ok {
+		peer := client["peername"]
+		if peer == nil {
+			peer = client["address"] // older format versions
+		}
+		if addr, ok := peer.([]any); ok && len(addr) == 2 {
+			f.Request.RemoteAddr = net.JoinHostPort(mitmString(addr[0]), strconv.Itoa(int(mitmNumber(addr[1]))))
+		}
+	}
+	f.Timestamps.Created = fromUnix(req["timestamp_start"])
+	f.Timestamps.RequestDone = fromUnix(req["timestamp_end"])
+
+	if resp, ok := state["response"].(map[string]any); ok {
+		f.Response = &proxy.CapturedResponse{
+			StatusCode: int(mitmNumber(resp["status_code"])),
+			Headers:    fromMitmHeaders(resp["headers"]),
+			Body:       mitmBytes(resp["content"]),
+			Proto:      mitmString(resp["http_version"]),
+			Trailers:   fromMitmTrailers(resp["trailers"]),
+		}
+		f.Response.Size = int64(len(f.Response.Body))
+		f.Timestamps.ResponseStart = fromUnix(resp["timestamp_start"])
+		f.Timestamps.ResponseDone = fromUnix(resp["timestamp_end"])
+	}
+	if e, ok := state["error"].(map[string]any); ok {
+		f.State = proxy.FlowStateError
+		f.Error = mitmString(e["msg"])
+		if f.Timestamps.ResponseDone.IsZero() {
+			f.Timestamps.ResponseDone = fromUnix(e["timestamp"])
+		}
+	} else if f.Response == nil {
+		f.State = proxy.FlowStateError
+	}
+	switch m := state["marked"].(type) {
+	case bool: // older format versions
+		f.Pinned = m
+	default:
+		f.Pinned = mitmString(m) != ""
+	}
+	if mitmString(state["is_replay"]) == "request" {
+		f.Tags = append(f.Tags, "replay")
+	}
+	return f, nil
+}
+
+func fromMitmHeaders(v any) http.Header {
+	h := http.Header{}
+	fields, _ := v.([]any)
+	for _, field := range fields {
+		if kv, ok := field.([]any); ok && len(kv) == 2 {
+			h.Add(mitmString(kv[0]), mitmString(kv[1]))
+		}
+	}
+	return h
+}
+
+func fromMitmTrailers(v any) http.Header {
+	if v == nil {
+		return nil
+	}
+	return fromMitmHeaders(v)
+}
+
+// mitmString reads a value that older mitmproxy versions store as bytes and
+// newer ones as str.
+func mitmString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func mitmBytes(v any) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+func mitmNumber(v any) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func fromUnix(v any) time.Time {
+	s := mitmNumber(v)
+	if s == 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(s)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// unixOrNil returns t as float seconds, or nil for the zero time.
+func unixOrNil(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// splitHostPort splits hostport, defaulting the port from scheme.
+func splitHostPort(hostport, scheme string) (string, int64) {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	port, _ := strconv.ParseInt(p, 10, 64)
+	if port == 0 {
+		switch scheme {
+		case "https":
+			port = 443
+		case "http":
+			port = 80
+		}
+	}
+	return host, port
+}
+
+func bodyOrEmpty(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
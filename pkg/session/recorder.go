@@ -0,0 +1,168 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// A Recorder writes flows to a session file as they finish, so a long
+// recording neither keeps its flows in memory nor rewrites the file. Native
+// sessions are written as NDJSON, one flow per line, and hpz sessions as
+// one gzip member of NDJSON per Append; Read accepts both. mitmproxy flow
+// files are a sequence of flows already. HAR is a single document, so its
+// flows are spooled as NDJSON next to the file and converted, one at a
+// time, by Close.
+type Recorder struct {
+	path   string
+	format Format
+	f      *os.File // the session file, or for HAR the spool
+}
+
+// CreateRecorder creates (or truncates) the session file at path.
+func CreateRecorder(path string, format Format) (*Recorder, error) {
+	r := &Recorder{path: path, format: format}
+	var err error
+	if format == FormatHAR {
+		// Check the session file can be written before spooling to it.
+		if err = os.WriteFile(path, nil, 0o644); err != nil {
+			return nil, err
+		}
+		r.f, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.ndjson")
+	} else {
+		r.f, err = os.Create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Append writes flows to the end of the session file.
+func (r *Recorder) Append(flows []*proxy.Flow) error {
+	var buf bytes.Buffer
+	switch r.format {
+	case FormatMitm:
+		if err := WriteMitm(&buf, flows); err != nil {
+			return err
+		}
+	case FormatCompressed:
+		zw := gzip.NewWriter(&buf)
+		if err := writeNDJSON(zw, flows); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	default:
+		if err := writeNDJSON(&buf, flows); err != nil {
+			return err
+		}
+	}
+	_, err := r.f.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the session file, first writing the HAR from its spool.
+func (r *Recorder) Close() error {
+	if r.format != FormatHAR {
+		return r.f.Close()
+	}
+	spool := r.f.Name()
+	defer os.Remove(spool)
+	if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+		r.f.Close()
+		return err
+	}
+	err := r.writeHAR()
+	return errors.Join(err, r.f.Close())
+}
+
+// writeHAR converts the spool to a HAR document, entry by entry, written
+// atomically like Save.
+func (r *Recorder) writeHAR() error {
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	creator, _ := json.MarshalIndent(HARCreator{Name: "http-proxy", Version: "1"}, "    ", "  ")
+	fmt.Fprintf(w, "{\n  \"log\": {\n    \"version\": \"1.2\",\n    \"creator\": %s,\n    \"entries\": [", creator)
+	sep := "\n      "
+	err = readNDJSON(bufio.NewReader(r.f), func(f *proxy.Flow) error {
+		if f.Request == nil {
+			return nil
+		}
+		entry, err := json.MarshalIndent(toHAREntry(f), "      ", "  ")
+		if err != nil {
+			return err
+		}
+		w.WriteString(sep)
+		w.Write(entry)
+		sep = ",\n      "
+		return nil
+	})
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if sep == "\n      " {
+		w.WriteString("]\n  }\n}\n")
+	} else {
+		w.WriteString("\n    ]\n  }\n}\n")
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// writeNDJSON writes flows to w, one JSON value per line.
+func writeNDJSON(w io.Writer, flows []*proxy.Flow) error {
+	enc := json.NewEncoder(w)
+	for _, f := range flows {
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readNDJSON calls fn with each flow of an NDJSON stream. A last line cut
+// short, by a crash mid-write, is skipped.
+func readNDJSON(r *bufio.Reader, fn func(*proxy.Flow) error) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var f proxy.Flow
+			if jerr := json.Unmarshal(line, &f); jerr != nil {
+				if err == io.EOF {
+					return nil // torn final line
+				}
+				return fmt.Errorf("decode session: %w", jerr)
+			}
+			if ferr := fn(&f); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
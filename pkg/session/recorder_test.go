@@ -0,0 +1,97 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+func TestRecorder(t *testing.T) {
+	for _, name := range []string{"session.json", "session.hpz", "session.mitm", "session.har"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, name)
+			rec, err := CreateRecorder(path, FormatForPath(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for batch := range 3 {
+				if err := rec.Append([]*proxy.Flow{journalFlow(batch*2, "a"), journalFlow(batch*2+1, "b")}); err != nil {
+					t.Fatal(err)
+				}
+				if FormatForPath(path) == FormatHAR {
+					continue // written by Close
+				}
+				flows, err := Load(path)
+				if err != nil {
+					t.Fatalf("loading a recording in progress: %v", err)
+				}
+				if len(flows) != (batch+1)*2 {
+					t.Fatalf("after %d appends: loaded %d flows", batch+1, len(flows))
+				}
+			}
+			if err := rec.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			flows, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var urls []string
+			for _, f := range flows {
+				urls = append(urls, strings.TrimPrefix(f.Request.URL, "http://example.test"))
+			}
+			want := []string{"/items/0", "/items/1", "/items/2", "/items/3", "/items/4", "/items/5"}
+			if !slices.Equal(urls, want) {
+				t.Errorf("recorded %v, want %v", urls, want)
+			}
+			if body := string(flows[5].Response.ReadBody()); body != "b" {
+				t.Errorf("last body = %q, want b", body)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("recording left %d files behind, want only the session", len(entries))
+			}
+		})
+	}
+}
+
+func TestRecorderEmpty(t *testing.T) {
+	for _, name := range []string{"session.json", "session.har"} {
+		path := filepath.Join(t.TempDir(), name)
+		rec, err := CreateRecorder(path, FormatForPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if flows, err := Load(path); err != nil || len(flows) != 0 {
+			t.Errorf("%s: empty recording loaded %d flows, err %v", name, len(flows), err)
+		}
+	}
+}
+
+func TestReadTornRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	rec, err := CreateRecorder(path, FormatNative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Append([]*proxy.Flow{journalFlow(0, "a"), journalFlow(1, "b")})
+	rec.Close()
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-10], 0o644) // a crash mid-write
+
+	flows, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 || flows[0].ID != "flow-0" {
+		t.Errorf("loaded %v, want the flow written in full", flowIDs(flows))
+	}
+}
@@ -0,0 +1,189 @@
+// Package session reads and writes captured flows to disk.
+//
+// Four formats are supported:
+//
+//   - native: a JSON document holding proxy.Flow values verbatim (lossless),
+//     or, as a Recorder writes it, one proxy.Flow per line (NDJSON)
+//   - hpz:    the native format, gzip-compressed (.hpz)
+//   - har:    HTTP Archive 1.2, readable by browsers and most HTTP tools
+//   - mitm:   mitmproxy's flow file format, readable by mitmproxy and mitmweb
+//
+// Read detects the format automatically, including gzip compression.
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// Format identifies an on-disk session encoding.
+type Format string
+
+const (
+	FormatNative     Format = "native"
+	FormatCompressed Format = "hpz"
+	FormatHAR        Format = "har"
+	FormatMitm       Format = "mitm"
+)
+
+// Version is the native format version written by this package.
+const Version = 1
+
+// File is the native on-disk session representation.
+type File struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Flows   []*proxy.Flow `json:"flows"`
+}
+
+// ParseFormat validates a user-supplied format name.
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatNative, "json":
+		return FormatNative, nil
+	case FormatCompressed:
+		return FormatCompressed, nil
+	case FormatHAR:
+		return FormatHAR, nil
+	case FormatMitm, "mitmproxy":
+		return FormatMitm, nil
+	default:
+		return "", fmt.Errorf("unknown session format %q (want native, hpz, har, or mitm)", s)
+	}
+}
+
+// FormatForPath guesses the format from a file extension (.har → HAR,
+// .hpz → compressed native, .mitm and .flows → mitmproxy).
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".har":
+		return FormatHAR
+	case ".hpz":
+		return FormatCompressed
+	case ".mitm", ".flows":
+		return FormatMitm
+	}
+	return FormatNative
+}
+
+// Write encodes flows to w in the given format.
+func Write(w io.Writer, flows []*proxy.Flow, format Format) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	switch format {
+	case FormatHAR:
+		return enc.Encode(ToHAR(flows))
+	case FormatMitm:
+		return WriteMitm(w, flows)
+	case FormatCompressed:
+		zw := gzip.NewWriter(w)
+		if err := Write(zw, flows, FormatNative); err != nil {
+			return err
+		}
+		return zw.Close()
+	default:
+		if flows == nil {
+			flows = []*proxy.Flow{}
+		}
+		return enc.Encode(File{Version: Version, Created: time.Now(), Flows: flows})
+	}
+}
+
+// Read decodes flows from r, accepting native, HAR, or mitmproxy input,
+// optionally gzip-compressed.
+func Read(r io.Reader) ([]*proxy.Flow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decompress session: %w", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("decompress session: %w", err)
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil // a recording that captured nothing
+	}
+	if data[0] >= '0' && data[0] <= '9' {
+		// JSON documents start with '{'; tnetstrings with their length.
+		return ReadMitm(bytes.NewReader(data))
+	}
+	var probe struct {
+		Log     *json.RawMessage `json:"log"`
+		Version int              `json:"version"`
+		ID      string           `json:"id"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&probe); err != nil {
+		return nil, fmt.Errorf("decode session: %w", err)
+	}
+	if probe.ID != "" {
+		// A native session written by a Recorder: one flow per line.
+		var flows []*proxy.Flow
+		err := readNDJSON(bufio.NewReader(bytes.NewReader(data)), func(f *proxy.Flow) error {
+			flows = append(flows, f)
+			return nil
+		})
+		return flows, err
+	}
+	if probe.Log != nil {
+		var h HAR
+		if err := json.Unmarshal(data, &h); err != nil {
+			return nil, fmt.Errorf("decode HAR: %w", err)
+		}
+		return FromHAR(&h)
+	}
+	if probe.Version > Version {
+		return nil, fmt.Errorf("session version %d is newer than supported (%d)", probe.Version, Version)
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode session: %w", err)
+	}
+	return f.Flows, nil
+}
+
+// Load reads a session file from disk.
+func Load(path string) ([]*proxy.Flow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	flows, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return flows, nil
+}
+
+// Save writes flows to path atomically (write to a temp file, then rename),
+// so a crash mid-write never leaves a truncated session behind.
+func Save(path string, flows []*proxy.Flow, format Format) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := Write(tmp, flows, format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
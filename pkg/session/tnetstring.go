@@ -0,0 +1,159 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// tnetstrings (https://tnetstrings.info) are the framing of mitmproxy flow
+// files: LENGTH ":" DATA TYPE, where TYPE is one of
+//
+//	,  byte string       ;  unicode string (mitmproxy extension)
+//	#  integer           ^  float
+//	!  boolean           ~  null
+//	]  list              }  dict (alternating keys and values)
+//
+// Values decode to []byte, string, int64, float64, bool, nil, []any, and
+// map[string]any.
+
+// writeTNetString appends the encoding of v to buf. Dict keys are written in
+// sorted order so output is stable.
+func writeTNetString(buf *bytes.Buffer, v any) error {
+	var data []byte
+	var tag byte
+	switch v := v.(type) {
+	case nil:
+		tag = '~'
+	case bool:
+		data, tag = strconv.AppendBool(nil, v), '!'
+	case int:
+		data, tag = strconv.AppendInt(nil, int64(v), 10), '#'
+	case int64:
+		data, tag = strconv.AppendInt(nil, v, 10), '#'
+	case float64:
+		data, tag = strconv.AppendFloat(nil, v, 'f', -1, 64), '^'
+		if !bytes.ContainsRune(data, '.') {
+			data = append(data, ".0"...)
+		}
+	case string:
+		data, tag = []byte(v), ';'
+	case []byte:
+		data, tag = v, ','
+	case []any:
+		var inner bytes.Buffer
+		for _, item := range v {
+			if err := writeTNetString(&inner, item); err != nil {
+				return err
+			}
+		}
+		data, tag = inner.Bytes(), ']'
+	case map[string]any:
+		var inner bytes.Buffer
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			_ = writeTNetString(&inner, k)
+			if err := writeTNetString(&inner, v[k]); err != nil {
+				return err
+			}
+		}
+		data, tag = inner.Bytes(), '}'
+	default:
+		return fmt.Errorf("tnetstring: unsupported type %T", v)
+	}
+	buf.WriteString(strconv.Itoa(len(data)))
+	buf.WriteByte(':')
+	buf.Write(data)
+	buf.WriteByte(tag)
+	return nil
+}
+
+// readTNetString decodes the next value from r. It returns io.EOF only when
+// r is exhausted before a value starts.
+func readTNetString(r *bufio.Reader) (any, error) {
+	prefix, err := r.ReadSlice(':')
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(prefix) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("tnetstring: missing length prefix")
+	}
+	n, err := strconv.Atoi(string(bytes.TrimSpace(prefix[:len(prefix)-1])))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("tnetstring: invalid length %q", prefix[:len(prefix)-1])
+	}
+	data := make([]byte, n+1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("tnetstring: truncated value: %w", err)
+	}
+	return parseTNetString(data[:n], data[n])
+}
+
+func parseTNetString(data []byte, tag byte) (any, error) {
+	switch tag {
+	case ',':
+		return data, nil
+	case ';':
+		return string(data), nil
+	case '#':
+		return strconv.ParseInt(string(data), 10, 64)
+	case '^':
+		return strconv.ParseFloat(string(data), 64)
+	case '!':
+		return strconv.ParseBool(string(data))
+	case '~':
+		if len(data) != 0 {
+			return nil, fmt.Errorf("tnetstring: null with data")
+		}
+		return nil, nil
+	case ']':
+		list := []any{}
+		r := bufio.NewReader(bytes.NewReader(data))
+		for {
+			v, err := readTNetString(r)
+			if errors.Is(err, io.EOF) {
+				return list, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case '}':
+		dict := map[string]any{}
+		r := bufio.NewReader(bytes.NewReader(data))
+		for {
+			k, err := readTNetString(r)
+			if errors.Is(err, io.EOF) {
+				return dict, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := readTNetString(r)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = fmt.Errorf("tnetstring: dict key %q has no value", k)
+				}
+				return nil, err
+			}
+			switch k := k.(type) {
+			case string:
+				dict[k] = v
+			case []byte:
+				dict[string(k)] = v
+			default:
+				return nil, fmt.Errorf("tnetstring: dict key of type %T", k)
+			}
+		}
+	}
+	return nil, fmt.Errorf("tnetstring: unknown type %q", tag)
+}
@@ -0,0 +1,95 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// toggleAddons opens or closes the addon screen.
+func (a *App) toggleAddons() {
+	if a.mode == viewAddons {
+		a.mode = viewList
+		return
+	}
+	a.mode = viewAddons
+	a.renderAddons()
+	a.detail.GotoTop()
+}
+
+// updateAddons handles the addon screen's own keys and reports whether msg
+// was one of them.
+func (a *App) updateAddons(msg tea.KeyMsg) bool {
+	list := a.engine.Addons().List()
+	if len(list) == 0 {
+		return false
+	}
+	a.addonCursor = min(a.addonCursor, len(list)-1)
+	cur := list[a.addonCursor]
+	switch msg.String() {
+	case "up", "k":
+		a.addonCursor = max(a.addonCursor-1, 0)
+	case "down", "j":
+		a.addonCursor = min(a.addonCursor+1, len(list)-1)
+	case " ", "enter":
+		enabled := !cur.Enabled
+		a.patchAddon(proxy.AddonPatch{Name: cur.Name, Enabled: &enabled})
+		if enabled {
+			a.notify("Enabled addon " + cur.Name)
+		} else {
+			a.notify("Disabled addon " + cur.Name)
+		}
+	case "+", "-":
+		priority := cur.Priority + 1
+		if msg.String() == "-" {
+			priority = cur.Priority - 1
+		}
+		a.patchAddon(proxy.AddonPatch{Name: cur.Name, Priority: &priority})
+		// Keep the cursor on the addon as it moves through the order.
+		for i, info := range a.engine.Addons().List() {
+			if info.Name == cur.Name {
+				a.addonCursor = i
+			}
+		}
+	default:
+		return false
+	}
+	a.renderAddons()
+	return true
+}
+
+func (a *App) patchAddon(p proxy.AddonPatch) {
+	if err := a.engine.Addons().Patch(p); err != nil {
+		a.notify(err.Error())
+	}
+}
+
+func (a *App) renderAddons() {
+	a.detail.SetContent(renderAddons(a.engine.Addons().List(), a.addonCursor))
+}
+
+func renderAddons(list []proxy.AddonInfo, cursor int) string {
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Addons") + "  (run in this order)\n\n")
+	if len(list) == 0 {
+		b.WriteString(styleHelp.Render("no addons registered") + "\n")
+		return b.String()
+	}
+	b.WriteString(styleSectionTitle.Render(fmt.Sprintf("  %-20s %8s %-8s %s", "Name", "Priority", "State", "Hooks")) + "\n")
+	for i, info := range list {
+		marker := "  "
+		if i == cursor {
+			marker = styleKeyword.Render("▶ ")
+		}
+		state := fmt.Sprintf("%-8s", "on")
+		if !info.Enabled {
+			state = styleError.Render(fmt.Sprintf("%-8s", "off"))
+		}
+		b.WriteString(fmt.Sprintf("%s%-20s %8d %s %s\n",
+			marker, truncateStr(info.Name, 20), info.Priority, state, strings.Join(info.Hooks, ", ")))
+	}
+	return b.String()
+}
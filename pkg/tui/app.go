@@ -5,15 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/fidiego/http-proxy/pkg/curl"
 	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/format"
 	"github.com/fidiego/http-proxy/pkg/proxy"
 )
 
@@ -21,8 +26,18 @@ import (
 type viewMode int
 
 const (
-	viewList   viewMode = iota // flow list
-	viewDetail                 // request/response detail
+	viewList      viewMode = iota // flow list
+	viewDetail                    // request/response detail
+	viewEdit                      // edit a request before replaying it
+	viewDiff                      // diff of two flows
+	viewStats                     // per-upstream traffic statistics
+	viewAddons                    // registered addons
+	viewIntercept                 // flows paused by intercept
+	viewLogs                      // the proxy's log and upstream process output
+	viewOverrides                 // runtime header overrides
+	viewGroups                    // filtered flows grouped by request signature
+	viewNetwork                   // network simulation profiles
+	viewQR                        // QR code of the proxy's LAN address
 )
 
 // flowEventMsg wraps a proxy.FlowEvent for the Bubbletea message bus.
@@ -40,15 +55,49 @@ type App struct {
 	filterExpr   string
 	filterParsed filter.Filter
 
+	// Filter input history
+	filterHistory []string // this project's recent filters, oldest first
+	historyPos    int      // index into filterHistory; len means the draft
+	historyDraft  string   // input typed before stepping into the history
+
+	// Table layout
+	columns  []string            // visible column names, see columns
+	sortKey  string              // one of SortKeys
+	sortDesc bool                // sort descending
+	nums     map[*proxy.Flow]int // row numbers, by capture order
+
 	// View state
-	mode     viewMode
-	selected int // index in filtered
+	mode       viewMode
+	selected   int  // index in filtered
+	follow     bool // move the cursor to each new flow
+	detailTab  detailTab
+	tabOffsets [numTabs]int // scroll position of each detail tab
+	rawBody    bool         // show bodies unformatted
 
 	// Sub-models
 	table       table.Model
 	detail      viewport.Model
 	filterInput textinput.Model
 	filterMode  bool // is the filter input active?
+	promptInput textinput.Model
+	promptLabel string
+	promptFn    func(string) // handles the prompt's input; nil when closed
+	editor      textarea.Model
+	editID      string   // flow being edited in viewEdit
+	editReturn  viewMode // mode to return to when the editor closes
+	marked      string   // flow ID marked as the base for diffs
+	statsWindow int      // index into proxy.StatsWindows shown in viewStats
+	addonCursor int      // addon under the cursor in viewAddons
+	logsProcess string   // upstream whose output viewLogs shows; "" for all
+	logsProxy   bool     // viewLogs shows only the proxy's own log
+
+	interceptCursor int  // paused flow under the cursor in viewIntercept
+	overrideCursor  int  // header override under the cursor in viewOverrides
+	groupCursor     int  // request group under the cursor in viewGroups
+	networkCursor   int  // row under the cursor in viewNetwork; 0 is all upstreams
+	qrIndex         int  // LAN address shown in viewQR
+	editIntercepted bool // the editor changes a paused flow instead of replaying
+	editResponse    bool // with editIntercepted: the flow is paused at its response
 
 	// Layout
 	width  int
@@ -58,25 +107,17 @@ type App struct {
 	notice    string
 	noticeExp time.Time
 
-	webPort int
+	webPort    int
+	profile    string
+	sessionDir string
 }
 
 // New creates a new App, subscribing to the given engine's flow store.
-func New(engine *proxy.Engine, webPort int) *App {
+// opts must be valid (see Options.Validate).
+func New(engine *proxy.Engine, opts Options) *App {
 	eventCh := engine.Store().Subscribe()
 
-	cols := []table.Column{
-		{Title: "#", Width: 5},
-		{Title: "Method", Width: 8},
-		{Title: "Status", Width: 7},
-		{Title: "Upstream", Width: 12},
-		{Title: "Path", Width: 45},
-		{Title: "Time", Width: 7},
-		{Title: "Size", Width: 7},
-	}
-
 	t := table.New(
-		table.WithColumns(cols),
 		table.WithFocused(true),
 		table.WithHeight(20),
 	)
@@ -90,9 +131,12 @@ func New(engine *proxy.Engine, webPort int) *App {
 	fi.Placeholder = "filter expression (e.g. ~m POST & ~p /api)"
 	fi.CharLimit = 256
 
+	pi := textinput.New()
+	pi.CharLimit = 256
+
 	vp := viewport.New(80, 30)
 
-	return &App{
+	a := &App{
 		engine:       engine,
 		store:        engine.Store(),
 		eventCh:      eventCh,
@@ -100,8 +144,30 @@ func New(engine *proxy.Engine, webPort int) *App {
 		table:        t,
 		detail:       vp,
 		filterInput:  fi,
-		webPort:      webPort,
+		promptInput:  pi,
+		editor:       newEditor(),
+		columns:      opts.Columns,
+		sortKey:      strings.TrimPrefix(opts.Sort, "-"),
+		sortDesc:     strings.HasPrefix(opts.Sort, "-"),
+		webPort:      opts.WebPort,
+		profile:      opts.Profile,
+		sessionDir:   opts.SessionDir,
+		follow:       true,
+	}
+	if len(a.columns) == 0 {
+		a.columns = DefaultColumns
 	}
+	if a.sortKey == "" {
+		a.sortKey = "time"
+	}
+	a.table.SetColumns(a.tableColumns())
+	// Show flows already in the store, e.g. a session loaded by open.
+	a.allFlows = a.store.All()
+	a.applyFilter()
+	if opts.QR {
+		a.toggleQR()
+	}
+	return a
 }
 
 // Init satisfies tea.Model.
@@ -131,39 +197,146 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.applyEvent(proxy.FlowEvent(msg))
 		cmds = append(cmds, waitForFlowEvent(a.eventCh))
 
+	case statsTickMsg:
+		if a.mode == viewStats {
+			a.renderStats()
+			cmds = append(cmds, statsTick())
+		}
+
+	case groupsTickMsg:
+		if a.mode == viewGroups {
+			a.renderGroups()
+			cmds = append(cmds, groupsTick())
+		}
+
+	case logsTickMsg:
+		if a.mode == viewLogs {
+			a.renderLogs()
+			cmds = append(cmds, logsTick())
+		}
+
 	case tea.KeyMsg:
 		if a.filterMode {
 			return a.updateFilterInput(msg, cmds)
 		}
+		if a.promptFn != nil {
+			return a.updatePrompt(msg, cmds)
+		}
+		if a.mode == viewEdit {
+			return a.updateEditor(msg, cmds)
+		}
+		if a.mode == viewAddons && a.updateAddons(msg) {
+			return a, tea.Batch(cmds...)
+		}
+		if a.mode == viewDetail && a.updateDetail(msg) {
+			return a, tea.Batch(cmds...)
+		}
+		if a.mode == viewLogs && a.updateLogs(msg) {
+			return a, tea.Batch(cmds...)
+		}
+		if a.mode == viewGroups && a.updateGroups(msg) {
+			return a, tea.Batch(cmds...)
+		}
+		if a.mode == viewQR && a.updateQR(msg) {
+			return a, tea.Batch(cmds...)
+		}
+		if a.mode == viewNetwork && a.updateNetwork(msg) {
+			return a, tea.Batch(cmds...)
+		}
+		if a.mode == viewIntercept {
+			if ok, cmd := a.updateIntercept(msg); ok {
+				return a, tea.Batch(append(cmds, cmd)...)
+			}
+		}
+		if a.mode == viewOverrides {
+			if ok, cmd := a.updateOverrides(msg); ok {
+				return a, tea.Batch(append(cmds, cmd)...)
+			}
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return a, tea.Quit
 		case "enter":
 			if a.mode == viewList && len(a.filtered) > 0 {
-				a.mode = viewDetail
-				a.renderDetail()
+				a.openDetail()
 			}
 		case "esc", "backspace":
-			if a.mode == viewDetail {
+			if a.mode == viewDetail || a.mode == viewDiff || a.mode == viewStats || a.mode == viewAddons || a.mode == viewIntercept || a.mode == viewLogs || a.mode == viewOverrides || a.mode == viewGroups || a.mode == viewNetwork || a.mode == viewQR {
 				a.mode = viewList
 			}
+		case "s":
+			return a, a.toggleStats()
+		case "L":
+			return a, a.toggleLogs()
+		case "u":
+			return a, a.toggleGroups()
+		case "F":
+			a.toggleFollow()
+		case "o", "O":
+			if a.mode == viewList {
+				a.cycleSort(msg.String() == "O")
+			}
+		case "A":
+			a.toggleAddons()
+		case "i":
+			a.toggleIntercept()
+		case "H":
+			a.toggleOverrides()
+		case "N":
+			a.toggleNetwork()
+		case "Q":
+			a.toggleQR()
+		case "w":
+			if a.mode == viewStats {
+				a.nextStatsWindow()
+			}
+		case ":":
+			return a, a.openCommand()
 		case "f":
-			a.filterMode = true
-			a.filterInput.Focus()
-			return a, textinput.Blink
+			return a, a.openFilter()
+		case "v":
+			a.nextView()
+		case "V":
+			return a, a.saveView()
+		case "t":
+			return a, a.tagSelected()
+		case "a":
+			return a, a.annotateSelected()
+		case "p":
+			a.togglePin()
 		case "r":
 			a.replaySelected()
+		case "e":
+			return a, a.editSelected()
+		case "n":
+			return a, a.newRequest()
+		case "m":
+			a.toggleMark()
+		case "x":
+			a.diffSelected()
+		case "g", "G":
+			if a.mode == viewList || a.mode == viewDetail {
+				a.jumpReplay(msg.String() == "G")
+			}
 		case "c":
 			a.copyAsCURL()
+		case "X":
+			a.deleteSelected()
+		case "D":
+			a.deleteMatching()
 		case "d":
-			a.store.Clear()
-			a.allFlows = nil
-			a.filtered = nil
+			kept := a.store.Clear()
+			a.allFlows = a.store.All()
 			a.selected = 0
-			a.rebuildTable()
-			a.notify("Cleared all flows")
+			a.applyFilter()
+			if kept > 0 {
+				a.notify(fmt.Sprintf("Cleared unpinned flows (%d pinned kept)", kept))
+			} else {
+				a.notify("Cleared all flows")
+			}
 		case "up", "k":
 			if a.mode == viewList {
+				a.stopFollowing()
 				a.table, _ = a.table.Update(msg)
 			} else {
 				a.detail, _ = a.detail.Update(msg)
@@ -175,9 +348,12 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				a.detail, _ = a.detail.Update(msg)
 			}
 		case "pgup", "pgdown":
-			if a.mode == viewDetail {
+			if a.mode != viewList {
 				a.detail, _ = a.detail.Update(msg)
 			} else {
+				if msg.String() == "pgup" {
+					a.stopFollowing()
+				}
 				a.table, _ = a.table.Update(msg)
 			}
 		}
@@ -194,13 +370,20 @@ func (a *App) updateFilterInput(msg tea.KeyMsg, cmds []tea.Cmd) (tea.Model, tea.
 		if err != nil {
 			a.notify(fmt.Sprintf("invalid filter: %v", err))
 		} else {
-			a.filterExpr = expr
-			a.filterParsed = f
-			a.applyFilter()
+			a.setFilter(expr, f)
 			a.notify(fmt.Sprintf("filter: %s", expr))
+			if err := a.engine.AddFilterHistory(expr); err != nil {
+				a.notify(err.Error())
+			}
 		}
 		a.filterMode = false
 		a.filterInput.Blur()
+	case "up":
+		a.stepHistory(-1)
+	case "down":
+		a.stepHistory(+1)
+	case "tab":
+		a.completeFilter()
 	case "esc":
 		a.filterMode = false
 		a.filterInput.Blur()
@@ -222,9 +405,17 @@ func (a *App) View() string {
 
 	// Title bar
 	upstreams := a.upstreamNames()
+	follow := ""
+	if a.follow {
+		follow = "  following"
+	}
+	name := "http-proxy"
+	if a.profile != "" {
+		name += " [" + a.profile + "]"
+	}
 	title := styleStatusBar.Width(a.width).Render(
-		fmt.Sprintf(" http-proxy  %s  %d flows  web: http://localhost:%d",
-			upstreams, a.store.Count(), a.webPort),
+		fmt.Sprintf(" %s  %s  %d flows%s  web: http://localhost:%d",
+			name, upstreams, a.store.Count(), follow, a.webPort),
 	)
 	b.WriteString(title)
 	b.WriteString("\n")
@@ -234,8 +425,11 @@ func (a *App) View() string {
 	switch a.mode {
 	case viewList:
 		b.WriteString(a.viewList(contentHeight))
-	case viewDetail:
+	case viewDetail, viewDiff, viewStats, viewAddons, viewIntercept, viewLogs, viewOverrides, viewGroups, viewNetwork, viewQR:
 		b.WriteString(a.viewDetailPane(contentHeight))
+	case viewEdit:
+		a.editor.SetHeight(contentHeight)
+		b.WriteString(a.editor.View())
 	}
 
 	// Filter bar
@@ -244,6 +438,11 @@ func (a *App) View() string {
 		b.WriteString(styleDivider.Render(strings.Repeat("─", a.width)))
 		b.WriteString("\n")
 		b.WriteString(styleHelp.Render(" Filter: ") + a.filterInput.View())
+	} else if a.promptFn != nil {
+		b.WriteString("\n")
+		b.WriteString(styleDivider.Render(strings.Repeat("─", a.width)))
+		b.WriteString("\n")
+		b.WriteString(styleHelp.Render(" "+a.promptLabel) + a.promptInput.View())
 	}
 
 	// Notice / help bar
@@ -251,13 +450,62 @@ func (a *App) View() string {
 	if a.notice != "" && time.Now().Before(a.noticeExp) {
 		b.WriteString(styleHelp.Width(a.width).Render(" " + a.notice))
 	} else {
-		if a.mode == viewList {
+		switch a.mode {
+		case viewList:
 			b.WriteString(styleHelp.Width(a.width).Render(
-				" [f]ilter [r]eplay [c]url [d]clear [q]uit  ↑↓ navigate  ⏎ detail",
+				" [f]ilter [F]ollow [o]rder [O]reverse [v]iew [V]save view [t]ag [a]nnotate [p]in [r]eplay [e]dit [n]ew [m]ark [x]diff [c]url [X]delete [D]delete matching [s]tats gro[u]ps [L]ogs [A]ddons [i]ntercept [H]eaders [N]etwork [Q]R [d]clear [:w] save [q]uit  ↑↓ navigate  ⏎ detail",
 			))
-		} else {
+		case viewDetail:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc] back  [h/l/1-3] tab  [b] raw/pretty  [t]ag  [a]nnotate  [p]in  [r]eplay  [e]dit  [x]diff  [c]url  [X]delete  ↑↓/PgUp/PgDn scroll",
+			))
+		case viewDiff:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc] back  ↑↓/PgUp/PgDn scroll",
+			))
+		case viewStats:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[s] back  [w]indow  ↑↓/PgUp/PgDn scroll",
+			))
+		case viewLogs:
 			b.WriteString(styleHelp.Width(a.width).Render(
-				" [esc] back  [r]eplay  [c]url  ↑↓/PgUp/PgDn scroll",
+				" [esc]/[L] back  [tab] source  [R]estart  ↑↓/PgUp/PgDn scroll",
+			))
+		case viewAddons:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[A] back  ↑↓ select  [space] enable/disable  [+]/[-] priority",
+			))
+		case viewIntercept:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[i] back  ↑↓ select  [a] resume  [x] kill  [e]dit  [I] intercept on/off  " +
+					"[b]/[B] break on requests/responses  [c]lear breakpoints",
+			))
+		case viewOverrides:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[H] back  ↑↓ select  [a]dd  [x] remove",
+			))
+		case viewGroups:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[u] back  ↑↓ select  ⏎ newest flow",
+			))
+		case viewNetwork:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[N] back  ↑↓ select  [space] next profile  [x] off",
+			))
+		case viewQR:
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" [esc]/[Q] back  [tab] next address  ↑↓/PgUp/PgDn scroll",
+			))
+		case viewEdit:
+			what := "editing request"
+			if a.editResponse {
+				what = "editing response"
+			}
+			if a.editID == "" {
+				what = "new request (raw HTTP or curl command)"
+			}
+			b.WriteString(styleHelp.Width(a.width).Render(
+				" " + what + "  [ctrl+s] send  [esc] cancel",
 			))
 		}
 	}
@@ -284,12 +532,49 @@ func (a *App) applyEvent(evt proxy.FlowEvent) {
 			a.filtered = append(a.filtered, evt.Flow)
 		}
 		a.rebuildTable()
-	case proxy.FlowEventComplete, proxy.FlowEventUpdate, proxy.FlowEventError:
+		if a.follow && a.mode == viewList {
+			if i := slices.Index(a.filtered, evt.Flow); i >= 0 {
+				a.table.SetCursor(i)
+			}
+		}
+	case proxy.FlowEventRequest, proxy.FlowEventComplete, proxy.FlowEventUpdate, proxy.FlowEventError:
 		// Flow was already added; refresh the table row.
 		a.rebuildTable()
 		if a.mode == viewDetail {
 			a.renderDetail()
 		}
+		if a.mode == viewIntercept {
+			a.renderIntercept()
+		}
+	case proxy.FlowEventDelete:
+		a.allFlows = a.store.All()
+		a.applyFilter()
+		if a.mode == viewDetail {
+			a.mode = viewList
+		}
+	case proxy.FlowEventEvict:
+		// Evictions happen as new flows arrive, so keep the cursor where it
+		// was unless its flow is the one gone.
+		selected := a.selectedFlow()
+		a.allFlows = a.store.All()
+		a.applyFilter()
+		if i := slices.Index(a.filtered, selected); i >= 0 {
+			a.table.SetCursor(i)
+		} else if a.mode == viewDetail {
+			a.mode = viewList
+		}
+	case proxy.FlowEventReload:
+		a.notify(evt.Message)
+	case proxy.FlowEventUpstream:
+		a.notify(evt.Message)
+	case proxy.FlowEventProcess:
+		a.notify(evt.Message)
+		if a.mode == viewLogs {
+			a.renderLogs()
+		}
+	case proxy.FlowEventJob:
+		j := evt.Job
+		a.notify(fmt.Sprintf("replay job: %d/%d done, %d failed (%s)", j.Done, j.Total, j.Failed, j.State))
 	}
 }
 
@@ -304,28 +589,59 @@ func (a *App) applyFilter() {
 	a.rebuildTable()
 }
 
-// rebuildTable refreshes the table rows from the filtered flow slice.
+// rebuildTable sorts the filtered flow slice and refreshes the table rows
+// from it, keeping the cursor on the selected flow.
 func (a *App) rebuildTable() {
+	selected := a.selectedFlow()
+	a.sortFiltered()
 	rows := make([]table.Row, 0, len(a.filtered))
-	for i, f := range a.filtered {
-		n := fmt.Sprintf("%d", i+1)
-		method := f.Request.Method
-		status := "-"
-		size := "-"
-		if f.Response != nil {
-			status = fmt.Sprintf("%d", f.Response.StatusCode)
-			size = formatSize(len(f.Response.Body))
-		} else if f.State == proxy.FlowStateError {
-			status = "ERR"
-		}
-		dur := formatDur(f.Duration())
-		path := f.Request.Path
-		if p := f.Request.URL; p != "" && len(p) > len(path) {
-			// include query string if it fits
-		}
-		rows = append(rows, table.Row{n, method, status, f.Upstream, path, dur, size})
+	for _, f := range a.filtered {
+		row := make(table.Row, len(a.columns))
+		for i, name := range a.columns {
+			row[i] = columns[name].cell(a.nums[f], f)
+		}
+		rows = append(rows, row)
 	}
 	a.table.SetRows(rows)
+	if selected != nil {
+		if i := slices.Index(a.filtered, selected); i >= 0 {
+			a.table.SetCursor(i)
+		}
+	}
+}
+
+// toggleFollow turns follow mode on or off. Turning it on jumps to the
+// newest flow.
+func (a *App) toggleFollow() {
+	a.follow = !a.follow
+	if !a.follow {
+		a.notify("follow off: the cursor stays on the selected flow")
+		return
+	}
+	if n := len(a.allFlows); n > 0 {
+		if i := slices.Index(a.filtered, a.allFlows[n-1]); i >= 0 {
+			a.table.SetCursor(i)
+		}
+	}
+	a.notify("follow on: the cursor moves to each new flow")
+}
+
+// stopFollowing turns follow mode off when the user moves up to inspect
+// older flows.
+func (a *App) stopFollowing() {
+	if a.follow {
+		a.follow = false
+		a.notify("follow off ([F] resumes)")
+	}
+}
+
+// selectedFlow returns the flow under the table cursor, or nil.
+func (a *App) selectedFlow() *proxy.Flow {
+	cursor := a.table.Cursor()
+	if cursor < 0 || cursor >= len(a.filtered) {
+		return nil
+	}
+	return a.filtered[cursor]
 }
 
 // renderDetail fills the viewport with request/response detail for the selected flow.
@@ -336,7 +652,7 @@ func (a *App) renderDetail() {
 		return
 	}
 	f := a.filtered[cursor]
-	a.detail.SetContent(renderFlowDetail(f, a.width))
+	a.detail.SetContent(renderFlowDetail(f, a.width, a.detailTab, a.rawBody))
 }
 
 // replaySelected replays the currently selected flow.
@@ -357,7 +673,6 @@ func (a *App) replaySelected() {
 }
 
 // copyAsCURL copies the selected flow as a cURL command.
-// (Writes to the notice bar; actual clipboard integration is OS-specific.)
 func (a *App) copyAsCURL() {
 	cursor := a.table.Cursor()
 	if cursor < 0 || cursor >= len(a.filtered) {
@@ -365,7 +680,7 @@ func (a *App) copyAsCURL() {
 		return
 	}
 	f := a.filtered[cursor]
-	a.notify(toCURL(f))
+	a.notify(copyText(toCURL(f), "cURL command", ".sh"))
 }
 
 // notify sets a brief status notice.
@@ -378,15 +693,22 @@ func (a *App) notify(msg string) {
 func (a *App) resize() {
 	cols := a.table.Columns()
 	// Give extra width to the path column.
-	extra := a.width - 5 - 8 - 7 - 12 - 7 - 7 - 10 // approx fixed cols
-	if extra > 20 {
-		cols[4].Width = extra
+	path, fixed := slices.Index(a.columns, "path"), 0
+	for i, name := range a.columns {
+		if i != path {
+			fixed += columns[name].width
+		}
+	}
+	if extra := a.width - fixed - len(cols) - 3; path >= 0 && extra > 20 {
+		cols[path].Width = extra
 	}
 	a.table.SetColumns(cols)
 	a.table.SetHeight(a.height - 4)
 	a.detail.Width = a.width
 	a.detail.Height = a.height - 4
 	a.filterInput.Width = a.width - 12
+	a.promptInput.Width = a.width - 24
+	a.editor.SetWidth(a.width)
 }
 
 // upstreamNames returns a compact upstream list for the title bar.
@@ -400,8 +722,8 @@ func (a *App) upstreamNames() string {
 }
 
 // Run starts the Bubbletea program, blocking until the user quits.
-func Run(ctx context.Context, engine *proxy.Engine, webPort int) error {
-	app := New(engine, webPort)
+func Run(ctx context.Context, engine *proxy.Engine, opts Options) error {
+	app := New(engine, opts)
 	p := tea.NewProgram(app, tea.WithAltScreen())
 
 	// Stop the program when context is cancelled.
@@ -417,111 +739,103 @@ func Run(ctx context.Context, engine *proxy.Engine, webPort int) error {
 
 // --- helpers ---
 
-func renderFlowDetail(f *proxy.Flow, width int) string {
+func renderRequest(f *proxy.Flow, width int, raw bool) string {
+	if f.Request == nil {
+		return ""
+	}
 	var b strings.Builder
-	half := (width - 3) / 2
-
-	// Header
-	statusStr := "-"
-	if f.Response != nil {
-		col := statusColor(f.Response.StatusCode)
-		statusStr = lipgloss.NewStyle().Foreground(col).Bold(true).
-			Render(fmt.Sprintf("%d", f.Response.StatusCode))
-	} else if f.State == proxy.FlowStateError {
-		statusStr = styleError.Render("ERR")
-	}
-
-	title := fmt.Sprintf("%s %s  →  %s  [%s]  %s",
-		styleKeyword.Render(f.Request.Method),
-		f.Request.Path,
-		f.Upstream,
-		formatDur(f.Duration()),
-		statusStr,
-	)
-	b.WriteString(title)
-	b.WriteString("\n")
-	b.WriteString(styleDivider.Render(strings.Repeat("─", width)))
+	b.WriteString(styleKeyword.Render(f.Request.Method) + " " + f.Request.URL)
 	b.WriteString("\n")
-
-	// Tags
-	if len(f.Tags) > 0 {
-		for _, t := range f.Tags {
-			b.WriteString(styleTag.Render(t) + " ")
+	for k, vv := range f.Request.Headers {
+		for _, v := range vv {
+			b.WriteString(styleGray(k+": ") + truncateStr(v, width-len(k)-4))
+			b.WriteString("\n")
 		}
-		b.WriteString("\n\n")
 	}
-
-	// Two-column layout: request | response
-	reqCol := renderRequest(f, half)
-	respCol := renderResponse(f, half)
-
-	sep := styleDivider.Render("│")
-	reqLines := strings.Split(reqCol, "\n")
-	respLines := strings.Split(respCol, "\n")
-	maxLines := len(reqLines)
-	if len(respLines) > maxLines {
-		maxLines = len(respLines)
+	if params := f.Request.QueryParams(); len(params) > 0 {
+		b.WriteString("\n" + styleKeyword.Render("Query") + "\n")
+		for _, p := range params {
+			b.WriteString(styleGray(p.Name+" = ") + truncateStr(p.Value, width-len(p.Name)-4) + "\n")
+		}
 	}
-
-	colStyle := lipgloss.NewStyle().Width(half)
-	for i := 0; i < maxLines; i++ {
-		rl := ""
-		if i < len(reqLines) {
-			rl = reqLines[i]
+	if cookies := f.Request.Cookies(); len(cookies) > 0 {
+		b.WriteString("\n" + styleKeyword.Render("Cookies") + "\n")
+		for _, c := range cookies {
+			b.WriteString(styleGray(c.Name+" = ") + truncateStr(c.Value, width-len(c.Name)-4) + "\n")
 		}
-		sl := ""
-		if i < len(respLines) {
-			sl = respLines[i]
+	}
+	b.WriteString(renderConnection(f, width))
+	b.WriteString(renderTrailers(f.Request.Trailers, width))
+	b.WriteString(renderMeta(f.Meta))
+	reqBody := f.Request.ReadBody()
+	if len(reqBody) > 0 && !raw && f.Request.IsMultipart() {
+		b.WriteString("\n")
+		b.WriteString(renderParts(f.Request, width))
+		if f.Request.BodyTruncated {
+			b.WriteString(styleError.Render(fmt.Sprintf("\n… (truncated, %d bytes total)", f.Request.Size)))
 		}
-		b.WriteString(colStyle.Render(rl))
-		b.WriteString(sep)
-		b.WriteString(colStyle.Render(sl))
+	} else if len(reqBody) > 0 {
 		b.WriteString("\n")
+		body := prettyBody(format.Body{
+			ContentType: f.Request.Headers.Get("Content-Type"),
+			Data:        reqBody,
+			Path:        f.Request.Path,
+		}, raw)
+		b.WriteString(body)
+		if f.Request.BodyTruncated {
+			b.WriteString(styleError.Render(fmt.Sprintf("\n… (truncated, %d bytes total)", f.Request.Size)))
+		}
+	} else if f.Request.BodyTruncated {
+		b.WriteString(styleHelp.Render(fmt.Sprintf("\n(body not captured, %d bytes)", f.Request.Size)))
 	}
-
 	return b.String()
 }
 
-func renderRequest(f *proxy.Flow, width int) string {
-	if f.Request == nil {
+// renderConnection shows where the request came from and went.
+func renderConnection(f *proxy.Flow, width int) string {
+	var b strings.Builder
+	for _, kv := range [][2]string{
+		{"client", f.Request.RemoteAddr},
+		{"protocol", f.Request.Proto},
+		{"target", f.TargetURL},
+		{"size", sizeBreakdown(f.Request.HeadersSize, max(f.Request.Size, int64(len(f.Request.Body))))},
+	} {
+		if kv[1] != "" {
+			b.WriteString(styleGray(kv[0]+": ") + truncateStr(kv[1], width-len(kv[0])-4) + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n" + styleKeyword.Render("Connection") + "\n" + b.String()
+}
+
+func renderTrailers(h http.Header, width int) string {
+	if len(h) == 0 {
 		return ""
 	}
 	var b strings.Builder
-	b.WriteString(styleSectionTitle.Width(width).Render("Request"))
-	b.WriteString("\n")
-	b.WriteString(styleKeyword.Render(f.Request.Method) + " " + f.Request.URL)
-	b.WriteString("\n")
-	for k, vv := range f.Request.Headers {
+	b.WriteString("\n" + styleKeyword.Render("Trailers") + "\n")
+	for k, vv := range h {
 		for _, v := range vv {
-			b.WriteString(styleGray(k+": ") + truncateStr(v, width-len(k)-4))
-			b.WriteString("\n")
-		}
-	}
-	if len(f.Request.Body) > 0 {
-		b.WriteString("\n")
-		body := prettyBody(f.Request.Headers.Get("Content-Type"), f.Request.Body)
-		b.WriteString(body)
-		if f.Request.BodyTruncated {
-			b.WriteString(styleError.Render("\n… (truncated)"))
+			b.WriteString(styleGray(k+": ") + truncateStr(v, width-len(k)-4) + "\n")
 		}
 	}
 	return b.String()
 }
 
-func renderResponse(f *proxy.Flow, width int) string {
+func renderResponse(f *proxy.Flow, width int, raw bool) string {
 	if f.Response == nil {
 		if f.Error != "" {
-			return styleSectionTitle.Width(width).Render("Response") + "\n" +
-				styleError.Render("Error: "+f.Error)
+			return styleError.Render("Error: " + f.Error)
 		}
-		return styleSectionTitle.Width(width).Render("Response") + "\n(pending)"
+		return "(pending)"
 	}
 	var b strings.Builder
 	col := statusColor(f.Response.StatusCode)
-	b.WriteString(styleSectionTitle.Width(width).Render("Response"))
-	b.WriteString("\n")
 	b.WriteString(lipgloss.NewStyle().Foreground(col).Bold(true).
 		Render(fmt.Sprintf("%d", f.Response.StatusCode)))
+	b.WriteString("  " + styleGray(sizeBreakdown(f.Response.HeadersSize, max(f.Response.Size, int64(len(f.Response.Body))))))
 	b.WriteString("\n")
 	for k, vv := range f.Response.Headers {
 		for _, v := range vv {
@@ -529,33 +843,123 @@ func renderResponse(f *proxy.Flow, width int) string {
 			b.WriteString("\n")
 		}
 	}
-	if len(f.Response.Body) > 0 {
+	if cookies := f.Response.SetCookies(); len(cookies) > 0 {
+		b.WriteString("\n" + styleKeyword.Render("Set-Cookie") + "\n")
+		for _, c := range cookies {
+			b.WriteString(styleGray(c.Name+" = ") + truncateStr(c.Value, width-len(c.Name)-4) + "\n")
+			if attrs := cookieAttrs(c); attrs != "" {
+				b.WriteString("  " + styleGray(truncateStr(attrs, width-2)) + "\n")
+			}
+		}
+	}
+	b.WriteString(renderTrailers(f.Response.Trailers, width))
+	if respBody := f.Response.ReadBody(); len(respBody) > 0 {
 		b.WriteString("\n")
-		body := prettyBody(f.Response.Headers.Get("Content-Type"), f.Response.Body)
+		body := prettyBody(format.Body{
+			ContentType: f.Response.Headers.Get("Content-Type"),
+			Data:        respBody,
+			Path:        f.Request.Path,
+			Response:    true,
+		}, raw)
 		b.WriteString(body)
 		if f.Response.BodyTruncated {
-			b.WriteString(styleError.Render("\n… (truncated)"))
+			b.WriteString(styleError.Render(fmt.Sprintf("\n… (truncated, %d bytes total)", f.Response.Size)))
 		}
+	} else if f.Response.BodyTruncated {
+		b.WriteString(styleHelp.Render(fmt.Sprintf("\n(body not captured, %d bytes)", f.Response.Size)))
 	}
 	return b.String()
 }
 
-// prettyBody formats a body based on content type.
-func prettyBody(contentType string, body []byte) string {
-	ct := strings.ToLower(contentType)
-	if strings.Contains(ct, "json") {
-		var v interface{}
-		if err := json.Unmarshal(body, &v); err == nil {
-			pretty, err := json.MarshalIndent(v, "", "  ")
-			if err == nil {
-				return string(pretty)
-			}
+// renderMeta shows addon data (e.g. decoded JWTs) as indented JSON, one
+// section per key.
+func renderMeta(meta map[string]any) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		data, err := json.MarshalIndent(meta[k], "", "  ")
+		if err != nil {
+			continue
+		}
+		b.WriteString("\n" + styleKeyword.Render(strings.ToUpper(k)) + "\n")
+		b.WriteString(string(data) + "\n")
+	}
+	return b.String()
+}
+
+// cookieAttrs summarises a Set-Cookie's attributes, e.g.
+// "Path=/ HttpOnly Secure SameSite=Lax".
+func cookieAttrs(c proxy.Cookie) string {
+	var attrs []string
+	if c.Domain != "" {
+		attrs = append(attrs, "Domain="+c.Domain)
+	}
+	if c.Path != "" {
+		attrs = append(attrs, "Path="+c.Path)
+	}
+	if !c.Expires.IsZero() {
+		attrs = append(attrs, "Expires="+c.Expires.Format(time.RFC1123))
+	}
+	if c.MaxAge != 0 {
+		attrs = append(attrs, fmt.Sprintf("Max-Age=%d", c.MaxAge))
+	}
+	if c.HttpOnly {
+		attrs = append(attrs, "HttpOnly")
+	}
+	if c.Secure {
+		attrs = append(attrs, "Secure")
+	}
+	if c.SameSite != "" {
+		attrs = append(attrs, "SameSite="+c.SameSite)
+	}
+	return strings.Join(attrs, " ")
+}
+
+// renderParts lists the parts of a multipart body instead of the raw blob.
+func renderParts(req *proxy.CapturedRequest, width int) string {
+	parts, err := req.Parts()
+	var b strings.Builder
+	b.WriteString(styleGray(fmt.Sprintf("%d parts", len(parts))))
+	for _, p := range parts {
+		line := p.Name
+		if p.Filename != "" {
+			line += " (" + p.Filename + ")"
+		}
+		if p.ContentType != "" {
+			line += " " + p.ContentType
+		}
+		line += fmt.Sprintf(" %dB", p.Size)
+		if p.Truncated {
+			line += " (truncated)"
+		}
+		b.WriteString("\n  " + styleKeyword.Render("•") + " " + truncateStr(line, width-4))
+	}
+	if err != nil {
+		b.WriteString("\n" + styleError.Render(err.Error()))
+	}
+	return b.String()
+}
+
+// prettyBody formats a body with the formatter for its content type. raw
+// returns it as is.
+func prettyBody(body format.Body, raw bool) string {
+	if raw {
+		return string(body.Data)
+	}
+	if text, name, ok := format.Format(body); ok {
+		if name == "json" {
+			return text
 		}
+		return styleGray("formatted as "+name) + "\n" + text
 	}
 	// Fallback: return as string, truncated.
-	s := string(body)
+	s := string(body.Data)
 	if len(s) > 2000 {
-		s = s[:2000] + "…"
+		s = s[:2000] + "… ([b] shows the raw body)"
 	}
 	return s
 }
@@ -564,6 +968,46 @@ func styleGray(s string) string {
 	return lipgloss.NewStyle().Foreground(colorGray).Render(s)
 }
 
+// renderTimings draws the timing phases as a waterfall: one row per phase,
+// with a bar offset by the phases before it.
+func renderTimings(t *proxy.Timings, width int) string {
+	phases := []struct {
+		name string
+		ms   float64
+	}{
+		{"proxy", t.Proxy}, {"blocked", t.Blocked}, {"dns", t.DNS}, {"connect", t.Connect},
+		{"tls", t.TLS}, {"send", t.Send}, {"wait", t.Wait}, {"receive", t.Receive},
+	}
+	var total float64
+	for _, p := range phases {
+		total += p.ms
+	}
+	barWidth := max(10, min(60, width-24))
+
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Timings"))
+	if t.Reused {
+		b.WriteString(styleHelp.Render("  (reused connection)"))
+	}
+	b.WriteString("\n")
+	var offset float64
+	for _, p := range phases {
+		if p.ms <= 0 {
+			continue
+		}
+		pad, n := 0, 1
+		if total > 0 {
+			pad = int(offset / total * float64(barWidth))
+			n = max(1, int(p.ms/total*float64(barWidth)))
+		}
+		b.WriteString(fmt.Sprintf("  %-8s %s%s %s\n", p.name,
+			strings.Repeat(" ", pad), styleKeyword.Render(strings.Repeat("█", n)),
+			formatDur(time.Duration(p.ms*float64(time.Millisecond)))))
+		offset += p.ms
+	}
+	return b.String()
+}
+
 func truncateStr(s string, max int) string {
 	if max <= 0 || len(s) <= max {
 		return s
@@ -582,6 +1026,12 @@ func formatDur(d time.Duration) string {
 	}
 }
 
+// sizeBreakdown describes a message's length on the wire: the total, then
+// its headers and body.
+func sizeBreakdown(headers, body int64) string {
+	return fmt.Sprintf("%s (%s headers + %s body)", formatSize(int(headers+body)), formatSize(int(headers)), formatSize(int(body)))
+}
+
 func formatSize(n int) string {
 	switch {
 	case n == 0:
@@ -600,21 +1050,5 @@ func toCURL(f *proxy.Flow) string {
 	if f.Request == nil {
 		return ""
 	}
-	var b strings.Builder
-	b.WriteString(fmt.Sprintf("curl -X %s '%s'", f.Request.Method, f.Request.URL))
-	for k, vv := range f.Request.Headers {
-		// Skip hop-by-hop headers.
-		lk := strings.ToLower(k)
-		if lk == "connection" || lk == "transfer-encoding" {
-			continue
-		}
-		for _, v := range vv {
-			b.WriteString(fmt.Sprintf(" \\\n  -H '%s: %s'", k, v))
-		}
-	}
-	if len(f.Request.Body) > 0 {
-		body := strings.ReplaceAll(string(f.Request.Body), "'", "'\\''")
-		b.WriteString(fmt.Sprintf(" \\\n  -d '%s'", body))
-	}
-	return b.String()
+	return curl.Command(f.Request)
 }
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/atotto/clipboard"
+	"github.com/muesli/termenv"
+)
+
+// copyText puts s on the clipboard and returns a notice saying where it went.
+//
+// The system clipboard (pbcopy, xclip, xsel, wl-copy, or the Windows API) is
+// tried first. Without one, e.g. over SSH, s is sent to the terminal as an
+// OSC 52 sequence, which most terminals turn into a clipboard write, and also
+// saved to a temp file in case the terminal ignores it.
+func copyText(s, what, ext string) string {
+	if err := clipboard.WriteAll(s); err == nil {
+		return "copied " + what + " to the clipboard"
+	}
+	termenv.Copy(s)
+	f, err := os.CreateTemp("", "http-proxy-*"+ext)
+	if err != nil {
+		return "sent " + what + " to the terminal clipboard (OSC 52)"
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s + "\n"); err != nil {
+		return "sent " + what + " to the terminal clipboard (OSC 52)"
+	}
+	return fmt.Sprintf("sent %s to the terminal clipboard (OSC 52); also saved to %s", what, f.Name())
+}
@@ -0,0 +1,226 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// Options configures the TUI.
+type Options struct {
+	// WebPort is shown in the title bar.
+	WebPort int
+
+	// Profile names the profile the proxy runs with, shown in the title bar.
+	Profile string
+
+	// QR opens the pairing screen (see toggleQR) at startup.
+	QR bool
+
+	// SessionDir, if set, is where :w saves when no file is named, as a new
+	// timestamped file, rather than session.hpz in the working directory.
+	SessionDir string
+
+	// Columns lists the flow table's columns in order (default
+	// DefaultColumns). See ColumnNames for the choices.
+	Columns []string
+
+	// Sort is the initial sort key (see SortKeys), prefixed with "-" for
+	// descending. Empty sorts by capture time.
+	Sort string
+}
+
+// DefaultColumns are the flow table columns shown when none are configured.
+var DefaultColumns = []string{"num", "method", "status", "upstream", "path", "duration", "size"}
+
+// SortKeys are the orders the flow table cycles through with o.
+var SortKeys = []string{"time", "duration", "status", "size"}
+
+// column is one flow table column. num is the flow's position in the
+// filtered list in capture order.
+type column struct {
+	title string
+	width int
+	cell  func(num int, f *proxy.Flow) string
+}
+
+var columns = map[string]column{
+	"num": {"#", 5, func(num int, f *proxy.Flow) string {
+		if f.Pinned {
+			return "★" + strconv.Itoa(num)
+		}
+		return strconv.Itoa(num)
+	}},
+	"method":   {"Method", 8, func(_ int, f *proxy.Flow) string { return f.Request.Method }},
+	"status":   {"Status", 8, func(_ int, f *proxy.Flow) string { return alertMark(f, "status") + flowStatus(f) }},
+	"upstream": {"Upstream", 12, func(_ int, f *proxy.Flow) string { return f.Upstream }},
+	"host":     {"Host", 20, func(_ int, f *proxy.Flow) string { return f.Request.Host }},
+	"path":     {"Path", 45, func(_ int, f *proxy.Flow) string { return f.Request.Path }},
+	"duration": {"Time", 7, func(_ int, f *proxy.Flow) string { return alertMark(f, "latency") + formatDur(f.Duration()) }},
+	"size": {"Size", 7, func(_ int, f *proxy.Flow) string {
+		if f.Response == nil {
+			return "-"
+		}
+		return formatSize(int(responseSize(f)))
+	}},
+	"type": {"Type", 18, func(_ int, f *proxy.Flow) string {
+		if f.Response == nil {
+			return ""
+		}
+		ct, _, _ := strings.Cut(f.Response.Headers.Get("Content-Type"), ";")
+		return ct
+	}},
+	"started": {"Started", 12, func(_ int, f *proxy.Flow) string {
+		return f.Timestamps.Created.Local().Format("15:04:05.000")
+	}},
+	"tags": {"Tags", 16, func(_ int, f *proxy.Flow) string { return strings.Join(f.Tags, " ") }},
+}
+
+// ColumnNames returns the names accepted in Options.Columns.
+func ColumnNames() []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// sortColumn is the column whose title shows the sort direction.
+var sortColumn = map[string]string{
+	"time":     "started",
+	"duration": "duration",
+	"status":   "status",
+	"size":     "size",
+}
+
+// Validate checks the column names and sort key.
+func (o Options) Validate() error {
+	for _, name := range o.Columns {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("unknown column %q (want one of %s)", name, strings.Join(ColumnNames(), ", "))
+		}
+	}
+	if key := strings.TrimPrefix(o.Sort, "-"); key != "" && !slices.Contains(SortKeys, key) {
+		return fmt.Errorf("unknown sort %q (want one of %s)", o.Sort, strings.Join(SortKeys, ", "))
+	}
+	return nil
+}
+
+// flowStatus is the status cell: the response code, or the flow's state.
+func flowStatus(f *proxy.Flow) string {
+	switch {
+	case f.Response != nil:
+		return strconv.Itoa(f.Response.StatusCode)
+	case f.State == proxy.FlowStateError:
+		return "ERR"
+	case f.State == proxy.FlowStateIntercepted:
+		return "PAUSE"
+	case f.Pending():
+		return "PENDING"
+	}
+	return "-"
+}
+
+// alertMark is "!" if the flow raised the given alert ("latency" or
+// "status"), to prefix the cell that broke the threshold. The table can't
+// color single cells, so the mark stands in for it.
+func alertMark(f *proxy.Flow, reason string) string {
+	if slices.Contains(f.Tags, "alert:"+reason) {
+		return "!"
+	}
+	return ""
+}
+
+// responseSize is the response's full length on the wire, headers
+// included, even when the captured body was truncated.
+func responseSize(f *proxy.Flow) int64 {
+	if f.Response == nil {
+		return 0
+	}
+	return f.Response.WireSize()
+}
+
+// tableColumns builds the table's column headers, marking the sorted column.
+func (a *App) tableColumns() []table.Column {
+	cols := make([]table.Column, len(a.columns))
+	for i, name := range a.columns {
+		c := columns[name]
+		cols[i] = table.Column{Title: c.title, Width: c.width}
+		if name == sortColumn[a.sortKey] && (a.sortKey != "time" || a.sortDesc) {
+			if a.sortDesc {
+				cols[i].Title += " ↓"
+			} else {
+				cols[i].Title += " ↑"
+			}
+		}
+	}
+	return cols
+}
+
+// sortFiltered orders the filtered flows by the current sort key. Ties, and
+// the time sort, keep capture order.
+func (a *App) sortFiltered() {
+	order := make(map[*proxy.Flow]int, len(a.allFlows))
+	for i, f := range a.allFlows {
+		order[f] = i
+	}
+	slices.SortStableFunc(a.filtered, func(x, y *proxy.Flow) int {
+		return cmp.Compare(order[x], order[y])
+	})
+	a.nums = make(map[*proxy.Flow]int, len(a.filtered))
+	for i, f := range a.filtered {
+		a.nums[f] = i + 1
+	}
+	var key func(*proxy.Flow) int64
+	switch a.sortKey {
+	case "duration":
+		key = func(f *proxy.Flow) int64 { return int64(f.Duration()) }
+	case "status":
+		key = func(f *proxy.Flow) int64 {
+			if f.Response == nil {
+				return 0
+			}
+			return int64(f.Response.StatusCode)
+		}
+	case "size":
+		key = responseSize
+	}
+	switch {
+	case key != nil:
+		slices.SortStableFunc(a.filtered, func(x, y *proxy.Flow) int {
+			if a.sortDesc {
+				return cmp.Compare(key(y), key(x))
+			}
+			return cmp.Compare(key(x), key(y))
+		})
+	case a.sortDesc:
+		slices.Reverse(a.filtered)
+	}
+}
+
+// cycleSort switches to the next sort key, largest first except for time;
+// reverse flips the direction of the current one instead.
+func (a *App) cycleSort(reverse bool) {
+	if reverse {
+		a.sortDesc = !a.sortDesc
+	} else {
+		i := slices.Index(SortKeys, a.sortKey)
+		a.sortKey = SortKeys[(i+1)%len(SortKeys)]
+		a.sortDesc = a.sortKey != "time"
+	}
+	a.table.SetColumns(a.tableColumns())
+	a.resize()
+	a.rebuildTable()
+	dir := "ascending"
+	if a.sortDesc {
+		dir = "descending"
+	}
+	a.notify(fmt.Sprintf("sort: %s, %s", a.sortKey, dir))
+}
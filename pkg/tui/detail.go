@@ -0,0 +1,189 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// detailTab is the section shown in viewDetail.
+type detailTab int
+
+const (
+	tabRequest detailTab = iota
+	tabResponse
+	tabTimings
+	numTabs
+)
+
+var detailTabs = [numTabs]string{"Request", "Response", "Timings"}
+
+// updateDetail handles the detail view's tab and body keys. It reports
+// whether the key was consumed.
+func (a *App) updateDetail(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "h", "left":
+		a.showTab((a.detailTab + numTabs - 1) % numTabs)
+	case "l", "right", "tab":
+		a.showTab((a.detailTab + 1) % numTabs)
+	case "1", "2", "3":
+		a.showTab(detailTab(msg.String()[0] - '1'))
+	case "b":
+		a.rawBody = !a.rawBody
+		a.renderDetail()
+		if a.rawBody {
+			a.notify("showing raw bodies")
+		} else {
+			a.notify("showing formatted bodies")
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// openDetail shows the selected flow, starting on the request tab.
+func (a *App) openDetail() {
+	a.mode = viewDetail
+	a.detailTab = tabRequest
+	a.tabOffsets = [numTabs]int{}
+	a.renderDetail()
+	a.detail.SetYOffset(0)
+}
+
+// showTab switches tabs, keeping each tab's scroll position.
+func (a *App) showTab(t detailTab) {
+	a.tabOffsets[a.detailTab] = a.detail.YOffset
+	a.detailTab = t
+	a.renderDetail()
+	a.detail.SetYOffset(a.tabOffsets[t])
+}
+
+// renderFlowDetail renders the flow's summary, the tab bar, and the chosen
+// tab.
+func renderFlowDetail(f *proxy.Flow, width int, tab detailTab, raw bool) string {
+	var b strings.Builder
+
+	// Header
+	statusStr := "-"
+	if f.Response != nil {
+		col := statusColor(f.Response.StatusCode)
+		statusStr = lipgloss.NewStyle().Foreground(col).Bold(true).
+			Render(fmt.Sprintf("%d", f.Response.StatusCode))
+	} else if f.State == proxy.FlowStateError {
+		statusStr = styleError.Render("ERR")
+	} else if f.Pending() {
+		statusStr = styleHelp.Render("pending")
+	}
+
+	dur := formatDur(f.Duration())
+	if alertMark(f, "latency") != "" {
+		dur = styleError.Bold(true).Render(dur)
+	}
+	if alertMark(f, "status") != "" {
+		statusStr += styleError.Render(" !")
+	}
+
+	title := fmt.Sprintf("%s %s  →  %s  [%s]  %s",
+		styleKeyword.Render(f.Request.Method),
+		f.Request.Path,
+		f.Upstream,
+		dur,
+		statusStr,
+	)
+	b.WriteString(title)
+	b.WriteString("\n")
+
+	// Tags
+	if len(f.Tags) > 0 {
+		for _, t := range f.Tags {
+			style := styleTag
+			if strings.HasPrefix(t, "alert:") {
+				style = styleAlertTag
+			}
+			b.WriteString(style.Render(t) + " ")
+		}
+		b.WriteString("\n")
+	}
+
+	// Note
+	if f.Note != "" {
+		b.WriteString(styleHeader.Render("Note: ") + f.Note + "\n")
+	}
+
+	// Replay links
+	if f.ReplayOf != "" {
+		b.WriteString(styleGray("replay of ") + shortID(f.ReplayOf) + styleHelp.Render("  [g] original") + "\n")
+	}
+	if n := len(f.Replays); n > 0 {
+		ids := make([]string, n)
+		for i, id := range f.Replays {
+			ids[i] = shortID(id)
+		}
+		b.WriteString(styleGray("replays: ") + truncateStr(strings.Join(ids, " "), width-30) +
+			styleHelp.Render("  [g] newest  [x] diff it") + "\n")
+	}
+
+	b.WriteString(renderTabBar(tab, raw))
+	b.WriteString("\n")
+	b.WriteString(styleDivider.Render(strings.Repeat("─", width)))
+	b.WriteString("\n")
+
+	switch tab {
+	case tabRequest:
+		b.WriteString(renderRequest(f, width, raw))
+	case tabResponse:
+		b.WriteString(renderResponse(f, width, raw))
+	case tabTimings:
+		b.WriteString(renderTimestamps(f))
+		if f.Timings != nil {
+			b.WriteString("\n")
+			b.WriteString(renderTimings(f.Timings, width))
+		}
+	}
+	return b.String()
+}
+
+func renderTabBar(active detailTab, raw bool) string {
+	var b strings.Builder
+	for i, name := range detailTabs {
+		label := fmt.Sprintf(" %d %s ", i+1, name)
+		if detailTab(i) == active {
+			b.WriteString(tableSelectedStyle.Render(label))
+		} else {
+			b.WriteString(styleHelp.Render(label))
+		}
+		b.WriteString(" ")
+	}
+	if raw {
+		b.WriteString(styleHelp.Render(" (raw bodies)"))
+	}
+	return b.String()
+}
+
+// renderTimestamps lists when each phase of the flow happened, relative to
+// its start.
+func renderTimestamps(f *proxy.Flow) string {
+	ts := f.Timestamps
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Timestamps") + "\n")
+	b.WriteString(fmt.Sprintf("  %-15s %s\n", "started", ts.Created.Local().Format("2006-01-02 15:04:05.000")))
+	for _, p := range []struct {
+		name string
+		t    time.Time
+	}{
+		{"request sent", ts.RequestDone},
+		{"response start", ts.ResponseStart},
+		{"response done", ts.ResponseDone},
+	} {
+		if !p.t.IsZero() {
+			b.WriteString(fmt.Sprintf("  %-15s +%s\n", p.name, formatDur(p.t.Sub(ts.Created))))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,174 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+var (
+	styleDiffAdd = lipgloss.NewStyle().Foreground(colorGreen)
+	styleDiffDel = lipgloss.NewStyle().Foreground(colorRed)
+)
+
+// toggleMark marks the selected flow as the base for [x] diffs.
+func (a *App) toggleMark() {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return
+	}
+	if a.marked == f.ID {
+		a.marked = ""
+		a.notify("mark cleared")
+		return
+	}
+	a.marked = f.ID
+	a.notify(fmt.Sprintf("marked %s %s for diff", f.Request.Method, f.Request.Path))
+}
+
+// diffSelected diffs the selected flow against the marked flow or, if none
+// is marked, against the flow it was replayed from. An original with
+// replays is diffed against its newest one.
+func (a *App) diffSelected() {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return
+	}
+	base, other := a.marked, f.ID
+	if base == "" || base == f.ID {
+		base = f.ReplayOf
+	}
+	if base == "" {
+		if replays := a.store.Replays(f); len(replays) > 0 {
+			base, other = f.ID, replays[len(replays)-1].ID
+		}
+	}
+	if base == "" {
+		a.notify("mark a flow with [m] first")
+		return
+	}
+	d, err := a.engine.Diff(base, other, proxy.DiffOptions{IgnoreHeaders: []string{"Date"}})
+	if err != nil {
+		a.notify(err.Error())
+		return
+	}
+	a.mode = viewDiff
+	a.detail.SetContent(renderDiff(d))
+	a.detail.GotoTop()
+}
+
+// jumpReplay moves the cursor between a flow and its replays. [g] goes from
+// a replay to its original, and from an original to its newest replay; [G]
+// steps to the next older replay of the same original, wrapping around.
+func (a *App) jumpReplay(older bool) {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return
+	}
+	original := f
+	if f.ReplayOf != "" {
+		original = a.store.Get(f.ReplayOf)
+	}
+	var target *proxy.Flow
+	if !older && f.ReplayOf != "" {
+		target = original
+	} else if original != nil {
+		replays := a.store.Replays(original)
+		if n := len(replays); n > 0 {
+			i := slices.Index(replays, f)
+			switch {
+			case i < 0 || !older:
+				target = replays[n-1]
+			default:
+				target = replays[(i-1+n)%n]
+			}
+		}
+	}
+	if target == nil {
+		a.notify("no stored original or replay to jump to")
+		return
+	}
+	i := slices.Index(a.filtered, target)
+	if i < 0 {
+		a.notify(fmt.Sprintf("flow %s is hidden by the filter", shortID(target.ID)))
+		return
+	}
+	a.stopFollowing()
+	a.table.SetCursor(i)
+	if a.mode == viewDetail {
+		a.renderDetail()
+	}
+}
+
+func renderDiff(d *proxy.FlowDiff) string {
+	var b strings.Builder
+	b.WriteString(styleHeader.Render(fmt.Sprintf("Diff %s → %s", shortID(d.A), shortID(d.B))))
+	b.WriteString("  " + styleHelp.Render("(Date ignored)") + "\n\n")
+	if d.Equal {
+		b.WriteString(styleDiffAdd.Render("flows are identical") + "\n")
+		return b.String()
+	}
+
+	for _, c := range d.Changes {
+		switch c.Op {
+		case proxy.DiffAdded:
+			b.WriteString(styleDiffAdd.Render(fmt.Sprintf("+ %s: %s", c.Path, diffValue(c.B))))
+		case proxy.DiffRemoved:
+			b.WriteString(styleDiffDel.Render(fmt.Sprintf("- %s: %s", c.Path, diffValue(c.A))))
+		default:
+			b.WriteString(styleKeyword.Render("~ "+c.Path) + ": " +
+				styleDiffDel.Render(diffValue(c.A)) + " → " + styleDiffAdd.Render(diffValue(c.B)))
+		}
+		b.WriteString("\n")
+	}
+
+	writeLines := func(title string, lines []proxy.DiffLine) {
+		if len(lines) == 0 {
+			return
+		}
+		b.WriteString("\n" + styleSectionTitle.Render(title) + "\n")
+		for _, l := range lines {
+			text := l.Op + " " + l.Text
+			switch l.Op {
+			case "+":
+				text = styleDiffAdd.Render(text)
+			case "-":
+				text = styleDiffDel.Render(text)
+			}
+			b.WriteString(text + "\n")
+		}
+	}
+	writeLines("Request body", d.RequestBody)
+	writeLines("Response body", d.ResponseBody)
+	return b.String()
+}
+
+// diffValue formats a change value compactly.
+func diffValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "∅"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
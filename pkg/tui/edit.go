@@ -0,0 +1,251 @@
+package tui
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/curl"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// The edit view shows the selected request as raw HTTP text:
+//
+//	POST /api/users HTTP/1.1
+//	Content-Type: application/json
+//
+//	{"name": "x"}
+//
+// ctrl+s sends it as a new flow via Engine.ReplayWith; esc discards it.
+//
+// The same view doubles as the "New request" form ([n]), where a curl
+// command line may be pasted instead of raw HTTP text, and edits paused
+// flows from the intercept screen, where ctrl+s changes the request in place,
+// or the response of a flow stopped at a response breakpoint:
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/json
+//
+//	{"ok": true}
+
+// newRequestTemplate pre-fills the editor for a new request.
+const newRequestTemplate = "GET / HTTP/1.1\n\n"
+
+// newEditor creates the textarea used by the edit view.
+func newEditor() textarea.Model {
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.MaxHeight = 0 // requests can be long
+	ta.Prompt = ""
+	return ta
+}
+
+// editSelected opens the edit view for the selected flow.
+func (a *App) editSelected() tea.Cmd {
+	cursor := a.table.Cursor()
+	if cursor < 0 || cursor >= len(a.filtered) {
+		a.notify("no flow selected")
+		return nil
+	}
+	f := a.filtered[cursor]
+	if f.Request == nil {
+		a.notify("flow has no captured request")
+		return nil
+	}
+	a.editID = f.ID
+	a.editReturn = a.mode
+	a.mode = viewEdit
+	a.editor.SetValue(requestText(f.Request))
+	a.editor.CursorStart()
+	return a.editor.Focus()
+}
+
+// newRequest opens the edit view for a request that isn't based on a flow.
+func (a *App) newRequest() tea.Cmd {
+	a.editID = ""
+	a.editReturn = a.mode
+	a.mode = viewEdit
+	a.editor.SetValue(newRequestTemplate)
+	return a.editor.Focus()
+}
+
+// sendNewRequest parses the editor as a curl command or raw HTTP and sends it.
+func (a *App) sendNewRequest() {
+	cr, err := curl.ParseRequest(a.editor.Value())
+	if err != nil {
+		a.notify(err.Error())
+		return
+	}
+	go func() {
+		_, _ = a.engine.ReplayRequest(cr, proxy.ReplayOptions{Tags: []string{"import"}})
+	}()
+	a.notify(fmt.Sprintf("sending %s %s", cr.Method, cr.URL))
+	a.closeEditor()
+}
+
+func (a *App) updateEditor(msg tea.KeyMsg, cmds []tea.Cmd) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+s":
+		if a.editID == "" {
+			a.sendNewRequest()
+			break
+		}
+		id := a.editID
+		if a.editResponse {
+			edit, err := parseResponseText(a.editor.Value())
+			if err != nil {
+				a.notify(err.Error())
+				break
+			}
+			if _, err := a.engine.EditResponse(id, edit); err != nil {
+				a.notify(err.Error())
+				break
+			}
+			a.notify("response edited; [a] resumes it")
+			a.closeEditor()
+			a.renderIntercept()
+			break
+		}
+		edit, err := parseRequestText(a.editor.Value())
+		if err != nil {
+			a.notify(err.Error())
+			break
+		}
+		if a.editIntercepted {
+			if _, err := a.engine.EditRequest(id, edit); err != nil {
+				a.notify(err.Error())
+				break
+			}
+			a.notify("request edited; [a] resumes it")
+			a.closeEditor()
+			a.renderIntercept()
+			break
+		}
+		go func() {
+			_, _ = a.engine.ReplayWith(id, proxy.ReplayOptions{Edit: edit})
+		}()
+		a.notify(fmt.Sprintf("replaying edited %s %s", *edit.Method, *edit.URL))
+		a.closeEditor()
+	case "esc":
+		a.closeEditor()
+	case "ctrl+c":
+		return a, tea.Quit
+	default:
+		var cmd tea.Cmd
+		a.editor, cmd = a.editor.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return a, tea.Batch(cmds...)
+}
+
+func (a *App) closeEditor() {
+	a.editor.Blur()
+	a.editID = ""
+	a.editIntercepted = false
+	a.editResponse = false
+	a.mode = a.editReturn
+}
+
+// responseText renders cr in the edit view's raw HTTP format.
+func responseText(cr *proxy.CapturedResponse) string {
+	var b strings.Builder
+	proto := cr.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(&b, "%s %d %s\n", proto, cr.StatusCode, http.StatusText(cr.StatusCode))
+	writeHeaderLines(&b, cr.Headers)
+	b.WriteString("\n")
+	b.Write(cr.ReadBody())
+	return b.String()
+}
+
+// parseResponseText parses the edit view's raw HTTP format into a
+// ResponseEdit that replaces the status, headers, and body.
+func parseResponseText(text string) (proxy.ResponseEdit, error) {
+	head, body, _ := strings.Cut(text, "\n\n")
+	lines := strings.Split(head, "\n")
+
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return proxy.ResponseEdit{}, fmt.Errorf("status line must be PROTO STATUS [TEXT], got %q", lines[0])
+	}
+	status, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return proxy.ResponseEdit{}, fmt.Errorf("invalid status %q", fields[1])
+	}
+	headers, err := parseHeaderLines(lines[1:])
+	if err != nil {
+		return proxy.ResponseEdit{}, err
+	}
+	return proxy.ResponseEdit{StatusCode: &status, Headers: headers, Body: &body}, nil
+}
+
+// requestText renders cr in the edit view's raw HTTP format.
+func requestText(cr *proxy.CapturedRequest) string {
+	var b strings.Builder
+	proto := cr.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(&b, "%s %s %s\n", cr.Method, cr.URL, proto)
+	writeHeaderLines(&b, cr.Headers)
+	b.WriteString("\n")
+	b.Write(cr.ReadBody())
+	return b.String()
+}
+
+// parseRequestText parses the edit view's raw HTTP format into a RequestEdit
+// that replaces the method, URL, headers, and body.
+func parseRequestText(text string) (proxy.RequestEdit, error) {
+	head, body, _ := strings.Cut(text, "\n\n")
+	lines := strings.Split(head, "\n")
+
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return proxy.RequestEdit{}, fmt.Errorf("request line must be METHOD URL [PROTO], got %q", lines[0])
+	}
+	method, url := strings.ToUpper(fields[0]), fields[1]
+
+	headers, err := parseHeaderLines(lines[1:])
+	if err != nil {
+		return proxy.RequestEdit{}, err
+	}
+	return proxy.RequestEdit{Method: &method, URL: &url, Headers: headers, Body: &body}, nil
+}
+
+// writeHeaderLines writes h as "Name: value" lines, sorted by name.
+func writeHeaderLines(b *strings.Builder, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(b, "%s: %s\n", k, v)
+		}
+	}
+}
+
+// parseHeaderLines parses the "Name: value" lines following a request or
+// status line.
+func parseHeaderLines(lines []string) (http.Header, error) {
+	headers := make(http.Header)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("line %d: header must be Name: value", i+2)
+		}
+		headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return headers, nil
+}
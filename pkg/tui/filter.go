@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/filter"
+)
+
+// openFilter focuses the filter input. up and down then step through the
+// project's filter history; tab completes the word before the cursor.
+func (a *App) openFilter() tea.Cmd {
+	a.filterMode = true
+	a.filterHistory = a.engine.FilterHistory()
+	a.historyPos = len(a.filterHistory)
+	a.filterInput.Focus()
+	return textinput.Blink
+}
+
+// stepHistory moves through the filter history: -1 is older, +1 newer.
+// Stepping past the newest entry restores what was being typed.
+func (a *App) stepHistory(delta int) {
+	pos := a.historyPos + delta
+	if pos < 0 || pos > len(a.filterHistory) {
+		return
+	}
+	if a.historyPos == len(a.filterHistory) {
+		a.historyDraft = a.filterInput.Value()
+	}
+	a.historyPos = pos
+	if pos == len(a.filterHistory) {
+		a.filterInput.SetValue(a.historyDraft)
+	} else {
+		a.filterInput.SetValue(a.filterHistory[pos])
+	}
+	a.filterInput.CursorEnd()
+}
+
+// completeFilter completes the word before the cursor: a filter primitive
+// after "~", an upstream name after ~u, or a tag after ~t. With several
+// candidates it completes their common prefix and lists them.
+func (a *App) completeFilter() {
+	value := []rune(a.filterInput.Value())
+	pos := min(a.filterInput.Position(), len(value))
+	head, tail := string(value[:pos]), string(value[pos:])
+	start := strings.LastIndexAny(head, " \t(!&|") + 1
+	word := head[start:]
+	prev := strings.Fields(head[:start])
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(word, "~"):
+		for _, p := range filter.Primitives {
+			candidates = append(candidates, p.Token)
+		}
+	case len(prev) > 0 && strings.HasSuffix(prev[len(prev)-1], "~u"):
+		for _, u := range a.engine.Router().Upstreams() {
+			candidates = append(candidates, u.Name)
+		}
+	case len(prev) > 0 && strings.HasSuffix(prev[len(prev)-1], "~t"):
+		for _, f := range a.allFlows {
+			for _, t := range f.Tags {
+				if !slices.Contains(candidates, t) {
+					candidates = append(candidates, t)
+				}
+			}
+		}
+	default:
+		return
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return
+	case 1:
+		a.setCompletion(head[:start]+matches[0]+" ", tail)
+		return
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	a.setCompletion(head[:start]+prefix, tail)
+	if strings.HasPrefix(word, "~") {
+		// List primitives with what they match.
+		for i, m := range matches {
+			j := slices.IndexFunc(filter.Primitives, func(p filter.Primitive) bool { return p.Token == m })
+			matches[i] = m + " " + filter.Primitives[j].Help
+		}
+	}
+	a.notify(strings.Join(matches, "  ·  "))
+}
+
+// setCompletion replaces the input with head+tail, leaving the cursor
+// between them.
+func (a *App) setCompletion(head, tail string) {
+	a.filterInput.SetValue(head + tail)
+	a.filterInput.SetCursor(utf8.RuneCountInString(head))
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// groupsTickMsg refreshes the groups screen while it is open.
+type groupsTickMsg struct{}
+
+func groupsTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return groupsTickMsg{} })
+}
+
+// toggleGroups opens or closes the screen grouping the filtered flows by
+// request signature.
+func (a *App) toggleGroups() tea.Cmd {
+	if a.mode == viewGroups {
+		a.mode = viewList
+		return nil
+	}
+	a.mode = viewGroups
+	a.groupCursor = 0
+	a.renderGroups()
+	a.detail.GotoTop()
+	return groupsTick()
+}
+
+// updateGroups handles the groups screen's own keys and reports whether msg
+// was one of them.
+func (a *App) updateGroups(msg tea.KeyMsg) bool {
+	groups := a.engine.GroupFlows(a.filtered)
+	if len(groups) == 0 {
+		return false
+	}
+	a.groupCursor = min(a.groupCursor, len(groups)-1)
+	switch msg.String() {
+	case "up", "k":
+		a.groupCursor = max(a.groupCursor-1, 0)
+	case "down", "j":
+		a.groupCursor = min(a.groupCursor+1, len(groups)-1)
+	case "enter":
+		// Show the group's newest flow.
+		latest := groups[a.groupCursor].Latest
+		i := slices.IndexFunc(a.filtered, func(f *proxy.Flow) bool { return f.ID == latest })
+		if i < 0 {
+			return true
+		}
+		a.table.SetCursor(i)
+		a.openDetail()
+		return true
+	default:
+		return false
+	}
+	a.detail.SetContent(renderGroups(groups, a.groupCursor, a.width))
+	return true
+}
+
+func (a *App) renderGroups() {
+	a.detail.SetContent(renderGroups(a.engine.GroupFlows(a.filtered), a.groupCursor, a.width))
+}
+
+func renderGroups(groups []proxy.FlowGroup, cursor, width int) string {
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Request groups") + "  (filtered flows by method, path template, and body)\n\n")
+	if len(groups) == 0 {
+		b.WriteString(styleHelp.Render("no flows") + "\n")
+		return b.String()
+	}
+	b.WriteString(styleSectionTitle.Render(fmt.Sprintf("  %-8s %6s %6s %8s %8s %8s  %-20s %s",
+		"Method", "Count", "Errors", "p50", "p95", "Max", "Statuses", "Path")) + "\n")
+	for i, g := range groups {
+		marker := "  "
+		if i == cursor {
+			marker = styleKeyword.Render("▶ ")
+		}
+		errs := fmt.Sprintf("%6d", g.Errors)
+		if g.Errors > 0 {
+			errs = styleError.Render(errs)
+		}
+		path := truncateStr(g.Path, max(width-73, 10))
+		if g.BodyHash != "" {
+			path += " " + styleGray("#"+g.BodyHash)
+		}
+		b.WriteString(fmt.Sprintf("%s%-8s %6d %s %8s %8s %8s  %-20s %s\n", marker, g.Method, g.Count, errs,
+			formatMillis(g.P50), formatMillis(g.P95), formatMillis(g.Max),
+			truncateStr(formatStatuses(g.Statuses), 20), path))
+	}
+	return b.String()
+}
+
+// formatStatuses lists status counts, most frequent first, e.g. "200x12 304x3".
+func formatStatuses(statuses map[int]int) string {
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	slices.SortFunc(codes, func(x, y int) int {
+		if statuses[x] != statuses[y] {
+			return statuses[y] - statuses[x]
+		}
+		return x - y
+	})
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		s := strconv.Itoa(code)
+		if code == 0 {
+			s = "-"
+		}
+		parts[i] = fmt.Sprintf("%sx%d", s, statuses[code])
+	}
+	return strings.Join(parts, " ")
+}
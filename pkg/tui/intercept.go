@@ -0,0 +1,189 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// toggleIntercept opens or closes the intercept queue screen.
+func (a *App) toggleIntercept() {
+	if a.mode == viewIntercept {
+		a.mode = viewList
+		return
+	}
+	a.mode = viewIntercept
+	a.renderIntercept()
+	a.detail.GotoTop()
+}
+
+// interceptedFlows returns the flows paused by intercept, oldest first.
+func (a *App) interceptedFlows() []*proxy.Flow {
+	var paused []*proxy.Flow
+	for _, f := range a.store.All() {
+		if f.State == proxy.FlowStateIntercepted {
+			paused = append(paused, f)
+		}
+	}
+	return paused
+}
+
+// updateIntercept handles the intercept screen's own keys and reports
+// whether msg was one of them.
+func (a *App) updateIntercept(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch msg.String() {
+	case "I":
+		return true, a.setIntercept()
+	case "b":
+		return true, a.addBreakpoint(proxy.BreakRequest)
+	case "B":
+		return true, a.addBreakpoint(proxy.BreakResponse)
+	case "c":
+		for _, b := range a.engine.Breakpoints() {
+			_ = a.engine.DeleteBreakpoint(b.ID)
+		}
+		a.notify("breakpoints cleared (paused flows stay paused)")
+		a.renderIntercept()
+		return true, nil
+	}
+	paused := a.interceptedFlows()
+	if len(paused) == 0 {
+		return false, nil
+	}
+	a.interceptCursor = min(a.interceptCursor, len(paused)-1)
+	cur := paused[a.interceptCursor]
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "up", "k":
+		a.interceptCursor = max(a.interceptCursor-1, 0)
+	case "down", "j":
+		a.interceptCursor = min(a.interceptCursor+1, len(paused)-1)
+	case "a":
+		if err := a.engine.Resume(cur.ID); err != nil {
+			a.notify(err.Error())
+		} else {
+			a.notify(fmt.Sprintf("resumed %s %s", cur.Request.Method, cur.Request.Path))
+		}
+	case "x":
+		if err := a.engine.Kill(cur.ID); err != nil {
+			a.notify(err.Error())
+		} else {
+			a.notify(fmt.Sprintf("killed %s %s", cur.Request.Method, cur.Request.Path))
+		}
+	case "e":
+		a.editID = cur.ID
+		a.editIntercepted = true
+		a.editResponse = cur.Response != nil
+		a.editReturn = a.mode
+		a.mode = viewEdit
+		if a.editResponse {
+			a.editor.SetValue(responseText(cur.Response))
+		} else {
+			a.editor.SetValue(requestText(cur.Request))
+		}
+		a.editor.CursorStart()
+		cmd = a.editor.Focus()
+	default:
+		return false, nil
+	}
+	a.renderIntercept()
+	return true, cmd
+}
+
+// setIntercept turns intercept off if it is on; otherwise it prompts for
+// the filter of requests to pause (empty pauses every request).
+func (a *App) setIntercept() tea.Cmd {
+	if a.engine.Intercept().Enabled {
+		a.engine.ClearIntercept()
+		a.notify("intercept off (paused flows stay paused)")
+		a.renderIntercept()
+		return nil
+	}
+	return a.openPrompt("Intercept filter (empty: all requests): ", "", func(expr string) {
+		var match proxy.Matcher
+		if expr != "" {
+			f, err := filter.Parse(expr)
+			if err != nil {
+				a.notify(fmt.Sprintf("invalid filter: %v", err))
+				return
+			}
+			match = proxy.Matcher(f)
+		}
+		a.engine.SetIntercept(expr, match)
+		a.notify("intercept on")
+		a.renderIntercept()
+	})
+}
+
+// addBreakpoint prompts for the filter of a breakpoint at phase, prefilled
+// with the current filter.
+func (a *App) addBreakpoint(phase string) tea.Cmd {
+	return a.openPrompt("Break on "+phase+"s matching (empty: all): ", a.filterExpr, func(expr string) {
+		b := proxy.Breakpoint{Filter: expr, Phase: phase}
+		if expr != "" {
+			f, err := filter.Parse(expr)
+			if err != nil {
+				a.notify(fmt.Sprintf("invalid filter: %v", err))
+				return
+			}
+			b.Match = proxy.Matcher(f)
+		}
+		if _, err := a.engine.AddBreakpoint(b); err != nil {
+			a.notify(err.Error())
+			return
+		}
+		a.notify("breakpoint added")
+		a.renderIntercept()
+	})
+}
+
+func (a *App) renderIntercept() {
+	a.detail.SetContent(renderIntercept(a.engine.Intercept(), a.engine.Breakpoints(), a.interceptedFlows(),
+		a.interceptCursor, a.width))
+}
+
+func renderIntercept(status proxy.InterceptStatus, breakpoints []proxy.Breakpoint, paused []*proxy.Flow, cursor, width int) string {
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Intercept") + "  ")
+	switch {
+	case !status.Enabled:
+		b.WriteString(styleHelp.Render("off ([I] turns it on)"))
+	case status.Filter == "":
+		b.WriteString("pausing every request")
+	default:
+		b.WriteString("pausing requests matching " + styleKeyword.Render(status.Filter))
+	}
+	b.WriteString("\n")
+	for _, bp := range breakpoints {
+		flows := bp.Filter
+		if flows == "" {
+			flows = "every flow"
+		}
+		b.WriteString(fmt.Sprintf("breakpoint on %-8s %s\n", bp.Phase+"s", styleKeyword.Render(flows)))
+	}
+	b.WriteString("\n")
+	if len(paused) == 0 {
+		b.WriteString(styleHelp.Render("no paused flows") + "\n")
+		return b.String()
+	}
+	b.WriteString(styleSectionTitle.Render(fmt.Sprintf("  %-8s %-12s %-8s %8s  %s", "Method", "Upstream", "At", "Waiting", "URL")) + "\n")
+	for i, f := range paused {
+		marker := "  "
+		if i == cursor {
+			marker = styleKeyword.Render("▶ ")
+		}
+		waiting := time.Since(f.Timestamps.Created).Truncate(time.Second)
+		at := proxy.BreakRequest
+		if f.Response != nil {
+			at = fmt.Sprintf("resp %d", f.Response.StatusCode)
+		}
+		b.WriteString(fmt.Sprintf("%s%-8s %-12s %-8s %8s  %s\n", marker, f.Request.Method,
+			truncateStr(f.Upstream, 12), at, waiting, truncateStr(f.Request.URL, width-45)))
+	}
+	return b.String()
+}
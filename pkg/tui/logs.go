@@ -0,0 +1,173 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// The logs screen shows the proxy's own log (reloads, webhook failures,
+// anything written to the standard logger) and the output of upstream
+// processes (upstreams with a command), all interleaved or one source at a
+// time, and follows new lines while scrolled to the bottom.
+
+// proxyLogName labels the proxy's own log lines among process output.
+const proxyLogName = "proxy"
+
+// logsTickMsg refreshes the logs screen while it is open.
+type logsTickMsg struct{}
+
+func logsTick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg { return logsTickMsg{} })
+}
+
+// toggleLogs opens or closes the logs screen.
+func (a *App) toggleLogs() tea.Cmd {
+	if a.mode == viewLogs {
+		a.mode = viewList
+		return nil
+	}
+	a.mode = viewLogs
+	a.renderLogs()
+	a.detail.GotoBottom()
+	return logsTick()
+}
+
+// updateLogs handles the logs screen's keys. It reports whether the key
+// was consumed.
+func (a *App) updateLogs(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "tab":
+		// Cycle: everything, the proxy's log, then each process in turn.
+		procs := a.engine.Processes()
+		next, proxyOnly := "", false
+		switch {
+		case a.logsProcess == "" && !a.logsProxy:
+			proxyOnly = true
+		case a.logsProxy:
+			if len(procs) > 0 {
+				next = procs[0].Upstream
+			}
+		default:
+			for i, p := range procs {
+				if p.Upstream == a.logsProcess && i+1 < len(procs) {
+					next = procs[i+1].Upstream
+				}
+			}
+		}
+		a.logsProcess, a.logsProxy = next, proxyOnly
+		a.renderLogs()
+		a.detail.GotoBottom()
+	case "R":
+		if a.logsProxy {
+			a.notify("the proxy's log has no process to restart")
+			return true
+		}
+		names := []string{a.logsProcess}
+		if a.logsProcess == "" {
+			names = names[:0]
+			for _, p := range a.engine.Processes() {
+				names = append(names, p.Upstream)
+			}
+		}
+		if len(names) == 0 {
+			a.notify("no upstream has a command")
+			return true
+		}
+		for _, name := range names {
+			if err := a.engine.RestartProcess(name); err != nil {
+				a.notify(err.Error())
+				return true
+			}
+		}
+		a.notify("restarting " + strings.Join(names, ", "))
+	default:
+		return false
+	}
+	return true
+}
+
+func (a *App) renderLogs() {
+	atBottom := a.detail.AtBottom()
+	var lines []proxy.ProcessLine
+	if !a.logsProxy {
+		var err error
+		if lines, err = a.engine.ProcessLogs(a.logsProcess); err != nil {
+			a.logsProcess = ""
+			lines, _ = a.engine.ProcessLogs("")
+		}
+	}
+	shown := a.logsProcess
+	if a.logsProcess == "" {
+		// The proxy's log joins the processes' output as pseudo-stream "log".
+		for _, l := range a.engine.Logs() {
+			lines = append(lines, proxy.ProcessLine{Time: l.Time, Upstream: proxyLogName, Stream: "log", Text: l.Text})
+		}
+		slices.SortStableFunc(lines, func(x, y proxy.ProcessLine) int { return x.Time.Compare(y.Time) })
+		if a.logsProxy {
+			shown = proxyLogName
+		}
+	}
+	a.detail.SetContent(renderLogs(a.engine.Processes(), lines, shown, a.width))
+	if atBottom {
+		a.detail.GotoBottom()
+	}
+}
+
+func renderLogs(procs []proxy.ProcessStatus, lines []proxy.ProcessLine, shown string, width int) string {
+	var b strings.Builder
+	title := "all"
+	if shown != "" {
+		title = shown
+	}
+	b.WriteString(styleHeader.Render("Logs") + "  " + styleKeyword.Render(title) + "\n")
+	for _, p := range procs {
+		state := p.State
+		switch p.State {
+		case proxy.ProcessReady:
+			state = lipgloss.NewStyle().Foreground(colorGreen).Render(fmt.Sprintf("%-8s", state))
+		case proxy.ProcessExited:
+			state = styleError.Render(fmt.Sprintf("%-8s", state))
+		default:
+			state = fmt.Sprintf("%-8s", state)
+		}
+		info := p.Addr
+		if p.PID != 0 {
+			info += fmt.Sprintf("  pid %d", p.PID)
+		}
+		if p.Restarts > 0 {
+			info += fmt.Sprintf("  %d restarts", p.Restarts)
+		}
+		if p.State == proxy.ProcessExited && p.LastExit != "" {
+			info += "  " + p.LastExit
+		}
+		b.WriteString(fmt.Sprintf("  %-16s %s %s\n", truncateStr(p.Upstream, 16), state, styleGray(truncateStr(info, width-30))))
+	}
+	if len(lines) == 0 {
+		b.WriteString(styleDivider.Render(strings.Repeat("─", width)) + "\n")
+		b.WriteString(styleGray("  nothing logged yet") + "\n")
+		return b.String()
+	}
+	b.WriteString(styleDivider.Render(strings.Repeat("─", width)) + "\n")
+	for _, l := range lines {
+		prefix := l.Time.Local().Format("15:04:05") + " "
+		if shown == "" {
+			prefix += fmt.Sprintf("%-12s ", truncateStr(l.Upstream, 12))
+		}
+		text := l.Text
+		switch l.Stream {
+		case "proxy":
+			text = styleKeyword.Render(text)
+		case "stderr":
+			text = lipgloss.NewStyle().Foreground(colorYellow).Render(text)
+		}
+		b.WriteString(styleGray(prefix) + text + "\n")
+	}
+	return b.String()
+}
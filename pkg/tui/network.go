@@ -0,0 +1,134 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// toggleNetwork opens or closes the network simulation screen.
+func (a *App) toggleNetwork() {
+	if a.mode == viewNetwork {
+		a.mode = viewList
+		return
+	}
+	a.mode = viewNetwork
+	a.renderNetwork()
+	a.detail.GotoTop()
+}
+
+// networkRows lists the rows of the network screen: every upstream ("")
+// first, then each upstream by name.
+func (a *App) networkRows() []string {
+	rows := []string{""}
+	for _, u := range a.engine.Router().Upstreams() {
+		rows = append(rows, u.Name)
+	}
+	return rows
+}
+
+// updateNetwork handles the network screen's own keys and reports whether
+// msg was one of them.
+func (a *App) updateNetwork(msg tea.KeyMsg) bool {
+	rows := a.networkRows()
+	a.networkCursor = min(a.networkCursor, len(rows)-1)
+	upstream := rows[a.networkCursor]
+	switch msg.String() {
+	case "up", "k":
+		a.networkCursor = max(a.networkCursor-1, 0)
+	case "down", "j":
+		a.networkCursor = min(a.networkCursor+1, len(rows)-1)
+	case " ", "enter":
+		a.setNetworkProfile(upstream, nextNetworkProfile(a.engine.NetworkConditions(), upstream))
+	case "x":
+		a.setNetworkProfile(upstream, "")
+	default:
+		return false
+	}
+	a.renderNetwork()
+	return true
+}
+
+// nextNetworkProfile returns the profile after the one upstream uses now,
+// cycling through off and then each profile by name.
+func nextNetworkProfile(st proxy.NetworkStatus, upstream string) string {
+	names := []string{""}
+	for _, p := range st.Profiles {
+		names = append(names, p.Name)
+	}
+	cur := st.Global
+	if upstream != "" {
+		cur = st.Upstreams[upstream]
+	}
+	i := slices.Index(names, cur)
+	return names[(i+1)%len(names)]
+}
+
+func (a *App) setNetworkProfile(upstream, profile string) {
+	if err := a.engine.SetNetworkProfile(upstream, profile); err != nil {
+		a.notify(err.Error())
+		return
+	}
+	where := "all upstreams"
+	if upstream != "" {
+		where = upstream
+	}
+	if profile == "" {
+		a.notify("network simulation off for " + where)
+	} else {
+		a.notify(fmt.Sprintf("simulating %s for %s", profile, where))
+	}
+}
+
+func (a *App) renderNetwork() {
+	a.detail.SetContent(renderNetwork(a.engine.NetworkConditions(), a.networkRows(), a.networkCursor))
+}
+
+func renderNetwork(st proxy.NetworkStatus, rows []string, cursor int) string {
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Network simulation") + "  (latency, bandwidth, and resets applied to requests)\n\n")
+	b.WriteString(styleSectionTitle.Render(fmt.Sprintf("  %-24s %s", "Upstream", "Profile")) + "\n")
+	for i, name := range rows {
+		marker := "  "
+		if i == cursor {
+			marker = styleKeyword.Render("▶ ")
+		}
+		label, profile := name, st.Global
+		if name == "" {
+			label = "all upstreams"
+		} else if p, ok := st.Upstreams[name]; ok {
+			profile = p
+		} else if profile != "" {
+			profile += styleHelp.Render(" (all upstreams)")
+		}
+		if profile == "" {
+			profile = styleHelp.Render("off")
+		}
+		b.WriteString(fmt.Sprintf("%s%-24s %s\n", marker, truncateStr(label, 24), profile))
+	}
+
+	b.WriteString("\n" + styleSectionTitle.Render(fmt.Sprintf("  %-14s %8s %8s %10s %10s %6s",
+		"Profile", "Latency", "Jitter", "Down", "Up", "Reset")) + "\n")
+	for _, p := range st.Profiles {
+		b.WriteString(fmt.Sprintf("  %-14s %8s %8s %10s %10s %6s\n", truncateStr(p.Name, 14),
+			fmt.Sprintf("%dms", p.LatencyMS), fmt.Sprintf("±%dms", p.JitterMS),
+			formatKbps(p.DownloadKbps), formatKbps(p.UploadKbps), fmt.Sprintf("%.0f%%", p.ResetRate*100)))
+	}
+	return b.String()
+}
+
+// formatKbps renders a bandwidth cap in kilobits per second.
+func formatKbps(kbps int) string {
+	switch {
+	case kbps == 0:
+		return "∞"
+	case kbps >= 1000:
+		return fmt.Sprintf("%.1f Mb/s", float64(kbps)/1000)
+	default:
+		return fmt.Sprintf("%d kb/s", kbps)
+	}
+}
@@ -0,0 +1,108 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// toggleOverrides opens or closes the header overrides screen.
+func (a *App) toggleOverrides() {
+	if a.mode == viewOverrides {
+		a.mode = viewList
+		return
+	}
+	a.mode = viewOverrides
+	a.renderOverrides()
+	a.detail.GotoTop()
+}
+
+// updateOverrides handles the header overrides screen's own keys and
+// reports whether msg was one of them.
+func (a *App) updateOverrides(msg tea.KeyMsg) (bool, tea.Cmd) {
+	if msg.String() == "a" {
+		return true, a.addOverride()
+	}
+	list := a.engine.HeaderOverrides()
+	if len(list) == 0 {
+		return false, nil
+	}
+	a.overrideCursor = min(a.overrideCursor, len(list)-1)
+	cur := list[a.overrideCursor]
+	switch msg.String() {
+	case "up", "k":
+		a.overrideCursor = max(a.overrideCursor-1, 0)
+	case "down", "j":
+		a.overrideCursor = min(a.overrideCursor+1, len(list)-1)
+	case "x":
+		if err := a.engine.DeleteHeaderOverride(cur.ID); err != nil {
+			a.notify(err.Error())
+		} else {
+			a.notify("removed override of " + cur.Header)
+		}
+	default:
+		return false, nil
+	}
+	a.renderOverrides()
+	return true, nil
+}
+
+// addOverride prompts for a header and then for the filter of the requests
+// it applies to, prefilled with the current filter.
+func (a *App) addOverride() tea.Cmd {
+	return a.openPrompt("Header override (Name: value; no value removes it): ", "", func(input string) {
+		name, value, _ := strings.Cut(input, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if name == "" {
+			return
+		}
+		a.openPrompt("Apply to flows matching (empty: all): ", a.filterExpr, func(expr string) {
+			f, err := filter.Parse(expr)
+			if err != nil {
+				a.notify(fmt.Sprintf("invalid filter: %v", err))
+				return
+			}
+			o := proxy.HeaderOverride{Filter: expr, Header: name, Value: value}
+			if _, err := a.engine.AddHeaderOverride(o, proxy.Matcher(f)); err != nil {
+				a.notify(err.Error())
+				return
+			}
+			a.notify("override added")
+			a.renderOverrides()
+		})
+	})
+}
+
+func (a *App) renderOverrides() {
+	a.detail.SetContent(renderOverrides(a.engine.HeaderOverrides(), a.overrideCursor, a.width))
+}
+
+func renderOverrides(list []proxy.HeaderOverride, cursor, width int) string {
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Header overrides") + "  (applied to requests before forwarding)\n\n")
+	if len(list) == 0 {
+		b.WriteString(styleHelp.Render("no overrides ([a] adds one)") + "\n")
+		return b.String()
+	}
+	b.WriteString(styleSectionTitle.Render(fmt.Sprintf("  %-40s %s", "Header", "Flows")) + "\n")
+	for i, o := range list {
+		marker := "  "
+		if i == cursor {
+			marker = styleKeyword.Render("▶ ")
+		}
+		header := o.Header + ": " + o.Value
+		if o.Value == "" {
+			header = o.Header + " (removed)"
+		}
+		flows := o.Filter
+		if flows == "" {
+			flows = "all"
+		}
+		b.WriteString(fmt.Sprintf("%s%-40s %s\n", marker, truncateStr(header, 40), truncateStr(flows, width-45)))
+	}
+	return b.String()
+}
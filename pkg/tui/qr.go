@@ -0,0 +1,78 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/qr"
+)
+
+// styleQR draws QR codes light-on-dark whatever the terminal's colours, as
+// qr.Code.String expects.
+var styleQR = lipgloss.NewStyle().Foreground(lipgloss.Color("#ffffff")).Background(lipgloss.Color("#000000"))
+
+// toggleQR opens or closes the pairing screen: a QR code of the proxy's LAN
+// address, for pointing a phone at it.
+func (a *App) toggleQR() {
+	if a.mode == viewQR {
+		a.mode = viewList
+		return
+	}
+	if len(a.engine.Info().LANURLs) == 0 {
+		a.notify("the proxy isn't reachable from the LAN; listen on all interfaces (e.g. :9090)")
+		return
+	}
+	a.mode = viewQR
+	a.renderQR()
+	a.detail.GotoTop()
+}
+
+// updateQR handles the pairing screen's keys. It reports whether the key
+// was consumed.
+func (a *App) updateQR(msg tea.KeyMsg) bool {
+	if msg.String() != "tab" {
+		return false
+	}
+	a.qrIndex++
+	a.renderQR()
+	return true
+}
+
+func (a *App) renderQR() {
+	info := a.engine.Info()
+	if len(info.LANURLs) == 0 {
+		a.detail.SetContent("no LAN address")
+		return
+	}
+	a.qrIndex %= len(info.LANURLs)
+	a.detail.SetContent(renderQR(info, a.qrIndex))
+}
+
+func renderQR(info proxy.Info, i int) string {
+	url := info.LANURLs[i]
+	var b strings.Builder
+	b.WriteString(styleHeader.Render("Pair a device") + "  " + styleKeyword.Render(url))
+	if len(info.LANURLs) > 1 {
+		b.WriteString(styleHelp.Render(fmt.Sprintf("  (%d of %d addresses)", i+1, len(info.LANURLs))))
+	}
+	b.WriteString("\n\n")
+	code, err := qr.Encode(url)
+	if err != nil {
+		return b.String() + styleError.Render(err.Error())
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(code.String(), "\n"), "\n") {
+		b.WriteString("  " + styleQR.Render(line) + "\n")
+	}
+	b.WriteString("\n")
+	if info.Mode == proxy.ModeForward {
+		host := strings.TrimPrefix(strings.TrimPrefix(url, "http://"), "https://")
+		b.WriteString(styleHelp.Render("  Set the device's HTTP proxy to "+host+"; it must be on the same network.") + "\n")
+	} else {
+		b.WriteString(styleHelp.Render("  Scan to open the proxy on a device on the same network.") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/session"
+)
+
+// defaultSessionFile is where :w saves when no file is named and there is no
+// Options.SessionDir.
+const defaultSessionFile = "session.hpz"
+
+// openCommand opens the ":" command line.
+func (a *App) openCommand() tea.Cmd {
+	return a.openPrompt(":", "", a.runCommand)
+}
+
+// runCommand executes a ":" command. Only :w [FILE] (save the session) is
+// supported.
+func (a *App) runCommand(line string) {
+	name, arg, _ := strings.Cut(line, " ")
+	switch name {
+	case "":
+	case "w", "write":
+		a.saveSession(strings.TrimSpace(arg))
+	default:
+		a.notify(fmt.Sprintf("unknown command :%s (try :w FILE)", name))
+	}
+}
+
+// saveSession writes every flow to path, in the format its extension
+// implies; reopen it with `http-proxy open`.
+func (a *App) saveSession(path string) {
+	switch {
+	case path != "":
+	case a.sessionDir != "":
+		path = filepath.Join(a.sessionDir, "session-"+time.Now().Format("20060102-150405")+".hpz")
+	default:
+		path = defaultSessionFile
+	}
+	flows := a.store.All()
+	if err := session.Save(path, flows, session.FormatForPath(path)); err != nil {
+		a.notify("save session: " + err.Error())
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	a.notify(fmt.Sprintf("saved %d flows to %s", len(flows), path))
+}
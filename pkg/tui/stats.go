@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// statsTickMsg refreshes the stats screen while it is open.
+type statsTickMsg struct{}
+
+func statsTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return statsTickMsg{} })
+}
+
+// toggleStats opens or closes the stats screen.
+func (a *App) toggleStats() tea.Cmd {
+	if a.mode == viewStats {
+		a.mode = viewList
+		return nil
+	}
+	a.mode = viewStats
+	a.renderStats()
+	a.detail.GotoTop()
+	return statsTick()
+}
+
+// nextStatsWindow cycles the window the stats screen reports over.
+func (a *App) nextStatsWindow() {
+	a.statsWindow = (a.statsWindow + 1) % len(proxy.StatsWindows)
+	a.renderStats()
+}
+
+func (a *App) renderStats() {
+	a.detail.SetContent(renderStats(a.engine.Stats(), a.statsWindow))
+}
+
+func renderStats(st proxy.Stats, window int) string {
+	var b strings.Builder
+	var windows []string
+	for i, w := range st.Global {
+		if i == window {
+			windows = append(windows, styleKeyword.Render(w.Window))
+		} else {
+			windows = append(windows, w.Window)
+		}
+	}
+	b.WriteString(styleHeader.Render("Traffic stats") + "  " + strings.Join(windows, " ") + "\n\n")
+
+	row := func(name string, ws proxy.WindowStats) string {
+		errs := fmt.Sprintf("%.1f%%", ws.ErrorRate*100)
+		if ws.Errors > 0 {
+			errs = styleError.Render(fmt.Sprintf("%-7s", errs))
+		} else {
+			errs = fmt.Sprintf("%-7s", errs)
+		}
+		return fmt.Sprintf("%-20s %8d %8.2f %s %8s %8s %8s %8s %8s\n",
+			truncateStr(name, 20), ws.Requests, ws.Rate, errs,
+			formatMillis(ws.P50), formatMillis(ws.P95), formatMillis(ws.P99),
+			formatSize(int(ws.BytesIn)), formatSize(int(ws.BytesOut)))
+	}
+	b.WriteString(styleSectionTitle.Render(fmt.Sprintf("%-20s %8s %8s %-7s %8s %8s %8s %8s %8s",
+		"Upstream", "Requests", "Req/s", "Errors", "p50", "p95", "p99", "In", "Out")) + "\n")
+	for _, u := range st.Upstreams {
+		b.WriteString(row(u.Upstream, u.Windows[window]))
+	}
+	if len(st.Global) > 0 {
+		b.WriteString(styleDivider.Render(strings.Repeat("─", 100)) + "\n")
+		b.WriteString(row("all", st.Global[window]))
+		if n := st.Global[window].SampledOut; n > 0 {
+			b.WriteString("\n" + styleGray(fmt.Sprintf("%d of these requests were not stored (sample_rate)", n)) + "\n")
+		}
+	}
+	if len(st.Endpoints) > 0 {
+		b.WriteString("\n" + styleSectionTitle.Render(fmt.Sprintf("%-20s %8s %8s %-7s %8s %8s %8s %8s %8s  %s",
+			"Upstream", "Requests", "Req/s", "Errors", "p50", "p95", "p99", "In", "Out", "Endpoint")) + "\n")
+		for _, ep := range st.Endpoints {
+			if ep.Windows[window].Requests > 0 {
+				b.WriteString(strings.TrimSuffix(row(ep.Upstream, ep.Windows[window]), "\n") +
+					"  " + ep.Method + " " + ep.Path + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func formatMillis(ms float64) string {
+	return formatDur(time.Duration(ms * float64(time.Millisecond)))
+}
@@ -47,6 +47,11 @@ var (
 			Background(lipgloss.Color("17")).
 			Padding(0, 1)
 
+	styleAlertTag = lipgloss.NewStyle().
+			Foreground(colorWhite).
+			Background(colorRed).
+			Padding(0, 1)
+
 	styleDivider = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("240"))
 
@@ -0,0 +1,193 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// openPrompt shows a one-line input in the filter bar's place. fn is called
+// with the entered text on enter; esc cancels.
+func (a *App) openPrompt(label, value string, fn func(string)) tea.Cmd {
+	a.promptLabel = label
+	a.promptFn = fn
+	a.promptInput.SetValue(value)
+	a.promptInput.CursorEnd()
+	a.promptInput.Focus()
+	return textinput.Blink
+}
+
+func (a *App) updatePrompt(msg tea.KeyMsg, cmds []tea.Cmd) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		fn := a.promptFn
+		a.promptFn = nil
+		a.promptInput.Blur()
+		fn(strings.TrimSpace(a.promptInput.Value()))
+	case "esc":
+		a.promptFn = nil
+		a.promptInput.Blur()
+	default:
+		var cmd tea.Cmd
+		a.promptInput, cmd = a.promptInput.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return a, tea.Batch(cmds...)
+}
+
+// tagSelected prompts for tags to add to the selected flow; words prefixed
+// with "-" are removed instead.
+func (a *App) tagSelected() tea.Cmd {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return nil
+	}
+	return a.openPrompt("Tags (-tag removes): ", "", func(input string) {
+		var add, remove []string
+		for _, t := range strings.FieldsFunc(input, func(r rune) bool { return r == ' ' || r == ',' }) {
+			if name, ok := strings.CutPrefix(t, "-"); ok {
+				remove = append(remove, name)
+			} else {
+				add = append(add, t)
+			}
+		}
+		if len(add) == 0 && len(remove) == 0 {
+			return
+		}
+		if _, err := a.engine.TagFlow(f.ID, add, remove); err != nil {
+			a.notify(err.Error())
+			return
+		}
+		// The tags may change whether the flow matches a ~t filter.
+		a.applyFilter()
+		a.notify(fmt.Sprintf("tags: %s", strings.Join(f.Tags, " ")))
+	})
+}
+
+// annotateSelected prompts for the selected flow's note, prefilled with the
+// current one. An empty note clears it.
+func (a *App) annotateSelected() tea.Cmd {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return nil
+	}
+	return a.openPrompt("Note: ", f.Note, func(note string) {
+		if _, err := a.engine.PatchFlow(f.ID, proxy.FlowPatch{Note: &note}); err != nil {
+			a.notify(err.Error())
+			return
+		}
+		a.notify("note saved")
+	})
+}
+
+// togglePin pins or unpins the selected flow.
+func (a *App) togglePin() {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return
+	}
+	pinned := !f.Pinned
+	if _, err := a.engine.PatchFlow(f.ID, proxy.FlowPatch{Pinned: &pinned}); err != nil {
+		a.notify(err.Error())
+		return
+	}
+	if pinned {
+		a.notify("pinned: kept through eviction and [d]clear")
+	} else {
+		a.notify("unpinned")
+	}
+}
+
+// deleteSelected removes the selected flow from the store.
+func (a *App) deleteSelected() {
+	f := a.selectedFlow()
+	if f == nil {
+		a.notify("no flow selected")
+		return
+	}
+	a.store.Delete(f.ID)
+	a.notify("deleted flow")
+}
+
+// deleteMatching removes the unpinned flows matching the current filter.
+func (a *App) deleteMatching() {
+	if a.filterExpr == "" {
+		a.notify("set a filter first: [D] deletes the flows matching it")
+		return
+	}
+	match := a.filterParsed
+	ids := a.store.DeleteFunc(func(f *proxy.Flow) bool { return !f.Pinned && match(f) })
+	a.notify(fmt.Sprintf("deleted %d flows matching %s", len(ids), a.filterExpr))
+}
+
+// nextView switches to the saved view after the one matching the current
+// filter. Past the last view the filter is cleared.
+func (a *App) nextView() {
+	views := a.engine.Views()
+	if len(views) == 0 {
+		a.notify("no saved views; save the current filter with [V]")
+		return
+	}
+	next := 0
+	for i, v := range views {
+		if v.Filter == a.filterExpr {
+			next = i + 1
+			break
+		}
+	}
+	if next == len(views) {
+		a.setFilter("", filter.MatchAll)
+		a.notify("view: all flows")
+		return
+	}
+	v := views[next]
+	f, err := filter.Parse(v.Filter)
+	if err != nil {
+		a.notify(fmt.Sprintf("view %s: invalid filter: %v", v.Name, err))
+		return
+	}
+	a.setFilter(v.Filter, f)
+	a.notify(fmt.Sprintf("view %s: %s", v.Name, v.Filter))
+}
+
+// saveView prompts for a name and saves the current filter as a view.
+func (a *App) saveView() tea.Cmd {
+	if a.filterExpr == "" {
+		a.notify("set a filter with [f] first")
+		return nil
+	}
+	name := ""
+	for _, v := range a.engine.Views() {
+		if v.Filter == a.filterExpr {
+			name = v.Name
+			break
+		}
+	}
+	expr := a.filterExpr
+	return a.openPrompt("Save view as: ", name, func(name string) {
+		if name == "" {
+			return
+		}
+		if _, err := a.engine.SaveView(name, expr); err != nil {
+			a.notify(err.Error())
+			return
+		}
+		a.notify(fmt.Sprintf("saved view %s", name))
+	})
+}
+
+// setFilter replaces the active filter and re-filters the flow list.
+func (a *App) setFilter(expr string, f filter.Filter) {
+	a.filterExpr = expr
+	a.filterParsed = f
+	a.filterInput.SetValue(expr)
+	a.applyFilter()
+}
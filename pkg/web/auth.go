@@ -0,0 +1,73 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+// tokenCookie carries the web token for the browser UI once it has been
+// presented as ?token= on page load.
+const tokenCookie = "http_proxy_token"
+
+// authMiddleware rejects requests that don't carry the configured
+// credentials: HTTP basic auth for WebAuth.User/Password, and for
+// WebAuth.Token a bearer token, ?token= query parameter, or the cookie set
+// from it. When both are configured either is accepted.
+func authMiddleware(auth proxy.WebAuth, next http.Handler) http.Handler {
+	if !auth.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.Token != "" {
+			if q := r.URL.Query().Get("token"); q != "" && equal(q, auth.Token) {
+				if r.URL.Path == "/" {
+					// Keep the token out of the address bar and history.
+					http.SetCookie(w, &http.Cookie{
+						Name: tokenCookie, Value: q, Path: "/",
+						HttpOnly: true, SameSite: http.SameSiteStrictMode,
+					})
+					http.Redirect(w, r, "/", http.StatusSeeOther)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && equal(bearer, auth.Token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if c, err := r.Cookie(tokenCookie); err == nil && equal(c.Value, auth.Token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if auth.User != "" {
+			if user, pass, ok := r.BasicAuth(); ok && equal(user, auth.User) && equal(pass, auth.Password) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="http-proxy", charset="UTF-8"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// sameOrigin reports whether a WebSocket handshake comes from a page served
+// by this server. With authentication on, the browser's cookie or cached
+// basic credentials would otherwise let any site open the socket.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // not a browser
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
@@ -2,19 +2,167 @@ package web
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fidiego/http-proxy/pkg/codegen"
+	"github.com/fidiego/http-proxy/pkg/curl"
+	"github.com/fidiego/http-proxy/pkg/filter"
+	"github.com/fidiego/http-proxy/pkg/format"
 	"github.com/fidiego/http-proxy/pkg/proxy"
+	"github.com/fidiego/http-proxy/pkg/session"
 )
 
 type handlers struct {
-	engine *proxy.Engine
-	hub    *wsHub
+	engine     *proxy.Engine
+	hub        *wsHub
+	sessionDir string // where POST /api/session/save writes; "" is the working directory
 }
 
+// flowPage is the envelope returned by a paginated flow query.
+type flowPage struct {
+	Total   int           `json:"total"`   // flows in the store
+	Matched int           `json:"matched"` // flows matching the filter
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"` // 0 means no limit
+	Flows   []*proxy.Flow `json:"flows"`
+	IDs     []string      `json:"ids,omitempty"` // with ids=true, in place of Flows
+}
+
+// listFlows returns every stored flow, oldest first. With any of the query
+// parameters filter, limit, offset, order, or ids it evaluates the filter
+// server side and returns a flowPage instead; ids=true lists only the IDs of
+// the page's flows, which is all the web UI needs to apply a filter.
+//
+// With stream=1 or "Accept: application/x-ndjson" the page's flows (or IDs)
+// are written one JSON value per line as they are encoded, without the
+// envelope, so a large store doesn't have to be marshalled in one piece.
 func (h *handlers) listFlows(w http.ResponseWriter, r *http.Request) {
 	flows := h.engine.Store().All()
-	jsonOK(w, flows)
+	q := r.URL.Query()
+	stream := wantsNDJSON(r)
+	if !stream && !q.Has("filter") && !q.Has("limit") && !q.Has("offset") && !q.Has("order") && !q.Has("ids") {
+		jsonOK(w, flows)
+		return
+	}
+
+	f, err := filter.Parse(q.Get("filter"))
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	page := flowPage{Total: len(flows), Flows: []*proxy.Flow{}}
+	idsOnly := q.Get("ids") == "true"
+	if page.Limit, err = queryInt(q, "limit"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if page.Offset, err = queryInt(q, "offset"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		slices.Reverse(flows)
+	default:
+		http.Error(w, `invalid order: want "asc" or "desc"`, http.StatusBadRequest)
+		return
+	}
+
+	if stream {
+		streamFlows(w, flows, f, page.Offset, page.Limit, idsOnly)
+		return
+	}
+	for _, fl := range flows {
+		if !f(fl) {
+			continue
+		}
+		page.Matched++
+		if page.Matched <= page.Offset || page.Limit != 0 && len(page.Flows)+len(page.IDs) >= page.Limit {
+			continue
+		}
+		if idsOnly {
+			page.IDs = append(page.IDs, fl.ID)
+		} else {
+			page.Flows = append(page.Flows, fl)
+		}
+	}
+	jsonOK(w, page)
+}
+
+// ndjsonFlushEvery is how many lines streamFlows writes between flushes.
+const ndjsonFlushEvery = 64
+
+// wantsNDJSON reports whether a flow listing should be streamed as
+// newline-delimited JSON: ?stream=1 (or true), or an Accept header naming
+// application/x-ndjson.
+func wantsNDJSON(r *http.Request) bool {
+	if v := r.URL.Query().Get("stream"); v != "" {
+		on, _ := strconv.ParseBool(v)
+		return on
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, t := range strings.Split(accept, ",") {
+			if mt, _, err := mime.ParseMediaType(t); err == nil && mt == "application/x-ndjson" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamFlows writes the flows matching f, after skipping offset matches
+// and up to limit (0: all), as one JSON value per line: the flow, or with
+// idsOnly its ID. It stops early if the client goes away.
+func streamFlows(w http.ResponseWriter, flows []*proxy.Flow, f filter.Filter, offset, limit int, idsOnly bool) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+	matched, written := 0, 0
+	for _, fl := range flows {
+		if limit != 0 && written >= limit {
+			break
+		}
+		if !f(fl) {
+			continue
+		}
+		if matched++; matched <= offset {
+			continue
+		}
+		var v any = fl
+		if idsOnly {
+			v = fl.ID
+		}
+		if err := enc.Encode(v); err != nil {
+			return
+		}
+		if written++; written%ndjsonFlushEvery == 0 {
+			_ = rc.Flush()
+		}
+	}
+}
+
+// queryInt parses a non-negative integer query parameter; absent means 0.
+func queryInt(q url.Values, name string) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: want a non-negative integer", name)
+	}
+	return n, nil
 }
 
 func (h *handlers) getFlow(w http.ResponseWriter, r *http.Request) {
@@ -27,9 +175,147 @@ func (h *handlers) getFlow(w http.ResponseWriter, r *http.Request) {
 	jsonOK(w, flow)
 }
 
+// requestParts parses the multipart body of the flow named in the path,
+// writing an error response and returning false on failure.
+func (h *handlers) requestParts(w http.ResponseWriter, r *http.Request) ([]proxy.Part, bool) {
+	flow := h.engine.Store().Get(r.PathValue("id"))
+	if flow == nil || flow.Request == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	parts, err := flow.Request.Parts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return parts, true
+}
+
+func (h *handlers) listParts(w http.ResponseWriter, r *http.Request) {
+	parts, ok := h.requestParts(w, r)
+	if !ok {
+		return
+	}
+	if parts == nil {
+		parts = []proxy.Part{}
+	}
+	jsonOK(w, parts)
+}
+
+// getPart downloads the content of one part, by index.
+func (h *handlers) getPart(w http.ResponseWriter, r *http.Request) {
+	parts, ok := h.requestParts(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 || n >= len(parts) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	p := parts[n]
+	ct := p.ContentType
+	if ct == "" {
+		ct = http.DetectContentType(p.Body)
+	}
+	name := p.Filename
+	if name == "" {
+		name = p.Name
+	}
+	if name == "" {
+		name = fmt.Sprintf("part-%d", n)
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	_, _ = w.Write(p.Body)
+}
+
+// prettyBody is a body rendered by its content type's formatter.
+type prettyBody struct {
+	Formatter string `json:"formatter"`
+	Text      string `json:"text"`
+}
+
+// getPretty formats the request or response body (?part=response) of a flow
+// with pkg/format. It is 204 when no formatter takes the body.
+func (h *handlers) getPretty(w http.ResponseWriter, r *http.Request) {
+	flow := h.engine.Store().Get(r.PathValue("id"))
+	if flow == nil || flow.Request == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	body := format.Body{
+		ContentType: flow.Request.Headers.Get("Content-Type"),
+		Data:        flow.Request.ReadBody(),
+		Path:        flow.Request.Path,
+	}
+	switch r.URL.Query().Get("part") {
+	case "", "request":
+	case "response":
+		if flow.Response == nil {
+			http.Error(w, "flow has no response", http.StatusNotFound)
+			return
+		}
+		body = format.Body{
+			ContentType: flow.Response.Headers.Get("Content-Type"),
+			Data:        flow.Response.ReadBody(),
+			Path:        flow.Request.Path,
+			Response:    true,
+		}
+	default:
+		http.Error(w, "part must be request or response", http.StatusBadRequest)
+		return
+	}
+	text, name, ok := format.Format(body)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	jsonOK(w, prettyBody{Formatter: name, Text: text})
+}
+
+// diffFlows diffs flow a against flow b, or with b "latest-replay" against
+// the newest stored replay of a.
+func (h *handlers) diffFlows(w http.ResponseWriter, r *http.Request) {
+	var opts proxy.DiffOptions
+	if v := r.URL.Query().Get("ignore"); v != "" {
+		opts.IgnoreHeaders = strings.Split(v, ",")
+	}
+	opts.Lines = r.URL.Query().Get("lines") == "true"
+	a, b := r.PathValue("a"), r.PathValue("b")
+	if b == "latest-replay" {
+		var replays []*proxy.Flow
+		if f := h.engine.Store().Get(a); f != nil {
+			replays = h.engine.Store().Replays(f)
+		}
+		if len(replays) == 0 {
+			http.Error(w, "flow has no stored replays", http.StatusNotFound)
+			return
+		}
+		b = replays[len(replays)-1].ID
+	}
+	d, err := h.engine.Diff(a, b, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonOK(w, d)
+}
+
 func (h *handlers) replayFlow(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	flow, err := h.engine.Replay(id)
+	// The body is optional; when present it overrides parts of the request
+	// and/or where it is sent.
+	var body struct {
+		proxy.RequestEdit
+		Target string            `json:"target"`
+		Assert *proxy.Assertions `json:"assert"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.ReplayWith(id, proxy.ReplayOptions{Edit: body.RequestEdit, Target: body.Target, Assert: body.Assert})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -37,28 +323,668 @@ func (h *handlers) replayFlow(w http.ResponseWriter, r *http.Request) {
 	jsonOK(w, flow)
 }
 
-func (h *handlers) clearFlows(w http.ResponseWriter, _ *http.Request) {
-	h.engine.Store().Clear()
+func (h *handlers) importRequest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Command string `json:"command"` // curl command line or raw HTTP request
+		Target  string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cr, err := curl.ParseRequest(req.Command)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.ReplayRequest(cr, proxy.ReplayOptions{Target: req.Target, Tags: []string{"import"}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, flow)
+}
+
+// composeRequest is the body of POST /api/requests.
+type composeRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"` // absolute, or a path routed as usual
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+	Target  string      `json:"target"`
+}
+
+func (h *handlers) composeRequest(w http.ResponseWriter, r *http.Request) {
+	var req composeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cr, err := curl.Build(req.Method, req.URL, req.Headers, req.Body)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.ReplayRequest(cr, proxy.ReplayOptions{Target: req.Target, Tags: []string{"compose"}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, flow)
+}
+
+func (h *handlers) bulkReplay(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filter      string `json:"filter"`
+		Concurrency int    `json:"concurrency"`
+		Delay       string `json:"delay"` // Go duration, e.g. "250ms"
+		Order       string `json:"order"`
+		Target      string `json:"target"`
+
+		Assert *proxy.Assertions `json:"assert"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := filter.Parse(req.Filter)
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var delay time.Duration
+	if req.Delay != "" {
+		if delay, err = time.ParseDuration(req.Delay); err != nil {
+			http.Error(w, "invalid delay: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	job, err := h.engine.BulkReplay(proxy.BulkReplayOptions{
+		Match:       proxy.Matcher(f),
+		Filter:      req.Filter,
+		Concurrency: req.Concurrency,
+		Delay:       delay,
+		Order:       req.Order,
+		Target:      req.Target,
+		Assert:      req.Assert,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, job)
+}
+
+func (h *handlers) listJobs(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Jobs())
+}
+
+func (h *handlers) runJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.engine.RunJob(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	jsonOK(w, job)
+}
+
+func (h *handlers) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.engine.Job(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	jsonOK(w, job)
+}
+
+func (h *handlers) cancelJob(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.CancelJob(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) resumeFlow(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.Resume(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) killFlow(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.Kill(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) editRequest(w http.ResponseWriter, r *http.Request) {
+	var edit proxy.RequestEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.EditRequest(r.PathValue("id"), edit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	jsonOK(w, flow)
+}
+
+func (h *handlers) editResponse(w http.ResponseWriter, r *http.Request) {
+	var edit proxy.ResponseEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.EditResponse(r.PathValue("id"), edit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	jsonOK(w, flow)
+}
+
+func (h *handlers) patchFlow(w http.ResponseWriter, r *http.Request) {
+	var p proxy.FlowPatch
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.PatchFlow(r.PathValue("id"), p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonOK(w, flow)
+}
+
+// tagRequest is the body of POST /api/flows/{id}/tags.
+type tagRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+func (h *handlers) tagFlow(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flow, err := h.engine.TagFlow(r.PathValue("id"), req.Add, req.Remove)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonOK(w, flow)
+}
+
+func (h *handlers) listViews(w http.ResponseWriter, _ *http.Request) {
+	views := h.engine.Views()
+	if views == nil {
+		views = []proxy.View{}
+	}
+	jsonOK(w, views)
+}
+
+func (h *handlers) saveView(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filter string `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := filter.Parse(req.Filter); err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	v, err := h.engine.SaveView(r.PathValue("name"), req.Filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonOK(w, v)
+}
+
+func (h *handlers) deleteView(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.DeleteView(r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) getStats(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Stats())
+}
+
+func (h *handlers) getShadowReport(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.ShadowReport())
+}
+
+func (h *handlers) resetShadowReport(w http.ResponseWriter, _ *http.Request) {
+	h.engine.ResetShadowReport()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) listProcesses(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Processes())
+}
+
+// processLogs returns the kept output of the process named by ?upstream=, or
+// of all processes.
+func (h *handlers) processLogs(w http.ResponseWriter, r *http.Request) {
+	lines, err := h.engine.ProcessLogs(r.URL.Query().Get("upstream"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if lines == nil {
+		lines = []proxy.ProcessLine{}
+	}
+	jsonOK(w, lines)
+}
+
+// getInfo reports where the proxy bound, for scripts discovering it.
+func (h *handlers) getInfo(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Info())
+}
+
+// getLogs returns the kept lines of the proxy's own log, oldest first.
+func (h *handlers) getLogs(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Logs())
+}
+
+func (h *handlers) restartProcess(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.RestartProcess(r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handlers) getIntercept(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Intercept())
+}
+
+func (h *handlers) setIntercept(w http.ResponseWriter, r *http.Request) {
+	var req proxy.InterceptStatus
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Enabled {
+		h.engine.ClearIntercept()
+		jsonOK(w, h.engine.Intercept())
+		return
+	}
+	f, err := filter.Parse(req.Filter)
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.engine.SetIntercept(req.Filter, proxy.Matcher(f))
+	jsonOK(w, h.engine.Intercept())
+}
+
+func (h *handlers) listBreakpoints(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Breakpoints())
+}
+
+func (h *handlers) addBreakpoint(w http.ResponseWriter, r *http.Request) {
+	var req proxy.Breakpoint
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := filter.Parse(req.Filter)
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Match = proxy.Matcher(f)
+	b, err := h.engine.AddBreakpoint(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, b)
+}
+
+func (h *handlers) deleteBreakpoint(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.DeleteBreakpoint(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) listOverrides(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.HeaderOverrides())
+}
+
+func (h *handlers) addOverride(w http.ResponseWriter, r *http.Request) {
+	var req proxy.HeaderOverride
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := filter.Parse(req.Filter)
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	o, err := h.engine.AddHeaderOverride(req, proxy.Matcher(f))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, o)
+}
+
+func (h *handlers) deleteOverride(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.DeleteHeaderOverride(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) getNetwork(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.NetworkConditions())
+}
+
+// setNetwork activates a network profile for one upstream, or for all of
+// them when no upstream is given. An empty profile turns simulation off, or
+// returns the upstream to the global profile.
+func (h *handlers) setNetwork(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Upstream string `json:"upstream"`
+		Profile  string `json:"profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.engine.SetNetworkProfile(req.Upstream, req.Profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, h.engine.NetworkConditions())
+}
+
+func (h *handlers) listAddons(w http.ResponseWriter, _ *http.Request) {
+	jsonOK(w, h.engine.Addons().List())
+}
+
+func (h *handlers) patchAddon(w http.ResponseWriter, r *http.Request) {
+	var p proxy.AddonPatch
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.engine.Addons().Patch(p); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonOK(w, h.engine.Addons().List())
+}
+
+// exportFlows downloads every flow, or with ?filter= the matching ones.
+func (h *handlers) exportFlows(w http.ResponseWriter, r *http.Request) {
+	f, err := filter.Parse(r.URL.Query().Get("filter"))
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flows := slices.DeleteFunc(h.engine.Store().All(), func(fl *proxy.Flow) bool { return !f(fl) })
+	writeExport(w, r, flows, string(session.FormatHAR))
+}
+
+// groupFlows groups the flows matching ?filter= by request signature.
+func (h *handlers) groupFlows(w http.ResponseWriter, r *http.Request) {
+	f, err := filter.Parse(r.URL.Query().Get("filter"))
+	if err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	flows := slices.DeleteFunc(h.engine.Store().All(), func(fl *proxy.Flow) bool { return !f(fl) })
+	groups := h.engine.GroupFlows(flows)
+	if groups == nil {
+		groups = []proxy.FlowGroup{}
+	}
+	jsonOK(w, groups)
+}
+
+func (h *handlers) exportFlow(w http.ResponseWriter, r *http.Request) {
+	flow := h.engine.Store().Get(r.PathValue("id"))
+	if flow == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeExport(w, r, []*proxy.Flow{flow}, "gotest")
+}
+
+// writeExport sends flows as a download in the ?format= given (har, native,
+// hpz, mitm, csv, gotest, k6, or vegeta), falling back to defaultFormat.
+func writeExport(w http.ResponseWriter, r *http.Request, flows []*proxy.Flow, defaultFormat string) {
+	q := r.URL.Query()
+	v := q.Get("format")
+	if v == "" {
+		v = defaultFormat
+	}
+	base := "http-proxy-" + time.Now().Format("2006-01-02T15-04-05")
+
+	if strings.EqualFold(v, "gotest") {
+		src, err := codegen.GoTest(flows, q.Get("package"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/x-go; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(base, "-", "_")+`_test.go"`)
+		_, _ = w.Write(src)
+		return
+	}
+	if strings.EqualFold(v, "k6") || strings.EqualFold(v, "vegeta") {
+		opts := codegen.LoadTestOptions{BaseURL: q.Get("base_url"), KeepTiming: q.Get("timing") == "true"}
+		gen, ext, ctype := codegen.K6, "js", "text/javascript; charset=utf-8"
+		if strings.EqualFold(v, "vegeta") {
+			gen, ext, ctype = codegen.Vegeta, "targets.json", "application/x-ndjson"
+		}
+		src, err := gen(flows, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+base+"."+ext+`"`)
+		_, _ = w.Write(src)
+		return
+	}
+
+	if strings.EqualFold(v, "csv") {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+base+`.csv"`)
+		_ = session.WriteCSV(w, flows)
+		return
+	}
+
+	format, err := session.ParseFormat(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ext, ctype := "json", "application/json"
+	switch format {
+	case session.FormatHAR:
+		ext = "har"
+	case session.FormatCompressed:
+		ext, ctype = "hpz", "application/gzip"
+	case session.FormatMitm:
+		ext, ctype = "mitm", "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+base+"."+ext+`"`)
+	_ = session.Write(w, flows, format)
+}
+
+// saveRequest is the body of POST /api/session/save.
+type saveRequest struct {
+	Path      string `json:"path"`      // a file name in the session directory
+	Overwrite bool   `json:"overwrite"` // replace an existing file of that name
+}
+
+// savedSession is the response of POST /api/session/save.
+type savedSession struct {
+	Path  string `json:"path"`
+	Flows int    `json:"flows"`
+}
+
+// saveSession writes every flow to a session file in the session directory
+// on the proxy's host (the profile's, else the working directory), in the
+// format given by the name's extension (default: a timestamped .hpz). Only a
+// bare file name is accepted, and an existing file is replaced only with
+// overwrite. Open it later with http-proxy open.
+func (h *handlers) saveSession(w http.ResponseWriter, r *http.Request) {
+	var req saveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		req.Path = "session-" + time.Now().Format("2006-01-02T15-04-05") + ".hpz"
+	}
+	if !validSessionName(req.Path) {
+		http.Error(w, fmt.Sprintf("invalid session file name %q: give a file name without a directory", req.Path), http.StatusBadRequest)
+		return
+	}
+	dir := h.sessionDir
+	if dir == "" {
+		dir = "."
+	}
+	path, err := filepath.Abs(filepath.Join(dir, req.Path))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Lstat(path); err == nil && !req.Overwrite {
+		http.Error(w, fmt.Sprintf("%s already exists (set overwrite to replace it)", path), http.StatusConflict)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		http.Error(w, "save session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	flows := h.engine.Store().All()
+	if err := session.Save(path, flows, session.FormatForPath(path)); err != nil {
+		http.Error(w, "save session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonOK(w, savedSession{Path: path, Flows: len(flows)})
+}
+
+// validSessionName reports whether name is a plain file name, with no
+// directory, that saveSession may create in the session directory.
+func validSessionName(name string) bool {
+	return name != "." && !strings.ContainsAny(name, `/\`) && filepath.IsLocal(name)
+}
+
+// deletedFlows is the response of DELETE /api/flows?filter=.
+type deletedFlows struct {
+	Deleted []string `json:"deleted"`
+}
+
+// clearFlows removes all unpinned flows, or every flow with ?force=true.
+// With ?filter= only the matching flows are removed, pinned ones included
+// only with force.
+func (h *handlers) clearFlows(w http.ResponseWriter, r *http.Request) {
+	force := r.URL.Query().Get("force") == "true"
+	if r.URL.Query().Has("filter") {
+		f, err := filter.Parse(r.URL.Query().Get("filter"))
+		if err != nil {
+			http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ids := h.engine.Store().DeleteFunc(func(fl *proxy.Flow) bool {
+			return (force || !fl.Pinned) && f(fl)
+		})
+		jsonOK(w, deletedFlows{Deleted: append([]string{}, ids...)})
+		return
+	}
+	if force {
+		h.engine.Store().ClearAll()
+	} else {
+		h.engine.Store().Clear()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) deleteFlow(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.engine.Store().Delete(id) {
+		http.Error(w, fmt.Sprintf("flow %q not found", id), http.StatusNotFound)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *handlers) getConfig(w http.ResponseWriter, _ *http.Request) {
 	upstreams := h.engine.Router().Upstreams()
 	type upstreamInfo struct {
-		Name   string `json:"name"`
-		Prefix string `json:"prefix"`
-		Target string `json:"target"`
+		Name   string       `json:"name"`
+		Prefix string       `json:"prefix"`
+		Target string       `json:"target"`
+		H2C    bool         `json:"h2c,omitempty"`
+		Rules  []proxy.Rule `json:"rules,omitempty"`
+
+		PrefixRegex string         `json:"prefixRegex,omitempty"`
+		StripPrefix bool           `json:"stripPrefix,omitempty"`
+		RewriteTo   string         `json:"rewriteTo,omitempty"`
+		Targets     []proxy.Target `json:"targets,omitempty"`
 	}
 	infos := make([]upstreamInfo, len(upstreams))
 	for i, u := range upstreams {
-		infos[i] = upstreamInfo{Name: u.Name, Prefix: u.Prefix, Target: u.Target}
+		infos[i] = upstreamInfo{
+			Name: u.Name, Prefix: u.Prefix, Target: u.Target, H2C: u.H2C, Rules: u.Rules,
+			PrefixRegex: u.PrefixRegex, StripPrefix: u.StripPrefix, RewriteTo: u.RewriteTo,
+		}
+		if len(u.Targets) > 1 {
+			infos[i].Targets = u.Targets
+		}
+	}
+	type mockInfo struct {
+		Name   string `json:"name"`
+		Method string `json:"method,omitempty"`
+		Path   string `json:"path"`
+		Status int    `json:"status"`
+	}
+	mocks := h.engine.Mocks()
+	mockInfos := make([]mockInfo, len(mocks))
+	for i, m := range mocks {
+		mockInfos[i] = mockInfo{Name: m.Name, Method: m.Method, Path: m.Path, Status: m.Status}
 	}
 	jsonOK(w, map[string]interface{}{
 		"upstreams": infos,
+		"mocks":     mockInfos,
 		"flows":     h.engine.Store().Count(),
 	})
 }
 
+func (h *handlers) reloadConfig(w http.ResponseWriter, _ *http.Request) {
+	msg, err := h.engine.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w, map[string]string{"message": msg})
+}
+
 func jsonOK(w http.ResponseWriter, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fidiego/http-proxy/pkg/proxy"
+)
+
+func TestSaveSession(t *testing.T) {
+	engine, err := proxy.New(proxy.Options{Upstreams: []proxy.Upstream{{Name: "api", Prefix: "/", Target: "http://localhost:1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.hpz")
+	if err := os.WriteFile(existing, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := &handlers{engine: engine, sessionDir: dir}
+
+	tests := []struct {
+		name     string
+		body     string
+		want     int
+		wantFile string
+	}{
+		{"file name", `{"path": "session.hpz"}`, http.StatusOK, "session.hpz"},
+		{"absolute path", `{"path": "/tmp/x.hpz"}`, http.StatusBadRequest, ""},
+		{"parent directory", `{"path": "../x.hpz"}`, http.StatusBadRequest, ""},
+		{"subdirectory", `{"path": "a/x.hpz"}`, http.StatusBadRequest, ""},
+		{"backslash", `{"path": "a\\x.hpz"}`, http.StatusBadRequest, ""},
+		{"dot dot", `{"path": ".."}`, http.StatusBadRequest, ""},
+		{"existing file", `{"path": "existing.hpz"}`, http.StatusConflict, ""},
+		{"overwrite", `{"path": "existing.hpz", "overwrite": true}`, http.StatusOK, "existing.hpz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.saveSession(w, httptest.NewRequest("POST", "/api/session/save", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.wantFile == "" {
+				return
+			}
+			if want := filepath.Join(dir, tt.wantFile); !strings.Contains(w.Body.String(), want) {
+				t.Errorf("response %s doesn't name %s", w.Body, want)
+			}
+		})
+	}
+	if data, _ := os.ReadFile(existing); string(data) == "keep" {
+		t.Error("overwrite didn't replace the existing file")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "x.hpz")); err == nil {
+		t.Error("a session was written outside the session directory")
+	}
+}
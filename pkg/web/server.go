@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"sync"
 	"time"
 
@@ -24,8 +27,12 @@ var upgrader = websocket.Upgrader{
 type Server struct {
 	engine  *proxy.Engine
 	port    int
+	ln      net.Listener // bound by Listen
 	server  *http.Server
 	hub     *wsHub
+	uiDir   string // serve the UI from here instead of the embedded copy
+
+	sessionDir string // where POST /api/session/save writes
 }
 
 // New creates a new web Server for the given engine.
@@ -38,8 +45,52 @@ func New(engine *proxy.Engine, port int) *Server {
 	return s
 }
 
+// SetUIDir serves the web UI's files from dir instead of the copy embedded in
+// the binary. They are read on every request, so edits show up on reload.
+func (s *Server) SetUIDir(dir string) error {
+	if err := checkUIDir(dir); err != nil {
+		return fmt.Errorf("web UI dir: %w", err)
+	}
+	s.uiDir = dir
+	return nil
+}
+
+// SetSessionDir makes POST /api/session/save write into dir instead of the
+// working directory.
+func (s *Server) SetSessionDir(dir string) { s.sessionDir = dir }
+
+// Listen binds the web server's port, falling back to the next free one if
+// it is busy and the engine's Options.AutoPort is set, and records it with
+// the engine for Info. Start calls it if it hasn't been.
+func (s *Server) Listen() error {
+	if s.ln != nil {
+		return nil
+	}
+	addr := fmt.Sprintf(":%d", s.port)
+	var ln net.Listener
+	var err error
+	if s.engine.Options().AutoPort {
+		ln, err = proxy.ListenAuto(addr)
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("web server: %w", err)
+	}
+	s.ln = ln
+	s.port = ln.Addr().(*net.TCPAddr).Port
+	s.engine.SetWebPort(s.port)
+	return nil
+}
+
+// Port returns the web server's port: the one bound once Listen has run.
+func (s *Server) Port() int { return s.port }
+
 // Start runs the web server until ctx is cancelled.
 func (s *Server) Start(ctx context.Context) error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
 	go s.hub.run()
 
 	// Subscribe to flow events and broadcast them to WebSocket clients.
@@ -65,9 +116,9 @@ func (s *Server) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	s.registerRoutes(mux)
 
+	auth := s.engine.Options().WebAuth
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: corsMiddleware(mux),
+		Handler: corsMiddleware(authMiddleware(auth, mux)),
 	}
 
 	go func() {
@@ -77,40 +128,105 @@ func (s *Server) Start(ctx context.Context) error {
 		_ = s.server.Shutdown(shutCtx)
 	}()
 
-	log.Printf("web UI: http://localhost:%d", s.port)
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if auth.Token != "" {
+		log.Printf("web UI: http://localhost:%d/?token=%s", s.port, url.QueryEscape(auth.Token))
+	} else {
+		log.Printf("web UI: http://localhost:%d", s.port)
+	}
+	if err := s.server.Serve(s.ln); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("web server: %w", err)
 	}
 	return nil
 }
 
 func (s *Server) registerRoutes(mux *http.ServeMux) {
-	h := &handlers{engine: s.engine, hub: s.hub}
+	h := &handlers{engine: s.engine, hub: s.hub, sessionDir: s.sessionDir}
 
-	// REST API
-	mux.HandleFunc("GET /api/flows", h.listFlows)
-	mux.HandleFunc("GET /api/flows/{id}", h.getFlow)
-	mux.HandleFunc("POST /api/flows/{id}/replay", h.replayFlow)
-	mux.HandleFunc("DELETE /api/flows", h.clearFlows)
-	mux.HandleFunc("GET /api/config", h.getConfig)
+	// REST API. The web UI uses /api; /api/v1 serves the same routes under a
+	// versioned prefix whose shape is kept stable for scripts and pkg/client.
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		api := func(method, path string, handler http.HandlerFunc) {
+			mux.HandleFunc(method+" "+prefix+path, handler)
+		}
+		api("GET", "/flows", h.listFlows)
+		api("GET", "/flows/{id}", h.getFlow)
+		api("PATCH", "/flows/{id}", h.patchFlow)
+		api("GET", "/flows/groups", h.groupFlows)
+		api("GET", "/flows/{a}/diff/{b}", h.diffFlows)
+		api("GET", "/flows/{id}/export", h.exportFlow)
+		api("GET", "/flows/{id}/parts", h.listParts)
+		api("GET", "/flows/{id}/parts/{n}", h.getPart)
+		api("GET", "/flows/{id}/pretty", h.getPretty)
+		api("POST", "/flows/{id}/replay", h.replayFlow)
+		api("POST", "/flows/replay", h.bulkReplay)
+		api("POST", "/flows/curl", h.importRequest)
+		api("POST", "/requests", h.composeRequest)
+		api("GET", "/jobs", h.listJobs)
+		api("POST", "/jobs/{name}/run", h.runJob)
+		api("GET", "/jobs/{id}", h.getJob)
+		api("DELETE", "/jobs/{id}", h.cancelJob)
+		api("POST", "/flows/{id}/resume", h.resumeFlow)
+		api("POST", "/flows/{id}/kill", h.killFlow)
+		api("PATCH", "/flows/{id}/request", h.editRequest)
+		api("PATCH", "/flows/{id}/response", h.editResponse)
+		api("POST", "/flows/{id}/tags", h.tagFlow)
+		api("DELETE", "/flows", h.clearFlows)
+		api("DELETE", "/flows/{id}", h.deleteFlow)
+		api("GET", "/export", h.exportFlows)
+		api("GET", "/flows/export", h.exportFlows)
+		api("POST", "/session/save", h.saveSession)
+		api("GET", "/config", h.getConfig)
+		api("POST", "/config/reload", h.reloadConfig)
+		api("GET", "/intercept", h.getIntercept)
+		api("PUT", "/intercept", h.setIntercept)
+		api("GET", "/breakpoints", h.listBreakpoints)
+		api("POST", "/breakpoints", h.addBreakpoint)
+		api("DELETE", "/breakpoints/{id}", h.deleteBreakpoint)
+		api("GET", "/overrides", h.listOverrides)
+		api("POST", "/overrides", h.addOverride)
+		api("DELETE", "/overrides/{id}", h.deleteOverride)
+		api("GET", "/network", h.getNetwork)
+		api("PUT", "/network", h.setNetwork)
+		api("GET", "/stats", h.getStats)
+		api("GET", "/shadow/report", h.getShadowReport)
+		api("DELETE", "/shadow/report", h.resetShadowReport)
+		api("GET", "/processes", h.listProcesses)
+		api("GET", "/processes/logs", h.processLogs)
+		api("POST", "/processes/{name}/restart", h.restartProcess)
+		api("GET", "/logs", h.getLogs)
+		api("GET", "/info", h.getInfo)
+		api("GET", "/addons", h.listAddons)
+		api("POST", "/addons", h.patchAddon)
+		api("GET", "/views", h.listViews)
+		api("PUT", "/views/{name}", h.saveView)
+		api("DELETE", "/views/{name}", h.deleteView)
+	}
 
-	// WebSocket
+	// WebSocket, also at /api/v1/events for API clients
 	mux.HandleFunc("GET /ws", s.handleWS)
+	mux.HandleFunc("GET /api/v1/events", s.handleWS)
 
-	// Embedded HTML UI (root)
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
+	// Web UI: index.html at the root, its assets beside it
+	ui, fromDisk := embeddedUI(), s.uiDir != ""
+	if fromDisk {
+		ui = os.DirFS(s.uiDir)
+		log.Printf("web UI: serving files from %s", s.uiDir)
+	}
+	files := http.FileServerFS(ui)
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		if fromDisk {
+			w.Header().Set("Cache-Control", "no-cache")
 		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		data, _ := staticFS.ReadFile("static/index.html")
-		w.Write(data)
+		files.ServeHTTP(w, r)
 	})
 }
 
 func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	up := upgrader
+	if s.engine.Options().WebAuth.Enabled() {
+		up.CheckOrigin = sameOrigin
+	}
+	conn, err := up.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
@@ -124,8 +240,8 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
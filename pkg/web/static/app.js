@@ -0,0 +1,1522 @@
+const flows = new Map();  // id -> flow
+let filteredIds = [];
+let selectedId = null;
+let checkedIds = [];  // flows checked for Compare, at most two
+let filterExpr = '';
+let interceptOn = false;
+
+// --- WebSocket ---
+let ws;
+function connect() {
+  ws = new WebSocket('ws://' + location.host + '/ws');
+  ws.onopen = () => { document.getElementById('ws-dot').className = 'dot live'; };
+  ws.onclose = () => {
+    document.getElementById('ws-dot').className = 'dot';
+    setTimeout(connect, 2000);
+  };
+  ws.onmessage = e => {
+    const evt = JSON.parse(e.data);
+    handleFlowEvent(evt);
+  };
+}
+
+function handleFlowEvent(evt) {
+  if (evt.type === 'reload' || evt.type === 'process' || evt.type === 'upstream' || evt.type === 'shutdown') {
+    notify(evt.message);
+    return;
+  }
+  if (evt.type === 'job') {
+    const j = evt.job;
+    if (j.schedule) {
+      // Scheduled runs report in the Jobs panel; only failures raise a notice.
+      if (document.getElementById('jobs-panel').style.display !== 'none') loadJobs();
+      if (j.state !== 'running' && (j.failed || !j.total)) {
+        notify('Scheduled job ' + j.schedule + ' failed: ' + (j.total ? j.failed + '/' + j.total + ' replays' : 'no flows to replay'));
+      }
+      return;
+    }
+    notify('Replay job: ' + j.done + '/' + j.total + (j.failed ? ' (' + j.failed + ' failed)' : '') +
+      (j.state === 'running' ? '' : ' — ' + j.state));
+    return;
+  }
+  if (evt.type === 'delete' || evt.type === 'evict') {
+    for (const id of evt.ids || []) flows.delete(id);
+    checkedIds = checkedIds.filter(id => flows.has(id));
+    if (selectedId && !flows.has(selectedId)) { selectedId = null; resetDetail(); }
+  } else if (evt.type === 'new') {
+    flows.set(evt.flow.id, evt.flow);
+  } else if (evt.flow) {
+    flows.set(evt.flow.id, evt.flow);
+    if (selectedId === evt.flow.id) renderDetail(evt.flow);
+  }
+  applyFilter();
+  updateStats();
+}
+
+// --- Filter ---
+// Filter expressions are evaluated by the server (GET /api/flows?filter=), so
+// the full filter language works here. Matches are re-queried, debounced, as
+// the expression or the flows change; only their IDs are fetched.
+let filterTimer = null;
+let idsStale = false; // without a filter, filteredIds needs rebuilding from flows
+
+document.getElementById('filter-input').addEventListener('input', function() {
+  filterExpr = this.value.trim();
+  syncViewSelect();
+  applyFilter();
+});
+
+function applyFilter() {
+  clearTimeout(filterTimer);
+  if (!filterExpr) {
+    idsStale = true;
+    setFilterError('');
+    renderTable();
+    return;
+  }
+  filterTimer = setTimeout(queryFilter, 150);
+}
+
+async function queryFilter() {
+  const expr = filterExpr;
+  const r = await fetch('/api/flows?ids=true&filter=' + encodeURIComponent(expr));
+  if (expr !== filterExpr) return; // superseded by a newer expression
+  if (!r.ok) { setFilterError(await r.text()); return; }
+  setFilterError('');
+  const page = await r.json();
+  filteredIds = (page.ids || []).filter(id => flows.has(id));
+  renderTable();
+}
+
+// --- Stats ---
+// The stats panel polls GET /api/stats while it is open.
+let statsTimer = null;
+let statsWindow = 0;
+
+function toggleStats() {
+  const panel = document.getElementById('stats-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? '' : 'none';
+  document.getElementById('stats-btn').className = 'btn' + (open ? ' active' : '');
+  clearInterval(statsTimer);
+  if (open) {
+    loadStats();
+    statsTimer = setInterval(loadStats, 2000);
+  }
+}
+
+function setStatsWindow(i) {
+  statsWindow = i;
+  loadStats();
+}
+
+async function loadStats() {
+  const r = await fetch('/api/stats');
+  if (!r.ok) return;
+  const st = await r.json();
+  const row = (name, w, cls) => '<tr class="'+(cls||'')+'"><td>'+escHtml(name)+'</td><td>'+w.requests+'</td>'+
+    '<td>'+w.rate.toFixed(2)+'</td>'+
+    '<td class="'+(w.errors ? 'status-5xx' : '')+'">'+(w.errorRate*100).toFixed(1)+'%</td>'+
+    '<td>'+fmtMs(w.p50)+'</td><td>'+fmtMs(w.p95)+'</td><td>'+fmtMs(w.p99)+'</td>'+
+    '<td>'+fmtSize(w.bytesIn)+'</td><td>'+fmtSize(w.bytesOut)+'</td></tr>';
+  let h = '<div style="margin-bottom:6px">Window: ' + st.global.map((w, i) =>
+    '<button class="btn'+(i === statsWindow ? ' active' : '')+'" onclick="setStatsWindow('+i+')">'+w.window+'</button>').join(' ') + '</div>';
+  h += '<table><thead><tr><th>Upstream</th><th>Requests</th><th>Req/s</th><th>Errors</th><th>p50</th><th>p95</th><th>p99</th><th>In</th><th>Out</th></tr></thead><tbody>';
+  for (const u of st.upstreams) h += row(u.upstream, u.windows[statsWindow]);
+  h += row('all', st.global[statsWindow], 'total');
+  h += '</tbody></table>';
+  const sampled = st.global[statsWindow].sampledOut;
+  if (sampled) h += '<div style="margin-top:6px; color: var(--fg2)">'+sampled+' of these requests were not stored (sample_rate)</div>';
+  const store = st.store;
+  h += '<div style="margin-top:6px; color: var(--fg2)">Store: '+store.flows+' flows, '+fmtSize(store.bodyBytes)+' of bodies in memory'+
+    (store.sharedRefs ? '; '+store.sharedRefs+' bodies share '+store.sharedBodies+' copies, saving '+fmtSize(store.dedupSavedBytes) : '')+'</div>';
+  const endpoints = st.endpoints.filter(ep => ep.windows[statsWindow].requests);
+  if (endpoints.length) {
+    h += '<table style="margin-top:8px"><thead><tr><th>Endpoint</th><th>Requests</th><th>Req/s</th><th>Errors</th><th>p50</th><th>p95</th><th>p99</th><th>In</th><th>Out</th></tr></thead><tbody>';
+    for (const ep of endpoints) h += row(ep.upstream+'  '+ep.method+' '+ep.path, ep.windows[statsWindow]);
+    h += '</tbody></table>';
+  }
+  document.getElementById('stats-panel').innerHTML = h;
+}
+
+// --- Groups ---
+// The groups panel polls GET /api/flows/groups for the filtered flows while
+// it is open, collapsing repeated requests (polling, retries) into one row.
+let groupsTimer = null;
+
+function toggleGroups() {
+  const panel = document.getElementById('groups-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? '' : 'none';
+  document.getElementById('groups-btn').className = 'btn' + (open ? ' active' : '');
+  clearInterval(groupsTimer);
+  if (open) {
+    loadGroups();
+    groupsTimer = setInterval(loadGroups, 2000);
+  }
+}
+
+async function loadGroups() {
+  const r = await fetch('/api/flows/groups?filter=' + encodeURIComponent(filterExpr));
+  if (!r.ok) return;
+  const groups = await r.json();
+  const cls = sc => sc >= 500 ? 'status-5xx' : sc >= 400 ? 'status-4xx' : sc >= 300 ? 'status-3xx' : sc ? 'status-2xx' : '';
+  const statuses = st => Object.entries(st).sort((a, b) => b[1] - a[1] || a[0] - b[0])
+    .map(([code, n]) => '<span class="'+cls(+code)+'">'+(code === '0' ? '-' : code)+'</span>×'+n).join(' ');
+  let h = '<table><thead><tr><th>Method</th><th>Path</th><th>Count</th><th>Statuses</th><th>Errors</th><th>p50</th><th>p95</th><th>Max</th></tr></thead><tbody>';
+  for (const g of groups) {
+    h += '<tr onclick="selectFlow(\''+g.latest+'\')" title="'+escHtml(g.signature)+' (click: newest flow)">'+
+      '<td>'+escHtml(g.method)+'</td>'+
+      '<td>'+escHtml(g.path)+(g.bodyHash ? ' <span style="color:var(--fg2)">#'+g.bodyHash+'</span>' : '')+'</td>'+
+      '<td>'+g.count+'</td><td>'+statuses(g.statuses)+'</td>'+
+      '<td class="'+(g.errors ? 'status-5xx' : '')+'">'+g.errors+'</td>'+
+      '<td>'+fmtMs(g.p50)+'</td><td>'+fmtMs(g.p95)+'</td><td>'+fmtMs(g.max)+'</td></tr>';
+  }
+  h += '</tbody></table>';
+  if (!groups.length) h = '<div style="color: var(--fg2)">No flows match the filter</div>';
+  document.getElementById('groups-panel').innerHTML = h;
+}
+
+// --- Header overrides ---
+// Runtime rules that set (or, with no value, remove) a request header on
+// matching flows before they are forwarded, until removed.
+function toggleOverrides() {
+  const panel = document.getElementById('overrides-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? '' : 'none';
+  document.getElementById('overrides-btn').className = 'btn' + (open ? ' active' : '');
+  if (open) loadOverrides();
+}
+
+async function loadOverrides() {
+  const r = await fetch('/api/overrides');
+  if (!r.ok) return;
+  const list = await r.json();
+  let h = '';
+  if (list.length) {
+    h += '<table style="margin-bottom:6px"><thead><tr><th>Header</th><th>Value</th><th>Flows</th><th></th></tr></thead><tbody>';
+    for (const o of list) {
+      h += '<tr><td>'+escHtml(o.header)+'</td>'+
+        '<td>'+(o.value ? escHtml(o.value) : '<span style="color:var(--fg2)">(removed)</span>')+'</td>'+
+        '<td>'+escHtml(o.filter || 'all')+'</td>'+
+        '<td><button class="btn" onclick="deleteOverride(\''+escHtml(o.id)+'\')" title="Remove override">✕</button></td></tr>';
+    }
+    h += '</tbody></table>';
+  }
+  h += '<input id="ov-header" placeholder="Header" size="20"> '+
+    '<input id="ov-value" placeholder="value (empty removes it)" size="24"> '+
+    '<input id="ov-filter" placeholder="flows (empty = all)" size="30" value="'+
+    escHtml(document.getElementById('filter-input').value.trim())+'"> '+
+    '<button class="btn" onclick="addOverride()">Add</button>';
+  document.getElementById('overrides-panel').innerHTML = h;
+}
+
+async function addOverride() {
+  const body = {
+    header: document.getElementById('ov-header').value.trim(),
+    value: document.getElementById('ov-value').value.trim(),
+    filter: document.getElementById('ov-filter').value.trim(),
+  };
+  if (!body.header) return;
+  const r = await fetch('/api/overrides', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Override failed: ' + await r.text()); return; }
+  loadOverrides();
+}
+
+async function deleteOverride(id) {
+  const r = await fetch('/api/overrides/' + encodeURIComponent(id), { method: 'DELETE' });
+  if (!r.ok) { notify('Remove failed: ' + await r.text()); return; }
+  loadOverrides();
+}
+
+// --- Network simulation ---
+// Profiles that delay, throttle, and occasionally reset requests, set for
+// all upstreams or per upstream until the config is reloaded.
+function toggleNetwork() {
+  const panel = document.getElementById('network-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? '' : 'none';
+  if (open) loadNetwork(); else updateNetworkBtn(null);
+}
+
+function updateNetworkBtn(st) {
+  const open = document.getElementById('network-panel').style.display !== 'none';
+  const btn = document.getElementById('network-btn');
+  btn.className = 'btn' + (open ? ' active' : '');
+  if (st) btn.textContent = st.global ? 'Network: ' + st.global : 'Network';
+}
+
+async function loadNetwork() {
+  const [rn, rc] = await Promise.all([fetch('/api/network'), fetch('/api/config')]);
+  if (!rn.ok || !rc.ok) return;
+  const st = await rn.json();
+  const cfg = await rc.json();
+  const kbps = k => !k ? '∞' : k >= 1000 ? (k/1000).toFixed(1)+' Mb/s' : k+' kb/s';
+  const select = (upstream, cur, none) => '<select onchange="setNetwork(\''+escHtml(upstream)+'\', this.value)">'+
+    '<option value="">'+none+'</option>'+st.profiles.map(p =>
+      '<option'+(p.name === cur ? ' selected' : '')+'>'+escHtml(p.name)+'</option>').join('')+'</select>';
+  let h = '<table style="margin-bottom:6px"><thead><tr><th>Upstream</th><th>Profile</th></tr></thead><tbody>';
+  h += '<tr><td>all upstreams</td><td>'+select('', st.global, 'off')+'</td></tr>';
+  for (const u of cfg.upstreams) {
+    const none = st.global ? 'same as all ('+escHtml(st.global)+')' : 'same as all (off)';
+    h += '<tr><td>'+escHtml(u.name)+'</td><td>'+select(u.name, st.upstreams[u.name] || '', none)+'</td></tr>';
+  }
+  h += '</tbody></table>';
+  h += '<table><thead><tr><th>Profile</th><th>Latency</th><th>Jitter</th><th>Down</th><th>Up</th><th>Reset</th></tr></thead><tbody>';
+  for (const p of st.profiles) {
+    h += '<tr><td>'+escHtml(p.name)+'</td><td>'+(p.latencyMs||0)+'ms</td><td>±'+(p.jitterMs||0)+'ms</td>'+
+      '<td>'+kbps(p.downloadKbps)+'</td><td>'+kbps(p.uploadKbps)+'</td><td>'+((p.resetRate||0)*100).toFixed(0)+'%</td></tr>';
+  }
+  h += '</tbody></table>';
+  document.getElementById('network-panel').innerHTML = h;
+  updateNetworkBtn(st);
+}
+
+async function setNetwork(upstream, profile) {
+  const r = await fetch('/api/network', {
+    method: 'PUT', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({upstream, profile}),
+  });
+  if (!r.ok) { notify('Network profile failed: ' + await r.text()); return; }
+  loadNetwork();
+}
+
+// --- Breakpoints ---
+// Standing filters that pause matching flows before they are forwarded, or
+// before their response is returned, until resumed or killed.
+function toggleBreakpoints() {
+  const panel = document.getElementById('breakpoints-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? '' : 'none';
+  document.getElementById('breakpoints-btn').className = 'btn' + (open ? ' active' : '');
+  if (open) loadBreakpoints();
+}
+
+async function loadBreakpoints() {
+  const r = await fetch('/api/breakpoints');
+  if (!r.ok) return;
+  const list = await r.json();
+  let h = '';
+  if (list.length) {
+    h += '<table style="margin-bottom:6px"><thead><tr><th>Pause at</th><th>Flows</th><th></th></tr></thead><tbody>';
+    for (const b of list) {
+      h += '<tr><td>'+escHtml(b.phase)+'</td>'+
+        '<td>'+escHtml(b.filter || 'all')+'</td>'+
+        '<td><button class="btn" onclick="deleteBreakpoint(\''+escHtml(b.id)+'\')" title="Remove breakpoint">✕</button></td></tr>';
+    }
+    h += '</tbody></table>';
+  }
+  h += '<select id="bp-phase"><option value="request">request</option><option value="response">response</option></select> '+
+    '<input id="bp-filter" placeholder="flows (empty = all)" size="40" value="'+
+    escHtml(document.getElementById('filter-input').value.trim())+'"> '+
+    '<button class="btn" onclick="addBreakpoint()">Add</button>';
+  document.getElementById('breakpoints-panel').innerHTML = h;
+}
+
+async function addBreakpoint() {
+  const body = {
+    phase: document.getElementById('bp-phase').value,
+    filter: document.getElementById('bp-filter').value.trim(),
+  };
+  const r = await fetch('/api/breakpoints', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Breakpoint failed: ' + await r.text()); return; }
+  loadBreakpoints();
+}
+
+async function deleteBreakpoint(id) {
+  const r = await fetch('/api/breakpoints/' + encodeURIComponent(id), { method: 'DELETE' });
+  if (!r.ok) { notify('Remove failed: ' + await r.text()); return; }
+  loadBreakpoints();
+}
+
+// --- Scheduled jobs ---
+// Replays from the config file run on a schedule as smoke tests. Clicking a
+// job filters the table to its replays; Run starts a run now.
+function toggleJobs() {
+  const panel = document.getElementById('jobs-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? '' : 'none';
+  document.getElementById('jobs-btn').className = 'btn' + (open ? ' active' : '');
+  if (open) loadJobs();
+}
+
+async function loadJobs() {
+  const r = await fetch('/api/jobs');
+  if (!r.ok) return;
+  const list = await r.json();
+  if (!list.length) {
+    document.getElementById('jobs-panel').innerHTML =
+      '<div style="color: var(--fg2)">No scheduled jobs; add them under jobs: in the config file</div>';
+    return;
+  }
+  const cls = res => res === 'pass' ? 'status-2xx' : res === 'fail' ? 'status-5xx' : '';
+  let h = '<table><thead><tr><th>Job</th><th>Flows</th><th>Every</th><th>Expect</th><th>Result</th><th>Last run</th><th>Runs</th><th>Next</th><th></th></tr></thead><tbody>';
+  for (const j of list) {
+    const run = j.lastRun;
+    let last = '-';
+    if (run) last = run.state === 'running' ? 'running ' + run.done + '/' + run.total
+      : (run.total - run.failed) + '/' + run.total + ' passed at ' + new Date(run.finished).toLocaleTimeString();
+    if (run && run.failedChecks) last += ' — ' + Object.entries(run.failedChecks).map(([c, n]) => c + ': ' + n).join(', ');
+    const flowsDesc = [j.filter, j.flows && j.flows.length ? j.flows.length + ' by ID' : ''].filter(Boolean).join(' + ');
+    h += '<tr onclick="showJobFlows(\''+escHtml(j.name)+'\')" title="Show this job\'s replays">'+
+      '<td>'+escHtml(j.name)+'</td><td>'+escHtml(flowsDesc)+(j.target ? ' → '+escHtml(j.target) : '')+'</td>'+
+      '<td>'+fmtEvery(j.intervalMs)+'</td><td>'+escHtml((j.expect || []).join(', ') || 'original')+(j.assert ? ' + assertions' : '')+'</td>'+
+      '<td class="'+cls(j.result)+'">'+escHtml(j.result)+'</td><td>'+escHtml(last)+'</td>'+
+      '<td>'+j.runs+(j.failures ? ' ('+j.failures+' failed)' : '')+'</td>'+
+      '<td>'+(j.next ? new Date(j.next).toLocaleTimeString() : '-')+'</td>'+
+      '<td><button class="btn" onclick="event.stopPropagation(); runJob(\''+escHtml(j.name)+'\')">Run</button></td></tr>';
+  }
+  h += '</tbody></table>';
+  document.getElementById('jobs-panel').innerHTML = h;
+}
+
+function showJobFlows(name) {
+  const expr = '~t schedule:' + name;
+  document.getElementById('filter-input').value = expr;
+  filterExpr = expr;
+  syncViewSelect();
+  applyFilter();
+}
+
+// fmtEvery formats a job interval in its largest whole unit.
+function fmtEvery(ms) {
+  if (ms % 3600000 === 0) return ms/3600000 + 'h';
+  if (ms % 60000 === 0) return ms/60000 + 'm';
+  return ms/1000 + 's';
+}
+
+async function runJob(name) {
+  const r = await fetch('/api/jobs/' + encodeURIComponent(name) + '/run', { method: 'POST' });
+  if (!r.ok) { notify('Run failed: ' + await r.text()); return; }
+  loadJobs();
+}
+
+function fmtMs(ms) {
+  if (ms < 1) return ms ? Math.round(ms*1000) + 'µs' : '-';
+  return fmtDur(Math.round(ms));
+}
+
+// --- Views ---
+// Views are named filters, from the config file or saved here. Saved views
+// live in the server's state file, so they are shared with the TUI.
+let views = [];
+
+async function loadViews() {
+  const r = await fetch('/api/views');
+  if (!r.ok) return;
+  views = await r.json();
+  const sel = document.getElementById('view-select');
+  sel.innerHTML = '<option value="">Views…</option>' + views.map(v =>
+    '<option value="'+escHtml(v.name)+'">'+escHtml(v.name)+(v.saved ? '' : ' (config)')+'</option>').join('');
+  syncViewSelect();
+}
+
+function selectView(name) {
+  const v = views.find(v => v.name === name);
+  if (v) {
+    document.getElementById('filter-input').value = v.filter;
+    filterExpr = v.filter;
+    applyFilter();
+  }
+  syncViewSelect();
+}
+
+// syncViewSelect shows the view whose filter is the current expression.
+function syncViewSelect() {
+  const sel = document.getElementById('view-select');
+  const cur = views.find(v => v.name === sel.value && v.filter === filterExpr) ||
+    views.find(v => v.filter === filterExpr && filterExpr);
+  sel.value = cur ? cur.name : '';
+  document.getElementById('view-del-btn').style.display = cur && cur.saved ? '' : 'none';
+}
+
+async function saveView() {
+  if (!filterExpr) { notify('Enter a filter to save first'); return; }
+  const sel = document.getElementById('view-select');
+  const name = (prompt('Save filter "' + filterExpr + '" as view:', sel.value) || '').trim();
+  if (!name) return;
+  const r = await fetch('/api/views/'+encodeURIComponent(name), {
+    method: 'PUT', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({filter: filterExpr}),
+  });
+  if (!r.ok) { notify('Save failed: ' + await r.text()); return; }
+  await loadViews();
+  sel.value = name;
+  syncViewSelect();
+  notify('Saved view ' + name);
+}
+
+async function deleteView() {
+  const name = document.getElementById('view-select').value;
+  if (!name) return;
+  const r = await fetch('/api/views/'+encodeURIComponent(name), {method:'DELETE'});
+  if (!r.ok) { notify('Delete failed: ' + await r.text()); return; }
+  await loadViews();
+  notify('Deleted view ' + name);
+}
+
+function setFilterError(msg) {
+  const input = document.getElementById('filter-input');
+  input.classList.toggle('invalid', !!msg);
+  input.title = msg.trim();
+}
+
+// --- Table rendering ---
+// The table is virtualized: only the rows in view, plus a margin, are in the
+// DOM, between two spacer rows that keep the scrollbar honest. Renders are
+// coalesced to one per animation frame, and a row is rebuilt only when its
+// flow or position changes.
+const rowOverscan = 20;
+let rowHeight = 0;           // measured from the first rendered row
+let renderPending = false;
+const rowCache = new Map();  // id -> {f, key, tr}
+
+function renderTable() {
+  if (renderPending) return;
+  renderPending = true;
+  requestAnimationFrame(() => { renderPending = false; drawTable(); });
+}
+
+document.getElementById('flow-table-wrap').addEventListener('scroll', renderTable);
+window.addEventListener('resize', renderTable);
+
+function drawTable() {
+  if (idsStale && !filterExpr) filteredIds = [...flows.keys()];
+  idsStale = false;
+  const tbody = document.getElementById('flow-tbody');
+  const empty = document.getElementById('empty');
+  const total = filteredIds.length;
+  if (total === 0) {
+    tbody.replaceChildren();
+    rowCache.clear();
+    empty.style.display = 'block';
+    return;
+  }
+  empty.style.display = 'none';
+  const wrap = document.getElementById('flow-table-wrap');
+  const h = rowHeight || 27;
+  const first = Math.max(0, Math.floor(wrap.scrollTop / h) - rowOverscan);
+  const last = Math.min(total, Math.ceil((wrap.scrollTop + wrap.clientHeight) / h) + rowOverscan);
+  // Render newest-first for easy inspection: row i shows filteredIds[total-1-i].
+  const rows = [spacerRow(first * h)];
+  const shown = new Set();
+  for (let i = first; i < last; i++) {
+    const id = filteredIds[total - 1 - i];
+    if (!flows.has(id)) { rows.push(spacerRow(h)); continue; } // deleted; the filter catches up
+    rows.push(flowRow(id, total - i));
+    shown.add(id);
+  }
+  rows.push(spacerRow((total - last) * h));
+  for (const id of rowCache.keys()) if (!shown.has(id)) rowCache.delete(id);
+  tbody.replaceChildren(...rows);
+  if (!rowHeight && rows.length > 2) rowHeight = rows[1].offsetHeight;
+}
+
+function spacerRow(height) {
+  const tr = document.createElement('tr');
+  tr.className = 'spacer';
+  tr.innerHTML = '<td colspan="7" style="height:'+height+'px"></td>';
+  return tr;
+}
+
+// flowRow returns the row for flow id, numbered n, reusing the cached row
+// when nothing it shows has changed. Active flows show a running duration,
+// so they are always rebuilt.
+function flowRow(id, n) {
+  const f = flows.get(id);
+  const tagged = t => (f.tags || []).includes(t);
+  const cls = 'flow-row' + (id === selectedId ? ' selected' : '') + (checkedIds.includes(id) ? ' checked' : '') +
+    (tagged('alert:latency') || tagged('alert:status') ? ' alert' : '') +
+    (f.state === 'rejected' ? ' rejected' : '');
+  const key = n + cls;
+  const cached = rowCache.get(id);
+  if (cached && cached.f === f && cached.key === key && f.state !== 'active') return cached.tr;
+
+  const method = f.request?.method || '-';
+  const path = f.request?.path || '/';
+  const upstream = f.upstream || '-';
+  let statusHtml = f.state === 'intercepted'
+    ? '<span class="status-paused">PAUSED</span>'
+    : f.state === 'active'
+    ? '<span class="status-pending">PENDING</span>'
+    : '<span class="status-err">ERR</span>';
+  if (f.response) {
+    const sc = f.response.statusCode;
+    const cls = sc >= 500 ? 'status-5xx' : sc >= 400 ? 'status-4xx' : sc >= 300 ? 'status-3xx' : 'status-2xx';
+    statusHtml = '<span class="'+cls+'">'+sc+'</span>';
+  }
+  if (tagged('alert:status')) statusHtml = '<span class="alert-hit">'+statusHtml+'</span>';
+  const dur = fmtDur(durationMs(f));
+  const size = f.response ? fmtSize(wireSize(f.response)) : '-';
+  const tags = (f.tags || []).map(t => '<span class="tag">'+escHtml(t)+'</span>').join(' ');
+  const tr = document.createElement('tr');
+  tr.className = cls;
+  tr.dataset.id = id;
+  tr.onclick = e => rowClick(e, id);
+  tr.innerHTML =
+    '<td>'+(f.pinned ? '★' : '')+n+'</td>'+
+    '<td class="method">'+escHtml(method)+'</td>'+
+    '<td>'+statusHtml+'</td>'+
+    '<td>'+escHtml(upstream)+'</td>'+
+    '<td class="path-col" title="'+escHtml(path)+'">'+escHtml(path)+'</td>'+
+    '<td'+(tagged('alert:latency') ? ' class="alert-hit"' : '')+'>'+dur+'</td>'+
+    '<td>'+size+' '+tags+'<span class="row-del" title="Delete flow" onclick="deleteFlow(event, \''+id+'\')">×</span></td>';
+  rowCache.set(id, {f, key, tr});
+  return tr;
+}
+
+// rowClick selects a flow; ctrl/cmd-click checks it for Compare instead.
+function rowClick(e, id) {
+  if (e.ctrlKey || e.metaKey) {
+    checkedIds = checkedIds.includes(id) ? checkedIds.filter(x => x !== id) : [...checkedIds, id].slice(-2);
+    document.getElementById('compare-btn').textContent = 'Compare' + (checkedIds.length ? ' ('+checkedIds.length+'/2)' : '');
+    renderTable();
+    return;
+  }
+  selectFlow(id);
+}
+
+function updateStats() {
+  document.getElementById('stats').textContent = flows.size + ' flows';
+}
+
+// --- Detail ---
+function selectFlow(id) {
+  selectedId = id;
+  renderTable(); // refresh selection highlight
+  const f = flows.get(id);
+  if (!f) return;
+  renderDetail(f);
+  document.getElementById('replay-btn').style.display = '';
+  document.getElementById('edit-btn').style.display = '';
+  document.getElementById('curl-btn').style.display = '';
+  document.getElementById('gotest-btn').style.display = '';
+  document.getElementById('tag-btn').style.display = '';
+  document.getElementById('note-btn').style.display = '';
+  document.getElementById('pin-btn').style.display = '';
+  document.getElementById('mark-btn').style.display = '';
+  document.getElementById('diff-btn').style.display = '';
+}
+
+function renderDetail(f) {
+  const sc = f.response?.statusCode;
+  let statusHtml = '';
+  if (sc) {
+    const cls = sc>=500?'status-5xx':sc>=400?'status-4xx':sc>=300?'status-3xx':'status-2xx';
+    statusHtml = ' → <span class="'+cls+'">'+sc+'</span>';
+  }
+  document.getElementById('detail-title').innerHTML =
+    '<strong>'+escHtml(f.request?.method||'-')+'</strong> '+escHtml(f.request?.path||'/')+statusHtml+
+    ' <span style="color:var(--fg2);font-size:11px">['+fmtDur(durationMs(f))+']</span>';
+
+  document.getElementById('pin-btn').textContent = f.pinned ? 'Unpin' : 'Pin';
+  const paused = f.state === 'intercepted';
+  document.getElementById('resume-btn').style.display = paused ? '' : 'none';
+  document.getElementById('kill-btn').style.display = paused ? '' : 'none';
+  // A flow paused at a response breakpoint has a response to edit; its
+  // request was already sent.
+  const pausedReq = paused && !f.response, pausedResp = paused && !!f.response;
+  // Don't clobber an edit in progress when the flow is re-broadcast.
+  const form = document.getElementById('edit-form');
+  const editing = form && form.dataset.id === f.id && (pausedReq || form.dataset.mode === 'replay');
+  if (!editing) {
+    document.getElementById('req-pane').innerHTML = pausedReq ? renderEditForm(f, 'resume') : renderRequestPane(f);
+  }
+  const respForm = document.getElementById('resp-edit-form');
+  if (!(pausedResp && respForm && respForm.dataset.id === f.id)) {
+    document.getElementById('resp-pane').innerHTML = pausedResp ? renderResponseEditForm(f) : renderResponsePane(f);
+  }
+}
+
+// renderResponseEditForm renders the editable response of a flow paused at a
+// response breakpoint.
+function renderResponseEditForm(f) {
+  const r = f.response;
+  let hdrs = '';
+  for (const [k, vv] of Object.entries(r.headers||{})) {
+    for (const v of vv) hdrs += k + ': ' + v + '\n';
+  }
+  let h = '<h3>Response (paused at breakpoint)</h3>';
+  h += '<form class="edit-form" id="resp-edit-form" data-id="'+escHtml(f.id)+'" onsubmit="saveResponseAndResume(event)">';
+  h += '<label>Status</label><input name="status" value="'+r.statusCode+'">';
+  h += '<label>Headers</label><textarea name="headers">'+escHtml(hdrs)+'</textarea>';
+  h += '<label>Body</label><textarea name="body">'+escHtml(atob_safe(r.body))+'</textarea>';
+  if (r.bodyTruncated) h += '<span style="color:var(--red);font-size:11px">… body truncated; saving replaces all of it</span>';
+  h += '<div style="margin-top:8px"><button class="replay-btn" type="submit">Save &amp; Resume</button></div>';
+  h += '</form>';
+  return h;
+}
+
+// renderEditForm renders an editable request. mode is 'resume' for an
+// intercepted flow or 'replay' to send an edited copy as a new flow.
+function renderEditForm(f, mode) {
+  const r = f.request || {};
+  let hdrs = '';
+  for (const [k, vv] of Object.entries(r.headers||{})) {
+    for (const v of vv) hdrs += k + ': ' + v + '\n';
+  }
+  const replay = mode === 'replay';
+  let h = '<h3>Request ('+(replay ? 'edit &amp; replay' : 'intercepted')+')</h3>';
+  h += '<form class="edit-form" id="edit-form" data-id="'+escHtml(f.id)+'" data-mode="'+mode+'" onsubmit="'+(replay ? 'sendEdited' : 'saveAndResume')+'(event)">';
+  h += '<label>Method</label><input name="method" value="'+escHtml(r.method||'')+'">';
+  h += '<label>URL</label><input name="url" value="'+escHtml(r.url||'')+'">';
+  h += '<label>Headers</label><textarea name="headers">'+escHtml(hdrs)+'</textarea>';
+  h += '<label>Body</label><textarea name="body">'+escHtml(atob_safe(r.body))+'</textarea>';
+  if (replay) h += '<label>Target</label><input name="target" placeholder="upstream name or base URL (default: '+escHtml(f.upstream||'routed')+')">';
+  h += '<div style="margin-top:8px"><button class="replay-btn" type="submit">'+(replay ? 'Send' : 'Save &amp; Resume')+'</button>';
+  if (replay) h += ' <button class="curl-btn" type="button" onclick="cancelEdit()">Cancel</button>';
+  h += '</div>';
+  h += '</form>';
+  return h;
+}
+
+function renderRequestPane(f) {
+  if (!f.request) return '<div class="empty">No request data</div>';
+  const r = f.request;
+  let h = '<h3>Request</h3>';
+  if (f.note) h += '<div class="section"><div class="section-title">Note</div><pre class="body">'+escHtml(f.note)+'</pre></div>';
+  h += renderReplayLinks(f);
+  h += '<div class="section"><div class="section-title">'+escHtml(r.method)+' '+escHtml(r.url)+'</div></div>';
+  h += renderHeaders(r.headers);
+  h += renderPairs(r.query, 'Query');
+  h += renderPairs(r.cookies, 'Cookies');
+  h += renderPairs([
+    {name: 'Client', value: r.remoteAddr},
+    {name: 'Protocol', value: r.proto},
+    {name: 'Target', value: f.targetUrl},
+    {name: 'Size', value: sizeBreakdown(r)},
+  ].filter(p => p.value), 'Connection');
+  const ct = r.headers?.['Content-Type']?.[0]||'';
+  if (r.body && ct.toLowerCase().startsWith('multipart/')) {
+    // Parts are parsed server-side; fill the table in once they arrive.
+    h += '<div class="section" id="parts"><div class="section-title">Parts</div><div class="empty">Loading…</div></div>';
+    loadParts(f.id);
+  } else if (r.body) {
+    h += '<div class="section"><div class="section-title">Body</div>';
+    h += renderBody(ct, atob_safe(r.body), f.id, 'request');
+    h += '</div>';
+  }
+  if (r.body && r.bodyTruncated) h += '<span style="color:var(--red);font-size:11px">… body truncated ('+fmtSize(r.size)+' total)</span>';
+  if (!r.body && r.bodyTruncated) {
+    h += '<div class="section"><div class="section-title">Body</div><div class="empty">Not captured ('+fmtSize(r.size)+')</div></div>';
+  }
+  h += renderHeaders(r.trailers, 'Trailers');
+  h += renderMeta(f.meta);
+  return h;
+}
+
+// renderTimings draws the flow's timing phases as a waterfall.
+function renderTimings(t) {
+  if (!t) return '';
+  const phases = ['proxy', 'blocked', 'dns', 'connect', 'tls', 'send', 'wait', 'receive'];
+  const total = phases.reduce((sum, p) => sum + t[p], 0);
+  if (!total) return '';
+  let h = '<div class="section"><div class="section-title">Timings' +
+    (t.reused ? ' <span style="color:var(--fg2);font-size:11px">(reused connection'+(t.remoteAddr ? ' to '+escHtml(t.remoteAddr) : '')+')</span>' :
+      t.remoteAddr ? ' <span style="color:var(--fg2);font-size:11px">('+escHtml(t.remoteAddr)+')</span>' : '') + '</div>';
+  let offset = 0;
+  for (const p of phases) {
+    if (t[p] <= 0) continue;
+    h += '<div class="wf-row"><span class="wf-label">'+p+'</span><span class="wf-track">' +
+      '<span class="wf-bar '+p+'" style="left:'+(offset/total*100)+'%;width:'+(t[p]/total*100)+'%"></span></span>' +
+      '<span class="wf-ms">'+fmtMs(t[p])+'</span></div>';
+    offset += t[p];
+  }
+  return h + '</div>';
+}
+
+async function loadParts(id) {
+  const r = await fetch('/api/flows/'+id+'/parts');
+  const el = document.getElementById('parts');
+  if (!el || selectedId !== id) return;
+  if (!r.ok) {
+    el.innerHTML = '<div class="section-title">Parts</div><div style="color:var(--red)">'+escHtml(await r.text())+'</div>';
+    return;
+  }
+  const parts = await r.json();
+  let h = '<div class="section-title">Parts ('+parts.length+')</div><table class="headers-table">';
+  h += '<tr><td>Name</td><td>Filename</td><td>Type</td><td>Size</td><td></td></tr>';
+  parts.forEach((p, i) => {
+    h += '<tr><td>'+escHtml(p.name)+'</td><td>'+escHtml(p.filename||'')+'</td><td>'+escHtml(p.contentType||'')+'</td>'+
+      '<td>'+fmtSize(p.size)+(p.truncated ? ' <span style="color:var(--red)">(truncated)</span>' : '')+'</td>'+
+      '<td><a href="/api/flows/'+id+'/parts/'+i+'" download>download</a></td></tr>';
+  });
+  el.innerHTML = h + '</table>';
+}
+
+function renderResponsePane(f) {
+  if (!f.response) {
+    if (f.error) return '<h3>Response</h3><div style="color:var(--red)">'+escHtml(f.error)+'</div>'+renderAssertions(f.assertions)+renderTimings(f.timings);
+    return '<h3>Response</h3><div class="empty">Pending…</div>';
+  }
+  const r = f.response;
+  const cls = r.statusCode>=500?'status-5xx':r.statusCode>=400?'status-4xx':r.statusCode>=300?'status-3xx':'status-2xx';
+  let h = '<h3>Response</h3>';
+  h += '<div class="section"><div class="section-title"><span class="'+cls+'">'+r.statusCode+'</span>' +
+    ' <span style="color:var(--fg2)">'+sizeBreakdown(r)+'</span></div></div>';
+  h += renderAssertions(f.assertions);
+  h += renderTimings(f.timings);
+  h += renderHeaders(r.headers);
+  h += renderPairs(r.setCookies, 'Set-Cookie', cookieAttrs);
+  if (r.body) {
+    h += '<div class="section"><div class="section-title">Body</div>';
+    h += renderBody(r.headers?.['Content-Type']?.[0]||'', atob_safe(r.body), f.id, 'response');
+    if (r.bodyTruncated) h += '<span style="color:var(--red);font-size:11px">… body truncated ('+fmtSize(r.size)+' total)</span>';
+    h += '</div>';
+  } else if (r.bodyTruncated) {
+    h += '<div class="section"><div class="section-title">Body</div><div class="empty">Not captured ('+fmtSize(r.size)+')</div></div>';
+  }
+  h += renderHeaders(r.trailers, 'Trailers');
+  return h;
+}
+
+// renderAssertions shows the outcome of the checks a replay was sent with.
+function renderAssertions(a) {
+  if (!a) return '';
+  let h = '<div class="section"><div class="section-title">Assertions: <span class="'+(a.passed ? 'status-2xx' : 'status-5xx')+'">'+
+    (a.passed ? 'passed' : (a.failures.length+' of '+a.checks+' failed'))+'</span></div>';
+  if (a.failures?.length) {
+    h += '<table class="headers-table">';
+    for (const c of a.failures) h += '<tr><td>'+escHtml(c.check)+'</td><td>'+escHtml(c.message)+'</td></tr>';
+    h += '</table>';
+  }
+  return h + '</div>';
+}
+
+// renderPairs renders [{name, value}] as a table; extra(item), if given,
+// returns text appended to each value.
+// renderReplayLinks links a replay to its original and an original to each
+// of its replays, newest first.
+function renderReplayLinks(f) {
+  const link = id => '<a href="#" class="flow-link" onclick="jumpToFlow(\''+escHtml(id)+'\');return false">'+
+    escHtml(id.slice(0,8))+'</a>';
+  let h = '';
+  if (f.replayOf) h += '<div>Replay of '+link(f.replayOf)+'</div>';
+  if (f.replays?.length) {
+    h += '<div>Replays: '+f.replays.slice().reverse().map(link).join(' ')+
+      ' <button class="curl-btn" onclick="diffSelected()">Diff latest</button></div>';
+  }
+  return h ? '<div class="section"><div class="section-title">Replays</div>'+h+'</div>' : '';
+}
+
+// jumpToFlow selects a linked flow, if it is still stored.
+function jumpToFlow(id) {
+  if (!flows.has(id)) { notify('Flow '+id.slice(0,8)+' is no longer stored'); return; }
+  selectFlow(id);
+}
+
+function renderPairs(items, title, extra) {
+  if (!items || items.length === 0) return '';
+  let h = '<div class="section"><div class="section-title">'+title+'</div><table class="headers-table">';
+  for (const it of items) {
+    const more = extra ? extra(it) : '';
+    h += '<tr><td>'+escHtml(it.name)+'</td><td>'+escHtml(it.value)+
+      (more ? ' <span style="color:var(--fg2)">'+escHtml(more)+'</span>' : '')+'</td></tr>';
+  }
+  return h + '</table></div>';
+}
+
+function cookieAttrs(c) {
+  const a = [];
+  if (c.domain) a.push('Domain='+c.domain);
+  if (c.path) a.push('Path='+c.path);
+  if (c.expires) a.push('Expires='+new Date(c.expires).toUTCString());
+  if (c.maxAge) a.push('Max-Age='+c.maxAge);
+  if (c.httpOnly) a.push('HttpOnly');
+  if (c.secure) a.push('Secure');
+  if (c.sameSite) a.push('SameSite='+c.sameSite);
+  return a.join('; ');
+}
+
+// renderMeta shows addon data (e.g. decoded JWTs) in collapsible sections.
+function renderMeta(meta) {
+  let h = '';
+  for (const k of Object.keys(meta || {}).sort()) {
+    const v = meta[k];
+    let summary = k.toUpperCase() + (Array.isArray(v) ? ' ('+v.length+')' : '');
+    if (k === 'jwt' && Array.isArray(v)) {
+      const bad = v.filter(t => t.expired || t.notYetValid || t.signature === 'invalid').length;
+      if (bad) summary += ' <span style="color:var(--red)">'+bad+' failing</span>';
+    }
+    if (k === 'soap' && v) {
+      if (v.operation) summary += ' '+escHtml(v.operation);
+      if (v.fault) summary += ' <span style="color:var(--red)">fault '+escHtml(v.fault.code)+'</span>';
+    }
+    h += '<details class="section"><summary class="section-title">'+summary+'</summary>';
+    h += '<pre class="body">'+escHtml(JSON.stringify(v, null, 2))+'</pre></details>';
+  }
+  return h;
+}
+
+function renderHeaders(hdrs, title) {
+  if (!hdrs || Object.keys(hdrs).length === 0) return '';
+  let h = '<div class="section"><div class="section-title">'+(title||'Headers')+'</div><table class="headers-table">';
+  for (const [k, vv] of Object.entries(hdrs)) {
+    for (const v of vv) {
+      h += '<tr><td>'+escHtml(k)+'</td><td>'+escHtml(v)+'</td></tr>';
+    }
+  }
+  h += '</table></div>';
+  return h;
+}
+
+// renderBody renders a body as an interactive tree when it is JSON, and as
+// text otherwise. Other formats (XML, forms, protobuf, ...) are formatted
+// server-side; the raw text shows until that arrives.
+function renderBody(ct, body, id, part) {
+  if ((ct||'').includes('json')) {
+    try { return renderJSONTree(JSON.parse(body)); } catch(e) {}
+  }
+  const pre = '<pre class="body">'+escHtml(prettyBody(ct, body))+'</pre>';
+  if (!id || !body) return pre;
+  loadPretty(id, part);
+  return '<div id="pretty-'+part+'">'+pre+'</div>';
+}
+
+async function loadPretty(id, part) {
+  const r = await fetch('/api/flows/'+id+'/pretty?part='+part);
+  const el = document.getElementById('pretty-'+part);
+  if (!el || selectedId !== id || r.status !== 200) return;
+  const p = await r.json();
+  el.innerHTML = '<span style="color:var(--fg2);font-size:11px">formatted as '+escHtml(p.formatter)+'</span>' +
+    '<pre class="body">'+escHtml(p.text)+'</pre>';
+}
+
+// --- JSON tree ---
+// Objects and arrays are collapsible <details> elements; the first levels
+// start open. Clicking a key copies its JSON path ($.items[0].id).
+const jsonTreeOpenDepth = 2;
+
+function renderJSONTree(v) {
+  return '<div class="json-tree"><div class="jt-tools">' +
+    '<input placeholder="search keys and values" oninput="searchJSONTree(this)">' +
+    '<button class="curl-btn" type="button" onclick="expandJSONTree(this, true)">Expand all</button>' +
+    '<button class="curl-btn" type="button" onclick="expandJSONTree(this, false)">Collapse all</button>' +
+    '</div>' + jsonNode(v, '$', null, 0) + '</div>';
+}
+
+function jsonNode(v, path, key, depth) {
+  const label = key === null ? '' :
+    '<span class="jt-key" data-path="'+escHtml(path)+'" title="Copy '+escHtml(path)+'">'+escHtml(key)+'</span>: ';
+  if (v === null || typeof v !== 'object') {
+    const cls = v === null ? 'null' : typeof v;
+    return '<div class="jt-leaf">'+label+'<span class="jt-'+cls+'">'+escHtml(JSON.stringify(v))+'</span></div>';
+  }
+  const arr = Array.isArray(v);
+  const entries = arr ? v.map((x, i) => [i, x]) : Object.entries(v);
+  const [open, close] = arr ? ['[', ']'] : ['{', '}'];
+  if (!entries.length) return '<div class="jt-leaf">'+label+open+close+'</div>';
+  let h = '<details class="jt-node"'+(depth < jsonTreeOpenDepth ? ' open' : '')+'><summary>'+label+open+
+    ' <span class="jt-count">'+entries.length+(arr ? ' item' : ' key')+(entries.length === 1 ? '' : 's')+'</span></summary>';
+  for (const [k, x] of entries) h += jsonNode(x, jsonPath(path, k, arr), String(k), depth+1);
+  return h + '<div>'+close+'</div></details>';
+}
+
+function jsonPath(path, k, arr) {
+  if (arr) return path+'['+k+']';
+  return /^[A-Za-z_$][\w$]*$/.test(k) ? path+'.'+k : path+'['+JSON.stringify(k)+']';
+}
+
+// searchJSONTree highlights the leaves whose key or value contains the
+// query, opening the nodes above them.
+function searchJSONTree(input) {
+  const q = input.value.trim().toLowerCase();
+  const tree = input.closest('.json-tree');
+  let hits = 0;
+  for (const el of tree.querySelectorAll('.jt-leaf')) {
+    const hit = q !== '' && el.textContent.toLowerCase().includes(q);
+    el.classList.toggle('jt-hit', hit);
+    if (!hit) continue;
+    hits++;
+    for (let d = el.closest('details'); d; d = d.parentElement.closest('details')) d.open = true;
+  }
+  input.title = q ? hits + ' matches' : '';
+  tree.querySelector('.jt-hit')?.scrollIntoView({block: 'nearest'});
+}
+
+function expandJSONTree(btn, open) {
+  for (const d of btn.closest('.json-tree').querySelectorAll('details')) d.open = open;
+}
+
+document.addEventListener('click', e => {
+  const key = e.target.closest('.jt-key');
+  if (!key) return;
+  e.preventDefault(); // don't toggle the node
+  navigator.clipboard?.writeText(key.dataset.path);
+  notify('Copied ' + key.dataset.path);
+});
+
+function prettyBody(ct, body) {
+  if (!body) return '';
+  if ((ct||'').includes('json')) {
+    try { return JSON.stringify(JSON.parse(body), null, 2); } catch(e) {}
+  }
+  return body.slice(0, 10000);
+}
+
+function atob_safe(b64) {
+  if (!b64) return '';
+  try { return atob(b64); } catch(e) { return b64; }
+}
+
+// --- Actions ---
+async function replaySelected() {
+  if (!selectedId) return;
+  const r = await fetch('/api/flows/'+selectedId+'/replay', {method:'POST'});
+  if (r.ok) {
+    notify('Replaying…');
+  } else {
+    notify('Replay failed: ' + await r.text());
+  }
+}
+
+// tagSelected edits the selected flow's tags: words are added, words
+// prefixed with "-" are removed.
+async function tagSelected() {
+  const f = flows.get(selectedId);
+  if (!f) return;
+  const input = prompt('Tags to add (prefix with - to remove):', '');
+  if (!input) return;
+  const body = {add: [], remove: []};
+  for (const t of input.split(/[\s,]+/).filter(Boolean)) {
+    if (t.startsWith('-')) body.remove.push(t.slice(1)); else body.add.push(t);
+  }
+  const r = await fetch('/api/flows/'+f.id+'/tags', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Tagging failed: ' + await r.text()); return; }
+  const updated = await r.json();
+  flows.set(updated.id, updated);
+  applyFilter();
+  selectFlow(updated.id);
+}
+
+// annotateSelected edits the selected flow's note; an empty note clears it.
+async function annotateSelected() {
+  const f = flows.get(selectedId);
+  if (!f) return;
+  const note = prompt('Note (kept in exports):', f.note || '');
+  if (note === null) return;
+  const r = await fetch('/api/flows/'+f.id, {
+    method: 'PATCH', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({note}),
+  });
+  if (!r.ok) { notify('Saving note failed: ' + await r.text()); return; }
+  const updated = await r.json();
+  flows.set(updated.id, updated);
+  selectFlow(updated.id);
+}
+
+async function togglePin() {
+  const f = flows.get(selectedId);
+  if (!f) return;
+  const r = await fetch('/api/flows/'+f.id, {
+    method: 'PATCH', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({pinned: !f.pinned}),
+  });
+  if (!r.ok) { notify('Pin failed: ' + await r.text()); return; }
+  const updated = await r.json();
+  flows.set(updated.id, updated);
+  selectFlow(updated.id);
+}
+
+// --- Diff ---
+let markedId = null;
+
+function markSelected() {
+  if (!selectedId) return;
+  markedId = markedId === selectedId ? null : selectedId;
+  notify(markedId ? 'Marked as diff base' : 'Mark cleared');
+}
+
+// diffSelected diffs the selected flow against the marked flow or, failing
+// that, against the flow it was replayed from. An original with replays is
+// diffed against its newest one.
+async function diffSelected() {
+  const f = flows.get(selectedId);
+  if (!f) return;
+  let base = markedId && markedId !== f.id ? markedId : f.replayOf;
+  let other = f.id;
+  if (!base && f.replays?.length) [base, other] = [f.id, 'latest-replay'];
+  if (!base) { notify('Mark a flow to diff against first'); return; }
+  const r = await fetch('/api/flows/'+base+'/diff/'+other+'?ignore=Date');
+  if (!r.ok) { notify('Diff failed: ' + await r.text()); return; }
+  renderDiff(await r.json());
+}
+
+function renderDiff(d) {
+  const val = v => v === undefined ? '∅' : escHtml(JSON.stringify(v));
+  let h = '<h3>Diff '+escHtml(d.a.slice(0,8))+' → '+escHtml(d.b.slice(0,8))+' <span style="color:var(--fg2);font-size:11px">(Date ignored)</span></h3>';
+  if (d.equal) h += '<div class="diff-add">Flows are identical</div>';
+  for (const c of d.changes) {
+    if (c.op === 'added') h += '<div class="diff-add">+ '+escHtml(c.path)+': '+val(c.b)+'</div>';
+    else if (c.op === 'removed') h += '<div class="diff-del">- '+escHtml(c.path)+': '+val(c.a)+'</div>';
+    else h += '<div><span class="diff-chg">~ '+escHtml(c.path)+'</span>: <span class="diff-del">'+val(c.a)+'</span> → <span class="diff-add">'+val(c.b)+'</span></div>';
+  }
+  document.getElementById('req-pane').innerHTML = h;
+
+  const lines = (title, ls) => {
+    if (!ls || !ls.length) return '';
+    let s = '<div class="section"><div class="section-title">'+title+'</div><pre class="body">';
+    for (const l of ls) {
+      const cls = l.op === '+' ? 'diff-add' : l.op === '-' ? 'diff-del' : '';
+      s += '<span class="'+cls+'">'+escHtml(l.op+' '+l.text)+'</span>\n';
+    }
+    return s + '</pre></div>';
+  };
+  document.getElementById('resp-pane').innerHTML =
+    (lines('Request body', d.requestBody) + lines('Response body', d.responseBody)) ||
+    '<div class="empty">No text body differences</div>';
+}
+
+// compareChecked shows the two checked flows side by side, older on the
+// left, using the line diffs from GET /api/flows/{a}/diff/{b}?lines=true.
+async function compareChecked() {
+  if (checkedIds.length !== 2) { notify('Ctrl/Cmd-click two flows to compare'); return; }
+  const [a, b] = [...checkedIds].sort((x, y) => filteredIds.indexOf(x) - filteredIds.indexOf(y));
+  const r = await fetch('/api/flows/'+a+'/diff/'+b+'?ignore=Date&lines=true');
+  if (!r.ok) { notify('Compare failed: ' + await r.text()); return; }
+  const d = await r.json();
+  const fa = flows.get(a), fb = flows.get(b);
+  const summary = f => [(f.request?.method||'-')+' '+(f.request?.url||''), 'Status: '+(f.response?.statusCode || f.error || '-')];
+  const sections = [
+    ['Request', diffSummary(summary(fa), summary(fb))],
+    ['Request headers', d.requestHeaders],
+    ['Request body', d.requestBody],
+    ['Response headers', d.responseHeaders],
+    ['Response body', d.responseBody],
+  ];
+  let left = '<h3>'+escHtml(a.slice(0,8))+'</h3>', right = '<h3>'+escHtml(b.slice(0,8))+'</h3>';
+  for (const [title, lines] of sections) {
+    if (!lines || !lines.length) continue;
+    const [l, r] = sideBySide(lines);
+    left += '<div class="section"><div class="section-title">'+title+'</div><div class="sbs">'+l+'</div></div>';
+    right += '<div class="section"><div class="section-title">'+title+'</div><div class="sbs">'+r+'</div></div>';
+  }
+  document.getElementById('req-pane').innerHTML = left;
+  document.getElementById('resp-pane').innerHTML = right;
+  document.getElementById('detail-title').innerHTML = 'Compare' + (d.equal ? ' <span class="diff-add">(identical, Date ignored)</span>' :
+    ' <span style="color:var(--fg2);font-size:11px">('+d.changes.length+' changes, Date ignored)</span>');
+}
+
+// diffSummary pairs two line lists as a diff, one line per row.
+function diffSummary(a, b) {
+  const out = [];
+  a.forEach((l, i) => {
+    if (l === b[i]) out.push({op: ' ', text: l});
+    else out.push({op: '-', text: l}, {op: '+', text: b[i]});
+  });
+  return out;
+}
+
+// sideBySide lays out a line diff as two columns with the same number of
+// rows: removed lines opposite the added lines that replace them, and blank
+// padding opposite lines that only one side has.
+function sideBySide(lines) {
+  let l = '', r = '';
+  const row = (cls, text) => '<div class="'+cls+'">'+(text === null ? '' : escHtml(text))+'</div>';
+  for (let i = 0; i < lines.length;) {
+    if (lines[i].op === ' ') {
+      l += row('', lines[i].text);
+      r += row('', lines[i].text);
+      i++;
+      continue;
+    }
+    const del = [], add = [];
+    for (; i < lines.length && lines[i].op !== ' '; i++) (lines[i].op === '-' ? del : add).push(lines[i].text);
+    for (let j = 0; j < Math.max(del.length, add.length); j++) {
+      const both = j < del.length && j < add.length;
+      l += j < del.length ? row(both ? 'chg' : 'del', del[j]) : row('pad', null);
+      r += j < add.length ? row(both ? 'chg' : 'add', add[j]) : row('pad', null);
+    }
+  }
+  return [l, r];
+}
+
+// newRequest shows a form that accepts a curl command or raw HTTP request.
+function newRequest() {
+  let h = '<h3>New request</h3>';
+  h += '<form class="edit-form" id="new-form" onsubmit="sendNewRequest(event)">';
+  h += '<label>curl command or raw HTTP request</label>';
+  h += '<textarea name="command" style="min-height:200px" placeholder="curl http://localhost:9090/api/users -H \'Accept: application/json\'"></textarea>';
+  h += '<label>Target</label><input name="target" placeholder="upstream name or base URL (default: routed)">';
+  h += '<div style="margin-top:8px"><button class="replay-btn" type="submit">Send</button></div>';
+  h += '</form>';
+  document.getElementById('req-pane').innerHTML = h;
+  document.getElementById('resp-pane').innerHTML = '';
+  document.getElementById('detail-title').textContent = 'New request';
+}
+
+async function sendNewRequest(e) {
+  e.preventDefault();
+  const form = e.target;
+  const body = { command: form.command.value, target: form.elements['target'].value.trim() };
+  const r = await fetch('/api/flows/curl', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Send failed: ' + await r.text()); return; }
+  const f = await r.json();
+  flows.set(f.id, f);
+  selectFlow(f.id);
+}
+
+// --- Compose ---
+// The compose form builds a request from scratch and sends it with
+// POST /api/requests. The draft is kept, so Compose reopens it after a send.
+const composeMethods = ['GET', 'POST', 'PUT', 'PATCH', 'DELETE', 'HEAD', 'OPTIONS'];
+let composeDraft = { method: 'GET', url: '/', headers: '', body: '', target: '' };
+
+function compose() {
+  const d = composeDraft;
+  let h = '<h3>Compose</h3>';
+  h += '<form class="edit-form" id="compose-form" onsubmit="sendComposed(event)" oninput="saveComposeDraft(this)">';
+  h += '<label>Method</label><select name="method">' + composeMethods.map(m =>
+    '<option'+(m === d.method ? ' selected' : '')+'>'+m+'</option>').join('') + '</select>';
+  h += '<label>URL</label><input name="url" value="'+escHtml(d.url)+'" placeholder="/api/users">';
+  h += '<label>Headers</label><textarea name="headers" placeholder="Content-Type: application/json">'+escHtml(d.headers)+'</textarea>';
+  h += '<label>Body <button class="curl-btn" type="button" onclick="formatComposeBody()">Format JSON</button></label>';
+  h += '<textarea name="body" style="min-height:200px">'+escHtml(d.body)+'</textarea>';
+  h += '<label>Target</label><input name="target" value="'+escHtml(d.target)+'" placeholder="upstream name or base URL (default: routed)">';
+  h += '<div style="margin-top:8px"><button class="replay-btn" type="submit">Send</button></div>';
+  h += '</form>';
+  document.getElementById('req-pane').innerHTML = h;
+  document.getElementById('resp-pane').innerHTML = '';
+  document.getElementById('detail-title').textContent = 'Compose';
+}
+
+function saveComposeDraft(form) {
+  composeDraft = {
+    method: form.method.value, url: form.url.value, headers: form.headers.value,
+    body: form.body.value, target: form.elements['target'].value,
+  };
+}
+
+// formatComposeBody pretty-prints a JSON body and, if no Content-Type is
+// set, adds one.
+function formatComposeBody() {
+  const form = document.getElementById('compose-form');
+  let v;
+  try { v = JSON.parse(form.body.value); } catch(e) { notify('Body is not valid JSON: ' + e.message); return; }
+  form.body.value = JSON.stringify(v, null, 2);
+  if (!/^content-type\s*:/im.test(form.headers.value)) {
+    form.headers.value = (form.headers.value.trim() ? form.headers.value.trimEnd() + '\n' : '') + 'Content-Type: application/json\n';
+  }
+  saveComposeDraft(form);
+}
+
+async function sendComposed(e) {
+  e.preventDefault();
+  const form = e.target;
+  saveComposeDraft(form);
+  const body = readEditForm(form);
+  body.target = form.elements['target'].value.trim();
+  const r = await fetch('/api/requests', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Send failed: ' + await r.text()); return; }
+  const f = await r.json();
+  flows.set(f.id, f);
+  selectFlow(f.id);
+}
+
+async function bulkReplay() {
+  const filter = document.getElementById('filter-input').value.trim();
+  const concurrency = parseInt(prompt('Replay flows matching "' + (filter || 'all') + '" with concurrency:', '1'), 10);
+  if (!concurrency) return;
+  const r = await fetch('/api/flows/replay', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({ filter, concurrency }),
+  });
+  notify(r.ok ? 'Replay job started' : 'Replay failed: ' + await r.text());
+}
+
+function exportGoTest() {
+  if (!selectedId) return;
+  const a = document.createElement('a');
+  a.href = '/api/flows/'+selectedId+'/export?format=gotest';
+  a.click();
+}
+
+function copyCURL() {
+  if (!selectedId) return;
+  const f = flows.get(selectedId);
+  if (!f) return;
+  const curl = toCURL(f);
+  navigator.clipboard?.writeText(curl);
+  notify('Copied cURL command');
+}
+
+async function resumeSelected() {
+  if (!selectedId) return;
+  const r = await fetch('/api/flows/'+selectedId+'/resume', {method:'POST'});
+  notify(r.ok ? 'Resumed' : 'Resume failed: ' + await r.text());
+}
+
+async function killSelected() {
+  if (!selectedId) return;
+  const r = await fetch('/api/flows/'+selectedId+'/kill', {method:'POST'});
+  notify(r.ok ? 'Killed' : 'Kill failed: ' + await r.text());
+}
+
+function editSelected() {
+  const f = flows.get(selectedId);
+  if (!f || !f.request) return;
+  document.getElementById('req-pane').innerHTML = renderEditForm(f, 'replay');
+}
+
+function cancelEdit() {
+  const f = flows.get(selectedId);
+  if (f) document.getElementById('req-pane').innerHTML = renderRequestPane(f);
+}
+
+// readEditForm converts the edit form into a RequestEdit JSON object.
+function readEditForm(form) {
+  const headers = {};
+  for (const line of form.headers.value.split('\n')) {
+    const i = line.indexOf(':');
+    if (i <= 0) continue;
+    const k = line.slice(0, i).trim();
+    (headers[k] = headers[k] || []).push(line.slice(i+1).trim());
+  }
+  return { method: form.method.value, url: form.url.value, headers, body: form.body.value };
+}
+
+async function sendEdited(e) {
+  e.preventDefault();
+  const form = e.target;
+  const body = readEditForm(form);
+  body.target = form.elements['target'].value.trim();
+  const r = await fetch('/api/flows/'+form.dataset.id+'/replay', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Replay failed: ' + await r.text()); return; }
+  const f = await r.json();
+  flows.set(f.id, f);
+  selectFlow(f.id);
+  notify('Sent edited request');
+}
+
+async function saveAndResume(e) {
+  e.preventDefault();
+  const form = e.target;
+  const id = form.dataset.id;
+  const edit = readEditForm(form);
+  const r = await fetch('/api/flows/'+id+'/request', {
+    method: 'PATCH', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(edit),
+  });
+  if (!r.ok) { notify('Edit failed: ' + await r.text()); return; }
+  form.dataset.id = '';
+  const rr = await fetch('/api/flows/'+id+'/resume', {method:'POST'});
+  notify(rr.ok ? 'Edited and resumed' : 'Resume failed: ' + await rr.text());
+}
+
+async function saveResponseAndResume(e) {
+  e.preventDefault();
+  const form = e.target;
+  const id = form.dataset.id;
+  const edit = { statusCode: parseInt(form.status.value, 10), headers: readEditForm(form).headers };
+  const f = flows.get(id);
+  // Leave a body that was only partly captured alone unless it was changed.
+  if (!f?.response?.bodyTruncated || form.body.value !== atob_safe(f.response.body)) edit.body = form.body.value;
+  const r = await fetch('/api/flows/'+id+'/response', {
+    method: 'PATCH', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(edit),
+  });
+  if (!r.ok) { notify('Edit failed: ' + await r.text()); return; }
+  form.dataset.id = '';
+  const rr = await fetch('/api/flows/'+id+'/resume', {method:'POST'});
+  notify(rr.ok ? 'Edited and resumed' : 'Resume failed: ' + await rr.text());
+}
+
+async function toggleIntercept() {
+  const enabled = !interceptOn;
+  const body = { enabled, filter: document.getElementById('intercept-input').value.trim() };
+  const r = await fetch('/api/intercept', {
+    method: 'PUT', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body),
+  });
+  if (!r.ok) { notify('Intercept failed: ' + await r.text()); return; }
+  setInterceptState(await r.json());
+}
+
+function setInterceptState(st) {
+  interceptOn = st.enabled;
+  const btn = document.getElementById('intercept-btn');
+  btn.textContent = 'Intercept: ' + (st.enabled ? 'on' : 'off');
+  btn.className = 'btn' + (st.enabled ? ' active' : '');
+  if (st.enabled) document.getElementById('intercept-input').value = st.filter || '';
+}
+
+// clearFlows clears unpinned flows; shift-click clears pinned ones too.
+async function clearFlows(force) {
+  await fetch('/api/flows' + (force ? '?force=true' : ''), {method:'DELETE'});
+  flows.clear();
+  const kept = await (await fetch('/api/flows')).json();
+  for (const f of kept || []) flows.set(f.id, f);
+  applyFilter();
+  selectedId = null;
+  renderTable();
+  updateStats();
+  resetDetail();
+}
+
+// deleteFlow removes one flow; the delete event updates the list.
+async function deleteFlow(e, id) {
+  e.stopPropagation();
+  const r = await fetch('/api/flows/' + id, {method:'DELETE'});
+  if (!r.ok) notify(await r.text());
+}
+
+// deleteMatching removes the unpinned flows matching the filter.
+async function deleteMatching() {
+  if (!filterExpr) { notify('Enter a filter to delete matching flows'); return; }
+  const r = await fetch('/api/flows?filter=' + encodeURIComponent(filterExpr), {method:'DELETE'});
+  if (!r.ok) { notify(await r.text()); return; }
+  const res = await r.json();
+  notify('Deleted ' + res.deleted.length + ' flows');
+}
+
+// resetDetail empties the detail pane when no flow is selected.
+function resetDetail() {
+  document.getElementById('req-pane').innerHTML = '<div class="empty">Select a flow to inspect</div>';
+  document.getElementById('resp-pane').innerHTML = '';
+  document.getElementById('detail-title').textContent = 'Select a flow';
+  document.getElementById('replay-btn').style.display = 'none';
+  document.getElementById('edit-btn').style.display = 'none';
+  document.getElementById('curl-btn').style.display = 'none';
+  document.getElementById('gotest-btn').style.display = 'none';
+  document.getElementById('tag-btn').style.display = 'none';
+  document.getElementById('note-btn').style.display = 'none';
+  document.getElementById('pin-btn').style.display = 'none';
+  document.getElementById('mark-btn').style.display = 'none';
+  document.getElementById('diff-btn').style.display = 'none';
+  document.getElementById('resume-btn').style.display = 'none';
+  document.getElementById('kill-btn').style.display = 'none';
+}
+
+// saveSession writes all flows to a session file in the proxy's session
+// directory, to be reopened with `http-proxy open FILE`.
+async function saveSession() {
+  const path = (prompt('Save session in the proxy\'s session directory as (.hpz, .json, or .har):', 'session.hpz') || '').trim();
+  if (!path) return;
+  const save = overwrite => fetch('/api/session/save', {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({path, overwrite}),
+  });
+  let r = await save(false);
+  if (r.status === 409) {
+    if (!confirm(path + ' already exists. Replace it?')) return;
+    r = await save(true);
+  }
+  if (!r.ok) { notify('Save failed: ' + await r.text()); return; }
+  const res = await r.json();
+  notify('Saved ' + res.flows + ' flows to ' + res.path);
+}
+
+function exportHAR() {
+  // The server builds the HAR so it matches `http-proxy record` output.
+  const a = document.createElement('a');
+  a.href = '/api/export?format=har';
+  a.click();
+}
+
+function exportCSV() {
+  // One row per flow matching the filter, for pivoting in a spreadsheet.
+  const a = document.createElement('a');
+  a.href = '/api/flows/export?format=csv&filter=' + encodeURIComponent(filterExpr);
+  a.click();
+}
+
+// --- Helpers ---
+function toCURL(f) {
+  if (!f.request) return '';
+  let cmd = 'curl -X ' + f.request.method + " '" + f.request.url + "'";
+  for (const [k, vv] of Object.entries(f.request.headers||{})) {
+    const lk = k.toLowerCase();
+    if (lk === 'connection' || lk === 'transfer-encoding') continue;
+    for (const v of vv) cmd += " \\\n  -H '" + k + ': ' + v + "'";
+  }
+  if (f.request.body) cmd += " \\\n  -d '" + atob_safe(f.request.body).replace(/'/g, "'\\''") + "'";
+  return cmd;
+}
+
+function durationMs(f) {
+  if (!f.timestamps) return 0;
+  const start = new Date(f.timestamps.created).getTime();
+  const end = f.timestamps.responseDone ? new Date(f.timestamps.responseDone).getTime() : Date.now();
+  return end - start;
+}
+
+// wireSize is a captured message's full length: headers plus the whole body,
+// even when the captured body was truncated.
+function wireSize(m) {
+  return (m.headersSize || 0) + Math.max(m.size || 0, bodyLen(m.body));
+}
+
+// sizeBreakdown describes a message's length as total, headers, and body.
+function sizeBreakdown(m) {
+  const body = Math.max(m.size || 0, bodyLen(m.body));
+  return fmtSize(wireSize(m)) + ' (' + fmtSize(m.headersSize || 0) + ' headers + ' + fmtSize(body) + ' body)';
+}
+
+function bodyLen(b) {
+  if (!b) return 0;
+  try { return atob(b).length; } catch(e) { return b.length; }
+}
+
+function fmtDur(ms) {
+  if (ms < 1) return '<1ms';
+  if (ms < 1000) return ms + 'ms';
+  return (ms/1000).toFixed(1) + 's';
+}
+
+function fmtSize(n) {
+  if (n === 0) return '0';
+  if (n < 1024) return n + 'B';
+  if (n < 1024*1024) return (n/1024).toFixed(1) + 'K';
+  return (n/1024/1024).toFixed(1) + 'M';
+}
+
+function escHtml(s) {
+  return String(s).replace(/&/g,'&amp;').replace(/</g,'&lt;').replace(/>/g,'&gt;').replace(/"/g,'&quot;');
+}
+
+function notify(msg) {
+  const el = document.getElementById('notice');
+  el.textContent = msg;
+  el.style.display = 'block';
+  clearTimeout(el._timer);
+  el._timer = setTimeout(() => { el.style.display = 'none'; }, 3000);
+}
+
+// loadFlows loads the stored flows a page at a time, so a large store fills
+// the table progressively instead of arriving as one huge response.
+const loadPageSize = 1000;
+
+async function loadFlows() {
+  const stored = [];
+  let merged = new Set();
+  for (let offset = 0; ; offset += loadPageSize) {
+    const r = await fetch('/api/flows?limit='+loadPageSize+'&offset='+offset);
+    if (!r.ok) return;
+    const page = await r.json();
+    stored.push(...page.flows);
+    // Stored flows come first, in capture order, then any that arrived over
+    // the WebSocket meanwhile. A WebSocket copy is the newer one, and a
+    // stored flow missing from flows since the last merge was deleted.
+    const live = new Map(flows);
+    flows.clear();
+    for (const f of stored) {
+      if (merged.has(f.id) && !live.has(f.id)) continue;
+      flows.set(f.id, live.get(f.id) || f);
+    }
+    for (const [id, f] of live) if (!flows.has(id)) flows.set(id, f);
+    merged = new Set(flows.keys());
+    applyFilter();
+    updateStats();
+    if (page.flows.length < loadPageSize) return;
+  }
+}
+
+loadFlows();
+
+fetch('/api/intercept').then(r => r.json()).then(setInterceptState);
+loadViews();
+
+connect();
@@ -1,6 +1,47 @@
 package web
 
-import "embed"
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+)
 
+// The web UI is plain static files: index.html, app.css, and app.js. They
+// are embedded in the binary, or served from a directory on disk with
+// Server.SetUIDir.
+//
 //go:embed static
 var staticFS embed.FS
+
+// embeddedUI returns the UI files compiled into the binary.
+func embeddedUI() fs.FS {
+	ui, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err) // the embed pattern guarantees the directory
+	}
+	return ui
+}
+
+// SourceDir returns pkg/web/static in the checkout the binary was built
+// from, for editing the UI without rebuilding (http-proxy web --dev). It fails
+// for binaries built elsewhere or with -trimpath.
+func SourceDir() (string, error) {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", fmt.Errorf("source location unknown")
+	}
+	dir := filepath.Join(filepath.Dir(file), "static")
+	if err := checkUIDir(dir); err != nil {
+		return "", fmt.Errorf("web UI sources not found; pass --web-ui-dir: %w", err)
+	}
+	return dir, nil
+}
+
+// checkUIDir reports whether dir looks like a web UI directory.
+func checkUIDir(dir string) error {
+	_, err := os.Stat(filepath.Join(dir, "index.html"))
+	return err
+}